@@ -1,15 +1,20 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/handler"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/storage"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -40,6 +45,73 @@ func main() {
 	if port == "" {
 		port = "8083"
 	}
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET must be set")
+	}
+	jwtDuration, err := time.ParseDuration(os.Getenv("JWT_DURATION"))
+	if err != nil {
+		jwtDuration = 15 * time.Minute
+	}
+	// MRN_TEMPLATE placeholders: {FACILITY}, {YYYY}, {YY}, {SEQ:n}, {CHECK}
+	mrnFormat, err := service.NewMRNFormat(os.Getenv("MRN_TEMPLATE"), os.Getenv("FACILITY_CODE"))
+	if err != nil {
+		log.Fatal("Invalid MRN configuration:", err)
+	}
+	// EWS_ALERT_THRESHOLDS overrides the escalation levels of early warning
+	// scores, e.g. "NEWS2:urgent=5,emergency=7;PEWS:urgent=3,emergency=5"
+	ewsThresholds, err := service.ParseEarlyWarningThresholds(os.Getenv("EWS_ALERT_THRESHOLDS"))
+	if err != nil {
+		log.Fatal("Invalid early warning configuration:", err)
+	}
+	// Child growth z-scores need the WHO Anthro reference files (weianthro.txt,
+	// lenanthro.txt, wflanthro.txt, wfhanthro.txt, acanthro.txt) in GROWTH_STANDARDS_DIR
+	growthStandards, err := service.LoadGrowthStandards(os.Getenv("GROWTH_STANDARDS_DIR"))
+	if err != nil {
+		log.Fatal("Invalid growth standards:", err)
+	}
+	if growthStandards == nil {
+		log.Println("GROWTH_STANDARDS_DIR is not set; child malnutrition is classified on MUAC and oedema only")
+	}
+	// PROGRAM_FOLLOW_UP_DAYS overrides the days between follow-up visits of
+	// chronic disease programs, e.g. "hypertension=30,diabetes=90"
+	programSchedules, err := service.ParseProgramFollowUpSchedules(os.Getenv("PROGRAM_FOLLOW_UP_DAYS"))
+	if err != nil {
+		log.Fatal("Invalid program follow-up schedules:", err)
+	}
+	// NCD screening CVD risk needs the WHO risk charts of the region as CSV in
+	// CVD_RISK_CHARTS (chart,sex,diabetes,smoker,age,sbp,factor,risk)
+	cvdRiskCharts, err := service.LoadCVDRiskCharts(os.Getenv("CVD_RISK_CHARTS"))
+	if err != nil {
+		log.Fatal("Invalid CVD risk charts:", err)
+	}
+	if cvdRiskCharts == nil {
+		log.Println("CVD_RISK_CHARTS is not set; NCD screenings are assessed without CVD risk")
+	}
+	// Patient card QR codes are signed with CARD_SIGNING_KEY. Without it a key is
+	// derived from JWT_SECRET, so rotating that secret invalidates printed cards.
+	cardSigningKey := []byte(os.Getenv("CARD_SIGNING_KEY"))
+	if len(cardSigningKey) == 0 {
+		log.Println("CARD_SIGNING_KEY is not set; deriving the patient card key from JWT_SECRET")
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte("patient-card"))
+		cardSigningKey = mac.Sum(nil)
+	}
+
+	// Object storage for patient photos: the local filesystem by default, or an
+	// S3-compatible store with STORAGE_BACKEND=s3
+	store, err := storage.New(storage.Config{
+		Backend:         os.Getenv("STORAGE_BACKEND"),
+		Dir:             os.Getenv("STORAGE_DIR"),
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		Region:          os.Getenv("S3_REGION"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		log.Fatal("Invalid storage configuration:", err)
+	}
 
 	// Database connection
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
@@ -54,53 +126,74 @@ func main() {
 
 	// Auto-migrate models
 	log.Println("Running database migrations...")
-	err = db.AutoMigrate(
-		&models.User{},
-		&models.Patient{},
-		&models.Encounter{},
-		&models.VitalSigns{},
-		&models.ClinicalNote{},
-		&models.Invoice{},
-		&models.InvoiceItem{},
-		&models.Payment{},
-		&models.InsuranceClaim{},
-		&models.ImagingStudy{},
-		&models.ImagingSeries{},
-		&models.ImagingInstance{},
-		&models.RadiologyReport{},
-		&models.Medication{},
-		&models.Prescription{},
-		&models.LabTest{},
-		&models.LabOrder{},
-		&models.LabResult{},
-		&models.Appointment{},
-		&models.Ward{},
-		&models.Room{},
-		&models.Bed{},
-		&models.Admission{},
-		&models.Transfer{},
-		&models.DischargeSummary{},
-		&models.PharmacyStock{},
-		&models.Dispensing{},
-		&models.StockMovement{},
-	)
+	err = db.AutoMigrate(models.All()...)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	auditRepo := repository.NewAuditRepository(db)
+	if err := auditRepo.InstallImmutabilityTrigger(); err != nil {
+		log.Fatal("Failed to protect audit trail:", err)
+	}
+	if err := repository.RegisterAuditCallbacks(db); err != nil {
+		log.Fatal("Failed to register audit callbacks:", err)
+	}
+
 	// Initialize Repositories
+	userRepo := repository.NewUserRepository(db)
 	patientRepo := repository.NewPatientRepository(db)
+	patientDuplicateRepo := repository.NewPatientDuplicateRepository(db)
+	patientMergeRepo := repository.NewPatientMergeRepository(db)
+	householdRepo := repository.NewHouseholdRepository(db)
+	patientPhotoRepo := repository.NewPatientPhotoRepository(db)
+	consentRepo := repository.NewConsentRepository(db)
 	encounterRepo := repository.NewEncounterRepository(db)
+	triageRepo := repository.NewTriageRepository(db)
+	queueRepo := repository.NewQueueRepository(db)
 	vitalSignsRepo := repository.NewVitalSignsRepository(db)
+	deviceRepo := repository.NewDeviceRepository(db)
+	ncdScreeningRepo := repository.NewNCDScreeningRepository(db)
+	programRepo := repository.NewProgramEnrolmentRepository(db)
+	questionnaireRepo := repository.NewQuestionnaireRepository(db)
 	clinicalNoteRepo := repository.NewClinicalNoteRepository(db)
 	medicationRepo := repository.NewMedicationRepository(db)
 	labRepo := repository.NewLabRepository(db)
 	appointmentRepo := repository.NewAppointmentRepository(db)
 
+	if err := patientRepo.BackfillNameKeys(); err != nil {
+		log.Fatal("Failed to index patient names:", err)
+	}
+	if err := patientRepo.InstallSearchIndexes(); err != nil {
+		log.Fatal("Failed to create patient search indexes:", err)
+	}
+	if err := patientRepo.BackfillIdentifiers(); err != nil {
+		log.Fatal("Failed to migrate patient identifiers:", err)
+	}
+	if err := encounterRepo.BackfillStatusHistory(); err != nil {
+		log.Fatal("Failed to start encounter status history:", err)
+	}
+	if err := vitalSignsRepo.BackfillAbnormalFlags(); err != nil {
+		log.Fatal("Failed to flag vital signs:", err)
+	}
+
 	// Initialize Services
-	patientService := service.NewPatientService(patientRepo)
+	authService := service.NewAuthService(userRepo, jwtSecret, jwtDuration)
+	auditService := service.NewAuditService(auditRepo)
+	patientService := service.NewPatientService(patientRepo, patientDuplicateRepo, patientMergeRepo, mrnFormat)
+	patientCardService := service.NewPatientCardService(patientService, cardSigningKey, mrnFormat.Facility())
+	householdService := service.NewHouseholdService(householdRepo, patientService)
+	patientPhotoService := service.NewPatientPhotoService(patientPhotoRepo, patientService, store)
+	patientCardService.SetPhotoLoader(patientPhotoService.CardPhoto)
+	consentService := service.NewConsentService(consentRepo, patientService)
 	encounterService := service.NewEncounterService(encounterRepo)
-	vitalSignsService := service.NewVitalSignsService(vitalSignsRepo)
+	triageService := service.NewTriageService(triageRepo, encounterRepo)
+	queueService := service.NewQueueService(queueRepo, patientService, encounterService, service.NewQueueBroker())
+	vitalSignsService := service.NewVitalSignsService(vitalSignsRepo, patientService, ewsThresholds)
+	deviceService := service.NewDeviceService(deviceRepo, vitalSignsService)
+	growthService := service.NewGrowthService(vitalSignsRepo, patientService, growthStandards)
+	programService := service.NewProgramService(programRepo, patientService, encounterService, programSchedules)
+	ncdScreeningService := service.NewNCDScreeningService(ncdScreeningRepo, encounterService, vitalSignsService, programService, cvdRiskCharts)
+	questionnaireService := service.NewQuestionnaireService(questionnaireRepo, patientService, encounterService)
 	clinicalNoteService := service.NewClinicalNoteService(clinicalNoteRepo)
 
 	cdsService := service.NewCDSService()
@@ -110,12 +203,25 @@ func main() {
 	appointmentService := service.NewAppointmentService(appointmentRepo)
 
 	// Initialize Handlers
-	patientHandler := handler.NewPatientHandler(patientService)
+	authHandler := handler.NewAuthHandler(authService)
+	auditHandler := handler.NewAuditHandler(auditService)
+	patientHandler := handler.NewPatientHandler(patientService, auditService)
+	patientCardHandler := handler.NewPatientCardHandler(patientCardService, auditService)
+	householdHandler := handler.NewHouseholdHandler(householdService, auditService)
+	patientPhotoHandler := handler.NewPatientPhotoHandler(patientPhotoService, auditService)
+	consentHandler := handler.NewConsentHandler(consentService, auditService)
 	encounterHandler := handler.NewEncounterHandler(encounterService)
+	triageHandler := handler.NewTriageHandler(triageService, auditService)
+	queueHandler := handler.NewQueueHandler(queueService)
 	vitalSignsHandler := handler.NewVitalSignsHandler(vitalSignsService)
-	clinicalNoteHandler := handler.NewClinicalNoteHandler(clinicalNoteService)
-	medicationHandler := handler.NewMedicationHandler(medicationService, patientService)
-	labHandler := handler.NewLabHandler(labService)
+	growthHandler := handler.NewGrowthHandler(growthService)
+	deviceHandler := handler.NewDeviceHandler(deviceService)
+	ncdScreeningHandler := handler.NewNCDScreeningHandler(ncdScreeningService, auditService)
+	programHandler := handler.NewProgramHandler(programService, auditService)
+	questionnaireHandler := handler.NewQuestionnaireHandler(questionnaireService, auditService)
+	clinicalNoteHandler := handler.NewClinicalNoteHandler(clinicalNoteService, auditService)
+	medicationHandler := handler.NewMedicationHandler(medicationService, patientService, auditService)
+	labHandler := handler.NewLabHandler(labService, auditService)
 	appointmentHandler := handler.NewAppointmentHandler(appointmentService)
 
 	// Initialize ADT
@@ -140,13 +246,23 @@ func main() {
 	pharmacyService := service.NewPharmacyService(pharmacyRepo)
 	pharmacyHandler := handler.NewPharmacyHandler(pharmacyService)
 
+	// Initialize FHIR R4 facade
+	fhirRepo := repository.NewFHIRRepository(db)
+	fhirService := service.NewFHIRService(fhirRepo, patientService, encounterService, appointmentService,
+		labService, vitalSignsService, medicationService, radiologyService)
+	fhirHandler := handler.NewFHIRHandler(fhirService, auditService)
+
 	// Initialize Portal
+	portalDelegationRepo := repository.NewPortalDelegationRepository(db)
+	portalAccessService := service.NewPortalAccessService(portalDelegationRepo, householdRepo, userRepo, patientService, consentService)
 	portalHandler := handler.NewPortalHandler(
 		patientService,
 		appointmentService,
 		labService,
 		medicationService,
 		clinicalNoteService,
+		portalAccessService,
+		auditService,
 	)
 
 	// Setup Router
@@ -167,121 +283,284 @@ func main() {
 		c.Next()
 	})
 
+	// Role policies (ADMIN is always allowed)
+	adminOnly := middleware.RequireRole()
+	doctorOnly := middleware.RequireRole(models.RoleDoctor)
+	pharmacistOnly := middleware.RequireRole(models.RolePharmacist)
+	clinicianOnly := middleware.RequireRole(models.RoleDoctor, models.RoleNurse)
+	staffOnly := middleware.RequireRole(models.RoleDoctor, models.RoleNurse, models.RolePharmacist)
+	patientOnly := middleware.RequireRole(models.RolePatient)
+	complianceOnly := middleware.RequireRole(models.RoleCompliance)
+
+	// Auth Routes (public)
+	auth := r.Group("/api/v1/auth")
+	{
+		auth.POST("/login", authHandler.Login)
+		auth.POST("/refresh", authHandler.Refresh)
+	}
+
+	// Queue display screens (public; token numbers only)
+	r.GET("/api/v1/display/queues", queueHandler.GetDisplay)
+	r.GET("/api/v1/display/queues/events", queueHandler.DisplayEvents)
+
+	// Device ingestion (authenticated by device key)
+	ingest := r.Group("/api/v1/device-ingest")
+	ingest.Use(middleware.RequireDevice(deviceService))
+	{
+		ingest.POST("/readings", deviceHandler.IngestReading)
+		ingest.POST("/hl7", deviceHandler.IngestHL7)
+	}
+
 	api := r.Group("/api/v1")
+	api.Use(middleware.RequireAuth(authService))
 	{
+		api.POST("/auth/logout", authHandler.Logout)
+
 		// Insurance Routes
 		insurance := api.Group("/insurance")
 		{
-			insurance.POST("/claims", billingHandler.SubmitClaim)
-			insurance.GET("/claims/:id", billingHandler.GetClaim)
-			insurance.GET("/claims/pending", billingHandler.GetPendingClaims)
-			insurance.POST("/claims/:id/approve", billingHandler.ApproveClaim)
-			insurance.POST("/claims/:id/reject", billingHandler.RejectClaim)
+			insurance.POST("/claims", staffOnly, billingHandler.SubmitClaim)
+			insurance.GET("/claims/:id", staffOnly, billingHandler.GetClaim)
+			insurance.GET("/claims/pending", adminOnly, billingHandler.GetPendingClaims)
+			insurance.POST("/claims/:id/approve", adminOnly, billingHandler.ApproveClaim)
+			insurance.POST("/claims/:id/reject", adminOnly, billingHandler.RejectClaim)
 		}
 
 		// Radiology Routes
 		radiology := api.Group("/radiology")
 		{
-			radiology.POST("/studies", radiologyHandler.CreateStudy)
-			radiology.GET("/studies", radiologyHandler.ListStudies)
-			radiology.GET("/studies/:id", radiologyHandler.GetStudy)
-			radiology.PUT("/studies/:id/status", radiologyHandler.UpdateStatus)
-			radiology.GET("/worklist", radiologyHandler.GetWorklist)
-
-			radiology.POST("/reports", radiologyHandler.CreateReport)
-			radiology.PUT("/reports/:id", radiologyHandler.UpdateReport)
+			radiology.POST("/studies", clinicianOnly, radiologyHandler.CreateStudy)
+			radiology.GET("/studies", clinicianOnly, radiologyHandler.ListStudies)
+			radiology.GET("/studies/:id", clinicianOnly, radiologyHandler.GetStudy)
+			radiology.PUT("/studies/:id/status", clinicianOnly, radiologyHandler.UpdateStatus)
+			radiology.GET("/worklist", clinicianOnly, radiologyHandler.GetWorklist)
+
+			radiology.POST("/reports", doctorOnly, radiologyHandler.CreateReport)
+			radiology.PUT("/reports/:id", doctorOnly, radiologyHandler.UpdateReport)
 		}
 		// Patient Routes
-		api.POST("/patients", patientHandler.CreatePatient)
-		api.GET("/patients/:id", patientHandler.GetPatient)
-		api.PUT("/patients/:id", patientHandler.UpdatePatient)
-		api.DELETE("/patients/:id", patientHandler.DeletePatient)
-		api.GET("/patients", patientHandler.ListPatients)
-		api.GET("/patients/search", patientHandler.SearchPatients)
-		api.GET("/patients/:id/history", patientHandler.GetPatientHistory)
+		api.POST("/patients", staffOnly, patientHandler.CreatePatient)
+		api.GET("/patients/:id", staffOnly, patientHandler.GetPatient)
+		api.PUT("/patients/:id", staffOnly, patientHandler.UpdatePatient)
+		api.DELETE("/patients/:id", adminOnly, patientHandler.DeletePatient)
+		api.GET("/patients", staffOnly, patientHandler.ListPatients)
+		api.GET("/patients/search", staffOnly, patientHandler.SearchPatients)
+		api.GET("/patients/identifier", staffOnly, patientHandler.FindByIdentifier)
+		api.GET("/patients/identifier-systems", staffOnly, patientHandler.ListIdentifierSystems)
+		api.GET("/patients/:id/card", staffOnly, patientCardHandler.GetCard)
+		api.POST("/patients/:id/photo", staffOnly, patientPhotoHandler.UploadPhoto)
+		api.GET("/patients/:id/photo", staffOnly, patientPhotoHandler.GetPhoto)
+		api.DELETE("/patients/:id/photo", staffOnly, patientPhotoHandler.DeletePhoto)
+		api.POST("/patients/lookup-by-qr", staffOnly, patientCardHandler.LookupByQR)
+		api.GET("/patients/duplicates", staffOnly, patientHandler.ListDuplicates)
+		api.POST("/patients/duplicates/:id/dismiss", staffOnly, patientHandler.DismissDuplicate)
+		api.GET("/patients/mrn/:mrn", staffOnly, patientHandler.GetPatientByMRN)
+		api.POST("/patients/:id/merge", adminOnly, patientHandler.MergePatient)
+		api.GET("/patients/:id/merges", staffOnly, patientHandler.ListMerges)
+		api.POST("/patients/merges/:id/unmerge", adminOnly, patientHandler.UnmergePatient)
+		api.GET("/patients/:id/history", clinicianOnly, patientHandler.GetPatientHistory)
+		api.GET("/patients/:id/household", staffOnly, householdHandler.GetPatientHousehold)
+		api.PUT("/patients/:id/mother", staffOnly, householdHandler.SetMother)
+		api.GET("/patients/:id/children", staffOnly, householdHandler.ListChildren)
+		api.POST("/patients/:id/consents", staffOnly, consentHandler.RecordConsent)
+		api.GET("/patients/:id/consents", staffOnly, consentHandler.ListPatientConsents)
+
+		// Consent Routes
+		api.GET("/consents/:id", staffOnly, consentHandler.GetConsent)
+		api.POST("/consents/:id/withdraw", staffOnly, consentHandler.WithdrawConsent)
+
+		// Household Routes
+		api.POST("/households", staffOnly, householdHandler.CreateHousehold)
+		api.GET("/households/search", staffOnly, householdHandler.SearchHouseholds)
+		api.GET("/households/:id", staffOnly, householdHandler.GetHousehold)
+		api.PUT("/households/:id", staffOnly, householdHandler.UpdateHousehold)
+		api.PUT("/households/:id/head", staffOnly, householdHandler.ChangeHead)
+		api.POST("/households/:id/members", staffOnly, householdHandler.AddMember)
+		api.PUT("/households/:id/members/:patientId", staffOnly, householdHandler.UpdateMember)
+		api.POST("/households/:id/members/:patientId/remove", staffOnly, householdHandler.RemoveMember)
 
 		// Encounter Routes
-		api.POST("/encounters", encounterHandler.CreateEncounter)
-		api.GET("/encounters/:id", encounterHandler.GetEncounter)
-		api.PUT("/encounters/:id", encounterHandler.UpdateEncounter)
-		api.PUT("/encounters/:id/status", encounterHandler.UpdateStatus)
-		api.GET("/patients/:id/encounters", encounterHandler.ListPatientEncounters)
+		api.POST("/encounters", clinicianOnly, encounterHandler.CreateEncounter)
+		api.GET("/encounters/:id", clinicianOnly, encounterHandler.GetEncounter)
+		api.PUT("/encounters/:id", clinicianOnly, encounterHandler.UpdateEncounter)
+		api.PUT("/encounters/:id/status", clinicianOnly, encounterHandler.UpdateStatus)
+		api.GET("/encounters/:id/status-history", clinicianOnly, encounterHandler.GetStatusHistory)
+		api.GET("/encounters/wait-times", clinicianOnly, encounterHandler.GetWaitTimes)
+		api.GET("/patients/:id/encounters", clinicianOnly, encounterHandler.ListPatientEncounters)
+
+		// Emergency triage
+		api.GET("/triage/discriminators", clinicianOnly, triageHandler.ListDiscriminators)
+		api.POST("/encounters/:id/triage", clinicianOnly, triageHandler.TriageEncounter)
+		api.GET("/encounters/:id/triage", clinicianOnly, triageHandler.GetTriage)
+		api.GET("/er/board", clinicianOnly, triageHandler.GetBoard)
+
+		// Queue Routes
+		api.GET("/queues", staffOnly, queueHandler.ListQueues)
+		api.POST("/queues/:point/check-in", staffOnly, queueHandler.CheckIn)
+		api.POST("/queues/:point/call-next", staffOnly, queueHandler.CallNext)
+		api.GET("/queues/:point/tokens", staffOnly, queueHandler.ListTokens)
+		api.GET("/queue-tokens/:id", staffOnly, queueHandler.GetToken)
+		api.POST("/queue-tokens/:id/call", staffOnly, queueHandler.CallToken)
+		api.POST("/queue-tokens/:id/skip", staffOnly, queueHandler.SkipToken)
+		api.POST("/queue-tokens/:id/requeue", staffOnly, queueHandler.RequeueToken)
+		api.POST("/queue-tokens/:id/complete", staffOnly, queueHandler.CompleteToken)
+		api.POST("/queue-tokens/:id/transfer", staffOnly, queueHandler.TransferToken)
 
 		// Vital Signs Routes
-		api.POST("/vital-signs", vitalSignsHandler.CreateVitalSigns)
-		api.GET("/vital-signs/:id", vitalSignsHandler.GetVitalSigns)
-		api.GET("/encounters/:id/vital-signs", vitalSignsHandler.ListEncounterVitalSigns)
-		api.GET("/patients/:id/vital-signs", vitalSignsHandler.ListPatientVitalSigns)
+		api.POST("/vital-signs", clinicianOnly, vitalSignsHandler.CreateVitalSigns)
+		api.GET("/vital-signs/reference-ranges", clinicianOnly, vitalSignsHandler.ListReferenceRanges)
+		api.GET("/vital-signs/pending", clinicianOnly, vitalSignsHandler.ListPendingDeviceReadings)
+		api.POST("/vital-signs/:id/validate", clinicianOnly, vitalSignsHandler.ValidateDeviceReading)
+		api.POST("/vital-signs/:id/reject", clinicianOnly, vitalSignsHandler.RejectDeviceReading)
+		api.GET("/vital-signs/:id", clinicianOnly, vitalSignsHandler.GetVitalSigns)
+		api.GET("/encounters/:id/vital-signs", clinicianOnly, vitalSignsHandler.ListEncounterVitalSigns)
+		api.GET("/patients/:id/vital-signs", clinicianOnly, vitalSignsHandler.ListPatientVitalSigns)
+		api.GET("/patients/:id/vital-signs/trends", clinicianOnly, vitalSignsHandler.GetVitalSignsTrends)
+		api.GET("/patients/:id/growth", clinicianOnly, growthHandler.GetPatientGrowth)
+		api.GET("/early-warning/alerts", clinicianOnly, vitalSignsHandler.ListEarlyWarningAlerts)
+		api.POST("/early-warning/alerts/:id/acknowledge", clinicianOnly, vitalSignsHandler.AcknowledgeEarlyWarningAlert)
+
+		// NCD Screening Routes
+		api.GET("/ncd-screenings/checklists", clinicianOnly, ncdScreeningHandler.GetChecklists)
+		api.POST("/ncd-screenings", clinicianOnly, ncdScreeningHandler.StartScreening)
+		api.GET("/ncd-screenings", clinicianOnly, ncdScreeningHandler.ListScreenings)
+		api.GET("/ncd-screenings/:id", clinicianOnly, ncdScreeningHandler.GetScreening)
+		api.PUT("/ncd-screenings/:id/part-b", clinicianOnly, ncdScreeningHandler.UpdatePartB)
+		api.PUT("/ncd-screenings/:id/part-c", doctorOnly, ncdScreeningHandler.RecordPartC)
+		api.POST("/ncd-screenings/:id/enrol", clinicianOnly, ncdScreeningHandler.Enrol)
+		api.GET("/encounters/:id/ncd-screening", clinicianOnly, ncdScreeningHandler.GetEncounterScreening)
+		api.GET("/patients/:id/ncd-screenings", clinicianOnly, ncdScreeningHandler.ListPatientScreenings)
+
+		// Chronic Disease Program Routes
+		api.GET("/programs/schedules", clinicianOnly, programHandler.GetSchedules)
+		api.GET("/programs/defaulters", clinicianOnly, programHandler.ListDefaulters)
+		api.GET("/programs/indicators", clinicianOnly, programHandler.GetIndicators)
+		api.POST("/program-enrolments", clinicianOnly, programHandler.Enrol)
+		api.GET("/program-enrolments", clinicianOnly, programHandler.ListEnrolments)
+		api.GET("/program-enrolments/:id", clinicianOnly, programHandler.GetEnrolment)
+		api.POST("/program-enrolments/:id/visits", clinicianOnly, programHandler.RecordVisit)
+		api.POST("/program-enrolments/:id/exit", clinicianOnly, programHandler.Exit)
+		api.GET("/patients/:id/program-enrolments", clinicianOnly, programHandler.ListPatientEnrolments)
+
+		// Form and Questionnaire Routes
+		api.POST("/questionnaires", adminOnly, questionnaireHandler.CreateQuestionnaire)
+		api.GET("/questionnaires", staffOnly, questionnaireHandler.ListQuestionnaires)
+		api.GET("/questionnaires/:id", staffOnly, questionnaireHandler.GetQuestionnaire)
+		api.PUT("/questionnaires/:id", adminOnly, questionnaireHandler.UpdateQuestionnaire)
+		api.POST("/questionnaires/:id/status", adminOnly, questionnaireHandler.SetQuestionnaireStatus)
+		api.POST("/questionnaires/:id/validate", clinicianOnly, questionnaireHandler.ValidateResponse)
+		api.POST("/questionnaire-responses", clinicianOnly, questionnaireHandler.SubmitResponse)
+		api.GET("/questionnaire-responses/:id", clinicianOnly, questionnaireHandler.GetResponse)
+		api.PUT("/questionnaire-responses/:id", clinicianOnly, questionnaireHandler.UpdateResponse)
+		api.GET("/questionnaire-responses/:id/observations", clinicianOnly, questionnaireHandler.GetResponseObservations)
+		api.GET("/patients/:id/questionnaire-responses", clinicianOnly, questionnaireHandler.ListPatientResponses)
+		api.GET("/encounters/:id/questionnaire-responses", clinicianOnly, questionnaireHandler.ListEncounterResponses)
 
 		// Clinical Notes Routes
-		api.POST("/clinical-notes", clinicalNoteHandler.CreateNote)
-		api.GET("/clinical-notes/:id", clinicalNoteHandler.GetNote)
-		api.PUT("/clinical-notes/:id", clinicalNoteHandler.UpdateNote)
-		api.POST("/clinical-notes/:id/sign", clinicalNoteHandler.SignNote)
-		api.GET("/encounters/:id/clinical-notes", clinicalNoteHandler.ListEncounterNotes)
-		api.GET("/patients/:id/clinical-notes", clinicalNoteHandler.ListPatientNotes)
+		api.POST("/clinical-notes", clinicianOnly, clinicalNoteHandler.CreateNote)
+		api.GET("/clinical-notes/:id", clinicianOnly, clinicalNoteHandler.GetNote)
+		api.PUT("/clinical-notes/:id", clinicianOnly, clinicalNoteHandler.UpdateNote)
+		api.POST("/clinical-notes/:id/sign", doctorOnly, clinicalNoteHandler.SignNote)
+		api.GET("/encounters/:id/clinical-notes", clinicianOnly, clinicalNoteHandler.ListEncounterNotes)
+		api.GET("/patients/:id/clinical-notes", clinicianOnly, clinicalNoteHandler.ListPatientNotes)
 
 		// Medication Routes
-		api.POST("/medications", medicationHandler.CreateMedication)
-		api.GET("/medications/search", medicationHandler.SearchMedications)
+		api.POST("/medications", pharmacistOnly, medicationHandler.CreateMedication)
+		api.GET("/medications/search", staffOnly, medicationHandler.SearchMedications)
 
 		// Prescription Routes
-		api.POST("/prescriptions", medicationHandler.CreatePrescription)
-		api.GET("/prescriptions/:id", medicationHandler.GetPrescription)
-		api.POST("/prescriptions/:id/discontinue", medicationHandler.DiscontinuePrescription)
-		api.GET("/patients/:id/prescriptions", medicationHandler.ListPatientPrescriptions)
+		api.POST("/prescriptions", doctorOnly, medicationHandler.CreatePrescription)
+		api.GET("/prescriptions/:id", staffOnly, medicationHandler.GetPrescription)
+		api.POST("/prescriptions/:id/discontinue", doctorOnly, medicationHandler.DiscontinuePrescription)
+		api.GET("/patients/:id/prescriptions", staffOnly, medicationHandler.ListPatientPrescriptions)
 
 		// Lab Routes
-		api.POST("/lab-tests", labHandler.CreateLabTest)
-		api.GET("/lab-tests", labHandler.ListLabTests)
-		api.POST("/lab-orders", labHandler.CreateLabOrder)
-		api.GET("/lab-orders/:id", labHandler.GetLabOrder)
-		api.GET("/patients/:id/lab-orders", labHandler.ListPatientLabOrders)
-		api.POST("/lab-results", labHandler.AddLabResult)
+		api.POST("/lab-tests", adminOnly, labHandler.CreateLabTest)
+		api.GET("/lab-tests", clinicianOnly, labHandler.ListLabTests)
+		api.POST("/lab-orders", doctorOnly, labHandler.CreateLabOrder)
+		api.GET("/lab-orders/:id", clinicianOnly, labHandler.GetLabOrder)
+		api.GET("/patients/:id/lab-orders", clinicianOnly, labHandler.ListPatientLabOrders)
+		api.POST("/lab-results", clinicianOnly, labHandler.AddLabResult)
 
 		// Appointment Routes
-		api.POST("/appointments", appointmentHandler.CreateAppointment)
-		api.GET("/appointments/:id", appointmentHandler.GetAppointment)
-		api.PUT("/appointments/:id", appointmentHandler.UpdateAppointment)
-		api.POST("/appointments/:id/cancel", appointmentHandler.CancelAppointment)
-		api.GET("/appointments", appointmentHandler.ListAppointments)
-		api.GET("/patients/:id/appointments", appointmentHandler.ListPatientAppointments)
+		api.POST("/appointments", staffOnly, appointmentHandler.CreateAppointment)
+		api.GET("/appointments/:id", staffOnly, appointmentHandler.GetAppointment)
+		api.PUT("/appointments/:id", staffOnly, appointmentHandler.UpdateAppointment)
+		api.POST("/appointments/:id/cancel", staffOnly, appointmentHandler.CancelAppointment)
+		api.POST("/appointments/:id/reminder-sent", staffOnly, appointmentHandler.MarkReminderSent)
+		api.GET("/appointments/reminders/due", staffOnly, appointmentHandler.ListDueReminders)
+		api.GET("/appointments", staffOnly, appointmentHandler.ListAppointments)
+		api.GET("/patients/:id/appointments", staffOnly, appointmentHandler.ListPatientAppointments)
 
 		// ADT Routes
-		api.POST("/wards", adtHandler.CreateWard)
-		api.GET("/wards", adtHandler.ListWards)
-		api.POST("/rooms", adtHandler.CreateRoom)
-		api.POST("/beds", adtHandler.CreateBed)
-		api.GET("/beds", adtHandler.ListBeds)
-		api.POST("/admissions", adtHandler.AdmitPatient)
-		api.POST("/admissions/:id/discharge", adtHandler.DischargePatient)
-		api.GET("/admissions/active", adtHandler.ListActiveAdmissions)
-		api.GET("/admissions/:id", adtHandler.GetAdmission)
-		api.POST("/transfers", adtHandler.TransferPatient)
-		api.GET("/transfers", adtHandler.ListTransfers)
-		api.POST("/discharge-summaries", adtHandler.CreateDischargeSummary)
-		api.GET("/admissions/:id/discharge-summary", adtHandler.GetDischargeSummary)
+		api.POST("/wards", adminOnly, adtHandler.CreateWard)
+		api.GET("/wards", clinicianOnly, adtHandler.ListWards)
+		api.GET("/wards/:id/early-warning", clinicianOnly, vitalSignsHandler.GetWardEarlyWarning)
+		api.POST("/rooms", adminOnly, adtHandler.CreateRoom)
+		api.POST("/beds", adminOnly, adtHandler.CreateBed)
+		api.GET("/beds", clinicianOnly, adtHandler.ListBeds)
+		api.POST("/admissions", clinicianOnly, adtHandler.AdmitPatient)
+		api.POST("/admissions/:id/discharge", doctorOnly, adtHandler.DischargePatient)
+		api.GET("/admissions/active", clinicianOnly, adtHandler.ListActiveAdmissions)
+		api.GET("/admissions/:id", clinicianOnly, adtHandler.GetAdmission)
+		api.POST("/transfers", clinicianOnly, adtHandler.TransferPatient)
+		api.GET("/transfers", clinicianOnly, adtHandler.ListTransfers)
+		api.POST("/discharge-summaries", doctorOnly, adtHandler.CreateDischargeSummary)
+		api.GET("/admissions/:id/discharge-summary", clinicianOnly, adtHandler.GetDischargeSummary)
+
+		// Bedside Device Routes (readings arrive through /api/v1/device-ingest)
+		api.POST("/devices", adminOnly, deviceHandler.RegisterDevice)
+		api.GET("/devices", adminOnly, deviceHandler.ListDevices)
+		api.GET("/devices/:id", adminOnly, deviceHandler.GetDevice)
+		api.PUT("/devices/:id", adminOnly, deviceHandler.UpdateDevice)
+		api.POST("/devices/:id/rotate-key", adminOnly, deviceHandler.RotateDeviceKey)
 
 		// Reporting Routes
-		api.GET("/reports/daily-opd", reportingHandler.GetDailyOPDReport)
-		api.GET("/reports/disease-surveillance", reportingHandler.GetDiseaseSurveillanceReport)
+		api.GET("/reports/daily-opd", staffOnly, reportingHandler.GetDailyOPDReport)
+		api.GET("/reports/disease-surveillance", staffOnly, reportingHandler.GetDiseaseSurveillanceReport)
 
 		// Pharmacy Routes
-		api.POST("/pharmacy/stock", pharmacyHandler.AddStock)
-		api.GET("/pharmacy/stock/:medication_id", pharmacyHandler.GetStock)
-		api.GET("/pharmacy/stock/low", pharmacyHandler.GetLowStock)
-		api.POST("/pharmacy/dispense", pharmacyHandler.DispenseMedication)
-		api.GET("/pharmacy/dispensing-queue", pharmacyHandler.GetDispensingQueue)
-		api.GET("/:patient_id/history", pharmacyHandler.GetPatientHistory)
-		api.GET("/movements/:medication_id", pharmacyHandler.GetStockMovements)
+		api.POST("/pharmacy/stock", pharmacistOnly, pharmacyHandler.AddStock)
+		api.GET("/pharmacy/stock/:medication_id", pharmacistOnly, pharmacyHandler.GetStock)
+		api.GET("/pharmacy/stock/low", pharmacistOnly, pharmacyHandler.GetLowStock)
+		api.POST("/pharmacy/dispense", pharmacistOnly, pharmacyHandler.DispenseMedication)
+		api.GET("/pharmacy/dispensing-queue", pharmacistOnly, pharmacyHandler.GetDispensingQueue)
+		api.GET("/:patient_id/history", pharmacistOnly, pharmacyHandler.GetPatientHistory)
+		api.GET("/movements/:medication_id", pharmacistOnly, pharmacyHandler.GetStockMovements)
 
 		// Portal Routes
-		portal := api.Group("/portal")
+		portal := api.Group("/portal", patientOnly)
 		{
 			portal.GET("/dashboard", portalHandler.GetDashboard)
 			portal.GET("/appointments", portalHandler.GetAppointments)
 			portal.GET("/records", portalHandler.GetRecords)
+			portal.GET("/delegations", portalHandler.GetDelegatedPatients)
+			portal.GET("/dependents", portalHandler.GetDependents)
+			portal.GET("/access-log", portalHandler.GetAccessLog)
 		}
+
+		// Audit Routes
+		api.GET("/audit", complianceOnly, auditHandler.ListEvents)
+		api.GET("/audit/verify", complianceOnly, auditHandler.VerifyChain)
+
+		// Portal Delegation Routes (caregiver/proxy access)
+		api.POST("/portal-delegations", staffOnly, portalHandler.CreateDelegation)
+		api.POST("/portal-delegations/dependents", staffOnly, portalHandler.DelegateDependents)
+		api.POST("/portal-delegations/:id/revoke", staffOnly, portalHandler.RevokeDelegation)
+		api.GET("/patients/:id/portal-delegations", staffOnly, portalHandler.ListPatientDelegations)
+	}
+
+	// FHIR R4 Routes
+	r.GET(handler.FHIRBasePath+"/metadata", fhirHandler.Capabilities)
+	fhirAPI := r.Group(handler.FHIRBasePath)
+	fhirAPI.Use(middleware.RequireAuth(authService))
+	{
+		fhirAPI.GET("/:type", staffOnly, fhirHandler.Search)
+		fhirAPI.GET("/:type/:id", staffOnly, fhirHandler.Read)
+		fhirAPI.POST("/:type", clinicianOnly, fhirHandler.Create)
+		fhirAPI.PUT("/:type/:id", clinicianOnly, fhirHandler.Update)
+		fhirAPI.GET("/:type/:id/$everything", staffOnly, fhirHandler.Everything)
+		fhirAPI.GET("/$export", adminOnly, fhirHandler.Export)
 	}
 
 	log.Printf("Zarish-HIS server starting on :%s", port)
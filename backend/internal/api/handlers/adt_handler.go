@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"zarish-his/backend/internal/api/middleware"
 	"zarish-his/backend/internal/domain/models"
 	"zarish-his/backend/internal/service/clinical"
 )
@@ -23,7 +24,7 @@ func (h *ADTHandler) CreateWard(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.CreateWard(&ward); err != nil {
+	if err := h.service.CreateWard(c.Request.Context(), &ward); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -31,12 +32,16 @@ func (h *ADTHandler) CreateWard(c *gin.Context) {
 }
 
 func (h *ADTHandler) ListWards(c *gin.Context) {
-	wards, err := h.service.ListWards()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+	wards, err := h.service.ListWards(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, wards)
+	respondList(c, wards, query)
 }
 
 func (h *ADTHandler) CreateRoom(c *gin.Context) {
@@ -45,7 +50,7 @@ func (h *ADTHandler) CreateRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.CreateRoom(&room); err != nil {
+	if err := h.service.CreateRoom(c.Request.Context(), &room); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -58,7 +63,7 @@ func (h *ADTHandler) CreateBed(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.CreateBed(&bed); err != nil {
+	if err := h.service.CreateBed(c.Request.Context(), &bed); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -66,13 +71,16 @@ func (h *ADTHandler) CreateBed(c *gin.Context) {
 }
 
 func (h *ADTHandler) ListBeds(c *gin.Context) {
-	status := c.Query("status")
-	beds, err := h.service.ListBeds(status)
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+	beds, err := h.service.ListBeds(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, beds)
+	respondList(c, beds, query)
 }
 
 func (h *ADTHandler) AdmitPatient(c *gin.Context) {
@@ -81,7 +89,8 @@ func (h *ADTHandler) AdmitPatient(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.AdmitPatient(&admission); err != nil {
+	admission.AdmittingDoctorID = middleware.CurrentUserID(c)
+	if err := h.service.AdmitPatient(c.Request.Context(), &admission); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -90,7 +99,7 @@ func (h *ADTHandler) AdmitPatient(c *gin.Context) {
 
 func (h *ADTHandler) DischargePatient(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := h.service.DischargePatient(uint(id)); err != nil {
+	if err := h.service.DischargePatient(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -98,12 +107,16 @@ func (h *ADTHandler) DischargePatient(c *gin.Context) {
 }
 
 func (h *ADTHandler) ListActiveAdmissions(c *gin.Context) {
-	admissions, err := h.service.ListActiveAdmissions()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+	admissions, err := h.service.ListActiveAdmissions(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, admissions)
+	respondList(c, admissions, query)
 }
 
 func (h *ADTHandler) GetAdmission(c *gin.Context) {
@@ -122,8 +135,9 @@ func (h *ADTHandler) TransferPatient(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	transfer.AuthorizedBy = middleware.CurrentUserID(c)
 
-	if err := h.service.TransferPatient(&transfer); err != nil {
+	if err := h.service.TransferPatient(c.Request.Context(), &transfer); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -132,13 +146,16 @@ func (h *ADTHandler) TransferPatient(c *gin.Context) {
 }
 
 func (h *ADTHandler) ListTransfers(c *gin.Context) {
-	admissionID, _ := strconv.Atoi(c.Query("admission_id"))
-	transfers, err := h.service.ListTransfers(uint(admissionID))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+	transfers, err := h.service.ListTransfers(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, transfers)
+	respondList(c, transfers, query)
 }
 
 func (h *ADTHandler) CreateDischargeSummary(c *gin.Context) {
@@ -147,8 +164,9 @@ func (h *ADTHandler) CreateDischargeSummary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	summary.SignedBy = middleware.CurrentUserID(c)
 
-	if err := h.service.CreateDischargeSummary(&summary); err != nil {
+	if err := h.service.CreateDischargeSummary(c.Request.Context(), &summary); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"zarish-his/backend/internal/api/middleware"
 	"zarish-his/backend/internal/domain/models"
 	"zarish-his/backend/internal/service/clinical"
 )
@@ -24,8 +25,9 @@ func (h *AppointmentHandler) CreateAppointment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	appointment.CreatedBy = middleware.CurrentUserID(c)
 
-	created, err := h.service.CreateAppointment(&appointment)
+	created, err := h.service.CreateAppointment(c.Request.Context(), &appointment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -64,7 +66,7 @@ func (h *AppointmentHandler) UpdateAppointment(c *gin.Context) {
 	}
 
 	appointment.ID = uint(id)
-	updated, err := h.service.UpdateAppointment(&appointment)
+	updated, err := h.service.UpdateAppointment(c.Request.Context(), &appointment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -82,19 +84,13 @@ func (h *AppointmentHandler) CancelAppointment(c *gin.Context) {
 
 	var req struct {
 		Reason string `json:"reason" binding:"required"`
-		UserID uint   `json:"user_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Default user ID if not provided
-	if req.UserID == 0 {
-		req.UserID = 1
-	}
-
-	cancelled, err := h.service.CancelAppointment(uint(id), req.Reason, req.UserID)
+	cancelled, err := h.service.CancelAppointment(c.Request.Context(), uint(id), req.Reason, middleware.CurrentUserID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -118,13 +114,18 @@ func (h *AppointmentHandler) ListAppointments(c *gin.Context) {
 		date = time.Now()
 	}
 
-	appointments, err := h.service.ListAppointmentsByDate(date)
+	query, ok := listQuery(c, "date")
+	if !ok {
+		return
+	}
+
+	appointments, err := h.service.ListAppointmentsByDate(date, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, appointments)
+	respondList(c, appointments, query)
 }
 
 func (h *AppointmentHandler) ListPatientAppointments(c *gin.Context) {
@@ -134,7 +135,31 @@ func (h *AppointmentHandler) ListPatientAppointments(c *gin.Context) {
 		return
 	}
 
-	appointments, err := h.service.ListPatientAppointments(uint(patientID))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	appointments, err := h.service.ListPatientAppointments(uint(patientID), query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, appointments, query)
+}
+
+// ListDueReminders lists the appointments a reminder should be sent for now.
+// within is how far ahead to look, 24h by default. Patients who have not
+// consented to SMS reminders are not listed.
+func (h *AppointmentHandler) ListDueReminders(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("within", "24h"))
+	if err != nil || window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid within duration (e.g. 24h)"})
+		return
+	}
+
+	appointments, err := h.service.ListDueReminders(window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -142,3 +167,19 @@ func (h *AppointmentHandler) ListPatientAppointments(c *gin.Context) {
 
 	c.JSON(http.StatusOK, appointments)
 }
+
+func (h *AppointmentHandler) MarkReminderSent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	appointment, err := h.service.MarkReminderSent(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, appointment)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// ListEvents lists audit events for compliance review
+// @Summary List audit events
+// @Tags audit
+// @Produce json
+// @Param patient_id query int false "Patient ID"
+// @Param actor query int false "Actor user ID"
+// @Param resource_type query string false "Resource type"
+// @Param action query string false "create, read, update, delete"
+// @Param from query string false "From date (YYYY-MM-DD)"
+// @Param to query string false "To date (YYYY-MM-DD), inclusive"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/audit [get]
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	filter := repository.AuditFilter{
+		ResourceType: c.Query("resource_type"),
+		Action:       c.Query("action"),
+	}
+
+	if raw := c.Query("patient_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient_id"})
+			return
+		}
+		patientID := uint(id)
+		filter.PatientID = &patientID
+	}
+	if raw := c.Query("actor"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor"})
+			return
+		}
+		actorID := uint(id)
+		filter.ActorID = &actorID
+	}
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date format (YYYY-MM-DD)"})
+			return
+		}
+		filter.From = &from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date format (YYYY-MM-DD)"})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	events, total, err := h.service.ListEvents(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// VerifyChain checks the audit hash chain for tampering
+func (h *AuditHandler) VerifyChain(c *gin.Context) {
+	result, err := h.service.VerifyChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"zarish-his/backend/internal/api/middleware"
 	"zarish-his/backend/internal/domain/models"
 	"zarish-his/backend/internal/service/integration"
 )
@@ -26,7 +27,7 @@ func (h *BillingHandler) CreateInvoice(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.GenerateInvoice(&invoice); err != nil {
+	if err := h.service.GenerateInvoice(c.Request.Context(), &invoice); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -59,13 +60,18 @@ func (h *BillingHandler) GetPatientInvoices(c *gin.Context) {
 }
 
 func (h *BillingHandler) GetOutstandingInvoices(c *gin.Context) {
-	invoices, err := h.service.GetOutstandingInvoices()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	invoices, err := h.service.GetOutstandingInvoices(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, invoices)
+	respondList(c, invoices, query)
 }
 
 // Payment Handlers
@@ -75,8 +81,9 @@ func (h *BillingHandler) RecordPayment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	payment.ReceivedBy = middleware.CurrentUserID(c)
 
-	if err := h.service.RecordPayment(&payment); err != nil {
+	if err := h.service.RecordPayment(c.Request.Context(), &payment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -140,7 +147,7 @@ func (h *BillingHandler) SubmitClaim(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.SubmitInsuranceClaim(&claim); err != nil {
+	if err := h.service.SubmitInsuranceClaim(c.Request.Context(), &claim); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -182,7 +189,7 @@ func (h *BillingHandler) ApproveClaim(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.ApproveClaim(uint(id), req.ApprovedAmount); err != nil {
+	if err := h.service.ApproveClaim(c.Request.Context(), uint(id), req.ApprovedAmount); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -202,7 +209,7 @@ func (h *BillingHandler) RejectClaim(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.RejectClaim(uint(id), req.Reason); err != nil {
+	if err := h.service.RejectClaim(c.Request.Context(), uint(id), req.Reason); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -5,16 +5,19 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"zarish-his/backend/internal/api/middleware"
 	"zarish-his/backend/internal/domain/models"
+	audit "zarish-his/backend/internal/service/audit"
 	"zarish-his/backend/internal/service/clinical"
 )
 
 type ClinicalNoteHandler struct {
 	service *clinical.ClinicalNoteService
+	audit   *audit.AuditService
 }
 
-func NewClinicalNoteHandler(service *clinical.ClinicalNoteService) *ClinicalNoteHandler {
-	return &ClinicalNoteHandler{service: service}
+func NewClinicalNoteHandler(service *clinical.ClinicalNoteService, audit *audit.AuditService) *ClinicalNoteHandler {
+	return &ClinicalNoteHandler{service: service, audit: audit}
 }
 
 func (h *ClinicalNoteHandler) CreateNote(c *gin.Context) {
@@ -24,7 +27,7 @@ func (h *ClinicalNoteHandler) CreateNote(c *gin.Context) {
 		return
 	}
 
-	createdNote, err := h.service.CreateNote(&note)
+	createdNote, err := h.service.CreateNote(c.Request.Context(), &note)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -45,6 +48,10 @@ func (h *ClinicalNoteHandler) GetNote(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 		return
 	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "ClinicalNote", note.ID, note.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, note)
 }
@@ -62,8 +69,13 @@ func (h *ClinicalNoteHandler) UpdateNote(c *gin.Context) {
 		return
 	}
 
+	if _, err := h.service.GetNoteByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return
+	}
+
 	note.ID = uint(id)
-	updatedNote, err := h.service.UpdateNote(&note)
+	updatedNote, err := h.service.UpdateNote(c.Request.Context(), &note)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -79,17 +91,7 @@ func (h *ClinicalNoteHandler) SignNote(c *gin.Context) {
 		return
 	}
 
-	// In a real app, get userID from context/token
-	// For MVP, we'll assume a default user or pass it in body
-	var signRequest struct {
-		UserID uint `json:"user_id"`
-	}
-	if err := c.ShouldBindJSON(&signRequest); err != nil {
-		// Default to user 1 if not provided
-		signRequest.UserID = 1
-	}
-
-	note, err := h.service.SignNote(uint(id), signRequest.UserID)
+	note, err := h.service.SignNote(c.Request.Context(), uint(id), middleware.CurrentUserID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,13 +123,20 @@ func (h *ClinicalNoteHandler) ListPatientNotes(c *gin.Context) {
 		return
 	}
 
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
 
-	notes, err := h.service.ListPatientNotes(uint(patientID), limit)
+	notes, err := h.service.ListPatientNotes(uint(patientID), query)
 	if err != nil {
+		listError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "ClinicalNote", 0, uint(patientID), nil, nil); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, notes)
+	respondList(c, notes, query)
 }
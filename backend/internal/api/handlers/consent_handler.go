@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type ConsentHandler struct {
+	service *service.ConsentService
+	audit   *service.AuditService
+}
+
+func NewConsentHandler(service *service.ConsentService, audit *service.AuditService) *ConsentHandler {
+	return &ConsentHandler{service: service, audit: audit}
+}
+
+// RecordConsent records a patient's consent decision on a scope
+// @Summary Record a consent decision
+// @Description Status active records consent given, rejected consent declined. Consent given needs a signed form (document_reference) or a witness. The decision replaces the earlier one on the same scope.
+// @Tags consents
+// @Accept json
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Param consent body models.Consent true "Consent"
+// @Success 201 {object} models.Consent
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/patients/{id}/consents [post]
+func (h *ConsentHandler) RecordConsent(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	var consent models.Consent
+	if err := c.ShouldBindJSON(&consent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	consent.BaseModel = models.BaseModel{}
+	consent.Patient = nil
+	consent.PatientID = patientID
+	consent.RecordedBy = middleware.CurrentUserID(c)
+
+	created, err := h.service.RecordConsent(c.Request.Context(), &consent)
+	if err != nil {
+		h.consentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// ListPatientConsents lists a patient's consent decisions, newest first
+// @Summary List a patient's consents
+// @Description Takes the list parameters (cursor, limit, sort, fields) and filters on consent fields, e.g. scope=sms-reminders or status=active.
+// @Tags consents
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, up to 100" default(20)
+// @Param scope query string false "Limit to one scope"
+// @Success 200 {object} repository.Page[models.Consent]
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/consents [get]
+func (h *ConsentHandler) ListPatientConsents(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	consents, err := h.service.ListPatientConsents(patientID, query)
+	if err != nil {
+		h.consentError(c, err)
+		return
+	}
+
+	respondList(c, consents, query)
+}
+
+// GetConsent gets a consent record
+// @Summary Get a consent
+// @Tags consents
+// @Produce json
+// @Param id path int true "Consent ID"
+// @Success 200 {object} models.Consent
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/consents/{id} [get]
+func (h *ConsentHandler) GetConsent(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid consent ID")
+	if !ok {
+		return
+	}
+
+	consent, err := h.service.GetConsent(id)
+	if err != nil {
+		h.consentError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Consent", consent.ID, consent.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, consent)
+}
+
+// WithdrawConsent withdraws a consent at the patient's request
+// @Summary Withdraw a consent
+// @Tags consents
+// @Accept json
+// @Produce json
+// @Param id path int true "Consent ID"
+// @Success 200 {object} models.Consent
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/consents/{id}/withdraw [post]
+func (h *ConsentHandler) WithdrawConsent(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid consent ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawn, err := h.service.WithdrawConsent(c.Request.Context(), id, req.Reason, middleware.CurrentUserID(c))
+	if err != nil {
+		h.consentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawn)
+}
+
+func (h *ConsentHandler) consentError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation), errors.Is(err, repository.ErrInvalidListQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrConsentNotActive), errors.Is(err, service.ErrPatientMerged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
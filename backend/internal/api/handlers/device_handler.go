@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/hl7"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+// hl7ContentType is the media type of ER7-encoded HL7 v2 messages
+const hl7ContentType = "x-application/hl7-v2+er7"
+
+// maxHL7MessageSize bounds the size of a pushed HL7 message
+const maxHL7MessageSize = 1 << 20
+
+type DeviceHandler struct {
+	service *service.DeviceService
+}
+
+func NewDeviceHandler(service *service.DeviceService) *DeviceHandler {
+	return &DeviceHandler{service: service}
+}
+
+// deviceWithKey is a device with its newly issued ingestion key
+type deviceWithKey struct {
+	*models.Device
+	Key string `json:"key"`
+}
+
+// RegisterDevice registers a monitor or other device
+// @Summary Register a device
+// @Description Registers a device and returns its ingestion key, which is only shown once. Readings go to the patient admitted to bed_id.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param device body models.Device true "Device"
+// @Success 201 {object} models.Device
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/devices [post]
+func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
+	var device models.Device
+	if err := c.ShouldBindJSON(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	device.BaseModel = models.BaseModel{}
+
+	created, key, err := h.service.RegisterDevice(c.Request.Context(), &device)
+	if err != nil {
+		deviceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, deviceWithKey{Device: created, Key: key})
+}
+
+// ListDevices lists the registered devices
+// @Summary List devices
+// @Tags devices
+// @Produce json
+// @Success 200 {object} repository.Page[models.Device]
+// @Router /api/v1/devices [get]
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	devices, err := h.service.ListDevices(query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, devices, query)
+}
+
+// GetDevice returns a device
+// @Summary Get a device
+// @Tags devices
+// @Produce json
+// @Param id path int true "Device ID"
+// @Success 200 {object} models.Device
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/devices/{id} [get]
+func (h *DeviceHandler) GetDevice(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid device ID")
+	if !ok {
+		return
+	}
+
+	device, err := h.service.GetDevice(id)
+	if err != nil {
+		deviceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// UpdateDevice changes a device's details, bed or active flag
+// @Summary Update a device
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param id path int true "Device ID"
+// @Param device body models.Device true "Device"
+// @Success 200 {object} models.Device
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/devices/{id} [put]
+func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid device ID")
+	if !ok {
+		return
+	}
+
+	var update models.Device
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device, err := h.service.UpdateDevice(c.Request.Context(), id, &update)
+	if err != nil {
+		deviceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// RotateDeviceKey issues a device a new ingestion key
+// @Summary Rotate a device's key
+// @Description The old key stops working at once.
+// @Tags devices
+// @Produce json
+// @Param id path int true "Device ID"
+// @Success 200 {object} models.Device
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/devices/{id}/rotate-key [post]
+func (h *DeviceHandler) RotateDeviceKey(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid device ID")
+	if !ok {
+		return
+	}
+
+	device, key, err := h.service.RotateKey(c.Request.Context(), id)
+	if err != nil {
+		deviceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deviceWithKey{Device: device, Key: key})
+}
+
+// IngestReading accepts a reading in the JSON push format
+// @Summary Push a device reading
+// @Description Authenticated with "Authorization: Device <key>". The reading is recorded for the patient admitted to the device's bed, on their active encounter, pending a nurse's validation. Temperature in °C, weight in kg, height in cm; measured_at defaults to the time received. A reading resent for the same time returns the recorded one with 200.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param reading body models.DeviceReading true "Reading"
+// @Success 201 {object} models.VitalSigns
+// @Success 200 {object} models.VitalSigns "Already recorded"
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /api/v1/device-ingest/readings [post]
+func (h *DeviceHandler) IngestReading(c *gin.Context) {
+	var reading models.DeviceReading
+	if err := c.ShouldBindJSON(&reading); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vitals, created, err := h.service.Ingest(c.Request.Context(), middleware.CurrentDevice(c), &reading, "")
+	if err != nil {
+		deviceError(c, err)
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, vitals)
+		return
+	}
+	c.JSON(http.StatusCreated, vitals)
+}
+
+// IngestHL7 accepts an HL7 v2 ORU^R01 observation message
+// @Summary Push an HL7 v2 observation message
+// @Description Authenticated with "Authorization: Device <key>". Takes an ER7-encoded ORU^R01 with IEEE 11073 (MDC) or LOINC coded OBX segments, as sent by IHE PCD-01 gateways, and answers with an ACK: AA when recorded, AE when it could not be placed on a patient, AR when the message is invalid.
+// @Tags devices
+// @Accept plain
+// @Produce plain
+// @Success 200 {string} string "ACK with AA"
+// @Failure 400 {string} string "ACK with AR"
+// @Failure 422 {string} string "ACK with AE"
+// @Router /api/v1/device-ingest/hl7 [post]
+func (h *DeviceHandler) IngestHL7(c *gin.Context) {
+	now := time.Now()
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxHL7MessageSize))
+	if err != nil {
+		c.Data(http.StatusBadRequest, hl7ContentType, hl7.Ack(nil, hl7.AckReject, err.Error(), now))
+		return
+	}
+	msg, err := hl7.Parse(body)
+	if err != nil {
+		c.Data(http.StatusBadRequest, hl7ContentType, hl7.Ack(nil, hl7.AckReject, err.Error(), now))
+		return
+	}
+	oru, err := hl7.ParseORU(msg, now.Location())
+	if err != nil {
+		c.Data(http.StatusBadRequest, hl7ContentType, hl7.Ack(msg, hl7.AckReject, err.Error(), now))
+		return
+	}
+
+	if _, _, err := h.service.Ingest(c.Request.Context(), middleware.CurrentDevice(c), &oru.Reading, oru.EquipmentID); err != nil {
+		status := deviceErrorStatus(err)
+		code := hl7.AckError
+		if status == http.StatusBadRequest {
+			code = hl7.AckReject
+		}
+		c.Data(status, hl7ContentType, hl7.Ack(msg, code, err.Error(), now))
+		return
+	}
+
+	c.Data(http.StatusOK, hl7ContentType, hl7.Ack(msg, hl7.AckAccept, "", now))
+}
+
+func deviceErrorStatus(err error) int {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &validation), errors.Is(err, models.ErrDeviceReadingEmpty):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrDeviceMismatch):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrDeviceNoBed), errors.Is(err, models.ErrDeviceNoPatient),
+		errors.Is(err, models.ErrDeviceNoEncounter):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func deviceError(c *gin.Context, err error) {
+	c.JSON(deviceErrorStatus(err), gin.H{"error": err.Error()})
+}
@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
@@ -24,9 +28,9 @@ func (h *EncounterHandler) CreateEncounter(c *gin.Context) {
 		return
 	}
 
-	createdEncounter, err := h.service.CreateEncounter(&encounter)
+	createdEncounter, err := h.service.CreateEncounter(c.Request.Context(), &encounter, middleware.CurrentUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		encounterError(c, err)
 		return
 	}
 
@@ -63,9 +67,9 @@ func (h *EncounterHandler) UpdateEncounter(c *gin.Context) {
 	}
 
 	encounter.ID = uint(id)
-	updatedEncounter, err := h.service.UpdateEncounter(&encounter)
+	updatedEncounter, err := h.service.UpdateEncounter(c.Request.Context(), &encounter, middleware.CurrentUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		encounterError(c, err)
 		return
 	}
 
@@ -79,23 +83,32 @@ func (h *EncounterHandler) ListPatientEncounters(c *gin.Context) {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
 
-	encounters, total, err := h.service.ListPatientEncounters(uint(patientID), page, limit)
+	encounters, err := h.service.ListPatientEncounters(uint(patientID), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  encounters,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-	})
+	respondList(c, encounters, query)
 }
 
+// UpdateStatus moves an encounter to another status
+// @Summary Change an encounter's status
+// @Description Statuses follow the FHIR Encounter workflow: planned → arrived → triaged → in-progress → finished, with onleave and back during a stay, cancelled before the patient is seen, and entered-in-error (with a reason) from any status. Other changes return 409 with the allowed statuses.
+// @Tags encounters
+// @Accept json
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Success 200 {object} models.Encounter
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/encounters/{id}/status [put]
 func (h *EncounterHandler) UpdateStatus(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -105,30 +118,99 @@ func (h *EncounterHandler) UpdateStatus(c *gin.Context) {
 
 	var statusUpdate struct {
 		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
 	}
 	if err := c.ShouldBindJSON(&statusUpdate); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var encounter *models.Encounter
-	if statusUpdate.Status == "in-progress" {
-		encounter, err = h.service.StartEncounter(uint(id))
-	} else if statusUpdate.Status == "finished" {
-		encounter, err = h.service.FinishEncounter(uint(id))
-	} else {
-		// Generic update for other statuses
-		encounter, err = h.service.GetEncounterByID(uint(id))
-		if err == nil {
-			encounter.Status = statusUpdate.Status
-			encounter, err = h.service.UpdateEncounter(encounter)
+	encounter, err := h.service.ChangeStatus(c.Request.Context(), uint(id), statusUpdate.Status, statusUpdate.Reason, middleware.CurrentUserID(c))
+	if err != nil {
+		encounterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, encounter)
+}
+
+// GetStatusHistory returns an encounter's status changes with the times derived from them
+// @Summary Encounter status history
+// @Description The status changes, oldest first, and the encounter's door-to-triage, door-to-doctor, consultation and length-of-stay times in minutes.
+// @Tags encounters
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/encounters/{id}/status-history [get]
+func (h *EncounterHandler) GetStatusHistory(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid encounter ID")
+	if !ok {
+		return
+	}
+
+	history, times, err := h.service.GetStatusHistory(id)
+	if err != nil {
+		encounterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history, "times": times})
+}
+
+// GetWaitTimes summarizes how long patients waited to be triaged and seen
+// @Summary Encounter wait times
+// @Description Median and 90th percentile door-to-doctor and median door-to-triage times, in minutes, of the encounters that arrived between from and to (dates, to exclusive; today by default).
+// @Tags encounters
+// @Produce json
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Day after the last (YYYY-MM-DD)"
+// @Param service_category query string false "Service category, e.g. General or NCD Corner"
+// @Success 200 {object} models.EncounterWaitTimes
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/encounters/wait-times [get]
+func (h *EncounterHandler) GetWaitTimes(c *gin.Context) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 0, 1)
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date (YYYY-MM-DD)"})
+			return
+		}
+		to = from.AddDate(0, 0, 1)
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date (YYYY-MM-DD)"})
+			return
 		}
 	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
 
+	summary, err := h.service.WaitTimes(from, to, c.Query("service_category"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, encounter)
+	c.JSON(http.StatusOK, summary)
+}
+
+func encounterError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrEncounterTransition), errors.Is(err, repository.ErrEncounterStatusConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
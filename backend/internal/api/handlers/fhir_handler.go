@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+// FHIRBasePath is where the FHIR R4 API is mounted
+const FHIRBasePath = "/fhir/R4"
+
+const (
+	fhirContentType   = "application/fhir+json"
+	ndjsonContentType = "application/fhir+ndjson"
+)
+
+type FHIRHandler struct {
+	service *service.FHIRService
+	audit   *service.AuditService
+}
+
+func NewFHIRHandler(service *service.FHIRService, audit *service.AuditService) *FHIRHandler {
+	return &FHIRHandler{service: service, audit: audit}
+}
+
+// Capabilities returns the server's CapabilityStatement
+// @Summary FHIR CapabilityStatement
+// @Tags fhir
+// @Produce json
+// @Router /fhir/R4/metadata [get]
+func (h *FHIRHandler) Capabilities(c *gin.Context) {
+	h.respond(c, http.StatusOK, fhir.NewCapabilityStatement())
+}
+
+// Read returns a single resource
+// @Summary Read a FHIR resource
+// @Tags fhir
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param id path string true "Resource ID"
+// @Router /fhir/R4/{type}/{id} [get]
+func (h *FHIRHandler) Read(c *gin.Context) {
+	record, err := h.service.Read(c.Param("type"), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, record.AuditType, record.RecordID, record.PatientID, nil, nil); err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, record.Resource)
+}
+
+// Search returns a searchset Bundle
+// @Summary Search FHIR resources
+// @Tags fhir
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param patient query string false "Patient reference"
+// @Param status query string false "Status"
+// @Param date query string false "Date with optional prefix (ge2024-01-01)"
+// @Param _count query int false "Page size (default 20, max 100)"
+// @Router /fhir/R4/{type} [get]
+func (h *FHIRHandler) Search(c *gin.Context) {
+	resourceType := c.Param("type")
+	result, err := h.service.Search(resourceType, c.Request.URL.Query())
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	base := fhirBaseURL(c)
+	entries := make([]fhir.BundleEntry, 0, len(result.Records))
+	audited := map[uint]bool{}
+	for _, record := range result.Records {
+		entries = append(entries, fhir.NewBundleEntry(base, resourceType, record.ID, record.Resource))
+
+		// One read event per patient whose data was returned
+		if record.PatientID != 0 && !audited[record.PatientID] {
+			audited[record.PatientID] = true
+			if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, record.AuditType, 0, record.PatientID, nil, nil); err != nil {
+				h.fail(c, err)
+				return
+			}
+		}
+	}
+
+	selfURL, err := url.Parse(base + "/" + resourceType)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	selfURL.RawQuery = c.Request.URL.RawQuery
+	h.respond(c, http.StatusOK, fhir.NewSearchBundle(selfURL, result.Total, result.Offset, result.Count, entries))
+}
+
+// Create stores a new resource
+// @Summary Create a FHIR resource
+// @Tags fhir
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Router /fhir/R4/{type} [post]
+func (h *FHIRHandler) Create(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	record, err := h.service.Create(c.Request.Context(), c.Param("type"), body, middleware.CurrentUserID(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.Header("Location", fhirBaseURL(c)+"/"+c.Param("type")+"/"+record.ID)
+	h.respond(c, http.StatusCreated, record.Resource)
+}
+
+// Update replaces an existing resource
+// @Summary Update a FHIR resource
+// @Tags fhir
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param id path string true "Resource ID"
+// @Router /fhir/R4/{type}/{id} [put]
+func (h *FHIRHandler) Update(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	after, err := h.service.Update(c.Request.Context(), c.Param("type"), c.Param("id"), body, middleware.CurrentUserID(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, after.Resource)
+}
+
+// Everything returns a patient's whole record as a transaction Bundle that can
+// be posted to another facility's FHIR server
+// @Summary Patient $everything
+// @Tags fhir
+// @Produce json
+// @Param type path string true "Resource type (Patient)"
+// @Param id path string true "Patient ID"
+// @Router /fhir/R4/{type}/{id}/$everything [get]
+func (h *FHIRHandler) Everything(c *gin.Context) {
+	if c.Param("type") != "Patient" {
+		h.fail(c, service.ErrFHIRUnsupported)
+		return
+	}
+
+	records, err := h.service.Everything(c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	resources := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		resources = append(resources, record.Resource)
+	}
+	bundle, err := fhir.NewTransactionBundle(resources)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientEverything", records[0].RecordID, records[0].PatientID, nil, nil); err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, bundle)
+}
+
+// Export streams matching resources as NDJSON, one resource per line
+// @Summary Bulk $export
+// @Tags fhir
+// @Produce application/fhir+ndjson
+// @Param patient query string false "Comma separated patient references"
+// @Param _type query string false "Comma separated resource types"
+// @Param _since query string false "Modified on or after this date"
+// @Param _until query string false "Modified on or before this date"
+// @Router /fhir/R4/$export [get]
+func (h *FHIRHandler) Export(c *gin.Context) {
+	filter, types, err := service.ParseExportParams(c.Request.URL.Query())
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	// Errors after the first line can no longer change the status code, so the
+	// stream is cut short and the client sees an incomplete file
+	started := false
+	audited := map[uint]bool{}
+	encoder := json.NewEncoder(c.Writer)
+	err = h.service.Export(filter, types, func(record *service.FHIRRecord) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", ndjsonContentType)
+			c.Status(http.StatusOK)
+		}
+		if record.PatientID != 0 && !audited[record.PatientID] {
+			audited[record.PatientID] = true
+			if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "BulkExport", 0, record.PatientID, nil, nil); err != nil {
+				return err
+			}
+		}
+		// Encode writes a trailing newline, which is the NDJSON record separator
+		return encoder.Encode(record.Resource)
+	})
+	if err != nil {
+		if !started {
+			h.fail(c, err)
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if !started {
+		c.Data(http.StatusOK, ndjsonContentType, nil)
+	}
+}
+
+func (h *FHIRHandler) respond(c *gin.Context, status int, resource interface{}) {
+	body, err := json.Marshal(resource)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, fhir.NewOperationOutcome(fhir.IssueException, err.Error()))
+		return
+	}
+	c.Data(status, fhirContentType, body)
+}
+
+// fail maps a service error to an OperationOutcome response
+func (h *FHIRHandler) fail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		h.respond(c, http.StatusNotFound, fhir.NewOperationOutcome(fhir.IssueNotFound, c.Param("type")+"/"+c.Param("id")+" not found"))
+	case errors.Is(err, service.ErrFHIRUnsupported):
+		h.respond(c, http.StatusNotFound, fhir.NewOperationOutcome(fhir.IssueNotSupported, "resource type "+c.Param("type")+" is not supported"))
+	case errors.Is(err, service.ErrFHIRInvalid), errors.As(err, new(*models.ValidationError)):
+		h.respond(c, http.StatusBadRequest, fhir.NewOperationOutcome(fhir.IssueInvalid, err.Error()))
+	case errors.Is(err, models.ErrEncounterTransition):
+		h.respond(c, http.StatusConflict, fhir.NewOperationOutcome(fhir.IssueBusinessRule, err.Error()))
+	case errors.Is(err, service.ErrConsentRequired):
+		h.respond(c, http.StatusForbidden, fhir.NewOperationOutcome(fhir.IssueForbidden, err.Error()))
+	default:
+		h.respond(c, http.StatusInternalServerError, fhir.NewOperationOutcome(fhir.IssueException, err.Error()))
+	}
+}
+
+// fhirBaseURL returns the absolute FHIR base URL of the request
+func fhirBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + FHIRBasePath
+}
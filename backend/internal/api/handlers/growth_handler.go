@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type GrowthHandler struct {
+	service *service.GrowthService
+}
+
+func NewGrowthHandler(service *service.GrowthService) *GrowthHandler {
+	return &GrowthHandler{service: service}
+}
+
+// GetPatientGrowth returns a child's growth chart
+// @Summary Child growth monitoring
+// @Description Weight-for-age, length/height-for-age, weight-for-length/height and MUAC-for-age z-scores against the WHO child growth standards for every measurement before the fifth birthday, with the acute malnutrition status (sam, mam, normal) from weight-for-height, MUAC and oedema.
+// @Tags vital-signs
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} models.GrowthChart
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/growth [get]
+func (h *GrowthHandler) GetPatientGrowth(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	chart, err := h.service.PatientGrowth(patientID)
+	if err != nil {
+		vitalSignsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, chart)
+}
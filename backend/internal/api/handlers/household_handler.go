@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type HouseholdHandler struct {
+	service *service.HouseholdService
+	audit   *service.AuditService
+}
+
+func NewHouseholdHandler(service *service.HouseholdService, audit *service.AuditService) *HouseholdHandler {
+	return &HouseholdHandler{service: service, audit: audit}
+}
+
+// CreateHousehold registers a household
+// @Summary Register a household
+// @Description Household with its shared address, UNHCR case number and members; exactly one member is the head
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param household body models.Household true "Household with members"
+// @Success 201 {object} models.Household
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/households [post]
+func (h *HouseholdHandler) CreateHousehold(c *gin.Context) {
+	var household models.Household
+	if err := c.ShouldBindJSON(&household); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	household.BaseModel = models.BaseModel{}
+
+	created, err := h.service.CreateHousehold(c.Request.Context(), &household)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetHousehold gets a household with its current and past members
+// @Summary Get a household
+// @Tags households
+// @Produce json
+// @Param id path int true "Household ID"
+// @Success 200 {object} models.Household
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/households/{id} [get]
+func (h *HouseholdHandler) GetHousehold(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+
+	household, err := h.service.GetHousehold(id)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// UpdateHousehold changes the case number and shared address of a household
+// @Summary Update a household
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param id path int true "Household ID"
+// @Success 200 {object} models.Household
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/households/{id} [put]
+func (h *HouseholdHandler) UpdateHousehold(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+
+	var changes models.Household
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	household, err := h.service.UpdateHousehold(c.Request.Context(), id, &changes)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// SearchHouseholds finds households by UNHCR case number and address
+// @Summary Search households
+// @Tags households
+// @Produce json
+// @Param case_number query string false "UNHCR case number"
+// @Param camp query string false "Camp name"
+// @Param block query string false "Block number"
+// @Param shelter query string false "Shelter number"
+// @Success 200 {array} models.Household
+// @Router /api/v1/households/search [get]
+func (h *HouseholdHandler) SearchHouseholds(c *gin.Context) {
+	caseNumber, camp := c.Query("case_number"), c.Query("camp")
+	block, shelter := c.Query("block"), c.Query("shelter")
+	if caseNumber == "" && camp == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "case_number or camp is required"})
+		return
+	}
+
+	households, err := h.service.SearchHouseholds(caseNumber, camp, block, shelter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, households)
+}
+
+// AddMember adds a patient to a household
+// @Summary Add a household member
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param id path int true "Household ID"
+// @Success 200 {object} models.Household
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/households/{id}/members [post]
+func (h *HouseholdHandler) AddMember(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PatientID    uint   `json:"patient_id" binding:"required"`
+		Relationship string `json:"relationship" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	household, err := h.service.AddMember(c.Request.Context(), id, req.PatientID, req.Relationship)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// UpdateMember changes a member's relationship to the head of the household
+// @Summary Recode a household member
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param id path int true "Household ID"
+// @Param patientId path int true "Patient ID"
+// @Success 200 {object} models.Household
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/households/{id}/members/{patientId} [put]
+func (h *HouseholdHandler) UpdateMember(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+	patientID, ok := parseID(c, "patientId", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Relationship string `json:"relationship" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	household, err := h.service.UpdateMember(c.Request.Context(), id, patientID, req.Relationship)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// RemoveMember ends a patient's membership of a household
+// @Summary Remove a household member
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param id path int true "Household ID"
+// @Param patientId path int true "Patient ID"
+// @Success 200 {object} models.Household
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/households/{id}/members/{patientId}/remove [post]
+func (h *HouseholdHandler) RemoveMember(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+	patientID, ok := parseID(c, "patientId", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	household, err := h.service.RemoveMember(c.Request.Context(), id, patientID, req.Reason)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// ChangeHead appoints a new head of the household
+// @Summary Change the head of a household
+// @Description The former head stays a member with former_head_relationship, their relationship to the new head
+// @Tags households
+// @Accept json
+// @Produce json
+// @Param id path int true "Household ID"
+// @Success 200 {object} models.Household
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/households/{id}/head [put]
+func (h *HouseholdHandler) ChangeHead(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid household ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PatientID              uint   `json:"patient_id" binding:"required"`
+		FormerHeadRelationship string `json:"former_head_relationship" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	household, err := h.service.ChangeHead(c.Request.Context(), id, req.PatientID, req.FormerHeadRelationship)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// GetPatientHousehold gets the household a patient currently lives in
+// @Summary Get a patient's household
+// @Tags households
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} models.Household
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/household [get]
+func (h *HouseholdHandler) GetPatientHousehold(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	household, err := h.service.GetPatientHousehold(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient does not belong to a household"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Household", household.ID, id, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, household)
+}
+
+// SetMother links a child to its mother
+// @Summary Link a patient to their mother
+// @Description Used for immunization and MNCH follow-up; a null mother_id removes the link
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} models.Patient
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/mother [put]
+func (h *HouseholdHandler) SetMother(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MotherID *uint `json:"mother_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient, err := h.service.SetMother(c.Request.Context(), id, req.MotherID)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, patient)
+}
+
+// ListChildren lists the children linked to a mother
+// @Summary List a mother's children
+// @Tags patients
+// @Produce json
+// @Param id path int true "Mother's patient ID"
+// @Success 200 {array} models.Patient
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/children [get]
+func (h *HouseholdHandler) ListChildren(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	children, err := h.service.ListChildren(id)
+	if err != nil {
+		h.householdError(c, err)
+		return
+	}
+	for _, child := range children {
+		if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Patient", child.ID, child.ID, nil, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, children)
+}
+
+func parseID(c *gin.Context, param, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *HouseholdHandler) householdError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation), errors.Is(err, service.ErrInvalidMother),
+		errors.Is(err, service.ErrHouseholdHead), errors.Is(err, service.ErrNotHouseholdMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyInHousehold), errors.Is(err, service.ErrPatientMerged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
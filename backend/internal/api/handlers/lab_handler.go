@@ -5,16 +5,18 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
 type LabHandler struct {
 	service *service.LabService
+	audit   *service.AuditService
 }
 
-func NewLabHandler(service *service.LabService) *LabHandler {
-	return &LabHandler{service: service}
+func NewLabHandler(service *service.LabService, audit *service.AuditService) *LabHandler {
+	return &LabHandler{service: service, audit: audit}
 }
 
 func (h *LabHandler) CreateLabTest(c *gin.Context) {
@@ -24,7 +26,7 @@ func (h *LabHandler) CreateLabTest(c *gin.Context) {
 		return
 	}
 
-	createdTest, err := h.service.CreateLabTest(&test)
+	createdTest, err := h.service.CreateLabTest(c.Request.Context(), &test)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -34,13 +36,18 @@ func (h *LabHandler) CreateLabTest(c *gin.Context) {
 }
 
 func (h *LabHandler) ListLabTests(c *gin.Context) {
-	tests, err := h.service.ListLabTests()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	tests, err := h.service.ListLabTests(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, tests)
+	respondList(c, tests, query)
 }
 
 func (h *LabHandler) CreateLabOrder(c *gin.Context) {
@@ -49,8 +56,9 @@ func (h *LabHandler) CreateLabOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	order.PractitionerID = middleware.CurrentUserID(c)
 
-	createdOrder, err := h.service.CreateLabOrder(&order)
+	createdOrder, err := h.service.CreateLabOrder(c.Request.Context(), &order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -71,6 +79,10 @@ func (h *LabHandler) GetLabOrder(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Lab order not found"})
 		return
 	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "LabOrder", order.ID, order.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, order)
 }
@@ -82,13 +94,22 @@ func (h *LabHandler) ListPatientLabOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := h.service.ListPatientLabOrders(uint(patientID))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	orders, err := h.service.ListPatientLabOrders(uint(patientID), query)
 	if err != nil {
+		listError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "LabOrder", 0, uint(patientID), nil, nil); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	respondList(c, orders, query)
 }
 
 func (h *LabHandler) AddLabResult(c *gin.Context) {
@@ -97,8 +118,14 @@ func (h *LabHandler) AddLabResult(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	result.PerformedBy = middleware.CurrentUserID(c)
+
+	if _, err := h.service.GetLabOrderByID(result.LabOrderID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lab order ID"})
+		return
+	}
 
-	createdResult, err := h.service.AddLabResult(&result)
+	createdResult, err := h.service.AddLabResult(c.Request.Context(), &result)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// listQuery reads the cursor, limit, sort, fields and filter parameters of a
+// list request. params are query parameters the endpoint handles itself.
+func listQuery(c *gin.Context, params ...string) (repository.ListQuery, bool) {
+	query, err := repository.ParseListQuery(c.Request.URL.Query(), params...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return query, false
+	}
+	return query, true
+}
+
+// respondList writes a page as {"data", "next_cursor", "total"}. With sparse
+// fields, items keep only the requested fields and their ID.
+func respondList[T any](c *gin.Context, page *repository.Page[T], query repository.ListQuery) {
+	if len(query.Fields) == 0 {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	keep := map[string]bool{"id": true, "ID": true}
+	for _, field := range query.Fields {
+		keep[field] = true
+	}
+	items := make([]map[string]json.RawMessage, 0, len(page.Data))
+	for _, item := range page.Data {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for name := range fields {
+			if !keep[name] {
+				delete(fields, name)
+			}
+		}
+		items = append(items, fields)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items, "next_cursor": page.NextCursor, "total": page.Total})
+}
+
+// listError reports a failed list request
+func listError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidListQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -5,19 +5,23 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
 type MedicationHandler struct {
 	service        *service.MedicationService
 	patientService *service.PatientService
+	audit          *service.AuditService
 }
 
-func NewMedicationHandler(service *service.MedicationService, patientService *service.PatientService) *MedicationHandler {
+func NewMedicationHandler(service *service.MedicationService, patientService *service.PatientService, audit *service.AuditService) *MedicationHandler {
 	return &MedicationHandler{
 		service:        service,
 		patientService: patientService,
+		audit:          audit,
 	}
 }
 
@@ -28,7 +32,7 @@ func (h *MedicationHandler) CreateMedication(c *gin.Context) {
 		return
 	}
 
-	createdMed, err := h.service.CreateMedication(&med)
+	createdMed, err := h.service.CreateMedication(c.Request.Context(), &med)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -59,6 +63,7 @@ func (h *MedicationHandler) CreatePrescription(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	prescription.PractitionerID = middleware.CurrentUserID(c)
 
 	// CDS Checks
 	force := c.Query("force") == "true"
@@ -85,7 +90,7 @@ func (h *MedicationHandler) CreatePrescription(c *gin.Context) {
 		}
 	}
 
-	createdPrescription, err := h.service.CreatePrescription(&prescription)
+	createdPrescription, err := h.service.CreatePrescription(c.Request.Context(), &prescription)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -106,6 +111,10 @@ func (h *MedicationHandler) GetPrescription(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
 		return
 	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Prescription", prescription.ID, prescription.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, prescription)
 }
@@ -125,7 +134,7 @@ func (h *MedicationHandler) DiscontinuePrescription(c *gin.Context) {
 		return
 	}
 
-	prescription, err := h.service.DiscontinuePrescription(uint(id), req.Reason)
+	prescription, err := h.service.DiscontinuePrescription(c.Request.Context(), uint(id), req.Reason)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -141,20 +150,24 @@ func (h *MedicationHandler) ListPatientPrescriptions(c *gin.Context) {
 		return
 	}
 
-	activeOnly := c.Query("active") == "true"
-	var prescriptions []*models.Prescription
-	var errSvc error
-
-	if activeOnly {
-		prescriptions, errSvc = h.service.ListActivePrescriptions(uint(patientID))
-	} else {
-		prescriptions, errSvc = h.service.ListPatientPrescriptions(uint(patientID))
+	query, ok := listQuery(c, "active")
+	if !ok {
+		return
+	}
+	// active=true is kept as a shorthand for status=active
+	if c.Query("active") == "true" {
+		query.Filters = append(query.Filters, repository.ListFilter{Field: "status", Op: "eq", Values: []string{"active"}})
 	}
 
-	if errSvc != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errSvc.Error()})
+	prescriptions, err := h.service.ListPatientPrescriptions(uint(patientID), query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Prescription", 0, uint(patientID), nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, prescriptions)
+	respondList(c, prescriptions, query)
 }
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type NCDScreeningHandler struct {
+	service *service.NCDScreeningService
+	audit   *service.AuditService
+}
+
+func NewNCDScreeningHandler(service *service.NCDScreeningService, audit *service.AuditService) *NCDScreeningHandler {
+	return &NCDScreeningHandler{service: service, audit: audit}
+}
+
+// StartScreening records Part B of an encounter's NCD screening
+// @Summary Start an NCD screening
+// @Description Records Part B of the WHO PEN screening form at the nursing station: history, symptoms, female history, warning signs, family history, tobacco, alcohol, diet and activity, BP, weight, height, waist and blood glucose. BP, weight and height left out are taken from vital_signs_id or the encounter's latest measurement; entered without vital_signs_id they are recorded as a new measurement. Computes the risk factors, hypertension and diabetes findings, the WHO CVD risk (patients 40 to 74, when the charts are loaded) and urgent referral.
+// @Tags ncd-screening
+// @Accept json
+// @Produce json
+// @Param screening body models.NCDScreening true "Part B"
+// @Success 201 {object} models.NCDScreening
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/ncd-screenings [post]
+func (h *NCDScreeningHandler) StartScreening(c *gin.Context) {
+	var screening models.NCDScreening
+	if err := c.ShouldBindJSON(&screening); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if screening.EncounterID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "encounter_id is required"})
+		return
+	}
+
+	saved, err := h.service.StartScreening(c.Request.Context(), &screening, middleware.CurrentUserID(c))
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, saved)
+}
+
+// UpdatePartB revises Part B of a screening
+// @Summary Update Part B of an NCD screening
+// @Description Replaces the Part B answers and reassesses the screening. Not allowed once Part C completed it.
+// @Tags ncd-screening
+// @Accept json
+// @Produce json
+// @Param id path int true "Screening ID"
+// @Param screening body models.NCDScreening true "Part B"
+// @Success 200 {object} models.NCDScreening
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/ncd-screenings/{id}/part-b [put]
+func (h *NCDScreeningHandler) UpdatePartB(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid screening ID")
+	if !ok {
+		return
+	}
+
+	var partB models.NCDScreening
+	if err := c.ShouldBindJSON(&partB); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.UpdatePartB(c.Request.Context(), id, &partB, middleware.CurrentUserID(c))
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// RecordPartC records the consultation of a screening
+// @Summary Record Part C of an NCD screening
+// @Description Records the doctor's consultation: known conditions, current medications, clinical assessment, total cholesterol, HbA1c, diagnoses, management plan, follow-up date and outcome (enrol, refer, review or no-ncd), and completes the screening. Total cholesterol switches the CVD risk to the laboratory chart. Can be revised until the patient is enrolled.
+// @Tags ncd-screening
+// @Accept json
+// @Produce json
+// @Param id path int true "Screening ID"
+// @Param screening body models.NCDScreening true "Part C"
+// @Success 200 {object} models.NCDScreening
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/ncd-screenings/{id}/part-c [put]
+func (h *NCDScreeningHandler) RecordPartC(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid screening ID")
+	if !ok {
+		return
+	}
+
+	var partC models.NCDScreening
+	if err := c.ShouldBindJSON(&partC); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.RecordPartC(c.Request.Context(), id, &partC, middleware.CurrentUserID(c))
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Enrol records the enrolment of the screened patient in NCD programs
+// @Summary Enrol in NCD programs
+// @Description Records Part D: the programs (hypertension, diabetes) the patient is enrolled in, the NCD number and whether the NCD book was issued. Needs a completed screening with outcome enrol, and a diagnosis for each program. Programs default to those the screening calls for.
+// @Tags ncd-screening
+// @Accept json
+// @Produce json
+// @Param id path int true "Screening ID"
+// @Success 200 {object} models.NCDScreening
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/ncd-screenings/{id}/enrol [post]
+func (h *NCDScreeningHandler) Enrol(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid screening ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Programs   []string `json:"programs"`
+		NCDNumber  string   `json:"ncd_number"`
+		BookIssued bool     `json:"ncd_book_issued"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.Enrol(c.Request.Context(), id, req.Programs, req.NCDNumber, req.BookIssued, middleware.CurrentUserID(c))
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// GetScreening gets an NCD screening
+// @Summary Get an NCD screening
+// @Tags ncd-screening
+// @Produce json
+// @Param id path int true "Screening ID"
+// @Success 200 {object} models.NCDScreening
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/ncd-screenings/{id} [get]
+func (h *NCDScreeningHandler) GetScreening(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid screening ID")
+	if !ok {
+		return
+	}
+
+	screening, err := h.service.GetScreening(id)
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "NCDScreening", screening.ID, screening.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, screening)
+}
+
+// GetEncounterScreening gets the NCD screening of an encounter
+// @Summary Get an encounter's NCD screening
+// @Tags ncd-screening
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Success 200 {object} models.NCDScreening
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/encounters/{id}/ncd-screening [get]
+func (h *NCDScreeningHandler) GetEncounterScreening(c *gin.Context) {
+	encounterID, ok := parseID(c, "id", "Invalid encounter ID")
+	if !ok {
+		return
+	}
+
+	screening, err := h.service.GetEncounterScreening(encounterID)
+	if err != nil {
+		ncdScreeningError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "NCDScreening", screening.ID, screening.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, screening)
+}
+
+// ListScreenings lists NCD screenings
+// @Summary List NCD screenings
+// @Description Latest first. Filter on any field, e.g. status=in-progress, outcome=enrol or urgent_referral=true.
+// @Tags ncd-screening
+// @Produce json
+// @Success 200 {object} repository.Page[models.NCDScreening]
+// @Router /api/v1/ncd-screenings [get]
+func (h *NCDScreeningHandler) ListScreenings(c *gin.Context) {
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	screenings, err := h.service.ListScreenings(query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, screenings, query)
+}
+
+// ListPatientScreenings lists a patient's NCD screenings
+// @Summary List a patient's NCD screenings
+// @Tags ncd-screening
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} repository.Page[models.NCDScreening]
+// @Router /api/v1/patients/{id}/ncd-screenings [get]
+func (h *NCDScreeningHandler) ListPatientScreenings(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	screenings, err := h.service.ListPatientScreenings(patientID, query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, screenings, query)
+}
+
+// GetChecklists lists the answer options of the screening checklists
+// @Summary NCD screening checklists
+// @Description The codes accepted for symptoms, female history, warning signs (urgent ones need same-day referral), and family history, known conditions and diagnoses.
+// @Tags ncd-screening
+// @Produce json
+// @Success 200 {object} models.NCDChecklists
+// @Router /api/v1/ncd-screenings/checklists [get]
+func (h *NCDScreeningHandler) GetChecklists(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Checklists())
+}
+
+func ncdScreeningError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNCDScreeningExists), errors.Is(err, models.ErrNCDScreeningCompleted),
+		errors.Is(err, models.ErrNCDScreeningNotCompleted), errors.Is(err, models.ErrNCDAlreadyEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type PatientCardHandler struct {
+	service *service.PatientCardService
+	audit   *service.AuditService
+}
+
+func NewPatientCardHandler(service *service.PatientCardService, audit *service.AuditService) *PatientCardHandler {
+	return &PatientCardHandler{service: service, audit: audit}
+}
+
+// GetCard renders a printable patient card
+// @Summary Print a patient card
+// @Description Card with name, MRN, photo and a signed QR code for check-in
+// @Tags patients
+// @Produce application/pdf
+// @Produce image/png
+// @Param id path int true "Patient ID"
+// @Param format query string false "pdf (default) or png"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/patients/{id}/card [get]
+func (h *PatientCardHandler) GetCard(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	format := c.DefaultQuery("format", "pdf")
+	if format != "pdf" && format != "png" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or png"})
+		return
+	}
+
+	card, err := h.service.Issue(uint(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+	if errors.Is(err, service.ErrPatientMerged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body []byte
+	contentType := "application/pdf"
+	if format == "png" {
+		body, err = card.PNG()
+		contentType = "image/png"
+	} else {
+		body, err = card.PDF()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientCard", card.Patient.ID, card.Patient.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", "patient-card-"+card.Patient.MRN+"."+format))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// LookupByQR finds the patient a scanned card belongs to
+// @Summary Look up a patient by card QR code
+// @Description Verifies the card signature; forged or altered codes are rejected
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Patient
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/lookup-by-qr [post]
+func (h *PatientCardHandler) LookupByQR(c *gin.Context) {
+	var req struct {
+		Payload string `json:"payload" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient, err := h.service.LookupByQR(req.Payload)
+	if errors.Is(err, service.ErrInvalidCard) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Patient", patient.ID, patient.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, patient)
+}
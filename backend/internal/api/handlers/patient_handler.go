@@ -1,20 +1,24 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
 type PatientHandler struct {
 	service *service.PatientService
+	audit   *service.AuditService
 }
 
-func NewPatientHandler(service *service.PatientService) *PatientHandler {
-	return &PatientHandler{service: service}
+func NewPatientHandler(service *service.PatientService, audit *service.AuditService) *PatientHandler {
+	return &PatientHandler{service: service, audit: audit}
 }
 
 // CreatePatient creates a new patient
@@ -41,13 +45,23 @@ func (h *PatientHandler) CreatePatient(c *gin.Context) {
 		return
 	}
 
-	createdPatient, err := h.service.CreatePatient(&patient)
+	createdPatient, matches, err := h.service.CreatePatient(c.Request.Context(), &patient)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for _, match := range matches {
+		if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientDuplicate", match.Patient.ID, match.Patient.ID, nil, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	c.JSON(http.StatusCreated, createdPatient)
+	// The patient is returned as before, with any likely duplicates alongside
+	c.JSON(http.StatusCreated, struct {
+		*models.Patient
+		PossibleDuplicates []*service.PatientMatch `json:"possible_duplicates,omitempty"`
+	}{createdPatient, matches})
 }
 
 // GetPatient retrieves a patient by ID
@@ -71,6 +85,10 @@ func (h *PatientHandler) GetPatient(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
 		return
 	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Patient", patient.ID, patient.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, patient)
 }
@@ -102,13 +120,24 @@ func (h *PatientHandler) UpdatePatient(c *gin.Context) {
 
 	patient.ID = uint(id)
 
+	before, err := h.service.GetPatientByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+
+	// Clients that only send the legacy identifier columns keep the other identifiers
+	patient.ApplyIdentifierColumns(before.Identifiers)
+	// The mother link is changed through PUT /patients/:id/mother
+	patient.MotherID = before.MotherID
+
 	// Validate based on nationality
 	if err := patient.Validate(); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	updatedPatient, err := h.service.UpdatePatient(&patient)
+	updatedPatient, err := h.service.UpdatePatient(c.Request.Context(), &patient)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -125,7 +154,7 @@ func (h *PatientHandler) UpdatePatient(c *gin.Context) {
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(20)
 // @Param nationality query string false "Filter by nationality"
-// @Param search query string false "Search by name, MRN, phone"
+// @Param search query string false "Search by name (Latin or Bangla script), MRN, phone, email"
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/patients [get]
 func (h *PatientHandler) ListPatients(c *gin.Context) {
@@ -150,7 +179,7 @@ func (h *PatientHandler) ListPatients(c *gin.Context) {
 
 // SearchPatients searches patients by various criteria
 // @Summary Search patients
-// @Description Search patients by name, MRN, NID, UNHCR number, phone
+// @Description Search patients by name in Latin or Bangla script, MRN, NID, UNHCR number, phone or household case number; best matches first
 // @Tags patients
 // @Produce json
 // @Param q query string true "Search query"
@@ -164,6 +193,10 @@ func (h *PatientHandler) SearchPatients(c *gin.Context) {
 	}
 
 	patients, err := h.service.SearchPatients(query)
+	if errors.Is(err, service.ErrInvalidMRN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -172,6 +205,285 @@ func (h *PatientHandler) SearchPatients(c *gin.Context) {
 	c.JSON(http.StatusOK, patients)
 }
 
+// FindByIdentifier finds patients by any of their identifiers
+// @Summary Find patients by identifier
+// @Description Looks up an identifier (NID, birth registration, UNHCR, FCN, smart card, MRN, ...) in one system or in all of them. Merged records resolve to the surviving patient.
+// @Tags patients
+// @Produce json
+// @Param system query string false "System code (nid, brn, unhcr, fcn, smartcard, mrn) or URI; empty searches every system"
+// @Param value query string true "Identifier value"
+// @Success 200 {array} models.Patient
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/patients/identifier [get]
+func (h *PatientHandler) FindByIdentifier(c *gin.Context) {
+	value := c.Query("value")
+	if value == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Identifier value is required"})
+		return
+	}
+
+	patients, err := h.service.FindByIdentifier(c.Query("system"), value)
+	if errors.Is(err, service.ErrUnknownIdentifierSystem) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, patient := range patients {
+		if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Patient", patient.ID, patient.ID, nil, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, patients)
+}
+
+// ListIdentifierSystems returns the registered identifier systems
+// @Summary List identifier systems
+// @Description The identifier systems patients can hold, with the format each accepts and the nationalities that require them
+// @Tags patients
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/patients/identifier-systems [get]
+func (h *PatientHandler) ListIdentifierSystems(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"systems":       models.IdentifierSystems,
+		"nationalities": models.NationalityIdentifiers,
+	})
+}
+
+// ListDuplicates returns the duplicate review queue
+// @Summary List possible duplicate patients
+// @Description Pairs of patient records the master patient index considers likely the same person, highest score first
+// @Tags patients
+// @Produce json
+// @Param status query string false "open (default), dismissed, merged or all"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/patients/duplicates [get]
+func (h *PatientHandler) ListDuplicates(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := c.DefaultQuery("status", models.DuplicateStatusOpen)
+	if status == "all" {
+		status = ""
+	}
+
+	duplicates, total, err := h.service.ListDuplicates(status, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audited := map[uint]bool{}
+	for _, duplicate := range duplicates {
+		for _, patientID := range []uint{duplicate.PatientID, duplicate.CandidateID} {
+			if !audited[patientID] {
+				audited[patientID] = true
+				if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientDuplicate", duplicate.ID, patientID, nil, nil); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  duplicates,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// DismissDuplicate marks a queued pair as different people
+// @Summary Dismiss a possible duplicate
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param id path int true "Duplicate ID"
+// @Success 200 {object} models.PatientDuplicate
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/patients/duplicates/{id}/dismiss [post]
+func (h *PatientHandler) DismissDuplicate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duplicate ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	duplicate, err := h.service.DismissDuplicate(c.Request.Context(), uint(id), middleware.CurrentUserID(c), req.Reason)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duplicate not found"})
+		return
+	}
+	if errors.Is(err, service.ErrDuplicateReviewed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicate)
+}
+
+// GetPatientByMRN finds a patient by MRN
+// @Summary Get a patient by MRN
+// @Description The MRN of a merged record resolves to the patient it was merged into
+// @Tags patients
+// @Produce json
+// @Param mrn path string true "Medical record number"
+// @Success 200 {object} models.Patient
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/mrn/{mrn} [get]
+func (h *PatientHandler) GetPatientByMRN(c *gin.Context) {
+	patient, err := h.service.GetPatientByMRN(c.Param("mrn"))
+	if errors.Is(err, service.ErrInvalidMRN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Patient", patient.ID, patient.ID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, patient)
+}
+
+// MergePatient merges a duplicate record into this patient
+// @Summary Merge a duplicate patient
+// @Description Moves all records of the duplicate to this patient in one transaction. The duplicate becomes inactive and its MRN resolves to this patient.
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param id path int true "Surviving patient ID"
+// @Success 201 {object} models.PatientMerge
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/patients/{id}/merge [post]
+func (h *PatientHandler) MergePatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	var req struct {
+		DuplicateID uint   `json:"duplicate_id" binding:"required"`
+		Reason      string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merge, err := h.service.MergePatients(c.Request.Context(), uint(id), req.DuplicateID, req.Reason, middleware.CurrentUserID(c))
+	if err != nil {
+		h.mergeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, merge)
+}
+
+// UnmergePatient reverses a merge
+// @Summary Undo a patient merge
+// @Description Moves the records that were merged back to the duplicate and reactivates it
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param id path int true "Merge ID"
+// @Success 200 {object} models.PatientMerge
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/patients/merges/{id}/unmerge [post]
+func (h *PatientHandler) UnmergePatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merge, err := h.service.UnmergePatients(c.Request.Context(), uint(id), middleware.CurrentUserID(c), req.Reason)
+	if err != nil {
+		h.mergeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
+
+// ListMerges lists the merges a patient took part in
+// @Summary List patient merges
+// @Tags patients
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {array} models.PatientMerge
+// @Router /api/v1/patients/{id}/merges [get]
+func (h *PatientHandler) ListMerges(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	merges, err := h.service.ListMerges(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, merges)
+}
+
+func (h *PatientHandler) mergeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMergeSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPatientMerged), errors.Is(err, service.ErrMergeUndone),
+		errors.Is(err, service.ErrSurvivorMerged), errors.Is(err, repository.ErrMergeConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // GetPatientHistory gets complete patient history
 // @Summary Get patient history
 // @Description Get complete patient history including encounters, medications, labs
@@ -193,6 +505,10 @@ func (h *PatientHandler) GetPatientHistory(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientHistory", uint(id), uint(id), nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, history)
 }
@@ -212,7 +528,12 @@ func (h *PatientHandler) DeletePatient(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeletePatient(uint(id)); err != nil {
+	if _, err := h.service.GetPatientByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+
+	if err := h.service.DeletePatient(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
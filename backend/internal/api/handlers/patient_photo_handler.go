@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type PatientPhotoHandler struct {
+	service *service.PatientPhotoService
+	audit   *service.AuditService
+}
+
+func NewPatientPhotoHandler(service *service.PatientPhotoService, audit *service.AuditService) *PatientPhotoHandler {
+	return &PatientPhotoHandler{service: service, audit: audit}
+}
+
+// UploadPhoto replaces a patient's photo
+// @Summary Upload a patient photo
+// @Description JPEG or PNG up to 10 MB in the multipart field "photo". Metadata such as EXIF is removed and thumbnails are generated.
+// @Tags patients
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Param photo formData file true "Photo"
+// @Success 201 {object} models.PatientPhoto
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/patients/{id}/photo [post]
+func (h *PatientPhotoHandler) UploadPhoto(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	// Room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxPhotoBytes+1<<20)
+	file, err := c.FormFile("photo")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrPhotoTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Photo is required"})
+		return
+	}
+	if file.Size > service.MaxPhotoBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrPhotoTooLarge.Error()})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	photo, err := h.service.Upload(c.Request.Context(), uint(id), data, middleware.CurrentUserID(c))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	case errors.Is(err, service.ErrPhotoTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUnsupportedPhoto):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrPatientMerged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, photo)
+}
+
+// GetPhoto serves a patient's current photo
+// @Summary Get a patient photo
+// @Tags patients
+// @Produce image/jpeg
+// @Produce image/png
+// @Param id path int true "Patient ID"
+// @Param size query string false "original, medium (default) or small"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/photo [get]
+func (h *PatientPhotoHandler) GetPhoto(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	data, contentType, err := h.service.Open(uint(id), c.DefaultQuery("size", "medium"))
+	switch {
+	case errors.Is(err, service.ErrUnknownPhotoSize):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient has no photo"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "PatientPhoto", uint(id), uint(id), nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Photos are patient data: private caches only
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// DeletePhoto removes a patient's photo
+// @Summary Delete a patient photo
+// @Tags patients
+// @Param id path int true "Patient ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/patients/{id}/photo [delete]
+func (h *PatientPhotoHandler) DeletePhoto(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	if _, err := h.service.GetPhoto(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient has no photo"})
+		return
+	}
+	if err := h.service.DeletePhoto(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
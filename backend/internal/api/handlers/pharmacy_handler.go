@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
@@ -25,7 +26,7 @@ func (h *PharmacyHandler) AddStock(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.AddStock(&stock); err != nil {
+	if err := h.service.AddStock(c.Request.Context(), &stock, middleware.CurrentUserID(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -46,13 +47,18 @@ func (h *PharmacyHandler) GetStock(c *gin.Context) {
 }
 
 func (h *PharmacyHandler) GetLowStock(c *gin.Context) {
-	stocks, err := h.service.GetLowStockAlerts()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	stocks, err := h.service.GetLowStockAlerts(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, stocks)
+	respondList(c, stocks, query)
 }
 
 func (h *PharmacyHandler) DispenseMedication(c *gin.Context) {
@@ -61,8 +67,9 @@ func (h *PharmacyHandler) DispenseMedication(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	dispensing.DispensedBy = middleware.CurrentUserID(c)
 
-	if err := h.service.DispenseMedication(&dispensing); err != nil {
+	if err := h.service.DispenseMedication(c.Request.Context(), &dispensing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -71,25 +78,34 @@ func (h *PharmacyHandler) DispenseMedication(c *gin.Context) {
 }
 
 func (h *PharmacyHandler) GetDispensingQueue(c *gin.Context) {
-	prescriptions, err := h.service.GetDispensingQueue()
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	prescriptions, err := h.service.GetDispensingQueue(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, prescriptions)
+	respondList(c, prescriptions, query)
 }
 
 func (h *PharmacyHandler) GetPatientHistory(c *gin.Context) {
 	patientID, _ := strconv.Atoi(c.Param("patient_id"))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
 
-	history, err := h.service.GetPatientDispensingHistory(uint(patientID))
+	history, err := h.service.GetPatientDispensingHistory(uint(patientID), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, history)
+	respondList(c, history, query)
 }
 
 func (h *PharmacyHandler) GetStockMovements(c *gin.Context) {
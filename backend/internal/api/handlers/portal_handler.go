@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
@@ -15,6 +19,8 @@ type PortalHandler struct {
 	labService          *service.LabService
 	medicationService   *service.MedicationService
 	clinicalNoteService *service.ClinicalNoteService
+	accessService       *service.PortalAccessService
+	auditService        *service.AuditService
 }
 
 func NewPortalHandler(
@@ -23,6 +29,8 @@ func NewPortalHandler(
 	labService *service.LabService,
 	medicationService *service.MedicationService,
 	clinicalNoteService *service.ClinicalNoteService,
+	accessService *service.PortalAccessService,
+	auditService *service.AuditService,
 ) *PortalHandler {
 	return &PortalHandler{
 		patientService:      patientService,
@@ -30,68 +38,109 @@ func NewPortalHandler(
 		labService:          labService,
 		medicationService:   medicationService,
 		clinicalNoteService: clinicalNoteService,
+		accessService:       accessService,
+		auditService:        auditService,
 	}
 }
 
+// resolvePatientID returns the patient the logged-in portal user is acting for.
+// The patient comes from the token; an optional patient_id query parameter selects
+// a delegated patient (caregiver/proxy access). It writes the error response and
+// returns false if access is not permitted.
+func (h *PortalHandler) resolvePatientID(c *gin.Context) (uint, bool) {
+	var requested uint
+	if raw := c.Query("patient_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+			return 0, false
+		}
+		requested = uint(id)
+	}
+
+	patientID, err := h.accessService.ResolvePatientID(middleware.CurrentUserID(c), middleware.CurrentPatientID(c), requested)
+	if err != nil {
+		if errors.Is(err, service.ErrPortalAccessDenied) || errors.Is(err, service.ErrConsentRequired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return patientID, true
+}
+
 // GetDashboard returns a summary for the patient dashboard
 func (h *PortalHandler) GetDashboard(c *gin.Context) {
-	// In a real app, we'd get the patient ID from the authenticated user context
-	// For MVP, we'll accept it as a query param or header, but strictly it should come from the token
-	// c.GetInt("patient_id")
-
-	patientID, _ := strconv.Atoi(c.Query("patient_id"))
-	if patientID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Patient ID required"})
+	patientID, ok := h.resolvePatientID(c)
+	if !ok {
 		return
 	}
 
-	patient, err := h.patientService.GetPatientByID(uint(patientID))
+	patient, err := h.patientService.GetPatientByID(patientID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
 		return
 	}
 
-	appointments, err := h.appointmentService.ListPatientAppointments(uint(patientID))
-	// Slice to get top 5
-	if len(appointments) > 5 {
-		appointments = appointments[:5]
+	appointments, err := h.appointmentService.ListPatientAppointments(patientID, repository.ListQuery{Limit: 5})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"patient":      patient,
-		"appointments": appointments,
+		"appointments": appointments.Data,
 		"alerts":       []string{}, // Placeholder for alerts
 	})
 }
 
 func (h *PortalHandler) GetAppointments(c *gin.Context) {
-	patientID, _ := strconv.Atoi(c.Query("patient_id"))
-	appointments, err := h.appointmentService.ListPatientAppointments(uint(patientID))
+	patientID, ok := h.resolvePatientID(c)
+	if !ok {
+		return
+	}
+
+	query, ok := listQuery(c, "patient_id")
+	if !ok {
+		return
+	}
+
+	appointments, err := h.appointmentService.ListPatientAppointments(patientID, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": appointments, "total": len(appointments)})
+	respondList(c, appointments, query)
 }
 
 func (h *PortalHandler) GetRecords(c *gin.Context) {
-	patientID, _ := strconv.Atoi(c.Query("patient_id"))
+	patientID, ok := h.resolvePatientID(c)
+	if !ok {
+		return
+	}
 
 	// Fetch various records
-	// This is a simplified aggregation
-	notes, err := h.clinicalNoteService.ListPatientNotes(uint(patientID), 10)
-	if err != nil {
-		notes = []*models.ClinicalNote{}
+	// This is a simplified aggregation of the latest of each
+	notes := []*models.ClinicalNote{}
+	if page, err := h.clinicalNoteService.ListPatientNotes(patientID, repository.ListQuery{Limit: 10}); err == nil {
+		notes = page.Data
 	}
 
-	prescriptions, err := h.medicationService.ListPatientPrescriptions(uint(patientID))
-	if err != nil {
-		prescriptions = []*models.Prescription{}
+	prescriptions := []*models.Prescription{}
+	if page, err := h.medicationService.ListPatientPrescriptions(patientID, repository.ListQuery{Limit: repository.MaxListLimit}); err == nil {
+		prescriptions = page.Data
 	}
 
-	labOrders, err := h.labService.ListPatientLabOrders(uint(patientID))
-	if err != nil {
-		labOrders = []*models.LabOrder{}
+	labOrders := []*models.LabOrder{}
+	if page, err := h.labService.ListPatientLabOrders(patientID, repository.ListQuery{Limit: repository.MaxListLimit}); err == nil {
+		labOrders = page.Data
+	}
+
+	if err := h.auditService.Record(middleware.AuditActor(c), models.AuditActionRead, "PortalRecords", patientID, patientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -100,3 +149,174 @@ func (h *PortalHandler) GetRecords(c *gin.Context) {
 		"lab_orders":     labOrders,
 	})
 }
+
+// GetAccessLog shows the patient who accessed or changed their record
+func (h *PortalHandler) GetAccessLog(c *gin.Context) {
+	patientID, ok := h.resolvePatientID(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	events, total, err := h.auditService.ListEvents(repository.AuditFilter{PatientID: &patientID}, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only expose who, what and when; change details and client IPs stay internal
+	type accessEntry struct {
+		RecordedAt   time.Time `json:"recorded_at"`
+		ActorID      uint      `json:"actor_id"`
+		ActorRole    string    `json:"actor_role"`
+		Action       string    `json:"action"`
+		ResourceType string    `json:"resource_type"`
+	}
+	entries := make([]accessEntry, 0, len(events))
+	for _, e := range events {
+		entries = append(entries, accessEntry{
+			RecordedAt:   e.RecordedAt,
+			ActorID:      e.ActorID,
+			ActorRole:    e.ActorRole,
+			Action:       e.Action,
+			ResourceType: e.ResourceType,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetDelegatedPatients lists the patients the portal user may view as a caregiver/proxy
+func (h *PortalHandler) GetDelegatedPatients(c *gin.Context) {
+	delegations, err := h.accessService.ListProxyDelegations(middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delegations)
+}
+
+// GetDependents lists the children linked to the portal user's own record as
+// mother or head of household; staff delegate access to them with
+// DelegateDependents
+func (h *PortalHandler) GetDependents(c *gin.Context) {
+	dependents, err := h.accessService.ListDependents(middleware.CurrentPatientID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dependents)
+}
+
+// CreateDelegation grants a portal user proxy access to a patient's records
+func (h *PortalHandler) CreateDelegation(c *gin.Context) {
+	var req struct {
+		ProxyUserID  uint       `json:"proxy_user_id" binding:"required"`
+		PatientID    uint       `json:"patient_id" binding:"required"`
+		Relationship string     `json:"relationship" binding:"required"`
+		ValidFrom    time.Time  `json:"valid_from"`
+		ValidUntil   *time.Time `json:"valid_until"`
+		Notes        string     `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delegation := models.PortalDelegation{
+		ProxyUserID:  req.ProxyUserID,
+		PatientID:    req.PatientID,
+		Relationship: req.Relationship,
+		ValidFrom:    req.ValidFrom,
+		ValidUntil:   req.ValidUntil,
+		GrantedBy:    middleware.CurrentUserID(c),
+		Notes:        req.Notes,
+	}
+	created, err := h.accessService.CreateDelegation(c.Request.Context(), &delegation)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DelegateDependents grants a portal user access to the children linked to
+// their own record, until each turns 18
+func (h *PortalHandler) DelegateDependents(c *gin.Context) {
+	var req struct {
+		ProxyUserID uint `json:"proxy_user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.accessService.DelegateDependents(c.Request.Context(), req.ProxyUserID, middleware.CurrentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidProxyUser) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// RevokeDelegation ends a caregiver/proxy delegation
+func (h *PortalHandler) RevokeDelegation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delegation ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delegation, err := h.accessService.RevokeDelegation(c.Request.Context(), uint(id), req.Reason, middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delegation)
+}
+
+// ListPatientDelegations lists all delegations (active and revoked) for a patient
+func (h *PortalHandler) ListPatientDelegations(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	delegations, err := h.accessService.ListPatientDelegations(uint(patientID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delegations)
+}
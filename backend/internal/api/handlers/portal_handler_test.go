@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDelegation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	mrnFormat, err := service.NewMRNFormat("", "")
+	require.NoError(t, err)
+	patients := service.NewPatientService(repository.NewPatientRepository(db), repository.NewPatientDuplicateRepository(db),
+		repository.NewPatientMergeRepository(db), mrnFormat)
+	access := service.NewPortalAccessService(repository.NewPortalDelegationRepository(db), repository.NewHouseholdRepository(db),
+		repository.NewUserRepository(db), patients, service.NewConsentService(repository.NewConsentRepository(db), patients))
+	h := NewPortalHandler(patients, nil, nil, nil, nil, access, nil)
+
+	patient := &models.Patient{MRN: fmt.Sprintf("TEST-%d", time.Now().UnixNano())}
+	require.NoError(t, db.Create(patient).Error)
+	proxy := &models.User{Username: "proxy", Password: "x", Email: "proxy@example.org", Role: models.RolePatient, Active: true}
+	require.NoError(t, db.Create(proxy).Error)
+
+	router := gin.New()
+	router.POST("/portal-delegations", func(c *gin.Context) {
+		c.Set(middleware.ContextUserID, uint(7))
+	}, h.CreateDelegation)
+	post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/portal-delegations", bytes.NewReader(payload)))
+		return w
+	}
+
+	// Fields the server owns are not taken from the request
+	w := post(map[string]interface{}{
+		"proxy_user_id": proxy.ID, "patient_id": patient.ID, "relationship": "caregiver",
+		"id": 9999, "granted_by": 1, "revoked_at": time.Now(), "revoked_by": 1, "revocation_reason": "pre-revoked",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.PortalDelegation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEqual(t, uint(9999), created.ID)
+	assert.Equal(t, uint(7), created.GrantedBy)
+	assert.Nil(t, created.RevokedAt)
+	assert.Nil(t, created.RevokedBy)
+	assert.Empty(t, created.RevocationReason)
+	assert.True(t, created.IsActive())
+
+	tests := []struct {
+		name     string
+		body     map[string]interface{}
+		wantCode int
+	}{
+		{"unknown proxy user", map[string]interface{}{"proxy_user_id": proxy.ID + 1000, "patient_id": patient.ID, "relationship": "caregiver"}, http.StatusNotFound},
+		{"unknown patient", map[string]interface{}{"proxy_user_id": proxy.ID, "patient_id": patient.ID + 1000, "relationship": "caregiver"}, http.StatusNotFound},
+		{"no relationship", map[string]interface{}{"proxy_user_id": proxy.ID, "patient_id": patient.ID}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, post(tt.body).Code)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type ProgramHandler struct {
+	service *service.ProgramService
+	audit   *service.AuditService
+}
+
+func NewProgramHandler(service *service.ProgramService, audit *service.AuditService) *ProgramHandler {
+	return &ProgramHandler{service: service, audit: audit}
+}
+
+// Enrol enrols a patient in a chronic disease program
+// @Summary Enrol a patient in a program
+// @Description Enrols a patient in the hypertension or diabetes program, e.g. on transfer in; screened patients are enrolled from their NCD screening. The first follow-up visit is due follow_up_days after enrolled_at (default: the program's schedule).
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Param enrolment body models.ProgramEnrolment true "Enrolment"
+// @Success 201 {object} models.ProgramEnrolment
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/program-enrolments [post]
+func (h *ProgramHandler) Enrol(c *gin.Context) {
+	var enrolment models.ProgramEnrolment
+	if err := c.ShouldBindJSON(&enrolment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enrolment.BaseModel = models.BaseModel{}
+	enrolment.NCDScreeningID = nil
+	enrolment.Visits = nil
+
+	saved, err := h.service.Enrol(c.Request.Context(), &enrolment, middleware.CurrentUserID(c))
+	if err != nil {
+		programError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, saved)
+}
+
+// GetEnrolment gets a program enrolment
+// @Summary Get a program enrolment
+// @Description The enrolment with its visits, latest first, and control: the latest BP and HbA1c and whether they are under 140/90 and 7%.
+// @Tags programs
+// @Produce json
+// @Param id path int true "Enrolment ID"
+// @Success 200 {object} models.ProgramEnrolment
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/program-enrolments/{id} [get]
+func (h *ProgramHandler) GetEnrolment(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid enrolment ID")
+	if !ok {
+		return
+	}
+
+	enrolment, err := h.service.GetEnrolment(id)
+	if err != nil {
+		programError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "ProgramEnrolment", enrolment.ID, enrolment.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrolment)
+}
+
+// RecordVisit records a follow-up visit of an enrolment
+// @Summary Record a program follow-up visit
+// @Description Marks the due visit attended on visit_date (default now), optionally with the encounter_id, and schedules the next visit on next_visit_date or after the follow-up interval.
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Param id path int true "Enrolment ID"
+// @Success 200 {object} models.ProgramEnrolment
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/program-enrolments/{id}/visits [post]
+func (h *ProgramHandler) RecordVisit(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid enrolment ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		EncounterID   *uint      `json:"encounter_id"`
+		VisitDate     time.Time  `json:"visit_date"`
+		NextVisitDate *time.Time `json:"next_visit_date"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.RecordVisit(c.Request.Context(), id, req.EncounterID, req.VisitDate, req.NextVisitDate, middleware.CurrentUserID(c))
+	if err != nil {
+		programError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Exit records a patient leaving a program
+// @Summary Exit a program
+// @Description Records the outcome (transferred-out, died, lost-to-follow-up, stopped-treatment, discharged) and cancels the due visit.
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Param id path int true "Enrolment ID"
+// @Success 200 {object} models.ProgramEnrolment
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/program-enrolments/{id}/exit [post]
+func (h *ProgramHandler) Exit(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid enrolment ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Outcome string `json:"outcome"`
+		Notes   string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.Exit(c.Request.Context(), id, req.Outcome, req.Notes, middleware.CurrentUserID(c))
+	if err != nil {
+		programError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// ListEnrolments lists program enrolments
+// @Summary List program enrolments
+// @Description Latest first, with control. Filter on any field, e.g. program=diabetes or status=active.
+// @Tags programs
+// @Produce json
+// @Success 200 {object} repository.Page[models.ProgramEnrolment]
+// @Router /api/v1/program-enrolments [get]
+func (h *ProgramHandler) ListEnrolments(c *gin.Context) {
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	enrolments, err := h.service.ListEnrolments(query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, enrolments, query)
+}
+
+// ListPatientEnrolments lists a patient's program enrolments
+// @Summary List a patient's program enrolments
+// @Tags programs
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} repository.Page[models.ProgramEnrolment]
+// @Router /api/v1/patients/{id}/program-enrolments [get]
+func (h *ProgramHandler) ListPatientEnrolments(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	enrolments, err := h.service.ListPatientEnrolments(patientID, query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, enrolments, query)
+}
+
+// ListDefaulters lists patients who missed a follow-up visit
+// @Summary Program defaulters
+// @Description Active enrolments whose due visit is more than days overdue (default 7), longest overdue first, with the patient's phone for tracing.
+// @Tags programs
+// @Produce json
+// @Param program query string false "hypertension or diabetes"
+// @Param days query int false "Days overdue"
+// @Success 200 {array} models.ProgramDefaulter
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/programs/defaulters [get]
+func (h *ProgramHandler) ListDefaulters(c *gin.Context) {
+	days, ok := defaulterDays(c)
+	if !ok {
+		return
+	}
+
+	defaulters, err := h.service.Defaulters(c.Query("program"), days)
+	if err != nil {
+		programError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, defaulters)
+}
+
+// GetIndicators returns the control indicators of the programs
+// @Summary Program control indicators
+// @Description Per program: active enrolments, defaulters more than days overdue (default 7), patients with BP under 140/90 and with HbA1c under 7% at their latest measurement among those measured, and exits by outcome.
+// @Tags programs
+// @Produce json
+// @Param program query string false "hypertension or diabetes"
+// @Param days query int false "Days overdue"
+// @Success 200 {array} models.ProgramIndicators
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/programs/indicators [get]
+func (h *ProgramHandler) GetIndicators(c *gin.Context) {
+	days, ok := defaulterDays(c)
+	if !ok {
+		return
+	}
+
+	indicators, err := h.service.Indicators(c.Query("program"), days)
+	if err != nil {
+		programError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, indicators)
+}
+
+// GetSchedules returns the days between follow-up visits of each program
+// @Summary Program follow-up schedules
+// @Tags programs
+// @Produce json
+// @Success 200 {object} models.ProgramFollowUpSchedules
+// @Router /api/v1/programs/schedules [get]
+func (h *ProgramHandler) GetSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Schedules())
+}
+
+// defaulterDays reads the days overdue of a defaulter query
+func defaulterDays(c *gin.Context) (int, bool) {
+	raw := c.Query("days")
+	if raw == "" {
+		return models.DefaultDefaulterDays, true
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return 0, false
+	}
+	return days, true
+}
+
+func programError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrProgramEnrolmentExists), errors.Is(err, models.ErrProgramEnrolmentExited):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
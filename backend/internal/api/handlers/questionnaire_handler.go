@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type QuestionnaireHandler struct {
+	service *service.QuestionnaireService
+	audit   *service.AuditService
+}
+
+func NewQuestionnaireHandler(service *service.QuestionnaireService, audit *service.AuditService) *QuestionnaireHandler {
+	return &QuestionnaireHandler{service: service, audit: audit}
+}
+
+// CreateQuestionnaire stores a form definition
+// @Summary Create a questionnaire
+// @Description Stores a FHIR Questionnaire as a draft. Supported item types: group, display, boolean, decimal, integer, date, dateTime, time, string, text, choice, open-choice and quantity, with enableWhen, required, repeats, maxLength, answerOption and the minValue, maxValue, regex, questionnaire-unit, sdc-questionnaire-calculatedExpression and sdc-questionnaire-observationExtract extensions. Problems are returned as issues.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param questionnaire body fhir.Questionnaire true "FHIR Questionnaire"
+// @Success 201 {object} fhir.Questionnaire
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/questionnaires [post]
+func (h *QuestionnaireHandler) CreateQuestionnaire(c *gin.Context) {
+	var definition fhir.Questionnaire
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.CreateQuestionnaire(c.Request.Context(), &definition, middleware.CurrentUserID(c))
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaire(c, http.StatusCreated, saved)
+}
+
+// GetQuestionnaire gets a form definition
+// @Summary Get a questionnaire
+// @Description The FHIR Questionnaire the frontend renders the form from.
+// @Tags questionnaires
+// @Produce json
+// @Param id path int true "Questionnaire ID"
+// @Success 200 {object} fhir.Questionnaire
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/questionnaires/{id} [get]
+func (h *QuestionnaireHandler) GetQuestionnaire(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire ID")
+	if !ok {
+		return
+	}
+
+	questionnaire, err := h.service.GetQuestionnaire(id)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaire(c, http.StatusOK, questionnaire)
+}
+
+// UpdateQuestionnaire replaces a draft form definition
+// @Summary Update a draft questionnaire
+// @Description Only drafts can be changed; to change a published form, create a new version.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param id path int true "Questionnaire ID"
+// @Param questionnaire body fhir.Questionnaire true "FHIR Questionnaire"
+// @Success 200 {object} fhir.Questionnaire
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/questionnaires/{id} [put]
+func (h *QuestionnaireHandler) UpdateQuestionnaire(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire ID")
+	if !ok {
+		return
+	}
+	var definition fhir.Questionnaire
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.UpdateQuestionnaire(c.Request.Context(), id, &definition)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaire(c, http.StatusOK, updated)
+}
+
+// SetQuestionnaireStatus publishes or retires a form
+// @Summary Publish or retire a questionnaire
+// @Description Drafts are published as active; active questionnaires can be retired and reactivated. Responses can only be submitted to active questionnaires.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param id path int true "Questionnaire ID"
+// @Success 200 {object} fhir.Questionnaire
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/questionnaires/{id}/status [post]
+func (h *QuestionnaireHandler) SetQuestionnaireStatus(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire ID")
+	if !ok {
+		return
+	}
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.SetQuestionnaireStatus(c.Request.Context(), id, req.Status)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaire(c, http.StatusOK, updated)
+}
+
+// ListQuestionnaires lists form definitions
+// @Summary List questionnaires
+// @Description Latest first, without their items. Filter on any field, e.g. status=active or url=...
+// @Tags questionnaires
+// @Produce json
+// @Success 200 {object} repository.Page[models.Questionnaire]
+// @Router /api/v1/questionnaires [get]
+func (h *QuestionnaireHandler) ListQuestionnaires(c *gin.Context) {
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	questionnaires, err := h.service.ListQuestionnaires(query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, questionnaires, query)
+}
+
+// ValidateResponse checks answers against a form without saving them
+// @Summary Validate a questionnaire response
+// @Description Returns the response as it would be saved, with calculated items filled in and items that are not enabled removed, and the issues found. Required items are enforced when the status is completed.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param id path int true "Questionnaire ID"
+// @Param response body fhir.QuestionnaireResponse true "FHIR QuestionnaireResponse"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/questionnaires/{id}/validate [post]
+func (h *QuestionnaireHandler) ValidateResponse(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire ID")
+	if !ok {
+		return
+	}
+	var response fhir.QuestionnaireResponse
+	if err := c.ShouldBindJSON(&response); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	processed, issues, err := h.service.ValidateResponse(id, &response)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": len(issues) == 0, "issues": issues, "response": processed})
+}
+
+// SubmitResponse saves a patient's answers to a form
+// @Summary Submit a questionnaire response
+// @Description questionnaire is the canonical url|version of an active questionnaire (or its url, for the latest active version), subject the Patient and encounter, optionally, one of theirs. The answers are validated and calculated items filled in; observations are extracted from completed responses for items marked with sdc-questionnaire-observationExtract.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param response body fhir.QuestionnaireResponse true "FHIR QuestionnaireResponse"
+// @Success 201 {object} fhir.QuestionnaireResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/questionnaire-responses [post]
+func (h *QuestionnaireHandler) SubmitResponse(c *gin.Context) {
+	var response fhir.QuestionnaireResponse
+	if err := c.ShouldBindJSON(&response); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.SubmitResponse(c.Request.Context(), &response, middleware.CurrentUserID(c))
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaireResponse(c, http.StatusCreated, saved)
+}
+
+// GetResponse gets a patient's answers to a form
+// @Summary Get a questionnaire response
+// @Tags questionnaires
+// @Produce json
+// @Param id path int true "Questionnaire response ID"
+// @Success 200 {object} fhir.QuestionnaireResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/questionnaire-responses/{id} [get]
+func (h *QuestionnaireHandler) GetResponse(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire response ID")
+	if !ok {
+		return
+	}
+
+	submission, err := h.service.GetResponse(id)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "QuestionnaireSubmission", submission.ID, submission.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondQuestionnaireResponse(c, http.StatusOK, submission)
+}
+
+// UpdateResponse replaces a patient's answers to a form
+// @Summary Update a questionnaire response
+// @Description Replaces the answers. Changing a completed response amends it and extracts its observations again; status entered-in-error withdraws it and its observations. The questionnaire, subject and encounter cannot change.
+// @Tags questionnaires
+// @Accept json
+// @Produce json
+// @Param id path int true "Questionnaire response ID"
+// @Param response body fhir.QuestionnaireResponse true "FHIR QuestionnaireResponse"
+// @Success 200 {object} fhir.QuestionnaireResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/questionnaire-responses/{id} [put]
+func (h *QuestionnaireHandler) UpdateResponse(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire response ID")
+	if !ok {
+		return
+	}
+	var response fhir.QuestionnaireResponse
+	if err := c.ShouldBindJSON(&response); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.service.UpdateResponse(c.Request.Context(), id, &response, middleware.CurrentUserID(c))
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+
+	respondQuestionnaireResponse(c, http.StatusOK, updated)
+}
+
+// GetResponseObservations lists the observations extracted from a response
+// @Summary Observations of a questionnaire response
+// @Tags questionnaires
+// @Produce json
+// @Param id path int true "Questionnaire response ID"
+// @Success 200 {array} models.QuestionnaireObservation
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/questionnaire-responses/{id}/observations [get]
+func (h *QuestionnaireHandler) GetResponseObservations(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid questionnaire response ID")
+	if !ok {
+		return
+	}
+
+	submission, err := h.service.GetResponse(id)
+	if err != nil {
+		questionnaireError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "QuestionnaireSubmission", submission.ID, submission.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	observations := submission.Observations
+	if observations == nil {
+		observations = []models.QuestionnaireObservation{}
+	}
+	c.JSON(http.StatusOK, observations)
+}
+
+// ListPatientResponses lists a patient's questionnaire responses
+// @Summary List a patient's questionnaire responses
+// @Description Latest first, with their questionnaire; each response is read by ID.
+// @Tags questionnaires
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Success 200 {object} repository.Page[models.QuestionnaireSubmission]
+// @Router /api/v1/patients/{id}/questionnaire-responses [get]
+func (h *QuestionnaireHandler) ListPatientResponses(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	submissions, err := h.service.ListPatientResponses(patientID, query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "QuestionnaireSubmission", 0, patientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, submissions, query)
+}
+
+// ListEncounterResponses lists an encounter's questionnaire responses
+// @Summary List an encounter's questionnaire responses
+// @Tags questionnaires
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Success 200 {object} repository.Page[models.QuestionnaireSubmission]
+// @Router /api/v1/encounters/{id}/questionnaire-responses [get]
+func (h *QuestionnaireHandler) ListEncounterResponses(c *gin.Context) {
+	encounterID, ok := parseID(c, "id", "Invalid encounter ID")
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
+
+	submissions, err := h.service.ListEncounterResponses(encounterID, query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, submissions, query)
+}
+
+// respondQuestionnaire writes a stored questionnaire as its FHIR resource
+func respondQuestionnaire(c *gin.Context, status int, questionnaire *models.Questionnaire) {
+	res, err := fhir.QuestionnaireFromModel(questionnaire)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, res)
+}
+
+// respondQuestionnaireResponse writes a submission as its FHIR resource
+func respondQuestionnaireResponse(c *gin.Context, status int, submission *models.QuestionnaireSubmission) {
+	res, err := fhir.QuestionnaireResponseFromSubmission(submission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, res)
+}
+
+func questionnaireError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	var issues *service.QuestionnaireIssuesError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &issues):
+		c.JSON(http.StatusBadRequest, gin.H{"error": issues.Message, "issues": issues.Issues})
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrQuestionnaireNotDraft), errors.Is(err, models.ErrQuestionnaireNotActive),
+		errors.Is(err, models.ErrQuestionnaireExists), errors.Is(err, models.ErrSubmissionEnteredInError):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,395 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+// queueSnapshotInterval is how often display screens get the whole queue
+// again, which also keeps the connection open through proxies
+const queueSnapshotInterval = 30 * time.Second
+
+type QueueHandler struct {
+	service *service.QueueService
+}
+
+func NewQueueHandler(service *service.QueueService) *QueueHandler {
+	return &QueueHandler{service: service}
+}
+
+// ListQueues summarizes the queue of every service point on a day
+// @Summary Queue summary
+// @Description Per service point: tokens waiting, called, done, skipped and transferred, and median and mean wait, longest current wait and median service time in minutes.
+// @Tags queues
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), today by default"
+// @Success 200 {array} models.QueueStats
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/queues [get]
+func (h *QueueHandler) ListQueues(c *gin.Context) {
+	date, ok := queueDate(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.service.Stats(date)
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// CheckIn issues a patient a token at a service point
+// @Summary Check a patient in to a queue
+// @Description Issues today's next token number at the service point (general, ncd, mhpss, mnch-fp, laboratory, pharmacy, emergency). A planned encounter given with the check-in is marked arrived.
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param point path string true "Service point"
+// @Success 201 {object} models.QueueToken
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queues/{point}/check-in [post]
+func (h *QueueHandler) CheckIn(c *gin.Context) {
+	var req struct {
+		PatientID   uint  `json:"patient_id" binding:"required"`
+		EncounterID *uint `json:"encounter_id"`
+		Priority    bool  `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token := &models.QueueToken{PatientID: req.PatientID, EncounterID: req.EncounterID, Priority: req.Priority}
+	created, err := h.service.CheckIn(c.Request.Context(), c.Param("point"), token, middleware.CurrentUserID(c))
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// CallNext calls the next patient of a service point's queue
+// @Summary Call the next patient
+// @Description Priority tokens first, then in order of check-in.
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param point path string true "Service point"
+// @Success 200 {object} models.QueueToken
+// @Failure 404 {object} map[string]string "Nobody waiting"
+// @Router /api/v1/queues/{point}/call-next [post]
+func (h *QueueHandler) CallNext(c *gin.Context) {
+	var req struct {
+		Counter string `json:"counter"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.service.CallNext(c.Request.Context(), c.Param("point"), strings.TrimSpace(req.Counter), middleware.CurrentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No patients waiting"})
+		return
+	}
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// ListTokens lists a service point's tokens of a day by number
+// @Summary List queue tokens
+// @Description Takes the list parameters (cursor, limit, sort, fields) and filters on token fields, e.g. status=waiting.
+// @Tags queues
+// @Produce json
+// @Param point path string true "Service point"
+// @Param date query string false "Day (YYYY-MM-DD), today by default"
+// @Success 200 {object} repository.Page[models.QueueToken]
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/queues/{point}/tokens [get]
+func (h *QueueHandler) ListTokens(c *gin.Context) {
+	date, ok := queueDate(c)
+	if !ok {
+		return
+	}
+	query, ok := listQuery(c, "date")
+	if !ok {
+		return
+	}
+
+	tokens, err := h.service.ListTokens(c.Param("point"), date, query)
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	respondList(c, tokens, query)
+}
+
+// GetToken gets a queue token
+// @Summary Get a queue token
+// @Tags queues
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.QueueToken
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id} [get]
+func (h *QueueHandler) GetToken(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid token ID")
+	if !ok {
+		return
+	}
+
+	token, err := h.service.GetToken(id)
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// CallToken calls a particular token, out of turn or again
+// @Summary Call or recall a token
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.QueueToken
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id}/call [post]
+func (h *QueueHandler) CallToken(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid token ID")
+	if !ok {
+		return
+	}
+	var req struct {
+		Counter string `json:"counter"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.service.Call(c.Request.Context(), id, strings.TrimSpace(req.Counter), middleware.CurrentUserID(c))
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// SkipToken marks a called patient who did not come as skipped
+// @Summary Skip a token
+// @Tags queues
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.QueueToken
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id}/skip [post]
+func (h *QueueHandler) SkipToken(c *gin.Context) {
+	h.changeToken(c, h.service.Skip)
+}
+
+// RequeueToken puts a skipped patient back in their place in the queue
+// @Summary Requeue a skipped token
+// @Tags queues
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.QueueToken
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id}/requeue [post]
+func (h *QueueHandler) RequeueToken(c *gin.Context) {
+	h.changeToken(c, h.service.Requeue)
+}
+
+// CompleteToken marks a patient as served
+// @Summary Complete a token
+// @Tags queues
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.QueueToken
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id}/complete [post]
+func (h *QueueHandler) CompleteToken(c *gin.Context) {
+	h.changeToken(c, h.service.Complete)
+}
+
+func (h *QueueHandler) changeToken(c *gin.Context, change func(context.Context, uint) (*models.QueueToken, error)) {
+	id, ok := parseID(c, "id", "Invalid token ID")
+	if !ok {
+		return
+	}
+
+	token, err := change(c.Request.Context(), id)
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// TransferToken sends a patient on to another service point's queue
+// @Summary Transfer a token to another queue
+// @Description Closes the token and issues a new one at the service point, e.g. consultation to laboratory to pharmacy. The new token keeps the encounter and, unless given, the priority.
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 201 {object} models.QueueToken "The new token"
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/queue-tokens/{id}/transfer [post]
+func (h *QueueHandler) TransferToken(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid token ID")
+	if !ok {
+		return
+	}
+	var req struct {
+		ServicePoint string `json:"service_point" binding:"required"`
+		Priority     *bool  `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.service.Transfer(c.Request.Context(), id, req.ServicePoint, req.Priority, middleware.CurrentUserID(c))
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// GetDisplay returns today's queues as shown on the waiting-area screens
+// @Summary Queue display
+// @Description Public: token numbers and counters only, no patient details.
+// @Tags queues
+// @Produce json
+// @Param points query string false "Comma-separated service points, all by default"
+// @Success 200 {array} models.QueueDisplay
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/display/queues [get]
+func (h *QueueHandler) GetDisplay(c *gin.Context) {
+	display, err := h.service.Display(queuePoints(c))
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, display)
+}
+
+// DisplayEvents streams queue changes to the waiting-area screens
+// @Summary Queue display events
+// @Description Public Server-Sent Events stream: a "snapshot" event with the queues (as GET /display/queues) on connect and every 30 seconds, and a "queue" event for every token issued, called, skipped, requeued, done or transferred.
+// @Tags queues
+// @Produce text/event-stream
+// @Param points query string false "Comma-separated service points, all by default"
+// @Router /api/v1/display/queues/events [get]
+func (h *QueueHandler) DisplayEvents(c *gin.Context) {
+	codes := queuePoints(c)
+	snapshot, err := h.service.Display(codes)
+	if err != nil {
+		queueError(c, err)
+		return
+	}
+	shown := map[string]bool{}
+	for _, display := range snapshot {
+		shown[display.ServicePoint] = true
+	}
+
+	events, unsubscribe := h.service.Subscribe()
+	defer unsubscribe()
+	ticker := time.NewTicker(queueSnapshotInterval)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("snapshot", snapshot)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if shown[event.ServicePoint] || shown[event.ToServicePoint] {
+				c.SSEvent("queue", event)
+			}
+			return true
+		case <-ticker.C:
+			snapshot, err := h.service.Display(codes)
+			if err != nil {
+				return false
+			}
+			c.SSEvent("snapshot", snapshot)
+			return true
+		}
+	})
+}
+
+// queueDate reads the date query parameter, today by default
+func queueDate(c *gin.Context) (string, bool) {
+	raw := c.Query("date")
+	if raw == "" {
+		return service.QueueDate(time.Now()), true
+	}
+	if _, err := time.Parse(models.QueueDateLayout, raw); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date (YYYY-MM-DD)"})
+		return "", false
+	}
+	return raw, true
+}
+
+// queuePoints reads the comma-separated points query parameter
+func queuePoints(c *gin.Context) []string {
+	var codes []string
+	for _, code := range strings.Split(c.Query("points"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func queueError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation), errors.Is(err, repository.ErrInvalidListQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrQueueTransition), errors.Is(err, models.ErrQueueCheckedIn),
+		errors.Is(err, models.ErrEncounterTransition), errors.Is(err, service.ErrPatientMerged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
@@ -24,7 +25,7 @@ func (h *RadiologyHandler) CreateStudy(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.CreateStudy(&study); err != nil {
+	if err := h.service.CreateStudy(c.Request.Context(), &study); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -45,23 +46,18 @@ func (h *RadiologyHandler) GetStudy(c *gin.Context) {
 }
 
 func (h *RadiologyHandler) ListStudies(c *gin.Context) {
-	patientID, _ := strconv.Atoi(c.Query("patient_id"))
-	status := c.Query("status")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
 
-	studies, total, err := h.service.ListStudies(uint(patientID), status, page, limit)
+	studies, err := h.service.ListStudies(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  studies,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-	})
+	respondList(c, studies, query)
 }
 
 func (h *RadiologyHandler) UpdateStatus(c *gin.Context) {
@@ -78,9 +74,9 @@ func (h *RadiologyHandler) UpdateStatus(c *gin.Context) {
 
 	var err error
 	if req.Status == "in-progress" {
-		err = h.service.StartExam(uint(id), req.TechID)
+		err = h.service.StartExam(c.Request.Context(), uint(id), req.TechID)
 	} else if req.Status == "completed" {
-		err = h.service.CompleteExam(uint(id))
+		err = h.service.CompleteExam(c.Request.Context(), uint(id))
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status transition"})
 		return
@@ -100,8 +96,9 @@ func (h *RadiologyHandler) CreateReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	report.RadiologistID = middleware.CurrentUserID(c)
 
-	if err := h.service.CreateReport(&report); err != nil {
+	if err := h.service.CreateReport(c.Request.Context(), &report); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -116,9 +113,10 @@ func (h *RadiologyHandler) UpdateReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	report.RadiologistID = middleware.CurrentUserID(c)
 
 	report.ID = uint(id)
-	if err := h.service.UpdateReport(&report); err != nil {
+	if err := h.service.UpdateReport(c.Request.Context(), &report); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
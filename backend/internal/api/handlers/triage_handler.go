@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+type TriageHandler struct {
+	service *service.TriageService
+	audit   *service.AuditService
+}
+
+func NewTriageHandler(service *service.TriageService, audit *service.AuditService) *TriageHandler {
+	return &TriageHandler{service: service, audit: audit}
+}
+
+// TriageEncounter triages an emergency encounter on the South African Triage Scale
+// @Summary Triage an emergency encounter
+// @Description Scores the adult TEWS from respiratory rate, pulse, systolic BP, temperature, mobility, AVPU and trauma, and raises the level for the discriminators, pain scale and blood glucose. Vital signs left out are taken from vital_signs_id or the encounter's latest measurement. Setting level to something else than computed needs override_reason. Moves the encounter to triaged; posting again re-triages.
+// @Tags triage
+// @Accept json
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Param triage body models.Triage true "Triage"
+// @Success 201 {object} models.Triage
+// @Success 200 {object} models.Triage "Re-triaged"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/encounters/{id}/triage [post]
+func (h *TriageHandler) TriageEncounter(c *gin.Context) {
+	encounterID, ok := parseID(c, "id", "Invalid encounter ID")
+	if !ok {
+		return
+	}
+
+	var triage models.Triage
+	if err := c.ShouldBindJSON(&triage); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	triage.BaseModel = models.BaseModel{}
+
+	saved, previous, err := h.service.TriageEncounter(c.Request.Context(), encounterID, &triage, middleware.CurrentUserID(c))
+	if err != nil {
+		encounterError(c, err)
+		return
+	}
+
+	if previous != nil {
+		c.JSON(http.StatusOK, saved)
+		return
+	}
+	c.JSON(http.StatusCreated, saved)
+}
+
+// GetTriage gets the triage of an encounter
+// @Summary Get an encounter's triage
+// @Tags triage
+// @Produce json
+// @Param id path int true "Encounter ID"
+// @Success 200 {object} models.Triage
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/encounters/{id}/triage [get]
+func (h *TriageHandler) GetTriage(c *gin.Context) {
+	encounterID, ok := parseID(c, "id", "Invalid encounter ID")
+	if !ok {
+		return
+	}
+
+	triage, err := h.service.GetTriage(encounterID)
+	if err != nil {
+		encounterError(c, err)
+		return
+	}
+	if err := h.audit.Record(middleware.AuditActor(c), models.AuditActionRead, "Triage", triage.ID, triage.PatientID, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, triage)
+}
+
+// ListDiscriminators lists the SATS discriminators with their levels
+// @Summary List triage discriminators
+// @Tags triage
+// @Produce json
+// @Success 200 {array} models.TriageDiscriminator
+// @Router /api/v1/triage/discriminators [get]
+func (h *TriageHandler) ListDiscriminators(c *gin.Context) {
+	c.JSON(http.StatusOK, models.TriageDiscriminators)
+}
+
+// GetBoard returns the emergency department board
+// @Summary Emergency department board
+// @Description Emergency patients waiting to be seen: those awaiting triage by arrival, and the triaged by level (red, orange, yellow, green) and then by arrival, with minutes waited and minutes left to the level's target time (red immediately, orange 10, yellow 60, green 240).
+// @Tags triage
+// @Produce json
+// @Success 200 {object} models.ERBoard
+// @Router /api/v1/er/board [get]
+func (h *TriageHandler) GetBoard(c *gin.Context) {
+	board, err := h.service.Board()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, board)
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/middleware"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
 )
 
@@ -23,10 +28,11 @@ func (h *VitalSignsHandler) CreateVitalSigns(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	vitals.RecordedBy = middleware.CurrentUserID(c)
 
-	createdVitals, err := h.service.CreateVitalSigns(&vitals)
+	createdVitals, err := h.service.CreateVitalSigns(c.Request.Context(), &vitals)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		vitalSignsError(c, err)
 		return
 	}
 
@@ -72,13 +78,269 @@ func (h *VitalSignsHandler) ListPatientVitalSigns(c *gin.Context) {
 		return
 	}
 
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	query, ok := listQuery(c)
+	if !ok {
+		return
+	}
 
-	vitals, err := h.service.ListPatientVitalSigns(uint(patientID), limit)
+	vitals, err := h.service.ListPatientVitalSigns(uint(patientID), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listError(c, err)
+		return
+	}
+
+	respondList(c, vitals, query)
+}
+
+// ListPendingDeviceReadings lists device readings awaiting validation
+// @Summary Device readings pending validation
+// @Tags vital-signs
+// @Produce json
+// @Param ward_id query int false "Only readings of devices at beds of this ward"
+// @Success 200 {object} repository.Page[models.VitalSigns]
+// @Router /api/v1/vital-signs/pending [get]
+func (h *VitalSignsHandler) ListPendingDeviceReadings(c *gin.Context) {
+	query, ok := listQuery(c, "ward_id")
+	if !ok {
+		return
+	}
+	var wardID *uint
+	if raw := c.Query("ward_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ward ID"})
+			return
+		}
+		ward := uint(id)
+		wardID = &ward
+	}
+
+	vitals, err := h.service.ListPendingDeviceReadings(wardID, query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, vitals, query)
+}
+
+// ValidateDeviceReading confirms a device reading
+// @Summary Validate a device reading
+// @Tags vital-signs
+// @Produce json
+// @Param id path int true "Vital signs ID"
+// @Success 200 {object} models.VitalSigns
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/vital-signs/{id}/validate [post]
+func (h *VitalSignsHandler) ValidateDeviceReading(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid ID")
+	if !ok {
+		return
+	}
+
+	vitals, err := h.service.ValidateDeviceReading(c.Request.Context(), id, middleware.CurrentUserID(c))
+	if err != nil {
+		vitalSignsError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, vitals)
 }
+
+// RejectDeviceReading discards a device reading
+// @Summary Reject a device reading
+// @Description Discards an artefactual reading with the reason; it is removed from charts and early warning scores, with its alert.
+// @Tags vital-signs
+// @Accept json
+// @Produce json
+// @Param id path int true "Vital signs ID"
+// @Success 200 {object} models.VitalSigns
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/vital-signs/{id}/reject [post]
+func (h *VitalSignsHandler) RejectDeviceReading(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vitals, err := h.service.RejectDeviceReading(c.Request.Context(), id, strings.TrimSpace(req.Reason), middleware.CurrentUserID(c))
+	if err != nil {
+		vitalSignsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vitals)
+}
+
+// GetVitalSignsTrends returns a patient's vital sign time series
+// @Summary Vital sign trends
+// @Description Measurements of each vital sign between from and to (dates, to exclusive; the last 30 days by default) with count, min, max and mean per day, week or month.
+// @Tags vital-signs
+// @Produce json
+// @Param id path int true "Patient ID"
+// @Param vitals query string false "Comma-separated vital signs, e.g. pulse_rate,spo2 (all by default)"
+// @Param period query string false "day (default), week or month"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Day after the last (YYYY-MM-DD)"
+// @Success 200 {array} models.VitalTrend
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/patients/{id}/vital-signs/trends [get]
+func (h *VitalSignsHandler) GetVitalSignsTrends(c *gin.Context) {
+	patientID, ok := parseID(c, "id", "Invalid patient ID")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	var err error
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date (YYYY-MM-DD)"})
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -30)
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date (YYYY-MM-DD)"})
+			return
+		}
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+
+	var vitals []string
+	if raw := c.Query("vitals"); raw != "" {
+		for _, vital := range strings.Split(raw, ",") {
+			if vital = strings.TrimSpace(vital); vital != "" {
+				vitals = append(vitals, vital)
+			}
+		}
+	}
+	period := c.DefaultQuery("period", models.TrendPeriodDay)
+
+	trends, err := h.service.Trends(patientID, vitals, period, from, to)
+	if err != nil {
+		vitalSignsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trends)
+}
+
+// ListReferenceRanges lists the vital sign reference ranges
+// @Summary Vital sign reference ranges
+// @Description Normal ranges by vital sign, age band in months (to_months exclusive), sex and pregnancy status. The first matching range applies.
+// @Tags vital-signs
+// @Produce json
+// @Success 200 {array} models.VitalReferenceRange
+// @Router /api/v1/vital-signs/reference-ranges [get]
+func (h *VitalSignsHandler) ListReferenceRanges(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ReferenceRanges())
+}
+
+// GetWardEarlyWarning lists a ward's admitted patients by their latest early warning score
+// @Summary Ward early warning scores
+// @Description Admitted patients of the ward with their latest NEWS2 or PEWS score since admission and their open alerts, highest score first. Patients without a score are listed last.
+// @Tags vital-signs
+// @Produce json
+// @Param id path int true "Ward ID"
+// @Success 200 {array} models.WardEarlyWarning
+// @Router /api/v1/wards/{id}/early-warning [get]
+func (h *VitalSignsHandler) GetWardEarlyWarning(c *gin.Context) {
+	wardID, ok := parseID(c, "id", "Invalid ward ID")
+	if !ok {
+		return
+	}
+
+	patients, err := h.service.WardEarlyWarning(wardID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, patients)
+}
+
+// ListEarlyWarningAlerts lists early warning escalation alerts
+// @Summary List early warning alerts
+// @Tags vital-signs
+// @Produce json
+// @Param status query string false "open or acknowledged"
+// @Success 200 {object} repository.Page[models.EarlyWarningAlert]
+// @Router /api/v1/early-warning/alerts [get]
+func (h *VitalSignsHandler) ListEarlyWarningAlerts(c *gin.Context) {
+	query, ok := listQuery(c, "status")
+	if !ok {
+		return
+	}
+
+	alerts, err := h.service.ListAlerts(c.Query("status"), query)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	respondList(c, alerts, query)
+}
+
+// AcknowledgeEarlyWarningAlert records the response to an early warning alert
+// @Summary Acknowledge an early warning alert
+// @Tags vital-signs
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert ID"
+// @Success 200 {object} models.EarlyWarningAlert
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/early-warning/alerts/{id}/acknowledge [post]
+func (h *VitalSignsHandler) AcknowledgeEarlyWarningAlert(c *gin.Context) {
+	id, ok := parseID(c, "id", "Invalid alert ID")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Response string `json:"response"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, err := h.service.AcknowledgeAlert(c.Request.Context(), id, req.Response, middleware.CurrentUserID(c))
+	if err != nil {
+		vitalSignsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+func vitalSignsError(c *gin.Context, err error) {
+	var validation *models.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAlertAcknowledged), errors.Is(err, models.ErrVitalSignsValidated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
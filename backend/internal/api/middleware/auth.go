@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+// Context keys set by RequireAuth
+const (
+	ContextUserID    = "user_id"
+	ContextRole      = "role"
+	ContextPatientID = "patient_id"
+)
+
+// RequireAuth verifies the bearer token and stores the acting user in the
+// context. The request context carries the user as audit actor, so writes made
+// with it are attributed to them.
+func RequireAuth(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || tokenString == header {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		claims, err := authService.ParseToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(ContextUserID, claims.UserID)
+		c.Set(ContextRole, claims.Role)
+		if claims.PatientID != nil {
+			c.Set(ContextPatientID, *claims.PatientID)
+		}
+		c.Request = c.Request.WithContext(models.WithAuditActor(c.Request.Context(), AuditActor(c)))
+
+		c.Next()
+	}
+}
+
+// RequireRole allows the request only if the acting user has one of the given roles.
+// ADMIN is always allowed.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString(ContextRole)
+		if role == models.RoleAdmin {
+			c.Next()
+			return
+		}
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	}
+}
+
+// CurrentUserID returns the ID of the authenticated user
+func CurrentUserID(c *gin.Context) uint {
+	return c.GetUint(ContextUserID)
+}
+
+// CurrentRole returns the role of the authenticated user
+func CurrentRole(c *gin.Context) string {
+	return c.GetString(ContextRole)
+}
+
+// CurrentPatientID returns the patient record linked to the authenticated user, if any
+func CurrentPatientID(c *gin.Context) *uint {
+	if v, ok := c.Get(ContextPatientID); ok {
+		if id, ok := v.(uint); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// AuditActor returns the authenticated user and client IP for audit logging
+func AuditActor(c *gin.Context) models.AuditActor {
+	return models.AuditActor{
+		UserID:   CurrentUserID(c),
+		Role:     CurrentRole(c),
+		ClientIP: c.ClientIP(),
+	}
+}
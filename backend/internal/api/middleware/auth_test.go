@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		role     string
+		allowed  []string
+		wantCode int
+	}{
+		{"listed role", models.RoleNurse, []string{models.RoleDoctor, models.RoleNurse}, http.StatusOK},
+		{"unlisted role", models.RolePharmacist, []string{models.RoleDoctor, models.RoleNurse}, http.StatusForbidden},
+		{"admin is always allowed", models.RoleAdmin, []string{models.RoleDoctor}, http.StatusOK},
+		{"patient on a staff route", models.RolePatient, []string{models.RoleDoctor}, http.StatusForbidden},
+		{"no role", "", []string{models.RoleDoctor}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set(ContextRole, tt.role)
+				}
+			}, RequireRole(tt.allowed...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authService := service.NewAuthService(nil, "test-secret", time.Minute)
+	patientID := uint(9)
+	sign := func(secret string) string {
+		claims := service.Claims{UserID: 4, Role: models.RolePatient, PatientID: &patientID,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{"valid token", "Bearer " + sign("test-secret"), http.StatusOK},
+		{"no header", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"signed with another secret", "Bearer " + sign("other"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", RequireAuth(authService), func(c *gin.Context) {
+				assert.Equal(t, uint(4), CurrentUserID(c))
+				assert.Equal(t, models.RolePatient, CurrentRole(c))
+				require.NotNil(t, CurrentPatientID(c))
+				assert.Equal(t, patientID, *CurrentPatientID(c))
+				assert.Equal(t, uint(4), models.AuditActorFrom(c.Request.Context()).UserID)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/service"
+)
+
+// ContextDevice is the context key set by RequireDevice
+const ContextDevice = "device"
+
+// RequireDevice verifies a device's ingestion key, sent as
+// "Authorization: Device <key>", and stores the device in the context. Writes
+// made with the request context are attributed to the device.
+func RequireDevice(devices *service.DeviceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		key := strings.TrimPrefix(header, "Device ")
+		if header == "" || key == header {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing device key"})
+			return
+		}
+
+		device, err := devices.Authenticate(key)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(ContextDevice, device)
+		actor := models.AuditActor{UserID: device.ID, Role: models.AuditRoleDevice, ClientIP: c.ClientIP()}
+		c.Request = c.Request.WithContext(models.WithAuditActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
+
+// CurrentDevice returns the authenticated device
+func CurrentDevice(c *gin.Context) *models.Device {
+	if v, ok := c.Get(ContextDevice); ok {
+		if device, ok := v.(*models.Device); ok {
+			return device
+		}
+	}
+	return nil
+}
@@ -46,3 +46,8 @@ type Admission struct {
 	Status            string    `json:"status" gorm:"default:'Admitted'"` // Admitted, Discharged, Transferred
 	Notes             string    `json:"notes"`
 }
+
+// TableName overrides the table name
+func (Admission) TableName() string {
+	return "admissions"
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditActionCreate = "create"
+	AuditActionRead   = "read"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditRoleDevice is the actor role of writes made by a bedside device; the
+// actor ID is then the device's ID
+const AuditRoleDevice = "DEVICE"
+
+// fields excluded from update diffs
+var auditDiffIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditActor identifies who performed an audited action and from where
+type AuditActor struct {
+	UserID   uint
+	Role     string
+	ClientIP string
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context whose database writes are audited as made by actor
+func WithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFrom returns the actor carried by ctx. Writes without one, such as
+// those of background jobs, are recorded with an empty actor.
+func AuditActorFrom(ctx context.Context) AuditActor {
+	if ctx != nil {
+		if actor, ok := ctx.Value(auditActorKey{}).(AuditActor); ok {
+			return actor
+		}
+	}
+	return AuditActor{}
+}
+
+// AuditParent is implemented by records that belong to a patient through a
+// parent record, such as a lab result through its order. The audit event of a
+// write to the record carries the parent's patient.
+type AuditParent interface {
+	AuditParent() (parent interface{}, id uint)
+}
+
+// AuditEvent is an append-only record of an access to or change of patient data
+// (FHIR R4 AuditEvent). Each event carries the hash of the previous event so that
+// any modification or deletion breaks the chain.
+type AuditEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	RecordedAt time.Time `gorm:"not null;index" json:"recorded_at"`
+
+	// Actor
+	ActorID   uint   `gorm:"index" json:"actor_id"`
+	ActorRole string `gorm:"size:50" json:"actor_role"`
+	ClientIP  string `gorm:"size:64" json:"client_ip"`
+
+	// Action: create, read, update, delete
+	Action string `gorm:"size:20;not null;index" json:"action"`
+
+	// Resource: Patient, ClinicalNote, Prescription, LabResult, etc.
+	ResourceType string `gorm:"size:50;not null;index" json:"resource_type"`
+	ResourceID   uint   `gorm:"index" json:"resource_id"`
+	PatientID    *uint  `gorm:"index" json:"patient_id,omitempty"`
+
+	// Change details for writes, stored as JSON text so the hashed bytes are preserved
+	Before string `gorm:"type:text" json:"before,omitempty"`
+	After  string `gorm:"type:text" json:"after,omitempty"`
+	Diff   string `gorm:"type:text" json:"diff,omitempty"`
+
+	// Hash chain
+	PrevHash string `gorm:"size:64;not null" json:"prev_hash"`
+	Hash     string `gorm:"size:64;not null;uniqueIndex" json:"hash"`
+}
+
+// TableName overrides the table name
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// NewAuditEvent builds an unchained event. before/after are the resource states
+// for writes (nil for reads); updates also carry the fields that changed.
+func NewAuditEvent(actor AuditActor, action, resourceType string, resourceID, patientID uint, before, after interface{}) (*AuditEvent, error) {
+	event := &AuditEvent{
+		ActorID:      actor.UserID,
+		ActorRole:    actor.Role,
+		ClientIP:     actor.ClientIP,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	}
+	if patientID != 0 {
+		event.PatientID = &patientID
+	}
+
+	var err error
+	if event.Before, err = auditJSON(before); err != nil {
+		return nil, fmt.Errorf("encoding before state of %s/%d: %w", resourceType, resourceID, err)
+	}
+	if event.After, err = auditJSON(after); err != nil {
+		return nil, fmt.Errorf("encoding after state of %s/%d: %w", resourceType, resourceID, err)
+	}
+	if action == AuditActionUpdate {
+		event.Diff = auditDiff(event.Before, event.After)
+	}
+	return event, nil
+}
+
+func auditJSON(v interface{}) (string, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// auditDiff returns the top-level fields that changed between two JSON objects
+// as {"field": {"from": ..., "to": ...}}
+func auditDiff(before, after string) string {
+	var b, a map[string]interface{}
+	if before != "" {
+		_ = json.Unmarshal([]byte(before), &b)
+	}
+	if after != "" {
+		_ = json.Unmarshal([]byte(after), &a)
+	}
+
+	changes := map[string]map[string]interface{}{}
+	for key, to := range a {
+		if auditDiffIgnoredFields[key] {
+			continue
+		}
+		if from, ok := b[key]; !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = map[string]interface{}{"from": b[key], "to": to}
+		}
+	}
+	for key, from := range b {
+		if _, ok := a[key]; !ok && !auditDiffIgnoredFields[key] {
+			changes[key] = map[string]interface{}{"from": from, "to": nil}
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+	out, _ := json.Marshal(changes)
+	return string(out)
+}
+
+// ComputeHash returns the SHA-256 hash of the event contents chained to PrevHash
+func (e *AuditEvent) ComputeHash() string {
+	patientID := ""
+	if e.PatientID != nil {
+		patientID = fmt.Sprint(*e.PatientID)
+	}
+	payload := fmt.Sprintf("%s|%s|%d|%s|%s|%s|%s|%d|%s|%s|%s|%s",
+		e.PrevHash,
+		e.RecordedAt.UTC().Format(time.RFC3339Nano),
+		e.ActorID, e.ActorRole, e.ClientIP,
+		e.Action, e.ResourceType, e.ResourceID, patientID,
+		e.Before, e.After, e.Diff,
+	)
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
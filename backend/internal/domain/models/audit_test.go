@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuditEvent(t *testing.T) {
+	actor := AuditActor{UserID: 7, Role: "DOCTOR", ClientIP: "10.0.0.1"}
+	before := map[string]interface{}{"status": "planned", "notes": "x", "updated_at": "2024-05-01"}
+	after := map[string]interface{}{"status": "finished", "notes": "x", "updated_at": "2024-05-02"}
+
+	tests := []struct {
+		name          string
+		action        string
+		patientID     uint
+		before, after interface{}
+		wantBefore    string
+		wantAfter     string
+		wantDiff      string
+		wantPatient   bool
+	}{
+		{"read carries no states", AuditActionRead, 3, nil, nil, "", "", "", true},
+		{"nil pointer is no state", AuditActionCreate, 3, (*Patient)(nil), map[string]int{"id": 1}, "", `{"id":1}`, "", true},
+		{"create has no diff", AuditActionCreate, 0, nil, after, "", `{"notes":"x","status":"finished","updated_at":"2024-05-02"}`, "", false},
+		{"update diffs changed fields, not updated_at", AuditActionUpdate, 3, before, after,
+			`{"notes":"x","status":"planned","updated_at":"2024-05-01"}`,
+			`{"notes":"x","status":"finished","updated_at":"2024-05-02"}`,
+			`{"status":{"from":"planned","to":"finished"}}`, true},
+		{"update records removed fields", AuditActionUpdate, 3, map[string]string{"a": "1"}, map[string]string{}, `{"a":"1"}`, `{}`,
+			`{"a":{"from":"1","to":null}}`, true},
+		{"unchanged update has no diff", AuditActionUpdate, 3, before, before,
+			`{"notes":"x","status":"planned","updated_at":"2024-05-01"}`,
+			`{"notes":"x","status":"planned","updated_at":"2024-05-01"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := NewAuditEvent(actor, tt.action, "Encounter", 5, tt.patientID, tt.before, tt.after)
+			require.NoError(t, err)
+			assert.Equal(t, actor.UserID, event.ActorID)
+			assert.Equal(t, actor.Role, event.ActorRole)
+			assert.Equal(t, actor.ClientIP, event.ClientIP)
+			assert.Equal(t, tt.wantBefore, event.Before)
+			assert.Equal(t, tt.wantAfter, event.After)
+			assert.Equal(t, tt.wantDiff, event.Diff)
+			if tt.wantPatient {
+				require.NotNil(t, event.PatientID)
+				assert.Equal(t, tt.patientID, *event.PatientID)
+			} else {
+				assert.Nil(t, event.PatientID)
+			}
+		})
+	}
+
+	_, err := NewAuditEvent(actor, AuditActionCreate, "Encounter", 5, 3, nil, map[string]interface{}{"bad": make(chan int)})
+	assert.Error(t, err)
+}
+
+func TestAuditActorFrom(t *testing.T) {
+	actor := AuditActor{UserID: 4, Role: AuditRoleDevice, ClientIP: "10.0.0.2"}
+	assert.Equal(t, actor, AuditActorFrom(WithAuditActor(context.Background(), actor)))
+	assert.Equal(t, AuditActor{}, AuditActorFrom(context.Background()))
+}
+
+func TestAuditEventHashChain(t *testing.T) {
+	patientID := uint(3)
+	recorded := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	first := &AuditEvent{RecordedAt: recorded, ActorID: 1, Action: AuditActionCreate, ResourceType: "Patient", ResourceID: 3, PatientID: &patientID, After: `{"id":3}`}
+	first.Hash = first.ComputeHash()
+	second := &AuditEvent{RecordedAt: recorded.Add(time.Second), ActorID: 1, Action: AuditActionRead, ResourceType: "Patient", ResourceID: 3, PatientID: &patientID, PrevHash: first.Hash}
+	second.Hash = second.ComputeHash()
+
+	assert.Len(t, first.Hash, 64)
+	assert.NotEqual(t, first.Hash, second.Hash)
+	assert.Equal(t, first.Hash, first.ComputeHash(), "hash is deterministic")
+
+	tests := []struct {
+		name   string
+		tamper func(e *AuditEvent)
+	}{
+		{"previous hash", func(e *AuditEvent) { e.PrevHash = "" }},
+		{"time", func(e *AuditEvent) { e.RecordedAt = e.RecordedAt.Add(time.Microsecond) }},
+		{"actor", func(e *AuditEvent) { e.ActorID = 2 }},
+		{"action", func(e *AuditEvent) { e.Action = AuditActionDelete }},
+		{"patient", func(e *AuditEvent) { e.PatientID = nil }},
+		{"states", func(e *AuditEvent) { e.After = `{"id":4}` }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *second
+			tt.tamper(&tampered)
+			assert.NotEqual(t, second.Hash, tampered.ComputeHash())
+		})
+	}
+}
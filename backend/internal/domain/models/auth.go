@@ -1,21 +1,55 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleAdmin      = "ADMIN"
+	RoleDoctor     = "DOCTOR"
+	RoleNurse      = "NURSE"
+	RolePharmacist = "PHARMACIST"
+	RoleCompliance = "COMPLIANCE"
+	RolePatient    = "PATIENT"
+)
+
 type User struct {
 	gorm.Model
 	Username  string   `json:"username" gorm:"uniqueIndex;not null"`
 	Password  string   `json:"-" gorm:"not null"` // Hashed password
 	Email     string   `json:"email" gorm:"uniqueIndex"`
-	Role      string   `json:"role" gorm:"default:'PATIENT'"` // ADMIN, DOCTOR, NURSE, PATIENT
+	Role      string   `json:"role" gorm:"default:'PATIENT'"` // ADMIN, DOCTOR, NURSE, PHARMACIST, COMPLIANCE, PATIENT
 	PatientID *uint    `json:"patient_id"`
 	Patient   *Patient `json:"patient" gorm:"foreignKey:PatientID"`
 	Active    bool     `json:"active" gorm:"default:true"`
 }
 
+// TableName overrides the table name
+func (User) TableName() string {
+	return "users"
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	User         User      `json:"user"`
+}
+
+// RefreshToken is a long-lived, revocable token used to obtain new access tokens.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsValid checks if the refresh token is neither revoked nor expired
+func (t *RefreshToken) IsValid() bool {
+	return t.RevokedAt == nil && t.ExpiresAt.After(time.Now())
 }
@@ -13,3 +13,60 @@ type BaseModel struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
+
+// All returns every model with a table, in migration order
+func All() []interface{} {
+	return []interface{}{
+		&User{},
+		&RefreshToken{},
+		&Patient{},
+		&PatientIdentifier{},
+		&PatientDuplicate{},
+		&PatientMerge{},
+		&MRNCounter{},
+		&Encounter{},
+		&EncounterStatusHistory{},
+		&Triage{},
+		&QueueToken{},
+		&QueueCounter{},
+		&VitalSigns{},
+		&EarlyWarningAlert{},
+		&Device{},
+		&NCDScreening{},
+		&ProgramEnrolment{},
+		&ProgramVisit{},
+		&Questionnaire{},
+		&QuestionnaireSubmission{},
+		&QuestionnaireObservation{},
+		&ClinicalNote{},
+		&Invoice{},
+		&InvoiceItem{},
+		&Payment{},
+		&InsuranceClaim{},
+		&ImagingStudy{},
+		&ImagingSeries{},
+		&ImagingInstance{},
+		&RadiologyReport{},
+		&Medication{},
+		&Prescription{},
+		&LabTest{},
+		&LabOrder{},
+		&LabResult{},
+		&Appointment{},
+		&Ward{},
+		&Room{},
+		&Bed{},
+		&Admission{},
+		&Transfer{},
+		&DischargeSummary{},
+		&PharmacyStock{},
+		&Dispensing{},
+		&StockMovement{},
+		&PortalDelegation{},
+		&PatientPhoto{},
+		&Household{},
+		&HouseholdMember{},
+		&Consent{},
+		&AuditEvent{},
+	}
+}
@@ -39,6 +39,11 @@ type InvoiceItem struct {
 	NetAmount   float64 `json:"net_amount" gorm:"not null"`
 }
 
+// AuditParent returns the invoice the item belongs to
+func (i InvoiceItem) AuditParent() (interface{}, uint) {
+	return &Invoice{}, i.InvoiceID
+}
+
 // Payment represents a payment transaction
 type Payment struct {
 	gorm.Model
@@ -53,6 +58,11 @@ type Payment struct {
 	Status        string    `json:"status" gorm:"size:50;default:'completed'"` // completed, pending, failed, refunded
 }
 
+// AuditParent returns the invoice the payment belongs to
+func (p Payment) AuditParent() (interface{}, uint) {
+	return &Invoice{}, p.InvoiceID
+}
+
 // InsuranceClaim represents an insurance claim
 type InsuranceClaim struct {
 	gorm.Model
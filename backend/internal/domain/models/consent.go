@@ -0,0 +1,117 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Consent scopes: what the patient agreed (or declined) to
+const (
+	ConsentScopeDataSharing  = "data-sharing"  // sharing records with partners, e.g. FHIR bulk export
+	ConsentScopeResearch     = "research"      // use in research extracts
+	ConsentScopeSMSReminders = "sms-reminders" // appointment reminders by SMS
+	ConsentScopePortalAccess = "portal-access" // access through the patient portal
+)
+
+// ConsentScopes lists the scopes with their display names
+var ConsentScopes = map[string]string{
+	ConsentScopeDataSharing:  "Sharing of health records with partner organizations",
+	ConsentScopeResearch:     "Use of health records for research",
+	ConsentScopeSMSReminders: "SMS appointment reminders",
+	ConsentScopePortalAccess: "Patient portal access",
+}
+
+// Consent statuses, as in FHIR Consent.status
+const (
+	ConsentStatusActive   = "active"   // consent given
+	ConsentStatusRejected = "rejected" // the patient declined
+	ConsentStatusInactive = "inactive" // superseded by a later decision or withdrawn
+)
+
+// Consent records a patient's decision on one scope. A new decision on the
+// same scope supersedes the previous one; records are never deleted.
+type Consent struct {
+	BaseModel
+
+	PatientID uint     `gorm:"index;not null" json:"patient_id"`
+	Patient   *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+
+	Scope   string `gorm:"size:30;index;not null" json:"scope"`
+	Purpose string `gorm:"type:text" json:"purpose,omitempty"` // as explained to the patient
+	Status  string `gorm:"size:20;index;not null" json:"status"`
+
+	// When the decision was made and until when it holds
+	GrantedAt time.Time  `gorm:"not null" json:"granted_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Witness of a verbal or thumbprint consent
+	WitnessName     string `gorm:"size:200" json:"witness_name,omitempty"`
+	WitnessRelation string `gorm:"size:50" json:"witness_relation,omitempty"`
+
+	// Signed consent form, e.g. a scanned document URL
+	DocumentReference string `gorm:"size:500" json:"document_reference,omitempty"`
+
+	RecordedBy uint `json:"recorded_by"`
+
+	// Withdrawal
+	WithdrawnAt     *time.Time `json:"withdrawn_at,omitempty"`
+	WithdrawnBy     *uint      `json:"withdrawn_by,omitempty"`
+	WithdrawnReason string     `gorm:"type:text" json:"withdrawn_reason,omitempty"`
+}
+
+// TableName overrides the table name
+func (Consent) TableName() string {
+	return "consents"
+}
+
+// IsEffective checks if the consent permits its scope at t
+func (c *Consent) IsEffective(t time.Time) bool {
+	if c.Status != ConsentStatusActive || c.GrantedAt.After(t) {
+		return false
+	}
+	return c.ExpiresAt == nil || c.ExpiresAt.After(t)
+}
+
+// Normalize trims the free-text fields
+func (c *Consent) Normalize() {
+	c.Scope = strings.ToLower(strings.TrimSpace(c.Scope))
+	c.Status = strings.ToLower(strings.TrimSpace(c.Status))
+	c.Purpose = strings.TrimSpace(c.Purpose)
+	c.WitnessName = strings.TrimSpace(c.WitnessName)
+	c.WitnessRelation = strings.TrimSpace(c.WitnessRelation)
+	c.DocumentReference = strings.TrimSpace(c.DocumentReference)
+}
+
+// Validate checks a newly recorded decision. A consent that is given needs
+// evidence: the signed form or, for verbal and thumbprint consent, a witness.
+func (c *Consent) Validate() error {
+	if _, ok := ConsentScopes[c.Scope]; !ok {
+		return ErrInvalidConsentScope
+	}
+	if c.Status != ConsentStatusActive && c.Status != ConsentStatusRejected {
+		return ErrInvalidConsentStatus
+	}
+	if c.ExpiresAt != nil && !c.ExpiresAt.After(c.GrantedAt) {
+		return ErrConsentExpiresBeforeGranted
+	}
+	if c.Status == ConsentStatusActive && c.WitnessName == "" && c.DocumentReference == "" {
+		return ErrConsentEvidenceRequired
+	}
+	return nil
+}
+
+// Withdraw ends a consent at the patient's request
+func (c *Consent) Withdraw(reason string, withdrawnBy uint) {
+	now := time.Now()
+	c.Status = ConsentStatusInactive
+	c.WithdrawnAt = &now
+	c.WithdrawnBy = &withdrawnBy
+	c.WithdrawnReason = reason
+}
+
+var (
+	ErrInvalidConsentScope         = &ValidationError{Field: "scope", Message: "Scope must be one of data-sharing, research, sms-reminders, portal-access"}
+	ErrInvalidConsentStatus        = &ValidationError{Field: "status", Message: "Status must be active (consent given) or rejected (consent declined)"}
+	ErrConsentExpiresBeforeGranted = &ValidationError{Field: "expires_at", Message: "Expiry must be after the date consent was given"}
+	ErrConsentEvidenceRequired     = &ValidationError{Field: "document_reference", Message: "A signed consent form or a witness is required"}
+)
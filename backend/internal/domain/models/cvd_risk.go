@@ -0,0 +1,125 @@
+package models
+
+import "sort"
+
+// WHO CVD risk charts: the laboratory-based charts use total cholesterol and
+// diabetes, the non-laboratory ones body mass index instead
+const (
+	CVDChartLab    = "lab"
+	CVDChartNonLab = "non-lab"
+)
+
+// Categories of the 10-year risk of a fatal or non-fatal heart attack or stroke
+const (
+	CVDRiskLow      = "low"       // under 10%
+	CVDRiskModerate = "moderate"  // 10% to under 20%
+	CVDRiskHigh     = "high"      // 20% to under 30%
+	CVDRiskVeryHigh = "very-high" // 30% and over
+)
+
+// Ages the CVD risk charts apply to
+const (
+	CVDRiskMinAge = 40
+	CVDRiskMaxAge = 74
+)
+
+// CVDRiskCategory returns the category of a 10-year risk in percent
+func CVDRiskCategory(risk float64) string {
+	switch {
+	case risk >= 30:
+		return CVDRiskVeryHigh
+	case risk >= 20:
+		return CVDRiskHigh
+	case risk >= 10:
+		return CVDRiskModerate
+	default:
+		return CVDRiskLow
+	}
+}
+
+// cvdRiskCell is a cell of a chart, by the lower bounds of its age, systolic
+// BP and cholesterol or BMI bands
+type cvdRiskCell struct {
+	chart, sex       string
+	diabetes, smoker bool
+	age, sbp, factor float64
+}
+
+// cvdRiskBands are the lower bounds of a chart's bands, in ascending order
+type cvdRiskBands struct {
+	age, sbp, factor []float64
+}
+
+// CVDRiskCharts holds the WHO CVD risk charts of one region
+type CVDRiskCharts struct {
+	cells map[cvdRiskCell]float64
+	bands map[string]*cvdRiskBands
+}
+
+func NewCVDRiskCharts() *CVDRiskCharts {
+	return &CVDRiskCharts{cells: map[cvdRiskCell]float64{}, bands: map[string]*cvdRiskBands{}}
+}
+
+// Add adds a cell of a chart: the risk in percent of a sex (male or female),
+// diabetes and smoking status, from the lower bounds of the age, systolic BP
+// and total cholesterol (mmol/L) or BMI band. The lowest bands start at 0,
+// e.g. systolic BP under 120. diabetes is false on non-laboratory charts.
+func (c *CVDRiskCharts) Add(chart, sex string, diabetes, smoker bool, age, sbp, factor, risk float64) {
+	b := c.bands[chart]
+	if b == nil {
+		b = &cvdRiskBands{}
+		c.bands[chart] = b
+	}
+	b.age = addCVDBand(b.age, age)
+	b.sbp = addCVDBand(b.sbp, sbp)
+	b.factor = addCVDBand(b.factor, factor)
+	c.cells[cvdRiskCell{chart, sex, diabetes, smoker, age, sbp, factor}] = risk
+}
+
+func addCVDBand(bands []float64, bound float64) []float64 {
+	i := sort.SearchFloat64s(bands, bound)
+	if i < len(bands) && bands[i] == bound {
+		return bands
+	}
+	bands = append(bands, 0)
+	copy(bands[i+1:], bands[i:])
+	bands[i] = bound
+	return bands
+}
+
+// cvdBand returns the lower bound of the band holding value
+func cvdBand(bands []float64, value float64) (float64, bool) {
+	i := sort.SearchFloat64s(bands, value)
+	if i < len(bands) && bands[i] == value {
+		return value, true
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return bands[i-1], true
+}
+
+// Has reports whether a chart was loaded
+func (c *CVDRiskCharts) Has(chart string) bool {
+	return c != nil && c.bands[chart] != nil
+}
+
+// Risk looks up the 10-year risk in percent on a chart. factor is the total
+// cholesterol on laboratory charts and the BMI on non-laboratory ones.
+func (c *CVDRiskCharts) Risk(chart, sex string, diabetes, smoker bool, age int, sbp int, factor float64) (float64, bool) {
+	if !c.Has(chart) || age < CVDRiskMinAge || age > CVDRiskMaxAge {
+		return 0, false
+	}
+	if chart == CVDChartNonLab {
+		diabetes = false
+	}
+	b := c.bands[chart]
+	ageBand, ok1 := cvdBand(b.age, float64(age))
+	sbpBand, ok2 := cvdBand(b.sbp, float64(sbp))
+	factorBand, ok3 := cvdBand(b.factor, factor)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+	risk, ok := c.cells[cvdRiskCell{chart, sex, diabetes, smoker, ageBand, sbpBand, factorBand}]
+	return risk, ok
+}
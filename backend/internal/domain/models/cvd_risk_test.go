@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCVDRiskCategory(t *testing.T) {
+	tests := []struct {
+		risk float64
+		want string
+	}{
+		{0, CVDRiskLow},
+		{9.9, CVDRiskLow},
+		{10, CVDRiskModerate},
+		{19.9, CVDRiskModerate},
+		{20, CVDRiskHigh},
+		{30, CVDRiskVeryHigh},
+		{45, CVDRiskVeryHigh},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CVDRiskCategory(tt.risk), tt.risk)
+	}
+}
+
+// testCVDRiskCharts has two age, systolic BP and cholesterol or BMI bands for
+// men; the risk encodes the cell, e.g. 15 for age 50+, SBP 140+, lowest factor
+func testCVDRiskCharts() *CVDRiskCharts {
+	charts := NewCVDRiskCharts()
+	for _, chart := range []string{CVDChartLab, CVDChartNonLab} {
+		factors := []float64{0, 6}
+		if chart == CVDChartNonLab {
+			factors = []float64{0, 25}
+		}
+		for _, diabetes := range []bool{false, true} {
+			if diabetes && chart == CVDChartNonLab {
+				continue
+			}
+			for _, smoker := range []bool{false, true} {
+				for ai, age := range []float64{40, 50} {
+					for si, sbp := range []float64{0, 140} {
+						for fi, factor := range factors {
+							risk := float64(ai*10 + si*5 + fi)
+							if smoker {
+								risk += 20
+							}
+							if diabetes {
+								risk += 40
+							}
+							charts.Add(chart, "male", diabetes, smoker, age, sbp, factor, risk)
+						}
+					}
+				}
+			}
+		}
+	}
+	return charts
+}
+
+func TestCVDRiskChartsRisk(t *testing.T) {
+	charts := testCVDRiskCharts()
+
+	tests := []struct {
+		name     string
+		chart    string
+		sex      string
+		diabetes bool
+		smoker   bool
+		age, sbp int
+		factor   float64
+		want     float64
+		ok       bool
+	}{
+		{"lowest cell", CVDChartLab, "male", false, false, 40, 110, 4, 0, true},
+		{"band lower bounds are inclusive", CVDChartLab, "male", false, false, 50, 140, 6, 16, true},
+		{"within the top bands", CVDChartLab, "male", false, true, 74, 200, 9, 36, true},
+		{"diabetes", CVDChartLab, "male", true, false, 45, 150, 5, 45, true},
+		{"diabetes is not on the non-lab chart", CVDChartNonLab, "male", true, false, 45, 150, 27, 6, true},
+		{"under 40", CVDChartLab, "male", false, false, 39, 150, 5, 0, false},
+		{"over 74", CVDChartLab, "male", false, false, 75, 150, 5, 0, false},
+		{"no cell for the sex", CVDChartLab, "female", false, false, 45, 150, 5, 0, false},
+		{"chart not loaded", "other", "male", false, false, 45, 150, 5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk, ok := charts.Risk(tt.chart, tt.sex, tt.diabetes, tt.smoker, tt.age, tt.sbp, tt.factor)
+			require.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, risk)
+		})
+	}
+
+	var none *CVDRiskCharts
+	assert.False(t, none.Has(CVDChartLab))
+	_, ok := none.Risk(CVDChartLab, "male", false, false, 50, 140, 5)
+	assert.False(t, ok)
+}
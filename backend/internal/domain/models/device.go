@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Device kinds
+const (
+	DeviceKindMonitor       = "monitor"
+	DeviceKindBPMachine     = "bp-machine"
+	DeviceKindPulseOximeter = "pulse-oximeter"
+	DeviceKindThermometer   = "thermometer"
+	DeviceKindScale         = "scale"
+)
+
+// Vital signs sources
+const (
+	VitalSourceManual = "manual"
+	VitalSourceDevice = "device"
+)
+
+// Verification statuses of device readings
+const (
+	VerificationPending   = "pending"
+	VerificationValidated = "validated"
+	VerificationRejected  = "rejected"
+)
+
+var (
+	ErrDeviceInactive      = errors.New("device is inactive")
+	ErrDeviceNoBed         = errors.New("device is not associated with a bed")
+	ErrDeviceNoPatient     = errors.New("no patient was admitted to the device's bed when the reading was measured")
+	ErrDeviceNoEncounter   = errors.New("the patient in the device's bed had no encounter under way when the reading was measured")
+	ErrDeviceReadingEmpty  = errors.New("reading has no supported vital signs")
+	ErrVitalSignsValidated = errors.New("vital signs are not pending validation")
+
+	ErrInvalidDeviceKind       = &ValidationError{Field: "kind", Message: "Kind must be one of monitor, bp-machine, pulse-oximeter, thermometer, scale"}
+	ErrDeviceIdentifierMissing = &ValidationError{Field: "identifier", Message: "Identifier is required"}
+	ErrRejectReasonMissing     = &ValidationError{Field: "reason", Message: "Reason is required"}
+	ErrDeviceReadingFuture     = &ValidationError{Field: "measured_at", Message: "Measurement time cannot be in the future"}
+)
+
+// DeviceClockSkew is how far ahead of the server's clock a device's
+// measurement time may be
+const DeviceClockSkew = 5 * time.Minute
+
+// Device is a bedside monitor or other measuring device that pushes vital
+// signs. Readings go to the patient admitted to the device's bed.
+type Device struct {
+	BaseModel
+
+	// Identifier is the device's serial number or EUI-64, as it sends it
+	Identifier   string `gorm:"size:100;uniqueIndex;not null" json:"identifier"`
+	Name         string `gorm:"size:100" json:"name"`
+	Kind         string `gorm:"size:20;not null" json:"kind"`
+	Manufacturer string `gorm:"size:100" json:"manufacturer,omitempty"`
+	Model        string `gorm:"size:100" json:"model,omitempty"`
+
+	BedID *uint `gorm:"index" json:"bed_id,omitempty"`
+	Bed   *Bed  `gorm:"foreignKey:BedID" json:"bed,omitempty"`
+
+	Active bool `gorm:"default:true" json:"active"`
+	// KeyHash is the SHA-256 hash of the device's ingestion key
+	KeyHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TableName overrides the table name
+func (Device) TableName() string {
+	return "devices"
+}
+
+// Validate checks the device's fields
+func (d *Device) Validate() error {
+	if d.Identifier == "" {
+		return ErrDeviceIdentifierMissing
+	}
+	switch d.Kind {
+	case DeviceKindMonitor, DeviceKindBPMachine, DeviceKindPulseOximeter, DeviceKindThermometer, DeviceKindScale:
+		return nil
+	default:
+		return ErrInvalidDeviceKind
+	}
+}
+
+// DeviceReading is one set of measurements pushed by a device, the common
+// form of every ingestion format. Temperature is in °C, weight in kg and
+// height in cm.
+type DeviceReading struct {
+	MeasuredAt      *time.Time `json:"measured_at,omitempty"`
+	SystolicBP      *int       `json:"systolic_bp,omitempty"`
+	DiastolicBP     *int       `json:"diastolic_bp,omitempty"`
+	PulseRate       *int       `json:"pulse_rate,omitempty"`
+	RespiratoryRate *int       `json:"respiratory_rate,omitempty"`
+	Temperature     *float64   `json:"temperature,omitempty"`
+	SpO2            *int       `json:"spo2,omitempty"`
+	Weight          *float64   `json:"weight,omitempty"`
+	Height          *float64   `json:"height,omitempty"`
+}
+
+// Empty reports whether the reading has no measurement
+func (r *DeviceReading) Empty() bool {
+	return r.SystolicBP == nil && r.DiastolicBP == nil && r.PulseRate == nil && r.RespiratoryRate == nil &&
+		r.Temperature == nil && r.SpO2 == nil && r.Weight == nil && r.Height == nil
+}
+
+// Measured returns when the reading was measured: its own time, or when it
+// was received if it has none. A time ahead of received by more than
+// DeviceClockSkew is rejected.
+func (r *DeviceReading) Measured(received time.Time) (time.Time, error) {
+	if r.MeasuredAt == nil {
+		return received, nil
+	}
+	if r.MeasuredAt.After(received.Add(DeviceClockSkew)) {
+		return time.Time{}, ErrDeviceReadingFuture
+	}
+	return *r.MeasuredAt, nil
+}
+
+// VitalSigns returns the reading, measured at measured, as vital signs
+// pending validation
+func (r *DeviceReading) VitalSigns(device *Device, encounterID, patientID uint, measured time.Time) *VitalSigns {
+	return &VitalSigns{
+		EncounterID:        encounterID,
+		PatientID:          patientID,
+		MeasuredAt:         measured,
+		SystolicBP:         r.SystolicBP,
+		DiastolicBP:        r.DiastolicBP,
+		PulseRate:          r.PulseRate,
+		RespiratoryRate:    r.RespiratoryRate,
+		Temperature:        r.Temperature,
+		SpO2:               r.SpO2,
+		Weight:             r.Weight,
+		Height:             r.Height,
+		Source:             VitalSourceDevice,
+		DeviceID:           &device.ID,
+		VerificationStatus: VerificationPending,
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceReadingMeasured(t *testing.T) {
+	received := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		measured := received.Add(d)
+		return &measured
+	}
+
+	tests := []struct {
+		name       string
+		measuredAt *time.Time
+		want       time.Time
+		wantErr    error
+	}{
+		{"no time is received time", nil, received, nil},
+		{"buffered reading keeps its time", at(-6 * time.Hour), received.Add(-6 * time.Hour), nil},
+		{"clock slightly ahead", at(DeviceClockSkew), received.Add(DeviceClockSkew), nil},
+		{"future", at(DeviceClockSkew + time.Second), time.Time{}, ErrDeviceReadingFuture},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reading := DeviceReading{MeasuredAt: tt.measuredAt}
+			got, err := reading.Measured(received)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -22,6 +22,11 @@ type DischargeSummary struct {
 	// User     *User `gorm:"foreignKey:SignedBy" json:"signed_by_user,omitempty"`
 }
 
+// AuditParent returns the admission the summary belongs to
+func (d DischargeSummary) AuditParent() (interface{}, uint) {
+	return &Admission{}, d.AdmissionID
+}
+
 func (DischargeSummary) TableName() string {
 	return "discharge_summaries"
 }
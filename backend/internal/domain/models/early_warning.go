@@ -0,0 +1,479 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Early warning scoring systems
+const (
+	EarlyWarningNEWS2 = "NEWS2" // National Early Warning Score 2, adults
+	EarlyWarningPEWS  = "PEWS"  // Brighton Paediatric Early Warning Score, children
+)
+
+// EarlyWarningAdultAge is the age from which NEWS2 is used instead of PEWS
+const EarlyWarningAdultAge = 16
+
+// Early warning risk bands
+const (
+	EarlyWarningRiskLow       = "low"
+	EarlyWarningRiskLowMedium = "low-medium" // NEWS2: 3 in a single parameter
+	EarlyWarningRiskMedium    = "medium"
+	EarlyWarningRiskHigh      = "high"
+)
+
+// PEWS behaviour values
+const (
+	PEWSBehaviourPlaying   = "playing" // or appropriate
+	PEWSBehaviourSleeping  = "sleeping"
+	PEWSBehaviourIrritable = "irritable"
+	PEWSBehaviourLethargic = "lethargic" // or confused, reduced response to pain
+)
+
+// Skin colour values
+const (
+	SkinColourPink    = "pink"
+	SkinColourPale    = "pale" // or dusky
+	SkinColourGrey    = "grey" // or cyanotic
+	SkinColourMottled = "mottled"
+)
+
+// Respiratory effort values
+const (
+	RespiratoryEffortNormal     = "normal"
+	RespiratoryEffortAccessory  = "accessory-muscles"
+	RespiratoryEffortRetraction = "retractions"
+	RespiratoryEffortGrunting   = "grunting" // or sternal recession, tracheal tug
+)
+
+var (
+	ErrAlertAcknowledged = errors.New("alert has already been acknowledged")
+
+	ErrInvalidConsciousness     = &ValidationError{Field: "consciousness", Message: "Consciousness must be one of alert, confused, voice, pain, unresponsive"}
+	ErrInvalidPEWSBehaviour     = &ValidationError{Field: "behaviour", Message: "Behaviour must be one of playing, sleeping, irritable, lethargic"}
+	ErrInvalidSkinColour        = &ValidationError{Field: "skin_colour", Message: "Skin colour must be one of pink, pale, grey, mottled"}
+	ErrInvalidRespiratoryEffort = &ValidationError{Field: "respiratory_effort", Message: "Respiratory effort must be one of normal, accessory-muscles, retractions, grunting"}
+)
+
+// EarlyWarning is an early warning score with the parameters it could not use
+type EarlyWarning struct {
+	System string
+	Score  int
+	Risk   string
+	// RedParameter is set when a single NEWS2 parameter scored 3
+	RedParameter bool
+	Missing      []string
+}
+
+// Validate checks the values of the coded fields
+func (v *VitalSigns) Validate() error {
+	if _, ok := tewsAVPU[v.Consciousness]; v.Consciousness != "" && !ok {
+		return ErrInvalidConsciousness
+	}
+	if _, ok := pewsBehaviour[v.Behaviour]; v.Behaviour != "" && !ok {
+		return ErrInvalidPEWSBehaviour
+	}
+	switch v.SkinColour {
+	case "", SkinColourPink, SkinColourPale, SkinColourGrey, SkinColourMottled:
+	default:
+		return ErrInvalidSkinColour
+	}
+	switch v.RespiratoryEffort {
+	case "", RespiratoryEffortNormal, RespiratoryEffortAccessory, RespiratoryEffortRetraction, RespiratoryEffortGrunting:
+	default:
+		return ErrInvalidRespiratoryEffort
+	}
+	switch v.LengthPosition {
+	case "", LengthPositionRecumbent, LengthPositionStanding:
+	default:
+		return ErrInvalidLengthPosition
+	}
+	return nil
+}
+
+// ScoreEarlyWarning computes NEWS2 for adults and PEWS for children, by the
+// patient's age when the observation was made, and stores it with the
+// observation. Patients of unknown age are scored as adults.
+func (v *VitalSigns) ScoreEarlyWarning(patient *Patient) EarlyWarning {
+	var ews EarlyWarning
+	if months, ok := ageInMonths(patient, v.MeasuredAt); ok && months < EarlyWarningAdultAge*12 {
+		ews = v.PEWS(months)
+	} else {
+		ews = v.NEWS2()
+	}
+	score := ews.Score
+	v.EWSSystem = ews.System
+	v.EWSScore = &score
+	v.EWSRisk = ews.Risk
+	v.EWSMissing = ews.Missing
+	return ews
+}
+
+func ageInMonths(patient *Patient, at time.Time) (int, bool) {
+	if patient == nil || patient.BirthDate == nil {
+		return 0, false
+	}
+	birth := *patient.BirthDate
+	months := (at.Year()-birth.Year())*12 + int(at.Month()-birth.Month())
+	if at.Day() < birth.Day() {
+		months--
+	}
+	return months, true
+}
+
+// NEWS2 computes the National Early Warning Score 2. Missing parameters score
+// 0 and are listed in Missing.
+func (v *VitalSigns) NEWS2() EarlyWarning {
+	ews := EarlyWarning{System: EarlyWarningNEWS2}
+	add := func(points int) {
+		ews.Score += points
+		ews.RedParameter = ews.RedParameter || points == 3
+	}
+
+	if v.RespiratoryRate == nil {
+		ews.Missing = append(ews.Missing, "respiratory_rate")
+	} else {
+		add(band(float64(*v.RespiratoryRate), []scoreBand{{8, 3}, {11, 1}, {20, 0}, {24, 2}}, 3))
+	}
+
+	switch {
+	case v.SpO2 == nil:
+		ews.Missing = append(ews.Missing, "spo2")
+	case v.SpO2Scale2:
+		spo2 := float64(*v.SpO2)
+		if v.OnOxygen && spo2 >= 93 {
+			add(band(spo2, []scoreBand{{94, 1}, {96, 2}}, 3))
+		} else {
+			add(band(spo2, []scoreBand{{83, 3}, {85, 2}, {87, 1}}, 0))
+		}
+	default:
+		add(band(float64(*v.SpO2), []scoreBand{{91, 3}, {93, 2}, {95, 1}}, 0))
+	}
+
+	if v.OnOxygen {
+		add(2)
+	}
+
+	if v.SystolicBP == nil {
+		ews.Missing = append(ews.Missing, "systolic_bp")
+	} else {
+		add(band(float64(*v.SystolicBP), []scoreBand{{90, 3}, {100, 2}, {110, 1}, {219, 0}}, 3))
+	}
+
+	if v.PulseRate == nil {
+		ews.Missing = append(ews.Missing, "pulse_rate")
+	} else {
+		add(band(float64(*v.PulseRate), []scoreBand{{40, 3}, {50, 1}, {90, 0}, {110, 1}, {130, 2}}, 3))
+	}
+
+	switch v.Consciousness {
+	case "":
+		ews.Missing = append(ews.Missing, "consciousness")
+	case AVPUAlert:
+	default:
+		// New confusion or any response below alert
+		add(3)
+	}
+
+	if v.Temperature == nil {
+		ews.Missing = append(ews.Missing, "temperature")
+	} else {
+		add(band(*v.Temperature, []scoreBand{{35.0, 3}, {36.0, 1}, {38.0, 0}, {39.0, 1}}, 2))
+	}
+
+	switch {
+	case ews.Score >= 7:
+		ews.Risk = EarlyWarningRiskHigh
+	case ews.Score >= 5:
+		ews.Risk = EarlyWarningRiskMedium
+	case ews.RedParameter:
+		ews.Risk = EarlyWarningRiskLowMedium
+	default:
+		ews.Risk = EarlyWarningRiskLow
+	}
+	return ews
+}
+
+// scoreBand gives the points of values up to and including Upper
+type scoreBand struct {
+	Upper  float64
+	Points int
+}
+
+// band scores a value on bands in increasing order, with above for values
+// over the last band
+func band(value float64, bands []scoreBand, above int) int {
+	for _, b := range bands {
+		if value <= b.Upper {
+			return b.Points
+		}
+	}
+	return above
+}
+
+// pewsNormal is the normal heart and respiratory rate of children up to an age
+type pewsNormal struct {
+	UpToMonths          int
+	HeartLow, HeartHigh int
+	RespLow, RespHigh   int
+}
+
+// pewsNormals are the normal ranges of the Brighton PEWS by age
+var pewsNormals = []pewsNormal{
+	{1, 100, 180, 40, 60},     // newborn
+	{13, 100, 180, 35, 40},    // 1-12 months
+	{48, 70, 110, 25, 30},     // 13 months-3 years
+	{84, 70, 110, 21, 23},     // 4-6 years
+	{156, 70, 110, 19, 21},    // 7-12 years
+	{1 << 30, 55, 90, 16, 18}, // 13 years and over
+}
+
+func pewsNormalFor(months int) pewsNormal {
+	for _, normal := range pewsNormals {
+		if months < normal.UpToMonths {
+			return normal
+		}
+	}
+	return pewsNormals[len(pewsNormals)-1]
+}
+
+var pewsBehaviour = map[string]int{
+	PEWSBehaviourPlaying:   0,
+	PEWSBehaviourSleeping:  1,
+	PEWSBehaviourIrritable: 2,
+	PEWSBehaviourLethargic: 3,
+}
+
+// PEWS computes the Brighton Paediatric Early Warning Score for a child of
+// the given age: behaviour, cardiovascular and respiratory scores of 0-3
+// each, plus 2 each for quarter-hourly nebulisers and persistent vomiting.
+// A component with none of its signs recorded scores 0 and is listed in Missing.
+func (v *VitalSigns) PEWS(ageMonths int) EarlyWarning {
+	ews := EarlyWarning{System: EarlyWarningPEWS}
+	normal := pewsNormalFor(ageMonths)
+
+	// Behaviour; a child who is not alert counts as lethargic
+	switch {
+	case v.Behaviour != "":
+		ews.Score += pewsBehaviour[v.Behaviour]
+	case v.Consciousness == AVPUAlert:
+	case v.Consciousness != "":
+		ews.Score += 3
+	default:
+		ews.Missing = append(ews.Missing, "behaviour")
+	}
+
+	// Cardiovascular: the worst of colour, capillary refill and heart rate
+	cardio, known := 0, false
+	switch v.SkinColour {
+	case SkinColourPink:
+		known = true
+	case SkinColourPale:
+		cardio, known = max(cardio, 1), true
+	case SkinColourGrey:
+		cardio, known = max(cardio, 2), true
+	case SkinColourMottled:
+		cardio, known = 3, true
+	}
+	if v.CapillaryRefill != nil {
+		known = true
+		switch crt := *v.CapillaryRefill; {
+		case crt >= 5:
+			cardio = 3
+		case crt >= 4:
+			cardio = max(cardio, 2)
+		case crt >= 3:
+			cardio = max(cardio, 1)
+		}
+	}
+	if v.PulseRate != nil {
+		known = true
+		switch hr := *v.PulseRate; {
+		case hr >= normal.HeartHigh+30, hr < normal.HeartLow:
+			cardio = 3
+		case hr >= normal.HeartHigh+20:
+			cardio = max(cardio, 2)
+		}
+	}
+	if !known {
+		ews.Missing = append(ews.Missing, "cardiovascular")
+	}
+	ews.Score += cardio
+
+	// Respiratory: the worst of rate, effort and oxygen
+	resp, known := 0, false
+	if v.RespiratoryRate != nil {
+		known = true
+		rr := *v.RespiratoryRate
+		switch {
+		case rr <= normal.RespLow-5 && (v.RespiratoryEffort == RespiratoryEffortRetraction || v.RespiratoryEffort == RespiratoryEffortGrunting):
+			resp = 3
+		case rr > normal.RespHigh+20:
+			resp = max(resp, 2)
+		case rr > normal.RespHigh+10:
+			resp = max(resp, 1)
+		}
+	}
+	switch v.RespiratoryEffort {
+	case RespiratoryEffortNormal:
+		known = true
+	case RespiratoryEffortAccessory:
+		resp, known = max(resp, 1), true
+	case RespiratoryEffortRetraction:
+		resp, known = max(resp, 2), true
+	case RespiratoryEffortGrunting:
+		resp, known = 3, true
+	}
+	if v.OxygenFlowRate != nil {
+		known = true
+		switch flow := *v.OxygenFlowRate; {
+		case flow >= 8:
+			resp = 3
+		case flow >= 6:
+			resp = max(resp, 2)
+		case flow >= 3:
+			resp = max(resp, 1)
+		}
+	}
+	if !known {
+		ews.Missing = append(ews.Missing, "respiratory")
+	}
+	ews.Score += resp
+
+	if v.FrequentNebulisers {
+		ews.Score += 2
+	}
+	if v.PersistentVomiting {
+		ews.Score += 2
+	}
+
+	switch {
+	case ews.Score >= 5:
+		ews.Risk = EarlyWarningRiskHigh
+	case ews.Score == 4:
+		ews.Risk = EarlyWarningRiskMedium
+	case ews.Score == 3:
+		ews.Risk = EarlyWarningRiskLowMedium
+	default:
+		ews.Risk = EarlyWarningRiskLow
+	}
+	return ews
+}
+
+// EarlyWarningThreshold is a score from which an escalation level applies
+type EarlyWarningThreshold struct {
+	Level string `json:"level"`
+	Score int    `json:"score"`
+}
+
+// EarlyWarningThresholds are the escalation thresholds of each scoring
+// system, from the least to the most urgent
+type EarlyWarningThresholds map[string][]EarlyWarningThreshold
+
+// Escalation levels of the default thresholds
+const (
+	EscalationUrgent    = "urgent"
+	EscalationEmergency = "emergency"
+)
+
+// DefaultEarlyWarningThresholds follow the NEWS2 clinical response (urgent
+// review from 5, emergency from 7) and a common Brighton PEWS escalation
+func DefaultEarlyWarningThresholds() EarlyWarningThresholds {
+	return EarlyWarningThresholds{
+		EarlyWarningNEWS2: {{EscalationUrgent, 5}, {EscalationEmergency, 7}},
+		EarlyWarningPEWS:  {{EscalationUrgent, 3}, {EscalationEmergency, 5}},
+	}
+}
+
+// Sort orders each system's thresholds by score
+func (t EarlyWarningThresholds) Sort() {
+	for _, thresholds := range t {
+		sort.Slice(thresholds, func(i, j int) bool { return thresholds[i].Score < thresholds[j].Score })
+	}
+}
+
+// Level returns the index and name of the most urgent threshold a score
+// reaches, or -1 and "" below all thresholds. A NEWS2 score with a single
+// parameter scoring 3 reaches at least the first threshold.
+func (t EarlyWarningThresholds) Level(system string, score int, redParameter bool) (int, string) {
+	index := -1
+	for i, threshold := range t[system] {
+		if score >= threshold.Score {
+			index = i
+		}
+	}
+	if index < 0 && redParameter && system == EarlyWarningNEWS2 && len(t[system]) > 0 {
+		index = 0
+	}
+	if index < 0 {
+		return -1, ""
+	}
+	return index, t[system][index].Level
+}
+
+// Early warning alert statuses
+const (
+	EarlyWarningAlertOpen         = "open"
+	EarlyWarningAlertAcknowledged = "acknowledged"
+)
+
+// EarlyWarningAlert is raised when an observation's early warning score
+// reaches a more urgent escalation level than the previous observation of
+// the encounter
+type EarlyWarningAlert struct {
+	BaseModel
+
+	VitalSignsID uint     `gorm:"uniqueIndex;not null" json:"vital_signs_id"`
+	EncounterID  uint     `gorm:"index;not null" json:"encounter_id"`
+	PatientID    uint     `gorm:"index;not null" json:"patient_id"`
+	Patient      *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+
+	System        string `gorm:"size:10;not null" json:"system"`
+	Score         int    `json:"score"`
+	Risk          string `gorm:"size:20" json:"risk"`
+	Level         string `gorm:"size:30;not null;index" json:"level"`
+	PreviousScore *int   `json:"previous_score,omitempty"`
+
+	Status   string    `gorm:"size:20;not null;index" json:"status"`
+	RaisedAt time.Time `gorm:"not null" json:"raised_at"`
+
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy *uint      `json:"acknowledged_by,omitempty"`
+	Response       string     `gorm:"type:text" json:"response,omitempty"` // action taken
+}
+
+// TableName overrides the table name
+func (EarlyWarningAlert) TableName() string {
+	return "early_warning_alerts"
+}
+
+// Acknowledge records who responded to the alert and how
+func (a *EarlyWarningAlert) Acknowledge(by uint, response string, at time.Time) error {
+	if a.Status != EarlyWarningAlertOpen {
+		return ErrAlertAcknowledged
+	}
+	a.Status = EarlyWarningAlertAcknowledged
+	a.AcknowledgedAt = &at
+	a.AcknowledgedBy = &by
+	a.Response = response
+	return nil
+}
+
+// WardEarlyWarning is an admitted patient with their latest early warning score
+type WardEarlyWarning struct {
+	AdmissionID   uint      `json:"admission_id"`
+	AdmissionDate time.Time `json:"admission_date"`
+	PatientID     uint      `json:"patient_id"`
+	MRN           string    `json:"mrn"`
+	PatientName   string    `json:"patient_name"`
+	RoomNumber    string    `json:"room_number"`
+	BedNumber     string    `json:"bed_number"`
+
+	VitalSignsID *uint      `json:"vital_signs_id,omitempty"`
+	MeasuredAt   *time.Time `json:"measured_at,omitempty"`
+	System       string     `json:"system,omitempty"`
+	Score        *int       `json:"score,omitempty"`
+	Risk         string     `json:"risk,omitempty"`
+	OpenAlerts   int        `json:"open_alerts"`
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// normalAdultVitals score 0 on NEWS2
+func normalAdultVitals() VitalSigns {
+	return VitalSigns{
+		RespiratoryRate: intPtr(16),
+		SpO2:            intPtr(97),
+		SystolicBP:      intPtr(120),
+		PulseRate:       intPtr(70),
+		Consciousness:   AVPUAlert,
+		Temperature:     floatPtr(37),
+	}
+}
+
+func TestNEWS2(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(v *VitalSigns)
+		wantScore int
+		wantRisk  string
+		wantRed   bool
+	}{
+		{"normal", func(v *VitalSigns) {}, 0, EarlyWarningRiskLow, false},
+		{"slow breathing", func(v *VitalSigns) { v.RespiratoryRate = intPtr(8) }, 3, EarlyWarningRiskLowMedium, true},
+		{"breathing 9", func(v *VitalSigns) { v.RespiratoryRate = intPtr(9) }, 1, EarlyWarningRiskLow, false},
+		{"breathing 21", func(v *VitalSigns) { v.RespiratoryRate = intPtr(21) }, 2, EarlyWarningRiskLow, false},
+		{"breathing 25", func(v *VitalSigns) { v.RespiratoryRate = intPtr(25) }, 3, EarlyWarningRiskLowMedium, true},
+		{"SpO2 95", func(v *VitalSigns) { v.SpO2 = intPtr(95) }, 1, EarlyWarningRiskLow, false},
+		{"SpO2 92", func(v *VitalSigns) { v.SpO2 = intPtr(92) }, 2, EarlyWarningRiskLow, false},
+		{"SpO2 91", func(v *VitalSigns) { v.SpO2 = intPtr(91) }, 3, EarlyWarningRiskLowMedium, true},
+		{"scale 2 on target", func(v *VitalSigns) { v.SpO2Scale2, v.SpO2 = true, intPtr(90) }, 0, EarlyWarningRiskLow, false},
+		{"scale 2 low", func(v *VitalSigns) { v.SpO2Scale2, v.SpO2 = true, intPtr(85) }, 2, EarlyWarningRiskLow, false},
+		{"scale 2 on air above target", func(v *VitalSigns) { v.SpO2Scale2, v.SpO2 = true, intPtr(97) }, 0, EarlyWarningRiskLow, false},
+		{"scale 2 on oxygen above target", func(v *VitalSigns) {
+			v.SpO2Scale2, v.OnOxygen, v.SpO2 = true, true, intPtr(97)
+		}, 3 + 2, EarlyWarningRiskMedium, true},
+		{"oxygen", func(v *VitalSigns) { v.OnOxygen = true }, 2, EarlyWarningRiskLow, false},
+		{"systolic 90", func(v *VitalSigns) { v.SystolicBP = intPtr(90) }, 3, EarlyWarningRiskLowMedium, true},
+		{"systolic 105", func(v *VitalSigns) { v.SystolicBP = intPtr(105) }, 1, EarlyWarningRiskLow, false},
+		{"systolic 220", func(v *VitalSigns) { v.SystolicBP = intPtr(220) }, 3, EarlyWarningRiskLowMedium, true},
+		{"pulse 40", func(v *VitalSigns) { v.PulseRate = intPtr(40) }, 3, EarlyWarningRiskLowMedium, true},
+		{"pulse 111", func(v *VitalSigns) { v.PulseRate = intPtr(111) }, 2, EarlyWarningRiskLow, false},
+		{"pulse 131", func(v *VitalSigns) { v.PulseRate = intPtr(131) }, 3, EarlyWarningRiskLowMedium, true},
+		{"new confusion", func(v *VitalSigns) { v.Consciousness = AVPUConfused }, 3, EarlyWarningRiskLowMedium, true},
+		{"temperature 35", func(v *VitalSigns) { v.Temperature = floatPtr(35) }, 3, EarlyWarningRiskLowMedium, true},
+		{"temperature 38.5", func(v *VitalSigns) { v.Temperature = floatPtr(38.5) }, 1, EarlyWarningRiskLow, false},
+		{"temperature 39.1", func(v *VitalSigns) { v.Temperature = floatPtr(39.1) }, 2, EarlyWarningRiskLow, false},
+		{"medium", func(v *VitalSigns) {
+			v.RespiratoryRate, v.PulseRate, v.Temperature = intPtr(22), intPtr(100), floatPtr(39.5)
+		}, 5, EarlyWarningRiskMedium, false},
+		{"high", func(v *VitalSigns) {
+			v.RespiratoryRate, v.SpO2, v.SystolicBP, v.PulseRate, v.Temperature =
+				intPtr(22), intPtr(93), intPtr(105), intPtr(115), floatPtr(38.5)
+		}, 8, EarlyWarningRiskHigh, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vitals := normalAdultVitals()
+			tt.change(&vitals)
+			ews := vitals.NEWS2()
+			assert.Equal(t, EarlyWarningNEWS2, ews.System)
+			assert.Equal(t, tt.wantScore, ews.Score)
+			assert.Equal(t, tt.wantRisk, ews.Risk)
+			assert.Equal(t, tt.wantRed, ews.RedParameter)
+			assert.Empty(t, ews.Missing)
+		})
+	}
+
+	ews := (&VitalSigns{PulseRate: intPtr(70)}).NEWS2()
+	assert.Equal(t, []string{"respiratory_rate", "spo2", "systolic_bp", "consciousness", "temperature"}, ews.Missing)
+}
+
+func TestPEWS(t *testing.T) {
+	// A five year old: heart rate 70-110, respiratory rate 21-23
+	const months = 60
+
+	tests := []struct {
+		name        string
+		vitals      VitalSigns
+		wantScore   int
+		wantRisk    string
+		wantMissing []string
+	}{
+		{"nothing recorded", VitalSigns{}, 0, EarlyWarningRiskLow, []string{"behaviour", "cardiovascular", "respiratory"}},
+		{"well", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPink, PulseRate: intPtr(100), RespiratoryRate: intPtr(22), RespiratoryEffort: RespiratoryEffortNormal},
+			0, EarlyWarningRiskLow, nil},
+		{"alert counts as playing", VitalSigns{Consciousness: AVPUAlert, SkinColour: SkinColourPink, RespiratoryEffort: RespiratoryEffortNormal}, 0, EarlyWarningRiskLow, nil},
+		{"not alert counts as lethargic", VitalSigns{Consciousness: AVPUVoice, SkinColour: SkinColourPink, RespiratoryEffort: RespiratoryEffortNormal}, 3, EarlyWarningRiskLowMedium, nil},
+		{"sleeping", VitalSigns{Behaviour: PEWSBehaviourSleeping, SkinColour: SkinColourPink, RespiratoryEffort: RespiratoryEffortNormal}, 1, EarlyWarningRiskLow, nil},
+		{"pulse 20 over normal", VitalSigns{Behaviour: PEWSBehaviourPlaying, PulseRate: intPtr(130), RespiratoryEffort: RespiratoryEffortNormal}, 2, EarlyWarningRiskLow, nil},
+		{"pulse 30 over normal", VitalSigns{Behaviour: PEWSBehaviourPlaying, PulseRate: intPtr(140), RespiratoryEffort: RespiratoryEffortNormal}, 3, EarlyWarningRiskLowMedium, nil},
+		{"bradycardia", VitalSigns{Behaviour: PEWSBehaviourPlaying, PulseRate: intPtr(60), RespiratoryEffort: RespiratoryEffortNormal}, 3, EarlyWarningRiskLowMedium, nil},
+		{"worst cardiovascular sign counts", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPale, CapillaryRefill: floatPtr(4), PulseRate: intPtr(100), RespiratoryEffort: RespiratoryEffortNormal},
+			2, EarlyWarningRiskLow, nil},
+		{"mottled", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourMottled, RespiratoryEffort: RespiratoryEffortNormal}, 3, EarlyWarningRiskLowMedium, nil},
+		{"breathing 10 over normal", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPink, RespiratoryRate: intPtr(34)}, 1, EarlyWarningRiskLow, nil},
+		{"breathing 20 over normal", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPink, RespiratoryRate: intPtr(44)}, 2, EarlyWarningRiskLow, nil},
+		{"slow breathing with retractions", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPink, RespiratoryRate: intPtr(16), RespiratoryEffort: RespiratoryEffortRetraction},
+			3, EarlyWarningRiskLowMedium, nil},
+		{"oxygen 8 L/min", VitalSigns{Behaviour: PEWSBehaviourPlaying, SkinColour: SkinColourPink, OxygenFlowRate: floatPtr(8)}, 3, EarlyWarningRiskLowMedium, nil},
+		{"medium", VitalSigns{Behaviour: PEWSBehaviourIrritable, SkinColour: SkinColourPink, RespiratoryEffort: RespiratoryEffortNormal, PersistentVomiting: true},
+			4, EarlyWarningRiskMedium, nil},
+		{"high", VitalSigns{Behaviour: PEWSBehaviourIrritable, SkinColour: SkinColourPale, PulseRate: intPtr(130), RespiratoryRate: intPtr(34), RespiratoryEffort: RespiratoryEffortNormal, FrequentNebulisers: true},
+			2 + 2 + 1 + 2, EarlyWarningRiskHigh, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ews := tt.vitals.PEWS(months)
+			assert.Equal(t, EarlyWarningPEWS, ews.System)
+			assert.Equal(t, tt.wantScore, ews.Score)
+			assert.Equal(t, tt.wantRisk, ews.Risk)
+			assert.Equal(t, tt.wantMissing, ews.Missing)
+		})
+	}
+
+	// 150/min is normal for an infant but 40 over normal at five
+	infant := VitalSigns{Behaviour: PEWSBehaviourPlaying, PulseRate: intPtr(150), RespiratoryEffort: RespiratoryEffortNormal}
+	assert.Equal(t, 0, infant.PEWS(6).Score)
+	assert.Equal(t, 3, infant.PEWS(months).Score)
+}
+
+func TestScoreEarlyWarning(t *testing.T) {
+	measured := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		patient    *Patient
+		wantSystem string
+	}{
+		{"unknown age", &Patient{}, EarlyWarningNEWS2},
+		{"no patient", nil, EarlyWarningNEWS2},
+		{"sixteenth birthday", bornOn(2008, 5, 1), EarlyWarningNEWS2},
+		{"day before the sixteenth birthday", bornOn(2008, 5, 2), EarlyWarningPEWS},
+		{"infant", bornOn(2024, 1, 15), EarlyWarningPEWS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vitals := VitalSigns{MeasuredAt: measured, PulseRate: intPtr(70)}
+			ews := vitals.ScoreEarlyWarning(tt.patient)
+			assert.Equal(t, tt.wantSystem, ews.System)
+			assert.Equal(t, tt.wantSystem, vitals.EWSSystem)
+			require.NotNil(t, vitals.EWSScore)
+			assert.Equal(t, ews.Score, *vitals.EWSScore)
+			assert.Equal(t, ews.Risk, vitals.EWSRisk)
+			assert.Equal(t, ews.Missing, vitals.EWSMissing)
+		})
+	}
+}
+
+func TestEarlyWarningThresholdsLevel(t *testing.T) {
+	thresholds := DefaultEarlyWarningThresholds()
+
+	tests := []struct {
+		name         string
+		system       string
+		score        int
+		redParameter bool
+		wantIndex    int
+		wantLevel    string
+	}{
+		{"NEWS2 below", EarlyWarningNEWS2, 4, false, -1, ""},
+		{"NEWS2 single red parameter", EarlyWarningNEWS2, 3, true, 0, EscalationUrgent},
+		{"NEWS2 urgent", EarlyWarningNEWS2, 6, false, 0, EscalationUrgent},
+		{"NEWS2 emergency", EarlyWarningNEWS2, 7, true, 1, EscalationEmergency},
+		{"PEWS below", EarlyWarningPEWS, 2, true, -1, ""},
+		{"PEWS urgent", EarlyWarningPEWS, 3, false, 0, EscalationUrgent},
+		{"PEWS emergency", EarlyWarningPEWS, 6, false, 1, EscalationEmergency},
+		{"unknown system", "MEWS", 9, true, -1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, level := thresholds.Level(tt.system, tt.score, tt.redParameter)
+			assert.Equal(t, tt.wantIndex, index)
+			assert.Equal(t, tt.wantLevel, level)
+		})
+	}
+
+	unsorted := EarlyWarningThresholds{EarlyWarningPEWS: {{EscalationEmergency, 5}, {EscalationUrgent, 3}}}
+	unsorted.Sort()
+	assert.Equal(t, DefaultEarlyWarningThresholds()[EarlyWarningPEWS], unsorted[EarlyWarningPEWS])
+}
+
+func TestEarlyWarningAlertAcknowledge(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	alert := EarlyWarningAlert{Status: EarlyWarningAlertOpen}
+
+	require.NoError(t, alert.Acknowledge(3, "Doctor called", at))
+	assert.Equal(t, EarlyWarningAlertAcknowledged, alert.Status)
+	assert.Equal(t, at, *alert.AcknowledgedAt)
+	assert.Equal(t, uint(3), *alert.AcknowledgedBy)
+	assert.ErrorIs(t, alert.Acknowledge(4, "Again", at), ErrAlertAcknowledged)
+}
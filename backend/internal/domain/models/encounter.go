@@ -1,9 +1,57 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// Encounter statuses, as in FHIR R4 Encounter.status
+const (
+	EncounterStatusPlanned        = "planned"
+	EncounterStatusArrived        = "arrived"
+	EncounterStatusTriaged        = "triaged"
+	EncounterStatusInProgress     = "in-progress"
+	EncounterStatusOnLeave        = "onleave"
+	EncounterStatusFinished       = "finished"
+	EncounterStatusCancelled      = "cancelled"
+	EncounterStatusEnteredInError = "entered-in-error"
+)
+
+// Encounter classes, as in FHIR R4 Encounter.class (v3 ActCode)
+const (
+	EncounterClassInpatient  = "imp"
+	EncounterClassAmbulatory = "amb"
+	EncounterClassEmergency  = "emer"
+	EncounterClassHomeHealth = "hh"
+	EncounterClassVirtual    = "vr"
+)
+
+// encounterTransitions lists the statuses an encounter can move to from each
+// status. Patients arrive, may be triaged, are seen and leave; an inpatient
+// can go on leave and come back. Any encounter recorded by mistake can be
+// marked entered-in-error, which is final.
+var encounterTransitions = map[string][]string{
+	EncounterStatusPlanned:        {EncounterStatusArrived, EncounterStatusCancelled, EncounterStatusEnteredInError},
+	EncounterStatusArrived:        {EncounterStatusTriaged, EncounterStatusInProgress, EncounterStatusCancelled, EncounterStatusEnteredInError},
+	EncounterStatusTriaged:        {EncounterStatusInProgress, EncounterStatusCancelled, EncounterStatusEnteredInError},
+	EncounterStatusInProgress:     {EncounterStatusOnLeave, EncounterStatusFinished, EncounterStatusEnteredInError},
+	EncounterStatusOnLeave:        {EncounterStatusInProgress, EncounterStatusFinished, EncounterStatusEnteredInError},
+	EncounterStatusFinished:       {EncounterStatusEnteredInError},
+	EncounterStatusCancelled:      {EncounterStatusEnteredInError},
+	EncounterStatusEnteredInError: {},
+}
+
+var (
+	// ErrEncounterTransition is wrapped by the error of a status change the
+	// encounter workflow does not allow
+	ErrEncounterTransition = errors.New("encounter status change not allowed")
+
+	ErrInvalidEncounterStatus  = &ValidationError{Field: "status", Message: "Status must be one of planned, arrived, triaged, in-progress, onleave, finished, cancelled, entered-in-error"}
+	ErrEncounterReasonRequired = &ValidationError{Field: "reason", Message: "A reason is required to mark an encounter entered-in-error"}
+)
+
 // Encounter represents an interaction between a patient and healthcare provider(s)
 // FHIR R4 Encounter resource - Enhanced version
 type Encounter struct {
@@ -76,23 +124,55 @@ func (Encounter) TableName() string {
 	return "encounters"
 }
 
+// IsValidEncounterStatus checks if status is a known encounter status
+func IsValidEncounterStatus(status string) bool {
+	_, ok := encounterTransitions[status]
+	return ok
+}
+
+// NextStatuses returns the statuses the encounter can move to from its current one
+func (e *Encounter) NextStatuses() []string {
+	return encounterTransitions[e.Status]
+}
+
+// TransitionTo moves the encounter to status at the given time, rejecting
+// changes the workflow does not allow. Finishing sets the end of the period.
+func (e *Encounter) TransitionTo(status string, at time.Time) error {
+	if !IsValidEncounterStatus(status) {
+		return ErrInvalidEncounterStatus
+	}
+	allowed := false
+	for _, next := range e.NextStatuses() {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		if len(e.NextStatuses()) == 0 {
+			return fmt.Errorf("%w: %s is final", ErrEncounterTransition, e.Status)
+		}
+		return fmt.Errorf("%w: %s cannot move to %s, only to %s",
+			ErrEncounterTransition, e.Status, status, strings.Join(e.NextStatuses(), ", "))
+	}
+
+	e.Status = status
+	if status == EncounterStatusFinished && e.PeriodEnd == nil {
+		e.PeriodEnd = &at
+	}
+	return nil
+}
+
 // Start marks the encounter as in-progress
-func (e *Encounter) Start() {
-	e.Status = "in-progress"
+func (e *Encounter) Start() error {
+	return e.TransitionTo(EncounterStatusInProgress, time.Now())
 }
 
 // Finish completes the encounter
-func (e *Encounter) Finish() {
-	now := time.Now()
-	e.Status = "finished"
-	if e.PeriodEnd == nil {
-		e.PeriodEnd = &now
-	}
+func (e *Encounter) Finish() error {
+	return e.TransitionTo(EncounterStatusFinished, time.Now())
 }
 
 // Cancel cancels the encounter
-func (e *Encounter) Cancel() {
-	e.Status = "cancelled"
+func (e *Encounter) Cancel() error {
+	return e.TransitionTo(EncounterStatusCancelled, time.Now())
 }
 
 // GetDuration returns the encounter duration in minutes
@@ -105,5 +185,5 @@ func (e *Encounter) GetDuration() int {
 
 // IsActive checks if the encounter is currently active
 func (e *Encounter) IsActive() bool {
-	return e.Status == "in-progress" || e.Status == "arrived" || e.Status == "triaged"
+	return e.Status == EncounterStatusInProgress || e.Status == EncounterStatusArrived || e.Status == EncounterStatusTriaged
 }
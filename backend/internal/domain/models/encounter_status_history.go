@@ -0,0 +1,110 @@
+package models
+
+import "time"
+
+// EncounterStatusHistory records a status an encounter moved to, when and by
+// whom. The first entry of an encounter is the status it was created with.
+type EncounterStatusHistory struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	EncounterID uint      `gorm:"index;not null" json:"encounter_id"`
+	FromStatus  string    `gorm:"size:50" json:"from_status,omitempty"`
+	Status      string    `gorm:"size:50;not null" json:"status"`
+	ChangedAt   time.Time `gorm:"not null;index" json:"changed_at"`
+	ChangedBy   uint      `json:"changed_by,omitempty"` // UserID
+	Reason      string    `gorm:"type:text" json:"reason,omitempty"`
+}
+
+// AuditParent returns the encounter the status change belongs to
+func (e EncounterStatusHistory) AuditParent() (interface{}, uint) {
+	return &Encounter{}, e.EncounterID
+}
+
+func (EncounterStatusHistory) TableName() string {
+	return "encounter_status_history"
+}
+
+// EncounterTimes are the waiting and service times of one encounter, derived
+// from its status history. Times whose statuses were never reached are left out.
+type EncounterTimes struct {
+	ArrivedAt  *time.Time `json:"arrived_at,omitempty"`
+	TriagedAt  *time.Time `json:"triaged_at,omitempty"`
+	SeenAt     *time.Time `json:"seen_at,omitempty"` // first in-progress
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	DoorToTriageMinutes *float64 `json:"door_to_triage_minutes,omitempty"`
+	DoorToDoctorMinutes *float64 `json:"door_to_doctor_minutes,omitempty"`
+	ConsultationMinutes *float64 `json:"consultation_minutes,omitempty"`   // seen to finished, less time on leave
+	LengthOfStayMinutes *float64 `json:"length_of_stay_minutes,omitempty"` // arrived to finished
+	OnLeaveMinutes      float64  `json:"on_leave_minutes"`
+}
+
+// EncounterTimesFrom derives the times of an encounter from its status
+// history in chronological order
+func EncounterTimesFrom(history []EncounterStatusHistory) EncounterTimes {
+	var t EncounterTimes
+	var leftAt *time.Time
+	returned := func(at time.Time) {
+		if leftAt != nil {
+			t.OnLeaveMinutes += at.Sub(*leftAt).Minutes()
+			leftAt = nil
+		}
+	}
+
+	for _, entry := range history {
+		at := entry.ChangedAt
+		switch entry.Status {
+		case EncounterStatusArrived:
+			if t.ArrivedAt == nil {
+				t.ArrivedAt = &at
+			}
+		case EncounterStatusTriaged:
+			if t.TriagedAt == nil {
+				t.TriagedAt = &at
+			}
+		case EncounterStatusInProgress:
+			if t.SeenAt == nil {
+				t.SeenAt = &at
+			}
+			returned(at)
+		case EncounterStatusOnLeave:
+			leftAt = &at
+		case EncounterStatusFinished:
+			t.FinishedAt = &at
+			returned(at)
+		}
+	}
+
+	t.DoorToTriageMinutes = minutesBetween(t.ArrivedAt, t.TriagedAt)
+	t.DoorToDoctorMinutes = minutesBetween(t.ArrivedAt, t.SeenAt)
+	if consultation := minutesBetween(t.SeenAt, t.FinishedAt); consultation != nil {
+		*consultation -= t.OnLeaveMinutes
+		t.ConsultationMinutes = consultation
+	}
+	t.LengthOfStayMinutes = minutesBetween(t.ArrivedAt, t.FinishedAt)
+	return t
+}
+
+func minutesBetween(from, to *time.Time) *float64 {
+	if from == nil || to == nil {
+		return nil
+	}
+	minutes := to.Sub(*from).Minutes()
+	return &minutes
+}
+
+// EncounterWaitTimes summarizes, in minutes, how long the patients who
+// arrived in a period waited to be triaged and to be seen
+type EncounterWaitTimes struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	ServiceCategory string    `json:"service_category,omitempty"`
+
+	Arrivals int64 `json:"arrivals"`
+	Triaged  int64 `json:"triaged"`
+	Seen     int64 `json:"seen"`
+
+	DoorToTriageMedian *float64 `json:"door_to_triage_median,omitempty"`
+	DoorToDoctorMedian *float64 `json:"door_to_doctor_median,omitempty"`
+	DoorToDoctorP90    *float64 `json:"door_to_doctor_p90,omitempty"`
+	DoorToDoctorMean   *float64 `json:"door_to_doctor_mean,omitempty"`
+}
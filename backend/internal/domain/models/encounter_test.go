@@ -0,0 +1,127 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncounterTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{EncounterStatusPlanned, EncounterStatusArrived, true},
+		{EncounterStatusPlanned, EncounterStatusInProgress, false},
+		{EncounterStatusArrived, EncounterStatusTriaged, true},
+		{EncounterStatusArrived, EncounterStatusInProgress, true},
+		{EncounterStatusArrived, EncounterStatusFinished, false},
+		{EncounterStatusTriaged, EncounterStatusInProgress, true},
+		{EncounterStatusTriaged, EncounterStatusArrived, false},
+		{EncounterStatusInProgress, EncounterStatusOnLeave, true},
+		{EncounterStatusInProgress, EncounterStatusFinished, true},
+		{EncounterStatusInProgress, EncounterStatusCancelled, false},
+		{EncounterStatusOnLeave, EncounterStatusInProgress, true},
+		{EncounterStatusFinished, EncounterStatusInProgress, false},
+		{EncounterStatusFinished, EncounterStatusEnteredInError, true},
+		{EncounterStatusCancelled, EncounterStatusArrived, false},
+		{EncounterStatusEnteredInError, EncounterStatusPlanned, false},
+		{EncounterStatusEnteredInError, EncounterStatusEnteredInError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			e := &Encounter{Status: tt.from}
+			err := e.TransitionTo(tt.to, time.Now())
+			if tt.allowed {
+				require.NoError(t, err)
+				assert.Equal(t, tt.to, e.Status)
+				return
+			}
+			assert.ErrorIs(t, err, ErrEncounterTransition)
+			assert.Equal(t, tt.from, e.Status)
+		})
+	}
+}
+
+// TestEncounterTransitionsCoverStatuses checks every status has an entry and
+// can be marked entered-in-error, which is final
+func TestEncounterTransitionsCoverStatuses(t *testing.T) {
+	for status, next := range encounterTransitions {
+		assert.True(t, IsValidEncounterStatus(status), status)
+		for _, to := range next {
+			assert.True(t, IsValidEncounterStatus(to), "%s to %s", status, to)
+		}
+		if status == EncounterStatusEnteredInError {
+			assert.Empty(t, next)
+			continue
+		}
+		assert.Contains(t, next, EncounterStatusEnteredInError, status)
+	}
+}
+
+func TestEncounterTransitionTo(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	e := &Encounter{Status: EncounterStatusInProgress}
+	assert.Equal(t, ErrInvalidEncounterStatus, e.TransitionTo("discharged", at))
+	require.NoError(t, e.TransitionTo(EncounterStatusFinished, at))
+	require.NotNil(t, e.PeriodEnd)
+	assert.True(t, at.Equal(*e.PeriodEnd))
+
+	// An end already recorded is kept
+	end := at.Add(-time.Hour)
+	e = &Encounter{Status: EncounterStatusOnLeave, PeriodEnd: &end}
+	require.NoError(t, e.TransitionTo(EncounterStatusFinished, at))
+	assert.True(t, end.Equal(*e.PeriodEnd))
+
+	e = &Encounter{Status: EncounterStatusEnteredInError}
+	err := e.TransitionTo(EncounterStatusFinished, at)
+	assert.ErrorIs(t, err, ErrEncounterTransition)
+	assert.Contains(t, err.Error(), "is final")
+}
+
+func TestEncounterTimesFrom(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	entry := func(status string, minutes int) EncounterStatusHistory {
+		return EncounterStatusHistory{Status: status, ChangedAt: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	tests := []struct {
+		name                                                   string
+		history                                                []EncounterStatusHistory
+		doorToTriage, doorToDoctor, consultation, lengthOfStay *float64
+		onLeave                                                float64
+	}{
+		{"no history", nil, nil, nil, nil, nil, 0},
+		{"arrived only", []EncounterStatusHistory{entry(EncounterStatusPlanned, 0), entry(EncounterStatusArrived, 5)},
+			nil, nil, nil, nil, 0},
+		{"triaged, seen and finished", []EncounterStatusHistory{
+			entry(EncounterStatusArrived, 0), entry(EncounterStatusTriaged, 12),
+			entry(EncounterStatusInProgress, 40), entry(EncounterStatusFinished, 55),
+		}, floatPtr(12), floatPtr(40), floatPtr(15), floatPtr(55), 0},
+		{"seen without triage", []EncounterStatusHistory{
+			entry(EncounterStatusArrived, 0), entry(EncounterStatusInProgress, 25),
+		}, nil, floatPtr(25), nil, nil, 0},
+		{"time on leave is not consultation", []EncounterStatusHistory{
+			entry(EncounterStatusArrived, 0), entry(EncounterStatusInProgress, 10),
+			entry(EncounterStatusOnLeave, 60), entry(EncounterStatusInProgress, 180),
+			entry(EncounterStatusOnLeave, 200), entry(EncounterStatusFinished, 230),
+		}, nil, floatPtr(10), floatPtr(70), floatPtr(230), 150},
+		{"first arrival and first seen count", []EncounterStatusHistory{
+			entry(EncounterStatusArrived, 0), entry(EncounterStatusArrived, 30),
+			entry(EncounterStatusInProgress, 45), entry(EncounterStatusInProgress, 50),
+		}, nil, floatPtr(45), nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncounterTimesFrom(tt.history)
+			assertFloatPtr(t, tt.doorToTriage, got.DoorToTriageMinutes)
+			assertFloatPtr(t, tt.doorToDoctor, got.DoorToDoctorMinutes)
+			assertFloatPtr(t, tt.consultation, got.ConsultationMinutes)
+			assertFloatPtr(t, tt.lengthOfStay, got.LengthOfStayMinutes)
+			assert.InDelta(t, tt.onLeave, got.OnLeaveMinutes, 1e-9)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// WHO growth standard indicators, named after the WHO reference files
+const (
+	GrowthWeightForAge    = "wfa"  // weight-for-age
+	GrowthLengthForAge    = "lhfa" // length/height-for-age
+	GrowthWeightForLength = "wfl"  // weight-for-length, under 2 years
+	GrowthWeightForHeight = "wfh"  // weight-for-height, 2 years and over
+	GrowthMUACForAge      = "acfa" // mid-upper arm circumference-for-age, from 3 months
+)
+
+// GrowthMaxAgeDays is the last age covered by the WHO child growth standards
+const GrowthMaxAgeDays = 1856
+
+// Length positions; children under 2 are measured lying, older children standing
+const (
+	LengthPositionRecumbent = "recumbent"
+	LengthPositionStanding  = "standing"
+)
+
+// Nutrition status of children 0-59 months
+const (
+	NutritionSAM    = "sam"    // severe acute malnutrition
+	NutritionMAM    = "mam"    // moderate acute malnutrition
+	NutritionNormal = "normal" // no acute malnutrition
+)
+
+// MUAC cut-offs (cm) of acute malnutrition for children 6-59 months
+const (
+	MUACSevere   = 11.5
+	MUACModerate = 12.5
+)
+
+var (
+	ErrInvalidLengthPosition = &ValidationError{Field: "length_position", Message: "Length position must be recumbent or standing"}
+	ErrGrowthBirthDate       = &ValidationError{Field: "birth_date", Message: "Growth is assessed for patients with a birth date"}
+	ErrGrowthSex             = &ValidationError{Field: "gender", Message: "Growth is assessed for patients recorded as male or female"}
+)
+
+// LMS are the Box-Cox power, median and coefficient of variation of a
+// growth reference at one age or length
+type LMS struct {
+	L, M, S float64
+}
+
+// ZScore returns the z-score of a measurement. Restricted indicators (all
+// weight and arm circumference ones) are not skewed beyond ±3 SD: there the
+// distance between the 2 and 3 SD values is used, as in the WHO standards.
+func (p LMS) ZScore(x float64, restricted bool) float64 {
+	z := (math.Pow(x/p.M, p.L) - 1) / (p.S * p.L)
+	if !restricted || math.Abs(z) <= 3 {
+		return z
+	}
+	if z > 3 {
+		sd3, sd2 := p.value(3), p.value(2)
+		return 3 + (x-sd3)/(sd3-sd2)
+	}
+	sd3, sd2 := p.value(-3), p.value(-2)
+	return -3 + (x-sd3)/(sd2-sd3)
+}
+
+// value returns the measurement at a z-score
+func (p LMS) value(z float64) float64 {
+	return p.M * math.Pow(1+p.L*p.S*z, 1/p.L)
+}
+
+// growthTable is a reference of one indicator and sex, by age in days or
+// length in cm
+type growthTable struct {
+	keys []float64
+	lms  []LMS
+}
+
+// at returns the reference at a key, interpolated between the rows around it
+func (t *growthTable) at(key float64) (LMS, bool) {
+	n := len(t.keys)
+	if n == 0 || key < t.keys[0] || key > t.keys[n-1] {
+		return LMS{}, false
+	}
+	i := sort.SearchFloat64s(t.keys, key)
+	if t.keys[i] == key {
+		return t.lms[i], true
+	}
+	lo, hi := t.lms[i-1], t.lms[i]
+	f := (key - t.keys[i-1]) / (t.keys[i] - t.keys[i-1])
+	return LMS{L: lo.L + f*(hi.L-lo.L), M: lo.M + f*(hi.M-lo.M), S: lo.S + f*(hi.S-lo.S)}, true
+}
+
+// GrowthStandards holds the WHO child growth standards by indicator and sex
+type GrowthStandards struct {
+	tables map[string]map[string]*growthTable
+}
+
+func NewGrowthStandards() *GrowthStandards {
+	return &GrowthStandards{tables: map[string]map[string]*growthTable{}}
+}
+
+// Add adds a row of an indicator's reference for a sex (male or female).
+// Rows may be added in any order.
+func (g *GrowthStandards) Add(indicator, sex string, key float64, lms LMS) {
+	if g.tables[indicator] == nil {
+		g.tables[indicator] = map[string]*growthTable{}
+	}
+	t := g.tables[indicator][sex]
+	if t == nil {
+		t = &growthTable{}
+		g.tables[indicator][sex] = t
+	}
+	i := sort.SearchFloat64s(t.keys, key)
+	if i < len(t.keys) && t.keys[i] == key {
+		t.lms[i] = lms
+		return
+	}
+	t.keys = append(t.keys, 0)
+	t.lms = append(t.lms, LMS{})
+	copy(t.keys[i+1:], t.keys[i:])
+	copy(t.lms[i+1:], t.lms[i:])
+	t.keys[i] = key
+	t.lms[i] = lms
+}
+
+// Has reports whether an indicator's reference was loaded
+func (g *GrowthStandards) Has(indicator string) bool {
+	return g != nil && len(g.tables[indicator]) > 0
+}
+
+// ZScore returns the z-score of a measurement on an indicator, or nil when
+// the standards do not cover it
+func (g *GrowthStandards) ZScore(indicator, sex string, key, value float64) *float64 {
+	if g == nil || g.tables[indicator][sex] == nil {
+		return nil
+	}
+	lms, ok := g.tables[indicator][sex].at(key)
+	if !ok {
+		return nil
+	}
+	z := lms.ZScore(value, indicator != GrowthLengthForAge)
+	z = math.Round(z*100) / 100
+	return &z
+}
+
+// growthPlausible are the z-score limits outside which WHO treats a value as
+// a likely measurement or entry error
+var growthPlausible = map[string][2]float64{
+	GrowthWeightForAge:    {-6, 5},
+	GrowthLengthForAge:    {-6, 6},
+	GrowthWeightForLength: {-5, 5},
+	GrowthWeightForHeight: {-5, 5},
+	GrowthMUACForAge:      {-5, 5},
+}
+
+// GrowthAssessment is a child's anthropometry on one observation, compared
+// with the WHO child growth standards
+type GrowthAssessment struct {
+	VitalSignsID uint      `json:"vital_signs_id"`
+	MeasuredAt   time.Time `json:"measured_at"`
+	AgeDays      int       `json:"age_days"`
+	AgeMonths    int       `json:"age_months"`
+
+	Weight *float64 `json:"weight,omitempty"`
+	// Height is the length for children under 2 and the standing height
+	// from 2, corrected by 0.7 cm when measured the other way
+	Height *float64 `json:"height,omitempty"`
+	MUAC   *float64 `json:"muac,omitempty"`
+	Oedema bool     `json:"oedema"`
+
+	WeightForAge    *float64 `json:"weight_for_age_z,omitempty"`
+	HeightForAge    *float64 `json:"height_for_age_z,omitempty"`
+	WeightForHeight *float64 `json:"weight_for_height_z,omitempty"`
+	MUACForAge      *float64 `json:"muac_for_age_z,omitempty"`
+	// Implausible lists the indicators left out as likely errors
+	Implausible []string `json:"implausible,omitempty"`
+
+	Nutrition string `json:"nutrition,omitempty"` // sam, mam or normal; empty if unknown
+}
+
+// AssessGrowth compares a child's measurements with the standards. It returns
+// false for patients without birth date or sex and from 5 years of age. With
+// nil standards, or standards missing an indicator, the nutrition status is
+// classified on MUAC and oedema alone.
+func (g *GrowthStandards) AssessGrowth(v *VitalSigns, patient *Patient) (GrowthAssessment, bool) {
+	if patient == nil || patient.BirthDate == nil || (patient.Gender != "male" && patient.Gender != "female") {
+		return GrowthAssessment{}, false
+	}
+	birth := *patient.BirthDate
+	days := int(time.Date(v.MeasuredAt.Year(), v.MeasuredAt.Month(), v.MeasuredAt.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(birth.Year(), birth.Month(), birth.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if days < 0 || days > GrowthMaxAgeDays {
+		return GrowthAssessment{}, false
+	}
+	months, _ := ageInMonths(patient, v.MeasuredAt)
+	sex := patient.Gender
+
+	a := GrowthAssessment{
+		VitalSignsID: v.ID,
+		MeasuredAt:   v.MeasuredAt,
+		AgeDays:      days,
+		AgeMonths:    months,
+		Weight:       v.Weight,
+		MUAC:         v.MUAC,
+		Oedema:       v.Oedema,
+	}
+	if v.Height != nil {
+		height := *v.Height
+		switch {
+		case months < 24 && v.LengthPosition == LengthPositionStanding:
+			height += 0.7
+		case months >= 24 && v.LengthPosition == LengthPositionRecumbent:
+			height -= 0.7
+		}
+		a.Height = &height
+	}
+
+	plausible := func(indicator string, z *float64) *float64 {
+		if z == nil {
+			return nil
+		}
+		if limits := growthPlausible[indicator]; *z < limits[0] || *z > limits[1] {
+			a.Implausible = append(a.Implausible, indicator)
+			return nil
+		}
+		return z
+	}
+	age := float64(days)
+	if a.Weight != nil {
+		a.WeightForAge = plausible(GrowthWeightForAge, g.ZScore(GrowthWeightForAge, sex, age, *a.Weight))
+	}
+	if a.Height != nil {
+		a.HeightForAge = plausible(GrowthLengthForAge, g.ZScore(GrowthLengthForAge, sex, age, *a.Height))
+	}
+	// Oedema makes weight meaningless for wasting
+	if a.Weight != nil && a.Height != nil && !a.Oedema {
+		indicator := GrowthWeightForHeight
+		if months < 24 {
+			indicator = GrowthWeightForLength
+		}
+		a.WeightForHeight = plausible(indicator, g.ZScore(indicator, sex, *a.Height, *a.Weight))
+	}
+	if a.MUAC != nil && months >= 3 {
+		a.MUACForAge = plausible(GrowthMUACForAge, g.ZScore(GrowthMUACForAge, sex, age, *a.MUAC))
+	}
+	a.Nutrition = a.classify()
+	return a, true
+}
+
+// classify gives the acute malnutrition status from weight-for-height, MUAC
+// (6-59 months) and bilateral pitting oedema, as in the WHO criteria
+func (a *GrowthAssessment) classify() string {
+	muac := a.MUAC != nil && a.AgeMonths >= 6
+	switch {
+	case a.Oedema,
+		a.WeightForHeight != nil && *a.WeightForHeight < -3,
+		muac && *a.MUAC < MUACSevere:
+		return NutritionSAM
+	case a.WeightForHeight != nil && *a.WeightForHeight < -2,
+		muac && *a.MUAC < MUACModerate:
+		return NutritionMAM
+	case a.WeightForHeight != nil, muac:
+		return NutritionNormal
+	default:
+		return ""
+	}
+}
+
+// GrowthChart is a child's growth assessments, oldest first. Standards lists
+// the indicators whose WHO references are loaded; z-scores of the others are
+// left out.
+type GrowthChart struct {
+	PatientID   uint               `json:"patient_id"`
+	Sex         string             `json:"sex"`
+	BirthDate   time.Time          `json:"birth_date"`
+	Standards   []string           `json:"standards"`
+	Assessments []GrowthAssessment `json:"assessments"`
+}
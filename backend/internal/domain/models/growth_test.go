@@ -0,0 +1,220 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WHO child growth standards at birth, boys (weianthro.txt, lenanthro.txt)
+var (
+	whoBoysWeightAtBirth = LMS{L: 0.3487, M: 3.3464, S: 0.14602}
+	whoBoysLengthAtBirth = LMS{L: 1, M: 49.8842, S: 0.03795}
+)
+
+// TestLMSWHOTables checks the LMS curve against the SD columns of the WHO
+// tables, which are rounded to 0.1 kg and 0.1 cm, and the z-score back
+func TestLMSWHOTables(t *testing.T) {
+	tests := []struct {
+		name       string
+		lms        LMS
+		restricted bool
+		z          float64
+		want       float64
+	}{
+		{"weight -3 SD", whoBoysWeightAtBirth, true, -3, 2.1},
+		{"weight -2 SD", whoBoysWeightAtBirth, true, -2, 2.5},
+		{"weight -1 SD", whoBoysWeightAtBirth, true, -1, 2.9},
+		{"weight median", whoBoysWeightAtBirth, true, 0, 3.3},
+		{"weight +1 SD", whoBoysWeightAtBirth, true, 1, 3.9},
+		{"weight +2 SD", whoBoysWeightAtBirth, true, 2, 4.4},
+		{"weight +3 SD", whoBoysWeightAtBirth, true, 3, 5.0},
+		{"length -2 SD", whoBoysLengthAtBirth, false, -2, 46.1},
+		{"length median", whoBoysLengthAtBirth, false, 0, 49.9},
+		{"length +2 SD", whoBoysLengthAtBirth, false, 2, 53.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.lms.value(tt.z)
+			assert.InDelta(t, tt.want, math.Round(value*10)/10, 1e-9)
+			assert.InDelta(t, tt.z, tt.lms.ZScore(value, tt.restricted), 1e-9)
+		})
+	}
+}
+
+func TestLMSZScoreBeyondThreeSD(t *testing.T) {
+	p := whoBoysWeightAtBirth
+	sd2, sd3 := p.value(2), p.value(3)
+	sdMinus2, sdMinus3 := p.value(-2), p.value(-3)
+
+	tests := []struct {
+		name       string
+		value      float64
+		restricted bool
+		want       float64
+	}{
+		{"at +3 SD", sd3, true, 3},
+		// Restricted: each SD beyond 3 is as wide as the one from 2 to 3
+		{"one more SD above", sd3 + (sd3 - sd2), true, 4},
+		{"one more SD below", sdMinus3 - (sdMinus2 - sdMinus3), true, -4},
+		{"half an SD above", sd3 + (sd3-sd2)/2, true, 3.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, p.ZScore(tt.value, tt.restricted), 1e-9)
+		})
+	}
+	// Unrestricted indicators follow the LMS curve, which is skewed to the right
+	unrestricted := p.ZScore(sd3+(sd3-sd2), false)
+	assert.Greater(t, unrestricted, 3.0)
+	assert.Less(t, unrestricted, 4.0)
+}
+
+func TestGrowthStandardsZScore(t *testing.T) {
+	g := NewGrowthStandards()
+	// Rows are added out of order; the table keeps them sorted
+	g.Add(GrowthLengthForAge, "male", 2, LMS{L: 1, M: 52, S: 0.04})
+	g.Add(GrowthLengthForAge, "male", 0, LMS{L: 1, M: 50, S: 0.04})
+	g.Add(GrowthLengthForAge, "male", 1, LMS{L: 1, M: 51, S: 0.04})
+	// A repeated row replaces the earlier one
+	g.Add(GrowthLengthForAge, "male", 2, LMS{L: 1, M: 52, S: 0.05})
+
+	tests := []struct {
+		name  string
+		sex   string
+		key   float64
+		value float64
+		want  *float64
+	}{
+		{"on a row", "male", 0, 52, floatPtr(1)},
+		{"between rows", "male", 0.5, 50.5, floatPtr(0)},
+		{"replaced row", "male", 2, 57.2, floatPtr(2)},
+		{"rounded to two decimals", "male", 1, 51.1, floatPtr(0.05)},
+		{"before the first row", "male", -1, 50, nil},
+		{"after the last row", "male", 3, 50, nil},
+		{"sex not loaded", "female", 1, 51, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := g.ZScore(GrowthLengthForAge, tt.sex, tt.key, tt.value)
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.InDelta(t, *tt.want, *got, 1e-9)
+		})
+	}
+
+	assert.True(t, g.Has(GrowthLengthForAge))
+	assert.False(t, g.Has(GrowthWeightForAge))
+	var none *GrowthStandards
+	assert.False(t, none.Has(GrowthLengthForAge))
+	assert.Nil(t, none.ZScore(GrowthLengthForAge, "male", 1, 51))
+}
+
+// syntheticStandards have a z-score of weight - 10 on weight-for-length and
+// weight-for-height, and of muac - 14 on MUAC-for-age
+func syntheticStandards() *GrowthStandards {
+	g := NewGrowthStandards()
+	for _, indicator := range []string{GrowthWeightForLength, GrowthWeightForHeight} {
+		g.Add(indicator, "male", 45, LMS{L: 1, M: 10, S: 0.1})
+		g.Add(indicator, "male", 120, LMS{L: 1, M: 10, S: 0.1})
+	}
+	g.Add(GrowthMUACForAge, "male", 91, LMS{L: 1, M: 14, S: 1.0 / 14})
+	g.Add(GrowthMUACForAge, "male", GrowthMaxAgeDays, LMS{L: 1, M: 14, S: 1.0 / 14})
+	return g
+}
+
+func TestAssessGrowth(t *testing.T) {
+	measured := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	boy := func(birth time.Time) *Patient { return &Patient{BirthDate: &birth, Gender: "male"} }
+	oneYear := boy(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC))
+	threeYears := boy(time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC))
+	fourMonths := boy(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name            string
+		standards       *GrowthStandards
+		patient         *Patient
+		vitals          VitalSigns
+		wantHeight      *float64
+		wantWFH         *float64
+		wantMUACZ       *float64
+		wantImplausible []string
+		wantNutrition   string
+	}{
+		{"normal", syntheticStandards(), oneYear, VitalSigns{Weight: floatPtr(9.5), Height: floatPtr(75), LengthPosition: LengthPositionRecumbent},
+			floatPtr(75), floatPtr(-0.5), nil, nil, NutritionNormal},
+		{"standing length under 2 is corrected", syntheticStandards(), oneYear, VitalSigns{Weight: floatPtr(7.5), Height: floatPtr(75), LengthPosition: LengthPositionStanding},
+			floatPtr(75.7), floatPtr(-2.5), nil, nil, NutritionMAM},
+		{"lying height from 2 is corrected", syntheticStandards(), threeYears, VitalSigns{Weight: floatPtr(6.5), Height: floatPtr(95), LengthPosition: LengthPositionRecumbent},
+			floatPtr(94.3), floatPtr(-3.5), nil, nil, NutritionSAM},
+		{"low MUAC", syntheticStandards(), oneYear, VitalSigns{MUAC: floatPtr(11)},
+			nil, nil, floatPtr(-3), nil, NutritionSAM},
+		{"moderate MUAC", syntheticStandards(), oneYear, VitalSigns{MUAC: floatPtr(12), Weight: floatPtr(10), Height: floatPtr(75)},
+			floatPtr(75), floatPtr(0), floatPtr(-2), nil, NutritionMAM},
+		{"oedema leaves out weight-for-length", syntheticStandards(), oneYear, VitalSigns{Weight: floatPtr(10), Height: floatPtr(75), Oedema: true},
+			floatPtr(75), nil, nil, nil, NutritionSAM},
+		{"MUAC under 6 months is not classified", syntheticStandards(), fourMonths, VitalSigns{MUAC: floatPtr(11)},
+			nil, nil, floatPtr(-3), nil, ""},
+		{"implausible weight", syntheticStandards(), oneYear, VitalSigns{Weight: floatPtr(4), Height: floatPtr(75)},
+			floatPtr(75), nil, nil, []string{GrowthWeightForLength}, ""},
+		{"without standards MUAC still classifies", nil, oneYear, VitalSigns{Weight: floatPtr(7.5), Height: floatPtr(75), MUAC: floatPtr(12)},
+			floatPtr(75), nil, nil, nil, NutritionMAM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vitals := tt.vitals
+			vitals.MeasuredAt = measured
+			a, ok := tt.standards.AssessGrowth(&vitals, tt.patient)
+			require.True(t, ok)
+			assertFloatPtr(t, tt.wantHeight, a.Height)
+			assertFloatPtr(t, tt.wantWFH, a.WeightForHeight)
+			assertFloatPtr(t, tt.wantMUACZ, a.MUACForAge)
+			assert.Equal(t, tt.wantImplausible, a.Implausible)
+			assert.Equal(t, tt.wantNutrition, a.Nutrition)
+		})
+	}
+}
+
+func TestAssessGrowthOnlyUnderFive(t *testing.T) {
+	measured := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	birth := func(days int) *time.Time {
+		b := measured.AddDate(0, 0, -days)
+		return &b
+	}
+
+	tests := []struct {
+		name    string
+		patient *Patient
+		want    bool
+	}{
+		{"no patient", nil, false},
+		{"no birth date", &Patient{Gender: "male"}, false},
+		{"sex not recorded", &Patient{BirthDate: birth(100), Gender: "unknown"}, false},
+		{"newborn", &Patient{BirthDate: birth(0), Gender: "female"}, true},
+		{"last day of the standards", &Patient{BirthDate: birth(GrowthMaxAgeDays), Gender: "female"}, true},
+		{"past the standards", &Patient{BirthDate: birth(GrowthMaxAgeDays + 1), Gender: "female"}, false},
+		{"born after the measurement", &Patient{BirthDate: birth(-1), Gender: "female"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := syntheticStandards().AssessGrowth(&VitalSigns{MeasuredAt: measured}, tt.patient)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}
+
+func assertFloatPtr(t *testing.T, want, got *float64) {
+	t.Helper()
+	if want == nil {
+		assert.Nil(t, got)
+		return
+	}
+	require.NotNil(t, got)
+	assert.InDelta(t, *want, *got, 1e-9)
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Relationship of a household member to the head of the household
+const (
+	HouseholdRelationshipHead          = "head"
+	HouseholdRelationshipSpouse        = "spouse"
+	HouseholdRelationshipChild         = "child"
+	HouseholdRelationshipStepchild     = "stepchild"
+	HouseholdRelationshipParent        = "parent"
+	HouseholdRelationshipSibling       = "sibling"
+	HouseholdRelationshipGrandchild    = "grandchild"
+	HouseholdRelationshipGrandparent   = "grandparent"
+	HouseholdRelationshipOtherRelative = "other_relative"
+	HouseholdRelationshipNonRelative   = "non_relative"
+)
+
+// HouseholdRelationships maps each relationship code to its HL7 v3 RoleCode
+var HouseholdRelationships = map[string]string{
+	HouseholdRelationshipHead:          "ONESELF",
+	HouseholdRelationshipSpouse:        "SPS",
+	HouseholdRelationshipChild:         "CHILD",
+	HouseholdRelationshipStepchild:     "STPCHLD",
+	HouseholdRelationshipParent:        "PRN",
+	HouseholdRelationshipSibling:       "SIB",
+	HouseholdRelationshipGrandchild:    "GRNDCHILD",
+	HouseholdRelationshipGrandparent:   "GRPRN",
+	HouseholdRelationshipOtherRelative: "FAMMEMB",
+	HouseholdRelationshipNonRelative:   "ROOM",
+}
+
+// Household groups the patients living together, e.g. a refugee family sharing
+// a shelter. Members are recorded with their relationship to the head of the
+// household; leaving a household ends the membership instead of deleting it.
+type Household struct {
+	BaseModel
+
+	// UNHCR case (family) number shared by the registered members
+	UNHCRCaseNumber string `gorm:"size:50;index" json:"unhcr_case_number,omitempty"`
+
+	// Shared address; camp and block are copied to the current members
+	CampName      string `gorm:"size:100;index" json:"camp_name,omitempty"`
+	BlockNumber   string `gorm:"size:50" json:"block_number,omitempty"`
+	ShelterNumber string `gorm:"size:50" json:"shelter_number,omitempty"`
+	AddressLine1  string `gorm:"type:text" json:"address_line1,omitempty"`
+	District      string `gorm:"size:100" json:"district,omitempty"`
+	Division      string `gorm:"size:100" json:"division,omitempty"`
+	Phone         string `gorm:"size:50" json:"phone,omitempty"`
+
+	Members []HouseholdMember `gorm:"foreignKey:HouseholdID" json:"members,omitempty"`
+}
+
+// TableName overrides the table name
+func (Household) TableName() string {
+	return "households"
+}
+
+// HouseholdMember is a patient's membership of a household
+type HouseholdMember struct {
+	BaseModel
+
+	HouseholdID uint     `gorm:"index;not null" json:"household_id"`
+	PatientID   uint     `gorm:"index;not null" json:"patient_id"`
+	Patient     *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+
+	// Relationship to the head of the household, see HouseholdRelationships
+	Relationship string `gorm:"size:30;not null" json:"relationship"`
+
+	JoinedAt   time.Time  `gorm:"not null" json:"joined_at"`
+	LeftAt     *time.Time `json:"left_at,omitempty"`
+	LeftReason string     `gorm:"type:text" json:"left_reason,omitempty"`
+}
+
+// TableName overrides the table name
+func (HouseholdMember) TableName() string {
+	return "household_members"
+}
+
+// IsCurrent checks if the patient still lives in the household
+func (m *HouseholdMember) IsCurrent() bool {
+	return m.LeftAt == nil
+}
+
+// Leave ends the membership
+func (m *HouseholdMember) Leave(reason string) {
+	now := time.Now()
+	m.LeftAt = &now
+	m.LeftReason = reason
+}
+
+// Head returns the current head of the household, or nil
+func (h *Household) Head() *HouseholdMember {
+	for i := range h.Members {
+		if h.Members[i].IsCurrent() && h.Members[i].Relationship == HouseholdRelationshipHead {
+			return &h.Members[i]
+		}
+	}
+	return nil
+}
+
+// CurrentMember returns the current membership of a patient, or nil
+func (h *Household) CurrentMember(patientID uint) *HouseholdMember {
+	for i := range h.Members {
+		if h.Members[i].IsCurrent() && h.Members[i].PatientID == patientID {
+			return &h.Members[i]
+		}
+	}
+	return nil
+}
+
+// Normalize trims the household fields and upper-cases the case number
+func (h *Household) Normalize() {
+	h.UNHCRCaseNumber = strings.ToUpper(strings.TrimSpace(h.UNHCRCaseNumber))
+	h.CampName = strings.TrimSpace(h.CampName)
+	h.BlockNumber = strings.TrimSpace(h.BlockNumber)
+	h.ShelterNumber = strings.TrimSpace(h.ShelterNumber)
+	for i := range h.Members {
+		h.Members[i].Relationship = strings.ToLower(strings.TrimSpace(h.Members[i].Relationship))
+	}
+}
+
+// Validate checks the relationship codes and that the household has exactly
+// one current head and no patient listed twice
+func (h *Household) Validate() error {
+	heads := 0
+	seen := map[uint]bool{}
+	for _, member := range h.Members {
+		if _, ok := HouseholdRelationships[member.Relationship]; !ok {
+			return ErrInvalidHouseholdRelationship
+		}
+		if !member.IsCurrent() {
+			continue
+		}
+		if seen[member.PatientID] {
+			return ErrDuplicateHouseholdMember
+		}
+		seen[member.PatientID] = true
+		if member.Relationship == HouseholdRelationshipHead {
+			heads++
+		}
+	}
+	if heads != 1 {
+		return ErrHouseholdHeadRequired
+	}
+	return nil
+}
+
+var (
+	ErrInvalidHouseholdRelationship = &ValidationError{Field: "relationship", Message: "Relationship must be one of head, spouse, child, stepchild, parent, sibling, grandchild, grandparent, other_relative, non_relative"}
+	ErrDuplicateHouseholdMember     = &ValidationError{Field: "members", Message: "A patient can only be listed once in a household"}
+	ErrHouseholdHeadRequired        = &ValidationError{Field: "members", Message: "A household must have exactly one head"}
+)
@@ -118,6 +118,11 @@ type LabResult struct {
 	Status string `gorm:"size:50;default:'final'" json:"status"`
 }
 
+// AuditParent returns the lab order the result belongs to
+func (l LabResult) AuditParent() (interface{}, uint) {
+	return &LabOrder{}, l.LabOrderID
+}
+
 // TableName overrides the table name
 func (LabResult) TableName() string {
 	return "lab_results"
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// MRNCounter holds the last MRN sequence number issued by a facility in a
+// period (the year, for MRN formats that contain one; otherwise empty)
+type MRNCounter struct {
+	FacilityCode string    `gorm:"primaryKey;size:20" json:"facility_code"`
+	Period       string    `gorm:"primaryKey;size:10" json:"period"`
+	LastValue    int64     `gorm:"not null" json:"last_value"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName overrides the table name
+func (MRNCounter) TableName() string {
+	return "mrn_counters"
+}
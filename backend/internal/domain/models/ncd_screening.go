@@ -0,0 +1,554 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NCD screening statuses, as the status of its FHIR QuestionnaireResponse
+const (
+	NCDScreeningInProgress = "in-progress" // Part B recorded at the nursing station
+	NCDScreeningCompleted  = "completed"   // Part C recorded at consultation
+)
+
+// Tobacco and alcohol use
+const (
+	UseNever   = "never"
+	UseFormer  = "former"
+	UseCurrent = "current"
+)
+
+// Blood glucose tests
+const (
+	GlucoseFasting = "fasting"
+	GlucoseRandom  = "random"
+)
+
+// Hypertension and diabetes findings of a screening
+const (
+	NCDFindingKnown      = "known"      // diagnosed before
+	NCDFindingSuspected  = "suspected"  // raised at screening, to be confirmed
+	NCDFindingBorderline = "borderline" // high-normal BP or prediabetes
+)
+
+// NCD programs patients are enrolled in
+const (
+	NCDProgramHypertension = "hypertension"
+	NCDProgramDiabetes     = "diabetes"
+)
+
+// Screening outcomes (C-7)
+const (
+	NCDOutcomeEnrol  = "enrol"  // enrol in the NCD program
+	NCDOutcomeRefer  = "refer"  // refer to hospital
+	NCDOutcomeReview = "review" // check again at a later visit
+	NCDOutcomeNoNCD  = "no-ncd" // no NCD found; lifestyle advice
+)
+
+// Modifiable risk factors found at screening
+const (
+	RiskFactorTobacco            = "tobacco"
+	RiskFactorSmokelessTobacco   = "smokeless-tobacco"
+	RiskFactorAlcohol            = "alcohol"
+	RiskFactorLowFruitVegetable  = "low-fruit-vegetable"
+	RiskFactorPhysicalInactivity = "physical-inactivity"
+	RiskFactorExtraSalt          = "extra-salt"
+	RiskFactorOverweight         = "overweight"
+	RiskFactorObesity            = "obesity"
+	RiskFactorCentralObesity     = "central-obesity"
+)
+
+// NCDChecklistItem is an answer of a screening checklist
+type NCDChecklistItem struct {
+	Code    string `json:"code"`
+	Display string `json:"display"`
+	// Urgent warning signs need urgent referral
+	Urgent bool `json:"urgent,omitempty"`
+}
+
+// NCDSymptoms is the symptom checklist (B-2)
+var NCDSymptoms = []NCDChecklistItem{
+	{Code: "chest-pain", Display: "Chest pain"},
+	{Code: "breathlessness", Display: "Shortness of breath"},
+	{Code: "palpitations", Display: "Palpitations"},
+	{Code: "headache", Display: "Headache"},
+	{Code: "dizziness", Display: "Dizziness"},
+	{Code: "blurred-vision", Display: "Blurred vision"},
+	{Code: "excessive-thirst", Display: "Excessive thirst"},
+	{Code: "frequent-urination", Display: "Frequent urination"},
+	{Code: "excessive-hunger", Display: "Excessive hunger"},
+	{Code: "weight-loss", Display: "Unexplained weight loss"},
+	{Code: "tingling-hands-feet", Display: "Numbness or tingling of hands or feet"},
+	{Code: "foot-ulcer", Display: "Foot ulcer or wound not healing"},
+	{Code: "leg-swelling", Display: "Swelling of the legs"},
+	{Code: "chronic-cough", Display: "Cough for more than 2 weeks"},
+	{Code: "wheeze", Display: "Wheezing"},
+	{Code: "fatigue", Display: "Tiredness"},
+}
+
+// NCDFemaleHistory is the female-specific history (B-3)
+var NCDFemaleHistory = []NCDChecklistItem{
+	{Code: "pregnant", Display: "Currently pregnant"},
+	{Code: "gestational-diabetes", Display: "Diabetes in a previous pregnancy"},
+	{Code: "pregnancy-hypertension", Display: "High blood pressure or eclampsia in a previous pregnancy"},
+	{Code: "large-baby", Display: "Baby over 4 kg at birth"},
+	{Code: "breast-lump", Display: "Lump in the breast"},
+	{Code: "post-menopausal-bleeding", Display: "Bleeding after menopause"},
+	{Code: "post-coital-bleeding", Display: "Bleeding after intercourse"},
+}
+
+// NCDWarningSigns are the CVD-focused history questions (B-4), after the
+// WHO PEN protocol. Signs of a heart attack or stroke happening now are urgent.
+var NCDWarningSigns = []NCDChecklistItem{
+	{Code: "chest-pain-exertion", Display: "Pain or discomfort in the chest when walking uphill or hurrying"},
+	{Code: "chest-pain-severe", Display: "Severe chest pain now, lasting half an hour or more", Urgent: true},
+	{Code: "one-sided-weakness", Display: "Sudden weakness or numbness of the face, arm or leg", Urgent: true},
+	{Code: "speech-difficulty", Display: "Sudden difficulty speaking or understanding", Urgent: true},
+	{Code: "vision-loss", Display: "Sudden loss of vision", Urgent: true},
+	{Code: "breathless-lying-flat", Display: "Breathless when lying flat or at night"},
+}
+
+// NCDConditions are the conditions of the family history (B-5), previous
+// medical history (C-1) and final diagnosis (C-5)
+var NCDConditions = []NCDChecklistItem{
+	{Code: "hypertension", Display: "Hypertension"},
+	{Code: "diabetes", Display: "Diabetes"},
+	{Code: "heart-disease", Display: "Heart disease"},
+	{Code: "stroke", Display: "Stroke"},
+	{Code: "kidney-disease", Display: "Chronic kidney disease"},
+	{Code: "asthma", Display: "Asthma"},
+	{Code: "copd", Display: "COPD"},
+	{Code: "cancer", Display: "Cancer"},
+}
+
+// NCDChecklists are the checklists of the screening form, for the form's
+// answer options
+type NCDChecklists struct {
+	Symptoms      []NCDChecklistItem `json:"symptoms"`
+	FemaleHistory []NCDChecklistItem `json:"female_history"`
+	WarningSigns  []NCDChecklistItem `json:"warning_signs"`
+	Conditions    []NCDChecklistItem `json:"conditions"`
+}
+
+var (
+	ErrNCDScreeningExists       = errors.New("encounter already has an NCD screening")
+	ErrNCDScreeningCompleted    = errors.New("NCD screening is completed")
+	ErrNCDScreeningNotCompleted = errors.New("NCD screening is not completed")
+	ErrNCDAlreadyEnrolled       = errors.New("patient was already enrolled from this NCD screening")
+
+	ErrInvalidTobaccoUse     = &ValidationError{Field: "tobacco_use", Message: "Tobacco use must be one of never, former, current"}
+	ErrInvalidAlcoholUse     = &ValidationError{Field: "alcohol_use", Message: "Alcohol use must be one of never, former, current"}
+	ErrInvalidGlucoseTest    = &ValidationError{Field: "glucose_test", Message: "Glucose test must be fasting or random"}
+	ErrGlucoseTestRequired   = &ValidationError{Field: "glucose_test", Message: "Glucose test is required with blood glucose"}
+	ErrNCDFemaleHistory      = &ValidationError{Field: "female_history", Message: "Female history is recorded for female patients only"}
+	ErrInvalidNCDOutcome     = &ValidationError{Field: "outcome", Message: "Outcome must be one of enrol, refer, review, no-ncd"}
+	ErrNCDOutcomeRequired    = &ValidationError{Field: "outcome", Message: "Outcome is required"}
+	ErrNCDEnrolOutcome       = &ValidationError{Field: "outcome", Message: "Only screenings with outcome enrol are enrolled"}
+	ErrInvalidNCDProgram     = &ValidationError{Field: "programs", Message: "Programs must be hypertension or diabetes"}
+	ErrNCDProgramsRequired   = &ValidationError{Field: "programs", Message: "At least one program is required"}
+	ErrNCDProgramDiagnosis   = &ValidationError{Field: "programs", Message: "Patients are enrolled only in programs of the final diagnoses"}
+	ErrNCDVitalSignsNotFound = &ValidationError{Field: "vital_signs_id", Message: "Vital signs must be recorded in this encounter"}
+)
+
+// NCDScreening is the NCD screening form of an encounter: Part B at the
+// nursing station, Part C at consultation and Part D enrolment. Hypertension
+// and diabetes findings, risk factors, the WHO CVD risk and the need for
+// urgent referral are assessed whenever a part is saved.
+type NCDScreening struct {
+	BaseModel
+
+	EncounterID uint `gorm:"uniqueIndex;not null" json:"encounter_id"`
+	PatientID   uint `gorm:"index;not null" json:"patient_id"`
+
+	Status string `gorm:"size:20;index;not null" json:"status"`
+
+	// Part B: nursing station
+	CurrentHistory string   `gorm:"type:text" json:"current_history,omitempty"`                // B-1
+	Symptoms       []string `gorm:"type:text;serializer:json" json:"symptoms,omitempty"`       // B-2, NCDSymptoms
+	FemaleHistory  []string `gorm:"type:text;serializer:json" json:"female_history,omitempty"` // B-3, NCDFemaleHistory
+	WarningSigns   []string `gorm:"type:text;serializer:json" json:"warning_signs,omitempty"`  // B-4, NCDWarningSigns
+	FamilyHistory  []string `gorm:"type:text;serializer:json" json:"family_history,omitempty"` // B-5, NCDConditions
+
+	// B-6: risk factors
+	TobaccoUse              string `gorm:"size:10" json:"tobacco_use,omitempty"`   // smoked
+	SmokelessTobacco        bool   `gorm:"default:false" json:"smokeless_tobacco"` // betel quid, jorda, gul
+	AlcoholUse              string `gorm:"size:10" json:"alcohol_use,omitempty"`
+	FruitVegetableServings  *int   `json:"fruit_vegetable_servings,omitempty"`  // per day
+	PhysicalActivityMinutes *int   `json:"physical_activity_minutes,omitempty"` // moderate activity per week
+	ExtraSalt               bool   `gorm:"default:false" json:"extra_salt"`     // adds salt at the table
+
+	// B-7: vital signs and casual tests. BP, weight and height are copied from
+	// VitalSignsID, or recorded as the encounter's vital signs when entered.
+	VitalSignsID       *uint    `json:"vital_signs_id,omitempty"`
+	SystolicBP         *int     `json:"systolic_bp,omitempty"`
+	DiastolicBP        *int     `json:"diastolic_bp,omitempty"`
+	Weight             *float64 `json:"weight,omitempty"` // kg
+	Height             *float64 `json:"height,omitempty"` // cm
+	BMI                *float64 `json:"bmi,omitempty"`
+	WaistCircumference *float64 `json:"waist_circumference,omitempty"` // cm
+	BloodGlucose       *float64 `json:"blood_glucose,omitempty"`       // mmol/L
+	GlucoseTest        string   `gorm:"size:10" json:"glucose_test,omitempty"`
+
+	ScreenedAt time.Time `gorm:"not null" json:"screened_at"`
+	ScreenedBy uint      `json:"screened_by"`
+
+	// Part C: consultation
+	KnownConditions    []string   `gorm:"type:text;serializer:json" json:"known_conditions,omitempty"` // C-1, NCDConditions
+	CurrentMedications string     `gorm:"type:text" json:"current_medications,omitempty"`
+	ClinicalAssessment string     `gorm:"type:text" json:"clinical_assessment,omitempty"`       // C-2
+	TotalCholesterol   *float64   `json:"total_cholesterol,omitempty"`                          // C-3, mmol/L
+	HbA1c              *float64   `gorm:"column:hba1c" json:"hba1c,omitempty"`                  // %
+	Diagnoses          []string   `gorm:"type:text;serializer:json" json:"diagnoses,omitempty"` // C-5, NCDConditions
+	DiagnosisNotes     string     `gorm:"type:text" json:"diagnosis_notes,omitempty"`
+	ManagementPlan     string     `gorm:"type:text" json:"management_plan,omitempty"` // C-6
+	FollowUpDate       *time.Time `json:"follow_up_date,omitempty"`
+	Outcome            string     `gorm:"size:10" json:"outcome,omitempty"` // C-7
+
+	ConsultedAt *time.Time `json:"consulted_at,omitempty"`
+	ConsultedBy *uint      `json:"consulted_by,omitempty"`
+
+	// Assessment, computed from Parts B and C
+	RiskFactors         []string `gorm:"type:text;serializer:json" json:"risk_factors,omitempty"`
+	HypertensionFinding string   `gorm:"size:20" json:"hypertension_finding,omitempty"`
+	DiabetesFinding     string   `gorm:"size:20" json:"diabetes_finding,omitempty"`
+	// C-4: WHO CVD risk chart used, 10-year risk (%) and its category.
+	// Patients with established CVD are very high risk without a chart.
+	CVDRiskChart    string   `gorm:"column:cvd_risk_chart;size:10" json:"cvd_risk_chart,omitempty"`
+	CVDRisk         *float64 `gorm:"column:cvd_risk" json:"cvd_risk,omitempty"`
+	CVDRiskCategory string   `gorm:"column:cvd_risk_category;size:20" json:"cvd_risk_category,omitempty"`
+	UrgentReferral  bool     `gorm:"default:false" json:"urgent_referral"`
+	ReferralReasons []string `gorm:"type:text;serializer:json" json:"referral_reasons,omitempty"`
+	// Programs the findings and diagnoses call for
+	EnrolmentPrograms []string `gorm:"type:text;serializer:json" json:"enrolment_programs,omitempty"`
+
+	// Part D: enrolment
+	EnrolledPrograms []string   `gorm:"type:text;serializer:json" json:"enrolled_programs,omitempty"`
+	NCDNumber        string     `gorm:"column:ncd_number;size:50;index" json:"ncd_number,omitempty"` // of the NCD book
+	NCDBookIssued    bool       `gorm:"column:ncd_book_issued;default:false" json:"ncd_book_issued"`
+	EnrolledAt       *time.Time `json:"enrolled_at,omitempty"`
+	EnrolledBy       *uint      `json:"enrolled_by,omitempty"`
+}
+
+// TableName overrides the table name
+func (NCDScreening) TableName() string {
+	return "ncd_screenings"
+}
+
+// UseVitalSigns fills the BP, weight and height not entered at screening
+// from a measurement
+func (s *NCDScreening) UseVitalSigns(v *VitalSigns) {
+	s.VitalSignsID = &v.ID
+	if s.SystolicBP == nil {
+		s.SystolicBP = v.SystolicBP
+	}
+	if s.DiastolicBP == nil {
+		s.DiastolicBP = v.DiastolicBP
+	}
+	if s.Weight == nil {
+		s.Weight = v.Weight
+	}
+	if s.Height == nil {
+		s.Height = v.Height
+	}
+}
+
+// HasMeasurements reports whether BP, weight or height were entered
+func (s *NCDScreening) HasMeasurements() bool {
+	return s.SystolicBP != nil || s.DiastolicBP != nil || s.Weight != nil || s.Height != nil
+}
+
+// VitalSigns returns the BP, weight and height entered at screening as a
+// vital signs measurement of the encounter
+func (s *NCDScreening) VitalSigns() *VitalSigns {
+	return &VitalSigns{
+		EncounterID: s.EncounterID,
+		PatientID:   s.PatientID,
+		MeasuredAt:  s.ScreenedAt,
+		SystolicBP:  s.SystolicBP,
+		DiastolicBP: s.DiastolicBP,
+		Weight:      s.Weight,
+		Height:      s.Height,
+		Pregnant:    hasCode(s.FemaleHistory, "pregnant"),
+		RecordedBy:  s.ScreenedBy,
+	}
+}
+
+// Assess computes the screening's assessment for the patient: BMI, risk
+// factors, hypertension and diabetes findings, the CVD risk on charts (when
+// loaded), urgent referral and the programs to enrol in
+func (s *NCDScreening) Assess(patient *Patient, charts *CVDRiskCharts) {
+	s.BMI = nil
+	if s.Weight != nil && s.Height != nil && *s.Height > 0 {
+		m := *s.Height / 100
+		bmi := *s.Weight / (m * m)
+		s.BMI = &bmi
+	}
+
+	s.RiskFactors = s.riskFactors(patient)
+	s.HypertensionFinding = s.hypertensionFinding()
+	s.DiabetesFinding = s.diabetesFinding()
+	s.assessCVDRisk(patient, charts)
+	s.assessReferral()
+
+	s.EnrolmentPrograms = nil
+	if s.HypertensionFinding == NCDFindingKnown || s.HypertensionFinding == NCDFindingSuspected ||
+		hasCode(s.Diagnoses, NCDProgramHypertension) {
+		s.EnrolmentPrograms = append(s.EnrolmentPrograms, NCDProgramHypertension)
+	}
+	if s.DiabetesFinding == NCDFindingKnown || s.DiabetesFinding == NCDFindingSuspected ||
+		hasCode(s.Diagnoses, NCDProgramDiabetes) {
+		s.EnrolmentPrograms = append(s.EnrolmentPrograms, NCDProgramDiabetes)
+	}
+}
+
+// Validate checks the screening's answers for the patient
+func (s *NCDScreening) Validate(patient *Patient) error {
+	checklists := []struct {
+		field string
+		codes []string
+		items []NCDChecklistItem
+	}{
+		{"symptoms", s.Symptoms, NCDSymptoms},
+		{"female_history", s.FemaleHistory, NCDFemaleHistory},
+		{"warning_signs", s.WarningSigns, NCDWarningSigns},
+		{"family_history", s.FamilyHistory, NCDConditions},
+		{"known_conditions", s.KnownConditions, NCDConditions},
+		{"diagnoses", s.Diagnoses, NCDConditions},
+	}
+	for _, c := range checklists {
+		for _, code := range c.codes {
+			if _, ok := findChecklistItem(c.items, code); !ok {
+				return &ValidationError{Field: c.field, Message: fmt.Sprintf("Unknown answer %q", code)}
+			}
+		}
+	}
+	if len(s.FemaleHistory) > 0 && patient.Gender != "female" {
+		return ErrNCDFemaleHistory
+	}
+
+	for _, use := range []struct {
+		value string
+		err   error
+	}{{s.TobaccoUse, ErrInvalidTobaccoUse}, {s.AlcoholUse, ErrInvalidAlcoholUse}} {
+		switch use.value {
+		case "", UseNever, UseFormer, UseCurrent:
+		default:
+			return use.err
+		}
+	}
+
+	switch {
+	case s.GlucoseTest != "" && s.GlucoseTest != GlucoseFasting && s.GlucoseTest != GlucoseRandom:
+		return ErrInvalidGlucoseTest
+	case s.BloodGlucose != nil && s.GlucoseTest == "":
+		return ErrGlucoseTestRequired
+	}
+
+	ranges := []struct {
+		field    string
+		value    *float64
+		min, max float64
+	}{
+		{"systolic_bp", intValue(s.SystolicBP), 50, 300},
+		{"diastolic_bp", intValue(s.DiastolicBP), 20, 200},
+		{"weight", s.Weight, 0.5, 500},
+		{"height", s.Height, 20, 300},
+		{"waist_circumference", s.WaistCircumference, 20, 300},
+		{"blood_glucose", s.BloodGlucose, 0.5, 50},
+		{"total_cholesterol", s.TotalCholesterol, 0.5, 30},
+		{"hba1c", s.HbA1c, 2, 25},
+	}
+	for _, r := range ranges {
+		if r.value != nil && (*r.value < r.min || *r.value > r.max) {
+			return &ValidationError{Field: r.field, Message: fmt.Sprintf("Must be between %g and %g", r.min, r.max)}
+		}
+	}
+
+	switch s.Outcome {
+	case "", NCDOutcomeEnrol, NCDOutcomeRefer, NCDOutcomeReview, NCDOutcomeNoNCD:
+	default:
+		return ErrInvalidNCDOutcome
+	}
+	return nil
+}
+
+// riskFactors lists the modifiable risk factors. BMI and waist cut-offs are
+// the WHO ones, with the South Asian waist cut-offs of the IDF.
+func (s *NCDScreening) riskFactors(patient *Patient) []string {
+	var factors []string
+	add := func(found bool, factor string) {
+		if found {
+			factors = append(factors, factor)
+		}
+	}
+	add(s.TobaccoUse == UseCurrent, RiskFactorTobacco)
+	add(s.SmokelessTobacco, RiskFactorSmokelessTobacco)
+	add(s.AlcoholUse == UseCurrent, RiskFactorAlcohol)
+	add(s.FruitVegetableServings != nil && *s.FruitVegetableServings < 5, RiskFactorLowFruitVegetable)
+	add(s.PhysicalActivityMinutes != nil && *s.PhysicalActivityMinutes < 150, RiskFactorPhysicalInactivity)
+	add(s.ExtraSalt, RiskFactorExtraSalt)
+	if s.BMI != nil {
+		add(*s.BMI >= 30, RiskFactorObesity)
+		add(*s.BMI >= 25 && *s.BMI < 30, RiskFactorOverweight)
+	}
+	if s.WaistCircumference != nil {
+		limit := 90.0
+		if patient.Gender == "female" {
+			limit = 80
+		}
+		add(*s.WaistCircumference >= limit, RiskFactorCentralObesity)
+	}
+	return factors
+}
+
+// hypertensionFinding reads the BP: 140/90 and over is suspected
+// hypertension, 130/85 and over high-normal
+func (s *NCDScreening) hypertensionFinding() string {
+	sbp, dbp := 0, 0
+	if s.SystolicBP != nil {
+		sbp = *s.SystolicBP
+	}
+	if s.DiastolicBP != nil {
+		dbp = *s.DiastolicBP
+	}
+	switch {
+	case hasCode(s.KnownConditions, NCDProgramHypertension):
+		return NCDFindingKnown
+	case sbp >= 140 || dbp >= 90:
+		return NCDFindingSuspected
+	case sbp >= 130 || dbp >= 85:
+		return NCDFindingBorderline
+	default:
+		return ""
+	}
+}
+
+// diabetesFinding reads the glucose and HbA1c on the WHO criteria: fasting
+// 7.0 mmol/L, random 11.1 mmol/L or HbA1c 6.5% and over is suspected
+// diabetes; fasting 6.1 to 6.9 mmol/L or HbA1c 6.0 to 6.4% prediabetes
+func (s *NCDScreening) diabetesFinding() string {
+	if hasCode(s.KnownConditions, NCDProgramDiabetes) {
+		return NCDFindingKnown
+	}
+	fasting := s.BloodGlucose != nil && s.GlucoseTest == GlucoseFasting
+	random := s.BloodGlucose != nil && s.GlucoseTest == GlucoseRandom
+	switch {
+	case fasting && *s.BloodGlucose >= 7.0, random && *s.BloodGlucose >= 11.1, s.HbA1c != nil && *s.HbA1c >= 6.5:
+		return NCDFindingSuspected
+	case fasting && *s.BloodGlucose >= 6.1, s.HbA1c != nil && *s.HbA1c >= 6.0:
+		return NCDFindingBorderline
+	default:
+		return ""
+	}
+}
+
+// assessCVDRisk looks up the 10-year CVD risk on the laboratory chart when
+// the total cholesterol is known, and on the non-laboratory chart otherwise
+func (s *NCDScreening) assessCVDRisk(patient *Patient, charts *CVDRiskCharts) {
+	s.CVDRiskChart, s.CVDRisk, s.CVDRiskCategory = "", nil, ""
+	if hasCode(s.KnownConditions, "heart-disease") || hasCode(s.KnownConditions, "stroke") {
+		s.CVDRiskCategory = CVDRiskVeryHigh
+		return
+	}
+	if s.SystolicBP == nil || patient.BirthDate == nil {
+		return
+	}
+
+	chart, factor := "", 0.0
+	switch {
+	case s.TotalCholesterol != nil && charts.Has(CVDChartLab):
+		chart, factor = CVDChartLab, *s.TotalCholesterol
+	case s.BMI != nil && charts.Has(CVDChartNonLab):
+		chart, factor = CVDChartNonLab, *s.BMI
+	default:
+		return
+	}
+	diabetes := s.DiabetesFinding == NCDFindingKnown || s.DiabetesFinding == NCDFindingSuspected
+	risk, ok := charts.Risk(chart, patient.Gender, diabetes, s.TobaccoUse == UseCurrent, patient.GetAge(), *s.SystolicBP, factor)
+	if !ok {
+		return
+	}
+	s.CVDRiskChart = chart
+	s.CVDRisk = &risk
+	s.CVDRiskCategory = CVDRiskCategory(risk)
+}
+
+// assessReferral looks for urgent warning signs, severe hypertension,
+// raised BP in pregnancy and very low or high glucose
+func (s *NCDScreening) assessReferral() {
+	s.ReferralReasons = nil
+	for _, code := range s.WarningSigns {
+		if sign, _ := findChecklistItem(NCDWarningSigns, code); sign.Urgent {
+			s.ReferralReasons = append(s.ReferralReasons, sign.Display)
+		}
+	}
+	sbp, dbp := 0, 0
+	if s.SystolicBP != nil {
+		sbp = *s.SystolicBP
+	}
+	if s.DiastolicBP != nil {
+		dbp = *s.DiastolicBP
+	}
+	if sbp >= 180 || dbp >= 110 {
+		s.ReferralReasons = append(s.ReferralReasons, fmt.Sprintf("Severe hypertension, BP %d/%d", sbp, dbp))
+	} else if (sbp >= 140 || dbp >= 90) && hasCode(s.FemaleHistory, "pregnant") {
+		s.ReferralReasons = append(s.ReferralReasons, fmt.Sprintf("Raised BP in pregnancy, BP %d/%d", sbp, dbp))
+	}
+	if g := s.BloodGlucose; g != nil && *g < 3 {
+		s.ReferralReasons = append(s.ReferralReasons, fmt.Sprintf("Hypoglycaemia, glucose %.1f mmol/L", *g))
+	} else if g != nil && *g > 18 {
+		s.ReferralReasons = append(s.ReferralReasons, fmt.Sprintf("Severe hyperglycaemia, glucose %.1f mmol/L", *g))
+	}
+	s.UrgentReferral = len(s.ReferralReasons) > 0
+}
+
+// Enrol records the patient's enrolment in NCD programs (Part D).
+// Programs default to those the screening calls for.
+func (s *NCDScreening) Enrol(programs []string, by uint, at time.Time) error {
+	if s.EnrolledAt != nil {
+		return ErrNCDAlreadyEnrolled
+	}
+	if s.Status != NCDScreeningCompleted {
+		return ErrNCDScreeningNotCompleted
+	}
+	if s.Outcome != NCDOutcomeEnrol {
+		return ErrNCDEnrolOutcome
+	}
+	if len(programs) == 0 {
+		programs = s.EnrolmentPrograms
+	}
+	if len(programs) == 0 {
+		return ErrNCDProgramsRequired
+	}
+	for _, program := range programs {
+		if program != NCDProgramHypertension && program != NCDProgramDiabetes {
+			return ErrInvalidNCDProgram
+		}
+		if !hasCode(s.Diagnoses, program) {
+			return ErrNCDProgramDiagnosis
+		}
+	}
+	s.EnrolledPrograms = programs
+	s.EnrolledAt = &at
+	s.EnrolledBy = &by
+	return nil
+}
+
+func findChecklistItem(items []NCDChecklistItem, code string) (NCDChecklistItem, bool) {
+	for _, item := range items {
+		if item.Code == code {
+			return item, true
+		}
+	}
+	return NCDChecklistItem{}, false
+}
+
+func hasCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bornYearsAgo is a patient of the given age and gender
+func bornYearsAgo(years int, gender string) *Patient {
+	birth := time.Now().AddDate(-years, 0, -1)
+	return &Patient{BirthDate: &birth, Gender: gender}
+}
+
+func TestNCDScreeningValidate(t *testing.T) {
+	man := bornYearsAgo(50, "male")
+	woman := bornYearsAgo(50, "female")
+
+	tests := []struct {
+		name      string
+		patient   *Patient
+		screening NCDScreening
+		wantErr   error
+		wantField string
+	}{
+		{"valid", woman, NCDScreening{
+			Symptoms: []string{"headache"}, FemaleHistory: []string{"pregnant"}, TobaccoUse: UseFormer,
+			BloodGlucose: floatPtr(6), GlucoseTest: GlucoseFasting, Outcome: NCDOutcomeReview,
+		}, nil, ""},
+		{"unknown symptom", man, NCDScreening{Symptoms: []string{"fever"}}, nil, "symptoms"},
+		{"unknown diagnosis", man, NCDScreening{Diagnoses: []string{"gout"}}, nil, "diagnoses"},
+		{"female history of a man", man, NCDScreening{FemaleHistory: []string{"large-baby"}}, ErrNCDFemaleHistory, ""},
+		{"tobacco use", man, NCDScreening{TobaccoUse: "daily"}, ErrInvalidTobaccoUse, ""},
+		{"alcohol use", man, NCDScreening{AlcoholUse: "sometimes"}, ErrInvalidAlcoholUse, ""},
+		{"glucose without test", man, NCDScreening{BloodGlucose: floatPtr(8)}, ErrGlucoseTestRequired, ""},
+		{"glucose test", man, NCDScreening{GlucoseTest: "hba1c"}, ErrInvalidGlucoseTest, ""},
+		{"systolic out of range", man, NCDScreening{SystolicBP: intPtr(400)}, nil, "systolic_bp"},
+		{"cholesterol out of range", man, NCDScreening{TotalCholesterol: floatPtr(40)}, nil, "total_cholesterol"},
+		{"outcome", man, NCDScreening{Outcome: "discharge"}, ErrInvalidNCDOutcome, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.screening.Validate(tt.patient)
+			switch {
+			case tt.wantErr != nil:
+				assert.Equal(t, tt.wantErr, err)
+			case tt.wantField != "":
+				var validation *ValidationError
+				require.ErrorAs(t, err, &validation)
+				assert.Equal(t, tt.wantField, validation.Field)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNCDScreeningFindings(t *testing.T) {
+	man := bornYearsAgo(50, "male")
+
+	tests := []struct {
+		name                  string
+		screening             NCDScreening
+		hypertension, glucose string
+		programs              []string
+	}{
+		{"normal", NCDScreening{SystolicBP: intPtr(120), DiastolicBP: intPtr(80), BloodGlucose: floatPtr(5), GlucoseTest: GlucoseFasting}, "", "", nil},
+		{"high-normal BP and prediabetes", NCDScreening{SystolicBP: intPtr(132), DiastolicBP: intPtr(80), BloodGlucose: floatPtr(6.5), GlucoseTest: GlucoseFasting},
+			NCDFindingBorderline, NCDFindingBorderline, nil},
+		{"raised diastolic", NCDScreening{SystolicBP: intPtr(130), DiastolicBP: intPtr(92)}, NCDFindingSuspected, "", []string{NCDProgramHypertension}},
+		{"random glucose", NCDScreening{BloodGlucose: floatPtr(11.1), GlucoseTest: GlucoseRandom}, "", NCDFindingSuspected, []string{NCDProgramDiabetes}},
+		{"random glucose below the cut-off", NCDScreening{BloodGlucose: floatPtr(9), GlucoseTest: GlucoseRandom}, "", "", nil},
+		{"HbA1c", NCDScreening{HbA1c: floatPtr(6.2)}, "", NCDFindingBorderline, nil},
+		{"known conditions", NCDScreening{KnownConditions: []string{"hypertension", "diabetes"}, SystolicBP: intPtr(118)},
+			NCDFindingKnown, NCDFindingKnown, []string{NCDProgramHypertension, NCDProgramDiabetes}},
+		{"diagnosed at consultation", NCDScreening{Diagnoses: []string{"diabetes"}}, "", "", []string{NCDProgramDiabetes}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.screening
+			s.Assess(man, nil)
+			assert.Equal(t, tt.hypertension, s.HypertensionFinding)
+			assert.Equal(t, tt.glucose, s.DiabetesFinding)
+			assert.Equal(t, tt.programs, s.EnrolmentPrograms)
+		})
+	}
+}
+
+func TestNCDScreeningRiskFactors(t *testing.T) {
+	s := NCDScreening{
+		TobaccoUse: UseCurrent, SmokelessTobacco: true, AlcoholUse: UseFormer,
+		FruitVegetableServings: intPtr(2), PhysicalActivityMinutes: intPtr(150), ExtraSalt: true,
+		Weight: floatPtr(72), Height: floatPtr(160), WaistCircumference: floatPtr(85),
+	}
+	s.Assess(bornYearsAgo(50, "female"), nil)
+	require.NotNil(t, s.BMI)
+	assert.InDelta(t, 28.1, *s.BMI, 0.05)
+	assert.Equal(t, []string{RiskFactorTobacco, RiskFactorSmokelessTobacco, RiskFactorLowFruitVegetable,
+		RiskFactorExtraSalt, RiskFactorOverweight, RiskFactorCentralObesity}, s.RiskFactors)
+
+	// The waist cut-off is higher for men
+	s.Assess(bornYearsAgo(50, "male"), nil)
+	assert.NotContains(t, s.RiskFactors, RiskFactorCentralObesity)
+}
+
+func TestNCDScreeningReferral(t *testing.T) {
+	woman := bornYearsAgo(30, "female")
+
+	tests := []struct {
+		name      string
+		screening NCDScreening
+		reasons   []string
+	}{
+		{"none", NCDScreening{SystolicBP: intPtr(150), DiastolicBP: intPtr(95), WarningSigns: []string{"chest-pain-exertion"}}, nil},
+		{"stroke signs", NCDScreening{WarningSigns: []string{"one-sided-weakness", "speech-difficulty"}},
+			[]string{"Sudden weakness or numbness of the face, arm or leg", "Sudden difficulty speaking or understanding"}},
+		{"severe hypertension", NCDScreening{SystolicBP: intPtr(185), DiastolicBP: intPtr(100)}, []string{"Severe hypertension, BP 185/100"}},
+		{"raised BP in pregnancy", NCDScreening{SystolicBP: intPtr(142), DiastolicBP: intPtr(88), FemaleHistory: []string{"pregnant"}},
+			[]string{"Raised BP in pregnancy, BP 142/88"}},
+		{"hypoglycaemia", NCDScreening{BloodGlucose: floatPtr(2.5), GlucoseTest: GlucoseRandom}, []string{"Hypoglycaemia, glucose 2.5 mmol/L"}},
+		{"severe hyperglycaemia", NCDScreening{BloodGlucose: floatPtr(22), GlucoseTest: GlucoseRandom}, []string{"Severe hyperglycaemia, glucose 22.0 mmol/L"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.screening
+			s.Assess(woman, nil)
+			assert.Equal(t, tt.reasons, s.ReferralReasons)
+			assert.Equal(t, len(tt.reasons) > 0, s.UrgentReferral)
+		})
+	}
+}
+
+func TestNCDScreeningCVDRisk(t *testing.T) {
+	charts := testCVDRiskCharts()
+	man := bornYearsAgo(55, "male")
+
+	// Cholesterol selects the laboratory chart, with diabetes from the findings
+	s := NCDScreening{SystolicBP: intPtr(150), TotalCholesterol: floatPtr(6.5), BloodGlucose: floatPtr(8), GlucoseTest: GlucoseFasting}
+	s.Assess(man, charts)
+	assert.Equal(t, CVDChartLab, s.CVDRiskChart)
+	require.NotNil(t, s.CVDRisk)
+	assert.Equal(t, 56.0, *s.CVDRisk)
+	assert.Equal(t, CVDRiskVeryHigh, s.CVDRiskCategory)
+
+	// Without cholesterol the BMI selects the non-laboratory chart
+	s = NCDScreening{SystolicBP: intPtr(130), Weight: floatPtr(60), Height: floatPtr(170), TobaccoUse: UseCurrent}
+	s.Assess(man, charts)
+	assert.Equal(t, CVDChartNonLab, s.CVDRiskChart)
+	require.NotNil(t, s.CVDRisk)
+	assert.Equal(t, 30.0, *s.CVDRisk)
+
+	// No risk without charts, BP, a known age or outside the charts' ages
+	for name, tt := range map[string]struct {
+		patient *Patient
+		charts  *CVDRiskCharts
+		sbp     *int
+	}{
+		"no charts":   {man, nil, intPtr(150)},
+		"no BP":       {man, charts, nil},
+		"unknown age": {&Patient{Gender: "male"}, charts, intPtr(150)},
+		"too young":   {bornYearsAgo(35, "male"), charts, intPtr(150)},
+	} {
+		s = NCDScreening{SystolicBP: tt.sbp, TotalCholesterol: floatPtr(5)}
+		s.Assess(tt.patient, tt.charts)
+		assert.Nil(t, s.CVDRisk, name)
+		assert.Empty(t, s.CVDRiskCategory, name)
+	}
+
+	// Established CVD is very high risk without a chart
+	s = NCDScreening{KnownConditions: []string{"stroke"}}
+	s.Assess(man, nil)
+	assert.Nil(t, s.CVDRisk)
+	assert.Equal(t, CVDRiskVeryHigh, s.CVDRiskCategory)
+}
+
+func TestNCDScreeningEnrol(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	completed := func() *NCDScreening {
+		return &NCDScreening{
+			Status: NCDScreeningCompleted, Outcome: NCDOutcomeEnrol,
+			Diagnoses: []string{"hypertension"}, EnrolmentPrograms: []string{NCDProgramHypertension},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func(s *NCDScreening)
+		programs []string
+		wantErr  error
+	}{
+		{"programs called for", nil, nil, nil},
+		{"in progress", func(s *NCDScreening) { s.Status = NCDScreeningInProgress }, nil, ErrNCDScreeningNotCompleted},
+		{"referred", func(s *NCDScreening) { s.Outcome = NCDOutcomeRefer }, nil, ErrNCDEnrolOutcome},
+		{"already enrolled", func(s *NCDScreening) { s.EnrolledAt = &at }, nil, ErrNCDAlreadyEnrolled},
+		{"nothing to enrol in", func(s *NCDScreening) { s.EnrolmentPrograms = nil }, nil, ErrNCDProgramsRequired},
+		{"unknown program", nil, []string{"asthma"}, ErrInvalidNCDProgram},
+		{"program not diagnosed", nil, []string{NCDProgramDiabetes}, ErrNCDProgramDiagnosis},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := completed()
+			if tt.change != nil {
+				tt.change(s)
+			}
+			err := s.Enrol(tt.programs, 3, at)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{NCDProgramHypertension}, s.EnrolledPrograms)
+			assert.True(t, at.Equal(*s.EnrolledAt))
+			assert.Equal(t, uint(3), *s.EnrolledBy)
+		})
+	}
+}
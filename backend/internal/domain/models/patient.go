@@ -1,7 +1,10 @@
 package models
 
 import (
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Patient represents a FHIR R4-compliant patient record with Bangladesh-specific extensions
@@ -12,11 +15,21 @@ type Patient struct {
 	Active bool   `gorm:"default:true" json:"active"`
 	MRN    string `gorm:"size:64;uniqueIndex;not null" json:"mrn"` // Medical Record Number
 
+	// Set when this record was merged into another patient; the MRN then resolves to that patient
+	MergedIntoID *uint `gorm:"index" json:"merged_into_id,omitempty"`
+
 	// Name (FHIR HumanName)
 	GivenName  string `gorm:"size:100" json:"given_name"`  // First name
 	FamilyName string `gorm:"size:100" json:"family_name"` // Last name
 	MiddleName string `gorm:"size:100" json:"middle_name,omitempty"`
 
+	// Phonetic keys of the name parts, maintained on save for duplicate detection
+	// and name search
+	NameKey string `gorm:"size:255;index" json:"-"`
+
+	// Romanized, normalized full name, maintained on save for trigram name search
+	SearchName string `gorm:"size:300" json:"-"`
+
 	// Demographics
 	Gender    string     `gorm:"size:20" json:"gender"` // male, female, other, unknown
 	BirthDate *time.Time `json:"birth_date"`
@@ -24,7 +37,11 @@ type Patient struct {
 	// Bangladesh-specific: Nationality
 	Nationality string `gorm:"size:50;index" json:"nationality"` // bangladeshi, rohingya, other
 
-	// Conditional fields based on nationality
+	// Identifiers (FHIR Identifier); see IdentifierSystems for the registered systems
+	Identifiers []PatientIdentifier `gorm:"foreignKey:PatientID" json:"identifiers,omitempty"`
+
+	// Legacy identifier columns, kept in step with the current identifier of
+	// their system by SyncIdentifiers for clients that still use them
 	// For Bangladeshi citizens
 	NationalID string `gorm:"size:50;index" json:"national_id,omitempty"` // NID number
 	BirthRegNo string `gorm:"size:50" json:"birth_reg_no,omitempty"`      // Birth registration number
@@ -53,6 +70,10 @@ type Patient struct {
 	Occupation    string `gorm:"size:100" json:"occupation,omitempty"`
 	Religion      string `gorm:"size:50" json:"religion,omitempty"` // islam, hinduism, buddhism, christianity, other
 
+	// Mother, linking a child to her record for immunization and MNCH follow-up;
+	// set through PUT /patients/:id/mother
+	MotherID *uint `gorm:"index" json:"mother_id,omitempty"`
+
 	// Emergency contact
 	EmergencyContactName     string `gorm:"size:200" json:"emergency_contact_name,omitempty"`
 	EmergencyContactPhone    string `gorm:"size:50" json:"emergency_contact_phone,omitempty"`
@@ -83,6 +104,15 @@ func (Patient) TableName() string {
 	return "patients"
 }
 
+// BeforeSave keeps NameKey and SearchName in step with the name and the legacy
+// identifier columns in step with Identifiers
+func (p *Patient) BeforeSave(tx *gorm.DB) error {
+	p.NameKey = strings.Join(NameTokenKeys(p.GivenName, p.MiddleName, p.FamilyName), " ")
+	p.SearchName = SearchName(p.GivenName, p.MiddleName, p.FamilyName)
+	p.SyncIdentifiers()
+	return nil
+}
+
 // IsRohingya checks if the patient is a Rohingya refugee
 func (p *Patient) IsRohingya() bool {
 	return p.Nationality == "rohingya"
@@ -120,28 +150,15 @@ func (p *Patient) Validate() error {
 		return ErrNationalityRequired
 	}
 
-	// Validate Bangladeshi-specific fields
-	if p.IsBangladeshi() {
-		if p.NationalID == "" && p.BirthRegNo == "" {
-			return ErrBangladeshiIDRequired
-		}
-	}
-
-	// Validate Rohingya-specific fields
-	if p.IsRohingya() {
-		if p.UNHCRNumber == "" {
-			return ErrRohingyaUNHCRRequired
-		}
-	}
-
-	return nil
+	// Identifier formats and the identifiers each nationality requires
+	return p.validateIdentifiers()
 }
 
 // Custom errors
 var (
 	ErrNationalityRequired   = &ValidationError{Field: "nationality", Message: "Nationality is required"}
 	ErrBangladeshiIDRequired = &ValidationError{Field: "national_id", Message: "National ID or Birth Registration Number is required for Bangladeshi citizens"}
-	ErrRohingyaUNHCRRequired = &ValidationError{Field: "unhcr_number", Message: "UNHCR number is required for Rohingya refugees"}
+	ErrRohingyaIDRequired    = &ValidationError{Field: "unhcr_number", Message: "UNHCR number, MoHA smart card number or FCN is required for Rohingya refugees"}
 )
 
 type ValidationError struct {
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// Duplicate review statuses
+const (
+	DuplicateStatusOpen      = "open"
+	DuplicateStatusDismissed = "dismissed"
+	DuplicateStatusMerged    = "merged"
+)
+
+// Duplicate match levels
+const (
+	DuplicateLevelProbable = "probable"
+	DuplicateLevelPossible = "possible"
+)
+
+// PatientDuplicate is a pair of patient records the master patient index
+// considers likely to be the same person, queued for review by registration staff
+type PatientDuplicate struct {
+	BaseModel
+
+	// The newer registration and the existing record it matched
+	PatientID   uint     `gorm:"uniqueIndex:idx_patient_duplicate_pair;not null" json:"patient_id"`
+	Patient     *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+	CandidateID uint     `gorm:"uniqueIndex:idx_patient_duplicate_pair;index;not null" json:"candidate_id"`
+	Candidate   *Patient `gorm:"foreignKey:CandidateID" json:"candidate,omitempty"`
+
+	// Match score between 0 and 1, its level (probable, possible) and the
+	// fields that contributed to it
+	Score   float64 `gorm:"not null;index" json:"score"`
+	Level   string  `gorm:"size:20;not null" json:"level"`
+	Reasons string  `gorm:"type:text" json:"reasons"`
+
+	// Review: open, dismissed, merged
+	Status     string     `gorm:"size:20;not null;default:'open';index" json:"status"`
+	ReviewedBy *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote string     `gorm:"type:text" json:"review_note,omitempty"`
+}
+
+// TableName overrides the table name
+func (PatientDuplicate) TableName() string {
+	return "patient_duplicates"
+}
@@ -0,0 +1,390 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identifier systems (FHIR Identifier.system) known to the registry
+const (
+	IdentifierSystemMRN        = "urn:zarish-his:mrn"
+	IdentifierSystemNationalID = "urn:zarish-his:bd-nid"
+	IdentifierSystemBirthReg   = "urn:zarish-his:bd-birth-registration"
+	IdentifierSystemUNHCR      = "urn:zarish-his:unhcr"
+	IdentifierSystemFCN        = "urn:zarish-his:rohingya-fcn"
+	IdentifierSystemSmartCard  = "urn:zarish-his:moha-smart-card"
+)
+
+// PatientIdentifier is one identifier of a patient (FHIR Identifier). A patient
+// can hold any number of them, from any system, including ones that have expired.
+type PatientIdentifier struct {
+	BaseModel
+
+	PatientID uint   `gorm:"not null;index" json:"patient_id"`
+	System    string `gorm:"size:255;not null;index:idx_patient_identifiers_value,priority:1" json:"system"`
+	Value     string `gorm:"size:100;not null;index:idx_patient_identifiers_value,priority:2" json:"value"`
+	Type      string `gorm:"size:20" json:"type,omitempty"` // HL7 v2-0203 identifier type, e.g. MR, NI
+	Use       string `gorm:"size:20" json:"use,omitempty"`  // usual, official, temp, secondary, old
+
+	// Period during which the identifier is valid
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+
+	// Organization that issued the identifier
+	Assigner string `gorm:"size:200" json:"assigner,omitempty"`
+}
+
+// TableName overrides the table name
+func (PatientIdentifier) TableName() string {
+	return "patient_identifiers"
+}
+
+// IsCurrent reports whether the identifier is valid at t
+func (i *PatientIdentifier) IsCurrent(t time.Time) bool {
+	return i.Use != "old" &&
+		(i.PeriodStart == nil || !i.PeriodStart.After(t)) &&
+		(i.PeriodEnd == nil || i.PeriodEnd.After(t))
+}
+
+// IdentifierSystem describes an identifier system: how its values are written
+// and checked, and which legacy patient column mirrors it
+type IdentifierSystem struct {
+	Code     string `json:"code"` // short name accepted by the API
+	System   string `json:"system"`
+	Type     string `json:"type,omitempty"`
+	Display  string `json:"display"`
+	Assigner string `json:"assigner,omitempty"`
+	Format   string `json:"format,omitempty"` // human readable description of valid values
+
+	// Column is the patients column kept in step with this system, if any
+	Column string `json:"-"`
+
+	digitsOnly bool
+	validate   func(value string) error
+}
+
+// IdentifierSystems is the registry of identifier systems the HIS issues or accepts
+var IdentifierSystems = []*IdentifierSystem{
+	{
+		Code: "mrn", System: IdentifierSystemMRN, Type: "MR", Display: "Medical record number",
+		Column: "mrn",
+	},
+	{
+		Code: "nid", System: IdentifierSystemNationalID, Type: "NI", Display: "Bangladesh national ID",
+		Assigner: "Bangladesh Election Commission", Format: "10 digits (smart card), or 13 or 17 digits (older cards)",
+		Column: "national_id", digitsOnly: true, validate: validateNationalID,
+	},
+	{
+		Code: "brn", System: IdentifierSystemBirthReg, Type: "BCT", Display: "Birth registration number",
+		Assigner: "Office of the Registrar General, Birth and Death Registration", Format: "17 digits starting with the year of birth",
+		Column: "birth_reg_no", digitsOnly: true, validate: validateBirthRegNo,
+	},
+	{
+		Code: "unhcr", System: IdentifierSystemUNHCR, Display: "UNHCR progress number",
+		Assigner: "UNHCR", Format: "office, year and case number such as 386-17C012345, or an individual number such as 386-00012345",
+		Column: "unhcr_number", validate: matchFormat(`^[0-9]{3}-([0-9]{2}[A-Z][0-9]{5,6}|[0-9]{8})$`),
+	},
+	{
+		Code: "fcn", System: IdentifierSystemFCN, Display: "Family counting number",
+		Assigner: "Refugee Relief and Repatriation Commissioner", Format: "5 to 8 digits",
+		digitsOnly: true, validate: matchFormat(`^[0-9]{5,8}$`),
+	},
+	{
+		Code: "smartcard", System: IdentifierSystemSmartCard, Display: "MoHA/UNHCR smart card number",
+		Assigner: "Ministry of Home Affairs", Format: "12 digits",
+		digitsOnly: true, validate: matchFormat(`^[0-9]{12}$`),
+	},
+}
+
+// identifierUses are the FHIR Identifier.use codes
+var identifierUses = map[string]bool{"": true, "usual": true, "official": true, "temp": true, "secondary": true, "old": true}
+
+// NationalityIdentifiers lists, per nationality, the identifier systems of
+// which a patient must hold at least one current identifier
+var NationalityIdentifiers = map[string][]string{
+	"bangladeshi": {IdentifierSystemNationalID, IdentifierSystemBirthReg},
+	"rohingya":    {IdentifierSystemUNHCR, IdentifierSystemSmartCard, IdentifierSystemFCN},
+}
+
+// FindIdentifierSystem looks up a registered system by URI or short code
+func FindIdentifierSystem(system string) *IdentifierSystem {
+	for _, s := range IdentifierSystems {
+		if s.System == system || strings.EqualFold(s.Code, system) {
+			return s
+		}
+	}
+	return nil
+}
+
+// IdentifierLookupValues returns the spellings a value of unknown system can be
+// stored under: its normalized form in each registered system
+func IdentifierLookupValues(value string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, s := range append([]*IdentifierSystem{nil}, IdentifierSystems...) {
+		if v := s.Normalize(value); v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Normalize returns the canonical spelling of a value: digits only for
+// numeric systems, upper case without spaces for the others. Values of
+// unregistered systems (nil) are only trimmed.
+func (s *IdentifierSystem) Normalize(value string) string {
+	if s == nil {
+		return strings.TrimSpace(value)
+	}
+	if s.digitsOnly {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, value)
+	}
+	return strings.ToUpper(strings.Join(strings.Fields(value), ""))
+}
+
+// NormalizeSQL is the SQL equivalent of Normalize applied to column
+func (s *IdentifierSystem) NormalizeSQL(column string) string {
+	if s.digitsOnly {
+		return "regexp_replace(" + column + `, '\D', '', 'g')`
+	}
+	return "upper(regexp_replace(" + column + `, '\s', '', 'g'))`
+}
+
+// Validate checks a normalized value against the system's format
+func (s *IdentifierSystem) Validate(value string) error {
+	if value == "" {
+		return &ValidationError{Field: "identifiers", Message: s.Display + " is empty"}
+	}
+	if s.validate == nil {
+		return nil
+	}
+	if err := s.validate(value); err != nil {
+		message := fmt.Sprintf("Invalid %s %q: %v", s.Display, value, err)
+		if s.Format != "" {
+			message += " (expected " + s.Format + ")"
+		}
+		return &ValidationError{Field: "identifiers", Message: message}
+	}
+	return nil
+}
+
+func matchFormat(pattern string) func(string) error {
+	re := regexp.MustCompile(pattern)
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return fmt.Errorf("wrong format")
+		}
+		return nil
+	}
+}
+
+// validateNationalID checks the structure of a Bangladesh NID. The NID has no
+// published check digit; the 17 digit form starts with the year of birth,
+// which is checked instead.
+func validateNationalID(value string) error {
+	switch len(value) {
+	case 10, 13:
+		return nil
+	case 17:
+		return checkBirthYear(value[:4])
+	}
+	return fmt.Errorf("must have 10, 13 or 17 digits")
+}
+
+// validateBirthRegNo checks a 17 digit birth registration number, which starts
+// with the year of birth
+func validateBirthRegNo(value string) error {
+	if len(value) != 17 {
+		return fmt.Errorf("must have 17 digits")
+	}
+	return checkBirthYear(value[:4])
+}
+
+func checkBirthYear(digits string) error {
+	year, _ := strconv.Atoi(digits)
+	if year < 1900 || year > time.Now().Year() {
+		return fmt.Errorf("does not start with a valid year of birth")
+	}
+	return nil
+}
+
+// identifierColumn is a legacy patient column mirroring an identifier system
+type identifierColumn struct {
+	system string
+	value  *string
+}
+
+func (p *Patient) identifierColumns() []identifierColumn {
+	return []identifierColumn{
+		{IdentifierSystemNationalID, &p.NationalID},
+		{IdentifierSystemBirthReg, &p.BirthRegNo},
+		{IdentifierSystemUNHCR, &p.UNHCRNumber},
+	}
+}
+
+// SyncIdentifiers makes Identifiers the source of truth. A patient submitted
+// with only the legacy columns (national_id, birth_reg_no, unhcr_number) gets
+// identifiers built from them; values are normalized, the MRN is added, and
+// the legacy columns are then filled from the current identifiers.
+func (p *Patient) SyncIdentifiers() {
+	if len(p.Identifiers) == 0 {
+		for _, column := range p.identifierColumns() {
+			if strings.TrimSpace(*column.value) != "" {
+				p.Identifiers = append(p.Identifiers, NewPatientIdentifier(column.system, *column.value))
+			}
+		}
+	}
+
+	hasMRN := false
+	for i := range p.Identifiers {
+		id := &p.Identifiers[i]
+		system := FindIdentifierSystem(id.System)
+		if system != nil {
+			id.System = system.System
+			if id.Type == "" {
+				id.Type = system.Type
+			}
+			if id.Assigner == "" {
+				id.Assigner = system.Assigner
+			}
+		}
+		id.Value = system.Normalize(id.Value)
+		if id.System == IdentifierSystemMRN && id.Value == p.MRN {
+			hasMRN = true
+		}
+	}
+	if p.MRN != "" && !hasMRN {
+		mrn := NewPatientIdentifier(IdentifierSystemMRN, p.MRN)
+		mrn.Use = "usual"
+		p.Identifiers = append(p.Identifiers, mrn)
+	}
+
+	now := time.Now()
+	for _, column := range p.identifierColumns() {
+		*column.value = ""
+		for _, id := range p.Identifiers {
+			if id.System == column.system && id.IsCurrent(now) {
+				*column.value = id.Value
+				break
+			}
+		}
+	}
+}
+
+// ApplyIdentifierColumns carries the stored identifiers over to an update that
+// was submitted with only the legacy columns. A changed column replaces the
+// identifier of its system; a cleared column removes it.
+func (p *Patient) ApplyIdentifierColumns(stored []PatientIdentifier) {
+	if p.Identifiers != nil {
+		return
+	}
+	now := time.Now()
+	changed := map[string]bool{}
+	var added []PatientIdentifier
+	for _, column := range p.identifierColumns() {
+		value := FindIdentifierSystem(column.system).Normalize(*column.value)
+		current := ""
+		for _, id := range stored {
+			if id.System == column.system && id.IsCurrent(now) {
+				current = id.Value
+				break
+			}
+		}
+		if value == current {
+			continue
+		}
+		changed[column.system] = true
+		if value != "" {
+			added = append(added, NewPatientIdentifier(column.system, value))
+		}
+	}
+
+	p.Identifiers = []PatientIdentifier{}
+	for _, id := range stored {
+		if !changed[id.System] || !id.IsCurrent(now) {
+			p.Identifiers = append(p.Identifiers, id)
+		}
+	}
+	p.Identifiers = append(p.Identifiers, added...)
+}
+
+// NewPatientIdentifier returns an identifier of a registered or external system
+func NewPatientIdentifier(system, value string) PatientIdentifier {
+	id := PatientIdentifier{System: system, Value: strings.TrimSpace(value)}
+	if s := FindIdentifierSystem(system); s != nil {
+		id.System = s.System
+		id.Type = s.Type
+		id.Assigner = s.Assigner
+		id.Value = s.Normalize(value)
+	}
+	return id
+}
+
+// validateIdentifiers checks the identifiers and the per-nationality rules.
+// Only identifiers not yet on file are checked against their system's format,
+// so records registered before a rule existed remain editable.
+func (p *Patient) validateIdentifiers() error {
+	identifiers := p.Identifiers
+	if len(identifiers) == 0 {
+		for _, column := range p.identifierColumns() {
+			if strings.TrimSpace(*column.value) != "" {
+				identifiers = append(identifiers, NewPatientIdentifier(column.system, *column.value))
+			}
+		}
+	}
+
+	now := time.Now()
+	held := map[string]bool{}
+	seen := map[string]bool{}
+	for _, id := range identifiers {
+		system := FindIdentifierSystem(id.System)
+		if system == nil {
+			if !strings.Contains(id.System, ":") {
+				return &ValidationError{Field: "identifiers", Message: fmt.Sprintf("Unknown identifier system %q", id.System)}
+			}
+		} else if id.ID == 0 && system.System != IdentifierSystemMRN {
+			if err := system.Validate(system.Normalize(id.Value)); err != nil {
+				return err
+			}
+		}
+		if !identifierUses[id.Use] {
+			return &ValidationError{Field: "identifiers", Message: fmt.Sprintf("Invalid identifier use %q", id.Use)}
+		}
+		if system != nil {
+			id.System = system.System
+		}
+		key := id.System + "|" + system.Normalize(id.Value)
+		if seen[key] {
+			return &ValidationError{Field: "identifiers", Message: fmt.Sprintf("Identifier %s is listed twice", id.Value)}
+		}
+		seen[key] = true
+		if id.PeriodStart != nil && id.PeriodEnd != nil && id.PeriodEnd.Before(*id.PeriodStart) {
+			return &ValidationError{Field: "identifiers", Message: fmt.Sprintf("Identifier %s ends before it starts", id.Value)}
+		}
+		if id.IsCurrent(now) {
+			held[id.System] = true
+		}
+	}
+
+	if required, ok := NationalityIdentifiers[p.Nationality]; ok {
+		for _, system := range required {
+			if held[system] {
+				return nil
+			}
+		}
+		if p.IsRohingya() {
+			return ErrRohingyaIDRequired
+		}
+		return ErrBangladeshiIDRequired
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// patientMergeModels are the models whose patient_id is moved from the
+// duplicate to the survivor when two patient records are merged
+var patientMergeModels = []tabler{
+	Encounter{},
+	Appointment{},
+	Prescription{},
+	LabOrder{},
+	VitalSigns{},
+	ClinicalNote{},
+	Invoice{},
+	InsuranceClaim{},
+	Admission{},
+	Dispensing{},
+	ImagingStudy{},
+	PortalDelegation{},
+	User{},
+	HouseholdMember{},
+	Consent{},
+	Triage{},
+	QueueToken{},
+	EarlyWarningAlert{},
+	NCDScreening{},
+	ProgramEnrolment{},
+	ProgramVisit{},
+	QuestionnaireSubmission{},
+	QuestionnaireObservation{},
+	PatientIdentifier{},
+	PatientPhoto{},
+}
+
+// PatientMergeTables are the tables of patientMergeModels, named by each
+// model so they cannot drift from the schema
+var PatientMergeTables = tableNames(patientMergeModels)
+
+type tabler interface {
+	TableName() string
+}
+
+func tableNames(models []tabler) []string {
+	names := make([]string, len(models))
+	for i, model := range models {
+		names[i] = model.TableName()
+	}
+	return names
+}
+
+// PatientMergeColumns are the other columns holding a patient ID, as
+// "table.column", moved the same way
+var PatientMergeColumns = []string{
+	"patients.mother_id",
+}
+
+// PatientMergeDuplicates are, by table of patientMergeModels, the SQL
+// condition under which a moved row duplicates a row the survivor already
+// holds, aliased "kept". The merge soft deletes such duplicates, so the
+// survivor's own row wins, and unmerge restores them.
+var PatientMergeDuplicates = map[string]string{
+	PatientIdentifier{}.TableName(): "kept.system = patient_identifiers.system AND kept.value = patient_identifiers.value",
+	// A patient has one current photo; the survivor's is kept
+	PatientPhoto{}.TableName(): "TRUE",
+}
+
+// PatientMerge records that a duplicate patient record was merged into a
+// survivor. The duplicate is kept (inactive, pointing at the survivor) so its
+// MRN still resolves, and the moved rows are listed so the merge can be undone.
+type PatientMerge struct {
+	BaseModel
+
+	SurvivorID uint     `gorm:"index;not null" json:"survivor_id"`
+	Survivor   *Patient `gorm:"foreignKey:SurvivorID" json:"survivor,omitempty"`
+	MergedID   uint     `gorm:"index;not null" json:"merged_id"`
+	Merged     *Patient `gorm:"foreignKey:MergedID" json:"merged,omitempty"`
+	MergedMRN  string   `gorm:"size:64;index;not null" json:"merged_mrn"`
+
+	Reason   string    `gorm:"type:text" json:"reason"`
+	MergedBy uint      `json:"merged_by"`
+	MergedAt time.Time `gorm:"not null" json:"merged_at"`
+
+	// IDs of the rows moved to the survivor, by table, as JSON
+	MovedRecords string `gorm:"type:text" json:"moved_records"`
+	// IDs of the moved rows soft deleted as duplicates, by table, as JSON
+	SupersededRecords string `gorm:"type:text" json:"superseded_records,omitempty"`
+
+	// Unmerge
+	UnmergedAt    *time.Time `json:"unmerged_at,omitempty"`
+	UnmergedBy    *uint      `json:"unmerged_by,omitempty"`
+	UnmergeReason string     `gorm:"type:text" json:"unmerge_reason,omitempty"`
+}
+
+// AuditParent returns the surviving patient, whom merge events are audited under
+func (p PatientMerge) AuditParent() (interface{}, uint) {
+	return &Patient{}, p.SurvivorID
+}
+
+// TableName overrides the table name
+func (PatientMerge) TableName() string {
+	return "patient_merges"
+}
+
+// IsActive checks if the merge has not been undone
+func (m *PatientMerge) IsActive() bool {
+	return m.UnmergedAt == nil
+}
+
+// Moved decodes MovedRecords
+func (m *PatientMerge) Moved() (map[string][]uint, error) {
+	return decodeRecordIDs(m.MovedRecords)
+}
+
+// Superseded decodes SupersededRecords
+func (m *PatientMerge) Superseded() (map[string][]uint, error) {
+	return decodeRecordIDs(m.SupersededRecords)
+}
+
+func decodeRecordIDs(encoded string) (map[string][]uint, error) {
+	ids := map[string][]uint{}
+	if encoded == "" {
+		return ids, nil
+	}
+	err := json.Unmarshal([]byte(encoded), &ids)
+	return ids, err
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+// TestPatientMergeTablesMatchSchema checks that every table moved by a merge
+// is migrated, is the table GORM uses for its model and has a patient_id column
+func TestPatientMergeTablesMatchSchema(t *testing.T) {
+	cache := &sync.Map{}
+	migrated := map[string]bool{}
+	for _, model := range All() {
+		parsed, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		require.NoError(t, err)
+		migrated[parsed.Table] = true
+	}
+
+	seen := map[string]bool{}
+	for i, model := range patientMergeModels {
+		parsed, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		require.NoError(t, err)
+
+		table := PatientMergeTables[i]
+		assert.Equal(t, parsed.Table, table)
+		assert.True(t, migrated[table], "%s is not migrated", table)
+		assert.False(t, seen[table], "%s is listed twice", table)
+		seen[table] = true
+
+		assert.NotNil(t, parsed.LookUpField("patient_id"), "%s has no patient_id column", table)
+		assert.NotNil(t, parsed.LookUpField("updated_at"), "%s has no updated_at column", table)
+	}
+	assert.Contains(t, PatientMergeTables, "dispensing")
+}
+
+func TestPatientMergeColumnsMatchSchema(t *testing.T) {
+	parsed, err := schema.Parse(&Patient{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+	for _, key := range PatientMergeColumns {
+		table, column, _ := strings.Cut(key, ".")
+		assert.Equal(t, parsed.Table, table)
+		assert.NotNil(t, parsed.LookUpField(column), "%s has no %s column", table, column)
+	}
+}
+
+// TestPatientMergeDuplicatesAreMoved checks duplicates are only resolved in
+// tables a merge moves, which are soft deleted
+func TestPatientMergeDuplicatesAreMoved(t *testing.T) {
+	cache := &sync.Map{}
+	for table := range PatientMergeDuplicates {
+		found := false
+		for i, model := range patientMergeModels {
+			if PatientMergeTables[i] != table {
+				continue
+			}
+			found = true
+			parsed, err := schema.Parse(model, cache, schema.NamingStrategy{})
+			require.NoError(t, err)
+			assert.NotNil(t, parsed.LookUpField("deleted_at"), "%s has no deleted_at column", table)
+		}
+		assert.True(t, found, "%s is not moved by a merge", table)
+	}
+}
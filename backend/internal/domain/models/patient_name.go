@@ -0,0 +1,99 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Romanized Bangla and Rohingya names are spelled in many ways (Rahman,
+// Rahaman, Rohman; Hossain, Hussain, Hosen; Yusuf, Yousuf). NameTokenKeys
+// reduces each name part to a consonant skeleton so that such variants share a
+// key: digraphs are simplified, letters that are interchangeable in
+// transliteration are folded together and vowels are dropped after the first letter.
+
+// nameDigraphs are replaced in order before letters are folded
+var nameDigraphs = strings.NewReplacer(
+	"ph", "f", "bh", "b", "kh", "k", "gh", "g", "th", "t", "dh", "d",
+	"sh", "s", "ch", "c", "ck", "k", "ee", "i", "oo", "u", "ou", "u",
+)
+
+// nameLetters folds letters used interchangeably in romanized names
+var nameLetters = map[rune]rune{
+	'q': 'k', 'z': 'j', 'v': 'b', 'x': 'k', 'w': 'a', 'y': 'a',
+	'e': 'a', 'i': 'a', 'o': 'a', 'u': 'a',
+}
+
+// Honorifics and very common name parts carry no identifying information
+var commonNameKeys = map[string]bool{}
+
+func init() {
+	for _, name := range []string{
+		"md", "mo", "mohammad", "mohammed", "muhammad", "mohd", "mst", "most", "mosammat",
+		"begum", "khatun", "bibi", "sheikh", "sk", "bin", "binte",
+	} {
+		commonNameKeys[nameTokenKey(name)] = true
+	}
+}
+
+// NormalizeName romanizes a name, lowercases it and keeps only letters and
+// single spaces
+func NormalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(TransliterateName(name)) {
+		switch {
+		case unicode.IsLetter(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+func nameTokenKey(token string) string {
+	token = nameDigraphs.Replace(token)
+
+	var key []rune
+	for i, r := range token {
+		if folded, ok := nameLetters[r]; ok {
+			r = folded
+		}
+		// h only matters at the start of a name (Rahman/Raman, Mohammad/Mohamad)
+		if r == 'h' && i > 0 {
+			continue
+		}
+		if r == 'a' && len(key) > 0 {
+			continue
+		}
+		if len(key) > 0 && key[len(key)-1] == r {
+			continue
+		}
+		key = append(key, r)
+	}
+	return string(key)
+}
+
+// NameTokenKeys returns the sorted, de-duplicated phonetic keys of the name
+// parts, leaving out honorifics such as Md. and Begum
+func NameTokenKeys(names ...string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, name := range names {
+		for _, token := range strings.Fields(NormalizeName(name)) {
+			key := nameTokenKey(token)
+			if key == "" || commonNameKeys[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Names are registered in Bangla script as well as in Latin script, and
+// occasionally in the Hanifi Rohingya script. TransliterateName romanizes the
+// Bangla and Hanifi Rohingya letters the way names are commonly spelled in
+// Bangladesh (রহমান → rahman, মোহাম্মদ → mohammad), so a name typed in either
+// script gets the same phonetic keys. The spelling need not match the one on
+// file; the keys absorb the remaining variation.
+
+// banglaConsonants romanizes the Bangla consonants
+var banglaConsonants = map[rune]string{
+	'ক': "k", 'খ': "kh", 'গ': "g", 'ঘ': "gh", 'ঙ': "ng",
+	'চ': "ch", 'ছ': "chh", 'জ': "j", 'ঝ': "jh", 'ঞ': "n",
+	'ট': "t", 'ঠ': "th", 'ড': "d", 'ঢ': "dh", 'ণ': "n",
+	'ত': "t", 'থ': "th", 'দ': "d", 'ধ': "dh", 'ন': "n",
+	'প': "p", 'ফ': "f", 'ব': "b", 'ভ': "bh", 'ম': "m",
+	'য': "j", 'র': "r", 'ল': "l", 'শ': "sh", 'ষ': "sh",
+	'স': "s", 'হ': "h", '\u09DC': "r", '\u09DD': "rh", '\u09DF': "y",
+	'ৎ': "t",
+}
+
+// banglaVowels romanizes the independent vowels and the vowel signs
+var banglaVowels = map[rune]string{
+	'অ': "a", 'আ': "a", 'ই': "i", 'ঈ': "i", 'উ': "u", 'ঊ': "u",
+	'ঋ': "ri", 'এ': "e", 'ঐ': "oi", 'ও': "o", 'ঔ': "ou",
+	'া': "a", 'ি': "i", 'ী': "i", 'ু': "u", 'ূ': "u",
+	'ৃ': "ri", 'ে': "e", 'ৈ': "oi", 'ো': "o", 'ৌ': "ou",
+}
+
+const (
+	banglaVirama  = '্'
+	banglaAnusvar = 'ং'
+)
+
+// hanifiRohingya romanizes the Hanifi Rohingya letters (U+10D00 to U+10D21)
+var hanifiRohingya = map[rune]string{
+	'\U00010D00': "a", '\U00010D01': "b", '\U00010D02': "p", '\U00010D03': "t",
+	'\U00010D04': "t", '\U00010D05': "j", '\U00010D06': "c", '\U00010D07': "h",
+	'\U00010D08': "kh", '\U00010D09': "f", '\U00010D0A': "d", '\U00010D0B': "d",
+	'\U00010D0C': "r", '\U00010D0D': "r", '\U00010D0E': "z", '\U00010D0F': "s",
+	'\U00010D10': "sh", '\U00010D11': "k", '\U00010D12': "g", '\U00010D13': "l",
+	'\U00010D14': "m", '\U00010D15': "n", '\U00010D16': "w", '\U00010D17': "w",
+	'\U00010D18': "y", '\U00010D19': "y", '\U00010D1A': "ng", '\U00010D1B': "ny",
+	'\U00010D1C': "v", '\U00010D1D': "a", '\U00010D1E': "i", '\U00010D1F': "u",
+	'\U00010D20': "e", '\U00010D21': "o",
+}
+
+// banglaNukta spells ড়, ঢ় and য় as one character; they are often typed as the
+// base letter followed by a nukta
+var banglaNukta = strings.NewReplacer("\u09A1\u09BC", "\u09DC", "\u09A2\u09BC", "\u09DD", "\u09AF\u09BC", "\u09DF")
+
+// TransliterateName romanizes the Bangla and Hanifi Rohingya letters of a
+// name; other characters are kept as they are
+func TransliterateName(name string) string {
+	runes := []rune(banglaNukta.Replace(name))
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if latin, ok := hanifiRohingya[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+		if latin, ok := banglaVowels[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+		if r == banglaAnusvar {
+			b.WriteString("ng")
+			continue
+		}
+		latin, ok := banglaConsonants[r]
+		if !ok {
+			// Chandrabindu, visarga, virama and nukta have no letter of their own
+			if r < 0x0980 || r > 0x09FF {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		// য after a virama is the ya-phala, pronounced as a y glide
+		if r == 'য' && i > 0 && runes[i-1] == banglaVirama {
+			latin = "y"
+		}
+		b.WriteString(latin)
+		if banglaInherentVowel(runes, i) {
+			b.WriteByte('a')
+		}
+	}
+	return b.String()
+}
+
+// banglaInherentVowel decides if the consonant at i is pronounced with its
+// inherent vowel. Romanized names drop it where speech does: at the end of a
+// word, before a virama or vowel sign, and after the first syllable when the
+// next consonant carries a vowel (রহমান is rahman, not rahamana).
+func banglaInherentVowel(runes []rune, i int) bool {
+	next := func(j int) rune {
+		if j < len(runes) {
+			return runes[j]
+		}
+		return 0
+	}
+	following := next(i + 1)
+	if following == banglaVirama {
+		return false
+	}
+	if _, ok := banglaVowels[following]; ok {
+		return false
+	}
+	if _, ok := banglaConsonants[following]; !ok {
+		// End of the word, or a sign such as ং that closes the syllable
+		return following == banglaAnusvar || following == 'ঃ' || following == 'ঁ'
+	}
+	wordStart := i == 0 || !isBanglaLetter(runes[i-1])
+	if wordStart {
+		return true
+	}
+	_, vowelFollows := banglaVowels[next(i+2)]
+	return !vowelFollows
+}
+
+func isBanglaLetter(r rune) bool {
+	return r >= 0x0980 && r <= 0x09FF && (unicode.IsLetter(r) || unicode.IsMark(r))
+}
+
+// SearchName is the normalized, romanized full name that name searches match
+// against with trigram similarity
+func SearchName(names ...string) string {
+	return NormalizeName(strings.Join(names, " "))
+}
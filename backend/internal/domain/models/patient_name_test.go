@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransliterateName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"রহমান", "rahman"},
+		{"মোহাম্মদ", "mohammad"},
+		{"হোসেন", "hosen"},
+		{"আয়েশা", "ayesha"},
+		{"ফাতেমা খাতুন", "fatema khatun"},
+		{"\U00010D14\U00010D1D\U00010D0C\U00010D1D\U00010D14", "maram"}, // Hanifi Rohingya
+		{"Md. Rahman", "Md. Rahman"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, TransliterateName(tt.name))
+		})
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "md rahman", NormalizeName("  Md.  RAHMAN "))
+	assert.Equal(t, "nur begam", NormalizeName("নূর-বেগম"))
+	assert.Equal(t, "", NormalizeName("123 ."))
+	assert.Equal(t, "nur begam hosen", SearchName("নূর", "", "বেগম হোসেন"))
+}
+
+// TestNameTokenKeys checks the usual spellings of a name share a key, in
+// either script, and honorifics are left out
+func TestNameTokenKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []string
+		want     []string
+	}{
+		{"rahman", []string{"Rahman", "Rahaman", "Rohman", "রহমান", "Md. Rahman", "Mohammad Rahman"}, []string{"rmn"}},
+		{"hossain", []string{"Hossain", "Hussain", "Hosen", "হোসেন"}, []string{"hsn"}},
+		{"yusuf", []string{"Yusuf", "Yousuf"}, []string{"asf"}},
+		{"ayesha", []string{"Ayesha", "Aisha", "আয়েশা"}, []string{"as"}},
+		{"fatema", []string{"Fatema", "Fatima", "Fatema Begum", "ফাতেমা খাতুন"}, []string{"ftm"}},
+		{"karim", []string{"Karim", "Kareem", "করিম"}, []string{"krm"}},
+		{"honorifics only", []string{"Md.", "Mst. Begum", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, variant := range tt.variants {
+				assert.Equal(t, tt.want, NameTokenKeys(variant), variant)
+			}
+		})
+	}
+
+	assert.Equal(t, []string{"hsn", "rmn"}, NameTokenKeys("Rahman", "", "Hossain Rahaman"))
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"path"
+)
+
+// Photo variants stored besides the original: the longest side in pixels
+var PhotoVariants = map[string]int{
+	"medium": 480, // registration desk and patient cards
+	"small":  160, // lists and search results
+}
+
+// PatientPhoto is an uploaded patient photo. The image files live in object
+// storage below StorageKey; replacing a photo soft-deletes the previous row.
+type PatientPhoto struct {
+	BaseModel
+
+	PatientID uint `gorm:"index;not null" json:"patient_id"`
+
+	// Key prefix of the stored files, e.g. patients/42/photos/<random>
+	StorageKey  string `gorm:"size:255;not null" json:"-"`
+	ContentType string `gorm:"size:50;not null" json:"content_type"` // of the original
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	SHA256      string `gorm:"size:64" json:"sha256"`
+
+	UploadedBy uint `json:"uploaded_by"`
+}
+
+// TableName overrides the table name
+func (PatientPhoto) TableName() string {
+	return "patient_photos"
+}
+
+// PatientPhotoURL is the API path a patient's current photo is served from,
+// stored in Patient.PhotoURL
+func PatientPhotoURL(patientID uint) string {
+	return fmt.Sprintf("/api/v1/patients/%d/photo", patientID)
+}
+
+// Key returns the storage key of the original or of a PhotoVariants entry
+func (p *PatientPhoto) Key(variant string) string {
+	if variant == "" || variant == "original" {
+		ext := ".jpg"
+		if p.ContentType == "image/png" {
+			ext = ".png"
+		}
+		return path.Join(p.StorageKey, "original"+ext)
+	}
+	return path.Join(p.StorageKey, variant+".jpg")
+}
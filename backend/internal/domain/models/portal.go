@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// PortalDelegation grants a portal user (caregiver/proxy) access to another
+// patient's records, e.g. a parent viewing a child's records.
+// Delegations are never deleted; revocation is recorded instead.
+type PortalDelegation struct {
+	BaseModel
+
+	// Proxy portal user who is granted access
+	ProxyUserID uint  `gorm:"index;not null" json:"proxy_user_id"`
+	ProxyUser   *User `gorm:"foreignKey:ProxyUserID" json:"proxy_user,omitempty"`
+
+	// Patient whose records may be viewed
+	PatientID uint     `gorm:"index;not null" json:"patient_id"`
+	Patient   *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+
+	// Relationship: parent, guardian, spouse, child, caregiver, other
+	Relationship string `gorm:"size:50;not null" json:"relationship"`
+
+	// Validity period
+	ValidFrom  time.Time  `gorm:"not null" json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+
+	// Granted by (staff user ID)
+	GrantedBy uint   `json:"granted_by"`
+	Notes     string `gorm:"type:text" json:"notes,omitempty"`
+
+	// Revocation
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy        *uint      `json:"revoked_by,omitempty"`
+	RevocationReason string     `gorm:"type:text" json:"revocation_reason,omitempty"`
+}
+
+// TableName overrides the table name
+func (PortalDelegation) TableName() string {
+	return "portal_delegations"
+}
+
+// IsActive checks if the delegation is currently in effect
+func (d *PortalDelegation) IsActive() bool {
+	now := time.Now()
+	if d.RevokedAt != nil || d.ValidFrom.After(now) {
+		return false
+	}
+	if d.ValidUntil != nil && d.ValidUntil.Before(now) {
+		return false
+	}
+	return true
+}
+
+// Revoke ends the delegation
+func (d *PortalDelegation) Revoke(reason string, revokedBy uint) {
+	now := time.Now()
+	d.RevokedAt = &now
+	d.RevokedBy = &revokedBy
+	d.RevocationReason = reason
+}
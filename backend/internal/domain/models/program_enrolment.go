@@ -0,0 +1,265 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Chronic disease programs patients are enrolled in for longitudinal care
+var Programs = []string{NCDProgramHypertension, NCDProgramDiabetes}
+
+// Program enrolment statuses
+const (
+	ProgramEnrolmentActive = "active"
+	ProgramEnrolmentExited = "exited"
+)
+
+// Outcomes of leaving a program
+const (
+	ProgramOutcomeTransferredOut   = "transferred-out"
+	ProgramOutcomeDied             = "died"
+	ProgramOutcomeLostToFollowUp   = "lost-to-follow-up"
+	ProgramOutcomeStoppedTreatment = "stopped-treatment"
+	ProgramOutcomeDischarged       = "discharged"
+)
+
+// Program visit statuses. A due visit is the next expected follow-up; it is
+// attended, or cancelled when the patient leaves the program.
+const (
+	ProgramVisitDue       = "due"
+	ProgramVisitAttended  = "attended"
+	ProgramVisitCancelled = "cancelled"
+)
+
+// Control targets at the last measurement: BP under 140/90 (WHO HEARTS) and
+// HbA1c under 7%
+const (
+	ControlSystolicBP  = 140
+	ControlDiastolicBP = 90
+	ControlHbA1c       = 7.0
+)
+
+// DefaultDefaulterDays is how many days past a due visit a patient becomes a
+// defaulter
+const DefaultDefaulterDays = 7
+
+var (
+	ErrProgramEnrolmentExists = errors.New("patient is already enrolled in this program")
+	ErrProgramEnrolmentExited = errors.New("patient has left this program")
+
+	ErrInvalidProgram        = &ValidationError{Field: "program", Message: "Program must be hypertension or diabetes"}
+	ErrInvalidProgramOutcome = &ValidationError{Field: "outcome", Message: "Outcome must be one of transferred-out, died, lost-to-follow-up, stopped-treatment, discharged"}
+	ErrInvalidFollowUpDays   = &ValidationError{Field: "follow_up_days", Message: "Follow-up interval must be between 1 and 365 days"}
+	ErrNextVisitBeforeVisit  = &ValidationError{Field: "next_visit_date", Message: "Next visit must be after the visit"}
+	ErrProgramVisitFuture    = &ValidationError{Field: "visit_date", Message: "Visit date cannot be in the future"}
+	ErrProgramVisitEncounter = &ValidationError{Field: "encounter_id", Message: "Encounter must be of the enrolled patient"}
+)
+
+// ProgramFollowUpSchedules are the days between follow-up visits of each
+// program
+type ProgramFollowUpSchedules map[string]int
+
+// DefaultProgramFollowUpSchedules follow monthly visits for hypertension and
+// diabetes, as in WHO HEARTS
+func DefaultProgramFollowUpSchedules() ProgramFollowUpSchedules {
+	return ProgramFollowUpSchedules{
+		NCDProgramHypertension: 30,
+		NCDProgramDiabetes:     30,
+	}
+}
+
+// IsProgram reports whether program is a known program
+func IsProgram(program string) bool {
+	return hasCode(Programs, program)
+}
+
+// ProgramEnrolment is a patient's enrolment in a chronic disease program,
+// from an NCD screening or entered directly (e.g. transferred in)
+type ProgramEnrolment struct {
+	BaseModel
+
+	PatientID uint    `gorm:"index;not null" json:"patient_id"`
+	Patient   Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+
+	// Program: hypertension, diabetes
+	Program string `gorm:"size:30;not null;index" json:"program"`
+
+	// Status: active, exited
+	Status string `gorm:"size:20;not null;index" json:"status"`
+
+	EnrolledAt     time.Time `gorm:"not null;index" json:"enrolled_at"`
+	EnrolledBy     uint      `json:"enrolled_by,omitempty"`
+	NCDScreeningID *uint     `gorm:"index" json:"ncd_screening_id,omitempty"`
+	NCDNumber      string    `gorm:"size:50;index" json:"ncd_number,omitempty"`
+
+	// Days between follow-up visits
+	FollowUpDays  int        `gorm:"not null" json:"follow_up_days"`
+	LastVisitDate *time.Time `json:"last_visit_date,omitempty"`
+	NextVisitDate *time.Time `gorm:"index" json:"next_visit_date,omitempty"`
+
+	// Outcome on leaving: transferred-out, died, lost-to-follow-up, stopped-treatment, discharged
+	Outcome      string     `gorm:"size:30" json:"outcome,omitempty"`
+	OutcomeNotes string     `gorm:"type:text" json:"outcome_notes,omitempty"`
+	ExitedAt     *time.Time `json:"exited_at,omitempty"`
+	ExitedBy     *uint      `json:"exited_by,omitempty"`
+
+	Visits []ProgramVisit `gorm:"foreignKey:EnrolmentID" json:"visits,omitempty"`
+
+	// Control at the latest measurements, computed when read
+	Control *ProgramControl `gorm:"-" json:"control,omitempty"`
+}
+
+// TableName overrides the table name
+func (ProgramEnrolment) TableName() string {
+	return "program_enrolments"
+}
+
+// Validate checks the program and follow-up interval
+func (e *ProgramEnrolment) Validate() error {
+	if !IsProgram(e.Program) {
+		return ErrInvalidProgram
+	}
+	if e.FollowUpDays < 1 || e.FollowUpDays > 365 {
+		return ErrInvalidFollowUpDays
+	}
+	return nil
+}
+
+// Exit records the patient leaving the program
+func (e *ProgramEnrolment) Exit(outcome, notes string, by uint, at time.Time) error {
+	if e.Status == ProgramEnrolmentExited {
+		return ErrProgramEnrolmentExited
+	}
+	switch outcome {
+	case ProgramOutcomeTransferredOut, ProgramOutcomeDied, ProgramOutcomeLostToFollowUp,
+		ProgramOutcomeStoppedTreatment, ProgramOutcomeDischarged:
+	default:
+		return ErrInvalidProgramOutcome
+	}
+	e.Status = ProgramEnrolmentExited
+	e.Outcome = outcome
+	e.OutcomeNotes = notes
+	e.ExitedAt = &at
+	e.ExitedBy = &by
+	e.NextVisitDate = nil
+	return nil
+}
+
+// NextVisit returns the date of the follow-up visit after one on a date
+func (e *ProgramEnrolment) NextVisit(after time.Time) time.Time {
+	y, m, d := after.Date()
+	return time.Date(y, m, d+e.FollowUpDays, 0, 0, 0, 0, after.Location())
+}
+
+// ProgramVisit is an expected follow-up visit of a program enrolment
+type ProgramVisit struct {
+	BaseModel
+
+	EnrolmentID uint `gorm:"index;not null" json:"enrolment_id"`
+	PatientID   uint `gorm:"index;not null" json:"patient_id"`
+
+	DueDate time.Time `gorm:"not null;index" json:"due_date"`
+
+	// Status: due, attended, cancelled
+	Status string `gorm:"size:20;not null;index" json:"status"`
+
+	EncounterID *uint      `gorm:"index" json:"encounter_id,omitempty"`
+	AttendedAt  *time.Time `json:"attended_at,omitempty"`
+	RecordedBy  *uint      `json:"recorded_by,omitempty"`
+}
+
+// TableName overrides the table name
+func (ProgramVisit) TableName() string {
+	return "program_visits"
+}
+
+// ProgramControl is whether an enrolled patient's BP and HbA1c were at target
+// at their latest measurement. Controlled is unset without a measurement.
+type ProgramControl struct {
+	EnrolmentID uint `json:"-"`
+
+	SystolicBP   *int       `json:"systolic_bp,omitempty"`
+	DiastolicBP  *int       `json:"diastolic_bp,omitempty"`
+	BPMeasuredAt *time.Time `json:"bp_measured_at,omitempty"`
+	BPControlled *bool      `gorm:"-" json:"bp_controlled,omitempty"`
+
+	HbA1c           *float64   `gorm:"column:hba1c" json:"hba1c,omitempty"`
+	HbA1cMeasuredAt *time.Time `gorm:"column:hba1c_measured_at" json:"hba1c_measured_at,omitempty"`
+	HbA1cControlled *bool      `gorm:"-" json:"hba1c_controlled,omitempty"`
+}
+
+// Assess sets whether BP and HbA1c are controlled
+func (c *ProgramControl) Assess() {
+	c.BPControlled, c.HbA1cControlled = nil, nil
+	if c.SystolicBP != nil && c.DiastolicBP != nil {
+		controlled := *c.SystolicBP < ControlSystolicBP && *c.DiastolicBP < ControlDiastolicBP
+		c.BPControlled = &controlled
+	}
+	if c.HbA1c != nil {
+		controlled := *c.HbA1c < ControlHbA1c
+		c.HbA1cControlled = &controlled
+	}
+}
+
+// ProgramDefaulter is an enrolled patient who missed a follow-up visit
+type ProgramDefaulter struct {
+	EnrolmentID   uint       `json:"enrolment_id"`
+	PatientID     uint       `json:"patient_id"`
+	MRN           string     `json:"mrn"`
+	PatientName   string     `json:"patient_name"`
+	Phone         string     `json:"phone,omitempty"`
+	Program       string     `json:"program"`
+	NCDNumber     string     `json:"ncd_number,omitempty"`
+	DueDate       time.Time  `json:"due_date"`
+	DaysOverdue   int        `json:"days_overdue"`
+	LastVisitDate *time.Time `json:"last_visit_date,omitempty"`
+}
+
+// ProgramIndicators are the control indicators of a program's active
+// enrolments. Rates are in percent of the patients with a measurement.
+type ProgramIndicators struct {
+	Program       string `json:"program"`
+	Active        int    `json:"active"`
+	Defaulters    int    `json:"defaulters"`
+	DefaulterDays int    `json:"defaulter_days"`
+
+	BPMeasured    int      `json:"bp_measured"`
+	BPControlled  int      `json:"bp_controlled"`
+	BPControlRate *float64 `json:"bp_control_rate,omitempty"`
+
+	HbA1cMeasured    int      `json:"hba1c_measured"`
+	HbA1cControlled  int      `json:"hba1c_controlled"`
+	HbA1cControlRate *float64 `json:"hba1c_control_rate,omitempty"`
+
+	// Exited enrolments by outcome
+	Outcomes map[string]int `json:"outcomes"`
+}
+
+// Add counts an enrolment's control
+func (i *ProgramIndicators) Add(c *ProgramControl) {
+	if c.BPControlled != nil {
+		i.BPMeasured++
+		if *c.BPControlled {
+			i.BPControlled++
+		}
+	}
+	if c.HbA1cControlled != nil {
+		i.HbA1cMeasured++
+		if *c.HbA1cControlled {
+			i.HbA1cControlled++
+		}
+	}
+}
+
+// Rates computes the control rates
+func (i *ProgramIndicators) Rates() {
+	i.BPControlRate, i.HbA1cControlRate = nil, nil
+	if i.BPMeasured > 0 {
+		rate := 100 * float64(i.BPControlled) / float64(i.BPMeasured)
+		i.BPControlRate = &rate
+	}
+	if i.HbA1cMeasured > 0 {
+		rate := 100 * float64(i.HbA1cControlled) / float64(i.HbA1cMeasured)
+		i.HbA1cControlRate = &rate
+	}
+}
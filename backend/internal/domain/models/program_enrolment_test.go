@@ -0,0 +1,114 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgramEnrolmentValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		days    int
+		wantErr error
+	}{
+		{"hypertension", NCDProgramHypertension, 30, nil},
+		{"diabetes yearly", NCDProgramDiabetes, 365, nil},
+		{"unknown program", "asthma", 30, ErrInvalidProgram},
+		{"no interval", NCDProgramDiabetes, 0, ErrInvalidFollowUpDays},
+		{"interval too long", NCDProgramDiabetes, 366, ErrInvalidFollowUpDays},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ProgramEnrolment{Program: tt.program, FollowUpDays: tt.days}
+			assert.Equal(t, tt.wantErr, e.Validate())
+		})
+	}
+}
+
+func TestProgramEnrolmentExit(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	next := at.AddDate(0, 0, 30)
+
+	e := &ProgramEnrolment{Status: ProgramEnrolmentActive, NextVisitDate: &next}
+	assert.Equal(t, ErrInvalidProgramOutcome, e.Exit("cured", "", 4, at))
+	assert.Equal(t, ProgramEnrolmentActive, e.Status)
+
+	require.NoError(t, e.Exit(ProgramOutcomeTransferredOut, "To Ukhiya UHC", 4, at))
+	assert.Equal(t, ProgramEnrolmentExited, e.Status)
+	assert.Equal(t, ProgramOutcomeTransferredOut, e.Outcome)
+	assert.Equal(t, "To Ukhiya UHC", e.OutcomeNotes)
+	assert.Equal(t, at, *e.ExitedAt)
+	assert.Equal(t, uint(4), *e.ExitedBy)
+	assert.Nil(t, e.NextVisitDate)
+
+	assert.ErrorIs(t, e.Exit(ProgramOutcomeDied, "", 4, at), ErrProgramEnrolmentExited)
+	assert.Equal(t, ProgramOutcomeTransferredOut, e.Outcome)
+}
+
+func TestProgramEnrolmentNextVisit(t *testing.T) {
+	e := &ProgramEnrolment{FollowUpDays: 30}
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		e.NextVisit(time.Date(2026, 1, 31, 16, 45, 0, 0, time.UTC)))
+
+	dhaka := time.FixedZone("BDT", 6*60*60)
+	e.FollowUpDays = 90
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, dhaka),
+		e.NextVisit(time.Date(2026, 1, 1, 23, 30, 0, 0, dhaka)))
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestProgramControlAssess(t *testing.T) {
+	tests := []struct {
+		name      string
+		control   ProgramControl
+		wantBP    *bool
+		wantHbA1c *bool
+	}{
+		{"no measurements", ProgramControl{}, nil, nil},
+		{"controlled", ProgramControl{SystolicBP: intPtr(128), DiastolicBP: intPtr(82), HbA1c: floatPtr(6.4)}, boolPtr(true), boolPtr(true)},
+		{"systolic at target", ProgramControl{SystolicBP: intPtr(140), DiastolicBP: intPtr(80)}, boolPtr(false), nil},
+		{"diastolic at target", ProgramControl{SystolicBP: intPtr(130), DiastolicBP: intPtr(90)}, boolPtr(false), nil},
+		{"systolic only", ProgramControl{SystolicBP: intPtr(120)}, nil, nil},
+		{"HbA1c at target", ProgramControl{HbA1c: floatPtr(7.0)}, nil, boolPtr(false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.control
+			c.Assess()
+			assert.Equal(t, tt.wantBP, c.BPControlled)
+			assert.Equal(t, tt.wantHbA1c, c.HbA1cControlled)
+		})
+	}
+}
+
+func TestProgramIndicatorsRates(t *testing.T) {
+	var ind ProgramIndicators
+	ind.Rates()
+	assert.Nil(t, ind.BPControlRate)
+	assert.Nil(t, ind.HbA1cControlRate)
+
+	controls := []ProgramControl{
+		{SystolicBP: intPtr(128), DiastolicBP: intPtr(82), HbA1c: floatPtr(8.1)},
+		{SystolicBP: intPtr(152), DiastolicBP: intPtr(96)},
+		{SystolicBP: intPtr(118), DiastolicBP: intPtr(76)},
+		{},
+	}
+	for i := range controls {
+		controls[i].Assess()
+		ind.Add(&controls[i])
+	}
+	ind.Rates()
+	assert.Equal(t, 3, ind.BPMeasured)
+	assert.Equal(t, 2, ind.BPControlled)
+	require.NotNil(t, ind.BPControlRate)
+	assert.InDelta(t, 66.67, *ind.BPControlRate, 0.01)
+	assert.Equal(t, 1, ind.HbA1cMeasured)
+	assert.Equal(t, 0, ind.HbA1cControlled)
+	require.NotNil(t, ind.HbA1cControlRate)
+	assert.Equal(t, 0.0, *ind.HbA1cControlRate)
+}
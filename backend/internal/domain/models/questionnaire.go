@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Questionnaire statuses, as in FHIR R4 Questionnaire.status
+const (
+	QuestionnaireDraft   = "draft"
+	QuestionnaireActive  = "active"
+	QuestionnaireRetired = "retired"
+)
+
+// Submission statuses, as in FHIR R4 QuestionnaireResponse.status
+const (
+	SubmissionInProgress     = "in-progress"
+	SubmissionCompleted      = "completed"
+	SubmissionAmended        = "amended"
+	SubmissionEnteredInError = "entered-in-error"
+)
+
+var (
+	ErrQuestionnaireNotDraft    = errors.New("only draft questionnaires can be changed; publish a new version")
+	ErrQuestionnaireNotActive   = errors.New("questionnaire is not active")
+	ErrQuestionnaireExists      = errors.New("a questionnaire with this url and version already exists")
+	ErrSubmissionEnteredInError = errors.New("questionnaire response was entered in error")
+
+	ErrInvalidQuestionnaireStatus = &ValidationError{Field: "status", Message: "Status must be one of draft, active, retired"}
+	ErrQuestionnaireTransition    = &ValidationError{Field: "status", Message: "Questionnaires go from draft to active, and between active and retired"}
+	ErrInvalidSubmissionStatus    = &ValidationError{Field: "status", Message: "Status must be one of in-progress, completed, amended, entered-in-error"}
+	ErrSubmissionReopened         = &ValidationError{Field: "status", Message: "A completed questionnaire response cannot go back to in-progress"}
+	ErrSubmissionPatientRequired  = &ValidationError{Field: "subject", Message: "Subject must reference a patient"}
+	ErrSubmissionEncounter        = &ValidationError{Field: "encounter", Message: "Encounter must be of the subject"}
+	ErrSubmissionAuthored         = &ValidationError{Field: "authored", Message: "Authored must be a FHIR dateTime"}
+	ErrSubmissionQuestionnaire    = &ValidationError{Field: "questionnaire", Message: "Questionnaire must be the canonical URL of a stored questionnaire, optionally with |version"}
+)
+
+// Questionnaire is a stored FHIR Questionnaire form definition. A
+// questionnaire is edited as a draft and published as active; changing a
+// published form means publishing a new version.
+type Questionnaire struct {
+	BaseModel
+
+	URL     string `gorm:"size:255;not null;uniqueIndex:idx_questionnaire_url_version" json:"url"`
+	Version string `gorm:"size:50;not null;uniqueIndex:idx_questionnaire_url_version" json:"version"`
+	Name    string `gorm:"size:100;index" json:"name,omitempty"`
+	Title   string `gorm:"size:255" json:"title,omitempty"`
+
+	// Status: draft, active, retired
+	Status string `gorm:"size:20;not null;index" json:"status"`
+
+	// Definition is the FHIR Questionnaire resource as JSON
+	Definition string `gorm:"type:text;not null" json:"-"`
+
+	CreatedBy uint `json:"created_by,omitempty"`
+}
+
+// TableName overrides the table name
+func (Questionnaire) TableName() string {
+	return "questionnaires"
+}
+
+// Canonical is the questionnaire's canonical reference, url|version
+func (q *Questionnaire) Canonical() string {
+	return q.URL + "|" + q.Version
+}
+
+// SetStatus moves the questionnaire to another status
+func (q *Questionnaire) SetStatus(status string) error {
+	switch status {
+	case QuestionnaireDraft, QuestionnaireActive, QuestionnaireRetired:
+	default:
+		return ErrInvalidQuestionnaireStatus
+	}
+	if status == q.Status {
+		return nil
+	}
+	if status == QuestionnaireDraft || (q.Status == QuestionnaireDraft && status != QuestionnaireActive) {
+		return ErrQuestionnaireTransition
+	}
+	q.Status = status
+	return nil
+}
+
+// QuestionnaireSubmission is a QuestionnaireResponse submitted for a patient,
+// optionally during an encounter, validated against its questionnaire
+type QuestionnaireSubmission struct {
+	BaseModel
+
+	QuestionnaireID uint          `gorm:"index;not null" json:"questionnaire_id"`
+	Questionnaire   Questionnaire `gorm:"foreignKey:QuestionnaireID" json:"questionnaire,omitempty"`
+
+	PatientID   uint  `gorm:"index;not null" json:"patient_id"`
+	EncounterID *uint `gorm:"index" json:"encounter_id,omitempty"`
+
+	// Status: in-progress, completed, amended, entered-in-error
+	Status     string    `gorm:"size:20;not null;index" json:"status"`
+	AuthoredAt time.Time `gorm:"not null;index" json:"authored_at"`
+	AuthorID   uint      `json:"author_id,omitempty"`
+
+	// Response is the FHIR QuestionnaireResponse as JSON, after calculation
+	Response string `gorm:"type:text;not null" json:"-"`
+
+	Observations []QuestionnaireObservation `gorm:"foreignKey:SubmissionID" json:"observations,omitempty"`
+}
+
+// TableName overrides the table name
+func (QuestionnaireSubmission) TableName() string {
+	return "questionnaire_submissions"
+}
+
+// SetStatus moves the submission to another status. Changing a completed
+// response makes it amended.
+func (s *QuestionnaireSubmission) SetStatus(status string) error {
+	switch status {
+	case SubmissionInProgress, SubmissionCompleted, SubmissionAmended, SubmissionEnteredInError:
+	default:
+		return ErrInvalidSubmissionStatus
+	}
+	switch {
+	case s.Status == SubmissionEnteredInError:
+		return ErrSubmissionEnteredInError
+	case status == SubmissionEnteredInError:
+	case s.Status == "" || s.Status == SubmissionInProgress:
+		if status == SubmissionAmended {
+			status = SubmissionCompleted
+		}
+	case status == SubmissionInProgress:
+		return ErrSubmissionReopened
+	default:
+		status = SubmissionAmended
+	}
+	s.Status = status
+	return nil
+}
+
+// IsFinal reports whether the answers are complete, so observations are
+// extracted from them
+func (s *QuestionnaireSubmission) IsFinal() bool {
+	return s.Status == SubmissionCompleted || s.Status == SubmissionAmended
+}
+
+// QuestionnaireObservation is an answer extracted from a completed
+// submission as an observation of the patient, for items the questionnaire
+// marks for observation extraction
+type QuestionnaireObservation struct {
+	BaseModel
+
+	SubmissionID uint   `gorm:"index;not null" json:"submission_id"`
+	PatientID    uint   `gorm:"index;not null" json:"patient_id"`
+	EncounterID  *uint  `gorm:"index" json:"encounter_id,omitempty"`
+	LinkID       string `gorm:"size:100;not null" json:"link_id"`
+
+	// Code of the item, e.g. a LOINC code
+	CodeSystem string `gorm:"size:255" json:"code_system,omitempty"`
+	Code       string `gorm:"size:100;index" json:"code"`
+	Display    string `gorm:"size:255" json:"display,omitempty"`
+
+	// Value: a number (with unit), a boolean, a coding or text
+	ValueNumber     *float64 `json:"value_number,omitempty"`
+	Unit            string   `gorm:"size:50" json:"unit,omitempty"`
+	ValueBoolean    *bool    `json:"value_boolean,omitempty"`
+	ValueCodeSystem string   `gorm:"size:255" json:"value_code_system,omitempty"`
+	ValueCode       string   `gorm:"size:100" json:"value_code,omitempty"`
+	ValueString     string   `gorm:"type:text" json:"value_string,omitempty"`
+
+	EffectiveAt time.Time `gorm:"not null;index" json:"effective_at"`
+}
+
+// TableName overrides the table name
+func (QuestionnaireObservation) TableName() string {
+	return "questionnaire_observations"
+}
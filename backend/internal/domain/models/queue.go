@@ -0,0 +1,233 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueueServicePoint is a place in the clinic where patients queue with a
+// token, e.g. consultation, laboratory or pharmacy. Name is the matching
+// Encounter.ServiceCategory.
+type QueueServicePoint struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"` // of the token numbers, e.g. L-007
+}
+
+// QueueServicePoints are the service points that issue tokens
+var QueueServicePoints = []QueueServicePoint{
+	{"general", "General", "G"},
+	{"ncd", "NCD Corner", "N"},
+	{"mhpss", "MHPSS", "M"},
+	{"mnch-fp", "MNCH & FP", "F"},
+	{"laboratory", "Laboratory", "L"},
+	{"pharmacy", "Pharmacy", "P"},
+	{"emergency", "Emergency", "E"},
+}
+
+// FindQueueServicePoint looks up a service point by code
+func FindQueueServicePoint(code string) (QueueServicePoint, bool) {
+	for _, point := range QueueServicePoints {
+		if point.Code == code {
+			return point, true
+		}
+	}
+	return QueueServicePoint{}, false
+}
+
+// Queue token statuses
+const (
+	QueueStatusWaiting     = "waiting"
+	QueueStatusCalled      = "called"
+	QueueStatusSkipped     = "skipped"     // did not come when called
+	QueueStatusDone        = "done"        // served
+	QueueStatusTransferred = "transferred" // sent on to another service point with a new token
+)
+
+// queueTransitions lists the statuses a token can move to from each status.
+// A called token can be called again; a skipped patient who turns up goes
+// back to waiting in their original place.
+var queueTransitions = map[string][]string{
+	QueueStatusWaiting:     {QueueStatusCalled, QueueStatusTransferred},
+	QueueStatusCalled:      {QueueStatusCalled, QueueStatusSkipped, QueueStatusDone, QueueStatusTransferred},
+	QueueStatusSkipped:     {QueueStatusWaiting},
+	QueueStatusDone:        {},
+	QueueStatusTransferred: {},
+}
+
+// QueueDateLayout is the layout of QueueToken.QueueDate
+const QueueDateLayout = "2006-01-02"
+
+var (
+	// ErrQueueTransition is wrapped by the error of a token status change the
+	// queue does not allow
+	ErrQueueTransition = errors.New("queue token status change not allowed")
+
+	// ErrQueueCheckedIn is returned when a patient already holds an open token
+	// at the service point
+	ErrQueueCheckedIn = errors.New("patient is already in this queue")
+
+	ErrInvalidServicePoint = &ValidationError{Field: "service_point", Message: "Service point must be one of general, ncd, mhpss, mnch-fp, laboratory, pharmacy, emergency"}
+	ErrQueueSamePoint      = &ValidationError{Field: "service_point", Message: "Patient is already queued at this service point"}
+	ErrQueueEncounterOther = &ValidationError{Field: "encounter_id", Message: "Encounter belongs to another patient"}
+)
+
+// QueueToken is a patient's place in the queue of a service point on a day.
+// Numbers restart at 1 every day at every service point.
+type QueueToken struct {
+	BaseModel
+
+	ServicePoint string `gorm:"size:30;not null;uniqueIndex:idx_queue_tokens_number" json:"service_point"`
+	QueueDate    string `gorm:"size:10;not null;uniqueIndex:idx_queue_tokens_number;index" json:"queue_date"` // local date, YYYY-MM-DD
+	Number       int    `gorm:"not null;uniqueIndex:idx_queue_tokens_number" json:"number"`
+	Token        string `gorm:"size:10;not null" json:"token"` // as displayed, e.g. G-012
+
+	PatientID   uint     `gorm:"index;not null" json:"patient_id"`
+	Patient     *Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
+	EncounterID *uint    `gorm:"index" json:"encounter_id,omitempty"`
+
+	// Priority tokens (elderly, pregnant, disabled, very sick) are called first
+	Priority bool   `gorm:"default:false" json:"priority"`
+	Status   string `gorm:"size:20;not null;index" json:"status"`
+
+	CheckedInAt time.Time `gorm:"not null" json:"checked_in_at"`
+	IssuedBy    uint      `json:"issued_by"`
+
+	// First and latest call, and where the patient was called to
+	CalledAt     *time.Time `json:"called_at,omitempty"`
+	LastCalledAt *time.Time `json:"last_called_at,omitempty"`
+	CallCount    int        `gorm:"default:0" json:"call_count"`
+	CalledBy     *uint      `json:"called_by,omitempty"`
+	Counter      string     `gorm:"size:50" json:"counter,omitempty"` // desk or room
+
+	SkippedAt   *time.Time `json:"skipped_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"` // done or transferred
+
+	// Token this one was transferred from, and the token it was transferred to
+	TransferredFromID *uint `gorm:"index" json:"transferred_from_id,omitempty"`
+	TransferredToID   *uint `json:"transferred_to_id,omitempty"`
+}
+
+// TableName overrides the table name
+func (QueueToken) TableName() string {
+	return "queue_tokens"
+}
+
+// QueueCounter holds the last token number issued at a service point on a day
+type QueueCounter struct {
+	ServicePoint string `gorm:"primaryKey;size:30" json:"service_point"`
+	QueueDate    string `gorm:"primaryKey;size:10" json:"queue_date"`
+	LastNumber   int    `gorm:"not null" json:"last_number"`
+}
+
+// TableName overrides the table name
+func (QueueCounter) TableName() string {
+	return "queue_counters"
+}
+
+// FormatQueueToken formats a token number for display, e.g. G-012
+func FormatQueueToken(point QueueServicePoint, number int) string {
+	return fmt.Sprintf("%s-%03d", point.Prefix, number)
+}
+
+// IsOpen checks if the patient is still waiting or being served
+func (t *QueueToken) IsOpen() bool {
+	return t.Status == QueueStatusWaiting || t.Status == QueueStatusCalled
+}
+
+// TransitionTo moves the token to status at the given time, rejecting changes
+// the queue does not allow
+func (t *QueueToken) TransitionTo(status string, at time.Time) error {
+	allowed := false
+	for _, next := range queueTransitions[t.Status] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		if len(queueTransitions[t.Status]) == 0 {
+			return fmt.Errorf("%w: token %s is %s", ErrQueueTransition, t.Token, t.Status)
+		}
+		return fmt.Errorf("%w: token %s is %s and can only be %s",
+			ErrQueueTransition, t.Token, t.Status, strings.Join(queueTransitions[t.Status], " or "))
+	}
+
+	switch status {
+	case QueueStatusCalled:
+		if t.CalledAt == nil {
+			t.CalledAt = &at
+		}
+		t.LastCalledAt = &at
+		t.CallCount++
+	case QueueStatusSkipped:
+		t.SkippedAt = &at
+	case QueueStatusWaiting:
+		t.SkippedAt = nil
+		t.Counter = ""
+	case QueueStatusDone, QueueStatusTransferred:
+		t.CompletedAt = &at
+	}
+	t.Status = status
+	return nil
+}
+
+// WaitMinutes returns how long the patient waited to be called, or has been
+// waiting so far
+func (t *QueueToken) WaitMinutes(now time.Time) float64 {
+	if t.CalledAt != nil {
+		return t.CalledAt.Sub(t.CheckedInAt).Minutes()
+	}
+	return now.Sub(t.CheckedInAt).Minutes()
+}
+
+// QueueStats summarizes a service point's queue on a day; times are in minutes
+type QueueStats struct {
+	ServicePoint string `json:"service_point"`
+	Name         string `json:"name"`
+	QueueDate    string `json:"queue_date"`
+
+	Waiting     int64 `json:"waiting"`
+	Called      int64 `json:"called"`
+	Done        int64 `json:"done"`
+	Skipped     int64 `json:"skipped"`
+	Transferred int64 `json:"transferred"`
+
+	WaitMedian     *float64 `json:"wait_median,omitempty"` // check-in to first call
+	WaitMean       *float64 `json:"wait_mean,omitempty"`
+	LongestWaiting *float64 `json:"longest_waiting,omitempty"` // of those still waiting
+	ServiceMedian  *float64 `json:"service_median,omitempty"`  // first call to done
+}
+
+// QueueEvent is a change to a queue, pushed to display screens. It carries
+// no patient details.
+type QueueEvent struct {
+	Type         string    `json:"type"` // issued, called, skipped, requeued, done, transferred
+	ServicePoint string    `json:"service_point"`
+	Token        string    `json:"token"`
+	Number       int       `json:"number"`
+	Status       string    `json:"status"`
+	Counter      string    `json:"counter,omitempty"`
+	Priority     bool      `json:"priority"`
+	At           time.Time `json:"at"`
+
+	// For transfers, the new token at the other service point
+	ToServicePoint string `json:"to_service_point,omitempty"`
+	ToToken        string `json:"to_token,omitempty"`
+}
+
+// QueueDisplay is what a waiting-area screen shows for a service point:
+// the tokens being called, latest first, and the tokens waiting in order
+type QueueDisplay struct {
+	ServicePoint string              `json:"service_point"`
+	Name         string              `json:"name"`
+	NowServing   []QueueDisplayToken `json:"now_serving"`
+	Waiting      []QueueDisplayToken `json:"waiting"`
+}
+
+// QueueDisplayToken is a token as shown on a display screen
+type QueueDisplayToken struct {
+	Token    string     `json:"token"`
+	Counter  string     `json:"counter,omitempty"`
+	Priority bool       `json:"priority"`
+	CalledAt *time.Time `json:"called_at,omitempty"`
+}
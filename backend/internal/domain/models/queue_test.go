@@ -0,0 +1,92 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueTokenTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{QueueStatusWaiting, QueueStatusCalled, true},
+		{QueueStatusWaiting, QueueStatusTransferred, true},
+		{QueueStatusWaiting, QueueStatusDone, false},
+		{QueueStatusWaiting, QueueStatusSkipped, false},
+		{QueueStatusCalled, QueueStatusCalled, true},
+		{QueueStatusCalled, QueueStatusSkipped, true},
+		{QueueStatusCalled, QueueStatusDone, true},
+		{QueueStatusCalled, QueueStatusWaiting, false},
+		{QueueStatusSkipped, QueueStatusWaiting, true},
+		{QueueStatusSkipped, QueueStatusCalled, false},
+		{QueueStatusDone, QueueStatusCalled, false},
+		{QueueStatusTransferred, QueueStatusWaiting, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			token := &QueueToken{Token: "G-001", Status: tt.from}
+			err := token.TransitionTo(tt.to, time.Now())
+			if tt.allowed {
+				require.NoError(t, err)
+				assert.Equal(t, tt.to, token.Status)
+				return
+			}
+			assert.ErrorIs(t, err, ErrQueueTransition)
+			assert.Equal(t, tt.from, token.Status)
+		})
+	}
+}
+
+func TestQueueTokenTransitionTo(t *testing.T) {
+	checkIn := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	first := checkIn.Add(20 * time.Minute)
+	again := checkIn.Add(25 * time.Minute)
+	token := &QueueToken{Token: "L-007", Status: QueueStatusWaiting, CheckedInAt: checkIn}
+	assert.Equal(t, 30.0, token.WaitMinutes(checkIn.Add(30*time.Minute)), "still waiting")
+
+	// Calling again keeps the first call and counts the calls
+	require.NoError(t, token.TransitionTo(QueueStatusCalled, first))
+	token.Counter = "Room 2"
+	require.NoError(t, token.TransitionTo(QueueStatusCalled, again))
+	assert.True(t, first.Equal(*token.CalledAt))
+	assert.True(t, again.Equal(*token.LastCalledAt))
+	assert.Equal(t, 2, token.CallCount)
+	assert.Equal(t, 20.0, token.WaitMinutes(checkIn.Add(time.Hour)))
+
+	// A skipped patient goes back to waiting without a counter
+	require.NoError(t, token.TransitionTo(QueueStatusSkipped, again))
+	require.NotNil(t, token.SkippedAt)
+	require.NoError(t, token.TransitionTo(QueueStatusWaiting, again))
+	assert.Nil(t, token.SkippedAt)
+	assert.Empty(t, token.Counter)
+	assert.True(t, token.IsOpen())
+
+	require.NoError(t, token.TransitionTo(QueueStatusCalled, again))
+	require.NoError(t, token.TransitionTo(QueueStatusDone, again))
+	require.NotNil(t, token.CompletedAt)
+	assert.False(t, token.IsOpen())
+	err := token.TransitionTo(QueueStatusCalled, again)
+	assert.ErrorIs(t, err, ErrQueueTransition)
+	assert.Contains(t, err.Error(), "token L-007 is done")
+}
+
+func TestQueueServicePoints(t *testing.T) {
+	prefixes := map[string]bool{}
+	for _, point := range QueueServicePoints {
+		found, ok := FindQueueServicePoint(point.Code)
+		require.True(t, ok, point.Code)
+		assert.Equal(t, point, found)
+		assert.False(t, prefixes[point.Prefix], "prefix %s is shared", point.Prefix)
+		prefixes[point.Prefix] = true
+	}
+	_, ok := FindQueueServicePoint("radiology")
+	assert.False(t, ok)
+
+	lab, _ := FindQueueServicePoint("laboratory")
+	assert.Equal(t, "L-007", FormatQueueToken(lab, 7))
+	assert.Equal(t, "L-1234", FormatQueueToken(lab, 1234))
+}
@@ -30,6 +30,11 @@ type ImagingStudy struct {
 	Report *RadiologyReport `json:"report" gorm:"foreignKey:StudyID"`
 }
 
+// TableName overrides the table name
+func (ImagingStudy) TableName() string {
+	return "imaging_studies"
+}
+
 // ImagingSeries represents a DICOM Series
 type ImagingSeries struct {
 	gorm.Model
@@ -42,6 +47,11 @@ type ImagingSeries struct {
 	Instances   []ImagingInstance `json:"instances" gorm:"foreignKey:SeriesID"`
 }
 
+// AuditParent returns the imaging study the series belongs to
+func (i ImagingSeries) AuditParent() (interface{}, uint) {
+	return &ImagingStudy{}, i.StudyID
+}
+
 // ImagingInstance represents a DICOM Instance (Image)
 type ImagingInstance struct {
 	gorm.Model
@@ -53,6 +63,11 @@ type ImagingInstance struct {
 	ContentType    string `json:"content_type"` // e.g., application/dicom, image/jpeg
 }
 
+// AuditParent returns the imaging series the instance belongs to
+func (i ImagingInstance) AuditParent() (interface{}, uint) {
+	return &ImagingSeries{}, i.SeriesID
+}
+
 // RadiologyReport represents the findings for a study
 type RadiologyReport struct {
 	gorm.Model
@@ -65,3 +80,8 @@ type RadiologyReport struct {
 	ReportedAt    time.Time  `json:"reported_at"`
 	FinalizedAt   *time.Time `json:"finalized_at"`
 }
+
+// AuditParent returns the imaging study the report belongs to
+func (r RadiologyReport) AuditParent() (interface{}, uint) {
+	return &ImagingStudy{}, r.StudyID
+}
@@ -26,6 +26,11 @@ type Transfer struct {
 	AuthorizedBy uint      `gorm:"not null" json:"authorized_by"` // UserID
 }
 
+// AuditParent returns the admission the transfer belongs to
+func (t Transfer) AuditParent() (interface{}, uint) {
+	return &Admission{}, t.AdmissionID
+}
+
 func (Transfer) TableName() string {
 	return "transfers"
 }
@@ -0,0 +1,436 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// TriageScaleSATS is the South African Triage Scale, used in the emergency
+// department: a Triage Early Warning Score (TEWS) from the vital signs,
+// mobility and level of consciousness, raised by clinical discriminators.
+const TriageScaleSATS = "SATS"
+
+// SATS levels, most urgent first
+const (
+	TriageLevelRed    = "red"    // emergency
+	TriageLevelOrange = "orange" // very urgent
+	TriageLevelYellow = "yellow" // urgent
+	TriageLevelGreen  = "green"  // routine
+)
+
+// TriageLevels lists the levels, most urgent first
+var TriageLevels = []string{TriageLevelRed, TriageLevelOrange, TriageLevelYellow, TriageLevelGreen}
+
+// TriageTargetMinutes is how soon after triage a patient of each level should be seen
+var TriageTargetMinutes = map[string]int{
+	TriageLevelRed:    0,
+	TriageLevelOrange: 10,
+	TriageLevelYellow: 60,
+	TriageLevelGreen:  240,
+}
+
+// Mobility values of the TEWS
+const (
+	TriageMobilityWalking  = "walking"
+	TriageMobilityWithHelp = "with-help"
+	TriageMobilityImmobile = "immobile" // stretcher
+)
+
+// AVPU values of the TEWS
+const (
+	AVPUAlert        = "alert"
+	AVPUConfused     = "confused"
+	AVPUVoice        = "voice" // reacts to voice
+	AVPUPain         = "pain"  // reacts to pain
+	AVPUUnresponsive = "unresponsive"
+)
+
+// TriageAdultAge is the age from which the adult TEWS applies. Younger
+// children are graded on the discriminators, and vital signs outside the
+// reference range for their age make them at least yellow.
+const TriageAdultAge = 12
+
+// TriageDiscriminator is a presenting sign that puts a patient at least at
+// its level whatever the TEWS
+type TriageDiscriminator struct {
+	Code    string `json:"code"`
+	Level   string `json:"level"`
+	Display string `json:"display"`
+}
+
+// TriageDiscriminators are the SATS discriminators
+var TriageDiscriminators = []TriageDiscriminator{
+	{"obstructed-airway", TriageLevelRed, "Obstructed airway"},
+	{"not-breathing", TriageLevelRed, "Not breathing"},
+	{"cardiac-arrest", TriageLevelRed, "Cardiac arrest"},
+	{"seizure-current", TriageLevelRed, "Seizure - current"},
+	{"burn-facial-inhalation", TriageLevelRed, "Burn - facial or inhalation"},
+	{"hypoglycaemia", TriageLevelRed, "Hypoglycaemia - glucose less than 3 mmol/L"},
+
+	{"high-energy-transport", TriageLevelOrange, "High energy transfer"},
+	{"dislocation-larger-joint", TriageLevelOrange, "Dislocation - larger joint (not finger or toe)"},
+	{"fracture-compound", TriageLevelOrange, "Fracture - compound"},
+	{"burn-over-20-percent", TriageLevelOrange, "Burn - over 20% of body surface"},
+	{"burn-electrical", TriageLevelOrange, "Burn - electrical"},
+	{"burn-circumferential", TriageLevelOrange, "Burn - circumferential"},
+	{"burn-chemical", TriageLevelOrange, "Burn - chemical"},
+	{"poisoning-overdose", TriageLevelOrange, "Poisoning or overdose"},
+	{"seizure-post-ictal", TriageLevelOrange, "Seizure - post-ictal"},
+	{"focal-neurology-acute", TriageLevelOrange, "Focal neurology - acute"},
+	{"level-of-consciousness-reduced", TriageLevelOrange, "Level of consciousness reduced"},
+	{"psychosis-aggression", TriageLevelOrange, "Psychosis or aggression"},
+	{"threatened-limb", TriageLevelOrange, "Threatened limb"},
+	{"haemorrhage-uncontrolled", TriageLevelOrange, "Haemorrhage - uncontrolled"},
+	{"chest-pain", TriageLevelOrange, "Chest pain"},
+	{"vomiting-fresh-blood", TriageLevelOrange, "Vomiting fresh blood"},
+	{"pregnancy-abdominal-trauma-or-pain", TriageLevelOrange, "Pregnancy and abdominal trauma or pain"},
+	{"severe-pain", TriageLevelOrange, "Severe pain (8-10)"},
+	{"shortness-of-breath-acute", TriageLevelOrange, "Shortness of breath - acute"},
+	{"coughing-blood", TriageLevelOrange, "Coughing blood"},
+	{"diabetic-ketonuria", TriageLevelOrange, "Diabetic - glucose over 11 mmol/L and ketonuria"},
+
+	{"haemorrhage-controlled", TriageLevelYellow, "Haemorrhage - controlled"},
+	{"dislocation-finger-toe", TriageLevelYellow, "Dislocation - finger or toe"},
+	{"fracture-closed", TriageLevelYellow, "Fracture - closed"},
+	{"burn-other", TriageLevelYellow, "Burn - other"},
+	{"abdominal-pain", TriageLevelYellow, "Abdominal pain"},
+	{"diabetic-hyperglycaemia", TriageLevelYellow, "Diabetic - glucose over 17 mmol/L, no ketonuria"},
+	{"vomiting-persistent", TriageLevelYellow, "Vomiting - persistent"},
+	{"pregnancy-trauma", TriageLevelYellow, "Pregnancy and trauma"},
+	{"pregnancy-pv-bleed", TriageLevelYellow, "Pregnancy and PV bleed"},
+	{"moderate-pain", TriageLevelYellow, "Moderate pain (5-7)"},
+}
+
+var triageDiscriminatorsByCode = map[string]TriageDiscriminator{}
+
+var triageLevelRank = map[string]int{}
+
+func init() {
+	for _, d := range TriageDiscriminators {
+		triageDiscriminatorsByCode[d.Code] = d
+	}
+	for i, level := range TriageLevels {
+		triageLevelRank[level] = i
+	}
+}
+
+var (
+	ErrTriageNotEmergency       = &ValidationError{Field: "encounter_id", Message: "Only emergency encounters are triaged"}
+	ErrTriageComplaintRequired  = &ValidationError{Field: "presenting_complaint", Message: "Presenting complaint is required"}
+	ErrInvalidTriageMobility    = &ValidationError{Field: "mobility", Message: "Mobility must be one of walking, with-help, immobile"}
+	ErrInvalidTriageAVPU        = &ValidationError{Field: "avpu", Message: "AVPU must be one of alert, confused, voice, pain, unresponsive"}
+	ErrTriageTEWSIncomplete     = &ValidationError{Field: "vital_signs", Message: "Respiratory rate, pulse, systolic BP, temperature, mobility and AVPU are needed to score an adult unless an emergency sign is present"}
+	ErrTriageVitalSignsNotFound = &ValidationError{Field: "vital_signs_id", Message: "Vital signs must be recorded in this encounter"}
+	ErrInvalidTriageLevel       = &ValidationError{Field: "level", Message: "Level must be one of red, orange, yellow, green"}
+	ErrTriageOverrideReason     = &ValidationError{Field: "override_reason", Message: "A reason is required to triage at a different level than computed"}
+)
+
+// Triage is the triage assessment of an emergency encounter. Re-triaging
+// replaces the assessment; earlier versions are kept in the audit trail.
+type Triage struct {
+	BaseModel
+
+	EncounterID uint `gorm:"uniqueIndex;not null" json:"encounter_id"`
+	PatientID   uint `gorm:"index;not null" json:"patient_id"`
+
+	PresentingComplaint string `gorm:"type:text;not null" json:"presenting_complaint"`
+
+	// Vital signs the triage was based on, copied from VitalSignsID (by default
+	// the latest of the encounter) unless entered at triage
+	VitalSignsID    *uint    `json:"vital_signs_id,omitempty"`
+	RespiratoryRate *int     `json:"respiratory_rate,omitempty"`
+	PulseRate       *int     `json:"pulse_rate,omitempty"`
+	SystolicBP      *int     `json:"systolic_bp,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	SpO2            *int     `json:"spo2,omitempty"`
+	PainScale       *int     `json:"pain_scale,omitempty"`
+	BloodGlucose    *float64 `json:"blood_glucose,omitempty"` // mmol/L
+
+	Mobility string `gorm:"size:20" json:"mobility,omitempty"`
+	AVPU     string `gorm:"size:20" json:"avpu,omitempty"`
+	Trauma   bool   `json:"trauma"`
+
+	// Codes of the TriageDiscriminators found
+	Discriminators []string `gorm:"type:text;serializer:json" json:"discriminators,omitempty"`
+
+	Scale         string   `gorm:"size:10;not null" json:"scale"`
+	TEWS          *int     `json:"tews,omitempty"` // not scored for children
+	ComputedLevel string   `gorm:"size:10;not null" json:"computed_level"`
+	LevelReasons  []string `gorm:"type:text;serializer:json" json:"level_reasons,omitempty"`
+
+	// Level the patient was triaged at; differs from ComputedLevel only with a reason
+	Level          string `gorm:"size:10;index;not null" json:"level"`
+	OverrideReason string `gorm:"type:text" json:"override_reason,omitempty"`
+
+	TriagedAt time.Time `gorm:"not null" json:"triaged_at"`
+	TriagedBy uint      `json:"triaged_by"`
+}
+
+// TableName overrides the table name
+func (Triage) TableName() string {
+	return "triages"
+}
+
+// IsValidTriageLevel checks if level is a SATS level
+func IsValidTriageLevel(level string) bool {
+	_, ok := triageLevelRank[level]
+	return ok
+}
+
+// MoreUrgentTriageLevel returns the more urgent of two levels
+func MoreUrgentTriageLevel(a, b string) string {
+	if triageLevelRank[a] <= triageLevelRank[b] {
+		return a
+	}
+	return b
+}
+
+// TriagePriority maps a triage level to an encounter priority
+func TriagePriority(level string) string {
+	switch level {
+	case TriageLevelRed:
+		return "emergency"
+	case TriageLevelOrange, TriageLevelYellow:
+		return "urgent"
+	default:
+		return "routine"
+	}
+}
+
+// UseVitalSigns fills the vital signs not entered at triage from a measurement
+func (t *Triage) UseVitalSigns(v *VitalSigns) {
+	t.VitalSignsID = &v.ID
+	if t.RespiratoryRate == nil {
+		t.RespiratoryRate = v.RespiratoryRate
+	}
+	if t.PulseRate == nil {
+		t.PulseRate = v.PulseRate
+	}
+	if t.SystolicBP == nil {
+		t.SystolicBP = v.SystolicBP
+	}
+	if t.Temperature == nil {
+		t.Temperature = v.Temperature
+	}
+	if t.SpO2 == nil {
+		t.SpO2 = v.SpO2
+	}
+	if t.PainScale == nil {
+		t.PainScale = v.PainScale
+	}
+}
+
+// Assess scores the triage on the SATS and sets TEWS, ComputedLevel and the
+// reasons for it. The level is the most urgent of the TEWS level and the
+// levels of the discriminators, including those read from the pain scale and
+// blood glucose. Patients from TriageAdultAge, or of unknown age, get the
+// adult TEWS. Children are not scored; a vital sign outside the reference
+// range for their age at the time of triage raises them to yellow.
+func (t *Triage) Assess(patient *Patient, at time.Time) error {
+	if t.PresentingComplaint == "" {
+		return ErrTriageComplaintRequired
+	}
+	if _, ok := tewsMobility[t.Mobility]; t.Mobility != "" && !ok {
+		return ErrInvalidTriageMobility
+	}
+	if _, ok := tewsAVPU[t.AVPU]; t.AVPU != "" && !ok {
+		return ErrInvalidTriageAVPU
+	}
+
+	t.Scale = TriageScaleSATS
+	t.TEWS = nil
+	t.LevelReasons = nil
+	level := TriageLevelGreen
+
+	raise := func(to, reason string) {
+		level = MoreUrgentTriageLevel(level, to)
+		t.LevelReasons = append(t.LevelReasons, fmt.Sprintf("%s (%s)", reason, to))
+	}
+	for _, code := range t.Discriminators {
+		d, ok := triageDiscriminatorsByCode[code]
+		if !ok {
+			return &ValidationError{Field: "discriminators", Message: fmt.Sprintf("Unknown discriminator %q", code)}
+		}
+		raise(d.Level, d.Display)
+	}
+	if t.PainScale != nil && *t.PainScale >= 8 {
+		raise(TriageLevelOrange, fmt.Sprintf("Severe pain, pain scale %d", *t.PainScale))
+	} else if t.PainScale != nil && *t.PainScale >= 5 {
+		raise(TriageLevelYellow, fmt.Sprintf("Moderate pain, pain scale %d", *t.PainScale))
+	}
+	if t.BloodGlucose != nil && *t.BloodGlucose < 3 {
+		raise(TriageLevelRed, fmt.Sprintf("Hypoglycaemia, glucose %.1f mmol/L", *t.BloodGlucose))
+	} else if t.BloodGlucose != nil && *t.BloodGlucose > 17 {
+		raise(TriageLevelYellow, fmt.Sprintf("Hyperglycaemia, glucose %.1f mmol/L", *t.BloodGlucose))
+	}
+
+	months, known := ageInMonths(patient, at)
+	if !known || months >= TriageAdultAge*12 {
+		tews, ok := t.score()
+		switch {
+		case ok:
+			t.TEWS = &tews
+			raise(tewsLevel(tews), fmt.Sprintf("TEWS %d", tews))
+		case level != TriageLevelRed:
+			// Emergency signs are treated at once; everyone else is scored
+			return ErrTriageTEWSIncomplete
+		}
+	} else {
+		for _, vital := range t.abnormalChildVitals(patient, months) {
+			raise(TriageLevelYellow, vital)
+		}
+	}
+
+	t.ComputedLevel = level
+	return nil
+}
+
+var tewsMobility = map[string]int{
+	TriageMobilityWalking:  0,
+	TriageMobilityWithHelp: 1,
+	TriageMobilityImmobile: 2,
+}
+
+var tewsAVPU = map[string]int{
+	AVPUAlert:        0,
+	AVPUConfused:     1,
+	AVPUVoice:        1,
+	AVPUPain:         2,
+	AVPUUnresponsive: 3,
+}
+
+// score computes the adult TEWS, if all its inputs are known
+func (t *Triage) score() (int, bool) {
+	if t.RespiratoryRate == nil || t.PulseRate == nil || t.SystolicBP == nil || t.Temperature == nil ||
+		t.Mobility == "" || t.AVPU == "" {
+		return 0, false
+	}
+
+	score := tewsMobility[t.Mobility] + tewsAVPU[t.AVPU]
+	if t.Trauma {
+		score++
+	}
+
+	switch rr := *t.RespiratoryRate; {
+	case rr < 9:
+		score += 2
+	case rr <= 14:
+	case rr <= 20:
+		score++
+	case rr <= 29:
+		score += 2
+	default:
+		score += 3
+	}
+
+	switch hr := *t.PulseRate; {
+	case hr < 41:
+		score += 2
+	case hr <= 50:
+		score++
+	case hr <= 100:
+	case hr <= 110:
+		score++
+	case hr <= 129:
+		score += 2
+	default:
+		score += 3
+	}
+
+	switch sbp := *t.SystolicBP; {
+	case sbp < 71:
+		score += 3
+	case sbp <= 80:
+		score += 2
+	case sbp <= 100:
+		score++
+	case sbp <= 199:
+	default:
+		score += 2
+	}
+
+	if temp := *t.Temperature; temp < 35 || temp >= 38.5 {
+		score += 2
+	}
+	return score, true
+}
+
+// triageVital is a vital sign recorded at triage
+type triageVital struct {
+	vital   string
+	display string
+	format  string
+	value   func(t *Triage) *float64
+}
+
+var triageVitals = []triageVital{
+	{VitalRespiratoryRate, "Respiratory rate", "%.0f/min", func(t *Triage) *float64 { return intValue(t.RespiratoryRate) }},
+	{VitalPulseRate, "Pulse", "%.0f/min", func(t *Triage) *float64 { return intValue(t.PulseRate) }},
+	{VitalSystolicBP, "Systolic BP", "%.0f mmHg", func(t *Triage) *float64 { return intValue(t.SystolicBP) }},
+	{VitalTemperature, "Temperature", "%.1f °C", func(t *Triage) *float64 { return t.Temperature }},
+	{VitalSpO2, "SpO2", "%.0f%%", func(t *Triage) *float64 { return intValue(t.SpO2) }},
+}
+
+// abnormalChildVitals describes the vital signs of a child of the given age
+// in months that are outside the reference range
+func (t *Triage) abnormalChildVitals(patient *Patient, months int) []string {
+	var abnormal []string
+	for _, v := range triageVitals {
+		value := v.value(t)
+		if value == nil {
+			continue
+		}
+		r, ok := FindVitalReferenceRange(v.vital, months, patient.Gender, false)
+		if !ok {
+			continue
+		}
+		if flag := r.Interpret(*value); flag != VitalFlagNormal {
+			abnormal = append(abnormal, fmt.Sprintf("%s "+v.format+", %s for age", v.display, *value, flag))
+		}
+	}
+	return abnormal
+}
+
+// tewsLevel is the SATS level of a TEWS
+func tewsLevel(tews int) string {
+	switch {
+	case tews >= 7:
+		return TriageLevelRed
+	case tews >= 5:
+		return TriageLevelOrange
+	case tews >= 3:
+		return TriageLevelYellow
+	default:
+		return TriageLevelGreen
+	}
+}
+
+// ERBoardEntry is a patient waiting in the emergency department
+type ERBoardEntry struct {
+	EncounterID    uint      `json:"encounter_id"`
+	PatientID      uint      `json:"patient_id"`
+	MRN            string    `json:"mrn"`
+	PatientName    string    `json:"patient_name"`
+	Status         string    `json:"status"`
+	ChiefComplaint string    `json:"chief_complaint,omitempty"`
+	ArrivedAt      time.Time `json:"arrived_at"`
+	WaitingMinutes float64   `json:"waiting_minutes"`
+
+	TriageID            *uint      `json:"triage_id,omitempty"`
+	Level               string     `json:"level,omitempty"`
+	TEWS                *int       `json:"tews,omitempty"`
+	PresentingComplaint string     `json:"presenting_complaint,omitempty"`
+	TriagedAt           *time.Time `json:"triaged_at,omitempty"`
+
+	// Minutes left until the level's target time; negative when overdue
+	MinutesToTarget *float64 `json:"minutes_to_target,omitempty"`
+	Overdue         bool     `json:"overdue"`
+}
+
+// ERBoard lists the patients waiting in the emergency department: those not
+// yet triaged by arrival, and the triaged by level and then by arrival
+type ERBoard struct {
+	GeneratedAt    time.Time      `json:"generated_at"`
+	AwaitingTriage []ERBoardEntry `json:"awaiting_triage"`
+	Waiting        []ERBoardEntry `json:"waiting"`
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(i int) *int { return &i }
+
+func floatPtr(f float64) *float64 { return &f }
+
+func bornOn(year int, month time.Month, day int) *Patient {
+	birth := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &Patient{BirthDate: &birth, Gender: "female"}
+}
+
+// adultTriage has normal vital signs: TEWS 0
+func adultTriage() Triage {
+	return Triage{
+		PresentingComplaint: "Fever",
+		RespiratoryRate:     intPtr(14),
+		PulseRate:           intPtr(80),
+		SystolicBP:          intPtr(120),
+		Temperature:         floatPtr(37),
+		Mobility:            TriageMobilityWalking,
+		AVPU:                AVPUAlert,
+	}
+}
+
+func TestTriageAssessAdult(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	adult := bornOn(1990, 4, 1)
+
+	tests := []struct {
+		name      string
+		patient   *Patient
+		change    func(tr *Triage)
+		wantTEWS  *int
+		wantLevel string
+		wantErr   error
+	}{
+		{"normal", adult, func(tr *Triage) {}, intPtr(0), TriageLevelGreen, nil},
+		{"unknown age is scored as an adult", &Patient{}, func(tr *Triage) {}, intPtr(0), TriageLevelGreen, nil},
+		{"yellow", adult, func(tr *Triage) {
+			tr.RespiratoryRate, tr.PulseRate, tr.AVPU = intPtr(18), intPtr(105), AVPUConfused
+		}, intPtr(3), TriageLevelYellow, nil},
+		{"orange with trauma", adult, func(tr *Triage) {
+			tr.Trauma, tr.Mobility, tr.AVPU, tr.PulseRate = true, TriageMobilityImmobile, AVPUVoice, intPtr(45)
+		}, intPtr(5), TriageLevelOrange, nil},
+		{"orange from low pressure and breathing", adult, func(tr *Triage) {
+			tr.SystolicBP, tr.RespiratoryRate = intPtr(70), intPtr(8)
+		}, intPtr(5), TriageLevelOrange, nil},
+		{"red", adult, func(tr *Triage) {
+			tr.RespiratoryRate, tr.PulseRate, tr.SystolicBP, tr.Temperature, tr.Mobility =
+				intPtr(22), intPtr(115), intPtr(95), floatPtr(38.6), TriageMobilityWithHelp
+		}, intPtr(8), TriageLevelRed, nil},
+		{"red from pressure, temperature and pulse", adult, func(tr *Triage) {
+			tr.SystolicBP, tr.Temperature, tr.PulseRate = intPtr(200), floatPtr(34.9), intPtr(130)
+		}, intPtr(7), TriageLevelRed, nil},
+		{"bradycardia", adult, func(tr *Triage) { tr.PulseRate = intPtr(40) }, intPtr(2), TriageLevelGreen, nil},
+		{"discriminator raises the level", adult, func(tr *Triage) {
+			tr.Discriminators = []string{"chest-pain"}
+		}, intPtr(0), TriageLevelOrange, nil},
+		{"moderate pain", adult, func(tr *Triage) { tr.PainScale = intPtr(6) }, intPtr(0), TriageLevelYellow, nil},
+		{"severe pain", adult, func(tr *Triage) { tr.PainScale = intPtr(9) }, intPtr(0), TriageLevelOrange, nil},
+		{"hypoglycaemia", adult, func(tr *Triage) { tr.BloodGlucose = floatPtr(2.5) }, intPtr(0), TriageLevelRed, nil},
+		{"hyperglycaemia", adult, func(tr *Triage) { tr.BloodGlucose = floatPtr(18) }, intPtr(0), TriageLevelYellow, nil},
+		{"incomplete", adult, func(tr *Triage) { tr.PulseRate = nil }, nil, "", ErrTriageTEWSIncomplete},
+		{"incomplete with an emergency sign", adult, func(tr *Triage) {
+			tr.PulseRate, tr.Mobility = nil, ""
+			tr.Discriminators = []string{"not-breathing"}
+		}, nil, TriageLevelRed, nil},
+		{"twelfth birthday", bornOn(2012, 5, 1), func(tr *Triage) { tr.PulseRate = nil }, nil, "", ErrTriageTEWSIncomplete},
+		{"no complaint", adult, func(tr *Triage) { tr.PresentingComplaint = "" }, nil, "", ErrTriageComplaintRequired},
+		{"unknown mobility", adult, func(tr *Triage) { tr.Mobility = "running" }, nil, "", ErrInvalidTriageMobility},
+		{"unknown AVPU", adult, func(tr *Triage) { tr.AVPU = "asleep" }, nil, "", ErrInvalidTriageAVPU},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			triage := adultTriage()
+			tt.change(&triage)
+			err := triage.Assess(tt.patient, at)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, TriageScaleSATS, triage.Scale)
+			assert.Equal(t, tt.wantTEWS, triage.TEWS)
+			assert.Equal(t, tt.wantLevel, triage.ComputedLevel, triage.LevelReasons)
+		})
+	}
+
+	triage := adultTriage()
+	triage.Discriminators = []string{"sore-thumb"}
+	var validation *ValidationError
+	assert.ErrorAs(t, triage.Assess(adult, at), &validation)
+}
+
+func TestTriageAssessChild(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fiveYears := bornOn(2019, 5, 1)
+	infant := bornOn(2023, 11, 1)
+
+	tests := []struct {
+		name        string
+		patient     *Patient
+		triage      Triage
+		wantLevel   string
+		wantReasons []string
+	}{
+		{"no vital signs", fiveYears, Triage{}, TriageLevelGreen, nil},
+		{"normal for age", fiveYears, Triage{RespiratoryRate: intPtr(24), PulseRate: intPtr(100), SystolicBP: intPtr(100), Temperature: floatPtr(37), SpO2: intPtr(98)},
+			TriageLevelGreen, nil},
+		// 24/min is normal at five but slow for an infant
+		{"slow breathing for an infant", infant, Triage{RespiratoryRate: intPtr(24)},
+			TriageLevelYellow, []string{"Respiratory rate 24/min, low for age (yellow)"}},
+		{"fast breathing", fiveYears, Triage{RespiratoryRate: intPtr(40)},
+			TriageLevelYellow, []string{"Respiratory rate 40/min, high for age (yellow)"}},
+		{"several abnormal", fiveYears, Triage{PulseRate: intPtr(150), Temperature: floatPtr(39.2), SpO2: intPtr(90)},
+			TriageLevelYellow, []string{"Pulse 150/min, high for age (yellow)", "Temperature 39.2 °C, high for age (yellow)", "SpO2 90%, low for age (yellow)"}},
+		{"discriminator is more urgent", fiveYears, Triage{RespiratoryRate: intPtr(40), Discriminators: []string{"seizure-post-ictal"}},
+			TriageLevelOrange, []string{"Seizure - post-ictal (orange)", "Respiratory rate 40/min, high for age (yellow)"}},
+		{"day before the twelfth birthday", bornOn(2012, 5, 2), Triage{SystolicBP: intPtr(90)},
+			TriageLevelYellow, []string{"Systolic BP 90 mmHg, low for age (yellow)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			triage := tt.triage
+			triage.PresentingComplaint = "Cough"
+			require.NoError(t, triage.Assess(tt.patient, at))
+			assert.Nil(t, triage.TEWS)
+			assert.Equal(t, tt.wantLevel, triage.ComputedLevel)
+			assert.Equal(t, tt.wantReasons, triage.LevelReasons)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+// Vital sign interpretations against the reference range, as for lab results
+const (
+	VitalFlagNormal = "normal"
+	VitalFlagLow    = "low"
+	VitalFlagHigh   = "high"
+)
+
+// Vital signs with reference ranges, by their JSON field name
+const (
+	VitalSystolicBP      = "systolic_bp"
+	VitalDiastolicBP     = "diastolic_bp"
+	VitalPulseRate       = "pulse_rate"
+	VitalRespiratoryRate = "respiratory_rate"
+	VitalTemperature     = "temperature"
+	VitalSpO2            = "spo2"
+)
+
+// VitalAdultAge is the age from which adult reference ranges apply
+const VitalAdultAge = 18
+
+// VitalReferenceRange is the normal range of a vital sign for patients of an
+// age band, sex and pregnancy status
+type VitalReferenceRange struct {
+	Vital      string  `json:"vital"`
+	FromMonths int     `json:"from_months"`
+	ToMonths   int     `json:"to_months,omitempty"` // exclusive; 0 for no upper age
+	Sex        string  `json:"sex,omitempty"`       // patient gender; empty for any
+	Pregnant   bool    `json:"pregnant,omitempty"`  // applies during pregnancy only
+	Low        float64 `json:"low"`
+	High       float64 `json:"high"`
+}
+
+// Matches reports whether the range applies to a patient
+func (r VitalReferenceRange) Matches(months int, sex string, pregnant bool) bool {
+	return months >= r.FromMonths && (r.ToMonths == 0 || months < r.ToMonths) &&
+		(r.Sex == "" || r.Sex == sex) && (!r.Pregnant || pregnant)
+}
+
+// Interpret flags a value as low, normal or high
+func (r VitalReferenceRange) Interpret(value float64) string {
+	switch {
+	case value < r.Low:
+		return VitalFlagLow
+	case value > r.High:
+		return VitalFlagHigh
+	default:
+		return VitalFlagNormal
+	}
+}
+
+// VitalReferenceRanges is the reference range catalog. Children's heart rate,
+// respiratory rate and blood pressure follow the PALS normal values; the
+// first matching entry applies, so pregnancy entries come before the others.
+var VitalReferenceRanges = []VitalReferenceRange{
+	{Vital: VitalPulseRate, FromMonths: 0, ToMonths: 1, Low: 100, High: 205},
+	{Vital: VitalPulseRate, FromMonths: 1, ToMonths: 12, Low: 100, High: 180},
+	{Vital: VitalPulseRate, FromMonths: 12, ToMonths: 36, Low: 98, High: 140},
+	{Vital: VitalPulseRate, FromMonths: 36, ToMonths: 72, Low: 80, High: 120},
+	{Vital: VitalPulseRate, FromMonths: 72, ToMonths: 144, Low: 75, High: 118},
+	{Vital: VitalPulseRate, FromMonths: 144, Sex: "female", Pregnant: true, Low: 60, High: 110},
+	{Vital: VitalPulseRate, FromMonths: 144, Low: 60, High: 100},
+
+	{Vital: VitalRespiratoryRate, FromMonths: 0, ToMonths: 12, Low: 30, High: 53},
+	{Vital: VitalRespiratoryRate, FromMonths: 12, ToMonths: 36, Low: 22, High: 37},
+	{Vital: VitalRespiratoryRate, FromMonths: 36, ToMonths: 72, Low: 20, High: 28},
+	{Vital: VitalRespiratoryRate, FromMonths: 72, ToMonths: 144, Low: 18, High: 25},
+	{Vital: VitalRespiratoryRate, FromMonths: 144, Low: 12, High: 20},
+
+	{Vital: VitalSystolicBP, FromMonths: 0, ToMonths: 1, Low: 67, High: 84},
+	{Vital: VitalSystolicBP, FromMonths: 1, ToMonths: 12, Low: 72, High: 104},
+	{Vital: VitalSystolicBP, FromMonths: 12, ToMonths: 36, Low: 86, High: 106},
+	{Vital: VitalSystolicBP, FromMonths: 36, ToMonths: 72, Low: 89, High: 112},
+	{Vital: VitalSystolicBP, FromMonths: 72, ToMonths: 120, Low: 97, High: 115},
+	{Vital: VitalSystolicBP, FromMonths: 120, ToMonths: 144, Low: 102, High: 120},
+	{Vital: VitalSystolicBP, FromMonths: 144, Sex: "female", Pregnant: true, Low: 90, High: 139},
+	{Vital: VitalSystolicBP, FromMonths: 144, ToMonths: VitalAdultAge * 12, Low: 110, High: 131},
+	{Vital: VitalSystolicBP, FromMonths: VitalAdultAge * 12, Low: 90, High: 140},
+
+	{Vital: VitalDiastolicBP, FromMonths: 0, ToMonths: 1, Low: 31, High: 45},
+	{Vital: VitalDiastolicBP, FromMonths: 1, ToMonths: 12, Low: 37, High: 56},
+	{Vital: VitalDiastolicBP, FromMonths: 12, ToMonths: 36, Low: 42, High: 63},
+	{Vital: VitalDiastolicBP, FromMonths: 36, ToMonths: 72, Low: 46, High: 72},
+	{Vital: VitalDiastolicBP, FromMonths: 72, ToMonths: 120, Low: 57, High: 76},
+	{Vital: VitalDiastolicBP, FromMonths: 120, ToMonths: 144, Low: 61, High: 80},
+	// Diastolic pressure falls in the second trimester; 90 and over is hypertension
+	{Vital: VitalDiastolicBP, FromMonths: 144, Sex: "female", Pregnant: true, Low: 50, High: 89},
+	{Vital: VitalDiastolicBP, FromMonths: 144, ToMonths: VitalAdultAge * 12, Low: 64, High: 83},
+	{Vital: VitalDiastolicBP, FromMonths: VitalAdultAge * 12, Low: 60, High: 90},
+
+	{Vital: VitalTemperature, FromMonths: 0, ToMonths: 1, Low: 36.5, High: 37.5},
+	{Vital: VitalTemperature, FromMonths: 1, Low: 36.1, High: 37.8},
+
+	{Vital: VitalSpO2, FromMonths: 0, Low: 95, High: 100},
+}
+
+// FindVitalReferenceRange returns the reference range of a vital sign for a
+// patient of an age in months, sex and pregnancy status
+func FindVitalReferenceRange(vital string, months int, sex string, pregnant bool) (VitalReferenceRange, bool) {
+	for _, r := range VitalReferenceRanges {
+		if r.Vital == vital && r.Matches(months, sex, pregnant) {
+			return r, true
+		}
+	}
+	return VitalReferenceRange{}, false
+}
+
+// vitalFlagField is a vital sign value with its flag
+type vitalFlagField struct {
+	vital string
+	value func(v *VitalSigns) *float64
+	flag  func(v *VitalSigns) *string
+}
+
+func intValue(i *int) *float64 {
+	if i == nil {
+		return nil
+	}
+	f := float64(*i)
+	return &f
+}
+
+var vitalFlagFields = []vitalFlagField{
+	{VitalSystolicBP, func(v *VitalSigns) *float64 { return intValue(v.SystolicBP) }, func(v *VitalSigns) *string { return &v.SystolicBPFlag }},
+	{VitalDiastolicBP, func(v *VitalSigns) *float64 { return intValue(v.DiastolicBP) }, func(v *VitalSigns) *string { return &v.DiastolicBPFlag }},
+	{VitalPulseRate, func(v *VitalSigns) *float64 { return intValue(v.PulseRate) }, func(v *VitalSigns) *string { return &v.PulseRateFlag }},
+	{VitalRespiratoryRate, func(v *VitalSigns) *float64 { return intValue(v.RespiratoryRate) }, func(v *VitalSigns) *string { return &v.RespiratoryRateFlag }},
+	{VitalTemperature, func(v *VitalSigns) *float64 { return v.Temperature }, func(v *VitalSigns) *string { return &v.TemperatureFlag }},
+	{VitalSpO2, func(v *VitalSigns) *float64 { return intValue(v.SpO2) }, func(v *VitalSigns) *string { return &v.SpO2Flag }},
+}
+
+// FlagAbnormal sets the flag of each measured vital sign from the reference
+// range for the patient's age when measured, sex and pregnancy status.
+// Patients of unknown age are compared with adult ranges.
+func (v *VitalSigns) FlagAbnormal(patient *Patient) {
+	months, ok := ageInMonths(patient, v.MeasuredAt)
+	if !ok {
+		months = VitalAdultAge * 12
+	}
+	sex := ""
+	if patient != nil {
+		sex = patient.Gender
+	}
+	for _, field := range vitalFlagFields {
+		flag := field.flag(v)
+		*flag = ""
+		value := field.value(v)
+		if value == nil {
+			continue
+		}
+		if r, ok := FindVitalReferenceRange(field.vital, months, sex, v.Pregnant); ok {
+			*flag = r.Interpret(*value)
+		}
+	}
+}
+
+// AbnormalFlags returns the flags of the vital signs outside their reference
+// range, by vital sign
+func (v *VitalSigns) AbnormalFlags() map[string]string {
+	flags := map[string]string{}
+	for _, field := range vitalFlagFields {
+		if flag := *field.flag(v); flag == VitalFlagLow || flag == VitalFlagHigh {
+			flags[field.vital] = flag
+		}
+	}
+	return flags
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindVitalReferenceRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		vital     string
+		months    int
+		sex       string
+		pregnant  bool
+		low, high float64
+	}{
+		{"newborn pulse", VitalPulseRate, 0, "male", false, 100, 205},
+		{"infant pulse", VitalPulseRate, 6, "female", false, 100, 180},
+		{"toddler breathing", VitalRespiratoryRate, 24, "male", false, 22, 37},
+		{"adult pulse", VitalPulseRate, 30 * 12, "male", false, 60, 100},
+		{"pregnant pulse", VitalPulseRate, 25 * 12, "female", true, 60, 110},
+		{"pregnancy ignored for men", VitalPulseRate, 25 * 12, "male", true, 60, 100},
+		{"adolescent systolic", VitalSystolicBP, 15 * 12, "male", false, 110, 131},
+		{"adult systolic", VitalSystolicBP, VitalAdultAge * 12, "male", false, 90, 140},
+		{"pregnant diastolic", VitalDiastolicBP, 25 * 12, "female", true, 50, 89},
+		{"newborn temperature", VitalTemperature, 0, "", false, 36.5, 37.5},
+		{"oxygen at any age", VitalSpO2, 70 * 12, "", false, 95, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := FindVitalReferenceRange(tt.vital, tt.months, tt.sex, tt.pregnant)
+			require.True(t, ok)
+			assert.Equal(t, tt.low, r.Low)
+			assert.Equal(t, tt.high, r.High)
+		})
+	}
+
+	_, ok := FindVitalReferenceRange("weight", 30*12, "male", false)
+	assert.False(t, ok)
+}
+
+// TestVitalReferenceRangesCoverAllAges checks every vital sign has a range
+// at every age, for either sex, without overlaps in its age bands
+func TestVitalReferenceRangesCoverAllAges(t *testing.T) {
+	for _, vital := range []string{VitalSystolicBP, VitalDiastolicBP, VitalPulseRate, VitalRespiratoryRate, VitalTemperature, VitalSpO2} {
+		for months := 0; months <= 100*12; months++ {
+			for _, sex := range []string{"male", "female", ""} {
+				r, ok := FindVitalReferenceRange(vital, months, sex, false)
+				require.True(t, ok, "%s at %d months", vital, months)
+				assert.False(t, r.Pregnant)
+				assert.Less(t, r.Low, r.High)
+			}
+		}
+	}
+}
+
+func TestVitalSignsFlagAbnormal(t *testing.T) {
+	measured := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	born := func(years, months int) *Patient {
+		birth := measured.AddDate(-years, -months, 0)
+		return &Patient{BirthDate: &birth, Gender: "female"}
+	}
+
+	// A pulse and breathing rate normal for an infant are high for an adult
+	infantVitals := func() *VitalSigns {
+		return &VitalSigns{MeasuredAt: measured, PulseRate: intPtr(150), RespiratoryRate: intPtr(40), Temperature: floatPtr(37), SpO2: intPtr(97)}
+	}
+	infant := infantVitals()
+	infant.FlagAbnormal(born(0, 6))
+	assert.Equal(t, VitalFlagNormal, infant.PulseRateFlag)
+	assert.Equal(t, VitalFlagNormal, infant.RespiratoryRateFlag)
+	assert.Empty(t, infant.SystolicBPFlag, "not measured")
+	assert.False(t, infant.IsAbnormal())
+
+	adult := infantVitals()
+	adult.FlagAbnormal(born(30, 0))
+	assert.Equal(t, map[string]string{VitalPulseRate: VitalFlagHigh, VitalRespiratoryRate: VitalFlagHigh}, adult.AbnormalFlags())
+	assert.True(t, adult.IsAbnormal())
+
+	// Patients of unknown age are compared with adult ranges
+	unknown := infantVitals()
+	unknown.FlagAbnormal(&Patient{Gender: "male"})
+	assert.Equal(t, VitalFlagHigh, unknown.PulseRateFlag)
+	unknown = infantVitals()
+	unknown.FlagAbnormal(nil)
+	assert.Equal(t, VitalFlagHigh, unknown.PulseRateFlag)
+
+	// A pulse of 105 is expected in pregnancy; flags are recomputed each time
+	pregnant := &VitalSigns{MeasuredAt: measured, PulseRate: intPtr(105), DiastolicBP: intPtr(55), SpO2: intPtr(92)}
+	pregnant.FlagAbnormal(born(25, 0))
+	assert.Equal(t, VitalFlagHigh, pregnant.PulseRateFlag)
+	assert.Equal(t, VitalFlagLow, pregnant.DiastolicBPFlag)
+	pregnant.Pregnant = true
+	pregnant.FlagAbnormal(born(25, 0))
+	assert.Equal(t, map[string]string{VitalSpO2: VitalFlagLow}, pregnant.AbnormalFlags())
+	pregnant.SpO2 = nil
+	pregnant.FlagAbnormal(born(25, 0))
+	assert.Empty(t, pregnant.SpO2Flag)
+	assert.False(t, pregnant.IsAbnormal())
+}
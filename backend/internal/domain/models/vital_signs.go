@@ -15,7 +15,16 @@ type VitalSigns struct {
 	PatientID uint    `gorm:"index;not null" json:"patient_id"`
 	Patient   Patient `gorm:"foreignKey:PatientID" json:"patient,omitempty"`
 
-	MeasuredAt time.Time `gorm:"not null;index" json:"measured_at"`
+	MeasuredAt time.Time `gorm:"not null;index;index:idx_vital_signs_device_reading,unique,priority:2" json:"measured_at"`
+
+	// Source is manual or device. Device readings are pending until a nurse
+	// validates or rejects them; rejected readings are deleted.
+	Source             string     `gorm:"size:10;default:manual" json:"source"`
+	DeviceID           *uint      `gorm:"index:idx_vital_signs_device_reading,unique,priority:1" json:"device_id,omitempty"`
+	VerificationStatus string     `gorm:"size:20;index" json:"verification_status,omitempty"`
+	VerifiedBy         *uint      `json:"verified_by,omitempty"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	RejectionReason    string     `gorm:"type:text" json:"rejection_reason,omitempty"`
 
 	// Blood Pressure (mmHg)
 	SystolicBP  *int `json:"systolic_bp,omitempty"`  // Normal: 90-120
@@ -36,8 +45,15 @@ type VitalSigns struct {
 	// Weight (kg)
 	Weight *float64 `json:"weight,omitempty"`
 
-	// Height (cm)
-	Height *float64 `json:"height,omitempty"`
+	// Height (cm); length for children measured lying
+	Height         *float64 `json:"height,omitempty"`
+	LengthPosition string   `gorm:"size:10" json:"length_position,omitempty"` // recumbent, standing
+
+	// Mid-upper arm circumference (cm)
+	MUAC *float64 `gorm:"column:muac" json:"muac,omitempty"`
+
+	// Bilateral pitting oedema
+	Oedema bool `gorm:"default:false" json:"oedema"`
 
 	// BMI (calculated)
 	BMI *float64 `json:"bmi,omitempty"`
@@ -45,6 +61,43 @@ type VitalSigns struct {
 	// Pain Scale (0-10)
 	PainScale *int `json:"pain_scale,omitempty"`
 
+	// Pregnancy status when measured, for the reference ranges
+	Pregnant bool `gorm:"default:false" json:"pregnant"`
+
+	// Interpretation of each measured vital sign against the reference range
+	// for the patient's age, sex and pregnancy status: low, normal or high
+	SystolicBPFlag      string `gorm:"size:10" json:"systolic_bp_flag,omitempty"`
+	DiastolicBPFlag     string `gorm:"size:10" json:"diastolic_bp_flag,omitempty"`
+	PulseRateFlag       string `gorm:"size:10" json:"pulse_rate_flag,omitempty"`
+	RespiratoryRateFlag string `gorm:"size:10" json:"respiratory_rate_flag,omitempty"`
+	TemperatureFlag     string `gorm:"size:10" json:"temperature_flag,omitempty"`
+	SpO2Flag            string `gorm:"size:10" json:"spo2_flag,omitempty"`
+
+	// Level of consciousness (ACVPU): alert, confused (new), voice, pain, unresponsive
+	Consciousness string `gorm:"size:20" json:"consciousness,omitempty"`
+
+	// Supplemental oxygen
+	OnOxygen       bool     `gorm:"default:false" json:"on_oxygen"`
+	OxygenFlowRate *float64 `json:"oxygen_flow_rate,omitempty"` // L/min
+
+	// SpO2 scale 2 of NEWS2, for patients with hypercapnic respiratory failure (target 88-92%)
+	SpO2Scale2 bool `gorm:"column:spo2_scale2;default:false" json:"spo2_scale_2"`
+
+	// Paediatric assessment (PEWS)
+	Behaviour          string   `gorm:"size:20" json:"behaviour,omitempty"`          // playing, sleeping, irritable, lethargic
+	SkinColour         string   `gorm:"size:20" json:"skin_colour,omitempty"`        // pink, pale, grey, mottled
+	CapillaryRefill    *float64 `json:"capillary_refill,omitempty"`                  // seconds
+	RespiratoryEffort  string   `gorm:"size:20" json:"respiratory_effort,omitempty"` // normal, accessory-muscles, retractions, grunting
+	FrequentNebulisers bool     `gorm:"default:false" json:"frequent_nebulisers"`    // every 15 minutes
+	PersistentVomiting bool     `gorm:"default:false" json:"persistent_vomiting"`
+
+	// Early warning score (NEWS2 or PEWS), computed when recorded; parameters
+	// that were not measured score 0 and are listed in EWSMissing
+	EWSSystem  string   `gorm:"column:ews_system;size:10" json:"ews_system,omitempty"`
+	EWSScore   *int     `gorm:"column:ews_score" json:"ews_score,omitempty"`
+	EWSRisk    string   `gorm:"column:ews_risk;size:20" json:"ews_risk,omitempty"`
+	EWSMissing []string `gorm:"column:ews_missing;type:text;serializer:json" json:"ews_missing,omitempty"`
+
 	// Notes
 	Notes string `gorm:"type:text" json:"notes,omitempty"`
 
@@ -66,22 +119,19 @@ func (v *VitalSigns) CalculateBMI() {
 	}
 }
 
-// IsAbnormal checks if any vital signs are outside normal ranges
-func (v *VitalSigns) IsAbnormal() bool {
-	if v.SystolicBP != nil && (*v.SystolicBP < 90 || *v.SystolicBP > 140) {
-		return true
-	}
-	if v.DiastolicBP != nil && (*v.DiastolicBP < 60 || *v.DiastolicBP > 90) {
-		return true
+// Verify records a nurse's validation or rejection of a device reading
+func (v *VitalSigns) Verify(status string, by uint, at time.Time) error {
+	if v.VerificationStatus != VerificationPending {
+		return ErrVitalSignsValidated
 	}
-	if v.PulseRate != nil && (*v.PulseRate < 60 || *v.PulseRate > 100) {
-		return true
-	}
-	if v.Temperature != nil && (*v.Temperature < 36.1 || *v.Temperature > 37.8) {
-		return true
-	}
-	if v.SpO2 != nil && *v.SpO2 < 95 {
-		return true
-	}
-	return false
+	v.VerificationStatus = status
+	v.VerifiedBy = &by
+	v.VerifiedAt = &at
+	return nil
+}
+
+// IsAbnormal reports whether any vital sign was flagged outside its
+// reference range by FlagAbnormal
+func (v *VitalSigns) IsAbnormal() bool {
+	return len(v.AbnormalFlags()) > 0
 }
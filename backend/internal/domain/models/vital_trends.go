@@ -0,0 +1,133 @@
+package models
+
+import "time"
+
+// Trend periods
+const (
+	TrendPeriodDay   = "day"
+	TrendPeriodWeek  = "week"
+	TrendPeriodMonth = "month"
+)
+
+var (
+	ErrInvalidTrendVital  = &ValidationError{Field: "vitals", Message: "Unknown vital sign"}
+	ErrInvalidTrendPeriod = &ValidationError{Field: "period", Message: "Period must be day, week or month"}
+)
+
+// vitalTrendValues are the vital signs that can be charted, in display order
+var vitalTrendValues = []struct {
+	vital string
+	value func(v *VitalSigns) *float64
+}{
+	{VitalSystolicBP, func(v *VitalSigns) *float64 { return intValue(v.SystolicBP) }},
+	{VitalDiastolicBP, func(v *VitalSigns) *float64 { return intValue(v.DiastolicBP) }},
+	{VitalPulseRate, func(v *VitalSigns) *float64 { return intValue(v.PulseRate) }},
+	{VitalRespiratoryRate, func(v *VitalSigns) *float64 { return intValue(v.RespiratoryRate) }},
+	{VitalTemperature, func(v *VitalSigns) *float64 { return v.Temperature }},
+	{VitalSpO2, func(v *VitalSigns) *float64 { return intValue(v.SpO2) }},
+	{"weight", func(v *VitalSigns) *float64 { return v.Weight }},
+	{"height", func(v *VitalSigns) *float64 { return v.Height }},
+	{"bmi", func(v *VitalSigns) *float64 { return v.BMI }},
+	{"muac", func(v *VitalSigns) *float64 { return v.MUAC }},
+	{"pain_scale", func(v *VitalSigns) *float64 { return intValue(v.PainScale) }},
+	{"ews_score", func(v *VitalSigns) *float64 { return intValue(v.EWSScore) }},
+}
+
+// VitalTrendPoint is one measurement of a vital sign
+type VitalTrendPoint struct {
+	VitalSignsID uint      `json:"vital_signs_id"`
+	MeasuredAt   time.Time `json:"measured_at"`
+	Value        float64   `json:"value"`
+	Flag         string    `json:"flag,omitempty"`
+}
+
+// VitalTrendPeriod summarizes the measurements of a vital sign in a period
+type VitalTrendPeriod struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Mean  float64   `json:"mean"`
+}
+
+// VitalTrend is the time series of a vital sign
+type VitalTrend struct {
+	Vital   string             `json:"vital"`
+	Points  []VitalTrendPoint  `json:"points"`
+	Periods []VitalTrendPeriod `json:"periods"`
+}
+
+// TrendPeriodStart returns the start of the day, week (from Monday) or month
+// of a time, in its location
+func TrendPeriodStart(t time.Time, period string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case TrendPeriodWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case TrendPeriodMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// VitalTrends builds the series of the given vital signs (all when empty)
+// from observations in order of measurement, with per-period statistics.
+// Vital signs never measured get empty series.
+func VitalTrends(observations []*VitalSigns, vitals []string, period string) ([]VitalTrend, error) {
+	switch period {
+	case TrendPeriodDay, TrendPeriodWeek, TrendPeriodMonth:
+	default:
+		return nil, ErrInvalidTrendPeriod
+	}
+	if len(vitals) == 0 {
+		for _, tv := range vitalTrendValues {
+			vitals = append(vitals, tv.vital)
+		}
+	}
+
+	trends := make([]VitalTrend, 0, len(vitals))
+	for _, vital := range vitals {
+		var value func(v *VitalSigns) *float64
+		for _, tv := range vitalTrendValues {
+			if tv.vital == vital {
+				value = tv.value
+			}
+		}
+		if value == nil {
+			return nil, &ValidationError{Field: ErrInvalidTrendVital.Field, Message: ErrInvalidTrendVital.Message + ": " + vital}
+		}
+
+		trend := VitalTrend{Vital: vital, Points: []VitalTrendPoint{}, Periods: []VitalTrendPeriod{}}
+		var current *VitalTrendPeriod
+		for _, v := range observations {
+			x := value(v)
+			if x == nil {
+				continue
+			}
+			trend.Points = append(trend.Points, VitalTrendPoint{VitalSignsID: v.ID, MeasuredAt: v.MeasuredAt, Value: *x, Flag: v.flag(vital)})
+
+			start := TrendPeriodStart(v.MeasuredAt, period)
+			if current == nil || !current.Start.Equal(start) {
+				trend.Periods = append(trend.Periods, VitalTrendPeriod{Start: start, Min: *x, Max: *x})
+				current = &trend.Periods[len(trend.Periods)-1]
+			}
+			current.Count++
+			current.Min = min(current.Min, *x)
+			current.Max = max(current.Max, *x)
+			current.Mean += (*x - current.Mean) / float64(current.Count)
+		}
+		trends = append(trends, trend)
+	}
+	return trends, nil
+}
+
+// flag returns the reference range flag of a vital sign, if it has one
+func (v *VitalSigns) flag(vital string) string {
+	for _, field := range vitalFlagFields {
+		if field.vital == vital {
+			return *field.flag(v)
+		}
+	}
+	return ""
+}
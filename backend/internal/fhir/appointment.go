@@ -0,0 +1,122 @@
+package fhir
+
+import (
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Appointment is the FHIR R4 Appointment resource
+type Appointment struct {
+	ResourceType      string                   `json:"resourceType"`
+	ID                string                   `json:"id,omitempty"`
+	Meta              *Meta                    `json:"meta,omitempty"`
+	Status            string                   `json:"status"`
+	CancelationReason *CodeableConcept         `json:"cancelationReason,omitempty"`
+	AppointmentType   *CodeableConcept         `json:"appointmentType,omitempty"`
+	ReasonCode        []CodeableConcept        `json:"reasonCode,omitempty"`
+	Start             string                   `json:"start,omitempty"`
+	End               string                   `json:"end,omitempty"`
+	Comment           string                   `json:"comment,omitempty"`
+	Participant       []AppointmentParticipant `json:"participant"`
+}
+
+// AppointmentParticipant is a patient or practitioner taking part in an appointment
+type AppointmentParticipant struct {
+	Actor  *Reference `json:"actor,omitempty"`
+	Status string     `json:"status"`
+}
+
+var appointmentStatuses = newCodeMap(
+	[2]string{"scheduled", "booked"},
+	[2]string{"confirmed", "booked"},
+	[2]string{"arrived", "arrived"},
+	[2]string{"in-progress", "checked-in"},
+	[2]string{"completed", "fulfilled"},
+	[2]string{"cancelled", "cancelled"},
+	[2]string{"no-show", "noshow"},
+)
+
+// AppointmentStatusCodes returns the internal statuses matching a FHIR status
+func AppointmentStatusCodes(code string) []string {
+	return appointmentStatuses.InternalCodes(code)
+}
+
+// AppointmentFromModel maps an appointment record to a FHIR Appointment
+func AppointmentFromModel(a *models.Appointment) *Appointment {
+	res := &Appointment{
+		ResourceType:    "Appointment",
+		ID:              fmt.Sprint(a.ID),
+		Meta:            NewMeta(a.UpdatedAt),
+		Status:          appointmentStatuses.ToFHIR(a.Status, "proposed"),
+		AppointmentType: textConcept(a.AppointmentType),
+		Start:           FormatDateTime(a.ScheduledStart),
+		End:             FormatDateTime(a.ScheduledEnd),
+		Comment:         a.Notes,
+		Participant: []AppointmentParticipant{
+			{Actor: NewReference("Patient", a.PatientID), Status: "accepted"},
+		},
+	}
+	if a.CancellationReason != "" {
+		res.CancelationReason = textConcept(a.CancellationReason)
+	}
+	if a.Reason != "" {
+		res.ReasonCode = []CodeableConcept{{Text: a.Reason}}
+	}
+	if a.PractitionerID != nil {
+		res.Participant = append(res.Participant, AppointmentParticipant{
+			Actor:  NewReference("Practitioner", *a.PractitionerID),
+			Status: "accepted",
+		})
+	}
+	return res
+}
+
+// AppointmentToModel applies a FHIR Appointment onto an appointment record
+func AppointmentToModel(res *Appointment, a *models.Appointment) error {
+	if res.ResourceType != "Appointment" {
+		return fmt.Errorf("expected resourceType Appointment, got %q", res.ResourceType)
+	}
+
+	var err error
+	if a.Status, err = appointmentStatuses.FromFHIR(res.Status, a.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+
+	a.PatientID, a.PractitionerID = 0, nil
+	for _, participant := range res.Participant {
+		if participant.Actor == nil {
+			continue
+		}
+		if id, err := ParseReference(participant.Actor, "Patient"); err == nil && id != 0 {
+			a.PatientID = id
+		} else if id, err := ParseReference(participant.Actor, "Practitioner"); err == nil && id != 0 {
+			a.PractitionerID = &id
+		}
+	}
+	if a.PatientID == 0 {
+		return fmt.Errorf("a Patient participant is required")
+	}
+
+	if a.ScheduledStart, err = ParseDateTime(res.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if a.ScheduledEnd, err = ParseDateTime(res.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if a.ScheduledStart.IsZero() || a.ScheduledEnd.IsZero() {
+		return fmt.Errorf("start and end are required")
+	}
+	if a.ScheduledEnd.Before(a.ScheduledStart) {
+		return fmt.Errorf("end must not be before start")
+	}
+
+	a.AppointmentType = res.AppointmentType.TextOrCode()
+	a.Reason = ""
+	if len(res.ReasonCode) > 0 {
+		a.Reason = res.ReasonCode[0].TextOrCode()
+	}
+	a.Notes = res.Comment
+	a.CancellationReason = res.CancelationReason.TextOrCode()
+	return nil
+}
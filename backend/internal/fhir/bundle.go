@@ -0,0 +1,172 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bundle is a FHIR R4 searchset or transaction Bundle
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Total        *int64        `json:"total,omitempty"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string         `json:"fullUrl,omitempty"`
+	Resource interface{}    `json:"resource"`
+	Search   *BundleSearch  `json:"search,omitempty"`
+	Request  *BundleRequest `json:"request,omitempty"`
+}
+
+type BundleSearch struct {
+	Mode string `json:"mode"`
+}
+
+type BundleRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	IfNoneExist string `json:"ifNoneExist,omitempty"`
+}
+
+// NewBundleEntry wraps a search match. baseURL is the FHIR base, e.g. https://host/fhir/R4.
+func NewBundleEntry(baseURL, resourceType, id string, resource interface{}) BundleEntry {
+	return BundleEntry{
+		FullURL:  baseURL + "/" + resourceType + "/" + id,
+		Resource: resource,
+		Search:   &BundleSearch{Mode: "match"},
+	}
+}
+
+// NewSearchBundle builds a searchset Bundle with self/first/previous/next links.
+// Paging is offset based: the links carry _offset and _count on top of the
+// original search parameters.
+func NewSearchBundle(requestURL *url.URL, total int64, offset, count int, entries []BundleEntry) *Bundle {
+	bundle := &Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Total:        &total,
+		Entry:        entries,
+	}
+
+	link := func(relation string, offset int) {
+		u := *requestURL
+		query := u.Query()
+		query.Set("_offset", strconv.Itoa(offset))
+		query.Set("_count", strconv.Itoa(count))
+		u.RawQuery = query.Encode()
+		bundle.Link = append(bundle.Link, BundleLink{Relation: relation, URL: u.String()})
+	}
+
+	link("self", offset)
+	link("first", 0)
+	if offset > 0 {
+		previous := offset - count
+		if previous < 0 {
+			previous = 0
+		}
+		link("previous", previous)
+	}
+	if int64(offset+count) < total {
+		link("next", offset+count)
+	}
+	return bundle
+}
+
+// NewTransactionBundle packages resources as a transaction Bundle that another
+// server can POST to its base URL. Every resource gets a urn:uuid fullUrl and
+// references between bundled resources ("Encounter/4") are rewritten to those
+// urns, so the receiving facility assigns its own ids while keeping the links.
+// The Patient is created conditionally on its MRN so that transferring the same
+// record twice does not create a duplicate.
+func NewTransactionBundle(resources []interface{}) (*Bundle, error) {
+	bundle := &Bundle{
+		ResourceType: "Bundle",
+		Type:         "transaction",
+		Timestamp:    FormatDateTime(time.Now()),
+		Entry:        make([]BundleEntry, 0, len(resources)),
+	}
+
+	urns := map[string]string{}
+	for _, resource := range resources {
+		raw, err := json.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		resourceType, _ := fields["resourceType"].(string)
+		if resourceType == "" {
+			return nil, fmt.Errorf("transaction entry %d has no resourceType", len(bundle.Entry))
+		}
+
+		urn := "urn:uuid:" + uuid.NewString()
+		if id, _ := fields["id"].(string); id != "" {
+			urns[resourceType+"/"+id] = urn
+		}
+		delete(fields, "id")
+		delete(fields, "meta")
+
+		request := &BundleRequest{Method: "POST", URL: resourceType}
+		if resourceType == "Patient" {
+			if mrn := mrnIdentifier(fields); mrn != "" {
+				request.IfNoneExist = "identifier=" + SystemMRN + "|" + mrn
+			}
+		}
+		bundle.Entry = append(bundle.Entry, BundleEntry{FullURL: urn, Resource: fields, Request: request})
+	}
+
+	// References can point forwards, so rewrite once every urn is known
+	for _, entry := range bundle.Entry {
+		rewriteReferences(entry.Resource, urns)
+	}
+	return bundle, nil
+}
+
+// rewriteReferences replaces every "reference" that points at a bundled resource with its urn
+func rewriteReferences(value interface{}, urns map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if ref, ok := child.(string); ok && key == "reference" {
+				if urn, found := urns[ref]; found {
+					v[key] = urn
+				}
+				continue
+			}
+			rewriteReferences(child, urns)
+		}
+	case []interface{}:
+		for _, child := range v {
+			rewriteReferences(child, urns)
+		}
+	}
+}
+
+func mrnIdentifier(fields map[string]interface{}) string {
+	identifiers, _ := fields["identifier"].([]interface{})
+	for _, identifier := range identifiers {
+		ident, _ := identifier.(map[string]interface{})
+		if system, _ := ident["system"].(string); system == SystemMRN {
+			value, _ := ident["value"].(string)
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package fhir
+
+import "time"
+
+// FHIRVersion is the FHIR release implemented by the facade
+const FHIRVersion = "4.0.1"
+
+// SearchParam describes a supported search parameter
+type SearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Common search parameters supported by every resource type
+var commonSearchParams = []SearchParam{
+	{Name: "_id", Type: "token"},
+	{Name: "_count", Type: "number"},
+	{Name: "_offset", Type: "number"},
+}
+
+// SupportedResources lists the resource types served and their search parameters
+var SupportedResources = map[string][]SearchParam{
+	"Patient": {
+		{Name: "identifier", Type: "token"},
+		{Name: "name", Type: "string"},
+		{Name: "gender", Type: "token"},
+		{Name: "birthdate", Type: "date"},
+	},
+	"Encounter": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "date", Type: "date"},
+	},
+	"Appointment": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "date", Type: "date"},
+	},
+	"ServiceRequest": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "authored", Type: "date"},
+	},
+	"Observation": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "date", Type: "date"},
+		{Name: "category", Type: "token"},
+	},
+	"MedicationRequest": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "authoredon", Type: "date"},
+	},
+	"ImagingStudy": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "started", Type: "date"},
+	},
+	"QuestionnaireResponse": {
+		{Name: "patient", Type: "reference"},
+		{Name: "status", Type: "token"},
+		{Name: "authored", Type: "date"},
+	},
+	"Questionnaire": {
+		{Name: "status", Type: "token"},
+		{Name: "date", Type: "date"},
+	},
+}
+
+// readOnlyResources are served for read and search only; they are written
+// through their own API, e.g. NCD screenings as QuestionnaireResponse
+var readOnlyResources = map[string]bool{
+	"QuestionnaireResponse": true,
+	"Questionnaire":         true,
+}
+
+// supportedResourceOrder keeps the CapabilityStatement output stable
+var supportedResourceOrder = []string{
+	"Patient", "Encounter", "Appointment", "ServiceRequest", "Observation", "MedicationRequest", "ImagingStudy",
+	"QuestionnaireResponse", "Questionnaire",
+}
+
+// CapabilityStatement describes the server's FHIR capabilities
+type CapabilityStatement struct {
+	ResourceType string                    `json:"resourceType"`
+	Status       string                    `json:"status"`
+	Date         string                    `json:"date"`
+	Kind         string                    `json:"kind"`
+	Software     CapabilitySoftware        `json:"software"`
+	FHIRVersion  string                    `json:"fhirVersion"`
+	Format       []string                  `json:"format"`
+	Rest         []CapabilityStatementRest `json:"rest"`
+}
+
+type CapabilitySoftware struct {
+	Name string `json:"name"`
+}
+
+type CapabilityStatementRest struct {
+	Mode      string                `json:"mode"`
+	Security  *CapabilitySecurity   `json:"security,omitempty"`
+	Resource  []CapabilityResource  `json:"resource"`
+	Operation []CapabilityOperation `json:"operation,omitempty"`
+}
+
+type CapabilitySecurity struct {
+	Description string `json:"description"`
+}
+
+type CapabilityResource struct {
+	Type        string                `json:"type"`
+	Interaction []CapabilityAction    `json:"interaction"`
+	SearchParam []SearchParam         `json:"searchParam"`
+	Operation   []CapabilityOperation `json:"operation,omitempty"`
+}
+
+type CapabilityOperation struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+type CapabilityAction struct {
+	Code string `json:"code"`
+}
+
+// NewCapabilityStatement describes the read/search/create/update support of the
+// facade and the $everything and $export operations
+func NewCapabilityStatement() *CapabilityStatement {
+	rest := CapabilityStatementRest{
+		Mode:     "server",
+		Security: &CapabilitySecurity{Description: "Bearer tokens issued by POST /api/v1/auth/login"},
+	}
+	for _, resourceType := range supportedResourceOrder {
+		params := append(append([]SearchParam{}, SupportedResources[resourceType]...), commonSearchParams...)
+		interactions := []CapabilityAction{{Code: "read"}, {Code: "search-type"}}
+		if !readOnlyResources[resourceType] {
+			interactions = append(interactions, CapabilityAction{Code: "create"}, CapabilityAction{Code: "update"})
+		}
+		rest.Resource = append(rest.Resource, CapabilityResource{
+			Type:        resourceType,
+			Interaction: interactions,
+			SearchParam: params,
+		})
+	}
+	for i := range rest.Resource {
+		if rest.Resource[i].Type == "Patient" {
+			rest.Resource[i].Operation = []CapabilityOperation{
+				{Name: "everything", Definition: "http://hl7.org/fhir/OperationDefinition/Patient-everything"},
+			}
+		}
+	}
+	rest.Operation = []CapabilityOperation{
+		{Name: "export", Definition: "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/export"},
+	}
+
+	return &CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         time.Now().UTC().Format(DateFormat),
+		Kind:         "instance",
+		Software:     CapabilitySoftware{Name: "Zarish-HIS"},
+		FHIRVersion:  FHIRVersion,
+		Format:       []string{"application/fhir+json", "json"},
+		Rest:         []CapabilityStatementRest{rest},
+	}
+}
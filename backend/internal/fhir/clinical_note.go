@@ -0,0 +1,199 @@
+package fhir
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Composition is the FHIR R4 Composition resource, used for structured clinical notes
+type Composition struct {
+	ResourceType string                `json:"resourceType"`
+	ID           string                `json:"id,omitempty"`
+	Meta         *Meta                 `json:"meta,omitempty"`
+	Status       string                `json:"status"`
+	Type         CodeableConcept       `json:"type"`
+	Subject      *Reference            `json:"subject"`
+	Encounter    *Reference            `json:"encounter,omitempty"`
+	Date         string                `json:"date"`
+	Author       []Reference           `json:"author"`
+	Title        string                `json:"title"`
+	Attester     []CompositionAttester `json:"attester,omitempty"`
+	Section      []CompositionSection  `json:"section,omitempty"`
+}
+
+type CompositionAttester struct {
+	Mode  string     `json:"mode"`
+	Time  string     `json:"time,omitempty"`
+	Party *Reference `json:"party,omitempty"`
+}
+
+type CompositionSection struct {
+	Title string     `json:"title"`
+	Text  *Narrative `json:"text"`
+}
+
+type Narrative struct {
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+// DocumentReference is the FHIR R4 DocumentReference resource. Clinical notes are
+// also exported this way so systems without Composition support can display them.
+type DocumentReference struct {
+	ResourceType string                     `json:"resourceType"`
+	ID           string                     `json:"id,omitempty"`
+	Meta         *Meta                      `json:"meta,omitempty"`
+	Status       string                     `json:"status"`
+	DocStatus    string                     `json:"docStatus,omitempty"`
+	Type         *CodeableConcept           `json:"type,omitempty"`
+	Subject      *Reference                 `json:"subject,omitempty"`
+	Date         string                     `json:"date,omitempty"`
+	Author       []Reference                `json:"author,omitempty"`
+	Content      []DocumentReferenceContent `json:"content"`
+	Context      *DocumentReferenceContext  `json:"context,omitempty"`
+}
+
+type DocumentReferenceContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+type DocumentReferenceContext struct {
+	Encounter []Reference `json:"encounter,omitempty"`
+}
+
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Data        string `json:"data,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// LOINC document types for the internal note types
+var noteTypeCodes = map[string]Coding{
+	"soap":         {System: SystemLOINC, Code: "11506-3", Display: "Progress note"},
+	"progress":     {System: SystemLOINC, Code: "11506-3", Display: "Progress note"},
+	"discharge":    {System: SystemLOINC, Code: "18842-5", Display: "Discharge summary"},
+	"admission":    {System: SystemLOINC, Code: "34117-2", Display: "History and physical note"},
+	"consultation": {System: SystemLOINC, Code: "11488-4", Display: "Consult note"},
+}
+
+var compositionStatuses = newCodeMap(
+	[2]string{"draft", "preliminary"},
+	[2]string{"final", "final"},
+	[2]string{"amended", "amended"},
+)
+
+// noteSections lists the note fields in display order
+func noteSections(n *models.ClinicalNote) [][2]string {
+	return [][2]string{
+		{"Chief complaint", n.ChiefComplaint},
+		{"History of present illness", n.HistoryPresentIllness},
+		{"Subjective", n.Subjective},
+		{"Review of systems", n.ReviewOfSystems},
+		{"Physical examination", n.PhysicalExamination},
+		{"Objective", n.Objective},
+		{"Assessment", n.Assessment},
+		{"Differential diagnosis", n.DifferentialDiagnosis},
+		{"Plan", n.Plan},
+		{"Treatment plan", n.TreatmentPlan},
+		{"Follow-up instructions", n.FollowUpInstructions},
+	}
+}
+
+func noteType(n *models.ClinicalNote) CodeableConcept {
+	concept := CodeableConcept{Text: n.NoteType}
+	if coding, ok := noteTypeCodes[n.NoteType]; ok {
+		concept.Coding = []Coding{coding}
+	}
+	return concept
+}
+
+func noteStatus(n *models.ClinicalNote) string {
+	if n.IsAmended {
+		return "amended"
+	}
+	return compositionStatuses.ToFHIR(n.Status, "preliminary")
+}
+
+// CompositionFromClinicalNote maps a clinical note to a Composition with one section per filled-in field
+func CompositionFromClinicalNote(n *models.ClinicalNote) *Composition {
+	res := &Composition{
+		ResourceType: "Composition",
+		ID:           fmt.Sprint(n.ID),
+		Meta:         NewMeta(n.UpdatedAt),
+		Status:       noteStatus(n),
+		Type:         noteType(n),
+		Subject:      NewReference("Patient", n.PatientID),
+		Encounter:    NewReference("Encounter", n.EncounterID),
+		Date:         FormatDateTime(n.NoteDate),
+		Title:        "Clinical note",
+	}
+	if n.NoteType != "" {
+		res.Title = strings.ToUpper(n.NoteType[:1]) + n.NoteType[1:] + " note"
+	}
+	if author := NewReference("Practitioner", n.PractitionerID); author != nil {
+		res.Author = []Reference{*author}
+	} else {
+		res.Author = []Reference{{Display: "Unknown"}}
+	}
+	if n.SignedBy != nil {
+		res.Attester = []CompositionAttester{{
+			Mode:  "legal",
+			Time:  FormatDateTimePtr(n.SignedAt),
+			Party: NewReference("Practitioner", *n.SignedBy),
+		}}
+	}
+	for _, section := range noteSections(n) {
+		if section[1] == "" {
+			continue
+		}
+		res.Section = append(res.Section, CompositionSection{
+			Title: section[0],
+			Text: &Narrative{
+				Status: "generated",
+				Div:    `<div xmlns="http://www.w3.org/1999/xhtml">` + html.EscapeString(section[1]) + `</div>`,
+			},
+		})
+	}
+	return res
+}
+
+// DocumentReferenceFromClinicalNote maps a clinical note to a DocumentReference
+// carrying the note as plain text
+func DocumentReferenceFromClinicalNote(n *models.ClinicalNote) *DocumentReference {
+	var text strings.Builder
+	for _, section := range noteSections(n) {
+		if section[1] != "" {
+			fmt.Fprintf(&text, "%s:\n%s\n\n", section[0], section[1])
+		}
+	}
+
+	docType := noteType(n)
+	res := &DocumentReference{
+		ResourceType: "DocumentReference",
+		ID:           fmt.Sprint(n.ID),
+		Meta:         NewMeta(n.UpdatedAt),
+		Status:       "current",
+		DocStatus:    noteStatus(n),
+		Type:         &docType,
+		Subject:      NewReference("Patient", n.PatientID),
+		Date:         FormatDateTime(n.NoteDate),
+		Content: []DocumentReferenceContent{{
+			Attachment: Attachment{
+				ContentType: "text/plain; charset=utf-8",
+				Data:        base64.StdEncoding.EncodeToString([]byte(strings.TrimSpace(text.String()))),
+				Title:       docType.TextOrCode(),
+			},
+		}},
+	}
+	if encounter := NewReference("Encounter", n.EncounterID); encounter != nil {
+		res.Context = &DocumentReferenceContext{Encounter: []Reference{*encounter}}
+	}
+	if author := NewReference("Practitioner", n.PractitionerID); author != nil {
+		res.Author = []Reference{*author}
+	}
+	return res
+}
@@ -0,0 +1,294 @@
+package fhir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Code systems and identifier namespaces used by the Zarish-HIS FHIR facade
+const (
+	SystemMRN            = models.IdentifierSystemMRN
+	SystemNationalID     = models.IdentifierSystemNationalID
+	SystemBirthReg       = models.IdentifierSystemBirthReg
+	SystemUNHCR          = models.IdentifierSystemUNHCR
+	SystemAccession      = "urn:zarish-his:accession"
+	SystemDICOMUID       = "urn:dicom:uid"
+	SystemLOINC          = "http://loinc.org"
+	SystemUCUM           = "http://unitsofmeasure.org"
+	SystemActCode        = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	SystemObsCategory    = "http://terminology.hl7.org/CodeSystem/observation-category"
+	SystemDICOMDCM       = "http://dicom.nema.org/resources/ontology/DCM"
+	SystemLabTestCode    = "urn:zarish-his:lab-test"
+	SystemIdentifierType = "http://terminology.hl7.org/CodeSystem/v2-0203"
+
+	ExtensionBase        = "https://zarish-his.org/fhir/StructureDefinition/"
+	ExtensionNationality = ExtensionBase + "nationality"
+	ExtensionCampName    = ExtensionBase + "camp-name"
+	ExtensionBlockNumber = ExtensionBase + "camp-block"
+)
+
+// FHIR date/time formats
+const (
+	DateFormat     = "2006-01-02"
+	DateTimeFormat = time.RFC3339
+)
+
+type Meta struct {
+	VersionID   string `json:"versionId,omitempty"`
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+type Extension struct {
+	URL             string      `json:"url"`
+	ValueString     string      `json:"valueString,omitempty"`
+	ValueBoolean    *bool       `json:"valueBoolean,omitempty"`
+	ValueInteger    *int        `json:"valueInteger,omitempty"`
+	ValueDecimal    *float64    `json:"valueDecimal,omitempty"`
+	ValueDate       string      `json:"valueDate,omitempty"`
+	ValueCoding     *Coding     `json:"valueCoding,omitempty"`
+	ValueExpression *Expression `json:"valueExpression,omitempty"`
+}
+
+// Expression is an expression in a given language, e.g. FHIRPath
+type Expression struct {
+	Description string `json:"description,omitempty"`
+	Language    string `json:"language"`
+	Expression  string `json:"expression,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	Use      string           `json:"use,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	Period   *Period          `json:"period,omitempty"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+	Rank   int    `json:"rank,omitempty"`
+}
+
+type Address struct {
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Quantity struct {
+	Value  *float64 `json:"value,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+	System string   `json:"system,omitempty"`
+	Code   string   `json:"code,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+// NewReference builds a literal reference such as "Patient/12"
+func NewReference(resourceType string, id uint) *Reference {
+	if id == 0 {
+		return nil
+	}
+	return &Reference{Reference: fmt.Sprintf("%s/%d", resourceType, id)}
+}
+
+// ParseReference extracts the numeric ID from a reference of the given type.
+// Both "Patient/12" and "12" are accepted.
+func ParseReference(ref *Reference, resourceType string) (uint, error) {
+	if ref == nil || ref.Reference == "" {
+		return 0, nil
+	}
+	value := strings.TrimPrefix(ref.Reference, resourceType+"/")
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s reference %q", resourceType, ref.Reference)
+	}
+	return uint(id), nil
+}
+
+// FormatDateTime formats a time as a FHIR dateTime
+func FormatDateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(DateTimeFormat)
+}
+
+// FormatDateTimePtr formats an optional time as a FHIR dateTime
+func FormatDateTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return FormatDateTime(*t)
+}
+
+// ParseDateTime parses a FHIR date or dateTime. An empty string yields the zero time.
+func ParseDateTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(DateTimeFormat, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(DateFormat, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date/time %q", value)
+}
+
+// ParseDateTimePtr parses an optional FHIR date or dateTime
+func ParseDateTimePtr(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := ParseDateTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// NewMeta builds resource metadata from the record's last update time
+func NewMeta(updatedAt time.Time) *Meta {
+	if updatedAt.IsZero() {
+		return nil
+	}
+	return &Meta{LastUpdated: FormatDateTime(updatedAt)}
+}
+
+// TextOrCode returns the concept's text, falling back to the first coding's display or code
+func (c *CodeableConcept) TextOrCode() string {
+	if c == nil {
+		return ""
+	}
+	if c.Text != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+		if coding.Code != "" {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+// CodeFor returns the code of the first coding with the given system
+func (c *CodeableConcept) CodeFor(system string) string {
+	if c == nil {
+		return ""
+	}
+	for _, coding := range c.Coding {
+		if coding.System == system {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+// textConcept wraps free text in a CodeableConcept
+func textConcept(text string) *CodeableConcept {
+	if text == "" {
+		return nil
+	}
+	return &CodeableConcept{Text: text}
+}
+
+// codeMap is a two-way mapping between internal status/class codes and FHIR codes.
+// Several internal codes may share one FHIR code; the first listed is used when
+// mapping back.
+type codeMap struct {
+	order    []string
+	toFHIR   map[string]string
+	fromFHIR map[string]string
+}
+
+// newCodeMap builds a codeMap from internal/FHIR code pairs
+func newCodeMap(pairs ...[2]string) *codeMap {
+	m := &codeMap{toFHIR: map[string]string{}, fromFHIR: map[string]string{}}
+	for _, pair := range pairs {
+		m.order = append(m.order, pair[0])
+		m.toFHIR[pair[0]] = pair[1]
+		if _, exists := m.fromFHIR[pair[1]]; !exists {
+			m.fromFHIR[pair[1]] = pair[0]
+		}
+	}
+	return m
+}
+
+// ToFHIR maps an internal code, returning fallback if it is unknown
+func (m *codeMap) ToFHIR(internal, fallback string) string {
+	if code, ok := m.toFHIR[internal]; ok {
+		return code
+	}
+	return fallback
+}
+
+// FromFHIR maps a FHIR code to an internal code. The current internal code is kept
+// when it already maps to the same FHIR code, so lossy mappings survive a round trip.
+func (m *codeMap) FromFHIR(code, current string) (string, error) {
+	if code == "" {
+		return current, nil
+	}
+	if current != "" && m.toFHIR[current] == code {
+		return current, nil
+	}
+	internal, ok := m.fromFHIR[code]
+	if !ok {
+		return "", fmt.Errorf("unsupported code %q", code)
+	}
+	return internal, nil
+}
+
+// InternalCodes returns every internal code that maps to the FHIR code
+func (m *codeMap) InternalCodes(code string) []string {
+	var codes []string
+	for _, internal := range m.order {
+		if m.toFHIR[internal] == code {
+			codes = append(codes, internal)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,86 @@
+package fhir
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// DiagnosticReport is the FHIR R4 DiagnosticReport resource, used for radiology reports
+type DiagnosticReport struct {
+	ResourceType       string            `json:"resourceType"`
+	ID                 string            `json:"id,omitempty"`
+	Meta               *Meta             `json:"meta,omitempty"`
+	Status             string            `json:"status"`
+	Category           []CodeableConcept `json:"category,omitempty"`
+	Code               CodeableConcept   `json:"code"`
+	Subject            *Reference        `json:"subject,omitempty"`
+	Encounter          *Reference        `json:"encounter,omitempty"`
+	EffectiveDateTime  string            `json:"effectiveDateTime,omitempty"`
+	Issued             string            `json:"issued,omitempty"`
+	ResultsInterpreter []Reference       `json:"resultsInterpreter,omitempty"`
+	ImagingStudy       []Reference       `json:"imagingStudy,omitempty"`
+	Conclusion         string            `json:"conclusion,omitempty"`
+	PresentedForm      []Attachment      `json:"presentedForm,omitempty"`
+}
+
+var diagnosticReportStatuses = newCodeMap(
+	[2]string{"draft", "registered"},
+	[2]string{"preliminary", "preliminary"},
+	[2]string{"final", "final"},
+	[2]string{"amended", "amended"},
+)
+
+// DiagnosticReportFromRadiologyReport maps a radiology report to a FHIR DiagnosticReport.
+// The study is needed for the patient, encounter and modality.
+func DiagnosticReportFromRadiologyReport(r *models.RadiologyReport, study *models.ImagingStudy) *DiagnosticReport {
+	res := &DiagnosticReport{
+		ResourceType: "DiagnosticReport",
+		ID:           fmt.Sprint(r.ID),
+		Meta:         NewMeta(r.UpdatedAt),
+		Status:       diagnosticReportStatuses.ToFHIR(r.Status, "unknown"),
+		Category: []CodeableConcept{{Coding: []Coding{{
+			System:  "http://terminology.hl7.org/CodeSystem/v2-0074",
+			Code:    "RAD",
+			Display: "Radiology",
+		}}}},
+		Code:              CodeableConcept{Text: strings.TrimSpace(study.Modality + " " + study.Description)},
+		Subject:           NewReference("Patient", study.PatientID),
+		EffectiveDateTime: FormatDateTime(study.StartedAt),
+		Issued:            FormatDateTime(r.ReportedAt),
+		ImagingStudy:      []Reference{*NewReference("ImagingStudy", study.ID)},
+		Conclusion:        r.Conclusion,
+	}
+	if res.Code.Text == "" {
+		res.Code.Text = "Imaging report"
+	}
+	if study.EncounterID != nil {
+		res.Encounter = NewReference("Encounter", *study.EncounterID)
+	}
+	if interpreter := NewReference("Practitioner", r.RadiologistID); interpreter != nil {
+		res.ResultsInterpreter = []Reference{*interpreter}
+	}
+	if r.FinalizedAt != nil {
+		res.Issued = FormatDateTime(*r.FinalizedAt)
+	}
+	if r.Conclusion == "" {
+		res.Conclusion = r.Impression
+	}
+
+	var text strings.Builder
+	for _, part := range [][2]string{{"Findings", r.Findings}, {"Impression", r.Impression}, {"Conclusion", r.Conclusion}} {
+		if part[1] != "" {
+			fmt.Fprintf(&text, "%s:\n%s\n\n", part[0], part[1])
+		}
+	}
+	if text.Len() > 0 {
+		res.PresentedForm = []Attachment{{
+			ContentType: "text/plain; charset=utf-8",
+			Data:        base64.StdEncoding.EncodeToString([]byte(strings.TrimSpace(text.String()))),
+			Title:       "Radiology report",
+		}}
+	}
+	return res
+}
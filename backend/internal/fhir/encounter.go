@@ -0,0 +1,162 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Encounter is the FHIR R4 Encounter resource
+type Encounter struct {
+	ResourceType    string            `json:"resourceType"`
+	ID              string            `json:"id,omitempty"`
+	Meta            *Meta             `json:"meta,omitempty"`
+	Status          string            `json:"status"`
+	Class           Coding            `json:"class"`
+	Type            []CodeableConcept `json:"type,omitempty"`
+	ServiceType     *CodeableConcept  `json:"serviceType,omitempty"`
+	Priority        *CodeableConcept  `json:"priority,omitempty"`
+	Subject         *Reference        `json:"subject,omitempty"`
+	Participant     []Participant     `json:"participant,omitempty"`
+	Appointment     []Reference       `json:"appointment,omitempty"`
+	Period          *Period           `json:"period,omitempty"`
+	ReasonCode      []CodeableConcept `json:"reasonCode,omitempty"`
+	Hospitalization *Hospitalization  `json:"hospitalization,omitempty"`
+}
+
+// Participant is a practitioner involved in an encounter or appointment
+type Participant struct {
+	Actor  *Reference `json:"actor,omitempty"`
+	Status string     `json:"status,omitempty"`
+}
+
+// Hospitalization carries the encounter's discharge details
+type Hospitalization struct {
+	DischargeDisposition *CodeableConcept `json:"dischargeDisposition,omitempty"`
+}
+
+// Encounter statuses are already FHIR codes; classes are stored lowercase
+var (
+	encounterStatuses = newCodeMap(
+		[2]string{"planned", "planned"},
+		[2]string{"arrived", "arrived"},
+		[2]string{"triaged", "triaged"},
+		[2]string{"in-progress", "in-progress"},
+		[2]string{"onleave", "onleave"},
+		[2]string{"finished", "finished"},
+		[2]string{"cancelled", "cancelled"},
+		[2]string{"entered-in-error", "entered-in-error"},
+	)
+	encounterClasses = newCodeMap(
+		[2]string{"amb", "AMB"},
+		[2]string{"imp", "IMP"},
+		[2]string{"emer", "EMER"},
+		[2]string{"hh", "HH"},
+		[2]string{"vr", "VR"},
+	)
+)
+
+// EncounterStatusCodes returns the internal statuses matching a FHIR status
+func EncounterStatusCodes(code string) []string {
+	return encounterStatuses.InternalCodes(code)
+}
+
+// EncounterFromModel maps an encounter record to a FHIR Encounter
+func EncounterFromModel(e *models.Encounter) *Encounter {
+	res := &Encounter{
+		ResourceType: "Encounter",
+		ID:           fmt.Sprint(e.ID),
+		Meta:         NewMeta(e.UpdatedAt),
+		Status:       encounterStatuses.ToFHIR(e.Status, "unknown"),
+		Class:        Coding{System: SystemActCode, Code: encounterClasses.ToFHIR(e.Class, strings.ToUpper(e.Class))},
+		ServiceType:  textConcept(e.ServiceType),
+		Priority:     textConcept(e.Priority),
+		Subject:      NewReference("Patient", e.PatientID),
+		Period:       &Period{Start: FormatDateTime(e.PeriodStart), End: FormatDateTimePtr(e.PeriodEnd)},
+	}
+	if e.Type != "" {
+		res.Type = []CodeableConcept{{Text: e.Type}}
+	}
+	if e.PractitionerID != nil {
+		res.Participant = []Participant{{Actor: NewReference("Practitioner", *e.PractitionerID)}}
+	}
+	if e.AppointmentID != nil {
+		res.Appointment = []Reference{*NewReference("Appointment", *e.AppointmentID)}
+	}
+	if e.Reason != "" {
+		res.ReasonCode = []CodeableConcept{{Text: e.Reason}}
+	}
+	if e.DischargeDisposition != "" {
+		res.Hospitalization = &Hospitalization{DischargeDisposition: textConcept(e.DischargeDisposition)}
+	}
+	return res
+}
+
+// EncounterToModel applies a FHIR Encounter onto an encounter record
+func EncounterToModel(res *Encounter, e *models.Encounter) error {
+	if res.ResourceType != "Encounter" {
+		return fmt.Errorf("expected resourceType Encounter, got %q", res.ResourceType)
+	}
+
+	var err error
+	if e.Status, err = encounterStatuses.FromFHIR(res.Status, e.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	if e.Class, err = encounterClasses.FromFHIR(res.Class.Code, e.Class); err != nil {
+		return fmt.Errorf("class: %w", err)
+	}
+	if e.PatientID, err = ParseReference(res.Subject, "Patient"); err != nil {
+		return err
+	}
+	if e.PatientID == 0 {
+		return fmt.Errorf("subject is required")
+	}
+
+	e.Type = ""
+	if len(res.Type) > 0 {
+		e.Type = res.Type[0].TextOrCode()
+	}
+	e.ServiceType = res.ServiceType.TextOrCode()
+	e.Priority = res.Priority.TextOrCode()
+
+	e.PractitionerID = nil
+	for _, participant := range res.Participant {
+		if id, err := ParseReference(participant.Actor, "Practitioner"); err != nil {
+			return err
+		} else if id != 0 {
+			e.PractitionerID = &id
+			break
+		}
+	}
+
+	e.AppointmentID = nil
+	if len(res.Appointment) > 0 {
+		id, err := ParseReference(&res.Appointment[0], "Appointment")
+		if err != nil {
+			return err
+		}
+		e.AppointmentID = &id
+	}
+
+	if res.Period != nil {
+		if res.Period.Start != "" {
+			if e.PeriodStart, err = ParseDateTime(res.Period.Start); err != nil {
+				return fmt.Errorf("period.start: %w", err)
+			}
+		}
+		if e.PeriodEnd, err = ParseDateTimePtr(res.Period.End); err != nil {
+			return fmt.Errorf("period.end: %w", err)
+		}
+	}
+
+	e.Reason = ""
+	if len(res.ReasonCode) > 0 {
+		e.Reason = res.ReasonCode[0].TextOrCode()
+	}
+	e.DischargeDisposition = ""
+	if res.Hospitalization != nil {
+		e.DischargeDisposition = res.Hospitalization.DischargeDisposition.TextOrCode()
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// ExtensionBodySite carries the study-level body site, which R4 only defines per series
+const ExtensionBodySite = ExtensionBase + "imaging-body-site"
+
+// ImagingStudy is the FHIR R4 ImagingStudy resource
+type ImagingStudy struct {
+	ResourceType      string               `json:"resourceType"`
+	ID                string               `json:"id,omitempty"`
+	Meta              *Meta                `json:"meta,omitempty"`
+	Extension         []Extension          `json:"extension,omitempty"`
+	Identifier        []Identifier         `json:"identifier,omitempty"`
+	Status            string               `json:"status"`
+	Modality          []Coding             `json:"modality,omitempty"`
+	Subject           *Reference           `json:"subject"`
+	Encounter         *Reference           `json:"encounter,omitempty"`
+	Started           string               `json:"started,omitempty"`
+	Referrer          *Reference           `json:"referrer,omitempty"`
+	NumberOfSeries    int                  `json:"numberOfSeries,omitempty"`
+	NumberOfInstances int                  `json:"numberOfInstances,omitempty"`
+	Description       string               `json:"description,omitempty"`
+	Series            []ImagingStudySeries `json:"series,omitempty"`
+}
+
+type ImagingStudySeries struct {
+	UID               string  `json:"uid"`
+	Number            int     `json:"number,omitempty"`
+	Modality          Coding  `json:"modality"`
+	Description       string  `json:"description,omitempty"`
+	NumberOfInstances int     `json:"numberOfInstances,omitempty"`
+	BodySite          *Coding `json:"bodySite,omitempty"`
+}
+
+var imagingStudyStatuses = newCodeMap(
+	[2]string{"scheduled", "registered"},
+	[2]string{"in-progress", "registered"},
+	[2]string{"completed", "available"},
+	[2]string{"cancelled", "cancelled"},
+)
+
+// ImagingStudyStatusCodes returns the internal study statuses matching a FHIR status
+func ImagingStudyStatusCodes(code string) []string {
+	return imagingStudyStatuses.InternalCodes(code)
+}
+
+// ImagingStudyFromModel maps an imaging study to a FHIR ImagingStudy
+func ImagingStudyFromModel(s *models.ImagingStudy) *ImagingStudy {
+	res := &ImagingStudy{
+		ResourceType:      "ImagingStudy",
+		ID:                fmt.Sprint(s.ID),
+		Meta:              NewMeta(s.UpdatedAt),
+		Status:            imagingStudyStatuses.ToFHIR(s.Status, "unknown"),
+		Subject:           NewReference("Patient", s.PatientID),
+		Started:           FormatDateTime(s.StartedAt),
+		NumberOfSeries:    s.NumberOfSeries,
+		NumberOfInstances: s.NumberOfInstances,
+		Description:       s.Description,
+	}
+	res.Identifier = append(res.Identifier, Identifier{System: SystemDICOMUID, Value: "urn:oid:" + s.StudyUID})
+	if s.AccessionNumber != "" {
+		res.Identifier = append(res.Identifier, Identifier{System: SystemAccession, Value: s.AccessionNumber})
+	}
+	if s.Modality != "" {
+		res.Modality = []Coding{{System: SystemDICOMDCM, Code: s.Modality}}
+	}
+	if s.EncounterID != nil {
+		res.Encounter = NewReference("Encounter", *s.EncounterID)
+	}
+	if s.ReferrerID != nil {
+		res.Referrer = NewReference("Practitioner", *s.ReferrerID)
+	}
+	if s.BodySite != "" {
+		res.Extension = []Extension{{URL: ExtensionBodySite, ValueString: s.BodySite}}
+	}
+	for _, series := range s.Series {
+		out := ImagingStudySeries{
+			UID:               series.SeriesUID,
+			Number:            series.Number,
+			Modality:          Coding{System: SystemDICOMDCM, Code: series.Modality},
+			Description:       series.Description,
+			NumberOfInstances: len(series.Instances),
+		}
+		if series.BodyPart != "" {
+			out.BodySite = &Coding{Display: series.BodyPart}
+		}
+		res.Series = append(res.Series, out)
+	}
+	return res
+}
+
+// ImagingStudyToModel applies a FHIR ImagingStudy onto an imaging study. Series and
+// instances are managed by the radiology workflow and are not written back.
+func ImagingStudyToModel(res *ImagingStudy, s *models.ImagingStudy) error {
+	if res.ResourceType != "ImagingStudy" {
+		return fmt.Errorf("expected resourceType ImagingStudy, got %q", res.ResourceType)
+	}
+
+	var err error
+	if s.Status, err = imagingStudyStatuses.FromFHIR(res.Status, s.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	if s.PatientID, err = ParseReference(res.Subject, "Patient"); err != nil {
+		return err
+	}
+	if s.PatientID == 0 {
+		return fmt.Errorf("subject is required")
+	}
+
+	s.EncounterID = nil
+	if encounterID, err := ParseReference(res.Encounter, "Encounter"); err != nil {
+		return err
+	} else if encounterID != 0 {
+		s.EncounterID = &encounterID
+	}
+	s.ReferrerID = nil
+	if referrerID, err := ParseReference(res.Referrer, "Practitioner"); err != nil {
+		return err
+	} else if referrerID != 0 {
+		s.ReferrerID = &referrerID
+	}
+
+	for _, id := range res.Identifier {
+		switch id.System {
+		case SystemDICOMUID:
+			// Study UIDs are immutable once assigned
+			if s.StudyUID == "" {
+				s.StudyUID = strings.TrimPrefix(id.Value, "urn:oid:")
+			}
+		case SystemAccession:
+			if s.AccessionNumber == "" {
+				s.AccessionNumber = id.Value
+			}
+		}
+	}
+
+	s.Modality = ""
+	if len(res.Modality) > 0 {
+		s.Modality = res.Modality[0].Code
+	}
+	s.BodySite = ""
+	for _, ext := range res.Extension {
+		if ext.URL == ExtensionBodySite {
+			s.BodySite = ext.ValueString
+		}
+	}
+	s.Description = res.Description
+	if res.Started != "" {
+		if s.StartedAt, err = ParseDateTime(res.Started); err != nil {
+			return fmt.Errorf("started: %w", err)
+		}
+	}
+	return nil
+}
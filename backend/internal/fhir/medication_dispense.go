@@ -0,0 +1,63 @@
+package fhir
+
+import (
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// MedicationDispense is the FHIR R4 MedicationDispense resource, used for pharmacy dispensings
+type MedicationDispense struct {
+	ResourceType            string       `json:"resourceType"`
+	ID                      string       `json:"id,omitempty"`
+	Meta                    *Meta        `json:"meta,omitempty"`
+	Status                  string       `json:"status"`
+	MedicationReference     *Reference   `json:"medicationReference"`
+	Subject                 *Reference   `json:"subject,omitempty"`
+	Performer               []Performer  `json:"performer,omitempty"`
+	AuthorizingPrescription []Reference  `json:"authorizingPrescription,omitempty"`
+	Quantity                *Quantity    `json:"quantity,omitempty"`
+	WhenHandedOver          string       `json:"whenHandedOver,omitempty"`
+	DosageInstruction       []Dosage     `json:"dosageInstruction,omitempty"`
+	Note                    []Annotation `json:"note,omitempty"`
+}
+
+type Performer struct {
+	Actor *Reference `json:"actor"`
+}
+
+var medicationDispenseStatuses = newCodeMap(
+	[2]string{"dispensed", "completed"},
+	[2]string{"returned", "stopped"},
+)
+
+// MedicationDispenseFromModel maps a dispensing record to a FHIR MedicationDispense
+func MedicationDispenseFromModel(d *models.Dispensing) *MedicationDispense {
+	quantity := float64(d.QuantityDispensed)
+	res := &MedicationDispense{
+		ResourceType:        "MedicationDispense",
+		ID:                  fmt.Sprint(d.ID),
+		Meta:                NewMeta(d.UpdatedAt),
+		Status:              medicationDispenseStatuses.ToFHIR(d.Status, "unknown"),
+		MedicationReference: NewReference("Medication", d.MedicationID),
+		Subject:             NewReference("Patient", d.PatientID),
+		Quantity:            &Quantity{Value: &quantity},
+		WhenHandedOver:      FormatDateTime(d.DispensedAt),
+	}
+	if res.MedicationReference != nil {
+		res.MedicationReference.Display = d.Medication.Name
+	}
+	if performer := NewReference("Practitioner", d.DispensedBy); performer != nil {
+		res.Performer = []Performer{{Actor: performer}}
+	}
+	if prescription := NewReference("MedicationRequest", d.PrescriptionID); prescription != nil {
+		res.AuthorizingPrescription = []Reference{*prescription}
+	}
+	if d.Instructions != "" {
+		res.DosageInstruction = []Dosage{{Text: d.Instructions}}
+	}
+	if d.Notes != "" {
+		res.Note = []Annotation{{Text: d.Notes}}
+	}
+	return res
+}
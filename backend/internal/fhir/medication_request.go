@@ -0,0 +1,174 @@
+package fhir
+
+import (
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// MedicationRequest is the FHIR R4 MedicationRequest resource, used for prescriptions
+type MedicationRequest struct {
+	ResourceType        string           `json:"resourceType"`
+	ID                  string           `json:"id,omitempty"`
+	Meta                *Meta            `json:"meta,omitempty"`
+	Status              string           `json:"status"`
+	StatusReason        *CodeableConcept `json:"statusReason,omitempty"`
+	Intent              string           `json:"intent"`
+	MedicationReference *Reference       `json:"medicationReference,omitempty"`
+	Subject             *Reference       `json:"subject"`
+	Encounter           *Reference       `json:"encounter,omitempty"`
+	AuthoredOn          string           `json:"authoredOn,omitempty"`
+	Requester           *Reference       `json:"requester,omitempty"`
+	DosageInstruction   []Dosage         `json:"dosageInstruction,omitempty"`
+	DispenseRequest     *DispenseRequest `json:"dispenseRequest,omitempty"`
+}
+
+type Dosage struct {
+	Text                  string            `json:"text,omitempty"`
+	AdditionalInstruction []CodeableConcept `json:"additionalInstruction,omitempty"`
+	PatientInstruction    string            `json:"patientInstruction,omitempty"`
+	Timing                *Timing           `json:"timing,omitempty"`
+	Route                 *CodeableConcept  `json:"route,omitempty"`
+}
+
+type Timing struct {
+	Code *CodeableConcept `json:"code,omitempty"`
+}
+
+type DispenseRequest struct {
+	ValidityPeriod         *Period   `json:"validityPeriod,omitempty"`
+	NumberOfRepeatsAllowed int       `json:"numberOfRepeatsAllowed,omitempty"`
+	Quantity               *Quantity `json:"quantity,omitempty"`
+	ExpectedSupplyDuration *Quantity `json:"expectedSupplyDuration,omitempty"`
+}
+
+var medicationRequestStatuses = newCodeMap(
+	[2]string{"active", "active"},
+	[2]string{"completed", "completed"},
+	[2]string{"discontinued", "stopped"},
+	[2]string{"cancelled", "cancelled"},
+)
+
+// MedicationRequestStatusCodes returns the internal prescription statuses matching a FHIR status
+func MedicationRequestStatusCodes(code string) []string {
+	return medicationRequestStatuses.InternalCodes(code)
+}
+
+// MedicationRequestFromModel maps a prescription to a FHIR MedicationRequest
+func MedicationRequestFromModel(p *models.Prescription) *MedicationRequest {
+	res := &MedicationRequest{
+		ResourceType:        "MedicationRequest",
+		ID:                  fmt.Sprint(p.ID),
+		Meta:                NewMeta(p.UpdatedAt),
+		Status:              medicationRequestStatuses.ToFHIR(p.Status, "unknown"),
+		StatusReason:        textConcept(p.DiscontinuedReason),
+		Intent:              "order",
+		MedicationReference: NewReference("Medication", p.MedicationID),
+		Subject:             NewReference("Patient", p.PatientID),
+		Encounter:           NewReference("Encounter", p.EncounterID),
+		AuthoredOn:          FormatDateTime(p.StartDate),
+		Requester:           NewReference("Practitioner", p.PractitionerID),
+	}
+	if res.MedicationReference != nil {
+		res.MedicationReference.Display = p.Medication.Name
+	}
+
+	dosage := Dosage{
+		Text:               p.Dosage,
+		PatientInstruction: p.Instructions,
+		Route:              textConcept(p.Route),
+	}
+	if p.Frequency != "" {
+		dosage.Timing = &Timing{Code: textConcept(p.Frequency)}
+	}
+	if p.SpecialInstructions != "" {
+		dosage.AdditionalInstruction = []CodeableConcept{{Text: p.SpecialInstructions}}
+	}
+	res.DosageInstruction = []Dosage{dosage}
+
+	dispense := &DispenseRequest{
+		ValidityPeriod:         &Period{Start: FormatDateTime(p.StartDate), End: FormatDateTimePtr(p.EndDate)},
+		NumberOfRepeatsAllowed: p.Refills,
+	}
+	if p.Quantity > 0 {
+		quantity := float64(p.Quantity)
+		dispense.Quantity = &Quantity{Value: &quantity}
+	}
+	if p.DurationDays > 0 {
+		days := float64(p.DurationDays)
+		dispense.ExpectedSupplyDuration = &Quantity{Value: &days, Unit: "days", System: SystemUCUM, Code: "d"}
+	}
+	res.DispenseRequest = dispense
+
+	return res
+}
+
+// MedicationRequestToModel applies a FHIR MedicationRequest onto a prescription
+func MedicationRequestToModel(res *MedicationRequest, p *models.Prescription) error {
+	if res.ResourceType != "MedicationRequest" {
+		return fmt.Errorf("expected resourceType MedicationRequest, got %q", res.ResourceType)
+	}
+	if res.Intent != "" && res.Intent != "order" {
+		return fmt.Errorf("unsupported intent %q", res.Intent)
+	}
+
+	var err error
+	if p.Status, err = medicationRequestStatuses.FromFHIR(res.Status, p.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	if p.MedicationID, err = ParseReference(res.MedicationReference, "Medication"); err != nil {
+		return err
+	}
+	if p.PatientID, err = ParseReference(res.Subject, "Patient"); err != nil {
+		return err
+	}
+	if p.EncounterID, err = ParseReference(res.Encounter, "Encounter"); err != nil {
+		return err
+	}
+	if p.MedicationID == 0 || p.PatientID == 0 || p.EncounterID == 0 {
+		return fmt.Errorf("medicationReference, subject and encounter are required")
+	}
+	if p.PractitionerID, err = ParseReference(res.Requester, "Practitioner"); err != nil {
+		return err
+	}
+	if res.AuthoredOn != "" {
+		if p.StartDate, err = ParseDateTime(res.AuthoredOn); err != nil {
+			return fmt.Errorf("authoredOn: %w", err)
+		}
+	}
+	p.DiscontinuedReason = res.StatusReason.TextOrCode()
+
+	p.Dosage, p.Frequency, p.Route, p.Instructions, p.SpecialInstructions = "", "", "", "", ""
+	if len(res.DosageInstruction) > 0 {
+		dosage := res.DosageInstruction[0]
+		p.Dosage = dosage.Text
+		p.Instructions = dosage.PatientInstruction
+		p.Route = dosage.Route.TextOrCode()
+		if dosage.Timing != nil {
+			p.Frequency = dosage.Timing.Code.TextOrCode()
+		}
+		if len(dosage.AdditionalInstruction) > 0 {
+			p.SpecialInstructions = dosage.AdditionalInstruction[0].TextOrCode()
+		}
+	}
+	if p.Dosage == "" || p.Frequency == "" {
+		return fmt.Errorf("dosageInstruction text and timing are required")
+	}
+
+	p.Refills, p.Quantity, p.DurationDays, p.EndDate = 0, 0, 0, nil
+	if d := res.DispenseRequest; d != nil {
+		p.Refills = d.NumberOfRepeatsAllowed
+		if d.Quantity != nil && d.Quantity.Value != nil {
+			p.Quantity = int(*d.Quantity.Value)
+		}
+		if d.ExpectedSupplyDuration != nil && d.ExpectedSupplyDuration.Value != nil {
+			p.DurationDays = int(*d.ExpectedSupplyDuration.Value)
+		}
+		if d.ValidityPeriod != nil {
+			if p.EndDate, err = ParseDateTimePtr(d.ValidityPeriod.End); err != nil {
+				return fmt.Errorf("dispenseRequest.validityPeriod.end: %w", err)
+			}
+		}
+	}
+	return nil
+}
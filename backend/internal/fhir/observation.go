@@ -0,0 +1,372 @@
+package fhir
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Observation IDs are prefixed with their source table, since lab results and
+// vital signs are both exposed as Observation
+const (
+	LabObservationPrefix    = "lab-"
+	VitalsObservationPrefix = "vs-"
+
+	ObservationCategoryLaboratory = "laboratory"
+	ObservationCategoryVitalSigns = "vital-signs"
+
+	// LOINC vital signs panel
+	vitalSignsPanelCode = "85353-1"
+)
+
+// Observation is the FHIR R4 Observation resource, used for lab results, vital
+// signs and the measurements of NCD screenings
+type Observation struct {
+	ResourceType         string                      `json:"resourceType"`
+	ID                   string                      `json:"id,omitempty"`
+	Meta                 *Meta                       `json:"meta,omitempty"`
+	BasedOn              []Reference                 `json:"basedOn,omitempty"`
+	Status               string                      `json:"status"`
+	Category             []CodeableConcept           `json:"category,omitempty"`
+	Code                 CodeableConcept             `json:"code"`
+	Subject              *Reference                  `json:"subject,omitempty"`
+	Encounter            *Reference                  `json:"encounter,omitempty"`
+	EffectiveDateTime    string                      `json:"effectiveDateTime,omitempty"`
+	Performer            []Reference                 `json:"performer,omitempty"`
+	ValueQuantity        *Quantity                   `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept            `json:"valueCodeableConcept,omitempty"`
+	ValueString          string                      `json:"valueString,omitempty"`
+	Interpretation       []CodeableConcept           `json:"interpretation,omitempty"`
+	Note                 []Annotation                `json:"note,omitempty"`
+	Method               *CodeableConcept            `json:"method,omitempty"`
+	ReferenceRange       []ObservationReferenceRange `json:"referenceRange,omitempty"`
+	DerivedFrom          []Reference                 `json:"derivedFrom,omitempty"`
+	Component            []ObservationComponent      `json:"component,omitempty"`
+}
+
+type ObservationReferenceRange struct {
+	Text string `json:"text,omitempty"`
+}
+
+type ObservationComponent struct {
+	Code           CodeableConcept   `json:"code"`
+	ValueQuantity  *Quantity         `json:"valueQuantity,omitempty"`
+	Interpretation []CodeableConcept `json:"interpretation,omitempty"`
+}
+
+const systemInterpretation = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+
+var (
+	labResultStatuses = newCodeMap(
+		[2]string{"preliminary", "preliminary"},
+		[2]string{"final", "final"},
+		[2]string{"corrected", "corrected"},
+		[2]string{"cancelled", "cancelled"},
+	)
+	abnormalFlags = newCodeMap(
+		[2]string{"normal", "N"},
+		[2]string{"high", "H"},
+		[2]string{"low", "L"},
+		[2]string{"critical-high", "HH"},
+		[2]string{"critical-low", "LL"},
+	)
+)
+
+// vitalComponent maps one VitalSigns column to an Observation component
+type vitalComponent struct {
+	code, display, unit string
+	get                 func(v *models.VitalSigns) *float64
+	set                 func(v *models.VitalSigns, value *float64)
+}
+
+var vitalComponents = []vitalComponent{
+	{"8480-6", "Systolic blood pressure", "mm[Hg]",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.SystolicBP) },
+		func(v *models.VitalSigns, f *float64) { v.SystolicBP = floatToInt(f) }},
+	{"8462-4", "Diastolic blood pressure", "mm[Hg]",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.DiastolicBP) },
+		func(v *models.VitalSigns, f *float64) { v.DiastolicBP = floatToInt(f) }},
+	{"8867-4", "Heart rate", "/min",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.PulseRate) },
+		func(v *models.VitalSigns, f *float64) { v.PulseRate = floatToInt(f) }},
+	{"9279-1", "Respiratory rate", "/min",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.RespiratoryRate) },
+		func(v *models.VitalSigns, f *float64) { v.RespiratoryRate = floatToInt(f) }},
+	{"8310-5", "Body temperature", "Cel",
+		func(v *models.VitalSigns) *float64 { return v.Temperature },
+		func(v *models.VitalSigns, f *float64) { v.Temperature = f }},
+	{"59408-5", "Oxygen saturation by pulse oximetry", "%",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.SpO2) },
+		func(v *models.VitalSigns, f *float64) { v.SpO2 = floatToInt(f) }},
+	{"29463-7", "Body weight", "kg",
+		func(v *models.VitalSigns) *float64 { return v.Weight },
+		func(v *models.VitalSigns, f *float64) { v.Weight = f }},
+	{"8302-2", "Body height", "cm",
+		func(v *models.VitalSigns) *float64 { return v.Height },
+		func(v *models.VitalSigns, f *float64) { v.Height = f }},
+	{"56072-2", "Mid upper arm circumference", "cm",
+		func(v *models.VitalSigns) *float64 { return v.MUAC },
+		func(v *models.VitalSigns, f *float64) { v.MUAC = f }},
+	{"39156-5", "Body mass index", "kg/m2",
+		func(v *models.VitalSigns) *float64 { return v.BMI },
+		func(v *models.VitalSigns, f *float64) { v.BMI = f }},
+	{"72514-3", "Pain severity 0-10", "{score}",
+		func(v *models.VitalSigns) *float64 { return intToFloat(v.PainScale) },
+		func(v *models.VitalSigns, f *float64) { v.PainScale = floatToInt(f) }},
+}
+
+// vitalComponentFlags are the reference range flags of the components that have them
+var vitalComponentFlags = map[string]func(v *models.VitalSigns) string{
+	"8480-6":  func(v *models.VitalSigns) string { return v.SystolicBPFlag },
+	"8462-4":  func(v *models.VitalSigns) string { return v.DiastolicBPFlag },
+	"8867-4":  func(v *models.VitalSigns) string { return v.PulseRateFlag },
+	"9279-1":  func(v *models.VitalSigns) string { return v.RespiratoryRateFlag },
+	"8310-5":  func(v *models.VitalSigns) string { return v.TemperatureFlag },
+	"59408-5": func(v *models.VitalSigns) string { return v.SpO2Flag },
+}
+
+func intToFloat(i *int) *float64 {
+	if i == nil {
+		return nil
+	}
+	f := float64(*i)
+	return &f
+}
+
+func floatToInt(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	i := int(math.Round(*f))
+	return &i
+}
+
+func categoryConcept(code, display string) CodeableConcept {
+	return CodeableConcept{Coding: []Coding{{System: SystemObsCategory, Code: code, Display: display}}}
+}
+
+// ParseObservationID splits an Observation ID into its source prefix and record ID
+func ParseObservationID(id string) (string, uint, error) {
+	for _, prefix := range []string{LabObservationPrefix, VitalsObservationPrefix} {
+		if strings.HasPrefix(id, prefix) {
+			n, err := strconv.ParseUint(strings.TrimPrefix(id, prefix), 10, 32)
+			if err != nil {
+				break
+			}
+			return prefix, uint(n), nil
+		}
+	}
+	return "", 0, fmt.Errorf("invalid Observation id %q", id)
+}
+
+// LabResultStatusCodes returns the internal lab result statuses matching a FHIR status
+func LabResultStatusCodes(code string) []string {
+	return labResultStatuses.InternalCodes(code)
+}
+
+// IsVitalSignsObservation reports whether the resource is a vital signs panel
+func IsVitalSignsObservation(res *Observation) bool {
+	if res.Code.CodeFor(SystemLOINC) == vitalSignsPanelCode {
+		return true
+	}
+	for _, category := range res.Category {
+		if category.CodeFor(SystemObsCategory) == ObservationCategoryVitalSigns {
+			return true
+		}
+	}
+	return false
+}
+
+// ObservationLabTestCode returns the lab test catalog code the Observation refers to
+func ObservationLabTestCode(res *Observation) string {
+	if code := res.Code.CodeFor(SystemLabTestCode); code != "" {
+		return code
+	}
+	return res.Code.CodeFor(SystemLOINC)
+}
+
+// ObservationFromLabResult maps a lab result to a FHIR Observation. The result's
+// LabOrder and LabTest should be loaded.
+func ObservationFromLabResult(r *models.LabResult) *Observation {
+	res := &Observation{
+		ResourceType:      "Observation",
+		ID:                fmt.Sprintf("%s%d", LabObservationPrefix, r.ID),
+		Meta:              NewMeta(r.UpdatedAt),
+		BasedOn:           []Reference{*NewReference("ServiceRequest", r.LabOrderID)},
+		Status:            labResultStatuses.ToFHIR(r.Status, "unknown"),
+		Category:          []CodeableConcept{categoryConcept(ObservationCategoryLaboratory, "Laboratory")},
+		Code:              CodeableConcept{Text: r.LabTest.Name},
+		Subject:           NewReference("Patient", r.LabOrder.PatientID),
+		Encounter:         NewReference("Encounter", r.LabOrder.EncounterID),
+		EffectiveDateTime: FormatDateTime(r.ResultDate),
+	}
+	if r.LabTest.Code != "" {
+		res.Code.Coding = []Coding{{System: SystemLabTestCode, Code: r.LabTest.Code, Display: r.LabTest.Name}}
+	}
+	if ref := NewReference("Practitioner", r.PerformedBy); ref != nil {
+		res.Performer = []Reference{*ref}
+	}
+
+	if r.NumericValue != nil {
+		res.ValueQuantity = &Quantity{Value: r.NumericValue, Unit: r.Unit}
+	} else {
+		res.ValueString = r.Value
+	}
+
+	if r.AbnormalFlag != "" || r.Interpretation != "" {
+		interpretation := CodeableConcept{Text: r.Interpretation}
+		if code := abnormalFlags.ToFHIR(r.AbnormalFlag, ""); code != "" {
+			interpretation.Coding = []Coding{{System: systemInterpretation, Code: code}}
+		}
+		res.Interpretation = []CodeableConcept{interpretation}
+	}
+	if r.ReferenceRange != "" {
+		res.ReferenceRange = []ObservationReferenceRange{{Text: r.ReferenceRange}}
+	}
+	if r.Notes != "" {
+		res.Note = []Annotation{{Text: r.Notes}}
+	}
+	return res
+}
+
+// ObservationToLabResult applies a FHIR Observation onto a lab result. The lab
+// test is resolved by the caller from ObservationLabTestCode.
+func ObservationToLabResult(res *Observation, r *models.LabResult) error {
+	if res.ResourceType != "Observation" {
+		return fmt.Errorf("expected resourceType Observation, got %q", res.ResourceType)
+	}
+
+	var err error
+	if r.Status, err = labResultStatuses.FromFHIR(res.Status, r.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+
+	r.LabOrderID = 0
+	if len(res.BasedOn) > 0 {
+		if r.LabOrderID, err = ParseReference(&res.BasedOn[0], "ServiceRequest"); err != nil {
+			return err
+		}
+	}
+	if r.LabOrderID == 0 {
+		return fmt.Errorf("basedOn must reference the ServiceRequest (lab order)")
+	}
+
+	r.PerformedBy = 0
+	if len(res.Performer) > 0 {
+		if r.PerformedBy, err = ParseReference(&res.Performer[0], "Practitioner"); err != nil {
+			return err
+		}
+	}
+	if res.EffectiveDateTime != "" {
+		if r.ResultDate, err = ParseDateTime(res.EffectiveDateTime); err != nil {
+			return fmt.Errorf("effectiveDateTime: %w", err)
+		}
+	}
+
+	r.NumericValue, r.Unit, r.Value = nil, "", res.ValueString
+	if q := res.ValueQuantity; q != nil && q.Value != nil {
+		r.NumericValue = q.Value
+		r.Unit = q.Unit
+		r.Value = strconv.FormatFloat(*q.Value, 'f', -1, 64)
+	}
+
+	r.Interpretation = ""
+	if len(res.Interpretation) > 0 {
+		r.Interpretation = res.Interpretation[0].Text
+	}
+	r.ReferenceRange = ""
+	if len(res.ReferenceRange) > 0 {
+		r.ReferenceRange = res.ReferenceRange[0].Text
+	}
+	r.Notes = ""
+	if len(res.Note) > 0 {
+		r.Notes = res.Note[0].Text
+	}
+	return nil
+}
+
+// ObservationFromVitalSigns maps a vital signs record to a FHIR vital signs panel
+// with one component per measurement
+func ObservationFromVitalSigns(v *models.VitalSigns) *Observation {
+	res := &Observation{
+		ResourceType: "Observation",
+		ID:           fmt.Sprintf("%s%d", VitalsObservationPrefix, v.ID),
+		Meta:         NewMeta(v.UpdatedAt),
+		Status:       "final",
+		Category:     []CodeableConcept{categoryConcept(ObservationCategoryVitalSigns, "Vital Signs")},
+		Code: CodeableConcept{
+			Coding: []Coding{{System: SystemLOINC, Code: vitalSignsPanelCode, Display: "Vital signs panel"}},
+			Text:   "Vital signs",
+		},
+		Subject:           NewReference("Patient", v.PatientID),
+		Encounter:         NewReference("Encounter", v.EncounterID),
+		EffectiveDateTime: FormatDateTime(v.MeasuredAt),
+	}
+	for _, vc := range vitalComponents {
+		if value := vc.get(v); value != nil {
+			component := ObservationComponent{
+				Code:          CodeableConcept{Coding: []Coding{{System: SystemLOINC, Code: vc.code, Display: vc.display}}},
+				ValueQuantity: &Quantity{Value: value, Unit: vc.unit, System: SystemUCUM, Code: vc.unit},
+			}
+			if flag, ok := vitalComponentFlags[vc.code]; ok {
+				if code := abnormalFlags.ToFHIR(flag(v), ""); code != "" {
+					component.Interpretation = []CodeableConcept{{Coding: []Coding{{System: systemInterpretation, Code: code}}}}
+				}
+			}
+			res.Component = append(res.Component, component)
+		}
+	}
+	if v.Notes != "" {
+		res.Note = []Annotation{{Text: v.Notes}}
+	}
+	return res
+}
+
+// ObservationToVitalSigns applies a FHIR vital signs panel onto a vital signs record.
+// Components with unknown codes are rejected; BMI is recalculated by the model.
+func ObservationToVitalSigns(res *Observation, v *models.VitalSigns) error {
+	if res.ResourceType != "Observation" {
+		return fmt.Errorf("expected resourceType Observation, got %q", res.ResourceType)
+	}
+
+	var err error
+	if v.PatientID, err = ParseReference(res.Subject, "Patient"); err != nil {
+		return err
+	}
+	if v.EncounterID, err = ParseReference(res.Encounter, "Encounter"); err != nil {
+		return err
+	}
+	if v.PatientID == 0 || v.EncounterID == 0 {
+		return fmt.Errorf("subject and encounter are required")
+	}
+	if res.EffectiveDateTime != "" {
+		if v.MeasuredAt, err = ParseDateTime(res.EffectiveDateTime); err != nil {
+			return fmt.Errorf("effectiveDateTime: %w", err)
+		}
+	}
+
+	values := map[string]*float64{}
+	for _, component := range res.Component {
+		code := component.Code.CodeFor(SystemLOINC)
+		if component.ValueQuantity == nil {
+			continue
+		}
+		values[code] = component.ValueQuantity.Value
+	}
+	for _, vc := range vitalComponents {
+		vc.set(v, values[vc.code])
+		delete(values, vc.code)
+	}
+	for code := range values {
+		return fmt.Errorf("unsupported vital signs component %q", code)
+	}
+
+	v.Notes = ""
+	if len(res.Note) > 0 {
+		v.Notes = res.Note[0].Text
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package fhir
+
+import (
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestObservationFromVitalSignsInterpretation checks each component carries
+// the flag of its reference range
+func TestObservationFromVitalSignsInterpretation(t *testing.T) {
+	v := &models.VitalSigns{
+		PulseRate: intPtr(130), PulseRateFlag: models.VitalFlagHigh,
+		SpO2: intPtr(90), SpO2Flag: models.VitalFlagLow,
+		Temperature: floatPtr(37), TemperatureFlag: models.VitalFlagNormal,
+		Weight: floatPtr(60),
+	}
+	v.ID = 4
+
+	interpretations := map[string]string{}
+	for _, component := range ObservationFromVitalSigns(v).Component {
+		code := component.Code.Coding[0].Code
+		interpretations[code] = ""
+		if len(component.Interpretation) > 0 {
+			require.Len(t, component.Interpretation[0].Coding, 1)
+			assert.Equal(t, systemInterpretation, component.Interpretation[0].Coding[0].System)
+			interpretations[code] = component.Interpretation[0].Coding[0].Code
+		}
+	}
+	assert.Equal(t, "H", interpretations["8867-4"])
+	assert.Equal(t, "L", interpretations["59408-5"])
+	assert.Equal(t, "N", interpretations["8310-5"])
+	require.Contains(t, interpretations, "29463-7")
+	assert.Empty(t, interpretations["29463-7"], "weight has no reference range")
+}
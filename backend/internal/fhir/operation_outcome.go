@@ -0,0 +1,35 @@
+package fhir
+
+// Issue types used in OperationOutcome responses
+const (
+	IssueInvalid      = "invalid"
+	IssueNotFound     = "not-found"
+	IssueForbidden    = "forbidden"
+	IssueNotSupported = "not-supported"
+	IssueException    = "exception"
+	IssueBusinessRule = "business-rule"
+	IssueRequired     = "required"
+	IssueValue        = "value"
+	IssueStructure    = "structure"
+)
+
+// OperationOutcome is the FHIR R4 error/information response
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+// NewOperationOutcome builds an OperationOutcome with a single error issue
+func NewOperationOutcome(code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []OperationOutcomeIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	}
+}
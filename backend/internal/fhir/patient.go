@@ -0,0 +1,282 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Patient is the FHIR R4 Patient resource
+type Patient struct {
+	ResourceType     string         `json:"resourceType"`
+	ID               string         `json:"id,omitempty"`
+	Meta             *Meta          `json:"meta,omitempty"`
+	Extension        []Extension    `json:"extension,omitempty"`
+	Identifier       []Identifier   `json:"identifier,omitempty"`
+	Active           *bool          `json:"active,omitempty"`
+	Name             []HumanName    `json:"name,omitempty"`
+	Telecom          []ContactPoint `json:"telecom,omitempty"`
+	Gender           string         `json:"gender,omitempty"`
+	BirthDate        string         `json:"birthDate,omitempty"`
+	DeceasedBoolean  *bool          `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime string         `json:"deceasedDateTime,omitempty"`
+	Address          []Address      `json:"address,omitempty"`
+	Link             []PatientLink  `json:"link,omitempty"`
+}
+
+type PatientLink struct {
+	Other *Reference `json:"other"`
+	Type  string     `json:"type"`
+}
+
+var patientGenders = map[string]bool{"male": true, "female": true, "other": true, "unknown": true}
+
+// PatientFromModel maps a patient record to a FHIR Patient
+func PatientFromModel(p *models.Patient) *Patient {
+	active := p.Active
+	res := &Patient{
+		ResourceType: "Patient",
+		ID:           fmt.Sprint(p.ID),
+		Meta:         NewMeta(p.UpdatedAt),
+		Active:       &active,
+		Gender:       p.Gender,
+	}
+	if p.MergedIntoID != nil {
+		res.Link = []PatientLink{{Other: NewReference("Patient", *p.MergedIntoID), Type: "replaced-by"}}
+	}
+
+	res.Identifier = patientIdentifiers(p)
+
+	name := HumanName{Use: "official", Family: p.FamilyName, Text: strings.TrimSpace(p.GetFullName())}
+	for _, given := range []string{p.GivenName, p.MiddleName} {
+		if given != "" {
+			name.Given = append(name.Given, given)
+		}
+	}
+	res.Name = []HumanName{name}
+
+	for _, cp := range []ContactPoint{
+		{System: "phone", Value: p.Phone, Rank: 1},
+		{System: "phone", Value: p.Phone2, Rank: 2},
+		{System: "email", Value: p.Email},
+	} {
+		if cp.Value != "" {
+			res.Telecom = append(res.Telecom, cp)
+		}
+	}
+
+	if p.BirthDate != nil {
+		res.BirthDate = p.BirthDate.Format(DateFormat)
+	}
+	if p.DeceasedDateTime != nil {
+		res.DeceasedDateTime = FormatDateTimePtr(p.DeceasedDateTime)
+	} else if p.DeceasedBoolean {
+		deceased := true
+		res.DeceasedBoolean = &deceased
+	}
+
+	addr := Address{City: p.City, District: p.District, State: p.Division, PostalCode: p.PostalCode, Country: p.Country}
+	for _, line := range []string{p.AddressLine1, p.AddressLine2} {
+		if line != "" {
+			addr.Line = append(addr.Line, line)
+		}
+	}
+	if len(addr.Line) > 0 || addr.City != "" || addr.District != "" || addr.State != "" || addr.PostalCode != "" || addr.Country != "" {
+		res.Address = []Address{addr}
+	}
+
+	for _, ext := range []Extension{
+		{URL: ExtensionNationality, ValueString: p.Nationality},
+		{URL: ExtensionCampName, ValueString: p.CampName},
+		{URL: ExtensionBlockNumber, ValueString: p.BlockNumber},
+	} {
+		if ext.ValueString != "" {
+			res.Extension = append(res.Extension, ext)
+		}
+	}
+
+	return res
+}
+
+// patientIdentifiers maps the patient's identifiers with the current MRN first.
+// A record loaded without its identifiers falls back to the legacy columns.
+func patientIdentifiers(p *models.Patient) []Identifier {
+	identifiers := p.Identifiers
+	if len(identifiers) == 0 {
+		legacy := *p
+		legacy.SyncIdentifiers()
+		identifiers = legacy.Identifiers
+	}
+
+	var out []Identifier
+	for _, id := range identifiers {
+		ident := Identifier{Use: id.Use, System: id.System, Value: id.Value}
+		if system := models.FindIdentifierSystem(id.System); system != nil {
+			ident.Type = &CodeableConcept{Text: system.Display}
+		}
+		if id.Type != "" {
+			if ident.Type == nil {
+				ident.Type = &CodeableConcept{}
+			}
+			ident.Type.Coding = []Coding{{System: SystemIdentifierType, Code: id.Type}}
+		}
+		if id.PeriodStart != nil || id.PeriodEnd != nil {
+			ident.Period = &Period{Start: FormatDateTimePtr(id.PeriodStart), End: FormatDateTimePtr(id.PeriodEnd)}
+		}
+		if id.Assigner != "" {
+			ident.Assigner = &Reference{Display: id.Assigner}
+		}
+		if id.System == SystemMRN && id.Value == p.MRN {
+			out = append([]Identifier{ident}, out...)
+		} else {
+			out = append(out, ident)
+		}
+	}
+	return out
+}
+
+// identifiersToModel maps the resource's identifiers onto the patient. MRNs are
+// assigned by the system, so MRN identifiers already on file are kept and those
+// in the resource ignored; unchanged identifiers keep their stored row.
+func identifiersToModel(res *Patient, p *models.Patient) error {
+	var identifiers []models.PatientIdentifier
+	for _, stored := range p.Identifiers {
+		if stored.System == SystemMRN {
+			identifiers = append(identifiers, stored)
+		}
+	}
+
+	for i, id := range res.Identifier {
+		if id.System == SystemMRN {
+			if p.MRN == "" {
+				p.MRN = id.Value
+			}
+			continue
+		}
+		ident := models.NewPatientIdentifier(id.System, id.Value)
+		ident.Use = id.Use
+		if id.Period != nil {
+			var err error
+			if ident.PeriodStart, err = ParseDateTimePtr(id.Period.Start); err != nil {
+				return fmt.Errorf("identifier[%d].period.start: %w", i, err)
+			}
+			if ident.PeriodEnd, err = ParseDateTimePtr(id.Period.End); err != nil {
+				return fmt.Errorf("identifier[%d].period.end: %w", i, err)
+			}
+		}
+		if id.Assigner != nil {
+			ident.Assigner = id.Assigner.Display
+		}
+		for _, stored := range p.Identifiers {
+			if stored.System == ident.System && stored.Value == ident.Value {
+				ident.BaseModel = stored.BaseModel
+				ident.PatientID = stored.PatientID
+			}
+		}
+		identifiers = append(identifiers, ident)
+	}
+
+	p.Identifiers = identifiers
+	p.SyncIdentifiers()
+	return nil
+}
+
+// PatientToModel applies a FHIR Patient onto a patient record. Pass an empty
+// model for creates and the stored record for updates; fields the resource does
+// not carry (emergency contact, occupation, ...) are left untouched.
+func PatientToModel(res *Patient, p *models.Patient) error {
+	if res.ResourceType != "Patient" {
+		return fmt.Errorf("expected resourceType Patient, got %q", res.ResourceType)
+	}
+	if res.Gender != "" && !patientGenders[res.Gender] {
+		return fmt.Errorf("invalid gender %q", res.Gender)
+	}
+
+	if res.Active != nil {
+		p.Active = *res.Active
+	} else if p.ID == 0 {
+		p.Active = true
+	}
+	p.Gender = res.Gender
+
+	// The legacy columns are refilled from the identifiers
+	p.NationalID, p.BirthRegNo, p.UNHCRNumber = "", "", ""
+	if err := identifiersToModel(res, p); err != nil {
+		return err
+	}
+
+	p.GivenName, p.MiddleName, p.FamilyName = "", "", ""
+	if len(res.Name) > 0 {
+		name := res.Name[0]
+		for _, n := range res.Name {
+			if n.Use == "official" {
+				name = n
+				break
+			}
+		}
+		p.FamilyName = name.Family
+		if len(name.Given) > 0 {
+			p.GivenName = name.Given[0]
+		}
+		if len(name.Given) > 1 {
+			p.MiddleName = strings.Join(name.Given[1:], " ")
+		}
+	}
+
+	p.Phone, p.Phone2, p.Email = "", "", ""
+	for _, cp := range res.Telecom {
+		switch {
+		case cp.System == "email" && p.Email == "":
+			p.Email = cp.Value
+		case cp.System == "phone" && p.Phone == "":
+			p.Phone = cp.Value
+		case cp.System == "phone" && p.Phone2 == "":
+			p.Phone2 = cp.Value
+		}
+	}
+
+	birthDate, err := ParseDateTimePtr(res.BirthDate)
+	if err != nil {
+		return fmt.Errorf("birthDate: %w", err)
+	}
+	p.BirthDate = birthDate
+
+	p.DeceasedDateTime, err = ParseDateTimePtr(res.DeceasedDateTime)
+	if err != nil {
+		return fmt.Errorf("deceasedDateTime: %w", err)
+	}
+	p.DeceasedBoolean = p.DeceasedDateTime != nil || (res.DeceasedBoolean != nil && *res.DeceasedBoolean)
+
+	p.AddressLine1, p.AddressLine2, p.City, p.District, p.Division, p.PostalCode = "", "", "", "", "", ""
+	if len(res.Address) > 0 {
+		addr := res.Address[0]
+		if len(addr.Line) > 0 {
+			p.AddressLine1 = addr.Line[0]
+		}
+		if len(addr.Line) > 1 {
+			p.AddressLine2 = strings.Join(addr.Line[1:], ", ")
+		}
+		p.City = addr.City
+		p.District = addr.District
+		p.Division = addr.State
+		p.PostalCode = addr.PostalCode
+		if addr.Country != "" {
+			p.Country = addr.Country
+		}
+	}
+
+	p.Nationality, p.CampName, p.BlockNumber = "", "", ""
+	for _, ext := range res.Extension {
+		switch ext.URL {
+		case ExtensionNationality:
+			p.Nationality = ext.ValueString
+		case ExtensionCampName:
+			p.CampName = ext.ValueString
+		case ExtensionBlockNumber:
+			p.BlockNumber = ext.ValueString
+		}
+	}
+
+	return p.Validate()
+}
@@ -0,0 +1,307 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// Questionnaire extensions understood by the form engine
+const (
+	ExtensionMinValue   = "http://hl7.org/fhir/StructureDefinition/minValue"
+	ExtensionMaxValue   = "http://hl7.org/fhir/StructureDefinition/maxValue"
+	ExtensionRegex      = "http://hl7.org/fhir/StructureDefinition/regex"
+	ExtensionUnit       = "http://hl7.org/fhir/StructureDefinition/questionnaire-unit"
+	ExtensionCalculated = "http://hl7.org/fhir/uv/sdc/StructureDefinition/sdc-questionnaire-calculatedExpression"
+	ExtensionExtract    = "http://hl7.org/fhir/uv/sdc/StructureDefinition/sdc-questionnaire-observationExtract"
+
+	// ExpressionLanguage is the language of calculated expressions
+	ExpressionLanguage = "text/fhirpath"
+)
+
+// Questionnaire is the FHIR R4 Questionnaire resource, the definition of a
+// form
+type Questionnaire struct {
+	ResourceType string              `json:"resourceType"`
+	ID           string              `json:"id,omitempty"`
+	Meta         *Meta               `json:"meta,omitempty"`
+	URL          string              `json:"url,omitempty"`
+	Version      string              `json:"version,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Title        string              `json:"title,omitempty"`
+	Status       string              `json:"status"`
+	SubjectType  []string            `json:"subjectType,omitempty"`
+	Date         string              `json:"date,omitempty"`
+	Publisher    string              `json:"publisher,omitempty"`
+	Description  string              `json:"description,omitempty"`
+	Extension    []Extension         `json:"extension,omitempty"`
+	Code         []Coding            `json:"code,omitempty"`
+	Item         []QuestionnaireItem `json:"item,omitempty"`
+}
+
+type QuestionnaireItem struct {
+	LinkID         string                        `json:"linkId"`
+	Code           []Coding                      `json:"code,omitempty"`
+	Prefix         string                        `json:"prefix,omitempty"`
+	Text           string                        `json:"text,omitempty"`
+	Type           string                        `json:"type"`
+	EnableWhen     []QuestionnaireEnableWhen     `json:"enableWhen,omitempty"`
+	EnableBehavior string                        `json:"enableBehavior,omitempty"`
+	Required       bool                          `json:"required,omitempty"`
+	Repeats        bool                          `json:"repeats,omitempty"`
+	ReadOnly       bool                          `json:"readOnly,omitempty"`
+	MaxLength      *int                          `json:"maxLength,omitempty"`
+	AnswerOption   []QuestionnaireAnswerOption   `json:"answerOption,omitempty"`
+	Initial        []QuestionnaireResponseAnswer `json:"initial,omitempty"`
+	Extension      []Extension                   `json:"extension,omitempty"`
+	Item           []QuestionnaireItem           `json:"item,omitempty"`
+}
+
+// QuestionnaireEnableWhen enables an item only when another item's answer
+// meets a condition
+type QuestionnaireEnableWhen struct {
+	Question       string    `json:"question"`
+	Operator       string    `json:"operator"`
+	AnswerBoolean  *bool     `json:"answerBoolean,omitempty"`
+	AnswerDecimal  *float64  `json:"answerDecimal,omitempty"`
+	AnswerInteger  *int      `json:"answerInteger,omitempty"`
+	AnswerDate     string    `json:"answerDate,omitempty"`
+	AnswerDateTime string    `json:"answerDateTime,omitempty"`
+	AnswerTime     string    `json:"answerTime,omitempty"`
+	AnswerString   string    `json:"answerString,omitempty"`
+	AnswerCoding   *Coding   `json:"answerCoding,omitempty"`
+	AnswerQuantity *Quantity `json:"answerQuantity,omitempty"`
+}
+
+// answer is the enableWhen's value as an answer, and the number of values set
+func (w *QuestionnaireEnableWhen) answer() (QuestionnaireResponseAnswer, int) {
+	a := QuestionnaireResponseAnswer{
+		ValueBoolean:  w.AnswerBoolean,
+		ValueDecimal:  w.AnswerDecimal,
+		ValueInteger:  w.AnswerInteger,
+		ValueDate:     w.AnswerDate,
+		ValueDateTime: w.AnswerDateTime,
+		ValueTime:     w.AnswerTime,
+		ValueString:   w.AnswerString,
+		ValueCoding:   w.AnswerCoding,
+		ValueQuantity: w.AnswerQuantity,
+	}
+	return a, a.valueCount()
+}
+
+type QuestionnaireAnswerOption struct {
+	ValueInteger    *int    `json:"valueInteger,omitempty"`
+	ValueDate       string  `json:"valueDate,omitempty"`
+	ValueTime       string  `json:"valueTime,omitempty"`
+	ValueString     string  `json:"valueString,omitempty"`
+	ValueCoding     *Coding `json:"valueCoding,omitempty"`
+	InitialSelected bool    `json:"initialSelected,omitempty"`
+}
+
+// Item types of FHIR R4 Questionnaire.item.type served by the form engine
+const (
+	ItemGroup      = "group"
+	ItemDisplay    = "display"
+	ItemBoolean    = "boolean"
+	ItemDecimal    = "decimal"
+	ItemInteger    = "integer"
+	ItemDate       = "date"
+	ItemDateTime   = "dateTime"
+	ItemTime       = "time"
+	ItemString     = "string"
+	ItemText       = "text"
+	ItemChoice     = "choice"
+	ItemOpenChoice = "open-choice"
+	ItemQuantity   = "quantity"
+)
+
+var questionnaireItemTypes = map[string]bool{
+	ItemGroup: true, ItemDisplay: true, ItemBoolean: true, ItemDecimal: true, ItemInteger: true,
+	ItemDate: true, ItemDateTime: true, ItemTime: true, ItemString: true, ItemText: true,
+	ItemChoice: true, ItemOpenChoice: true, ItemQuantity: true,
+}
+
+var enableWhenOperators = map[string]bool{
+	"exists": true, "=": true, "!=": true, ">": true, "<": true, ">=": true, "<=": true,
+}
+
+var questionnaireStatuses = newCodeMap(
+	[2]string{models.QuestionnaireDraft, "draft"},
+	[2]string{models.QuestionnaireActive, "active"},
+	[2]string{models.QuestionnaireRetired, "retired"},
+)
+
+// QuestionnaireStatusCodes returns the internal questionnaire statuses matching a FHIR status
+func QuestionnaireStatusCodes(code string) []string {
+	return questionnaireStatuses.InternalCodes(code)
+}
+
+// QuestionnaireFromModel maps a stored questionnaire to its resource. The
+// stored columns take precedence over the definition.
+func QuestionnaireFromModel(m *models.Questionnaire) (*Questionnaire, error) {
+	var q Questionnaire
+	if err := json.Unmarshal([]byte(m.Definition), &q); err != nil {
+		return nil, fmt.Errorf("questionnaire %d: %w", m.ID, err)
+	}
+	q.ResourceType = "Questionnaire"
+	q.ID = fmt.Sprint(m.ID)
+	q.Meta = NewMeta(m.UpdatedAt)
+	q.URL = m.URL
+	q.Version = m.Version
+	q.Status = questionnaireStatuses.ToFHIR(m.Status, "draft")
+	return &q, nil
+}
+
+// extension returns the item's extension with the given URL
+func (item *QuestionnaireItem) extension(url string) *Extension {
+	return findExtension(item.Extension, url)
+}
+
+func findExtension(extensions []Extension, url string) *Extension {
+	for i := range extensions {
+		if extensions[i].URL == url {
+			return &extensions[i]
+		}
+	}
+	return nil
+}
+
+// isQuestion reports whether the item is answered, rather than a group or
+// display text
+func (item *QuestionnaireItem) isQuestion() bool {
+	return item.Type != ItemGroup && item.Type != ItemDisplay
+}
+
+// itemIssue is an error about an item of a questionnaire or response
+func itemIssue(code, resourceType, linkID, format string, args ...interface{}) OperationOutcomeIssue {
+	return OperationOutcomeIssue{
+		Severity:    "error",
+		Code:        code,
+		Diagnostics: fmt.Sprintf(format, args...),
+		Expression:  []string{fmt.Sprintf("%s.item.where(linkId='%s')", resourceType, linkID)},
+	}
+}
+
+// ValidateQuestionnaire checks a questionnaire definition against what the
+// form engine supports. It returns no issues when the definition is valid.
+func ValidateQuestionnaire(q *Questionnaire) []OperationOutcomeIssue {
+	var issues []OperationOutcomeIssue
+	fail := func(code, format string, args ...interface{}) {
+		issues = append(issues, OperationOutcomeIssue{Severity: "error", Code: code, Diagnostics: fmt.Sprintf(format, args...)})
+	}
+	if q.ResourceType != "Questionnaire" {
+		fail(IssueInvalid, "resourceType must be Questionnaire")
+	}
+	if q.URL == "" {
+		fail(IssueRequired, "url is required")
+	}
+	if q.Version == "" {
+		fail(IssueRequired, "version is required")
+	}
+	if len(q.Item) == 0 {
+		fail(IssueRequired, "a questionnaire needs at least one item")
+	}
+
+	items := map[string]*QuestionnaireItem{}
+	var index func([]QuestionnaireItem)
+	index = func(list []QuestionnaireItem) {
+		for i := range list {
+			item := &list[i]
+			if item.LinkID == "" {
+				fail(IssueRequired, "every item needs a linkId")
+			} else if _, exists := items[item.LinkID]; exists {
+				issues = append(issues, itemIssue(IssueInvalid, "Questionnaire", item.LinkID, "linkId %s is used more than once", item.LinkID))
+			} else {
+				items[item.LinkID] = item
+			}
+			index(item.Item)
+		}
+	}
+	index(q.Item)
+
+	for _, item := range items {
+		issues = append(issues, validateItem(item, items)...)
+	}
+	sortIssues(issues)
+	return issues
+}
+
+// validateItem checks one item of a questionnaire definition
+func validateItem(item *QuestionnaireItem, items map[string]*QuestionnaireItem) []OperationOutcomeIssue {
+	var issues []OperationOutcomeIssue
+	fail := func(format string, args ...interface{}) {
+		issues = append(issues, itemIssue(IssueInvalid, "Questionnaire", item.LinkID, format, args...))
+	}
+
+	if !questionnaireItemTypes[item.Type] {
+		fail("item %s: unsupported type %q", item.LinkID, item.Type)
+		return issues
+	}
+	switch {
+	case item.Type == ItemGroup && len(item.Item) == 0:
+		fail("group %s has no items", item.LinkID)
+	case item.Type == ItemDisplay && (len(item.Item) > 0 || item.Required):
+		fail("display item %s cannot have items or be required", item.LinkID)
+	case item.Type == ItemChoice && len(item.AnswerOption) == 0:
+		fail("choice item %s has no answerOption", item.LinkID)
+	}
+	if item.MaxLength != nil && item.Type != ItemString && item.Type != ItemText && item.Type != ItemOpenChoice {
+		fail("item %s: maxLength applies to string, text and open-choice items", item.LinkID)
+	}
+
+	if item.EnableBehavior != "" && item.EnableBehavior != "all" && item.EnableBehavior != "any" {
+		fail("item %s: enableBehavior must be all or any", item.LinkID)
+	}
+	for _, when := range item.EnableWhen {
+		question, ok := items[when.Question]
+		_, values := when.answer()
+		switch {
+		case !ok:
+			fail("item %s: enableWhen refers to unknown item %q", item.LinkID, when.Question)
+		case !question.isQuestion():
+			fail("item %s: enableWhen refers to %s, which is not a question", item.LinkID, when.Question)
+		case !enableWhenOperators[when.Operator]:
+			fail("item %s: unsupported enableWhen operator %q", item.LinkID, when.Operator)
+		case values != 1:
+			fail("item %s: enableWhen on %s needs exactly one answer", item.LinkID, when.Question)
+		case when.Operator == "exists" && when.AnswerBoolean == nil:
+			fail("item %s: enableWhen exists on %s needs answerBoolean", item.LinkID, when.Question)
+		}
+	}
+
+	if ext := item.extension(ExtensionCalculated); ext != nil {
+		switch {
+		case item.Type != ItemDecimal && item.Type != ItemInteger && item.Type != ItemQuantity:
+			fail("item %s: calculated items must be decimal, integer or quantity", item.LinkID)
+		case ext.ValueExpression == nil || ext.ValueExpression.Language != ExpressionLanguage:
+			fail("item %s: calculatedExpression needs a %s valueExpression", item.LinkID, ExpressionLanguage)
+		default:
+			expr, err := parseExpression(ext.ValueExpression.Expression)
+			if err != nil {
+				fail("item %s: %v", item.LinkID, err)
+				break
+			}
+			for _, linkID := range expr.references() {
+				if question, ok := items[linkID]; !ok || !question.isQuestion() {
+					fail("item %s: calculatedExpression refers to unknown question %q", item.LinkID, linkID)
+				}
+			}
+		}
+	}
+	for _, url := range []string{ExtensionMinValue, ExtensionMaxValue} {
+		if ext := item.extension(url); ext != nil && boundValue(ext) == nil && ext.ValueDate == "" {
+			fail("item %s: %s needs a valueInteger, valueDecimal or valueDate", item.LinkID, url)
+		}
+	}
+	if ext := item.extension(ExtensionRegex); ext != nil {
+		if _, err := compileRegex(ext.ValueString); err != nil {
+			fail("item %s: invalid regex: %v", item.LinkID, err)
+		}
+	}
+	if ext := item.extension(ExtensionExtract); ext != nil && ext.ValueBoolean != nil && *ext.ValueBoolean &&
+		item.isQuestion() && len(item.Code) == 0 {
+		fail("item %s: observationExtract needs the item's code", item.LinkID)
+	}
+	return issues
+}
@@ -0,0 +1,611 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// maxCalculationPasses bounds the passes over a response while calculated
+// answers and enableWhen conditions settle
+const maxCalculationPasses = 10
+
+// ProcessQuestionnaireResponse checks a response against its questionnaire
+// the way the form does: items that are not enabled are removed, calculated
+// items are filled in, and the items are put in the questionnaire's order.
+// It returns the issues with the answers; required items are only enforced
+// once the response is completed. The response is left as it was when its
+// structure does not match the questionnaire.
+func ProcessQuestionnaireResponse(q *Questionnaire, qr *QuestionnaireResponse) []OperationOutcomeIssue {
+	var issues []OperationOutcomeIssue
+	checkStructure(q.Item, qr.Item, &issues)
+	if len(issues) > 0 {
+		return issues
+	}
+
+	answers := collectAnswers(qr.Item, answerSet{})
+	var items []QuestionnaireResponseItem
+	for pass := 0; pass < maxCalculationPasses; pass++ {
+		items = buildItems(q.Item, qr.Item, answers)
+		next := collectAnswers(items, answerSet{})
+		if sameAnswers(answers, next) {
+			break
+		}
+		answers = next
+	}
+	qr.Item = items
+
+	completed := qr.Status == models.SubmissionCompleted || qr.Status == models.SubmissionAmended
+	validateAnswers(q.Item, qr.Item, answers, completed, &issues)
+	sortIssues(issues)
+	return issues
+}
+
+// checkStructure reports response items that are not in the questionnaire at
+// their place, repeated items that do not repeat and answers given to groups
+func checkStructure(defs []QuestionnaireItem, items []QuestionnaireResponseItem, issues *[]OperationOutcomeIssue) {
+	byLinkID := map[string]*QuestionnaireItem{}
+	for i := range defs {
+		byLinkID[defs[i].LinkID] = &defs[i]
+	}
+	seen := map[string]int{}
+	for _, item := range items {
+		def, ok := byLinkID[item.LinkID]
+		if !ok {
+			*issues = append(*issues, itemIssue(IssueStructure, "QuestionnaireResponse", item.LinkID,
+				"item %s is not in the questionnaire at this place", item.LinkID))
+			continue
+		}
+		seen[item.LinkID]++
+		if seen[item.LinkID] == 2 && !(def.Type == ItemGroup && def.Repeats) {
+			*issues = append(*issues, itemIssue(IssueStructure, "QuestionnaireResponse", item.LinkID,
+				"item %s appears more than once; repeated answers go in one item", item.LinkID))
+		}
+		if !def.isQuestion() {
+			if len(item.Answer) > 0 {
+				*issues = append(*issues, itemIssue(IssueStructure, "QuestionnaireResponse", item.LinkID,
+					"%s item %s cannot have answers", def.Type, item.LinkID))
+			}
+			checkStructure(def.Item, item.Item, issues)
+			continue
+		}
+		if len(item.Item) > 0 {
+			*issues = append(*issues, itemIssue(IssueStructure, "QuestionnaireResponse", item.LinkID,
+				"items under question %s go under its answer", item.LinkID))
+		}
+		for _, answer := range item.Answer {
+			checkStructure(def.Item, answer.Item, issues)
+		}
+	}
+}
+
+// collectAnswers indexes the answers of a response by linkId. A question
+// under a repeating group is read at its first occurrence.
+func collectAnswers(items []QuestionnaireResponseItem, answers answerSet) answerSet {
+	for _, item := range items {
+		if _, exists := answers[item.LinkID]; !exists && len(item.Answer) > 0 {
+			answers[item.LinkID] = item.Answer
+		}
+		collectAnswers(item.Item, answers)
+		for _, answer := range item.Answer {
+			collectAnswers(answer.Item, answers)
+		}
+	}
+	return answers
+}
+
+func sameAnswers(a, b answerSet) bool {
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && string(x) == string(y)
+}
+
+// buildItems rebuilds the response items of a level of the questionnaire in
+// its order, without the items that are not enabled and with the calculated
+// items filled in from the answers
+func buildItems(defs []QuestionnaireItem, items []QuestionnaireResponseItem, answers answerSet) []QuestionnaireResponseItem {
+	var built []QuestionnaireResponseItem
+	for i := range defs {
+		def := &defs[i]
+		if def.Type == ItemDisplay || !enabled(def, answers) {
+			continue
+		}
+		var matches []QuestionnaireResponseItem
+		for _, item := range items {
+			if item.LinkID == def.LinkID {
+				matches = append(matches, item)
+			}
+		}
+
+		if def.Type == ItemGroup {
+			if len(matches) == 0 {
+				matches = []QuestionnaireResponseItem{{LinkID: def.LinkID, Text: def.Text}}
+			}
+			for _, group := range matches {
+				group.Item = buildItems(def.Item, group.Item, answers)
+				if len(group.Item) > 0 {
+					built = append(built, group)
+				}
+			}
+			continue
+		}
+
+		item := QuestionnaireResponseItem{LinkID: def.LinkID, Text: def.Text}
+		if len(matches) > 0 {
+			item = matches[0]
+		}
+		if calculated, ok := calculateAnswer(def, answers); ok {
+			item.Answer = []QuestionnaireResponseAnswer{calculated}
+		} else if def.extension(ExtensionCalculated) != nil {
+			item.Answer = nil
+		}
+		if len(item.Answer) == 0 {
+			continue
+		}
+		answered := make([]QuestionnaireResponseAnswer, len(item.Answer))
+		for j, answer := range item.Answer {
+			answer.Item = buildItems(def.Item, answer.Item, answers)
+			answered[j] = answer
+		}
+		item.Answer = answered
+		built = append(built, item)
+	}
+	return built
+}
+
+// calculateAnswer evaluates the calculated expression of an item
+func calculateAnswer(def *QuestionnaireItem, answers answerSet) (QuestionnaireResponseAnswer, bool) {
+	ext := def.extension(ExtensionCalculated)
+	if ext == nil || ext.ValueExpression == nil {
+		return QuestionnaireResponseAnswer{}, false
+	}
+	expr, err := parseExpression(ext.ValueExpression.Expression)
+	if err != nil {
+		return QuestionnaireResponseAnswer{}, false
+	}
+	value, ok := expr.evaluate(answers)
+	if !ok {
+		return QuestionnaireResponseAnswer{}, false
+	}
+	switch def.Type {
+	case ItemInteger:
+		n := int(math.Round(value))
+		return QuestionnaireResponseAnswer{ValueInteger: &n}, true
+	case ItemQuantity:
+		quantity := &Quantity{Value: &value}
+		if unit := def.extension(ExtensionUnit); unit != nil && unit.ValueCoding != nil {
+			quantity.Unit = unit.ValueCoding.Display
+			if quantity.Unit == "" {
+				quantity.Unit = unit.ValueCoding.Code
+			}
+			quantity.System, quantity.Code = unit.ValueCoding.System, unit.ValueCoding.Code
+		}
+		return QuestionnaireResponseAnswer{ValueQuantity: quantity}, true
+	}
+	return QuestionnaireResponseAnswer{ValueDecimal: &value}, true
+}
+
+// enabled evaluates an item's enableWhen conditions
+func enabled(def *QuestionnaireItem, answers answerSet) bool {
+	if len(def.EnableWhen) == 0 {
+		return true
+	}
+	anyOf := def.EnableBehavior == "any"
+	for i := range def.EnableWhen {
+		met := enableWhenMet(&def.EnableWhen[i], answers[def.EnableWhen[i].Question])
+		if met == anyOf {
+			return met
+		}
+	}
+	return !anyOf
+}
+
+// enableWhenMet evaluates one condition on a question's answers. Apart from
+// exists, a condition on an unanswered question is not met.
+func enableWhenMet(when *QuestionnaireEnableWhen, answers []QuestionnaireResponseAnswer) bool {
+	value, _ := when.answer()
+	if when.Operator == "exists" {
+		return when.AnswerBoolean != nil && (len(answers) > 0) == *when.AnswerBoolean
+	}
+	if len(answers) == 0 {
+		return false
+	}
+	if when.Operator == "!=" {
+		for _, answer := range answers {
+			if answer.equals(value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, answer := range answers {
+		if when.Operator == "=" {
+			if answer.equals(value) {
+				return true
+			}
+			continue
+		}
+		c, ok := answer.compare(value)
+		if !ok {
+			continue
+		}
+		switch when.Operator {
+		case ">":
+			ok = c > 0
+		case "<":
+			ok = c < 0
+		case ">=":
+			ok = c >= 0
+		case "<=":
+			ok = c <= 0
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAnswers checks the answers of a level of the response against the
+// questionnaire
+func validateAnswers(defs []QuestionnaireItem, items []QuestionnaireResponseItem, answers answerSet, completed bool, issues *[]OperationOutcomeIssue) {
+	for i := range defs {
+		def := &defs[i]
+		if def.Type == ItemDisplay || !enabled(def, answers) {
+			continue
+		}
+		var matches []QuestionnaireResponseItem
+		for _, item := range items {
+			if item.LinkID == def.LinkID {
+				matches = append(matches, item)
+			}
+		}
+		if def.Type == ItemGroup {
+			if len(matches) == 0 && def.Required && completed {
+				*issues = append(*issues, itemIssue(IssueRequired, "QuestionnaireResponse", def.LinkID, "%s is required", itemLabel(def)))
+			}
+			for _, group := range matches {
+				validateAnswers(def.Item, group.Item, answers, completed, issues)
+			}
+			continue
+		}
+
+		var given []QuestionnaireResponseAnswer
+		if len(matches) > 0 {
+			given = matches[0].Answer
+		}
+		if len(given) == 0 {
+			if def.Required && completed {
+				*issues = append(*issues, itemIssue(IssueRequired, "QuestionnaireResponse", def.LinkID, "%s is required", itemLabel(def)))
+			}
+			continue
+		}
+		if len(given) > 1 && !def.Repeats {
+			*issues = append(*issues, itemIssue(IssueValue, "QuestionnaireResponse", def.LinkID, "%s takes one answer", itemLabel(def)))
+		}
+		for _, answer := range given {
+			if msg := answerProblem(def, &answer); msg != "" {
+				*issues = append(*issues, itemIssue(IssueValue, "QuestionnaireResponse", def.LinkID, "%s: %s", itemLabel(def), msg))
+			}
+			validateAnswers(def.Item, answer.Item, answers, completed, issues)
+		}
+	}
+}
+
+// itemLabel names an item in issues by its text, or its linkId
+func itemLabel(def *QuestionnaireItem) string {
+	if def.Text != "" {
+		return def.Text
+	}
+	return def.LinkID
+}
+
+// answerProblem describes what is wrong with an answer, or is empty
+func answerProblem(def *QuestionnaireItem, a *QuestionnaireResponseAnswer) string {
+	if a.valueCount() != 1 {
+		return "an answer has exactly one value"
+	}
+	switch def.Type {
+	case ItemBoolean:
+		if a.ValueBoolean == nil {
+			return "expected valueBoolean"
+		}
+	case ItemDecimal:
+		if a.ValueDecimal == nil {
+			return "expected valueDecimal"
+		}
+	case ItemInteger:
+		if a.ValueInteger == nil {
+			return "expected valueInteger"
+		}
+	case ItemDate:
+		if _, err := time.Parse(DateFormat, a.ValueDate); err != nil {
+			return "expected valueDate as YYYY-MM-DD"
+		}
+	case ItemDateTime:
+		if _, err := ParseDateTime(a.ValueDateTime); err != nil || a.ValueDateTime == "" {
+			return "expected valueDateTime"
+		}
+	case ItemTime:
+		if !validTime(a.ValueTime) {
+			return "expected valueTime as hh:mm:ss"
+		}
+	case ItemString, ItemText:
+		if a.ValueString == "" {
+			return "expected valueString"
+		}
+	case ItemChoice:
+		if !optionMatches(def.AnswerOption, a) {
+			return "not one of the answer options"
+		}
+	case ItemOpenChoice:
+		if a.ValueString == "" && !optionMatches(def.AnswerOption, a) {
+			return "not one of the answer options or free text"
+		}
+	case ItemQuantity:
+		if a.ValueQuantity == nil || a.ValueQuantity.Value == nil {
+			return "expected valueQuantity with a value"
+		}
+	}
+
+	if value, ok := a.number(); ok {
+		if min := boundValue(def.extension(ExtensionMinValue)); min != nil && value < *min {
+			return fmt.Sprintf("must be at least %v", *min)
+		}
+		if max := boundValue(def.extension(ExtensionMaxValue)); max != nil && value > *max {
+			return fmt.Sprintf("must be at most %v", *max)
+		}
+	}
+	if a.ValueDate != "" {
+		if min := def.extension(ExtensionMinValue); min != nil && min.ValueDate != "" && a.ValueDate < min.ValueDate {
+			return "must be on or after " + min.ValueDate
+		}
+		if max := def.extension(ExtensionMaxValue); max != nil && max.ValueDate != "" && a.ValueDate > max.ValueDate {
+			return "must be on or before " + max.ValueDate
+		}
+	}
+	if a.ValueString != "" {
+		if def.MaxLength != nil && len([]rune(a.ValueString)) > *def.MaxLength {
+			return fmt.Sprintf("must be at most %d characters", *def.MaxLength)
+		}
+		if ext := def.extension(ExtensionRegex); ext != nil {
+			if re, err := compileRegex(ext.ValueString); err == nil && !re.MatchString(a.ValueString) {
+				return "is not in the expected format"
+			}
+		}
+	}
+	return ""
+}
+
+func validTime(value string) bool {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// optionMatches reports whether an answer is one of the answer options
+func optionMatches(options []QuestionnaireAnswerOption, a *QuestionnaireResponseAnswer) bool {
+	for _, option := range options {
+		value := QuestionnaireResponseAnswer{
+			ValueInteger: option.ValueInteger,
+			ValueDate:    option.ValueDate,
+			ValueTime:    option.ValueTime,
+			ValueString:  option.ValueString,
+			ValueCoding:  option.ValueCoding,
+		}
+		if a.equals(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// boundValue is the number of a minValue or maxValue extension
+func boundValue(ext *Extension) *float64 {
+	switch {
+	case ext == nil:
+		return nil
+	case ext.ValueDecimal != nil:
+		return ext.ValueDecimal
+	case ext.ValueInteger != nil:
+		value := float64(*ext.ValueInteger)
+		return &value
+	}
+	return nil
+}
+
+// compileRegex compiles a regex extension, which must match the whole answer
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// sortIssues orders issues by the item they are about
+func sortIssues(issues []OperationOutcomeIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return strings.Join(issues[i].Expression, ",") < strings.Join(issues[j].Expression, ",")
+	})
+}
+
+// valueCount counts the values set on an answer
+func (a *QuestionnaireResponseAnswer) valueCount() int {
+	n := 0
+	for _, set := range []bool{
+		a.ValueBoolean != nil, a.ValueDecimal != nil, a.ValueInteger != nil, a.ValueDate != "",
+		a.ValueDateTime != "", a.ValueTime != "", a.ValueString != "", a.ValueCoding != nil, a.ValueQuantity != nil,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// number is the numeric value of a decimal, integer or quantity answer
+func (a *QuestionnaireResponseAnswer) number() (float64, bool) {
+	switch {
+	case a.ValueDecimal != nil:
+		return *a.ValueDecimal, true
+	case a.ValueInteger != nil:
+		return float64(*a.ValueInteger), true
+	case a.ValueQuantity != nil && a.ValueQuantity.Value != nil:
+		return *a.ValueQuantity.Value, true
+	}
+	return 0, false
+}
+
+// text is the value of a string, date, dateTime or time answer
+func (a *QuestionnaireResponseAnswer) text() string {
+	for _, value := range []string{a.ValueString, a.ValueDate, a.ValueDateTime, a.ValueTime} {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// equals compares the values of two answers. Codings match on code, and on
+// system when both have one.
+func (a *QuestionnaireResponseAnswer) equals(b QuestionnaireResponseAnswer) bool {
+	switch {
+	case a.ValueBoolean != nil || b.ValueBoolean != nil:
+		return a.ValueBoolean != nil && b.ValueBoolean != nil && *a.ValueBoolean == *b.ValueBoolean
+	case a.ValueCoding != nil || b.ValueCoding != nil:
+		return a.ValueCoding != nil && b.ValueCoding != nil && a.ValueCoding.Code == b.ValueCoding.Code &&
+			(a.ValueCoding.System == "" || b.ValueCoding.System == "" || a.ValueCoding.System == b.ValueCoding.System)
+	}
+	if x, ok := a.number(); ok {
+		y, ok := b.number()
+		return ok && x == y
+	}
+	return a.text() != "" && a.text() == b.text()
+}
+
+// compare orders two numeric answers, or two date, dateTime or time answers
+// of the same format
+func (a *QuestionnaireResponseAnswer) compare(b QuestionnaireResponseAnswer) (int, bool) {
+	if x, ok := a.number(); ok {
+		y, ok := b.number()
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, y := a.text(), b.text()
+	if x == "" || y == "" || a.ValueString != "" || b.ValueString != "" {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// ExtractQuestionnaireObservations returns an observation for each answer
+// to a coded question marked for observation extraction, on the item or on
+// one of its ancestors or the questionnaire. The caller sets the patient,
+// encounter and time.
+func ExtractQuestionnaireObservations(q *Questionnaire, qr *QuestionnaireResponse) []models.QuestionnaireObservation {
+	var observations []models.QuestionnaireObservation
+	var walk func([]QuestionnaireItem, []QuestionnaireResponseItem, bool)
+	walk = func(defs []QuestionnaireItem, items []QuestionnaireResponseItem, extract bool) {
+		for i := range defs {
+			def := &defs[i]
+			flag := extract
+			if ext := def.extension(ExtensionExtract); ext != nil && ext.ValueBoolean != nil {
+				flag = *ext.ValueBoolean
+			}
+			for _, item := range items {
+				if item.LinkID != def.LinkID {
+					continue
+				}
+				walk(def.Item, item.Item, flag)
+				for _, answer := range item.Answer {
+					if flag && def.isQuestion() && len(def.Code) > 0 {
+						observations = append(observations, observationFromAnswer(def, &answer))
+					}
+					walk(def.Item, answer.Item, flag)
+				}
+			}
+		}
+	}
+	extract := false
+	if ext := findExtension(q.Extension, ExtensionExtract); ext != nil && ext.ValueBoolean != nil {
+		extract = *ext.ValueBoolean
+	}
+	walk(q.Item, qr.Item, extract)
+	return observations
+}
+
+func observationFromAnswer(def *QuestionnaireItem, a *QuestionnaireResponseAnswer) models.QuestionnaireObservation {
+	code := def.Code[0]
+	obs := models.QuestionnaireObservation{
+		LinkID:     def.LinkID,
+		CodeSystem: code.System,
+		Code:       code.Code,
+		Display:    code.Display,
+	}
+	if obs.Display == "" {
+		obs.Display = def.Text
+	}
+	switch {
+	case a.ValueQuantity != nil:
+		obs.ValueNumber = a.ValueQuantity.Value
+		obs.Unit = a.ValueQuantity.Code
+		if obs.Unit == "" {
+			obs.Unit = a.ValueQuantity.Unit
+		}
+	case a.ValueDecimal != nil || a.ValueInteger != nil:
+		value, _ := a.number()
+		obs.ValueNumber = &value
+		if unit := def.extension(ExtensionUnit); unit != nil && unit.ValueCoding != nil {
+			obs.Unit = unit.ValueCoding.Code
+		}
+	case a.ValueBoolean != nil:
+		obs.ValueBoolean = a.ValueBoolean
+	case a.ValueCoding != nil:
+		obs.ValueCodeSystem = a.ValueCoding.System
+		obs.ValueCode = a.ValueCoding.Code
+		obs.ValueString = a.ValueCoding.Display
+	default:
+		obs.ValueString = a.text()
+	}
+	return obs
+}
+
+// QuestionnaireResponseFromSubmission maps a stored submission to its
+// QuestionnaireResponse. The stored columns take precedence over the response.
+func QuestionnaireResponseFromSubmission(s *models.QuestionnaireSubmission) (*QuestionnaireResponse, error) {
+	var res QuestionnaireResponse
+	if err := json.Unmarshal([]byte(s.Response), &res); err != nil {
+		return nil, fmt.Errorf("questionnaire response %d: %w", s.ID, err)
+	}
+	res.ResourceType = "QuestionnaireResponse"
+	res.ID = fmt.Sprint(s.ID)
+	res.Meta = NewMeta(s.UpdatedAt)
+	if s.Questionnaire.ID != 0 {
+		res.Questionnaire = s.Questionnaire.Canonical()
+	}
+	res.Status = s.Status
+	res.Subject = NewReference("Patient", s.PatientID)
+	res.Encounter = nil
+	if s.EncounterID != nil {
+		res.Encounter = NewReference("Encounter", *s.EncounterID)
+	}
+	res.Authored = FormatDateTime(s.AuthoredAt)
+	res.Author = NewReference("Practitioner", s.AuthorID)
+	return &res, nil
+}
@@ -0,0 +1,278 @@
+package fhir
+
+import (
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func intPtr(i int) *int { return &i }
+
+func floatPtr(f float64) *float64 { return &f }
+
+// screeningQuestionnaire is a small NCD screening form: BMI is calculated,
+// the smoking group only shows for smokers and the pregnancy question only
+// for women
+func screeningQuestionnaire() *Questionnaire {
+	return &Questionnaire{
+		ResourceType: "Questionnaire",
+		URL:          "https://zarish-his.org/fhir/Questionnaire/ncd-screening",
+		Version:      "1",
+		Status:       "active",
+		Extension:    []Extension{{URL: ExtensionExtract, ValueBoolean: boolPtr(true)}},
+		Item: []QuestionnaireItem{
+			{LinkID: "intro", Type: ItemDisplay, Text: "Ask the patient to remove their shoes"},
+			{LinkID: "sex", Type: ItemChoice, Text: "Sex", Required: true, AnswerOption: []QuestionnaireAnswerOption{
+				{ValueCoding: &Coding{System: "http://hl7.org/fhir/administrative-gender", Code: "female"}},
+				{ValueCoding: &Coding{System: "http://hl7.org/fhir/administrative-gender", Code: "male"}},
+			}},
+			{LinkID: "pregnant", Type: ItemBoolean, Text: "Pregnant", Required: true, EnableWhen: []QuestionnaireEnableWhen{
+				{Question: "sex", Operator: "=", AnswerCoding: &Coding{Code: "female"}},
+			}},
+			{LinkID: "body", Type: ItemGroup, Text: "Body measurements", Item: []QuestionnaireItem{
+				{LinkID: "weight", Type: ItemDecimal, Text: "Weight", Required: true,
+					Code: []Coding{{System: "http://loinc.org", Code: "29463-7", Display: "Body weight"}},
+					Extension: []Extension{
+						{URL: ExtensionMinValue, ValueDecimal: floatPtr(1)},
+						{URL: ExtensionMaxValue, ValueInteger: intPtr(300)},
+						{URL: ExtensionUnit, ValueCoding: &Coding{System: "http://unitsofmeasure.org", Code: "kg"}},
+					}},
+				{LinkID: "height", Type: ItemQuantity, Text: "Height", Required: true,
+					Code: []Coding{{System: "http://loinc.org", Code: "8302-2"}}},
+				{LinkID: "bmi", Type: ItemDecimal, Text: "BMI", ReadOnly: true,
+					Code:      []Coding{{System: "http://loinc.org", Code: "39156-5", Display: "BMI"}},
+					Extension: []Extension{{URL: ExtensionCalculated, ValueExpression: &Expression{Language: ExpressionLanguage, Expression: bmiExpression}}}},
+				{LinkID: "obese", Type: ItemBoolean, Text: "Obese", EnableWhen: []QuestionnaireEnableWhen{
+					{Question: "bmi", Operator: ">=", AnswerDecimal: floatPtr(30)},
+				}},
+			}},
+			{LinkID: "smoker", Type: ItemBoolean, Text: "Smokes tobacco", Item: []QuestionnaireItem{
+				{LinkID: "per-day", Type: ItemInteger, Text: "Cigarettes a day", Required: true, EnableWhen: []QuestionnaireEnableWhen{
+					{Question: "smoker", Operator: "=", AnswerBoolean: boolPtr(true)},
+				}},
+			}},
+			{LinkID: "phone", Type: ItemString, Text: "Phone", MaxLength: intPtr(14),
+				Extension: []Extension{{URL: ExtensionRegex, ValueString: `\+?[0-9]+`}}},
+			{LinkID: "visit", Type: ItemDate, Text: "Visit date",
+				Extension: []Extension{{URL: ExtensionMinValue, ValueDate: "2024-01-01"}}},
+			{LinkID: "notes", Type: ItemText, Extension: []Extension{{URL: ExtensionExtract, ValueBoolean: boolPtr(false)}},
+				Code: []Coding{{Code: "notes"}}},
+		},
+	}
+}
+
+func answered(linkID string, answers ...QuestionnaireResponseAnswer) QuestionnaireResponseItem {
+	return QuestionnaireResponseItem{LinkID: linkID, Answer: answers}
+}
+
+func TestValidateQuestionnaire(t *testing.T) {
+	assert.Empty(t, ValidateQuestionnaire(screeningQuestionnaire()))
+}
+
+func TestProcessQuestionnaireResponse(t *testing.T) {
+	female := QuestionnaireResponseAnswer{ValueCoding: &Coding{System: "http://hl7.org/fhir/administrative-gender", Code: "female"}}
+	male := QuestionnaireResponseAnswer{ValueCoding: &Coding{Code: "male"}}
+	yes := QuestionnaireResponseAnswer{ValueBoolean: boolPtr(true)}
+	no := QuestionnaireResponseAnswer{ValueBoolean: boolPtr(false)}
+	kg := func(w float64) QuestionnaireResponseAnswer { return QuestionnaireResponseAnswer{ValueDecimal: &w} }
+	cm := func(h float64) QuestionnaireResponseAnswer {
+		return QuestionnaireResponseAnswer{ValueQuantity: &Quantity{Value: &h, Unit: "cm"}}
+	}
+	body := func(items ...QuestionnaireResponseItem) QuestionnaireResponseItem {
+		return QuestionnaireResponseItem{LinkID: "body", Item: items}
+	}
+
+	tests := []struct {
+		name       string
+		status     string
+		items      []QuestionnaireResponseItem
+		wantLinks  []string
+		wantBMI    *float64
+		wantIssues []string
+	}{
+		{"BMI is calculated and items are put in order", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			body(answered("height", cm(170)), answered("weight", kg(70))),
+			answered("sex", male),
+		}, []string{"sex", "body"}, floatPtr(24.2), nil},
+		{"a stale BMI is replaced", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			answered("sex", male),
+			body(answered("weight", kg(70)), answered("height", cm(170)), answered("bmi", kg(99))),
+		}, []string{"sex", "body"}, floatPtr(24.2), nil},
+		{"a calculated answer enables an item", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			answered("sex", male),
+			body(answered("weight", kg(101.2)), answered("height", cm(170)), answered("obese", yes)),
+		}, []string{"sex", "body"}, floatPtr(35), nil},
+		{"enabled required item", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			answered("sex", female),
+			body(answered("weight", kg(70)), answered("height", cm(170))),
+		}, []string{"sex", "body"}, floatPtr(24.2), []string{"Pregnant is required"}},
+		{"nested question under a yes", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			answered("sex", female), answered("pregnant", no),
+			body(answered("weight", kg(70)), answered("height", cm(170))),
+			{LinkID: "smoker", Answer: []QuestionnaireResponseAnswer{{ValueBoolean: boolPtr(true)}}},
+		}, []string{"sex", "pregnant", "body", "smoker"}, floatPtr(24.2), []string{"Cigarettes a day is required"}},
+		{"required items wait for completion", models.SubmissionInProgress, []QuestionnaireResponseItem{
+			answered("sex", female),
+		}, []string{"sex"}, nil, nil},
+		{"no BMI without height", models.SubmissionCompleted, []QuestionnaireResponseItem{
+			answered("sex", male), body(answered("weight", kg(70))),
+		}, []string{"sex", "body"}, nil, []string{"Height is required"}},
+		{"values are checked", models.SubmissionInProgress, []QuestionnaireResponseItem{
+			answered("sex", QuestionnaireResponseAnswer{ValueCoding: &Coding{Code: "unknown"}}),
+			body(answered("weight", kg(350)), answered("height", QuestionnaireResponseAnswer{ValueString: "tall"})),
+			answered("phone", QuestionnaireResponseAnswer{ValueString: "017-1234"}),
+			answered("visit", QuestionnaireResponseAnswer{ValueDate: "2023-12-31"}),
+		}, []string{"sex", "body", "phone", "visit"}, nil, []string{
+			"Height: expected valueQuantity with a value",
+			"Phone: is not in the expected format",
+			"Sex: not one of the answer options",
+			"Visit date: must be on or after 2024-01-01",
+			"Weight: must be at most 300",
+		}},
+		{"one answer to a question that does not repeat", models.SubmissionInProgress, []QuestionnaireResponseItem{
+			answered("sex", male, female),
+			answered("phone", QuestionnaireResponseAnswer{ValueString: "+8801712345678901"}),
+			answered("notes", QuestionnaireResponseAnswer{ValueString: "x", ValueBoolean: boolPtr(true)}),
+		}, []string{"sex", "phone", "notes"}, nil, []string{
+			"notes: an answer has exactly one value",
+			"Phone: must be at most 14 characters",
+			"Sex takes one answer",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qr := &QuestionnaireResponse{Status: tt.status, Item: tt.items}
+			issues := ProcessQuestionnaireResponse(screeningQuestionnaire(), qr)
+
+			var links []string
+			for _, item := range qr.Item {
+				links = append(links, item.LinkID)
+			}
+			assert.Equal(t, tt.wantLinks, links)
+
+			bmi := collectAnswers(qr.Item, answerSet{})["bmi"]
+			if tt.wantBMI == nil {
+				assert.Empty(t, bmi)
+			} else {
+				require.Len(t, bmi, 1)
+				require.NotNil(t, bmi[0].ValueDecimal)
+				assert.InDelta(t, *tt.wantBMI, *bmi[0].ValueDecimal, 1e-9)
+			}
+
+			var diagnostics []string
+			for _, issue := range issues {
+				diagnostics = append(diagnostics, issue.Diagnostics)
+			}
+			assert.ElementsMatch(t, tt.wantIssues, diagnostics)
+		})
+	}
+
+	// Answers to items that are not enabled are removed
+	qr := &QuestionnaireResponse{Status: models.SubmissionCompleted, Item: []QuestionnaireResponseItem{
+		answered("sex", male),
+		answered("pregnant", yes),
+		body(answered("weight", kg(70)), answered("height", cm(170)), answered("obese", yes)),
+	}}
+	require.Empty(t, ProcessQuestionnaireResponse(screeningQuestionnaire(), qr))
+	answers := collectAnswers(qr.Item, answerSet{})
+	assert.NotContains(t, answers, "pregnant")
+	assert.NotContains(t, answers, "obese")
+	assert.Contains(t, answers, "weight")
+}
+
+func TestProcessQuestionnaireResponseStructure(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []QuestionnaireResponseItem
+		want  string
+	}{
+		{"unknown item", []QuestionnaireResponseItem{answered("colour", QuestionnaireResponseAnswer{ValueString: "red"})},
+			"item colour is not in the questionnaire at this place"},
+		{"item at the wrong level", []QuestionnaireResponseItem{answered("weight", QuestionnaireResponseAnswer{ValueDecimal: floatPtr(70)})},
+			"item weight is not in the questionnaire at this place"},
+		{"repeated question", []QuestionnaireResponseItem{answered("phone"), answered("phone")},
+			"item phone appears more than once; repeated answers go in one item"},
+		{"answered group", []QuestionnaireResponseItem{answered("body", QuestionnaireResponseAnswer{ValueString: "x"})},
+			"group item body cannot have answers"},
+		{"items under a question", []QuestionnaireResponseItem{{LinkID: "smoker", Item: []QuestionnaireResponseItem{answered("per-day")}}},
+			"items under question smoker go under its answer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qr := &QuestionnaireResponse{Status: models.SubmissionCompleted, Item: tt.items}
+			issues := ProcessQuestionnaireResponse(screeningQuestionnaire(), qr)
+			require.Len(t, issues, 1)
+			assert.Equal(t, IssueStructure, issues[0].Code)
+			assert.Equal(t, tt.want, issues[0].Diagnostics)
+			assert.Equal(t, tt.items, qr.Item, "the response is left as it was")
+		})
+	}
+}
+
+func TestEnableWhenMet(t *testing.T) {
+	five := integerAnswer(intPtr(5))
+	date := []QuestionnaireResponseAnswer{{ValueDate: "2024-05-01"}}
+	coded := []QuestionnaireResponseAnswer{{ValueCoding: &Coding{System: "http://snomed.info/sct", Code: "77176002"}}}
+
+	tests := []struct {
+		name    string
+		when    QuestionnaireEnableWhen
+		answers []QuestionnaireResponseAnswer
+		want    bool
+	}{
+		{"exists", QuestionnaireEnableWhen{Operator: "exists", AnswerBoolean: boolPtr(true)}, five, true},
+		{"exists unanswered", QuestionnaireEnableWhen{Operator: "exists", AnswerBoolean: boolPtr(true)}, nil, false},
+		{"not exists unanswered", QuestionnaireEnableWhen{Operator: "exists", AnswerBoolean: boolPtr(false)}, nil, true},
+		{"integer equals decimal", QuestionnaireEnableWhen{Operator: "=", AnswerDecimal: floatPtr(5)}, five, true},
+		{"not equal", QuestionnaireEnableWhen{Operator: "!=", AnswerInteger: intPtr(4)}, five, true},
+		{"not equal unanswered", QuestionnaireEnableWhen{Operator: "!=", AnswerInteger: intPtr(4)}, nil, false},
+		{"greater", QuestionnaireEnableWhen{Operator: ">", AnswerInteger: intPtr(4)}, five, true},
+		{"less or equal", QuestionnaireEnableWhen{Operator: "<=", AnswerInteger: intPtr(4)}, five, false},
+		{"date after", QuestionnaireEnableWhen{Operator: ">=", AnswerDate: "2024-05-01"}, date, true},
+		{"date before", QuestionnaireEnableWhen{Operator: "<", AnswerDate: "2024-05-01"}, date, false},
+		{"number against a date", QuestionnaireEnableWhen{Operator: ">", AnswerInteger: intPtr(1)}, date, false},
+		{"coding without system", QuestionnaireEnableWhen{Operator: "=", AnswerCoding: &Coding{Code: "77176002"}}, coded, true},
+		{"coding in another system", QuestionnaireEnableWhen{Operator: "=", AnswerCoding: &Coding{System: "http://loinc.org", Code: "77176002"}}, coded, false},
+		{"any of several answers", QuestionnaireEnableWhen{Operator: "=", AnswerInteger: intPtr(5)}, append(integerAnswer(intPtr(3)), five...), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, enableWhenMet(&tt.when, tt.answers))
+		})
+	}
+
+	def := &QuestionnaireItem{EnableWhen: []QuestionnaireEnableWhen{
+		{Question: "a", Operator: "exists", AnswerBoolean: boolPtr(true)},
+		{Question: "b", Operator: "exists", AnswerBoolean: boolPtr(true)},
+	}}
+	onlyA := answerSet{"a": five}
+	assert.False(t, enabled(def, onlyA), "all conditions by default")
+	def.EnableBehavior = "any"
+	assert.True(t, enabled(def, onlyA))
+	assert.False(t, enabled(def, answerSet{}))
+}
+
+func TestExtractQuestionnaireObservations(t *testing.T) {
+	height := 170.0
+	qr := &QuestionnaireResponse{Status: models.SubmissionCompleted, Item: []QuestionnaireResponseItem{
+		answered("sex", QuestionnaireResponseAnswer{ValueCoding: &Coding{Code: "male"}}),
+		{LinkID: "body", Item: []QuestionnaireResponseItem{
+			answered("weight", QuestionnaireResponseAnswer{ValueDecimal: floatPtr(70)}),
+			answered("height", QuestionnaireResponseAnswer{ValueQuantity: &Quantity{Value: &height, Unit: "cm", Code: "cm"}}),
+		}},
+		answered("notes", QuestionnaireResponseAnswer{ValueString: "well"}),
+	}}
+	require.Empty(t, ProcessQuestionnaireResponse(screeningQuestionnaire(), qr))
+
+	got := ExtractQuestionnaireObservations(screeningQuestionnaire(), qr)
+	// sex has no code and notes opts out of extraction
+	assert.Equal(t, []models.QuestionnaireObservation{
+		{LinkID: "weight", CodeSystem: "http://loinc.org", Code: "29463-7", Display: "Body weight", ValueNumber: floatPtr(70), Unit: "kg"},
+		{LinkID: "height", CodeSystem: "http://loinc.org", Code: "8302-2", Display: "Height", ValueNumber: &height, Unit: "cm"},
+		{LinkID: "bmi", CodeSystem: "http://loinc.org", Code: "39156-5", Display: "BMI", ValueNumber: floatPtr(24.2)},
+	}, got)
+}
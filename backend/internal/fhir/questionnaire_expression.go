@@ -0,0 +1,290 @@
+package fhir
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Calculated expressions are a subset of FHIRPath: numbers, + - * /,
+// parentheses, unary minus, .round(n) and references to the first answer of a
+// question. BMI, for example, is
+//
+//	(%resource.item.where(linkId='weight').answer.value * 10000
+//		/ %resource.item.where(linkId='height').answer.value
+//		/ %resource.item.where(linkId='height').answer.value).round(1)
+//
+// References may also start at %context or use descendants(); only the
+// linkId they select matters. A reference to an unanswered question, or a
+// division by zero, gives no value.
+
+// answerSet holds the answers of a response by linkId
+type answerSet map[string][]QuestionnaireResponseAnswer
+
+type exprNode interface {
+	eval(answers answerSet) (float64, bool)
+	refs(linkIDs *[]string)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(answerSet) (float64, bool) { return float64(n), true }
+func (n numberNode) refs(*[]string)                 {}
+
+type refNode string
+
+func (n refNode) eval(answers answerSet) (float64, bool) {
+	if list := answers[string(n)]; len(list) > 0 {
+		return list[0].number()
+	}
+	return 0, false
+}
+
+func (n refNode) refs(linkIDs *[]string) { *linkIDs = append(*linkIDs, string(n)) }
+
+type negNode struct{ x exprNode }
+
+func (n negNode) eval(answers answerSet) (float64, bool) {
+	x, ok := n.x.eval(answers)
+	return -x, ok
+}
+
+func (n negNode) refs(linkIDs *[]string) { n.x.refs(linkIDs) }
+
+type binaryNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binaryNode) eval(answers answerSet) (float64, bool) {
+	l, ok := n.l.eval(answers)
+	if !ok {
+		return 0, false
+	}
+	r, ok := n.r.eval(answers)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	}
+	if r == 0 {
+		return 0, false
+	}
+	return l / r, true
+}
+
+func (n binaryNode) refs(linkIDs *[]string) {
+	n.l.refs(linkIDs)
+	n.r.refs(linkIDs)
+}
+
+type roundNode struct {
+	x      exprNode
+	digits int
+}
+
+func (n roundNode) eval(answers answerSet) (float64, bool) {
+	x, ok := n.x.eval(answers)
+	if !ok {
+		return 0, false
+	}
+	scale := math.Pow(10, float64(n.digits))
+	return math.Round(x*scale) / scale, true
+}
+
+func (n roundNode) refs(linkIDs *[]string) { n.x.refs(linkIDs) }
+
+// calcExpression is a parsed calculated expression
+type calcExpression struct {
+	root exprNode
+}
+
+// references returns the linkIds the expression reads
+func (e *calcExpression) references() []string {
+	var linkIDs []string
+	e.root.refs(&linkIDs)
+	return linkIDs
+}
+
+// evaluate computes the expression, reporting false when it has no value
+func (e *calcExpression) evaluate(answers answerSet) (float64, bool) {
+	value, ok := e.root.eval(answers)
+	if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+var (
+	linkIDPattern = regexp.MustCompile(`linkId\s*=\s*'([^']*)'`)
+	roundPattern  = regexp.MustCompile(`^\.round\((\d+)\)`)
+)
+
+// exprParser is a recursive descent parser over an expression's text
+type exprParser struct {
+	src string
+	pos int
+}
+
+func parseExpression(src string) (*calcExpression, error) {
+	p := &exprParser{src: src}
+	root, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &calcExpression{root: root}, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// next returns the next non-space byte without consuming it, or 0 at the end
+func (p *exprParser) next() byte {
+	p.skipSpace()
+	if p.pos == len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) sum() (exprNode, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '+' || op == '-'; op = p.next() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) product() (exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == '*' || op == '/'; op = p.next() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.next() == '-' {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		m := roundPattern.FindStringSubmatch(p.src[p.pos:])
+		if m == nil {
+			return x, nil
+		}
+		digits, _ := strconv.Atoi(m[1])
+		p.pos += len(m[0])
+		x = roundNode{x: x, digits: digits}
+	}
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	switch c := p.next(); {
+	case c == '(':
+		p.pos++
+		x, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case c == '%':
+		return p.reference()
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return numberNode(value), nil
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	default:
+		return nil, p.errorf("unexpected %q", string(c))
+	}
+}
+
+// reference reads a path from %resource or %context up to an operator or
+// .round(n), and returns the linkId it selects
+func (p *exprParser) reference() (exprNode, error) {
+	start := p.pos
+	p.pos++
+	depth, quoted := 0, false
+	for ; p.pos < len(p.src); p.pos++ {
+		c := p.src[p.pos]
+		if quoted {
+			quoted = c != '\''
+			continue
+		}
+		if depth == 0 && (strings.IndexByte(" \t\r\n+-*/)", c) >= 0 || roundPattern.MatchString(p.src[p.pos:])) {
+			break
+		}
+		switch c {
+		case '\'':
+			quoted = true
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	path := p.src[start:p.pos]
+	if !strings.HasPrefix(path, "%resource.") && !strings.HasPrefix(path, "%context.") {
+		return nil, fmt.Errorf("expression: unsupported reference %q; use %%resource", path)
+	}
+	m := linkIDPattern.FindAllStringSubmatch(path, -1)
+	if m == nil {
+		return nil, fmt.Errorf("expression: reference %q does not select an item by linkId", path)
+	}
+	return refNode(m[len(m)-1][1]), nil
+}
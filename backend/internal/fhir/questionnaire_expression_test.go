@@ -0,0 +1,83 @@
+package fhir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bmiExpression = `(%resource.item.where(linkId='weight').answer.value * 10000
+	/ %resource.item.where(linkId='height').answer.value
+	/ %resource.item.where(linkId='height').answer.value).round(1)`
+
+func TestCalcExpression(t *testing.T) {
+	height := 170.0
+	answers := answerSet{
+		"weight": {{ValueDecimal: floatPtr(70)}},
+		"height": {{ValueQuantity: &Quantity{Value: &height, Unit: "cm"}}},
+		"sbp":    integerAnswer(intPtr(120)),
+		"dbp":    integerAnswer(intPtr(80)),
+		"zero":   integerAnswer(intPtr(0)),
+		"note":   {{ValueString: "text"}},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		want     float64
+		wantOK   bool
+		wantRefs []string
+	}{
+		{"BMI", bmiExpression, 24.2, true, []string{"weight", "height", "height"}},
+		{"precedence", "1 + 2 * 3 - 4 / 2", 5, true, nil},
+		{"left associative", "10 - 4 - 3", 3, true, nil},
+		{"parentheses", "(1 + 2) * 3", 9, true, nil},
+		{"unary minus", "-2 * -(3 - 1)", 4, true, nil},
+		{"decimal number", "0.5 * 3", 1.5, true, nil},
+		{"round to whole", "(7 / 2).round(0)", 4, true, nil},
+		{"round twice", "(2 / 3).round(3).round(1)", 0.7, true, nil},
+		{"mean arterial pressure", "(%resource.item.where(linkId='dbp').answer.value * 2 + %resource.item.where(linkId='sbp').answer.value) / 3",
+			93.33333333333333, true, []string{"dbp", "sbp"}},
+		{"context and descendants", "%context.descendants().where(linkId = 'sbp').answer.value - 20", 100, true, []string{"sbp"}},
+		{"nested item path selects the last linkId", "%resource.item.where(linkId='vitals').item.where(linkId='dbp').answer.value", 80, true, []string{"dbp"}},
+		{"unanswered question", "%resource.item.where(linkId='pulse').answer.value + 1", 0, false, []string{"pulse"}},
+		{"text answer", "%resource.item.where(linkId='note').answer.value", 0, false, []string{"note"}},
+		{"division by zero", "1 / %resource.item.where(linkId='zero').answer.value", 0, false, []string{"zero"}},
+		{"unanswered inside round", "(%resource.item.where(linkId='pulse').answer.value).round(1)", 0, false, []string{"pulse"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseExpression(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRefs, expr.references())
+			got, ok := expr.evaluate(answers)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestParseExpressionRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", ""},
+		{"dangling operator", "1 +"},
+		{"missing parenthesis", "(1 + 2"},
+		{"extra parenthesis", "1 + 2)"},
+		{"unknown function", "(1 + 2).sqrt()"},
+		{"two numbers", "1 2"},
+		{"malformed number", "1.2.3"},
+		{"identifier", "weight * 2"},
+		{"unsupported root", "%patient.item.where(linkId='weight').answer.value"},
+		{"no linkId", "%resource.item.answer.value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExpression(tt.expr)
+			assert.Error(t, err)
+		})
+	}
+}
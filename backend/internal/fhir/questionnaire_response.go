@@ -0,0 +1,340 @@
+package fhir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+const (
+	// QuestionnaireBase is the canonical URL prefix of the Zarish-HIS forms
+	QuestionnaireBase = "https://zarish-his.org/fhir/Questionnaire/"
+	// NCDScreeningQuestionnaire is the canonical URL of the NCD screening form
+	NCDScreeningQuestionnaire = QuestionnaireBase + "ncd-screening"
+
+	// SystemNCDScreening codes the answers of the NCD screening checklists
+	SystemNCDScreening = "urn:zarish-his:ncd-screening"
+	SystemSNOMED       = "http://snomed.info/sct"
+
+	// NCDObservationPrefix prefixes the IDs of the Observations of an NCD
+	// screening, which are "ncd-<screening id>-<measurement>"
+	NCDObservationPrefix = "ncd-"
+)
+
+// QuestionnaireResponse is the FHIR R4 QuestionnaireResponse resource, used
+// for the answers of forms such as the NCD screening
+type QuestionnaireResponse struct {
+	ResourceType  string                      `json:"resourceType"`
+	ID            string                      `json:"id,omitempty"`
+	Meta          *Meta                       `json:"meta,omitempty"`
+	Questionnaire string                      `json:"questionnaire,omitempty"`
+	Status        string                      `json:"status"`
+	Subject       *Reference                  `json:"subject,omitempty"`
+	Encounter     *Reference                  `json:"encounter,omitempty"`
+	Authored      string                      `json:"authored,omitempty"`
+	Author        *Reference                  `json:"author,omitempty"`
+	Item          []QuestionnaireResponseItem `json:"item,omitempty"`
+}
+
+type QuestionnaireResponseItem struct {
+	LinkID string                        `json:"linkId"`
+	Text   string                        `json:"text,omitempty"`
+	Answer []QuestionnaireResponseAnswer `json:"answer,omitempty"`
+	Item   []QuestionnaireResponseItem   `json:"item,omitempty"`
+}
+
+type QuestionnaireResponseAnswer struct {
+	ValueBoolean  *bool     `json:"valueBoolean,omitempty"`
+	ValueDecimal  *float64  `json:"valueDecimal,omitempty"`
+	ValueInteger  *int      `json:"valueInteger,omitempty"`
+	ValueDate     string    `json:"valueDate,omitempty"`
+	ValueDateTime string    `json:"valueDateTime,omitempty"`
+	ValueTime     string    `json:"valueTime,omitempty"`
+	ValueString   string    `json:"valueString,omitempty"`
+	ValueCoding   *Coding   `json:"valueCoding,omitempty"`
+	ValueQuantity *Quantity `json:"valueQuantity,omitempty"`
+
+	// Items nested under the question, answered for this answer
+	Item []QuestionnaireResponseItem `json:"item,omitempty"`
+}
+
+var questionnaireResponseStatuses = newCodeMap(
+	[2]string{models.NCDScreeningInProgress, "in-progress"},
+	[2]string{models.NCDScreeningCompleted, "completed"},
+)
+
+// QuestionnaireResponseStatusCodes returns the internal screening statuses matching a FHIR status
+func QuestionnaireResponseStatusCodes(code string) []string {
+	return questionnaireResponseStatuses.InternalCodes(code)
+}
+
+// qrItem is an answered question, or nil when it has no answer
+func qrItem(linkID, text string, answers ...QuestionnaireResponseAnswer) *QuestionnaireResponseItem {
+	if len(answers) == 0 {
+		return nil
+	}
+	return &QuestionnaireResponseItem{LinkID: linkID, Text: text, Answer: answers}
+}
+
+// qrGroup groups the answered items, or is nil when none is answered
+func qrGroup(linkID, text string, items ...*QuestionnaireResponseItem) *QuestionnaireResponseItem {
+	group := &QuestionnaireResponseItem{LinkID: linkID, Text: text}
+	for _, item := range items {
+		if item != nil {
+			group.Item = append(group.Item, *item)
+		}
+	}
+	if len(group.Item) == 0 {
+		return nil
+	}
+	return group
+}
+
+func stringAnswer(value string) []QuestionnaireResponseAnswer {
+	if value == "" {
+		return nil
+	}
+	return []QuestionnaireResponseAnswer{{ValueString: value}}
+}
+
+func booleanAnswer(value bool) []QuestionnaireResponseAnswer {
+	return []QuestionnaireResponseAnswer{{ValueBoolean: &value}}
+}
+
+func integerAnswer(value *int) []QuestionnaireResponseAnswer {
+	if value == nil {
+		return nil
+	}
+	return []QuestionnaireResponseAnswer{{ValueInteger: value}}
+}
+
+func quantityAnswer(value *float64, unit string) []QuestionnaireResponseAnswer {
+	if value == nil {
+		return nil
+	}
+	return []QuestionnaireResponseAnswer{{ValueQuantity: &Quantity{Value: value, Unit: unit, System: SystemUCUM, Code: unit}}}
+}
+
+func codeAnswer(code string) []QuestionnaireResponseAnswer {
+	if code == "" {
+		return nil
+	}
+	return []QuestionnaireResponseAnswer{{ValueCoding: &Coding{System: SystemNCDScreening, Code: code}}}
+}
+
+// checklistAnswers answers a checklist with one coding per ticked item
+func checklistAnswers(items []models.NCDChecklistItem, codes []string) []QuestionnaireResponseAnswer {
+	var answers []QuestionnaireResponseAnswer
+	for _, code := range codes {
+		coding := &Coding{System: SystemNCDScreening, Code: code}
+		for _, item := range items {
+			if item.Code == code {
+				coding.Display = item.Display
+			}
+		}
+		answers = append(answers, QuestionnaireResponseAnswer{ValueCoding: coding})
+	}
+	return answers
+}
+
+// QuestionnaireResponseFromNCDScreening maps an NCD screening to a
+// QuestionnaireResponse with one group per part of the form and one item per
+// answered question, numbered as on the paper form
+func QuestionnaireResponseFromNCDScreening(s *models.NCDScreening) *QuestionnaireResponse {
+	res := &QuestionnaireResponse{
+		ResourceType:  "QuestionnaireResponse",
+		ID:            fmt.Sprint(s.ID),
+		Meta:          NewMeta(s.UpdatedAt),
+		Questionnaire: NCDScreeningQuestionnaire,
+		Status:        questionnaireResponseStatuses.ToFHIR(s.Status, "in-progress"),
+		Subject:       NewReference("Patient", s.PatientID),
+		Encounter:     NewReference("Encounter", s.EncounterID),
+		Authored:      FormatDateTime(s.ScreenedAt),
+		Author:        NewReference("Practitioner", s.ScreenedBy),
+	}
+	if s.ConsultedAt != nil {
+		res.Authored = FormatDateTime(*s.ConsultedAt)
+	}
+
+	var followUp []QuestionnaireResponseAnswer
+	if s.FollowUpDate != nil {
+		followUp = []QuestionnaireResponseAnswer{{ValueDate: s.FollowUpDate.Format(DateFormat)}}
+	}
+	cvdRisk := append(quantityAnswer(s.CVDRisk, "%"), codeAnswer(s.CVDRiskCategory)...)
+	var enrolled, bookIssued []QuestionnaireResponseAnswer
+	if s.EnrolledAt != nil {
+		enrolled = []QuestionnaireResponseAnswer{{ValueDate: s.EnrolledAt.Format(DateFormat)}}
+		bookIssued = booleanAnswer(s.NCDBookIssued)
+	}
+
+	parts := []*QuestionnaireResponseItem{
+		qrGroup("B", "Part B: Nursing station",
+			qrItem("B-1", "Current history", stringAnswer(s.CurrentHistory)...),
+			qrItem("B-2", "Symptoms", checklistAnswers(models.NCDSymptoms, s.Symptoms)...),
+			qrItem("B-3", "Female history", checklistAnswers(models.NCDFemaleHistory, s.FemaleHistory)...),
+			qrItem("B-4", "CVD-focused history", checklistAnswers(models.NCDWarningSigns, s.WarningSigns)...),
+			qrItem("B-5", "Family history", checklistAnswers(models.NCDConditions, s.FamilyHistory)...),
+			qrGroup("B-6", "Risk factors",
+				qrItem("B-6.1", "Tobacco smoking", codeAnswer(s.TobaccoUse)...),
+				qrItem("B-6.2", "Smokeless tobacco", booleanAnswer(s.SmokelessTobacco)...),
+				qrItem("B-6.3", "Alcohol", codeAnswer(s.AlcoholUse)...),
+				qrItem("B-6.4", "Servings of fruit and vegetables per day", integerAnswer(s.FruitVegetableServings)...),
+				qrItem("B-6.5", "Minutes of moderate physical activity per week", integerAnswer(s.PhysicalActivityMinutes)...),
+				qrItem("B-6.6", "Adds salt at the table", booleanAnswer(s.ExtraSalt)...),
+			),
+			qrGroup("B-7", "Vital signs and casual tests",
+				qrItem("B-7.1", "Systolic blood pressure", quantityAnswer(intToFloat(s.SystolicBP), "mm[Hg]")...),
+				qrItem("B-7.2", "Diastolic blood pressure", quantityAnswer(intToFloat(s.DiastolicBP), "mm[Hg]")...),
+				qrItem("B-7.3", "Weight", quantityAnswer(s.Weight, "kg")...),
+				qrItem("B-7.4", "Height", quantityAnswer(s.Height, "cm")...),
+				qrItem("B-7.5", "Body mass index", quantityAnswer(s.BMI, "kg/m2")...),
+				qrItem("B-7.6", "Waist circumference", quantityAnswer(s.WaistCircumference, "cm")...),
+				qrItem("B-7.7", "Blood glucose", quantityAnswer(s.BloodGlucose, "mmol/L")...),
+				qrItem("B-7.8", "Glucose test", codeAnswer(s.GlucoseTest)...),
+			),
+		),
+		qrGroup("C", "Part C: Consultation",
+			qrItem("C-1", "Previous medical history", checklistAnswers(models.NCDConditions, s.KnownConditions)...),
+			qrItem("C-1.1", "Current medications", stringAnswer(s.CurrentMedications)...),
+			qrItem("C-2", "Clinical assessment", stringAnswer(s.ClinicalAssessment)...),
+			qrGroup("C-3", "Lab tests",
+				qrItem("C-3.1", "Total cholesterol", quantityAnswer(s.TotalCholesterol, "mmol/L")...),
+				qrItem("C-3.2", "HbA1c", quantityAnswer(s.HbA1c, "%")...),
+			),
+			qrItem("C-4", "CVD risk", cvdRisk...),
+			qrItem("C-5", "Final diagnosis", checklistAnswers(models.NCDConditions, s.Diagnoses)...),
+			qrItem("C-5.1", "Diagnosis notes", stringAnswer(s.DiagnosisNotes)...),
+			qrItem("C-6", "Management plan", stringAnswer(s.ManagementPlan)...),
+			qrItem("C-6.1", "Follow-up date", followUp...),
+			qrItem("C-7", "Screening outcome", codeAnswer(s.Outcome)...),
+		),
+		qrGroup("D", "Part D: Enrolment",
+			qrItem("D-1", "Enrolled programs", checklistAnswers(models.NCDConditions, s.EnrolledPrograms)...),
+			qrItem("D-2", "NCD number", stringAnswer(s.NCDNumber)...),
+			qrItem("D-3", "Enrolment date", enrolled...),
+			qrItem("D-4", "NCD book issued", bookIssued...),
+		),
+	}
+	for _, part := range parts {
+		if part != nil {
+			res.Item = append(res.Item, *part)
+		}
+	}
+	return res
+}
+
+// SNOMED CT codes of tobacco and alcohol use
+var (
+	tobaccoUseCodes = map[string]Coding{
+		models.UseNever:   {System: SystemSNOMED, Code: "266919005", Display: "Never smoked tobacco"},
+		models.UseFormer:  {System: SystemSNOMED, Code: "8517006", Display: "Ex-smoker"},
+		models.UseCurrent: {System: SystemSNOMED, Code: "77176002", Display: "Smoker"},
+	}
+	alcoholUseCodes = map[string]Coding{
+		models.UseNever:   {System: SystemSNOMED, Code: "105542008", Display: "Non-drinker"},
+		models.UseFormer:  {System: SystemSNOMED, Code: "82581004", Display: "Ex-drinker"},
+		models.UseCurrent: {System: SystemSNOMED, Code: "219006", Display: "Current drinker of alcohol"},
+	}
+)
+
+// ParseNCDObservationID returns the screening ID of an NCD screening Observation ID
+func ParseNCDObservationID(id string) (uint, bool) {
+	rest, ok := strings.CutPrefix(id, NCDObservationPrefix)
+	if !ok {
+		return 0, false
+	}
+	screening, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(screening, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// ObservationsFromNCDScreening maps the casual tests, lab tests, tobacco and
+// alcohol use and CVD risk of an NCD screening to Observations derived from
+// its QuestionnaireResponse. BP, weight and height are the encounter's vital
+// signs Observation.
+func ObservationsFromNCDScreening(s *models.NCDScreening) []*Observation {
+	var observations []*Observation
+	add := func(key, category, categoryDisplay string, code Coding) *Observation {
+		res := &Observation{
+			ResourceType:      "Observation",
+			ID:                fmt.Sprintf("%s%d-%s", NCDObservationPrefix, s.ID, key),
+			Meta:              NewMeta(s.UpdatedAt),
+			Status:            "final",
+			Category:          []CodeableConcept{categoryConcept(category, categoryDisplay)},
+			Code:              CodeableConcept{Coding: []Coding{code}, Text: code.Display},
+			Subject:           NewReference("Patient", s.PatientID),
+			Encounter:         NewReference("Encounter", s.EncounterID),
+			EffectiveDateTime: FormatDateTime(s.ScreenedAt),
+			DerivedFrom:       []Reference{*NewReference("QuestionnaireResponse", s.ID)},
+		}
+		if performer := NewReference("Practitioner", s.ScreenedBy); performer != nil {
+			res.Performer = []Reference{*performer}
+		}
+		observations = append(observations, res)
+		return res
+	}
+	quantity := func(value *float64, unit string) *Quantity {
+		return &Quantity{Value: value, Unit: unit, System: SystemUCUM, Code: unit}
+	}
+
+	if s.BloodGlucose != nil {
+		code := Coding{System: SystemLOINC, Code: "15074-8", Display: "Glucose [Moles/volume] in Blood"}
+		if s.GlucoseTest == models.GlucoseFasting {
+			code = Coding{System: SystemLOINC, Code: "14771-0", Display: "Fasting glucose [Moles/volume] in Serum or Plasma"}
+		}
+		add("glucose", ObservationCategoryLaboratory, "Laboratory", code).ValueQuantity = quantity(s.BloodGlucose, "mmol/L")
+	}
+	if s.WaistCircumference != nil {
+		add("waist", "exam", "Exam", Coding{System: SystemLOINC, Code: "8280-0", Display: "Waist circumference"}).
+			ValueQuantity = quantity(s.WaistCircumference, "cm")
+	}
+	if coding, ok := tobaccoUseCodes[s.TobaccoUse]; ok {
+		add("tobacco", "social-history", "Social History", Coding{System: SystemLOINC, Code: "72166-2", Display: "Tobacco smoking status"}).
+			ValueCodeableConcept = &CodeableConcept{Coding: []Coding{coding}, Text: coding.Display}
+	}
+	if coding, ok := alcoholUseCodes[s.AlcoholUse]; ok {
+		add("alcohol", "social-history", "Social History", Coding{System: SystemLOINC, Code: "11331-6", Display: "History of alcohol use"}).
+			ValueCodeableConcept = &CodeableConcept{Coding: []Coding{coding}, Text: coding.Display}
+	}
+
+	// Lab tests and the CVD risk are recorded at consultation
+	consulted := func(res *Observation) *Observation {
+		if s.ConsultedAt != nil {
+			res.EffectiveDateTime = FormatDateTime(*s.ConsultedAt)
+		}
+		if s.ConsultedBy != nil {
+			res.Performer = []Reference{*NewReference("Practitioner", *s.ConsultedBy)}
+		}
+		return res
+	}
+	if s.TotalCholesterol != nil {
+		consulted(add("cholesterol", ObservationCategoryLaboratory, "Laboratory",
+			Coding{System: SystemLOINC, Code: "14647-2", Display: "Cholesterol [Moles/volume] in Serum or Plasma"})).
+			ValueQuantity = quantity(s.TotalCholesterol, "mmol/L")
+	}
+	if s.HbA1c != nil {
+		consulted(add("hba1c", ObservationCategoryLaboratory, "Laboratory",
+			Coding{System: SystemLOINC, Code: "4548-4", Display: "Hemoglobin A1c/Hemoglobin.total in Blood"})).
+			ValueQuantity = quantity(s.HbA1c, "%")
+	}
+	if s.CVDRiskCategory != "" {
+		res := consulted(add("cvd-risk", "survey", "Survey",
+			Coding{System: SystemNCDScreening, Code: "cvd-risk", Display: "WHO cardiovascular disease 10-year risk"}))
+		if s.CVDRisk != nil {
+			res.ValueQuantity = quantity(s.CVDRisk, "%")
+			res.Method = textConcept("WHO CVD risk chart, " + s.CVDRiskChart)
+		} else {
+			res.ValueCodeableConcept = &CodeableConcept{Text: "Established cardiovascular disease"}
+		}
+		res.Interpretation = []CodeableConcept{{Coding: []Coding{{System: SystemNCDScreening, Code: s.CVDRiskCategory}}, Text: s.CVDRiskCategory}}
+	}
+	return observations
+}
@@ -0,0 +1,113 @@
+package fhir
+
+import (
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// qrLinkIDs lists the link IDs of the items, depth first
+func qrLinkIDs(items []QuestionnaireResponseItem) []string {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.LinkID)
+		ids = append(ids, qrLinkIDs(item.Item)...)
+	}
+	return ids
+}
+
+func findQRItem(items []QuestionnaireResponseItem, linkID string) *QuestionnaireResponseItem {
+	for i := range items {
+		if items[i].LinkID == linkID {
+			return &items[i]
+		}
+		if found := findQRItem(items[i].Item, linkID); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestQuestionnaireResponseFromNCDScreening(t *testing.T) {
+	screened := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	s := &models.NCDScreening{
+		EncounterID: 12, PatientID: 7, Status: models.NCDScreeningInProgress,
+		Symptoms: []string{"headache", "dizziness"}, TobaccoUse: models.UseCurrent,
+		SystolicBP: intPtr(150), BloodGlucose: floatPtr(7.4), GlucoseTest: models.GlucoseFasting,
+		ScreenedAt: screened, ScreenedBy: 2,
+	}
+	s.ID = 5
+
+	// Only answered questions are included, and no part without answers
+	res := QuestionnaireResponseFromNCDScreening(s)
+	assert.Equal(t, "5", res.ID)
+	assert.Equal(t, NCDScreeningQuestionnaire, res.Questionnaire)
+	assert.Equal(t, "in-progress", res.Status)
+	assert.Equal(t, "Patient/7", res.Subject.Reference)
+	assert.Equal(t, "Encounter/12", res.Encounter.Reference)
+	assert.Equal(t, FormatDateTime(screened), res.Authored)
+	assert.Equal(t, []string{"B", "B-2", "B-6", "B-6.1", "B-6.2", "B-6.6", "B-7", "B-7.1", "B-7.7", "B-7.8"}, qrLinkIDs(res.Item))
+
+	symptoms := findQRItem(res.Item, "B-2")
+	require.Len(t, symptoms.Answer, 2)
+	assert.Equal(t, Coding{System: SystemNCDScreening, Code: "headache", Display: "Headache"}, *symptoms.Answer[0].ValueCoding)
+	systolic := findQRItem(res.Item, "B-7.1").Answer[0].ValueQuantity
+	assert.Equal(t, 150.0, *systolic.Value)
+	assert.Equal(t, "mm[Hg]", systolic.Code)
+
+	// Part C and D once consulted and enrolled
+	consulted := screened.Add(time.Hour)
+	s.Status = models.NCDScreeningCompleted
+	s.ConsultedAt = &consulted
+	s.Diagnoses = []string{"diabetes"}
+	s.CVDRisk, s.CVDRiskCategory = floatPtr(12), models.CVDRiskModerate
+	s.Outcome = models.NCDOutcomeEnrol
+	s.EnrolledPrograms = []string{models.NCDProgramDiabetes}
+	s.EnrolledAt = &consulted
+	res = QuestionnaireResponseFromNCDScreening(s)
+	assert.Equal(t, "completed", res.Status)
+	assert.Equal(t, FormatDateTime(consulted), res.Authored)
+	require.Len(t, res.Item, 3)
+	assert.Equal(t, []string{"C-4", "C-5", "C-7"}, qrLinkIDs(res.Item[1].Item))
+	assert.Len(t, findQRItem(res.Item, "C-4").Answer, 2, "risk and category")
+	assert.Equal(t, []string{"D-1", "D-3", "D-4"}, qrLinkIDs(res.Item[2].Item))
+	assert.Equal(t, "2024-05-01", findQRItem(res.Item, "D-3").Answer[0].ValueDate)
+}
+
+func TestObservationsFromNCDScreening(t *testing.T) {
+	consultedBy := uint(3)
+	s := &models.NCDScreening{
+		EncounterID: 12, PatientID: 7, ScreenedBy: 2, ConsultedBy: &consultedBy,
+		BloodGlucose: floatPtr(6.2), GlucoseTest: models.GlucoseRandom, AlcoholUse: models.UseNever,
+		TotalCholesterol: floatPtr(5.4), CVDRiskCategory: models.CVDRiskVeryHigh,
+	}
+	s.ID = 5
+
+	observations := ObservationsFromNCDScreening(s)
+	byID := map[string]*Observation{}
+	for _, o := range observations {
+		byID[o.ID] = o
+		assert.Equal(t, "QuestionnaireResponse/5", o.DerivedFrom[0].Reference)
+		id, ok := ParseNCDObservationID(o.ID)
+		require.True(t, ok, o.ID)
+		assert.Equal(t, uint(5), id)
+	}
+	require.Len(t, byID, 4)
+
+	assert.Equal(t, "15074-8", byID["ncd-5-glucose"].Code.Coding[0].Code, "random glucose")
+	assert.Equal(t, "Practitioner/2", byID["ncd-5-glucose"].Performer[0].Reference)
+	assert.Equal(t, "105542008", byID["ncd-5-alcohol"].ValueCodeableConcept.Coding[0].Code)
+	assert.Equal(t, "Practitioner/3", byID["ncd-5-cholesterol"].Performer[0].Reference)
+	risk := byID["ncd-5-cvd-risk"]
+	assert.Nil(t, risk.ValueQuantity)
+	assert.Equal(t, "Established cardiovascular disease", risk.ValueCodeableConcept.Text)
+	assert.Equal(t, models.CVDRiskVeryHigh, risk.Interpretation[0].Coding[0].Code)
+
+	for _, id := range []string{"ncd-x-glucose", "ncd-5", "vitals-5", ""} {
+		_, ok := ParseNCDObservationID(id)
+		assert.False(t, ok, id)
+	}
+}
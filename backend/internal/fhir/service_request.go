@@ -0,0 +1,131 @@
+package fhir
+
+import (
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// ServiceRequest is the FHIR R4 ServiceRequest resource, used for lab orders
+type ServiceRequest struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Status       string            `json:"status"`
+	Intent       string            `json:"intent"`
+	Category     []CodeableConcept `json:"category,omitempty"`
+	Priority     string            `json:"priority,omitempty"`
+	Code         *CodeableConcept  `json:"code,omitempty"`
+	Subject      *Reference        `json:"subject"`
+	Encounter    *Reference        `json:"encounter,omitempty"`
+	AuthoredOn   string            `json:"authoredOn,omitempty"`
+	Requester    *Reference        `json:"requester,omitempty"`
+	ReasonCode   []CodeableConcept `json:"reasonCode,omitempty"`
+	Note         []Annotation      `json:"note,omitempty"`
+}
+
+var (
+	serviceRequestStatuses = newCodeMap(
+		[2]string{"ordered", "active"},
+		[2]string{"collected", "active"},
+		[2]string{"processing", "active"},
+		[2]string{"completed", "completed"},
+		[2]string{"cancelled", "revoked"},
+	)
+	serviceRequestPriorities = newCodeMap(
+		[2]string{"routine", "routine"},
+		[2]string{"urgent", "urgent"},
+		[2]string{"stat", "stat"},
+	)
+)
+
+// laboratoryCategory is the SNOMED CT "Laboratory procedure" category
+var laboratoryCategory = CodeableConcept{
+	Coding: []Coding{{System: "http://snomed.info/sct", Code: "108252007", Display: "Laboratory procedure"}},
+}
+
+// ServiceRequestStatusCodes returns the internal lab order statuses matching a FHIR status
+func ServiceRequestStatusCodes(code string) []string {
+	return serviceRequestStatuses.InternalCodes(code)
+}
+
+// ServiceRequestFromModel maps a lab order to a FHIR ServiceRequest
+func ServiceRequestFromModel(o *models.LabOrder) *ServiceRequest {
+	res := &ServiceRequest{
+		ResourceType: "ServiceRequest",
+		ID:           fmt.Sprint(o.ID),
+		Meta:         NewMeta(o.UpdatedAt),
+		Status:       serviceRequestStatuses.ToFHIR(o.Status, "unknown"),
+		Intent:       "order",
+		Category:     []CodeableConcept{laboratoryCategory},
+		Priority:     serviceRequestPriorities.ToFHIR(o.Priority, ""),
+		Subject:      NewReference("Patient", o.PatientID),
+		Encounter:    NewReference("Encounter", o.EncounterID),
+		AuthoredOn:   FormatDateTime(o.OrderDate),
+		Requester:    NewReference("Practitioner", o.PractitionerID),
+	}
+
+	// The ordered tests are only known through the results recorded against the order
+	code := &CodeableConcept{}
+	for _, result := range o.Results {
+		if result.LabTest.Code != "" {
+			code.Coding = append(code.Coding, Coding{System: SystemLabTestCode, Code: result.LabTest.Code, Display: result.LabTest.Name})
+		}
+	}
+	if len(code.Coding) > 0 {
+		res.Code = code
+	}
+
+	if o.ClinicalInfo != "" {
+		res.ReasonCode = []CodeableConcept{{Text: o.ClinicalInfo}}
+	}
+	if o.Notes != "" {
+		res.Note = []Annotation{{Text: o.Notes}}
+	}
+	return res
+}
+
+// ServiceRequestToModel applies a FHIR ServiceRequest onto a lab order
+func ServiceRequestToModel(res *ServiceRequest, o *models.LabOrder) error {
+	if res.ResourceType != "ServiceRequest" {
+		return fmt.Errorf("expected resourceType ServiceRequest, got %q", res.ResourceType)
+	}
+	if res.Intent != "" && res.Intent != "order" {
+		return fmt.Errorf("unsupported intent %q", res.Intent)
+	}
+
+	var err error
+	if o.Status, err = serviceRequestStatuses.FromFHIR(res.Status, o.Status); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	if o.Priority, err = serviceRequestPriorities.FromFHIR(res.Priority, o.Priority); err != nil {
+		return fmt.Errorf("priority: %w", err)
+	}
+	if o.PatientID, err = ParseReference(res.Subject, "Patient"); err != nil {
+		return err
+	}
+	if o.EncounterID, err = ParseReference(res.Encounter, "Encounter"); err != nil {
+		return err
+	}
+	if o.PatientID == 0 || o.EncounterID == 0 {
+		return fmt.Errorf("subject and encounter are required")
+	}
+	if o.PractitionerID, err = ParseReference(res.Requester, "Practitioner"); err != nil {
+		return err
+	}
+	if res.AuthoredOn != "" {
+		if o.OrderDate, err = ParseDateTime(res.AuthoredOn); err != nil {
+			return fmt.Errorf("authoredOn: %w", err)
+		}
+	}
+
+	o.ClinicalInfo = ""
+	if len(res.ReasonCode) > 0 {
+		o.ClinicalInfo = res.ReasonCode[0].TextOrCode()
+	}
+	o.Notes = ""
+	if len(res.Note) > 0 {
+		o.Notes = res.Note[0].Text
+	}
+	return nil
+}
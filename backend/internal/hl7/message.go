@@ -0,0 +1,216 @@
+// Package hl7 parses HL7 v2 messages received from devices and builds their
+// acknowledgements.
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("invalid HL7 v2 message")
+
+// Message is a parsed HL7 v2 message
+type Message struct {
+	Segments []Segment
+
+	fieldSep     string
+	componentSep string
+	repeatSep    string
+	escape       string
+	subSep       string
+}
+
+// Segment is one segment of a message; Fields[0] is the segment name and, as
+// in the standard, Fields[n] is field n (for MSH, field 1 is the separator)
+type Segment struct {
+	Fields []string
+	msg    *Message
+}
+
+// Parse parses an ER7-encoded message. Segments may end with CR, LF or CRLF,
+// and MLLP framing bytes are ignored.
+func Parse(data []byte) (*Message, error) {
+	text := strings.Trim(string(data), "\x0b\x1c\r\n ")
+	if !strings.HasPrefix(text, "MSH") || len(text) < 8 {
+		return nil, fmt.Errorf("%w: must start with MSH", ErrInvalidMessage)
+	}
+	m := &Message{
+		fieldSep:     text[3:4],
+		componentSep: text[4:5],
+		repeatSep:    text[5:6],
+		escape:       text[6:7],
+		subSep:       text[7:8],
+	}
+
+	lines := strings.FieldsFunc(text, func(r rune) bool { return r == '\r' || r == '\n' })
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		fields := strings.Split(line, m.fieldSep)
+		if fields[0] == "MSH" {
+			// MSH-1 is the field separator itself
+			fields = append([]string{"MSH", m.fieldSep}, fields[1:]...)
+		}
+		m.Segments = append(m.Segments, Segment{Fields: fields, msg: m})
+	}
+	return m, nil
+}
+
+// Segment returns the first segment with a name
+func (m *Message) Segment(name string) (Segment, bool) {
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+// Type returns the message code and trigger event of MSH-9, e.g. ORU and R01
+func (m *Message) Type() (string, string) {
+	msh, _ := m.Segment("MSH")
+	return msh.Component(9, 1), msh.Component(9, 2)
+}
+
+// ControlID returns MSH-10
+func (m *Message) ControlID() string {
+	msh, _ := m.Segment("MSH")
+	return msh.Field(10)
+}
+
+func (s Segment) Name() string {
+	if len(s.Fields) == 0 {
+		return ""
+	}
+	return s.Fields[0]
+}
+
+// Field returns field n, unescaped, with only its first repetition
+func (s Segment) Field(n int) string {
+	if n >= len(s.Fields) {
+		return ""
+	}
+	if s.Name() == "MSH" && n <= 2 {
+		return s.Fields[n]
+	}
+	field, _, _ := strings.Cut(s.Fields[n], s.msg.repeatSep)
+	return s.msg.unescape(field)
+}
+
+// Component returns component c (from 1) of field n
+func (s Segment) Component(n, c int) string {
+	if n >= len(s.Fields) {
+		return ""
+	}
+	field, _, _ := strings.Cut(s.Fields[n], s.msg.repeatSep)
+	components := strings.Split(field, s.msg.componentSep)
+	if c < 1 || c > len(components) {
+		return ""
+	}
+	value, _, _ := strings.Cut(components[c-1], s.msg.subSep)
+	return s.msg.unescape(value)
+}
+
+func (m *Message) unescape(value string) string {
+	if !strings.Contains(value, m.escape) {
+		return value
+	}
+	e := m.escape
+	return strings.NewReplacer(
+		e+"F"+e, m.fieldSep, e+"S"+e, m.componentSep, e+"R"+e, m.repeatSep,
+		e+"T"+e, m.subSep, e+"E"+e, m.escape,
+	).Replace(value)
+}
+
+// ParseTime parses an HL7 TS/DTM value (YYYY[MM[DD[HH[MM[SS[.S+]]]]]][+/-ZZZZ]).
+// Values without an offset are in loc.
+func ParseTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	offset := ""
+	if i := strings.IndexAny(value, "+-"); i > 0 {
+		value, offset = value[:i], value[i:]
+	}
+	if i := strings.Index(value, "."); i >= 0 {
+		value = value[:i]
+	}
+	layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid HL7 time %q", value)
+	}
+	if offset != "" {
+		t, err := time.Parse(layout+"-0700", value+offset)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid HL7 time %q: %w", value+offset, err)
+		}
+		return t, nil
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid HL7 time %q: %w", value, err)
+	}
+	return t, nil
+}
+
+// FormatTime formats a time as an HL7 DTM with offset
+func FormatTime(t time.Time) string {
+	return t.Format("20060102150405-0700")
+}
+
+// Acknowledgement codes
+const (
+	AckAccept = "AA"
+	AckError  = "AE"
+	AckReject = "AR"
+)
+
+// Ack builds the original-mode ACK of a message, with text explaining an
+// error. The sending and receiving applications are swapped.
+func Ack(m *Message, code, text string, now time.Time) []byte {
+	fs, cs := "|", "^"
+	var msh Segment
+	if m != nil {
+		fs, cs = m.fieldSep, m.componentSep
+		msh, _ = m.Segment("MSH")
+	}
+	event, version, controlID := "", "2.6", ""
+	if msh.Fields != nil {
+		event = msh.Component(9, 2)
+		if v := msh.Field(12); v != "" {
+			version = v
+		}
+		controlID = msh.Field(10)
+	}
+	field := func(n int) string {
+		if msh.Fields == nil || n >= len(msh.Fields) {
+			return ""
+		}
+		return msh.Fields[n]
+	}
+	ackID := "ACK" + now.Format("20060102150405")
+	if controlID != "" {
+		ackID = controlID + "-ACK"
+	}
+	encoding := "^~\\&"
+	if m != nil {
+		encoding = m.componentSep + m.repeatSep + m.escape + m.subSep
+	}
+	lines := []string{
+		strings.Join([]string{"MSH", encoding, field(5), field(6), field(3), field(4), FormatTime(now), "",
+			"ACK" + cs + event + cs + "ACK", ackID, "P", version}, fs),
+		strings.Join([]string{"MSA", code, controlID, escapeText(text, m)}, fs),
+	}
+	return []byte(strings.Join(lines, "\r") + "\r")
+}
+
+func escapeText(text string, m *Message) string {
+	if m == nil {
+		return strings.NewReplacer("\\", "\\E\\", "|", "\\F\\", "^", "\\S\\", "~", "\\R\\", "&", "\\T\\").Replace(text)
+	}
+	e := m.escape
+	return strings.NewReplacer(e, e+"E"+e, m.fieldSep, e+"F"+e, m.componentSep, e+"S"+e,
+		m.repeatSep, e+"R"+e, m.subSep, e+"T"+e).Replace(text)
+}
@@ -0,0 +1,175 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oruMessage = "MSH|^~\\&|GATEWAY|WARD3|HIS|HOSPITAL|20240501101500+0600||ORU^R01^ORU_R01|MSG0001|P|2.6\r" +
+	"PID|||MRN-1^^^HOSPITAL^MR||Rahim^Abdul\r" +
+	"OBR|1|||182777000^monitoring of patient^SNOMED-CT|||20240501101000+0600\r" +
+	"OBX|1|NM|150021^MDC_PRESS_BLD_NONINV_SYS^MDC|1.0.1.1|118|266016^MDC_DIM_MMHG^MDC|||||R|||20240501101200+0600||||MON-7^DEV\r" +
+	"NTE|1||Cuff A\\T\\B \\F\\ left arm~repeat\r"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"CR", oruMessage},
+		{"LF", "\n" + strings.ReplaceAll(oruMessage, "\r", "\n")},
+		{"CRLF", strings.ReplaceAll(oruMessage, "\r", "\r\n")},
+		{"MLLP framing", "\x0b" + oruMessage + "\x1c\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse([]byte(tt.data))
+			require.NoError(t, err)
+			require.Len(t, m.Segments, 5)
+
+			code, event := m.Type()
+			assert.Equal(t, "ORU", code)
+			assert.Equal(t, "R01", event)
+			assert.Equal(t, "MSG0001", m.ControlID())
+
+			msh, ok := m.Segment("MSH")
+			require.True(t, ok)
+			assert.Equal(t, "|", msh.Field(1))
+			assert.Equal(t, "^~\\&", msh.Field(2))
+			assert.Equal(t, "GATEWAY", msh.Field(3))
+
+			pid, ok := m.Segment("PID")
+			require.True(t, ok)
+			assert.Equal(t, "MRN-1", pid.Component(3, 1))
+			assert.Equal(t, "MR", pid.Component(3, 5))
+			assert.Equal(t, "Abdul", pid.Component(5, 2))
+			assert.Equal(t, "", pid.Component(5, 3))
+			assert.Equal(t, "", pid.Field(30))
+
+			obx, ok := m.Segment("OBX")
+			require.True(t, ok)
+			assert.Equal(t, "MON-7", obx.Component(18, 1))
+			assert.Equal(t, "1.0.1.1", obx.Field(4))
+
+			nte, ok := m.Segment("NTE")
+			require.True(t, ok)
+			assert.Equal(t, "Cuff A&B | left arm", nte.Field(3), "escapes are undone and only the first repetition is kept")
+
+			_, ok = m.Segment("ZZZ")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestParseCustomSeparators(t *testing.T) {
+	m, err := Parse([]byte("MSH#$*@%#DEV#WARD#HIS#HOSP#20240501##ORU$R01#7#P#2.5\rPID###MRN-2$$$HOSP%X*other#\r"))
+	require.NoError(t, err)
+	code, event := m.Type()
+	assert.Equal(t, "ORU", code)
+	assert.Equal(t, "R01", event)
+	pid, _ := m.Segment("PID")
+	assert.Equal(t, "MRN-2", pid.Component(3, 1))
+	assert.Equal(t, "HOSP", pid.Component(3, 4), "the subcomponent is cut")
+	assert.Equal(t, "MRN-2$$$HOSP%X", pid.Field(3), "the repetition is cut")
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, data := range []string{"", "PID|||1", "MSH|^~", "\x0b\x1c"} {
+		_, err := Parse([]byte(data))
+		assert.ErrorIs(t, err, ErrInvalidMessage, "%q", data)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	dhaka := time.FixedZone("BDT", 6*3600)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, dhaka), false},
+		{"20240501", time.Date(2024, 5, 1, 0, 0, 0, 0, dhaka), false},
+		{"202405011015", time.Date(2024, 5, 1, 10, 15, 0, 0, dhaka), false},
+		{"20240501101530.1234", time.Date(2024, 5, 1, 10, 15, 30, 0, dhaka), false},
+		{"20240501101530+0000", time.Date(2024, 5, 1, 10, 15, 30, 0, time.UTC), false},
+		{"20240501101530.5-0500", time.Date(2024, 5, 1, 15, 15, 30, 0, time.UTC), false},
+		{" 2024050110 ", time.Date(2024, 5, 1, 10, 0, 0, 0, dhaka), false},
+		{"", time.Time{}, true},
+		{"2024051", time.Time{}, true},
+		{"20241301", time.Time{}, true},
+		{"20240501+06", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value, dhaka)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %v", got)
+		})
+	}
+
+	now := time.Date(2024, 5, 1, 10, 15, 30, 0, dhaka)
+	assert.Equal(t, "20240501101530+0600", FormatTime(now))
+	parsed, err := ParseTime(FormatTime(now), time.UTC)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(parsed))
+}
+
+// TestAckRoundTrip parses the acknowledgements built for a message
+func TestAckRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 16, 0, 0, time.FixedZone("BDT", 6*3600))
+	custom, err := Parse([]byte("MSH#$*@%#DEV#WARD#HIS#HOSP#20240501##ORU$R01#7#P#2.5\r"))
+	require.NoError(t, err)
+	oru, err := Parse([]byte(oruMessage))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		msg           *Message
+		code          string
+		text          string
+		wantSending   string
+		wantReceiving string
+		wantEvent     string
+		wantVersion   string
+		wantControlID string
+		wantAckID     string
+	}{
+		{"accept", oru, AckAccept, "", "HIS", "GATEWAY", "R01", "2.6", "MSG0001", "MSG0001-ACK"},
+		{"error text with delimiters", oru, AckError, "bad value |118^ & more~\\", "HIS", "GATEWAY", "R01", "2.6", "MSG0001", "MSG0001-ACK"},
+		{"custom separators", custom, AckReject, "bad # value $", "HIS", "DEV", "R01", "2.5", "7", "7-ACK"},
+		{"unparsable message", nil, AckReject, "invalid HL7 v2 message: must start with MSH", "", "", "", "2.6", "", "ACK20240501101600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := Parse(Ack(tt.msg, tt.code, tt.text, now))
+			require.NoError(t, err)
+			require.Len(t, ack.Segments, 2)
+
+			code, event := ack.Type()
+			assert.Equal(t, "ACK", code)
+			assert.Equal(t, tt.wantEvent, event)
+			assert.Equal(t, tt.wantAckID, ack.ControlID())
+
+			msh, _ := ack.Segment("MSH")
+			assert.Equal(t, tt.wantSending, msh.Field(3))
+			assert.Equal(t, tt.wantReceiving, msh.Field(5))
+			assert.Equal(t, FormatTime(now), msh.Field(7))
+			assert.Equal(t, tt.wantVersion, msh.Field(12))
+
+			msa, ok := ack.Segment("MSA")
+			require.True(t, ok)
+			assert.Equal(t, tt.code, msa.Field(1))
+			assert.Equal(t, tt.wantControlID, msa.Field(2))
+			assert.Equal(t, tt.text, msa.Field(3))
+		})
+	}
+}
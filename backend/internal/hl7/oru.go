@@ -0,0 +1,168 @@
+package hl7
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// vitalCode maps an observation identifier, as an IEEE 11073-10101 (MDC)
+// code, MDC reference identifier or LOINC code, onto a field of a reading.
+// Heart rate from the ECG takes precedence over pulse rates from oximetry
+// or NIBP.
+type vitalCode struct {
+	field    string
+	codes    []string
+	priority int
+	set      func(r *models.DeviceReading, value float64, unit string)
+}
+
+func rounded(value float64) *int {
+	i := int(math.Round(value))
+	return &i
+}
+
+var vitalCodes = []vitalCode{
+	{models.VitalSystolicBP, []string{"150021", "MDC_PRESS_BLD_NONINV_SYS", "8480-6"}, 1,
+		func(r *models.DeviceReading, v float64, _ string) { r.SystolicBP = rounded(v) }},
+	{models.VitalDiastolicBP, []string{"150022", "MDC_PRESS_BLD_NONINV_DIA", "8462-4"}, 1,
+		func(r *models.DeviceReading, v float64, _ string) { r.DiastolicBP = rounded(v) }},
+	{models.VitalPulseRate, []string{"147842", "MDC_ECG_HEART_RATE", "8867-4"}, 2,
+		func(r *models.DeviceReading, v float64, _ string) { r.PulseRate = rounded(v) }},
+	{models.VitalPulseRate, []string{"149530", "MDC_PULS_OXIM_PULS_RATE", "149546", "MDC_PULS_RATE_NON_INV"}, 1,
+		func(r *models.DeviceReading, v float64, _ string) { r.PulseRate = rounded(v) }},
+	{models.VitalRespiratoryRate, []string{"151562", "MDC_RESP_RATE", "9279-1"}, 1,
+		func(r *models.DeviceReading, v float64, _ string) { r.RespiratoryRate = rounded(v) }},
+	{models.VitalSpO2, []string{"150456", "MDC_PULS_OXIM_SAT_O2", "59408-5", "2708-6"}, 1,
+		func(r *models.DeviceReading, v float64, _ string) { r.SpO2 = rounded(v) }},
+	{models.VitalTemperature, []string{"150344", "MDC_TEMP", "150364", "MDC_TEMP_BODY", "8310-5"}, 1,
+		func(r *models.DeviceReading, v float64, u string) {
+			if isUnit(u, "266560", "MDC_DIM_FAHR", "[degF]", "degF", "F") {
+				v = (v - 32) * 5 / 9
+			}
+			v = math.Round(v*10) / 10
+			r.Temperature = &v
+		}},
+	{"weight", []string{"188736", "MDC_MASS_BODY_ACTUAL", "29463-7"}, 1,
+		func(r *models.DeviceReading, v float64, u string) {
+			if isUnit(u, "263904", "MDC_DIM_LB", "[lb_av]", "lb") {
+				v *= 0.45359237
+			}
+			v = math.Round(v*100) / 100
+			r.Weight = &v
+		}},
+	{"height", []string{"188740", "MDC_LEN_BODY_ACTUAL", "8302-2"}, 1,
+		func(r *models.DeviceReading, v float64, u string) {
+			if isUnit(u, "262688", "MDC_DIM_INCH", "[in_i]", "in") {
+				v *= 2.54
+			}
+			v = math.Round(v*10) / 10
+			r.Height = &v
+		}},
+}
+
+func isUnit(unit string, names ...string) bool {
+	for _, name := range names {
+		if strings.EqualFold(unit, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func findVitalCode(identifier, text string) (vitalCode, bool) {
+	for _, vc := range vitalCodes {
+		for _, code := range vc.codes {
+			if code == identifier || code == text {
+				return vc, true
+			}
+		}
+	}
+	return vitalCode{}, false
+}
+
+// ORU is the vital signs content of an ORU^R01 observation message, as sent
+// by IHE PCD-01 device gateways and bedside monitors
+type ORU struct {
+	Reading models.DeviceReading
+	// EquipmentID is the device identifier of OBX-18, if given
+	EquipmentID string
+	// Ignored lists observation identifiers that are not vital signs
+	Ignored []string
+}
+
+// ParseORU reads the numeric vital sign observations of an ORU^R01 message.
+// The reading is timed by the latest OBX-14, or else OBR-7. Observations
+// marked wrong or deleted (OBX-11 W, D or X) are skipped.
+func ParseORU(m *Message, loc *time.Location) (*ORU, error) {
+	if code, event := m.Type(); code != "ORU" || event != "R01" {
+		return nil, fmt.Errorf("%w: expected ORU^R01, got %s^%s", ErrInvalidMessage, code, event)
+	}
+
+	oru := &ORU{}
+	priorities := map[string]int{}
+	var measured *time.Time
+	setTime := func(value string) error {
+		if value == "" {
+			return nil
+		}
+		t, err := ParseTime(value, loc)
+		if err != nil {
+			return err
+		}
+		if measured == nil || t.After(*measured) {
+			measured = &t
+		}
+		return nil
+	}
+
+	var obrTime string
+	for _, s := range m.Segments {
+		switch s.Name() {
+		case "OBR":
+			if obrTime == "" {
+				obrTime = s.Field(7)
+			}
+		case "OBX":
+			if status := s.Field(11); status == "W" || status == "D" || status == "X" {
+				continue
+			}
+			identifier, text := s.Component(3, 1), s.Component(3, 2)
+			vc, ok := findVitalCode(identifier, text)
+			if !ok || (s.Field(2) != "" && s.Field(2) != "NM") {
+				oru.Ignored = append(oru.Ignored, identifier)
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(s.Field(5)), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: OBX %s value %q is not a number", ErrInvalidMessage, identifier, s.Field(5))
+			}
+			if vc.priority >= priorities[vc.field] {
+				// OBX-6 is code^text, e.g. 266560^MDC_DIM_FAHR or [degF]
+				unit := s.Component(6, 1)
+				if text := s.Component(6, 2); strings.HasPrefix(text, "MDC_") {
+					unit = text
+				}
+				vc.set(&oru.Reading, value, unit)
+				priorities[vc.field] = vc.priority
+			}
+			if err := setTime(s.Field(14)); err != nil {
+				return nil, fmt.Errorf("%w: OBX-14: %v", ErrInvalidMessage, err)
+			}
+			if equipment := s.Component(18, 1); equipment != "" && oru.EquipmentID == "" {
+				oru.EquipmentID = equipment
+			}
+		}
+	}
+	if measured == nil {
+		if err := setTime(obrTime); err != nil {
+			return nil, fmt.Errorf("%w: OBR-7: %v", ErrInvalidMessage, err)
+		}
+	}
+	oru.Reading.MeasuredAt = measured
+	return oru, nil
+}
@@ -0,0 +1,117 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(i int) *int { return &i }
+
+func floatPtr(f float64) *float64 { return &f }
+
+func oru(segments ...string) []byte {
+	header := "MSH|^~\\&|GATEWAY|WARD3|HIS|HOSPITAL|20240501101500+0600||ORU^R01^ORU_R01|MSG0001|P|2.6"
+	return []byte(strings.Join(append([]string{header}, segments...), "\r"))
+}
+
+func TestParseORU(t *testing.T) {
+	dhaka := time.FixedZone("BDT", 6*3600)
+	at := func(hour, min int) *time.Time {
+		t := time.Date(2024, 5, 1, hour, min, 0, 0, dhaka)
+		return &t
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		want          models.DeviceReading
+		wantEquipment string
+		wantIgnored   []string
+	}{
+		{"PCD-01 monitor", oru(
+			"OBR|1|||182777000^monitoring of patient^SNOMED-CT|||20240501100000+0600",
+			"OBX|1|NM|150021^MDC_PRESS_BLD_NONINV_SYS^MDC|1.0.1.1|118.4|266016^MDC_DIM_MMHG^MDC|||||R|||20240501101000+0600||||MON-7^DEV",
+			"OBX|2|NM|150022^MDC_PRESS_BLD_NONINV_DIA^MDC|1.0.1.2|76|266016^MDC_DIM_MMHG^MDC|||||R|||20240501101000+0600",
+			"OBX|3|NM|149530^MDC_PULS_OXIM_PULS_RATE^MDC|1.0.2.1|75|264864^MDC_DIM_BEAT_PER_MIN^MDC|||||R|||20240501101200+0600",
+			"OBX|4|NM|147842^MDC_ECG_HEART_RATE^MDC|1.0.3.1|72|264864^MDC_DIM_BEAT_PER_MIN^MDC|||||R|||20240501101100+0600",
+			"OBX|5|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC|1.0.2.2|96.6|262688^MDC_DIM_PERCENT^MDC|||||R",
+			"OBX|6|NM|151562^MDC_RESP_RATE^MDC|1.0.3.2|18|264928^MDC_DIM_RESP_PER_MIN^MDC|||||R",
+			"OBX|7|NM|150364^MDC_TEMP_BODY^MDC|1.0.4.1|37.26|268192^MDC_DIM_DEGC^MDC|||||R",
+		), models.DeviceReading{
+			MeasuredAt: at(10, 12), SystolicBP: intPtr(118), DiastolicBP: intPtr(76), PulseRate: intPtr(72),
+			RespiratoryRate: intPtr(18), SpO2: intPtr(97), Temperature: floatPtr(37.3),
+		}, "MON-7", nil},
+		{"ECG heart rate sent first still wins", oru(
+			"OBX|1|NM|147842^MDC_ECG_HEART_RATE^MDC||72",
+			"OBX|2|NM|149530^MDC_PULS_OXIM_PULS_RATE^MDC||75",
+		), models.DeviceReading{PulseRate: intPtr(72)}, "", nil},
+		{"LOINC codes and imperial units", oru(
+			"OBX|1|NM|8310-5^Body temperature^LN||99.5|[degF]^degF^UCUM",
+			"OBX|2|NM|29463-7^Body weight^LN||22|[lb_av]^lb^UCUM",
+			"OBX|3|NM|8302-2^Body height^LN||40|[in_i]^in^UCUM",
+			"OBX|4|NM|8867-4^Heart rate^LN||88",
+		), models.DeviceReading{Temperature: floatPtr(37.5), Weight: floatPtr(9.98), Height: floatPtr(101.6), PulseRate: intPtr(88)}, "", nil},
+		{"MDC reference identifier alone and MDC unit text", oru(
+			"OBX|1||^MDC_TEMP||101.3|266560^MDC_DIM_FAHR",
+		), models.DeviceReading{Temperature: floatPtr(38.5)}, "", nil},
+		{"reading timed by OBR-7 without OBX-14", oru(
+			"OBR|1||||||202405010930",
+			"OBX|1|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||98",
+		), models.DeviceReading{MeasuredAt: at(9, 30), SpO2: intPtr(98)}, "", nil},
+		{"wrong and deleted observations are skipped", oru(
+			"OBX|1|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||97||||||F",
+			"OBX|2|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||60||||||W",
+			"OBX|3|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||61||||||D",
+			"OBX|4|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||62||||||X",
+		), models.DeviceReading{SpO2: intPtr(97)}, "", nil},
+		{"other observations are ignored", oru(
+			"OBX|1|NM|150033^MDC_PRESS_BLD_NONINV_MEAN^MDC||90",
+			"OBX|2|ST|150021^MDC_PRESS_BLD_NONINV_SYS^MDC||high",
+			"OBX|3|NM|151562^MDC_RESP_RATE^MDC||16",
+		), models.DeviceReading{RespiratoryRate: intPtr(16)}, "", []string{"150033", "150021"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.data)
+			require.NoError(t, err)
+			got, err := ParseORU(m, dhaka)
+			require.NoError(t, err)
+
+			if tt.want.MeasuredAt == nil {
+				assert.Nil(t, got.Reading.MeasuredAt)
+			} else {
+				require.NotNil(t, got.Reading.MeasuredAt)
+				assert.True(t, tt.want.MeasuredAt.Equal(*got.Reading.MeasuredAt), "measured at %v", got.Reading.MeasuredAt)
+			}
+			tt.want.MeasuredAt, got.Reading.MeasuredAt = nil, nil
+			assert.Equal(t, tt.want, got.Reading)
+			assert.Equal(t, tt.wantEquipment, got.EquipmentID)
+			assert.Equal(t, tt.wantIgnored, got.Ignored)
+		})
+	}
+}
+
+func TestParseORURejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not an observation result", []byte("MSH|^~\\&|GATEWAY|WARD3|HIS|HOSPITAL|20240501101500||ADT^A01|1|P|2.6\rPID|||1")},
+		{"value is not a number", oru("OBX|1|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||ninety")},
+		{"malformed OBX-14", oru("OBX|1|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||97||||||R|||yesterday")},
+		{"malformed OBR-7", oru("OBR|1||||||2024-05-01", "OBX|1|NM|150456^MDC_PULS_OXIM_SAT_O2^MDC||97")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.data)
+			require.NoError(t, err)
+			_, err = ParseORU(m, time.UTC)
+			assert.ErrorIs(t, err, ErrInvalidMessage)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The worked example of ISO/IEC 18004 Annex I: "01234567" as version 1-M
+func TestReedSolomonRemainder(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(len(want))))
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantVersion int
+	}{
+		{"empty", nil, 1},
+		{"fits version 1", []byte("ZH-CXB-2400001"), 1},
+		{"one byte over version 1", []byte("ZH-CXB-24000012"), 2},
+		{"patient card", []byte(`{"v":1,"mrn":"CXB-24-0000422","name":"Mohammad Hossain","dob":"1990-04-01","exp":1767225600}.c2lnbmF0dXJlLW9mLXRoZS1jYXJk`), 7},
+		{"binary", all[:100], 6},
+		{"largest", bytes.Repeat([]byte{'x'}, 213), 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion*4+17, code.Size)
+
+			got, err := decode(code)
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.data), string(got))
+		})
+	}
+
+	_, err := Encode(bytes.Repeat([]byte{'x'}, 214))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestImage(t *testing.T) {
+	code, err := Encode([]byte("ZH"))
+	require.NoError(t, err)
+
+	img := code.Image(4, 2)
+	assert.Equal(t, (code.Size+4)*4, img.Bounds().Dx())
+	assert.Equal(t, uint8(0xFF), img.GrayAt(0, 0).Y, "quiet zone is light")
+	// The top left module is the corner of a finder pattern
+	assert.Equal(t, uint8(0), img.GrayAt(2*4, 2*4).Y)
+	assert.Equal(t, uint8(0), img.GrayAt(2*4+3, 2*4+3).Y)
+}
+
+// decode reads a code back the way a scanner would, checking the format
+// information and the error correction of every block
+func decode(c *Code) ([]byte, error) {
+	version := (c.Size - 17) / 4
+	function := newCode(version).function
+
+	// Both copies of the format information must agree
+	var first, second int
+	firstAt := [][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+	for i, at := range firstAt {
+		if c.Black(at[0], at[1]) {
+			first |= 1 << uint(i)
+		}
+		x, y := 8, c.Size-15+i
+		if i < 8 {
+			x, y = c.Size-1-i, 8
+		}
+		if c.Black(x, y) {
+			second |= 1 << uint(i)
+		}
+	}
+	if first != second {
+		return nil, fmt.Errorf("format copies differ: %015b and %015b", first, second)
+	}
+	format := first ^ 0x5412
+	rem := format >> 10
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	if rem != format&0x3FF {
+		return nil, fmt.Errorf("format %015b fails its BCH check", first)
+	}
+	if level := format >> 13; level != formatBitsM {
+		return nil, fmt.Errorf("error correction level %d, want M", level)
+	}
+	mask := (format >> 10) & 7
+
+	// Unmask and read the data region in the zigzag order, upward first
+	var bits []bool
+	upward := true
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for k := 0; k < c.Size; k++ {
+			y := k
+			if upward {
+				y = c.Size - 1 - k
+			}
+			for _, x := range []int{right, right - 1} {
+				if !function[y][x] {
+					bits = append(bits, c.Black(x, y) != masked(mask, y, x))
+				}
+			}
+		}
+		upward = !upward
+	}
+	raw := make([]byte, totalCodewords[version])
+	for i := range raw {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				raw[i] |= 1 << uint(7-j)
+			}
+		}
+	}
+
+	// De-interleave the blocks; the last blocks hold one more data codeword
+	blocks, ecc := numBlocks[version], eccPerBlock[version]
+	short := totalCodewords[version]/blocks - ecc
+	dataLen := make([]int, blocks)
+	for i := range dataLen {
+		dataLen[i] = short
+		if i >= blocks-totalCodewords[version]%blocks {
+			dataLen[i]++
+		}
+	}
+	data := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= short; i++ {
+		for j := range data {
+			if i < dataLen[j] {
+				data[j] = append(data[j], raw[k])
+				k++
+			}
+		}
+	}
+	var codewords []byte
+	for j := range data {
+		block := append([]byte{}, data[j]...)
+		for i := 0; i < ecc; i++ {
+			block = append(block, raw[k+i*blocks+j])
+		}
+		// A valid block is divisible by the generator, whose roots are a^0..a^(ecc-1)
+		root := byte(1)
+		for i := 0; i < ecc; i++ {
+			var v byte
+			for _, b := range block {
+				v = gfMultiply(v, root) ^ b
+			}
+			if v != 0 {
+				return nil, fmt.Errorf("block %d fails its error correction check", j)
+			}
+			root = gfMultiply(root, 0x02)
+		}
+		codewords = append(codewords, data[j]...)
+	}
+
+	// A single byte mode segment
+	read := func(offset, n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v <<= 1
+			if codewords[(offset+i)/8]&(1<<uint(7-(offset+i)%8)) != 0 {
+				v |= 1
+			}
+		}
+		return v
+	}
+	if mode := read(0, 4); mode != 0x4 {
+		return nil, fmt.Errorf("mode %04b, want byte mode", mode)
+	}
+	n := read(4, countBits(version))
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(read(4+countBits(version)+8*i, 8))
+	}
+	return out, nil
+}
+
+// masked reports whether the mask inverts the module at row i, column j, as
+// the masks are written in the standard
+func masked(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -14,14 +16,12 @@ func NewADTRepository(db *gorm.DB) *ADTRepository {
 }
 
 // Ward Operations
-func (r *ADTRepository) CreateWard(ward *models.Ward) error {
-	return r.db.Create(ward).Error
+func (r *ADTRepository) CreateWard(ctx context.Context, ward *models.Ward) error {
+	return r.db.WithContext(ctx).Create(ward).Error
 }
 
-func (r *ADTRepository) ListWards() ([]models.Ward, error) {
-	var wards []models.Ward
-	err := r.db.Preload("Rooms.Beds").Find(&wards).Error
-	return wards, err
+func (r *ADTRepository) ListWards(q ListQuery) (*Page[models.Ward], error) {
+	return Paginate[models.Ward](r.db, ListSpec{Sort: "name", Preloads: []string{"Rooms.Beds"}}, q)
 }
 
 func (r *ADTRepository) GetWard(id uint) (*models.Ward, error) {
@@ -31,32 +31,32 @@ func (r *ADTRepository) GetWard(id uint) (*models.Ward, error) {
 }
 
 // Room Operations
-func (r *ADTRepository) CreateRoom(room *models.Room) error {
-	return r.db.Create(room).Error
+func (r *ADTRepository) CreateRoom(ctx context.Context, room *models.Room) error {
+	return r.db.WithContext(ctx).Create(room).Error
 }
 
 // Bed Operations
-func (r *ADTRepository) CreateBed(bed *models.Bed) error {
-	return r.db.Create(bed).Error
+func (r *ADTRepository) CreateBed(ctx context.Context, bed *models.Bed) error {
+	return r.db.WithContext(ctx).Create(bed).Error
 }
 
-func (r *ADTRepository) UpdateBedStatus(id uint, status string) error {
-	return r.db.Model(&models.Bed{}).Where("id = ?", id).Update("status", status).Error
+func (r *ADTRepository) UpdateBedStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&models.Bed{}).Where("id = ?", id).Update("status", status).Error
 }
 
-func (r *ADTRepository) ListBeds(status string) ([]models.Bed, error) {
-	var beds []models.Bed
-	query := r.db.Model(&models.Bed{})
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-	err := query.Find(&beds).Error
-	return beds, err
+func (r *ADTRepository) ListBeds(q ListQuery) (*Page[models.Bed], error) {
+	return Paginate[models.Bed](r.db, ListSpec{Sort: "bed_number"}, q)
+}
+
+func (r *ADTRepository) IsBedAvailable(id uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Bed{}).Where("id = ? AND status = ?", id, "Available").Count(&count).Error
+	return count > 0, err
 }
 
 // Admission Operations
-func (r *ADTRepository) CreateAdmission(admission *models.Admission) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *ADTRepository) CreateAdmission(ctx context.Context, admission *models.Admission) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create admission record
 		if err := tx.Create(admission).Error; err != nil {
 			return err
@@ -69,8 +69,8 @@ func (r *ADTRepository) CreateAdmission(admission *models.Admission) error {
 	})
 }
 
-func (r *ADTRepository) DischargePatient(admissionID uint) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *ADTRepository) DischargePatient(ctx context.Context, admissionID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var admission models.Admission
 		if err := tx.First(&admission, admissionID).Error; err != nil {
 			return err
@@ -94,14 +94,12 @@ func (r *ADTRepository) DischargePatient(admissionID uint) error {
 	})
 }
 
-func (r *ADTRepository) ListAdmissions(status string) ([]models.Admission, error) {
-	var admissions []models.Admission
-	query := r.db.Preload("Patient").Preload("Bed")
+func (r *ADTRepository) ListAdmissions(status string, q ListQuery) (*Page[models.Admission], error) {
+	query := r.db
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
-	err := query.Find(&admissions).Error
-	return admissions, err
+	return Paginate[models.Admission](query, ListSpec{Sort: "-admission_date", Preloads: []string{"Patient", "Bed"}}, q)
 }
 
 func (r *ADTRepository) GetAdmission(id uint) (*models.Admission, error) {
@@ -111,8 +109,8 @@ func (r *ADTRepository) GetAdmission(id uint) (*models.Admission, error) {
 }
 
 // Transfer Operations
-func (r *ADTRepository) CreateTransfer(transfer *models.Transfer) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *ADTRepository) CreateTransfer(ctx context.Context, transfer *models.Transfer) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create transfer record
 		if err := tx.Create(transfer).Error; err != nil {
 			return err
@@ -140,19 +138,16 @@ func (r *ADTRepository) CreateTransfer(transfer *models.Transfer) error {
 	})
 }
 
-func (r *ADTRepository) ListTransfers(admissionID uint) ([]models.Transfer, error) {
-	var transfers []models.Transfer
-	query := r.db.Preload("FromWard").Preload("FromBed").Preload("ToWard").Preload("ToBed")
-	if admissionID > 0 {
-		query = query.Where("admission_id = ?", admissionID)
-	}
-	err := query.Find(&transfers).Error
-	return transfers, err
+func (r *ADTRepository) ListTransfers(q ListQuery) (*Page[models.Transfer], error) {
+	return Paginate[models.Transfer](r.db, ListSpec{
+		Sort:     "-transfer_date",
+		Preloads: []string{"FromWard", "FromBed", "ToWard", "ToBed"},
+	}, q)
 }
 
 // Discharge Summary Operations
-func (r *ADTRepository) CreateDischargeSummary(summary *models.DischargeSummary) error {
-	return r.db.Create(summary).Error
+func (r *ADTRepository) CreateDischargeSummary(ctx context.Context, summary *models.DischargeSummary) error {
+	return r.db.WithContext(ctx).Create(summary).Error
 }
 
 func (r *ADTRepository) GetDischargeSummary(admissionID uint) (*models.DischargeSummary, error) {
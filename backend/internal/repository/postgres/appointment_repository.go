@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -16,8 +17,8 @@ func NewAppointmentRepository(db *gorm.DB) *AppointmentRepository {
 	return &AppointmentRepository{db: db}
 }
 
-func (r *AppointmentRepository) Create(appointment *models.Appointment) (*models.Appointment, error) {
-	if err := r.db.Create(appointment).Error; err != nil {
+func (r *AppointmentRepository) Create(ctx context.Context, appointment *models.Appointment) (*models.Appointment, error) {
+	if err := r.db.WithContext(ctx).Create(appointment).Error; err != nil {
 		return nil, err
 	}
 	return appointment, nil
@@ -34,24 +35,32 @@ func (r *AppointmentRepository) FindByID(id uint) (*models.Appointment, error) {
 	return &appointment, nil
 }
 
-func (r *AppointmentRepository) Update(appointment *models.Appointment) (*models.Appointment, error) {
-	if err := r.db.Save(appointment).Error; err != nil {
+func (r *AppointmentRepository) Update(ctx context.Context, appointment *models.Appointment) (*models.Appointment, error) {
+	if err := r.db.WithContext(ctx).Save(appointment).Error; err != nil {
 		return nil, err
 	}
 	return appointment, nil
 }
 
-func (r *AppointmentRepository) ListByDateRange(start, end time.Time) ([]*models.Appointment, error) {
-	var appointments []*models.Appointment
-	if err := r.db.Preload("Patient").Where("scheduled_start BETWEEN ? AND ?", start, end).Order("scheduled_start ASC").Find(&appointments).Error; err != nil {
-		return nil, err
-	}
-	return appointments, nil
+func (r *AppointmentRepository) ListByDateRange(start, end time.Time, q ListQuery) (*Page[models.Appointment], error) {
+	query := r.db.Where("scheduled_start BETWEEN ? AND ?", start, end)
+	return Paginate[models.Appointment](query, ListSpec{Sort: "scheduled_start", Preloads: []string{"Patient"}}, q)
+}
+
+func (r *AppointmentRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.Appointment], error) {
+	return Paginate[models.Appointment](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-scheduled_start"}, q)
 }
 
-func (r *AppointmentRepository) ListByPatient(patientID uint) ([]*models.Appointment, error) {
+// ListDueReminders returns the upcoming appointments starting within [start,
+// end) whose reminder has not been sent, for patients who consented to SMS
+// reminders
+func (r *AppointmentRepository) ListDueReminders(start, end time.Time) ([]*models.Appointment, error) {
 	var appointments []*models.Appointment
-	if err := r.db.Where("patient_id = ?", patientID).Order("scheduled_start DESC").Find(&appointments).Error; err != nil {
+	query := r.db.Preload("Patient").
+		Where("status IN ? AND reminder_sent = ?", []string{"scheduled", "confirmed"}, false).
+		Where("scheduled_start >= ? AND scheduled_start < ?", start, end)
+	if err := whereConsented(query, "appointments.patient_id", models.ConsentScopeSMSReminders, time.Now()).
+		Order("scheduled_start ASC").Find(&appointments).Error; err != nil {
 		return nil, err
 	}
 	return appointments, nil
@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statement settings used by the audit callbacks
+const (
+	// auditBeforeKey holds the rows an update or delete is about to change
+	auditBeforeKey = "audit:before"
+	// auditSkipKey marks a write that is not audited, see skipAudit
+	auditSkipKey = "audit:skip"
+)
+
+// auditCallbacks records an audit event for every row a create, update or
+// delete changes
+type auditCallbacks struct {
+	// models maps each migrated table to its model, so that writes made with
+	// Table() are recorded like writes made with Model()
+	models map[string]reflect.Type
+	// ignored tables: the audit trail itself, login tokens and counters
+	ignored map[string]bool
+}
+
+// RegisterAuditCallbacks audits every create, update and delete made through
+// db. Each event is appended in the transaction of the write it records, so a
+// write whose event cannot be stored is rolled back. The actor is taken from
+// the statement's context (see models.WithAuditActor); writes made without
+// one, such as startup backfills, are recorded without an actor.
+func RegisterAuditCallbacks(db *gorm.DB) error {
+	a := &auditCallbacks{models: map[string]reflect.Type{}, ignored: map[string]bool{}}
+	for _, model := range models.All() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		a.models[stmt.Schema.Table] = stmt.Schema.ModelType
+		switch model.(type) {
+		case *models.AuditEvent, *models.RefreshToken, *models.MRNCounter, *models.QueueCounter:
+			a.ignored[stmt.Schema.Table] = true
+		}
+	}
+
+	const commit = "gorm:commit_or_rollback_transaction"
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before(commit).Register("audit:after_create", a.afterCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("audit:before_update", a.loadBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before(commit).Register("audit:after_update", a.afterUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", a.loadBefore); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before(commit).Register("audit:after_delete", a.afterDelete)
+}
+
+// skipAudit marks writes made with the returned db as not audited. It is for
+// bookkeeping that carries no patient data, such as a device's last-seen time.
+func skipAudit(db *gorm.DB) *gorm.DB {
+	return db.Set(auditSkipKey, true)
+}
+
+// auditRecord is a changed row and its primary key
+type auditRecord struct {
+	id    uint
+	value interface{}
+}
+
+func (a *auditCallbacks) audited(db *gorm.DB) bool {
+	if db.Error != nil || db.DryRun || db.Statement.Table == "" || a.ignored[db.Statement.Table] {
+		return false
+	}
+	skip, ok := db.Get(auditSkipKey)
+	return !ok || skip != true
+}
+
+// loadBefore locks and loads the rows an update or delete is about to change
+func (a *auditCallbacks) loadBefore(db *gorm.DB) {
+	if !a.audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+	query := db.Session(&gorm.Session{NewDB: true}).Clauses(clause.Locking{Strength: "UPDATE"})
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+	conditions := 0
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		query = query.Clauses(where)
+		conditions++
+	}
+	if ids := primaryKeys(stmt); len(ids) > 0 {
+		query = query.Where(clause.IN{Column: clause.PrimaryColumn, Values: ids})
+		conditions++
+	}
+	// GORM refuses updates and deletes without conditions
+	if conditions == 0 {
+		return
+	}
+
+	before, err := a.find(query, stmt.Table)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: loading %s before change: %w", stmt.Table, err))
+		return
+	}
+	db.InstanceSet(auditBeforeKey, before)
+}
+
+func (a *auditCallbacks) afterCreate(db *gorm.DB) {
+	if !a.audited(db) {
+		return
+	}
+	ids := primaryKeys(db.Statement)
+	if len(ids) == 0 {
+		return
+	}
+	created, err := a.reload(db, ids)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: loading created %s: %w", db.Statement.Table, err))
+		return
+	}
+	for _, record := range created {
+		a.record(db, models.AuditActionCreate, record.id, nil, record.value)
+	}
+}
+
+func (a *auditCallbacks) afterUpdate(db *gorm.DB) {
+	before := a.before(db)
+	if len(before) == 0 {
+		return
+	}
+	ids := make([]interface{}, len(before))
+	for i, record := range before {
+		ids[i] = record.id
+	}
+	updated, err := a.reload(db, ids)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: loading updated %s: %w", db.Statement.Table, err))
+		return
+	}
+	after := map[uint]interface{}{}
+	for _, record := range updated {
+		after[record.id] = record.value
+	}
+	for _, record := range before {
+		a.record(db, models.AuditActionUpdate, record.id, record.value, after[record.id])
+	}
+}
+
+func (a *auditCallbacks) afterDelete(db *gorm.DB) {
+	for _, record := range a.before(db) {
+		a.record(db, models.AuditActionDelete, record.id, record.value, nil)
+	}
+}
+
+// before returns the rows loaded by loadBefore, nil if the write failed
+func (a *auditCallbacks) before(db *gorm.DB) []auditRecord {
+	if !a.audited(db) {
+		return nil
+	}
+	before, _ := db.InstanceGet(auditBeforeKey)
+	records, _ := before.([]auditRecord)
+	return records
+}
+
+// record appends the event of one changed row, failing the write if it cannot
+func (a *auditCallbacks) record(db *gorm.DB, action string, id uint, before, after interface{}) {
+	if db.Error != nil {
+		return
+	}
+	tx := a.session(db)
+	state := after
+	if state == nil {
+		state = before
+	}
+	patientID, err := auditPatientID(tx, state)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: finding the patient of %s/%d: %w", db.Statement.Table, id, err))
+		return
+	}
+
+	event, err := models.NewAuditEvent(models.AuditActorFrom(db.Statement.Context), action, a.resourceType(db.Statement.Table), id, patientID, before, after)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	// Saving a row unchanged is not a change
+	if action == models.AuditActionUpdate && event.Diff == "" {
+		return
+	}
+	if err := appendAuditEvent(tx, event); err != nil {
+		db.AddError(fmt.Errorf("audit: recording %s %s/%d: %w", action, event.ResourceType, id, err))
+	}
+}
+
+// session starts queries on the write's connection, inside its transaction.
+// Rows are found whether or not they are soft-deleted.
+func (a *auditCallbacks) session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Unscoped()
+}
+
+// reload loads rows of the statement's table by ID
+func (a *auditCallbacks) reload(db *gorm.DB, ids []interface{}) ([]auditRecord, error) {
+	id := clause.Column{Table: clause.CurrentTable, Name: "id"}
+	return a.find(a.session(db).Where(clause.IN{Column: id, Values: ids}), db.Statement.Table)
+}
+
+// find loads the rows of table matching query as models, or as column maps
+// for tables without a model
+func (a *auditCallbacks) find(query *gorm.DB, table string) ([]auditRecord, error) {
+	modelType, ok := a.models[table]
+	if !ok {
+		var rows []map[string]interface{}
+		if err := query.Table(table).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		records := make([]auditRecord, len(rows))
+		for i, row := range rows {
+			records[i] = auditRecord{id: auditUint(reflect.ValueOf(row["id"])), value: row}
+		}
+		return records, nil
+	}
+
+	rows := reflect.New(reflect.SliceOf(reflect.PointerTo(modelType)))
+	if err := query.Table(table).Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	records := make([]auditRecord, rows.Elem().Len())
+	for i := range records {
+		row := rows.Elem().Index(i)
+		records[i] = auditRecord{id: auditUint(row.Elem().FieldByName("ID")), value: row.Interface()}
+	}
+	return records, nil
+}
+
+// resourceType names a table's rows after their model
+func (a *auditCallbacks) resourceType(table string) string {
+	if modelType, ok := a.models[table]; ok {
+		return modelType.Name()
+	}
+	return table
+}
+
+// primaryKeys returns the non-zero primary keys of the statement's model value
+func primaryKeys(stmt *gorm.Statement) []interface{} {
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	var ids []interface{}
+	add := func(rv reflect.Value) {
+		if rv.Kind() != reflect.Struct {
+			return
+		}
+		if id, zero := field.ValueOf(stmt.Context, rv); !zero {
+			ids = append(ids, id)
+		}
+	}
+
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Struct:
+		add(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			add(reflect.Indirect(rv.Index(i)))
+		}
+	}
+	return ids
+}
+
+// auditPatientID returns the patient a row belongs to: the patient itself, its
+// patient_id, or the patient of its parent record (models.AuditParent)
+func auditPatientID(tx *gorm.DB, record interface{}) (uint, error) {
+	for record != nil {
+		switch r := record.(type) {
+		case *models.Patient:
+			return r.ID, nil
+		case map[string]interface{}:
+			return auditUint(reflect.ValueOf(r["patient_id"])), nil
+		}
+
+		if field := reflect.Indirect(reflect.ValueOf(record)).FieldByName("PatientID"); field.IsValid() {
+			return auditUint(field), nil
+		}
+		child, ok := record.(models.AuditParent)
+		if !ok {
+			return 0, nil
+		}
+		parent, id := child.AuditParent()
+		if id == 0 {
+			return 0, nil
+		}
+		if err := tx.First(parent, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		record = parent
+	}
+	return 0, nil
+}
+
+// auditUint reads an unsigned, signed or pointer-to-integer value as a uint
+func auditUint(v reflect.Value) uint {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	switch {
+	case !v.IsValid():
+		return 0
+	case v.CanUint():
+		return uint(v.Uint())
+	case v.CanInt() && v.Int() > 0:
+		return uint(v.Int())
+	}
+	return 0
+}
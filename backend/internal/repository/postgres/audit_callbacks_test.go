@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// openAuditedTestDB opens a test database whose writes are audited
+func openAuditedTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTestDB(t)
+	require.NoError(t, RegisterAuditCallbacks(db))
+	return db
+}
+
+func TestAuditCallbacks(t *testing.T) {
+	db := openAuditedTestDB(t)
+	actor := models.AuditActor{UserID: 9, Role: "NURSE", ClientIP: "10.0.0.1"}
+	ctx := models.WithAuditActor(context.Background(), actor)
+
+	patient := createTestPatient(t, db, "audited")
+	order := &models.LabOrder{EncounterID: 1, PatientID: patient.ID, OrderDate: time.Now(), Status: "pending"}
+	require.NoError(t, db.WithContext(ctx).Omit(clause.Associations).Create(order).Error)
+	result := &models.LabResult{LabOrderID: order.ID, LabTestID: 1, Value: "5.4"}
+	require.NoError(t, db.WithContext(ctx).Omit(clause.Associations).Create(result).Error)
+	require.NoError(t, db.WithContext(ctx).Model(order).Update("status", "completed").Error)
+	// Saving a row unchanged is not recorded
+	require.NoError(t, db.WithContext(ctx).Model(order).Update("status", "completed").Error)
+	require.NoError(t, db.WithContext(ctx).Delete(result).Error)
+
+	events, err := NewAuditRepository(db).ListInOrder(0, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+
+	tests := []struct {
+		action       string
+		resourceType string
+		resourceID   uint
+		actorID      uint
+		diff         string
+	}{
+		{models.AuditActionCreate, "Patient", patient.ID, 0, ""},
+		{models.AuditActionCreate, "LabOrder", order.ID, actor.UserID, ""},
+		{models.AuditActionCreate, "LabResult", result.ID, actor.UserID, ""},
+		{models.AuditActionUpdate, "LabOrder", order.ID, actor.UserID, `"status":{"from":"pending","to":"completed"}`},
+		{models.AuditActionDelete, "LabResult", result.ID, actor.UserID, ""},
+	}
+	prevHash := ""
+	for i, tt := range tests {
+		event := events[i]
+		t.Run(tt.action+" "+tt.resourceType, func(t *testing.T) {
+			assert.Equal(t, tt.action, event.Action)
+			assert.Equal(t, tt.resourceType, event.ResourceType)
+			assert.Equal(t, tt.resourceID, event.ResourceID)
+			assert.Equal(t, tt.actorID, event.ActorID)
+			require.NotNil(t, event.PatientID, "lab results carry the patient of their order")
+			assert.Equal(t, patient.ID, *event.PatientID)
+			assert.Contains(t, event.Diff, tt.diff)
+			assert.Equal(t, prevHash, event.PrevHash)
+			assert.Equal(t, event.ComputeHash(), event.Hash)
+		})
+		prevHash = event.Hash
+	}
+}
+
+func TestAuditCallbacksRollBackUnauditedWrites(t *testing.T) {
+	db := openAuditedTestDB(t)
+	patient := createTestPatient(t, db, "rollback")
+
+	require.NoError(t, db.Migrator().DropTable(&models.AuditEvent{}))
+
+	order := &models.LabOrder{EncounterID: 1, PatientID: patient.ID, OrderDate: time.Now(), Status: "pending"}
+	assert.Error(t, db.Omit(clause.Associations).Create(order).Error)
+	assert.Error(t, db.Model(patient).Update("phone", "01700000000").Error)
+
+	var orders int64
+	require.NoError(t, db.Model(&models.LabOrder{}).Where("patient_id = ?", patient.ID).Count(&orders).Error)
+	assert.Zero(t, orders)
+	var stored models.Patient
+	require.NoError(t, db.First(&stored, patient.ID).Error)
+	assert.Empty(t, stored.Phone)
+}
+
+func TestSkipAudit(t *testing.T) {
+	db := openAuditedTestDB(t)
+	patient := createTestPatient(t, db, "skipped")
+
+	require.NoError(t, skipAudit(db).Model(patient).Update("phone", "01700000000").Error)
+
+	var updates int64
+	require.NoError(t, db.Model(&models.AuditEvent{}).Where("action = ?", models.AuditActionUpdate).Count(&updates).Error)
+	assert.Zero(t, updates)
+}
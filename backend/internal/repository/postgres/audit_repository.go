@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// auditChainLockKey serializes appends so each event chains to the latest one
+const auditChainLockKey = 727001
+
+// AuditFilter holds the optional criteria for querying audit events
+type AuditFilter struct {
+	PatientID    *uint
+	ActorID      *uint
+	ResourceType string
+	Action       string
+	From         *time.Time
+	To           *time.Time
+}
+
+// AuditRepository stores audit events. It only ever inserts; there are no
+// update or delete operations.
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// InstallImmutabilityTrigger makes the database reject UPDATE and DELETE on audit_events
+func (r *AuditRepository) InstallImmutabilityTrigger() error {
+	return r.db.Exec(`
+CREATE OR REPLACE FUNCTION audit_events_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_modify ON audit_events;
+CREATE TRIGGER audit_events_no_modify
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_immutable();
+`).Error
+}
+
+// Append chains the event to the latest event and inserts it
+func (r *AuditRepository) Append(event *models.AuditEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return appendAuditEvent(tx, event)
+	})
+}
+
+// appendAuditEvent chains the event to the latest event and inserts it in
+// tx. The chain lock is held until tx ends, so events are chained in the
+// order their transactions commit.
+func appendAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+		return err
+	}
+
+	var last models.AuditEvent
+	err := tx.Order("id DESC").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// Postgres stores microseconds; truncate so the hash can be recomputed
+	event.RecordedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.PrevHash = last.Hash
+	event.Hash = event.ComputeHash()
+
+	return tx.Create(event).Error
+}
+
+func (r *AuditRepository) List(filter AuditFilter, offset, limit int) ([]*models.AuditEvent, int64, error) {
+	var events []*models.AuditEvent
+	var total int64
+
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.PatientID != nil {
+		query = query.Where("patient_id = ?", *filter.PatientID)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		query = query.Where("recorded_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("recorded_at < ?", *filter.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Offset(offset).Limit(limit).Order("id DESC").Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// ListInOrder returns events in chain order starting after the given ID
+func (r *AuditRepository) ListInOrder(afterID uint, limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	if err := r.db.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -16,8 +17,8 @@ func NewBillingRepository(db *gorm.DB) *BillingRepository {
 }
 
 // Invoice Operations
-func (r *BillingRepository) CreateInvoice(invoice *models.Invoice) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *BillingRepository) CreateInvoice(ctx context.Context, invoice *models.Invoice) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create invoice
 		if err := tx.Create(invoice).Error; err != nil {
 			return err
@@ -62,25 +63,21 @@ func (r *BillingRepository) ListInvoices(patientID uint, status string) ([]model
 	return invoices, err
 }
 
-func (r *BillingRepository) GetOutstandingInvoices() ([]models.Invoice, error) {
-	var invoices []models.Invoice
-	err := r.db.Preload("Patient").
-		Where("status IN ?", []string{"pending", "partial"}).
-		Where("balance_amount > 0").
-		Order("due_date ASC").
-		Find(&invoices).Error
-	return invoices, err
+func (r *BillingRepository) GetOutstandingInvoices(q ListQuery) (*Page[models.Invoice], error) {
+	query := r.db.Where("status IN ?", []string{"pending", "partial"}).
+		Where("balance_amount > 0")
+	return Paginate[models.Invoice](query, ListSpec{Sort: "due_date", Preloads: []string{"Patient"}}, q)
 }
 
-func (r *BillingRepository) UpdateInvoiceStatus(id uint, status string) error {
-	return r.db.Model(&models.Invoice{}).
+func (r *BillingRepository) UpdateInvoiceStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&models.Invoice{}).
 		Where("id = ?", id).
 		Update("status", status).Error
 }
 
 // Payment Operations
-func (r *BillingRepository) CreatePayment(payment *models.Payment) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *BillingRepository) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create payment
 		if err := tx.Create(payment).Error; err != nil {
 			return err
@@ -124,8 +121,8 @@ func (r *BillingRepository) GetPaymentsByDateRange(startDate, endDate time.Time)
 }
 
 // Insurance Claim Operations
-func (r *BillingRepository) CreateClaim(claim *models.InsuranceClaim) error {
-	return r.db.Create(claim).Error
+func (r *BillingRepository) CreateClaim(ctx context.Context, claim *models.InsuranceClaim) error {
+	return r.db.WithContext(ctx).Create(claim).Error
 }
 
 func (r *BillingRepository) GetClaim(id uint) (*models.InsuranceClaim, error) {
@@ -149,7 +146,7 @@ func (r *BillingRepository) ListClaims(status string) ([]models.InsuranceClaim,
 	return claims, err
 }
 
-func (r *BillingRepository) UpdateClaimStatus(id uint, status string, approvedAmount float64, reason string) error {
+func (r *BillingRepository) UpdateClaimStatus(ctx context.Context, id uint, status string, approvedAmount float64, reason string) error {
 	updates := map[string]interface{}{
 		"status":          status,
 		"approved_amount": approvedAmount,
@@ -167,7 +164,7 @@ func (r *BillingRepository) UpdateClaimStatus(id uint, status string, approvedAm
 		updates["paid_at"] = time.Now()
 	}
 
-	return r.db.Model(&models.InsuranceClaim{}).
+	return r.db.WithContext(ctx).Model(&models.InsuranceClaim{}).
 		Where("id = ?", id).
 		Updates(updates).Error
 }
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -15,8 +16,8 @@ func NewClinicalNoteRepository(db *gorm.DB) *ClinicalNoteRepository {
 	return &ClinicalNoteRepository{db: db}
 }
 
-func (r *ClinicalNoteRepository) Create(note *models.ClinicalNote) (*models.ClinicalNote, error) {
-	if err := r.db.Create(note).Error; err != nil {
+func (r *ClinicalNoteRepository) Create(ctx context.Context, note *models.ClinicalNote) (*models.ClinicalNote, error) {
+	if err := r.db.WithContext(ctx).Create(note).Error; err != nil {
 		return nil, err
 	}
 	return note, nil
@@ -33,8 +34,8 @@ func (r *ClinicalNoteRepository) FindByID(id uint) (*models.ClinicalNote, error)
 	return &note, nil
 }
 
-func (r *ClinicalNoteRepository) Update(note *models.ClinicalNote) (*models.ClinicalNote, error) {
-	if err := r.db.Save(note).Error; err != nil {
+func (r *ClinicalNoteRepository) Update(ctx context.Context, note *models.ClinicalNote) (*models.ClinicalNote, error) {
+	if err := r.db.WithContext(ctx).Save(note).Error; err != nil {
 		return nil, err
 	}
 	return note, nil
@@ -48,10 +49,6 @@ func (r *ClinicalNoteRepository) ListByEncounter(encounterID uint) ([]*models.Cl
 	return notes, nil
 }
 
-func (r *ClinicalNoteRepository) ListByPatient(patientID uint, limit int) ([]*models.ClinicalNote, error) {
-	var notes []*models.ClinicalNote
-	if err := r.db.Where("patient_id = ?", patientID).Order("note_date DESC").Limit(limit).Find(&notes).Error; err != nil {
-		return nil, err
-	}
-	return notes, nil
+func (r *ClinicalNoteRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.ClinicalNote], error) {
+	return Paginate[models.ClinicalNote](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-note_date"}, q)
 }
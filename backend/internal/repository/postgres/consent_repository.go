@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ConsentRepository struct {
+	db *gorm.DB
+}
+
+func NewConsentRepository(db *gorm.DB) *ConsentRepository {
+	return &ConsentRepository{db: db}
+}
+
+// consentedPatientsSQL selects the patients with an effective consent for a
+// scope; the parameters are the scope and the current time twice
+const consentedPatientsSQL = `SELECT patient_id FROM consents
+	WHERE scope = ? AND status = 'active' AND deleted_at IS NULL
+	AND granted_at <= ? AND (expires_at IS NULL OR expires_at > ?)`
+
+// whereConsented limits a query to rows whose patient, in patientColumn, has
+// an effective consent for scope
+func whereConsented(query *gorm.DB, patientColumn, scope string, now time.Time) *gorm.DB {
+	return query.Where(patientColumn+" IN ("+consentedPatientsSQL+")", scope, now, now)
+}
+
+// Create records a decision, superseding the patient's earlier decisions on
+// the same scope
+func (r *ConsentRepository) Create(ctx context.Context, consent *models.Consent) (*models.Consent, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Consent{}).
+			Where("patient_id = ? AND scope = ? AND status IN ?", consent.PatientID, consent.Scope,
+				[]string{models.ConsentStatusActive, models.ConsentStatusRejected}).
+			UpdateColumns(map[string]interface{}{"status": models.ConsentStatusInactive, "updated_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(consent).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+func (r *ConsentRepository) FindByID(id uint) (*models.Consent, error) {
+	var consent models.Consent
+	if err := r.db.First(&consent, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *ConsentRepository) Update(ctx context.Context, consent *models.Consent) (*models.Consent, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(consent).Error; err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+// ListByPatient returns a page of the patient's consent history, newest first
+func (r *ConsentRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.Consent], error) {
+	return Paginate[models.Consent](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-granted_at"}, q)
+}
+
+// HasConsent checks if the patient has an effective consent for scope
+func (r *ConsentRepository) HasConsent(patientID uint, scope string) (bool, error) {
+	var count int64
+	err := whereConsented(r.db.Model(&models.Patient{}), "id", scope, time.Now()).
+		Where("id = ?", patientID).Count(&count).Error
+	return count > 0, err
+}
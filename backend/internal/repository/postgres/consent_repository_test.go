@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereConsented(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewConsentRepository(db)
+	now := time.Now()
+	hourAgo, inAnHour := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		consent *models.Consent
+		want    bool
+	}{
+		{"active", &models.Consent{Status: models.ConsentStatusActive, GrantedAt: hourAgo}, true},
+		{"active until later", &models.Consent{Status: models.ConsentStatusActive, GrantedAt: hourAgo, ExpiresAt: &inAnHour}, true},
+		{"expired", &models.Consent{Status: models.ConsentStatusActive, GrantedAt: now.Add(-2 * time.Hour), ExpiresAt: &hourAgo}, false},
+		{"granted from later", &models.Consent{Status: models.ConsentStatusActive, GrantedAt: inAnHour}, false},
+		{"rejected", &models.Consent{Status: models.ConsentStatusRejected, GrantedAt: hourAgo}, false},
+		{"withdrawn", &models.Consent{Status: models.ConsentStatusInactive, GrantedAt: hourAgo}, false},
+		{"other scope", &models.Consent{Scope: models.ConsentScopeResearch, Status: models.ConsentStatusActive, GrantedAt: hourAgo}, false},
+		{"never asked", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patient := createTestPatient(t, db, "consent")
+			if tt.consent != nil {
+				tt.consent.PatientID = patient.ID
+				if tt.consent.Scope == "" {
+					tt.consent.Scope = models.ConsentScopeDataSharing
+				}
+				_, err := repo.Create(context.Background(), tt.consent)
+				require.NoError(t, err)
+			}
+
+			var count int64
+			err := whereConsented(db.Model(&models.Patient{}), "id", models.ConsentScopeDataSharing, now).
+				Where("id = ?", patient.ID).Count(&count).Error
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, count == 1)
+		})
+	}
+}
+
+// TestConsentCreateSupersedes checks a new decision replaces the earlier
+// decision on the same scope and leaves other scopes alone
+func TestConsentCreateSupersedes(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewConsentRepository(db)
+	patient := createTestPatient(t, db, "supersede")
+	ctx := context.Background()
+	hourAgo := time.Now().Add(-time.Hour)
+
+	given, err := repo.Create(ctx, &models.Consent{PatientID: patient.ID, Scope: models.ConsentScopeDataSharing, Status: models.ConsentStatusActive, GrantedAt: hourAgo})
+	require.NoError(t, err)
+	research, err := repo.Create(ctx, &models.Consent{PatientID: patient.ID, Scope: models.ConsentScopeResearch, Status: models.ConsentStatusActive, GrantedAt: hourAgo})
+	require.NoError(t, err)
+	declined, err := repo.Create(ctx, &models.Consent{PatientID: patient.ID, Scope: models.ConsentScopeDataSharing, Status: models.ConsentStatusRejected, GrantedAt: hourAgo})
+	require.NoError(t, err)
+
+	stored, err := repo.FindByID(given.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusInactive, stored.Status)
+	stored, err = repo.FindByID(declined.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusRejected, stored.Status)
+	stored, err = repo.FindByID(research.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusActive, stored.Status)
+
+	consented, err := repo.HasConsent(patient.ID, models.ConsentScopeDataSharing)
+	require.NoError(t, err)
+	assert.False(t, consented)
+	consented, err = repo.HasConsent(patient.ID, models.ConsentScopeResearch)
+	require.NoError(t, err)
+	assert.True(t, consented)
+}
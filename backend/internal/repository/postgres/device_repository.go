@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeviceRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceRepository(db *gorm.DB) *DeviceRepository {
+	return &DeviceRepository{db: db}
+}
+
+func (r *DeviceRepository) Create(ctx context.Context, device *models.Device) (*models.Device, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Create(device).Error; err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (r *DeviceRepository) FindByID(id uint) (*models.Device, error) {
+	var device models.Device
+	if err := r.db.Preload("Bed").First(&device, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// FindByKeyHash returns the device holding an ingestion key
+func (r *DeviceRepository) FindByKeyHash(hash string) (*models.Device, error) {
+	var device models.Device
+	if err := r.db.Where("key_hash = ?", hash).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, device *models.Device) (*models.Device, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(device).Error; err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Touch records when a device last sent a reading. The time is bookkeeping,
+// so it is not audited.
+func (r *DeviceRepository) Touch(id uint, at time.Time) error {
+	return skipAudit(r.db).Model(&models.Device{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+}
+
+func (r *DeviceRepository) List(q ListQuery) (*Page[models.Device], error) {
+	return Paginate[models.Device](r.db, ListSpec{Sort: "identifier", Preloads: []string{"Bed"}}, q)
+}
+
+// admissionBedAtSQL is the bed an admission was in at @at: where its last
+// transfer before then took it, else where its first transfer after then took
+// it from, else its bed
+const admissionBedAtSQL = `COALESCE(
+	(SELECT to_bed_id FROM transfers WHERE transfers.admission_id = admissions.id AND transfers.deleted_at IS NULL
+		AND transfers.transfer_date <= @at ORDER BY transfers.transfer_date DESC, transfers.id DESC LIMIT 1),
+	(SELECT from_bed_id FROM transfers WHERE transfers.admission_id = admissions.id AND transfers.deleted_at IS NULL
+		AND transfers.transfer_date > @at ORDER BY transfers.transfer_date, transfers.id LIMIT 1),
+	admissions.bed_id)`
+
+// AdmittedPatientAtBed returns the patient who was admitted to a bed at a
+// time, following transfers between beds
+func (r *DeviceRepository) AdmittedPatientAtBed(bedID uint, at time.Time) (uint, error) {
+	var admission models.Admission
+	err := r.db.Where("admission_date <= @at AND (discharge_date IS NULL OR discharge_date > @at) AND "+
+		admissionBedAtSQL+" = @bed", sql.Named("at", at), sql.Named("bed", bedID)).
+		Order("admission_date DESC").First(&admission).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return admission.PatientID, nil
+}
+
+// EncounterAt returns the patient's encounter that was under way at a time, an
+// inpatient one first and then the latest started
+func (r *DeviceRepository) EncounterAt(patientID uint, at time.Time) (uint, error) {
+	var encounter models.Encounter
+	err := r.db.Where("patient_id = ? AND status IN ?", patientID, []string{models.EncounterStatusArrived,
+		models.EncounterStatusTriaged, models.EncounterStatusInProgress, models.EncounterStatusOnLeave,
+		models.EncounterStatusFinished}).
+		Where("period_start <= ? AND (period_end IS NULL OR period_end > ?)", at, at).
+		Order(clause.Expr{SQL: "class = ? DESC, period_start DESC", Vars: []interface{}{models.EncounterClassInpatient}}).
+		First(&encounter).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return encounter.ID, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/clause"
+)
+
+// TestAdmittedPatientAtBed follows a bed through two admissions and a
+// transfer: the previous occupant keeps the bed's readings up to their
+// transfer out, the new occupant from their admission
+func TestAdmittedPatientAtBed(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewDeviceRepository(db)
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	first := createTestPatient(t, db, "first")
+	second := createTestPatient(t, db, "second")
+	const bed, otherBed = 10, 11
+
+	// The first patient is admitted to the bed, moves to another bed at 4h
+	// and is discharged at 6h; the second is admitted to the bed at 5h
+	moved := &models.Admission{PatientID: first.ID, BedID: otherBed, AdmissionDate: hour(0), Status: "Discharged"}
+	discharged := hour(6)
+	moved.DischargeDate = &discharged
+	require.NoError(t, db.Omit(clause.Associations).Create(moved).Error)
+	require.NoError(t, db.Create(&models.Transfer{AdmissionID: moved.ID, FromWardID: 1, FromBedID: bed,
+		ToWardID: 1, ToBedID: otherBed, TransferDate: hour(4), AuthorizedBy: 1}).Error)
+	current := &models.Admission{PatientID: second.ID, BedID: bed, AdmissionDate: hour(5), Status: "Admitted"}
+	require.NoError(t, db.Omit(clause.Associations).Create(current).Error)
+
+	tests := []struct {
+		name string
+		bed  uint
+		at   time.Time
+		want uint
+	}{
+		{"before any admission", bed, hour(-1), 0},
+		{"first patient before the transfer", bed, hour(1), first.ID},
+		{"bed empty after the transfer", bed, hour(4).Add(30 * time.Minute), 0},
+		{"second patient", bed, hour(7), second.ID},
+		{"first patient in the other bed", otherBed, hour(5), first.ID},
+		{"other bed after discharge", otherBed, hour(6), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.AdmittedPatientAtBed(tt.bed, tt.at)
+			if tt.want == 0 {
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
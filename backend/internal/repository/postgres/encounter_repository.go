@@ -1,12 +1,19 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrEncounterStatusConflict is returned when an encounter's status was
+// changed by someone else after it was read
+var ErrEncounterStatusConflict = errors.New("encounter status was changed by someone else; reload it and try again")
+
 type EncounterRepository struct {
 	db *gorm.DB
 }
@@ -15,8 +22,20 @@ func NewEncounterRepository(db *gorm.DB) *EncounterRepository {
 	return &EncounterRepository{db: db}
 }
 
-func (r *EncounterRepository) Create(encounter *models.Encounter) (*models.Encounter, error) {
-	if err := r.db.Create(encounter).Error; err != nil {
+// Create saves a new encounter with the first entry of its status history
+func (r *EncounterRepository) Create(ctx context.Context, encounter *models.Encounter, createdBy uint) (*models.Encounter, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(encounter).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EncounterStatusHistory{
+			EncounterID: encounter.ID,
+			Status:      encounter.Status,
+			ChangedAt:   encounter.CreatedAt,
+			ChangedBy:   createdBy,
+		}).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return encounter, nil
@@ -35,26 +54,104 @@ func (r *EncounterRepository) FindByID(id uint) (*models.Encounter, error) {
 	return &encounter, nil
 }
 
-func (r *EncounterRepository) Update(encounter *models.Encounter) (*models.Encounter, error) {
-	if err := r.db.Save(encounter).Error; err != nil {
+// Update saves the encounter, keeping its status. ErrEncounterStatusConflict
+// is returned if the status changed since the encounter was read.
+func (r *EncounterRepository) Update(ctx context.Context, encounter *models.Encounter) (*models.Encounter, error) {
+	if err := saveEncounter(r.db.WithContext(ctx), encounter, encounter.Status); err != nil {
 		return nil, err
 	}
 	return encounter, nil
 }
 
-func (r *EncounterRepository) ListByPatient(patientID uint, offset, limit int) ([]*models.Encounter, int64, error) {
-	var encounters []*models.Encounter
-	var total int64
+// UpdateStatus saves an encounter whose status changed together with the
+// history entry of the change. The encounter is only saved while its status is
+// still change.FromStatus, so two concurrent changes cannot both pass the
+// transition check; the later one gets ErrEncounterStatusConflict.
+func (r *EncounterRepository) UpdateStatus(ctx context.Context, encounter *models.Encounter, change *models.EncounterStatusHistory) (*models.Encounter, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := saveEncounter(tx, encounter, change.FromStatus); err != nil {
+			return err
+		}
+		change.EncounterID = encounter.ID
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encounter, nil
+}
 
-	query := r.db.Model(&models.Encounter{}).Where("patient_id = ?", patientID)
+// saveEncounter updates every column of the encounter, provided its stored
+// status is fromStatus; otherwise ErrEncounterStatusConflict is returned
+func saveEncounter(tx *gorm.DB, encounter *models.Encounter, fromStatus string) error {
+	saved := tx.Model(encounter).Where("status = ?", fromStatus).
+		Select("*").Omit(clause.Associations, "created_at").Updates(encounter)
+	if saved.Error != nil {
+		return saved.Error
+	}
+	if saved.RowsAffected == 0 {
+		return ErrEncounterStatusConflict
+	}
+	return nil
+}
 
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+// ListStatusHistory returns the encounter's status changes, oldest first
+func (r *EncounterRepository) ListStatusHistory(encounterID uint) ([]models.EncounterStatusHistory, error) {
+	var history []models.EncounterStatusHistory
+	if err := r.db.Where("encounter_id = ?", encounterID).Order("changed_at, id").Find(&history).Error; err != nil {
+		return nil, err
 	}
+	return history, nil
+}
+
+// encounterWaitTimesSQL takes each encounter's first arrival, triage and
+// in-progress times from the status history and summarizes the encounters
+// that arrived in [from, to). percentile_cont skips encounters that have not
+// reached a status yet.
+const encounterWaitTimesSQL = `
+WITH times AS (
+	SELECT h.encounter_id,
+		min(h.changed_at) FILTER (WHERE h.status = 'arrived') AS arrived_at,
+		min(h.changed_at) FILTER (WHERE h.status = 'triaged') AS triaged_at,
+		min(h.changed_at) FILTER (WHERE h.status = 'in-progress') AS seen_at
+	FROM encounter_status_history h
+	GROUP BY h.encounter_id
+)
+SELECT count(*) AS arrivals,
+	count(t.triaged_at) AS triaged,
+	count(t.seen_at) AS seen,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM t.triaged_at - t.arrived_at) / 60) AS door_to_triage_median,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM t.seen_at - t.arrived_at) / 60) AS door_to_doctor_median,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY extract(epoch FROM t.seen_at - t.arrived_at) / 60) AS door_to_doctor_p90,
+	avg(extract(epoch FROM t.seen_at - t.arrived_at) / 60) AS door_to_doctor_mean
+FROM times t
+JOIN encounters e ON e.id = t.encounter_id
+WHERE e.deleted_at IS NULL AND e.status <> 'entered-in-error'
+	AND t.arrived_at >= @from AND t.arrived_at < @to
+	AND (@category = '' OR e.service_category = @category)`
 
-	if err := query.Offset(offset).Limit(limit).Order("period_start DESC").Find(&encounters).Error; err != nil {
-		return nil, 0, err
+// WaitTimes summarizes the door-to-triage and door-to-doctor times of the
+// encounters that arrived in [from, to), optionally of one service category
+func (r *EncounterRepository) WaitTimes(from, to time.Time, serviceCategory string) (*models.EncounterWaitTimes, error) {
+	summary := &models.EncounterWaitTimes{From: from, To: to, ServiceCategory: serviceCategory}
+	err := r.db.Raw(encounterWaitTimesSQL, map[string]interface{}{
+		"from": from, "to": to, "category": serviceCategory,
+	}).Scan(summary).Error
+	if err != nil {
+		return nil, err
 	}
+	return summary, nil
+}
+
+// BackfillStatusHistory gives encounters created before status history was
+// kept an entry with their current status at their creation time
+func (r *EncounterRepository) BackfillStatusHistory() error {
+	return r.db.Exec(`INSERT INTO encounter_status_history (encounter_id, status, changed_at, reason)
+		SELECT e.id, e.status, e.created_at, 'status when history began'
+		FROM encounters e
+		WHERE NOT EXISTS (SELECT 1 FROM encounter_status_history h WHERE h.encounter_id = e.id)`).Error
+}
 
-	return encounters, total, nil
+func (r *EncounterRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.Encounter], error) {
+	return Paginate[models.Encounter](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-period_start"}, q)
 }
@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DateFilter is a FHIR date search parameter: the prefix (eq, ne, lt, le, gt, ge,
+// sa, eb) is applied to the half-open range [Start, End) implied by the value's precision
+type DateFilter struct {
+	Prefix string
+	Start  time.Time
+	End    time.Time
+}
+
+// FHIRSearch holds the parsed criteria of a FHIR search
+type FHIRSearch struct {
+	IDs       []uint
+	PatientID *uint
+	Statuses  []string
+	Dates     []DateFilter
+
+	// Patient only
+	Name       string
+	Gender     string
+	BirthDates []DateFilter
+
+	// Identifier search: the normalized values to look for, in one system or
+	// in any system if IdentifierSystem is empty
+	IdentifierSystem string
+	IdentifierValues []string
+
+	Offset int
+	Count  int
+}
+
+// fhirColumns names the columns a resource's search parameters apply to
+type fhirColumns struct {
+	id      string
+	patient string
+	status  string
+	date    string
+}
+
+// FHIRRepository implements FHIR searches and generic reads/writes over the domain tables
+type FHIRRepository struct {
+	db *gorm.DB
+}
+
+func NewFHIRRepository(db *gorm.DB) *FHIRRepository {
+	return &FHIRRepository{db: db}
+}
+
+func (r *FHIRRepository) SearchPatients(s FHIRSearch) ([]*models.Patient, int64, error) {
+	query := r.db.Model(&models.Patient{}).Preload("Identifiers")
+	if s.Name != "" {
+		like := "%" + s.Name + "%"
+		query = query.Where("given_name ILIKE ? OR middle_name ILIKE ? OR family_name ILIKE ?", like, like, like)
+	}
+	if s.IdentifierValues != nil {
+		identifiers := r.db.Model(&models.PatientIdentifier{}).Select("patient_id").Where("value IN ?", s.IdentifierValues)
+		if s.IdentifierSystem != "" {
+			identifiers = identifiers.Where("system = ?", s.IdentifierSystem)
+		}
+		query = query.Where("id IN (?)", identifiers)
+	}
+	if s.Gender != "" {
+		query = query.Where("gender = ?", s.Gender)
+	}
+	query = applyDateFilters(query, "birth_date", s.BirthDates)
+
+	var patients []*models.Patient
+	total, err := r.search(query, s, fhirColumns{id: "id", date: "created_at"}, &patients)
+	return patients, total, err
+}
+
+func (r *FHIRRepository) SearchEncounters(s FHIRSearch) ([]*models.Encounter, int64, error) {
+	var encounters []*models.Encounter
+	total, err := r.search(r.db.Model(&models.Encounter{}), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "period_start"}, &encounters)
+	return encounters, total, err
+}
+
+func (r *FHIRRepository) SearchAppointments(s FHIRSearch) ([]*models.Appointment, int64, error) {
+	var appointments []*models.Appointment
+	total, err := r.search(r.db.Model(&models.Appointment{}), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "scheduled_start"}, &appointments)
+	return appointments, total, err
+}
+
+func (r *FHIRRepository) SearchLabOrders(s FHIRSearch) ([]*models.LabOrder, int64, error) {
+	var orders []*models.LabOrder
+	total, err := r.search(r.db.Model(&models.LabOrder{}).Preload("Results.LabTest"), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "order_date"}, &orders)
+	return orders, total, err
+}
+
+var (
+	labOrdersTable  = models.LabOrder{}.TableName()
+	labResultsTable = models.LabResult{}.TableName()
+
+	// labOrderJoin joins lab results to their lab order, which holds the patient
+	labOrderJoin = "JOIN " + labOrdersTable + " ON " + labOrdersTable + ".id = " + labResultsTable +
+		".lab_order_id AND " + labOrdersTable + ".deleted_at IS NULL"
+)
+
+// SearchLabResults searches lab results; the patient comes from the parent lab order
+func (r *FHIRRepository) SearchLabResults(s FHIRSearch) ([]*models.LabResult, int64, error) {
+	query := r.db.Model(&models.LabResult{}).
+		Joins(labOrderJoin).
+		Preload("LabOrder").Preload("LabTest")
+
+	var results []*models.LabResult
+	total, err := r.search(query, s, fhirColumns{
+		id:      labResultsTable + ".id",
+		patient: labOrdersTable + ".patient_id",
+		status:  labResultsTable + ".status",
+		date:    labResultsTable + ".result_date",
+	}, &results)
+	return results, total, err
+}
+
+// SearchVitalSigns searches vital signs. Vital signs have no status column; they
+// are always final, so any other status matches nothing.
+func (r *FHIRRepository) SearchVitalSigns(s FHIRSearch) ([]*models.VitalSigns, int64, error) {
+	query := r.db.Model(&models.VitalSigns{})
+	if len(s.Statuses) > 0 && !containsString(s.Statuses, "final") {
+		query = query.Where("1 = 0")
+	}
+
+	var vitals []*models.VitalSigns
+	total, err := r.search(query, s, fhirColumns{id: "id", patient: "patient_id", date: "measured_at"}, &vitals)
+	return vitals, total, err
+}
+
+func (r *FHIRRepository) SearchPrescriptions(s FHIRSearch) ([]*models.Prescription, int64, error) {
+	var prescriptions []*models.Prescription
+	total, err := r.search(r.db.Model(&models.Prescription{}).Preload("Medication"), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "start_date"}, &prescriptions)
+	return prescriptions, total, err
+}
+
+func (r *FHIRRepository) SearchImagingStudies(s FHIRSearch) ([]*models.ImagingStudy, int64, error) {
+	var studies []*models.ImagingStudy
+	total, err := r.search(r.db.Model(&models.ImagingStudy{}).Preload("Series.Instances"), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "started_at"}, &studies)
+	return studies, total, err
+}
+
+// SearchNCDScreenings searches NCD screenings, served as QuestionnaireResponse
+func (r *FHIRRepository) SearchNCDScreenings(s FHIRSearch) ([]*models.NCDScreening, int64, error) {
+	var screenings []*models.NCDScreening
+	total, err := r.search(r.db.Model(&models.NCDScreening{}), s,
+		fhirColumns{id: "id", patient: "patient_id", status: "status", date: "screened_at"}, &screenings)
+	return screenings, total, err
+}
+
+// SearchQuestionnaires searches form definitions, which have no patient
+func (r *FHIRRepository) SearchQuestionnaires(s FHIRSearch) ([]*models.Questionnaire, int64, error) {
+	var questionnaires []*models.Questionnaire
+	total, err := r.search(r.db.Model(&models.Questionnaire{}), s,
+		fhirColumns{id: "id", status: "status", date: "updated_at"}, &questionnaires)
+	return questionnaires, total, err
+}
+
+// search applies the common criteria, counts the matches and loads one page into out
+func (r *FHIRRepository) search(query *gorm.DB, s FHIRSearch, cols fhirColumns, out interface{}) (int64, error) {
+	if len(s.IDs) > 0 {
+		query = query.Where(cols.id+" IN ?", s.IDs)
+	}
+	if s.PatientID != nil {
+		if cols.patient == "" {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where(cols.patient+" = ?", *s.PatientID)
+		}
+	}
+	if len(s.Statuses) > 0 && cols.status != "" {
+		query = query.Where(cols.status+" IN ?", s.Statuses)
+	}
+	query = applyDateFilters(query, cols.date, s.Dates)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	if s.Count == 0 {
+		return total, nil
+	}
+	if err := query.Order(cols.id + " ASC").Offset(s.Offset).Limit(s.Count).Find(out).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func applyDateFilters(query *gorm.DB, column string, filters []DateFilter) *gorm.DB {
+	for _, f := range filters {
+		switch f.Prefix {
+		case "ne":
+			query = query.Where("("+column+" < ? OR "+column+" >= ?)", f.Start, f.End)
+		case "lt", "eb":
+			query = query.Where(column+" < ?", f.Start)
+		case "le":
+			query = query.Where(column+" < ?", f.End)
+		case "gt", "sa":
+			query = query.Where(column+" >= ?", f.End)
+		case "ge":
+			query = query.Where(column+" >= ?", f.Start)
+		default:
+			query = query.Where(column+" >= ? AND "+column+" < ?", f.Start, f.End)
+		}
+	}
+	return query
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Find loads a record by ID into out with the given associations preloaded
+func (r *FHIRRepository) Find(out interface{}, id uint, preloads ...string) error {
+	query := r.db
+	for _, association := range preloads {
+		query = query.Preload(association)
+	}
+	return notFound(query.First(out, id).Error)
+}
+
+// Exists reports whether a record of the model's table has the given ID
+func (r *FHIRRepository) Exists(model interface{}, id uint) (bool, error) {
+	var count int64
+	if err := r.db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *FHIRRepository) FindLabTestByCode(code string) (*models.LabTest, error) {
+	var test models.LabTest
+	if err := notFound(r.db.Where("code = ?", code).First(&test).Error); err != nil {
+		return nil, err
+	}
+	return &test, nil
+}
+
+// notFound maps gorm's missing-record error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Save updates a record's own columns; preloaded associations are not written
+func (r *FHIRRepository) Save(ctx context.Context, record interface{}) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(record).Error
+}
+
+// ExportFilter limits a bulk export to a group of patients and/or to records
+// last modified within [Since, Until). With ConsentScope set, only patients
+// with an effective consent for that scope are exported.
+type ExportFilter struct {
+	PatientIDs   []uint
+	Since        *time.Time
+	Until        *time.Time
+	ConsentScope string
+}
+
+// exportBatchSize is how many rows are loaded at a time while exporting
+const exportBatchSize = 200
+
+// exportQuery applies an ExportFilter. The dates are qualified with the table
+// of the query's model, for joined queries.
+func exportQuery(query *gorm.DB, patientColumn string, f ExportFilter) *gorm.DB {
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(query.Statement.Model); err != nil {
+		query.AddError(err)
+		return query
+	}
+	table := stmt.Table
+	if len(f.PatientIDs) > 0 {
+		query = query.Where(patientColumn+" IN ?", f.PatientIDs)
+	}
+	if f.Since != nil {
+		query = query.Where(table+".updated_at >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		query = query.Where(table+".updated_at < ?", *f.Until)
+	}
+	if f.ConsentScope != "" {
+		query = whereConsented(query, patientColumn, f.ConsentScope, time.Now())
+	}
+	return query
+}
+
+// exportBatches streams the query's rows to fn in primary key order
+func exportBatches[T any](query *gorm.DB, fn func([]*T) error) error {
+	var batch []*T
+	return query.FindInBatches(&batch, exportBatchSize, func(*gorm.DB, int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (r *FHIRRepository) ExportPatients(f ExportFilter, fn func([]*models.Patient) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.Patient{}).Preload("Identifiers"), "id", f), fn)
+}
+
+func (r *FHIRRepository) ExportEncounters(f ExportFilter, fn func([]*models.Encounter) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.Encounter{}), "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportAppointments(f ExportFilter, fn func([]*models.Appointment) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.Appointment{}), "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportVitalSigns(f ExportFilter, fn func([]*models.VitalSigns) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.VitalSigns{}), "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportClinicalNotes(f ExportFilter, fn func([]*models.ClinicalNote) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.ClinicalNote{}), "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportPrescriptions(f ExportFilter, fn func([]*models.Prescription) error) error {
+	query := r.db.Model(&models.Prescription{}).Preload("Medication")
+	return exportBatches(exportQuery(query, "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportDispensings(f ExportFilter, fn func([]*models.Dispensing) error) error {
+	query := r.db.Model(&models.Dispensing{}).Preload("Medication")
+	return exportBatches(exportQuery(query, "patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportLabOrders(f ExportFilter, fn func([]*models.LabOrder) error) error {
+	query := r.db.Model(&models.LabOrder{}).Preload("Results.LabTest")
+	return exportBatches(exportQuery(query, "patient_id", f), fn)
+}
+
+// ExportLabResults exports lab results; the patient comes from the parent lab order
+func (r *FHIRRepository) ExportLabResults(f ExportFilter, fn func([]*models.LabResult) error) error {
+	query := r.db.Model(&models.LabResult{}).
+		Joins(labOrderJoin).
+		Preload("LabOrder").Preload("LabTest")
+	return exportBatches(exportQuery(query, labOrdersTable+".patient_id", f), fn)
+}
+
+func (r *FHIRRepository) ExportNCDScreenings(f ExportFilter, fn func([]*models.NCDScreening) error) error {
+	return exportBatches(exportQuery(r.db.Model(&models.NCDScreening{}), "patient_id", f), fn)
+}
+
+// ExportImagingStudies exports imaging studies with their series and report
+func (r *FHIRRepository) ExportImagingStudies(f ExportFilter, fn func([]*models.ImagingStudy) error) error {
+	query := r.db.Model(&models.ImagingStudy{}).Preload("Series.Instances").Preload("Report")
+	return exportBatches(exportQuery(query, "patient_id", f), fn)
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dryRunDB builds SQL without a database
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestExportQueryQualifiesDatesWithModelTable(t *testing.T) {
+	db := dryRunDB(t)
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 1, 0)
+	f := ExportFilter{PatientIDs: []uint{7}, Since: &since, Until: &until}
+
+	tests := []struct {
+		name          string
+		model         interface{}
+		patientColumn string
+		want          []string
+	}{
+		{"dispensing", &models.Dispensing{}, "patient_id",
+			[]string{"dispensing.updated_at >= ", "dispensing.updated_at < ", "patient_id IN "}},
+		{"patients", &models.Patient{}, "id",
+			[]string{"patients.updated_at >= ", "patients.updated_at < ", "id IN "}},
+		{"lab results", &models.LabResult{}, labOrdersTable + ".patient_id",
+			[]string{"lab_results.updated_at >= ", "lab_orders.patient_id IN "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return exportQuery(tx.Model(tt.model), tt.patientColumn, f).Find(tt.model)
+			})
+			for _, want := range tt.want {
+				assert.Contains(t, sql, want)
+			}
+		})
+	}
+}
+
+// TestExportsWithDateRange runs every export with a date range against the
+// migrated schema, so each table the exports name must exist
+func TestExportsWithDateRange(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewFHIRRepository(db)
+
+	patient := createTestPatient(t, db, "export")
+	dispensing := &models.Dispensing{PatientID: patient.ID, PrescriptionID: 1, MedicationID: 1, QuantityDispensed: 10, DispensedAt: time.Now()}
+	require.NoError(t, db.Omit(clause.Associations).Create(dispensing).Error)
+
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Hour)
+	f := ExportFilter{PatientIDs: []uint{patient.ID}, Since: &since, Until: &until, ConsentScope: models.ConsentScopeResearch}
+
+	assert.NoError(t, repo.ExportPatients(f, func([]*models.Patient) error { return nil }))
+	assert.NoError(t, repo.ExportEncounters(f, func([]*models.Encounter) error { return nil }))
+	assert.NoError(t, repo.ExportAppointments(f, func([]*models.Appointment) error { return nil }))
+	assert.NoError(t, repo.ExportVitalSigns(f, func([]*models.VitalSigns) error { return nil }))
+	assert.NoError(t, repo.ExportClinicalNotes(f, func([]*models.ClinicalNote) error { return nil }))
+	assert.NoError(t, repo.ExportPrescriptions(f, func([]*models.Prescription) error { return nil }))
+	assert.NoError(t, repo.ExportLabOrders(f, func([]*models.LabOrder) error { return nil }))
+	assert.NoError(t, repo.ExportLabResults(f, func([]*models.LabResult) error { return nil }))
+	assert.NoError(t, repo.ExportNCDScreenings(f, func([]*models.NCDScreening) error { return nil }))
+	assert.NoError(t, repo.ExportImagingStudies(f, func([]*models.ImagingStudy) error { return nil }))
+
+	// Without consent nothing is exported; without the scope the dispensing is
+	var exported []uint
+	collect := func(batch []*models.Dispensing) error {
+		for _, d := range batch {
+			exported = append(exported, d.ID)
+		}
+		return nil
+	}
+	require.NoError(t, repo.ExportDispensings(f, collect))
+	assert.Empty(t, exported)
+	f.ConsentScope = ""
+	require.NoError(t, repo.ExportDispensings(f, collect))
+	assert.Equal(t, []uint{dispensing.ID}, exported)
+}
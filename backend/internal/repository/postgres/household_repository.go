@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type HouseholdRepository struct {
+	db *gorm.DB
+}
+
+func NewHouseholdRepository(db *gorm.DB) *HouseholdRepository {
+	return &HouseholdRepository{db: db}
+}
+
+// Create stores the household with its members and copies its camp and block
+// to the members
+func (r *HouseholdRepository) Create(ctx context.Context, household *models.Household) (*models.Household, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members.Patient").Create(household).Error; err != nil {
+			return err
+		}
+		return syncHouseholdAddress(tx, household)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return household, nil
+}
+
+// FindByID returns the household with its current and past members
+func (r *HouseholdRepository) FindByID(id uint) (*models.Household, error) {
+	var household models.Household
+	if err := r.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("left_at IS NOT NULL, joined_at, id")
+	}).Preload("Members.Patient").First(&household, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &household, nil
+}
+
+// Update saves the household fields; members are changed through the member methods
+func (r *HouseholdRepository) Update(ctx context.Context, household *models.Household) (*models.Household, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(household).Error; err != nil {
+			return err
+		}
+		return syncHouseholdAddress(tx, household)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return household, nil
+}
+
+// syncHouseholdAddress copies the household camp and block to its current members
+func syncHouseholdAddress(tx *gorm.DB, household *models.Household) error {
+	columns := map[string]interface{}{}
+	if household.CampName != "" {
+		columns["camp_name"] = household.CampName
+	}
+	if household.BlockNumber != "" {
+		columns["block_number"] = household.BlockNumber
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	columns["updated_at"] = time.Now()
+	return tx.Model(&models.Patient{}).
+		Where("id IN (?)", tx.Model(&models.HouseholdMember{}).Select("patient_id").
+			Where("household_id = ? AND left_at IS NULL", household.ID)).
+		UpdateColumns(columns).Error
+}
+
+// AddMember adds a patient to the household
+func (r *HouseholdRepository) AddMember(ctx context.Context, household *models.Household, member *models.HouseholdMember) (*models.HouseholdMember, error) {
+	member.HouseholdID = household.ID
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(member).Error; err != nil {
+			return err
+		}
+		return syncHouseholdAddress(tx, household)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateMembers saves changed memberships together, e.g. a new head and the former one
+func (r *HouseholdRepository) UpdateMembers(ctx context.Context, members ...*models.HouseholdMember) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, member := range members {
+			if err := tx.Omit(clause.Associations).Save(member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindCurrentByPatient returns the household the patient currently lives in.
+// After a merge the survivor may briefly belong to two; the latest joined wins.
+func (r *HouseholdRepository) FindCurrentByPatient(patientID uint) (*models.Household, error) {
+	var member models.HouseholdMember
+	if err := r.db.Where("patient_id = ? AND left_at IS NULL", patientID).
+		Order("joined_at DESC").First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r.FindByID(member.HouseholdID)
+}
+
+// Search finds households by UNHCR case number and address. Empty filters are ignored.
+func (r *HouseholdRepository) Search(caseNumber, camp, block, shelter string) ([]*models.Household, error) {
+	var households []*models.Household
+	query := r.db.Preload("Members", "left_at IS NULL").Preload("Members.Patient")
+	if caseNumber != "" {
+		query = query.Where("unhcr_case_number = ?", caseNumber)
+	}
+	if camp != "" {
+		query = query.Where("camp_name ILIKE ?", camp)
+	}
+	if block != "" {
+		query = query.Where("block_number = ?", block)
+	}
+	if shelter != "" {
+		query = query.Where("shelter_number = ?", shelter)
+	}
+	if err := query.Order("id").Limit(20).Find(&households).Error; err != nil {
+		return nil, err
+	}
+	return households, nil
+}
+
+// dependentsQuery selects the ids of the patients born after bornAfter whose
+// mother is guardianID or whose current household guardianID heads
+func (r *HouseholdRepository) dependentsQuery(guardianID uint, bornAfter time.Time) *gorm.DB {
+	headed := r.db.Model(&models.HouseholdMember{}).Select("household_id").
+		Where("patient_id = ? AND relationship = ? AND left_at IS NULL", guardianID, models.HouseholdRelationshipHead)
+	members := r.db.Model(&models.HouseholdMember{}).Select("patient_id").
+		Where("household_id IN (?) AND left_at IS NULL", headed)
+	return r.db.Model(&models.Patient{}).Select("id").
+		Where("id <> ? AND merged_into_id IS NULL AND birth_date > ?", guardianID, bornAfter).
+		Where("mother_id = ? OR id IN (?)", guardianID, members)
+}
+
+// ListDependents returns the dependents of guardianID, see dependentsQuery
+func (r *HouseholdRepository) ListDependents(guardianID uint, bornAfter time.Time) ([]*models.Patient, error) {
+	var patients []*models.Patient
+	if err := r.db.Where("id IN (?)", r.dependentsQuery(guardianID, bornAfter)).
+		Order("birth_date").Find(&patients).Error; err != nil {
+		return nil, err
+	}
+	return patients, nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
@@ -16,19 +17,15 @@ func NewLabRepository(db *gorm.DB) *LabRepository {
 }
 
 // Lab Test methods
-func (r *LabRepository) CreateLabTest(test *models.LabTest) (*models.LabTest, error) {
-	if err := r.db.Create(test).Error; err != nil {
+func (r *LabRepository) CreateLabTest(ctx context.Context, test *models.LabTest) (*models.LabTest, error) {
+	if err := r.db.WithContext(ctx).Create(test).Error; err != nil {
 		return nil, err
 	}
 	return test, nil
 }
 
-func (r *LabRepository) ListLabTests() ([]*models.LabTest, error) {
-	var tests []*models.LabTest
-	if err := r.db.Where("active = ?", true).Order("name ASC").Find(&tests).Error; err != nil {
-		return nil, err
-	}
-	return tests, nil
+func (r *LabRepository) ListLabTests(q ListQuery) (*Page[models.LabTest], error) {
+	return Paginate[models.LabTest](r.db.Where("active = ?", true), ListSpec{Sort: "name"}, q)
 }
 
 func (r *LabRepository) FindLabTestByID(id uint) (*models.LabTest, error) {
@@ -40,8 +37,8 @@ func (r *LabRepository) FindLabTestByID(id uint) (*models.LabTest, error) {
 }
 
 // Lab Order methods
-func (r *LabRepository) CreateLabOrder(order *models.LabOrder) (*models.LabOrder, error) {
-	if err := r.db.Create(order).Error; err != nil {
+func (r *LabRepository) CreateLabOrder(ctx context.Context, order *models.LabOrder) (*models.LabOrder, error) {
+	if err := r.db.WithContext(ctx).Create(order).Error; err != nil {
 		return nil, err
 	}
 	return order, nil
@@ -58,24 +55,20 @@ func (r *LabRepository) FindLabOrderByID(id uint) (*models.LabOrder, error) {
 	return &order, nil
 }
 
-func (r *LabRepository) ListLabOrdersByPatient(patientID uint) ([]*models.LabOrder, error) {
-	var orders []*models.LabOrder
-	if err := r.db.Preload("Results").Where("patient_id = ?", patientID).Order("order_date DESC").Find(&orders).Error; err != nil {
-		return nil, err
-	}
-	return orders, nil
+func (r *LabRepository) ListLabOrdersByPatient(patientID uint, q ListQuery) (*Page[models.LabOrder], error) {
+	return Paginate[models.LabOrder](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-order_date", Preloads: []string{"Results"}}, q)
 }
 
 // Lab Result methods
-func (r *LabRepository) CreateLabResult(result *models.LabResult) (*models.LabResult, error) {
-	if err := r.db.Create(result).Error; err != nil {
+func (r *LabRepository) CreateLabResult(ctx context.Context, result *models.LabResult) (*models.LabResult, error) {
+	if err := r.db.WithContext(ctx).Create(result).Error; err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (r *LabRepository) UpdateLabResult(result *models.LabResult) (*models.LabResult, error) {
-	if err := r.db.Save(result).Error; err != nil {
+func (r *LabRepository) UpdateLabResult(ctx context.Context, result *models.LabResult) (*models.LabResult, error) {
+	if err := r.db.WithContext(ctx).Save(result).Error; err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -0,0 +1,450 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Page sizes of list endpoints
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// ErrInvalidListQuery is wrapped by the errors of a list request that names an
+// unknown field, has a malformed value or carries a stale cursor
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+func invalidListf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidListQuery, fmt.Sprintf(format, args...))
+}
+
+// ListQuery asks for one page of a list. Fields are named as in the items'
+// JSON.
+type ListQuery struct {
+	Cursor  string // next_cursor of the previous page; empty for the first page
+	Limit   int
+	Sort    []SortField // empty for the list's default order
+	Filters []ListFilter
+	Fields  []string // sparse field selection; empty for every field
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListFilter compares a field with values. Op is eq or ne (several values
+// mean any of them), gt, gte, lt, lte, or null with "true" or "false".
+type ListFilter struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+var listOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=", "null": "",
+}
+
+// Page is one page of a list and the response envelope of list endpoints.
+// NextCursor is empty on the last page.
+type Page[T any] struct {
+	Data       []*T   `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	Total      int64  `json:"total"`
+}
+
+// ListSpec describes a list endpoint
+type ListSpec struct {
+	// Default order, in the sort parameter's syntax, e.g. "-start_date"
+	Sort string
+	// Associations loaded with each item, e.g. "Medication" or "Results.LabTest"
+	Preloads []string
+}
+
+// ParseListQuery reads the list parameters: cursor, limit, sort (comma
+// separated fields, "-" for descending), fields (comma separated) and filters.
+// A filter is a parameter named after a field, field=value or
+// field[op]=value; comma separated values match any of them. params are
+// parameters the endpoint handles itself, which are not filters.
+func ParseListQuery(values url.Values, params ...string) (ListQuery, error) {
+	q := ListQuery{Cursor: values.Get("cursor"), Limit: DefaultListLimit}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return q, invalidListf("limit must be a positive number")
+		}
+		q.Limit = min(limit, MaxListLimit)
+	}
+	q.Sort = parseSort(values.Get("sort"))
+	if raw := values.Get("fields"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				q.Fields = append(q.Fields, field)
+			}
+		}
+	}
+
+	reserved := map[string]bool{"cursor": true, "limit": true, "sort": true, "fields": true}
+	for _, param := range params {
+		reserved[param] = true
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if reserved[key] {
+			continue
+		}
+		field, op := key, "eq"
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			field, op = key[:i], key[i+1:len(key)-1]
+		}
+		if _, ok := listOperators[op]; !ok {
+			return q, invalidListf("unknown filter operator %q", op)
+		}
+		filter := ListFilter{Field: field, Op: op}
+		for _, value := range values[key] {
+			filter.Values = append(filter.Values, strings.Split(value, ",")...)
+		}
+		if len(filter.Values) > 1 && op != "eq" && op != "ne" {
+			return q, invalidListf("%s takes a single value", key)
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+	return q, nil
+}
+
+func parseSort(raw string) []SortField {
+	var fields []SortField
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		desc := strings.HasPrefix(part, "-")
+		fields = append(fields, SortField{Field: strings.TrimPrefix(part, "-"), Desc: desc})
+	}
+	return fields
+}
+
+// listField is a field of a list's items that the query can refer to
+type listField struct {
+	column   string // column name; empty for associations
+	typ      reflect.Type
+	nullable bool
+	relation *schema.Relationship
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+)
+
+// comparable reports if the field's values can be filtered on and ordered
+func (f *listField) comparable() bool {
+	if f.column == "" {
+		return false
+	}
+	if f.typ == timeType || f.typ.ConvertibleTo(nullTimeType) {
+		return true
+	}
+	switch f.typ.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// parse converts a filter value to the field's type, so malformed values are
+// rejected before they reach the database
+func (f *listField) parse(raw string) (interface{}, error) {
+	if f.typ == timeType || f.typ.ConvertibleTo(nullTimeType) {
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", raw)
+	}
+	switch f.typ.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	default:
+		return strconv.ParseUint(raw, 10, 64)
+	}
+}
+
+// listFields maps the JSON names of a model's fields to its columns and associations
+func listFields(sch *schema.Schema) map[string]*listField {
+	fields := map[string]*listField{}
+	for _, f := range sch.Fields {
+		name := jsonName(f.StructField)
+		if name == "" || f.DBName == "" {
+			continue
+		}
+		typ := f.FieldType
+		nullable := typ.Kind() == reflect.Ptr
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		fields[name] = &listField{column: f.DBName, typ: typ, nullable: nullable || typ.ConvertibleTo(nullTimeType)}
+	}
+	for _, rel := range sch.Relationships.Relations {
+		if name := jsonName(rel.Field.StructField); name != "" {
+			fields[name] = &listField{typ: rel.Field.FieldType, relation: rel}
+		}
+	}
+	return fields
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func encodeCursor(id interface{}) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprint(id)))
+}
+
+func decodeCursor(cursor string) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalidListf("malformed cursor")
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, invalidListf("malformed cursor")
+	}
+	return id, nil
+}
+
+// Paginate loads one page of the rows of query, which selects from T's table
+// and holds the conditions of the endpoint itself, such as the patient.
+// Filters, order, the cursor and the selected columns are all applied in SQL.
+//
+// Pages are cut by keyset rather than offset: the cursor is the last row's
+// primary key, and the next page starts after that row's sort values, so
+// rows added meanwhile do not shift the pages. Only columns that are never
+// NULL can be sorted on, and the primary key breaks ties.
+func Paginate[T any](query *gorm.DB, spec ListSpec, q ListQuery) (*Page[T], error) {
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	sch := stmt.Schema
+	table := sch.Table
+	primary := sch.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, fmt.Errorf("%s has no primary key", table)
+	}
+	fields := listFields(sch)
+	column := func(name string) string {
+		return stmt.Quote(clause.Column{Table: table, Name: name})
+	}
+
+	query = query.Model(new(T))
+	for _, filter := range q.Filters {
+		field, ok := fields[filter.Field]
+		if !ok || !field.comparable() {
+			return nil, invalidListf("cannot filter on %q", filter.Field)
+		}
+		if filter.Op == "null" {
+			isNull, err := strconv.ParseBool(filter.Values[0])
+			if err != nil {
+				return nil, invalidListf("%s[null] must be true or false", filter.Field)
+			}
+			if isNull {
+				query = query.Where(column(field.column) + " IS NULL")
+			} else {
+				query = query.Where(column(field.column) + " IS NOT NULL")
+			}
+			continue
+		}
+		values := make([]interface{}, len(filter.Values))
+		for i, raw := range filter.Values {
+			value, err := field.parse(raw)
+			if err != nil {
+				return nil, invalidListf("invalid value %q for %s", raw, filter.Field)
+			}
+			values[i] = value
+		}
+		switch {
+		case len(values) > 1 && filter.Op == "eq":
+			query = query.Where(column(field.column)+" IN ?", values)
+		case len(values) > 1:
+			query = query.Where(column(field.column)+" NOT IN ?", values)
+		default:
+			query = query.Where(column(field.column)+" "+listOperators[filter.Op]+" ?", values[0])
+		}
+	}
+
+	// Order by the sort fields, then by primary key in the direction of the last one
+	sorts := q.Sort
+	if len(sorts) == 0 {
+		sorts = parseSort(spec.Sort)
+	}
+	type orderColumn struct {
+		name string
+		desc bool
+	}
+	var order []orderColumn
+	for _, s := range sorts {
+		field, ok := fields[s.Field]
+		if !ok || !field.comparable() || field.nullable {
+			return nil, invalidListf("cannot sort on %q", s.Field)
+		}
+		if field.column != primary.DBName {
+			order = append(order, orderColumn{field.column, s.Desc})
+		}
+	}
+	lastDesc := len(order) > 0 && order[len(order)-1].desc
+	order = append(order, orderColumn{primary.DBName, lastDesc})
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	if q.Cursor != "" {
+		id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var exists int64
+		if err := query.Session(&gorm.Session{NewDB: true}).Unscoped().Model(new(T)).
+			Where(column(primary.DBName)+" = ?", id).Count(&exists).Error; err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, invalidListf("cursor refers to a row that no longer exists")
+		}
+
+		// Rows after the cursor row: the first differing sort value decides
+		var after []string
+		var args []interface{}
+		for i, col := range order {
+			var terms []string
+			for _, prev := range order[:i+1] {
+				op := "="
+				if prev == col {
+					op = ">"
+					if col.desc {
+						op = "<"
+					}
+				}
+				terms = append(terms, fmt.Sprintf("%s %s (SELECT cursor_row.%s FROM %s AS cursor_row WHERE cursor_row.%s = ?)",
+					column(prev.name), op, stmt.Quote(prev.name), stmt.Quote(table), stmt.Quote(primary.DBName)))
+				args = append(args, id)
+			}
+			after = append(after, "("+strings.Join(terms, " AND ")+")")
+		}
+		query = query.Where("("+strings.Join(after, " OR ")+")", args...)
+	}
+
+	// Sparse fields: select only their columns, plus the primary key and the
+	// sort columns, and load only the associations asked for
+	preloads := spec.Preloads
+	if len(q.Fields) > 0 {
+		selected := map[string]bool{}
+		columns := []string{}
+		add := func(name string) {
+			if !selected[name] {
+				selected[name] = true
+				columns = append(columns, name)
+			}
+		}
+		for _, col := range order {
+			add(col.name)
+		}
+		wanted := map[string]bool{}
+		for _, name := range q.Fields {
+			field, ok := fields[name]
+			if !ok {
+				return nil, invalidListf("unknown field %q", name)
+			}
+			if field.column != "" {
+				add(field.column)
+				continue
+			}
+			if !containsPreload(spec.Preloads, field.relation.Name) {
+				return nil, invalidListf("field %q is not available in this list", name)
+			}
+			wanted[field.relation.Name] = true
+			for _, ref := range field.relation.References {
+				if ref.ForeignKey.Schema == sch {
+					add(ref.ForeignKey.DBName)
+				} else if ref.PrimaryKey != nil && ref.PrimaryKey.Schema == sch {
+					add(ref.PrimaryKey.DBName)
+				}
+			}
+		}
+		query = query.Select(columns)
+		preloads = nil
+		for _, preload := range spec.Preloads {
+			if wanted[strings.Split(preload, ".")[0]] {
+				preloads = append(preloads, preload)
+			}
+		}
+	}
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+
+	orderBy := clause.OrderBy{}
+	for _, col := range order {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Table: table, Name: col.name}, Desc: col.desc})
+	}
+	limit := q.Limit
+	if limit < 1 {
+		limit = DefaultListLimit
+	}
+
+	page := &Page[T]{Data: []*T{}, Total: total}
+	if err := query.Clauses(orderBy).Limit(limit + 1).Find(&page.Data).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		id, _ := primary.ValueOf(context.Background(), reflect.ValueOf(page.Data[limit-1]))
+		page.NextCursor = encodeCursor(id)
+	}
+	return page, nil
+}
+
+func containsPreload(preloads []string, name string) bool {
+	for _, preload := range preloads {
+		if strings.Split(preload, ".")[0] == name {
+			return true
+		}
+	}
+	return false
+}
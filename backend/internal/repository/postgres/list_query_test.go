@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/clause"
+)
+
+func TestParseListQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		params  []string
+		want    ListQuery
+		wantErr bool
+	}{
+		{"defaults", "", nil, ListQuery{Limit: DefaultListLimit}, false},
+		{"limit is capped", "limit=500", nil, ListQuery{Limit: MaxListLimit}, false},
+		{"sort and fields", "sort=-period_start,status&fields=id,+status", nil, ListQuery{
+			Limit:  DefaultListLimit,
+			Sort:   []SortField{{"period_start", true}, {"status", false}},
+			Fields: []string{"id", "status"},
+		}, false},
+		{"filters in name order", "status=planned,arrived&period_start[gte]=2024-01-01&cursor=MTI", nil, ListQuery{
+			Cursor: "MTI",
+			Limit:  DefaultListLimit,
+			Filters: []ListFilter{
+				{Field: "period_start", Op: "gte", Values: []string{"2024-01-01"}},
+				{Field: "status", Op: "eq", Values: []string{"planned", "arrived"}},
+			},
+		}, false},
+		{"endpoint parameters are not filters", "q=rahim&status=planned", []string{"q"}, ListQuery{
+			Limit:   DefaultListLimit,
+			Filters: []ListFilter{{Field: "status", Op: "eq", Values: []string{"planned"}}},
+		}, false},
+		{"zero limit", "limit=0", nil, ListQuery{}, true},
+		{"unknown operator", "status[like]=pl", nil, ListQuery{}, true},
+		{"range with several values", "period_start[gt]=2024-01-01,2024-02-01", nil, ListQuery{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			got, err := ParseListQuery(values, tt.params...)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidListQuery)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPaginateRejectsInvalidQueries(t *testing.T) {
+	db := dryRunDB(t)
+
+	tests := []struct {
+		name string
+		q    ListQuery
+	}{
+		{"unknown filter", ListQuery{Filters: []ListFilter{{Field: "colour", Op: "eq", Values: []string{"red"}}}}},
+		{"malformed filter value", ListQuery{Filters: []ListFilter{{Field: "period_start", Op: "gte", Values: []string{"yesterday"}}}}},
+		{"filter on an association", ListQuery{Filters: []ListFilter{{Field: "patient", Op: "eq", Values: []string{"1"}}}}},
+		{"sort on a nullable column", ListQuery{Sort: []SortField{{Field: "period_end"}}}},
+		{"malformed cursor", ListQuery{Cursor: "not a cursor"}},
+		{"unknown field", ListQuery{Fields: []string{"colour"}}},
+		{"association that is not loaded", ListQuery{Fields: []string{"patient"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Paginate[models.Encounter](db, ListSpec{Sort: "-period_start"}, tt.q)
+			assert.ErrorIs(t, err, ErrInvalidListQuery)
+		})
+	}
+}
+
+// TestPaginateAcrossTies pages through encounters whose sort values tie, so
+// the primary key has to decide where each page ends
+func TestPaginateAcrossTies(t *testing.T) {
+	db := openTestDB(t)
+	patient := createTestPatient(t, db, "paging")
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	var encounters []*models.Encounter
+	for i, hour := range []int{0, 2, 2, 2, 1, 2, 0} {
+		status := models.EncounterStatusFinished
+		if i%2 == 0 {
+			status = models.EncounterStatusArrived
+		}
+		encounter := &models.Encounter{PatientID: patient.ID, Status: status, Class: "AMB", PeriodStart: start.Add(time.Duration(hour) * time.Hour)}
+		require.NoError(t, db.Omit(clause.Associations).Create(encounter).Error)
+		encounters = append(encounters, encounter)
+	}
+
+	tests := []struct {
+		name string
+		sort []SortField
+		less func(a, b *models.Encounter) bool
+	}{
+		{"default order", nil, func(a, b *models.Encounter) bool {
+			if !a.PeriodStart.Equal(b.PeriodStart) {
+				return a.PeriodStart.After(b.PeriodStart)
+			}
+			return a.ID > b.ID
+		}},
+		{"ascending", []SortField{{Field: "period_start"}}, func(a, b *models.Encounter) bool {
+			if !a.PeriodStart.Equal(b.PeriodStart) {
+				return a.PeriodStart.Before(b.PeriodStart)
+			}
+			return a.ID < b.ID
+		}},
+		{"two fields", []SortField{{Field: "status"}, {Field: "period_start", Desc: true}}, func(a, b *models.Encounter) bool {
+			if a.Status != b.Status {
+				return a.Status < b.Status
+			}
+			if !a.PeriodStart.Equal(b.PeriodStart) {
+				return a.PeriodStart.After(b.PeriodStart)
+			}
+			return a.ID > b.ID
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := append([]*models.Encounter{}, encounters...)
+			sort.Slice(want, func(i, j int) bool { return tt.less(want[i], want[j]) })
+			var wantIDs []uint
+			for _, e := range want {
+				wantIDs = append(wantIDs, e.ID)
+			}
+
+			var gotIDs []uint
+			q := ListQuery{Limit: 2, Sort: tt.sort}
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, len(encounters), "paging does not end")
+				page, err := Paginate[models.Encounter](db.Where("patient_id = ?", patient.ID), ListSpec{Sort: "-period_start"}, q)
+				require.NoError(t, err)
+				assert.Equal(t, int64(len(encounters)), page.Total)
+				for _, e := range page.Data {
+					gotIDs = append(gotIDs, e.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				q.Cursor = page.NextCursor
+			}
+			assert.Equal(t, wantIDs, gotIDs)
+		})
+	}
+}
+
+func TestPaginateRejectsStaleCursor(t *testing.T) {
+	db := openTestDB(t)
+	patient := createTestPatient(t, db, "stale")
+	for i := 0; i < 3; i++ {
+		encounter := &models.Encounter{PatientID: patient.ID, Status: models.EncounterStatusArrived, Class: "AMB", PeriodStart: time.Now()}
+		require.NoError(t, db.Omit(clause.Associations).Create(encounter).Error)
+	}
+
+	page, err := Paginate[models.Encounter](db, ListSpec{Sort: "-period_start"}, ListQuery{Limit: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.NextCursor)
+	require.NoError(t, db.Unscoped().Delete(page.Data[0]).Error)
+
+	_, err = Paginate[models.Encounter](db, ListSpec{Sort: "-period_start"}, ListQuery{Limit: 1, Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidListQuery)
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
@@ -16,8 +17,8 @@ func NewMedicationRepository(db *gorm.DB) *MedicationRepository {
 }
 
 // Medication methods
-func (r *MedicationRepository) CreateMedication(med *models.Medication) (*models.Medication, error) {
-	if err := r.db.Create(med).Error; err != nil {
+func (r *MedicationRepository) CreateMedication(ctx context.Context, med *models.Medication) (*models.Medication, error) {
+	if err := r.db.WithContext(ctx).Create(med).Error; err != nil {
 		return nil, err
 	}
 	return med, nil
@@ -44,8 +45,8 @@ func (r *MedicationRepository) SearchMedications(query string) ([]*models.Medica
 }
 
 // Prescription methods
-func (r *MedicationRepository) CreatePrescription(prescription *models.Prescription) (*models.Prescription, error) {
-	if err := r.db.Create(prescription).Error; err != nil {
+func (r *MedicationRepository) CreatePrescription(ctx context.Context, prescription *models.Prescription) (*models.Prescription, error) {
+	if err := r.db.WithContext(ctx).Create(prescription).Error; err != nil {
 		return nil, err
 	}
 	return prescription, nil
@@ -62,19 +63,15 @@ func (r *MedicationRepository) FindPrescriptionByID(id uint) (*models.Prescripti
 	return &prescription, nil
 }
 
-func (r *MedicationRepository) UpdatePrescription(prescription *models.Prescription) (*models.Prescription, error) {
-	if err := r.db.Save(prescription).Error; err != nil {
+func (r *MedicationRepository) UpdatePrescription(ctx context.Context, prescription *models.Prescription) (*models.Prescription, error) {
+	if err := r.db.WithContext(ctx).Save(prescription).Error; err != nil {
 		return nil, err
 	}
 	return prescription, nil
 }
 
-func (r *MedicationRepository) ListPrescriptionsByPatient(patientID uint) ([]*models.Prescription, error) {
-	var prescriptions []*models.Prescription
-	if err := r.db.Preload("Medication").Where("patient_id = ?", patientID).Order("start_date DESC").Find(&prescriptions).Error; err != nil {
-		return nil, err
-	}
-	return prescriptions, nil
+func (r *MedicationRepository) ListPrescriptionsByPatient(patientID uint, q ListQuery) (*Page[models.Prescription], error) {
+	return Paginate[models.Prescription](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-start_date", Preloads: []string{"Medication"}}, q)
 }
 
 func (r *MedicationRepository) ListActivePrescriptions(patientID uint) ([]*models.Prescription, error) {
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NCDScreeningRepository struct {
+	db *gorm.DB
+}
+
+func NewNCDScreeningRepository(db *gorm.DB) *NCDScreeningRepository {
+	return &NCDScreeningRepository{db: db}
+}
+
+func (r *NCDScreeningRepository) Create(ctx context.Context, screening *models.NCDScreening) (*models.NCDScreening, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Create(screening).Error; err != nil {
+		return nil, err
+	}
+	return screening, nil
+}
+
+func (r *NCDScreeningRepository) FindByID(id uint) (*models.NCDScreening, error) {
+	var screening models.NCDScreening
+	if err := r.db.First(&screening, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &screening, nil
+}
+
+func (r *NCDScreeningRepository) FindByEncounter(encounterID uint) (*models.NCDScreening, error) {
+	var screening models.NCDScreening
+	if err := r.db.Where("encounter_id = ?", encounterID).First(&screening).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &screening, nil
+}
+
+func (r *NCDScreeningRepository) Update(ctx context.Context, screening *models.NCDScreening) (*models.NCDScreening, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(screening).Error; err != nil {
+		return nil, err
+	}
+	return screening, nil
+}
+
+// List returns a page of screenings, latest first
+func (r *NCDScreeningRepository) List(q ListQuery) (*Page[models.NCDScreening], error) {
+	return Paginate[models.NCDScreening](r.db, ListSpec{Sort: "-screened_at"}, q)
+}
+
+// ListByPatient returns a page of a patient's screenings, latest first
+func (r *NCDScreeningRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.NCDScreening], error) {
+	return Paginate[models.NCDScreening](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-screened_at"}, q)
+}
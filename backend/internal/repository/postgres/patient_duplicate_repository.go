@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PatientDuplicateRepository struct {
+	db *gorm.DB
+}
+
+func NewPatientDuplicateRepository(db *gorm.DB) *PatientDuplicateRepository {
+	return &PatientDuplicateRepository{db: db}
+}
+
+// CreateAll queues duplicate pairs; pairs already queued are left as they are
+func (r *PatientDuplicateRepository) CreateAll(ctx context.Context, duplicates []*models.PatientDuplicate) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&duplicates).Error
+}
+
+func (r *PatientDuplicateRepository) FindByID(id uint) (*models.PatientDuplicate, error) {
+	var duplicate models.PatientDuplicate
+	if err := r.db.Preload("Patient").Preload("Candidate").First(&duplicate, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &duplicate, nil
+}
+
+func (r *PatientDuplicateRepository) Update(ctx context.Context, duplicate *models.PatientDuplicate) (*models.PatientDuplicate, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(duplicate).Error; err != nil {
+		return nil, err
+	}
+	return duplicate, nil
+}
+
+// List returns the review queue, highest scores first
+func (r *PatientDuplicateRepository) List(status string, offset, limit int) ([]*models.PatientDuplicate, int64, error) {
+	var duplicates []*models.PatientDuplicate
+	var total int64
+
+	query := r.db.Model(&models.PatientDuplicate{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Preload("Patient").Preload("Candidate").
+		Order("score DESC, id ASC").Offset(offset).Limit(limit).
+		Find(&duplicates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return duplicates, total, nil
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMergeConflict is returned when a patient was merged or unmerged by
+// someone else while the merge was being applied
+var ErrMergeConflict = errors.New("patient record was changed by another merge")
+
+type PatientMergeRepository struct {
+	db *gorm.DB
+}
+
+func NewPatientMergeRepository(db *gorm.DB) *PatientMergeRepository {
+	return &PatientMergeRepository{db: db}
+}
+
+func (r *PatientMergeRepository) FindByID(id uint) (*models.PatientMerge, error) {
+	var merge models.PatientMerge
+	if err := r.db.First(&merge, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &merge, nil
+}
+
+// ListByPatient returns the merges a patient took part in, newest first
+func (r *PatientMergeRepository) ListByPatient(patientID uint) ([]*models.PatientMerge, error) {
+	var merges []*models.PatientMerge
+	if err := r.db.Where("survivor_id = ? OR merged_id = ?", patientID, patientID).
+		Order("merged_at DESC").Find(&merges).Error; err != nil {
+		return nil, err
+	}
+	return merges, nil
+}
+
+// patientReference is a column holding a patient ID. key names it in
+// MovedRecords: the table for patient_id, "table.column" otherwise.
+type patientReference struct {
+	key, table, column string
+}
+
+func patientReferences() []patientReference {
+	refs := make([]patientReference, 0, len(models.PatientMergeTables)+len(models.PatientMergeColumns))
+	for _, table := range models.PatientMergeTables {
+		refs = append(refs, patientReference{key: table, table: table, column: "patient_id"})
+	}
+	for _, key := range models.PatientMergeColumns {
+		table, column, _ := strings.Cut(key, ".")
+		refs = append(refs, patientReference{key: key, table: table, column: column})
+	}
+	return refs
+}
+
+// Merge moves every row of models.PatientMergeTables and PatientMergeColumns
+// from the merged patient to the survivor, soft deletes the moved rows that
+// duplicate the survivor's (models.PatientMergeDuplicates), retires the merged
+// patient and stores the merge record, all in one transaction. The moved and
+// deleted row IDs are stored on the merge for Unmerge.
+func (r *PatientMergeRepository) Merge(ctx context.Context, merge *models.PatientMerge) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock both patients so concurrent merges of the same records serialize
+		var patients []*models.Patient
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []uint{merge.SurvivorID, merge.MergedID}).
+			Find(&patients).Error; err != nil {
+			return err
+		}
+		if len(patients) != 2 {
+			return ErrNotFound
+		}
+		for _, patient := range patients {
+			if patient.MergedIntoID != nil {
+				return ErrMergeConflict
+			}
+		}
+
+		now := time.Now()
+		moved := map[string][]uint{}
+		for _, ref := range patientReferences() {
+			var ids []uint
+			if err := tx.Table(ref.table).Where(ref.column+" = ?", merge.MergedID).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			if err := tx.Table(ref.table).Where("id IN ?", ids).
+				Updates(map[string]interface{}{ref.column: merge.SurvivorID, "updated_at": now}).Error; err != nil {
+				return err
+			}
+			moved[ref.key] = ids
+		}
+
+		superseded := map[string][]uint{}
+		for table, duplicate := range models.PatientMergeDuplicates {
+			ids, err := supersede(tx, table, duplicate, merge.SurvivorID, moved[table], now)
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				superseded[table] = ids
+			}
+		}
+		if err := syncPhotoURL(tx, merge.SurvivorID, now); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Patient{}).Where("id = ?", merge.MergedID).
+			UpdateColumns(map[string]interface{}{"active": false, "merged_into_id": merge.SurvivorID, "updated_at": now}).Error; err != nil {
+			return err
+		}
+
+		// The pair is resolved in the duplicate review queue
+		if err := tx.Model(&models.PatientDuplicate{}).
+			Where("status = ?", models.DuplicateStatusOpen).
+			Where("(patient_id = ? AND candidate_id = ?) OR (patient_id = ? AND candidate_id = ?)",
+				merge.SurvivorID, merge.MergedID, merge.MergedID, merge.SurvivorID).
+			Updates(map[string]interface{}{
+				"status":      models.DuplicateStatusMerged,
+				"reviewed_by": merge.MergedBy,
+				"reviewed_at": now,
+				"updated_at":  now,
+			}).Error; err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(moved)
+		if err != nil {
+			return err
+		}
+		merge.MovedRecords = string(encoded)
+		if len(superseded) > 0 {
+			if encoded, err = json.Marshal(superseded); err != nil {
+				return err
+			}
+			merge.SupersededRecords = string(encoded)
+		}
+		merge.MergedAt = now
+		return tx.Omit(clause.Associations).Create(merge).Error
+	})
+}
+
+// supersede soft deletes the rows of table moved to the survivor that
+// duplicate, by the duplicate condition, a row the survivor already held, and
+// returns their IDs
+func supersede(tx *gorm.DB, table, duplicate string, survivorID uint, moved []uint, now time.Time) ([]uint, error) {
+	var ids []uint
+	if len(moved) == 0 {
+		return ids, nil
+	}
+	err := tx.Table(table).Where("id IN ? AND deleted_at IS NULL", moved).
+		Where("EXISTS (SELECT 1 FROM "+table+" kept WHERE kept.patient_id = ? AND kept.id NOT IN ? AND kept.deleted_at IS NULL AND "+duplicate+")",
+			survivorID, moved).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+	return ids, tx.Table(table).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"deleted_at": now, "updated_at": now}).Error
+}
+
+// syncPhotoURL points a patient without a photo URL at the photo a merge
+// moved to them, and clears the URL once an unmerge took the photo back.
+// Other URLs, such as inline legacy photos, are left alone.
+func syncPhotoURL(tx *gorm.DB, patientID uint, now time.Time) error {
+	url := models.PatientPhotoURL(patientID)
+	hasPhoto := "EXISTS (SELECT 1 FROM patient_photos WHERE patient_id = patients.id AND deleted_at IS NULL)"
+	if err := tx.Model(&models.Patient{}).Where("id = ? AND coalesce(photo_url, '') = '' AND "+hasPhoto, patientID).
+		UpdateColumns(map[string]interface{}{"photo_url": url, "updated_at": now}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Patient{}).Where("id = ? AND photo_url = ? AND NOT "+hasPhoto, patientID, url).
+		UpdateColumns(map[string]interface{}{"photo_url": "", "updated_at": now}).Error
+}
+
+// Unmerge moves the rows recorded on the merge back to the merged patient,
+// restores the duplicates the merge soft deleted and reactivates it. Rows
+// added to the survivor after the merge stay with the survivor.
+func (r *PatientMergeRepository) Unmerge(ctx context.Context, merge *models.PatientMerge, unmergedBy uint, reason string) error {
+	moved, err := merge.Moved()
+	if err != nil {
+		return err
+	}
+	superseded, err := merge.Superseded()
+	if err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		restored := tx.Model(&models.Patient{}).
+			Where("id = ? AND merged_into_id = ?", merge.MergedID, merge.SurvivorID).
+			UpdateColumns(map[string]interface{}{"active": true, "merged_into_id": nil, "updated_at": now})
+		if restored.Error != nil {
+			return restored.Error
+		}
+		if restored.RowsAffected == 0 {
+			return ErrMergeConflict
+		}
+
+		// Only known tables are touched, whatever the stored JSON says
+		for _, ref := range patientReferences() {
+			ids := moved[ref.key]
+			if len(ids) == 0 {
+				continue
+			}
+			if err := tx.Table(ref.table).Where("id IN ? AND "+ref.column+" = ?", ids, merge.SurvivorID).
+				Updates(map[string]interface{}{ref.column: merge.MergedID, "updated_at": now}).Error; err != nil {
+				return err
+			}
+		}
+		for table := range models.PatientMergeDuplicates {
+			ids := superseded[table]
+			if len(ids) == 0 {
+				continue
+			}
+			if err := tx.Table(table).Where("id IN ? AND patient_id = ?", ids, merge.MergedID).
+				Updates(map[string]interface{}{"deleted_at": nil, "updated_at": now}).Error; err != nil {
+				return err
+			}
+		}
+		if err := syncPhotoURL(tx, merge.SurvivorID, now); err != nil {
+			return err
+		}
+
+		// The pair goes back to the review queue
+		if err := tx.Model(&models.PatientDuplicate{}).
+			Where("status = ?", models.DuplicateStatusMerged).
+			Where("(patient_id = ? AND candidate_id = ?) OR (patient_id = ? AND candidate_id = ?)",
+				merge.SurvivorID, merge.MergedID, merge.MergedID, merge.SurvivorID).
+			Updates(map[string]interface{}{
+				"status":      models.DuplicateStatusOpen,
+				"reviewed_by": nil,
+				"reviewed_at": nil,
+				"updated_at":  now,
+			}).Error; err != nil {
+			return err
+		}
+
+		merge.UnmergedAt = &now
+		merge.UnmergedBy = &unmergedBy
+		merge.UnmergeReason = reason
+		return tx.Omit(clause.Associations).Save(merge).Error
+	})
+}
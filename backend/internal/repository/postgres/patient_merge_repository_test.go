@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestPatientMergeAndUnmerge(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPatientMergeRepository(db)
+
+	survivor := createTestPatient(t, db, "survivor")
+	merged := createTestPatient(t, db, "merged")
+	now := time.Now()
+
+	encounter := &models.Encounter{PatientID: merged.ID, Status: "finished", Class: "AMB", PeriodStart: now}
+	require.NoError(t, db.Omit(clause.Associations).Create(encounter).Error)
+	dispensing := &models.Dispensing{PatientID: merged.ID, PrescriptionID: 1, MedicationID: 1, QuantityDispensed: 10, DispensedAt: now}
+	require.NoError(t, db.Omit(clause.Associations).Create(dispensing).Error)
+	later := &models.Encounter{PatientID: survivor.ID, Status: "finished", Class: "AMB", PeriodStart: now}
+	require.NoError(t, db.Omit(clause.Associations).Create(later).Error)
+
+	merge := &models.PatientMerge{SurvivorID: survivor.ID, MergedID: merged.ID, MergedMRN: merged.MRN, MergedBy: 1}
+	require.NoError(t, repo.Merge(context.Background(), merge))
+
+	moved, err := merge.Moved()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]uint{
+		models.Encounter{}.TableName():         {encounter.ID},
+		models.Dispensing{}.TableName():        {dispensing.ID},
+		models.PatientIdentifier{}.TableName(): {merged.Identifiers[0].ID},
+	}, moved)
+	assertPatientOf(t, db, models.Encounter{}.TableName(), encounter.ID, survivor.ID)
+	assertPatientOf(t, db, models.Dispensing{}.TableName(), dispensing.ID, survivor.ID)
+
+	var retired models.Patient
+	require.NoError(t, db.First(&retired, merged.ID).Error)
+	assert.False(t, retired.Active)
+	require.NotNil(t, retired.MergedIntoID)
+	assert.Equal(t, survivor.ID, *retired.MergedIntoID)
+
+	// A merged patient cannot be merged again
+	again := &models.PatientMerge{SurvivorID: survivor.ID, MergedID: merged.ID, MergedMRN: merged.MRN}
+	assert.ErrorIs(t, repo.Merge(context.Background(), again), ErrMergeConflict)
+
+	require.NoError(t, repo.Unmerge(context.Background(), merge, 1, "wrong patient"))
+	assertPatientOf(t, db, models.Encounter{}.TableName(), encounter.ID, merged.ID)
+	assertPatientOf(t, db, models.Dispensing{}.TableName(), dispensing.ID, merged.ID)
+	assertPatientOf(t, db, models.Encounter{}.TableName(), later.ID, survivor.ID)
+
+	var restored models.Patient
+	require.NoError(t, db.First(&restored, merged.ID).Error)
+	assert.True(t, restored.Active)
+	assert.Nil(t, restored.MergedIntoID)
+
+	stored, err := repo.FindByID(merge.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsActive())
+	assert.ErrorIs(t, repo.Unmerge(context.Background(), stored, 1, "again"), ErrMergeConflict)
+}
+
+// TestPatientMergeIdentifiers checks the duplicate's identifiers find the
+// survivor after a merge, an identifier both records hold is kept once, and
+// unmerge gives every identifier back
+func TestPatientMergeIdentifiers(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPatientMergeRepository(db)
+	patients := NewPatientRepository(db)
+	ctx := context.Background()
+
+	survivor := createTestPatient(t, db, "survivor")
+	merged := createTestPatient(t, db, "merged")
+	addIdentifier := func(patientID uint, system, value string) *models.PatientIdentifier {
+		identifier := &models.PatientIdentifier{PatientID: patientID, System: system, Value: value}
+		require.NoError(t, db.Create(identifier).Error)
+		return identifier
+	}
+	addIdentifier(survivor.ID, models.IdentifierSystemUNHCR, "CXB-123456")
+	shared := addIdentifier(merged.ID, models.IdentifierSystemUNHCR, "CXB-123456")
+	addIdentifier(merged.ID, models.IdentifierSystemFCN, "FCN-987654")
+
+	// holders returns the IDs of the patients found by an identifier
+	holders := func(system, value string) []uint {
+		t.Helper()
+		found, err := patients.FindByIdentifier(system, []string{value})
+		require.NoError(t, err)
+		ids := make([]uint, len(found))
+		for i, patient := range found {
+			ids[i] = patient.ID
+		}
+		return ids
+	}
+
+	merge := &models.PatientMerge{SurvivorID: survivor.ID, MergedID: merged.ID, MergedMRN: merged.MRN, MergedBy: 1}
+	require.NoError(t, repo.Merge(ctx, merge))
+
+	assert.Equal(t, []uint{survivor.ID}, holders(models.IdentifierSystemUNHCR, "CXB-123456"))
+	assert.Equal(t, []uint{survivor.ID}, holders(models.IdentifierSystemFCN, "FCN-987654"))
+	assert.Equal(t, []uint{survivor.ID}, holders(models.IdentifierSystemMRN, merged.MRN))
+	var held int64
+	require.NoError(t, db.Model(&models.PatientIdentifier{}).
+		Where("patient_id = ? AND system = ?", survivor.ID, models.IdentifierSystemUNHCR).Count(&held).Error)
+	assert.EqualValues(t, 1, held, "the shared identifier is kept once")
+
+	superseded, err := merge.Superseded()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]uint{models.PatientIdentifier{}.TableName(): {shared.ID}}, superseded)
+
+	stored, err := repo.FindByID(merge.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Unmerge(ctx, stored, 1, "wrong patient"))
+
+	assert.Equal(t, []uint{survivor.ID, merged.ID}, holders(models.IdentifierSystemUNHCR, "CXB-123456"))
+	assert.Equal(t, []uint{merged.ID}, holders(models.IdentifierSystemFCN, "FCN-987654"))
+	assert.Equal(t, []uint{merged.ID}, holders(models.IdentifierSystemMRN, merged.MRN))
+}
+
+// TestPatientMergePhotos checks which photo is current after a merge and an
+// unmerge: the survivor's wins, and a survivor without one takes the duplicate's
+func TestPatientMergePhotos(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPatientMergeRepository(db)
+	photos := NewPatientPhotoRepository(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name                    string
+		survivorPhoto, dupPhoto bool
+	}{
+		{"both have a photo", true, true},
+		{"only the duplicate has a photo", false, true},
+		{"only the survivor has a photo", true, false},
+		{"neither has a photo", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			survivor := createTestPatient(t, db, "survivor")
+			merged := createTestPatient(t, db, "merged")
+			upload := func(patientID uint) *models.PatientPhoto {
+				photo := &models.PatientPhoto{PatientID: patientID, StorageKey: "test", ContentType: "image/jpeg"}
+				_, err := photos.Create(ctx, photo, models.PatientPhotoURL(patientID))
+				require.NoError(t, err)
+				return photo
+			}
+			var survivorPhoto, dupPhoto *models.PatientPhoto
+			if tt.survivorPhoto {
+				survivorPhoto = upload(survivor.ID)
+			}
+			if tt.dupPhoto {
+				upload(merged.ID) // retired by the next upload, and moved too
+				dupPhoto = upload(merged.ID)
+			}
+
+			// assertPhoto checks the patient's current photo and photo_url
+			assertPhoto := func(patientID uint, want *models.PatientPhoto) {
+				t.Helper()
+				var patient models.Patient
+				require.NoError(t, db.First(&patient, patientID).Error)
+				current, err := photos.FindCurrent(patientID)
+				if want == nil {
+					assert.ErrorIs(t, err, ErrNotFound)
+					assert.Empty(t, patient.PhotoURL)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, want.ID, current.ID)
+				assert.Equal(t, models.PatientPhotoURL(patientID), patient.PhotoURL)
+			}
+
+			merge := &models.PatientMerge{SurvivorID: survivor.ID, MergedID: merged.ID, MergedMRN: merged.MRN, MergedBy: 1}
+			require.NoError(t, repo.Merge(ctx, merge))
+			if survivorPhoto != nil {
+				assertPhoto(survivor.ID, survivorPhoto)
+			} else {
+				assertPhoto(survivor.ID, dupPhoto)
+			}
+
+			stored, err := repo.FindByID(merge.ID)
+			require.NoError(t, err)
+			require.NoError(t, repo.Unmerge(ctx, stored, 1, "wrong patient"))
+			assertPhoto(survivor.ID, survivorPhoto)
+			current, err := photos.FindCurrent(merged.ID)
+			if dupPhoto == nil {
+				assert.ErrorIs(t, err, ErrNotFound)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, dupPhoto.ID, current.ID)
+			}
+		})
+	}
+}
+
+// assertPatientOf checks the patient a row belongs to
+func assertPatientOf(t *testing.T, db *gorm.DB, table string, id, patientID uint) {
+	t.Helper()
+	var got []uint
+	require.NoError(t, db.Table(table).Where("id = ?", id).Pluck("patient_id", &got).Error)
+	assert.Equal(t, []uint{patientID}, got, "%s %d", table, id)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type PatientPhotoRepository struct {
+	db *gorm.DB
+}
+
+func NewPatientPhotoRepository(db *gorm.DB) *PatientPhotoRepository {
+	return &PatientPhotoRepository{db: db}
+}
+
+// Create stores the photo as the patient's current photo, retiring the previous
+// one, and points the patient's photo_url at it
+func (r *PatientPhotoRepository) Create(ctx context.Context, photo *models.PatientPhoto, photoURL string) (*models.PatientPhoto, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("patient_id = ?", photo.PatientID).Delete(&models.PatientPhoto{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(photo).Error; err != nil {
+			return err
+		}
+		return setPhotoURL(tx, photo.PatientID, photoURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// FindCurrent returns the patient's current photo
+func (r *PatientPhotoRepository) FindCurrent(patientID uint) (*models.PatientPhoto, error) {
+	var photo models.PatientPhoto
+	if err := r.db.Where("patient_id = ?", patientID).Order("id DESC").First(&photo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// Delete retires the patient's current photo and clears photo_url
+func (r *PatientPhotoRepository) Delete(ctx context.Context, patientID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Where("patient_id = ?", patientID).Delete(&models.PatientPhoto{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return setPhotoURL(tx, patientID, "")
+	})
+}
+
+func setPhotoURL(tx *gorm.DB, patientID uint, photoURL string) error {
+	return tx.Model(&models.Patient{}).Where("id = ?", patientID).
+		UpdateColumns(map[string]interface{}{"photo_url": photoURL, "updated_at": time.Now()}).Error
+}
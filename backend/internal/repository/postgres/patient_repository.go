@@ -1,10 +1,14 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var ErrNotFound = errors.New("record not found")
@@ -17,8 +21,8 @@ func NewPatientRepository(db *gorm.DB) *PatientRepository {
 	return &PatientRepository{db: db}
 }
 
-func (r *PatientRepository) Create(patient *models.Patient) (*models.Patient, error) {
-	if err := r.db.Create(patient).Error; err != nil {
+func (r *PatientRepository) Create(ctx context.Context, patient *models.Patient) (*models.Patient, error) {
+	if err := r.db.WithContext(ctx).Create(patient).Error; err != nil {
 		return nil, err
 	}
 	return patient, nil
@@ -26,7 +30,7 @@ func (r *PatientRepository) Create(patient *models.Patient) (*models.Patient, er
 
 func (r *PatientRepository) FindByID(id uint) (*models.Patient, error) {
 	var patient models.Patient
-	if err := r.db.First(&patient, id).Error; err != nil {
+	if err := r.db.Preload("Identifiers").First(&patient, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
 		}
@@ -37,7 +41,7 @@ func (r *PatientRepository) FindByID(id uint) (*models.Patient, error) {
 
 func (r *PatientRepository) FindByIDWithRelations(id uint) (*models.Patient, error) {
 	var patient models.Patient
-	if err := r.db.Preload("Encounters").Preload("Appointments").
+	if err := r.db.Preload("Identifiers").Preload("Encounters").Preload("Appointments").
 		Preload("Prescriptions").Preload("LabOrders").
 		First(&patient, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -48,35 +52,78 @@ func (r *PatientRepository) FindByIDWithRelations(id uint) (*models.Patient, err
 	return &patient, nil
 }
 
-func (r *PatientRepository) Update(patient *models.Patient) (*models.Patient, error) {
-	if err := r.db.Save(patient).Error; err != nil {
+// Update saves the patient and replaces its identifiers with patient.Identifiers.
+// Identifiers left out are soft deleted, so they remain in the history.
+func (r *PatientRepository) Update(ctx context.Context, patient *models.Patient) (*models.Patient, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(patient).Error; err != nil {
+			return err
+		}
+
+		var owned []uint
+		if err := tx.Model(&models.PatientIdentifier{}).Where("patient_id = ?", patient.ID).Pluck("id", &owned).Error; err != nil {
+			return err
+		}
+		keep := make([]uint, 0, len(patient.Identifiers))
+		for i := range patient.Identifiers {
+			identifier := &patient.Identifiers[i]
+			// An id belonging to another patient is treated as a new identifier
+			if !containsID(owned, identifier.ID) {
+				identifier.BaseModel = models.BaseModel{}
+			}
+			identifier.PatientID = patient.ID
+			if err := tx.Save(identifier).Error; err != nil {
+				return err
+			}
+			keep = append(keep, identifier.ID)
+		}
+
+		removed := tx.Where("patient_id = ?", patient.ID)
+		if len(keep) > 0 {
+			removed = removed.Where("id NOT IN ?", keep)
+		}
+		return removed.Delete(&models.PatientIdentifier{}).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return patient, nil
 }
 
-func (r *PatientRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Patient{}, id).Error
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PatientRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Patient{}, id).Error
 }
 
 func (r *PatientRepository) List(offset, limit int, nationality, search string) ([]*models.Patient, int64, error) {
 	var patients []*models.Patient
 	var total int64
 
-	query := r.db.Model(&models.Patient{})
+	// Records merged into another patient are left out
+	query := r.db.Model(&models.Patient{}).Where("merged_into_id IS NULL")
 
 	// Filter by nationality
 	if nationality != "" {
 		query = query.Where("nationality = ?", nationality)
 	}
 
-	// Search filter
+	// Search filter; matches are ranked, otherwise the newest come first
+	order := clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "created_at"}, Desc: true}}}
 	if search != "" {
+		name := newNameSearch(search)
 		searchPattern := "%" + search + "%"
-		query = query.Where(
-			"given_name ILIKE ? OR family_name ILIKE ? OR mrn ILIKE ? OR phone ILIKE ? OR email ILIKE ?",
-			searchPattern, searchPattern, searchPattern, searchPattern, searchPattern,
-		)
+		condition, args := name.condition()
+		query = query.Where(condition+" OR mrn ILIKE ? OR phone ILIKE ? OR email ILIKE ?",
+			append(args, searchPattern, searchPattern, searchPattern)...)
+		order = name.order("CASE WHEN mrn = ? THEN 3 ELSE 0 END", search)
 	}
 
 	// Get total count
@@ -85,34 +132,295 @@ func (r *PatientRepository) List(offset, limit int, nationality, search string)
 	}
 
 	// Get paginated results
-	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&patients).Error; err != nil {
+	if err := query.Preload("Identifiers").Clauses(order).Offset(offset).Limit(limit).Find(&patients).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return patients, total, nil
 }
 
+// Search finds patients by name in Latin or Bangla script, MRN, phone,
+// identifier or household case number, best matches first. Each kind of match
+// is looked up through its own index and the results are combined with UNION,
+// so the patients table is never scanned in full.
 func (r *PatientRepository) Search(query string) ([]*models.Patient, error) {
 	var patients []*models.Patient
 	searchPattern := "%" + query + "%"
+	name := newNameSearch(query)
+
+	condition, args := name.condition()
+	direct := r.db.Model(&models.Patient{}).Select("id").
+		Where(condition+" OR mrn = ? OR phone ILIKE ?", append(args, query, searchPattern)...)
+	identifiers := r.identifierQuery("", models.IdentifierLookupValues(query))
 
-	if err := r.db.Where(
-		"given_name ILIKE ? OR family_name ILIKE ? OR mrn = ? OR national_id = ? OR unhcr_number = ? OR phone ILIKE ?",
-		searchPattern, searchPattern, query, query, query, searchPattern,
-	).Limit(20).Find(&patients).Error; err != nil {
+	// A UNHCR case number finds the current members of the household
+	household := r.db.Model(&models.HouseholdMember{}).Select("patient_id").
+		Where("left_at IS NULL AND household_id IN (?)",
+			r.db.Model(&models.Household{}).Select("id").Where("unhcr_case_number = ?", strings.ToUpper(query)))
+
+	if err := r.db.Preload("Identifiers").
+		Where("id IN (?)", gorm.Expr("? UNION ? UNION ?", direct, identifiers, household)).
+		Clauses(name.order("CASE WHEN mrn = ? OR id IN (?) THEN 3 ELSE 0 END", query, identifiers)).
+		Limit(20).Find(&patients).Error; err != nil {
 		return nil, err
 	}
 
 	return patients, nil
 }
 
-func (r *PatientRepository) GetLastPatient() (*models.Patient, error) {
+// nameSearch is a name query in the forms stored on patients: the romanized
+// name for trigram matching against search_name and the phonetic keys for
+// matching name_key
+type nameSearch struct {
+	name string
+	keys []string
+}
+
+func newNameSearch(query string) nameSearch {
+	return nameSearch{name: models.SearchName(query), keys: models.NameTokenKeys(query)}
+}
+
+// condition matches patients sharing a phonetic key with the query, or whose
+// name contains or closely resembles it. Both are served by the indexes of
+// InstallSearchIndexes.
+func (n nameSearch) condition() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(n.keys) > 0 {
+		conditions = append(conditions, "string_to_array(name_key, ' ') && string_to_array(?, ' ')")
+		args = append(args, strings.Join(n.keys, " "))
+	}
+	if n.name != "" {
+		conditions = append(conditions, "search_name ILIKE ? OR ? <% search_name")
+		args = append(args, "%"+n.name+"%", n.name)
+	}
+	if len(conditions) == 0 {
+		return "FALSE", nil
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+// order ranks matches by boost, an SQL score for exact matches, then by the
+// share of the query's phonetic keys the name has and by trigram similarity
+func (n nameSearch) order(boost string, boostArgs ...interface{}) clause.OrderBy {
+	rank := boost + ` + word_similarity(?, coalesce(search_name, ''))
+		+ (SELECT count(*) FROM unnest(string_to_array(name_key, ' ')) AS k WHERE k = ANY(string_to_array(?, ' ')))::float / ?`
+	args := append(boostArgs, n.name, strings.Join(n.keys, " "), max(len(n.keys), 1))
+	return clause.OrderBy{Expression: clause.Expr{SQL: "(" + rank + ") DESC, id DESC", Vars: args, WithoutParentheses: true}}
+}
+
+// InstallSearchIndexes creates the indexes patient search relies on: trigram
+// indexes for substring and similarity matches, and an index on the phonetic
+// name keys. pg_trgm is a trusted extension, so the database owner can install it.
+func (r *PatientRepository) InstallSearchIndexes() error {
+	return r.db.Exec(`
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_patients_search_name_trgm ON patients USING gin (search_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patients_name_key_tokens ON patients USING gin (string_to_array(name_key, ' '));
+CREATE INDEX IF NOT EXISTS idx_patients_mrn_trgm ON patients USING gin (mrn gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patients_phone_trgm ON patients USING gin (phone gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patients_email_trgm ON patients USING gin (email gin_trgm_ops);
+`).Error
+}
+
+// SetMother links a child to its mother; nil removes the link
+func (r *PatientRepository) SetMother(ctx context.Context, patientID uint, motherID *uint) error {
+	return r.db.WithContext(ctx).Model(&models.Patient{}).Where("id = ?", patientID).
+		UpdateColumns(map[string]interface{}{"mother_id": motherID, "updated_at": time.Now()}).Error
+}
+
+// FindChildren returns the patients linked to the mother, youngest first
+func (r *PatientRepository) FindChildren(motherID uint) ([]*models.Patient, error) {
+	var patients []*models.Patient
+	if err := r.db.Preload("Identifiers").Where("mother_id = ? AND merged_into_id IS NULL", motherID).
+		Order("birth_date DESC").Find(&patients).Error; err != nil {
+		return nil, err
+	}
+	return patients, nil
+}
+
+// identifierQuery selects the ids of patients holding one of the identifier
+// values, in any system if system is empty
+func (r *PatientRepository) identifierQuery(system string, values []string) *gorm.DB {
+	query := r.db.Model(&models.PatientIdentifier{}).Select("patient_id").Where("value IN ?", values)
+	if system != "" {
+		query = query.Where("system = ?", system)
+	}
+	return query
+}
+
+// FindByIdentifier finds the patients holding an identifier. values are the
+// normalized spellings to look for; system may be empty to search every system.
+func (r *PatientRepository) FindByIdentifier(system string, values []string) ([]*models.Patient, error) {
+	var patients []*models.Patient
+	if len(values) == 0 {
+		return patients, nil
+	}
+	if err := r.db.Preload("Identifiers").
+		Where("id IN (?)", r.identifierQuery(system, values)).
+		Order("id").Limit(20).Find(&patients).Error; err != nil {
+		return nil, err
+	}
+	return patients, nil
+}
+
+// maxMergeChain bounds how many merges are followed when resolving a retired record
+const maxMergeChain = 10
+
+// ResolveMerged follows MergedIntoID to the record a merged patient now lives in.
+// Patients that were never merged are returned as they are.
+func (r *PatientRepository) ResolveMerged(patient *models.Patient) (*models.Patient, error) {
+	for i := 0; i < maxMergeChain && patient.MergedIntoID != nil; i++ {
+		survivor, err := r.FindByID(*patient.MergedIntoID)
+		if err != nil {
+			return nil, err
+		}
+		patient = survivor
+	}
+	return patient, nil
+}
+
+// FindByMRN finds a patient by MRN. The MRN of a merged record resolves to the survivor.
+func (r *PatientRepository) FindByMRN(mrn string) (*models.Patient, error) {
 	var patient models.Patient
-	if err := r.db.Order("id DESC").First(&patient).Error; err != nil {
+	if err := r.db.Preload("Identifiers").Where("mrn = ?", mrn).First(&patient).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return &patient, nil
+	return r.ResolveMerged(&patient)
+}
+
+// NextMRNSequence allocates the next MRN sequence number for a facility and
+// period. The increment is a single UPDATE, so concurrent registrations never
+// get the same number. A counter that does not exist yet is seeded from the
+// highest existing MRN matching seedPattern, whose first capture group is the
+// sequence number.
+func (r *PatientRepository) NextMRNSequence(facility, period, seedPattern string) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.MRNCounter{}).
+		Where("facility_code = ? AND period = ?", facility, period).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		if err := r.db.Exec(`
+			INSERT INTO mrn_counters (facility_code, period, last_value, updated_at)
+			SELECT ?, ?, COALESCE(MAX(CAST(substring(mrn from ?) AS BIGINT)), 0), now()
+			FROM patients WHERE mrn ~ ?
+			ON CONFLICT (facility_code, period) DO NOTHING`,
+			facility, period, seedPattern, seedPattern).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	var next int64
+	if err := r.db.Raw(`
+		UPDATE mrn_counters SET last_value = last_value + 1, updated_at = now()
+		WHERE facility_code = ? AND period = ?
+		RETURNING last_value`, facility, period).Scan(&next).Error; err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// FindMatchCandidates returns patients that share a phonetic name key, an
+// identifier or a phone number with the given patient. These are the records
+// worth scoring as possible duplicates.
+func (r *PatientRepository) FindMatchCandidates(patient *models.Patient, limit int) ([]*models.Patient, error) {
+	var conditions []string
+	var args []interface{}
+
+	if keys := models.NameTokenKeys(patient.GivenName, patient.MiddleName, patient.FamilyName); len(keys) > 0 {
+		conditions = append(conditions, "string_to_array(name_key, ' ') && ARRAY[?]::text[]")
+		args = append(args, keys)
+	}
+	for _, identifier := range patient.Identifiers {
+		if identifier.System != models.IdentifierSystemMRN && identifier.Value != "" {
+			conditions = append(conditions, "id IN (?)")
+			args = append(args, r.identifierQuery(identifier.System, []string{identifier.Value}))
+		}
+	}
+	// Phone numbers are compared on their last 10 digits so +880 and 0 prefixes match
+	for _, phone := range []string{patient.Phone, patient.Phone2} {
+		if digits := PhoneDigits(phone); digits != "" {
+			conditions = append(conditions,
+				`right(regexp_replace(phone, '\D', '', 'g'), 10) = ? OR right(regexp_replace(phone2, '\D', '', 'g'), 10) = ?`)
+			args = append(args, digits, digits)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := r.db.Where("("+strings.Join(conditions, ") OR (")+")", args...).Where("merged_into_id IS NULL")
+	if patient.ID != 0 {
+		query = query.Where("id <> ?", patient.ID)
+	}
+
+	var patients []*models.Patient
+	if err := query.Preload("Identifiers").Order("id DESC").Limit(limit).Find(&patients).Error; err != nil {
+		return nil, err
+	}
+	return patients, nil
+}
+
+// PhoneDigits returns the last 10 digits of a phone number, or "" if it has fewer
+func PhoneDigits(phone string) string {
+	var digits []byte
+	for i := 0; i < len(phone); i++ {
+		if phone[i] >= '0' && phone[i] <= '9' {
+			digits = append(digits, phone[i])
+		}
+	}
+	if len(digits) < 10 {
+		return ""
+	}
+	return string(digits[len(digits)-10:])
+}
+
+// BackfillNameKeys computes the phonetic name key and search name of patients
+// registered before they existed
+func (r *PatientRepository) BackfillNameKeys() error {
+	var batch []*models.Patient
+	return r.db.Where("name_key IS NULL OR name_key = '' OR search_name IS NULL OR search_name = ''").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, patient := range batch {
+				columns := map[string]interface{}{
+					"name_key":    strings.Join(models.NameTokenKeys(patient.GivenName, patient.MiddleName, patient.FamilyName), " "),
+					"search_name": models.SearchName(patient.GivenName, patient.MiddleName, patient.FamilyName),
+				}
+				if err := tx.Model(&models.Patient{}).Where("id = ?", patient.ID).UpdateColumns(columns).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// BackfillIdentifiers creates identifier rows from the legacy identifier
+// columns of patients registered before identifiers had their own table
+func (r *PatientRepository) BackfillIdentifiers() error {
+	for _, system := range models.IdentifierSystems {
+		if system.Column == "" {
+			continue
+		}
+		use := ""
+		if system.System == models.IdentifierSystemMRN {
+			use = "usual"
+		}
+		value := system.NormalizeSQL("p." + system.Column)
+		if err := r.db.Exec(`
+			INSERT INTO patient_identifiers (patient_id, system, value, type, use, assigner, created_at, updated_at)
+			SELECT p.id, ?, `+value+`, ?, ?, ?, now(), now()
+			FROM patients p
+			WHERE `+value+` <> '' AND NOT EXISTS (
+				SELECT 1 FROM patient_identifiers i
+				WHERE i.patient_id = p.id AND i.system = ? AND i.deleted_at IS NULL)`,
+			system.System, system.Type, use, system.Assigner, system.System).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
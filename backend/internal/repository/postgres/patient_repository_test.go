@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPatientNameSearch checks a name is found from its other spellings and
+// scripts, with the closest names first
+func TestPatientNameSearch(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPatientRepository(db)
+	require.NoError(t, repo.InstallSearchIndexes())
+
+	create := func(given, family string) *models.Patient {
+		patient := &models.Patient{MRN: fmt.Sprintf("TEST-%d", time.Now().UnixNano()), GivenName: given, FamilyName: family}
+		require.NoError(t, db.Create(patient).Error)
+		return patient
+	}
+	rahman := create("Mohammad Rahman", "Hossain")
+	bangla := create("রহমান", "হোসেন")
+	rahima := create("Rahima", "Begum")
+	create("Karim", "Uddin")
+
+	ids := func(patients []*models.Patient) []uint {
+		found := make([]uint, len(patients))
+		for i, patient := range patients {
+			found[i] = patient.ID
+		}
+		return found
+	}
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{"Rahaman Hussain", []uint{bangla.ID, rahman.ID}},
+		{"রহমান", []uint{bangla.ID, rahman.ID}},
+		{"Md. Rohman", []uint{bangla.ID, rahman.ID}},
+		{"Rahima", []uint{rahima.ID}},
+		{rahima.MRN, []uint{rahima.ID}},
+		{"Md.", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			found, err := repo.Search(tt.query)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, ids(found))
+
+			listed, total, err := repo.List(0, 10, "", tt.query)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(tt.want), total)
+			assert.ElementsMatch(t, tt.want, ids(listed))
+		})
+	}
+
+	// The record spelled like the query ranks first
+	found, err := repo.Search("Mohammad Rahman Hossain")
+	require.NoError(t, err)
+	require.NotEmpty(t, found)
+	assert.Equal(t, rahman.ID, found[0].ID)
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
@@ -16,8 +17,8 @@ func NewPharmacyRepository(db *gorm.DB) *PharmacyRepository {
 }
 
 // Stock Operations
-func (r *PharmacyRepository) AddStock(stock *models.PharmacyStock) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *PharmacyRepository) AddStock(ctx context.Context, stock *models.PharmacyStock, performedBy uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(stock).Error; err != nil {
 			return err
 		}
@@ -29,6 +30,7 @@ func (r *PharmacyRepository) AddStock(stock *models.PharmacyStock) error {
 			Quantity:     stock.Quantity,
 			BatchNumber:  stock.BatchNumber,
 			Reference:    "STOCK-ADD",
+			PerformedBy:  performedBy,
 			PerformedAt:  time.Now(),
 		}
 		return tx.Create(movement).Error
@@ -44,23 +46,19 @@ func (r *PharmacyRepository) GetStock(medicationID uint) ([]models.PharmacyStock
 	return stocks, err
 }
 
-func (r *PharmacyRepository) GetLowStock(threshold int) ([]models.PharmacyStock, error) {
-	var stocks []models.PharmacyStock
-	err := r.db.Preload("Medication").
-		Where("quantity <= reorder_level").
-		Find(&stocks).Error
-	return stocks, err
+func (r *PharmacyRepository) GetLowStock(q ListQuery) (*Page[models.PharmacyStock], error) {
+	return Paginate[models.PharmacyStock](r.db.Where("quantity <= reorder_level"), ListSpec{Sort: "quantity", Preloads: []string{"Medication"}}, q)
 }
 
-func (r *PharmacyRepository) UpdateStockQuantity(id uint, quantity int) error {
-	return r.db.Model(&models.PharmacyStock{}).
+func (r *PharmacyRepository) UpdateStockQuantity(ctx context.Context, id uint, quantity int) error {
+	return r.db.WithContext(ctx).Model(&models.PharmacyStock{}).
 		Where("id = ?", id).
 		Update("quantity", quantity).Error
 }
 
 // Dispensing Operations
-func (r *PharmacyRepository) CreateDispensing(dispensing *models.Dispensing) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+func (r *PharmacyRepository) CreateDispensing(ctx context.Context, dispensing *models.Dispensing) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create dispensing record
 		if err := tx.Create(dispensing).Error; err != nil {
 			return err
@@ -94,24 +92,17 @@ func (r *PharmacyRepository) CreateDispensing(dispensing *models.Dispensing) err
 	})
 }
 
-func (r *PharmacyRepository) GetPendingPrescriptions() ([]models.Prescription, error) {
-	var prescriptions []models.Prescription
-	err := r.db.Preload("Patient").
-		Preload("Medication").
-		Where("status = ?", "active").
-		Where("id NOT IN (SELECT prescription_id FROM dispensing)").
-		Find(&prescriptions).Error
-	return prescriptions, err
+func (r *PharmacyRepository) GetPendingPrescriptions(q ListQuery) (*Page[models.Prescription], error) {
+	query := r.db.Where("status = ?", "active").
+		Where("id NOT IN (SELECT prescription_id FROM dispensing)")
+	return Paginate[models.Prescription](query, ListSpec{Sort: "start_date", Preloads: []string{"Patient", "Medication"}}, q)
 }
 
-func (r *PharmacyRepository) GetDispensingHistory(patientID uint) ([]models.Dispensing, error) {
-	var dispensing []models.Dispensing
-	err := r.db.Preload("Medication").
-		Preload("Prescription").
-		Where("patient_id = ?", patientID).
-		Order("dispensed_at DESC").
-		Find(&dispensing).Error
-	return dispensing, err
+func (r *PharmacyRepository) GetDispensingHistory(patientID uint, q ListQuery) (*Page[models.Dispensing], error) {
+	return Paginate[models.Dispensing](r.db.Where("patient_id = ?", patientID), ListSpec{
+		Sort:     "-dispensed_at",
+		Preloads: []string{"Medication", "Prescription"},
+	}, q)
 }
 
 // Stock Movement
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type PortalDelegationRepository struct {
+	db *gorm.DB
+}
+
+func NewPortalDelegationRepository(db *gorm.DB) *PortalDelegationRepository {
+	return &PortalDelegationRepository{db: db}
+}
+
+func (r *PortalDelegationRepository) Create(ctx context.Context, delegation *models.PortalDelegation) (*models.PortalDelegation, error) {
+	if err := r.db.WithContext(ctx).Create(delegation).Error; err != nil {
+		return nil, err
+	}
+	return delegation, nil
+}
+
+func (r *PortalDelegationRepository) FindByID(id uint) (*models.PortalDelegation, error) {
+	var delegation models.PortalDelegation
+	if err := r.db.First(&delegation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+func (r *PortalDelegationRepository) Update(ctx context.Context, delegation *models.PortalDelegation) (*models.PortalDelegation, error) {
+	if err := r.db.WithContext(ctx).Save(delegation).Error; err != nil {
+		return nil, err
+	}
+	return delegation, nil
+}
+
+// ListActiveByProxy returns the delegations currently in effect for a proxy user
+func (r *PortalDelegationRepository) ListActiveByProxy(proxyUserID uint) ([]*models.PortalDelegation, error) {
+	var delegations []*models.PortalDelegation
+	now := time.Now()
+	if err := r.db.Preload("Patient").
+		Where("proxy_user_id = ? AND revoked_at IS NULL AND valid_from <= ?", proxyUserID, now).
+		Where("valid_until IS NULL OR valid_until > ?", now).
+		Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+func (r *PortalDelegationRepository) ListByPatient(patientID uint) ([]*models.PortalDelegation, error) {
+	var delegations []*models.PortalDelegation
+	if err := r.db.Preload("ProxyUser").Where("patient_id = ?", patientID).
+		Order("created_at DESC").Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+// HasActiveDelegation checks if the proxy user currently has access to the patient
+func (r *PortalDelegationRepository) HasActiveDelegation(proxyUserID, patientID uint) (bool, error) {
+	var count int64
+	now := time.Now()
+	if err := r.db.Model(&models.PortalDelegation{}).
+		Where("proxy_user_id = ? AND patient_id = ? AND revoked_at IS NULL AND valid_from <= ?", proxyUserID, patientID, now).
+		Where("valid_until IS NULL OR valid_until > ?", now).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
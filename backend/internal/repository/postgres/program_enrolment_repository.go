@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HbA1cLOINCCodes are the lab test codes read as HbA1c in percent
+var HbA1cLOINCCodes = []string{"4548-4", "17856-6", "4549-2"}
+
+type ProgramEnrolmentRepository struct {
+	db *gorm.DB
+}
+
+func NewProgramEnrolmentRepository(db *gorm.DB) *ProgramEnrolmentRepository {
+	return &ProgramEnrolmentRepository{db: db}
+}
+
+// Create saves an enrolment with its first expected visit
+func (r *ProgramEnrolmentRepository) Create(ctx context.Context, enrolment *models.ProgramEnrolment, due *models.ProgramVisit) (*models.ProgramEnrolment, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(enrolment).Error; err != nil {
+			return err
+		}
+		due.EnrolmentID = enrolment.ID
+		return tx.Create(due).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindByID(enrolment.ID)
+}
+
+func (r *ProgramEnrolmentRepository) FindByID(id uint) (*models.ProgramEnrolment, error) {
+	var enrolment models.ProgramEnrolment
+	err := r.db.Preload("Visits", func(db *gorm.DB) *gorm.DB {
+		return db.Order("due_date DESC, id DESC")
+	}).First(&enrolment, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &enrolment, nil
+}
+
+// FindActive finds a patient's active enrolment in a program
+func (r *ProgramEnrolmentRepository) FindActive(patientID uint, program string) (*models.ProgramEnrolment, error) {
+	var enrolment models.ProgramEnrolment
+	err := r.db.Where("patient_id = ? AND program = ? AND status = ?", patientID, program, models.ProgramEnrolmentActive).
+		First(&enrolment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &enrolment, nil
+}
+
+// RecordVisit saves an enrolment's attended visit, which replaces its due
+// visit, and the next due visit
+func (r *ProgramEnrolmentRepository) RecordVisit(ctx context.Context, enrolment *models.ProgramEnrolment, attended, next *models.ProgramVisit) (*models.ProgramEnrolment, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(enrolment).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(attended).Error; err != nil {
+			return err
+		}
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindByID(enrolment.ID)
+}
+
+// Exit saves an enrolment that left its program and cancels its due visit
+func (r *ProgramEnrolmentRepository) Exit(ctx context.Context, enrolment *models.ProgramEnrolment) (*models.ProgramEnrolment, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(enrolment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ProgramVisit{}).
+			Where("enrolment_id = ? AND status = ?", enrolment.ID, models.ProgramVisitDue).
+			Update("status", models.ProgramVisitCancelled).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindByID(enrolment.ID)
+}
+
+// List returns a page of enrolments, latest first
+func (r *ProgramEnrolmentRepository) List(q ListQuery) (*Page[models.ProgramEnrolment], error) {
+	return Paginate[models.ProgramEnrolment](r.db, ListSpec{Sort: "-enrolled_at", Preloads: []string{"Patient"}}, q)
+}
+
+// ListByPatient returns a page of a patient's enrolments, latest first
+func (r *ProgramEnrolmentRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.ProgramEnrolment], error) {
+	return Paginate[models.ProgramEnrolment](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-enrolled_at"}, q)
+}
+
+// programDefaultersSQL selects the active enrolments whose due visit is
+// before a date, longest overdue first
+const programDefaultersSQL = `
+SELECT e.id AS enrolment_id, e.patient_id, p.mrn,
+	trim(p.given_name || ' ' || p.family_name) AS patient_name, p.phone,
+	e.program, e.ncd_number, pv.due_date, e.last_visit_date
+FROM program_visits pv
+JOIN program_enrolments e ON e.id = pv.enrolment_id
+JOIN patients p ON p.id = e.patient_id
+WHERE pv.deleted_at IS NULL AND e.deleted_at IS NULL
+	AND pv.status = 'due' AND e.status = 'active' AND pv.due_date < @before
+	AND (@program = '' OR e.program = @program)
+ORDER BY pv.due_date, e.id`
+
+// Defaulters returns the active enrolments of a program (or of all programs)
+// with a visit due before a date
+func (r *ProgramEnrolmentRepository) Defaulters(program string, before time.Time) ([]models.ProgramDefaulter, error) {
+	var rows []models.ProgramDefaulter
+	err := r.db.Raw(programDefaultersSQL, map[string]interface{}{"program": program, "before": before}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// programControlSQL selects the latest BP and HbA1c of enrolled patients. BP
+// readings from devices count once validated; HbA1c is a final or corrected
+// lab result.
+const programControlSQL = `
+SELECT e.id AS enrolment_id,
+	v.systolic_bp, v.diastolic_bp, v.measured_at AS bp_measured_at,
+	h.numeric_value AS hba1c, h.result_date AS hba1c_measured_at
+FROM program_enrolments e
+LEFT JOIN LATERAL (
+	SELECT vs.systolic_bp, vs.diastolic_bp, vs.measured_at FROM vital_signs vs
+	WHERE vs.patient_id = e.patient_id AND vs.systolic_bp IS NOT NULL AND vs.diastolic_bp IS NOT NULL
+		AND coalesce(vs.verification_status, '') <> 'pending' AND vs.deleted_at IS NULL
+	ORDER BY vs.measured_at DESC, vs.id DESC
+	LIMIT 1
+) v ON true
+LEFT JOIN LATERAL (
+	SELECT lr.numeric_value, lr.result_date FROM lab_results lr
+	JOIN lab_orders lo ON lo.id = lr.lab_order_id
+	JOIN lab_tests lt ON lt.id = lr.lab_test_id
+	WHERE lo.patient_id = e.patient_id AND lt.code IN @hba1c AND lr.numeric_value IS NOT NULL
+		AND lr.status IN ('final', 'corrected') AND lr.deleted_at IS NULL AND lo.deleted_at IS NULL
+	ORDER BY lr.result_date DESC, lr.id DESC
+	LIMIT 1
+) h ON true
+WHERE e.deleted_at IS NULL`
+
+// Controls returns the latest BP and HbA1c of the given enrolments
+func (r *ProgramEnrolmentRepository) Controls(enrolmentIDs []uint) ([]models.ProgramControl, error) {
+	var rows []models.ProgramControl
+	if len(enrolmentIDs) == 0 {
+		return rows, nil
+	}
+	err := r.db.Raw(programControlSQL+" AND e.id IN @ids",
+		map[string]interface{}{"hba1c": HbA1cLOINCCodes, "ids": enrolmentIDs}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ActiveControls returns the latest BP and HbA1c of a program's active
+// enrolments
+func (r *ProgramEnrolmentRepository) ActiveControls(program string) ([]models.ProgramControl, error) {
+	var rows []models.ProgramControl
+	err := r.db.Raw(programControlSQL+" AND e.status = 'active' AND e.program = @program",
+		map[string]interface{}{"hba1c": HbA1cLOINCCodes, "program": program}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// OutcomeCounts counts a program's exited enrolments by outcome
+func (r *ProgramEnrolmentRepository) OutcomeCounts(program string) (map[string]int, error) {
+	var rows []struct {
+		Outcome string
+		Count   int
+	}
+	err := r.db.Model(&models.ProgramEnrolment{}).Select("outcome, count(*) AS count").
+		Where("program = ? AND status = ?", program, models.ProgramEnrolmentExited).
+		Group("outcome").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Outcome] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuestionnaireRepository struct {
+	db *gorm.DB
+}
+
+func NewQuestionnaireRepository(db *gorm.DB) *QuestionnaireRepository {
+	return &QuestionnaireRepository{db: db}
+}
+
+func (r *QuestionnaireRepository) Create(ctx context.Context, questionnaire *models.Questionnaire) (*models.Questionnaire, error) {
+	if err := r.db.WithContext(ctx).Create(questionnaire).Error; err != nil {
+		return nil, err
+	}
+	return questionnaire, nil
+}
+
+func (r *QuestionnaireRepository) FindByID(id uint) (*models.Questionnaire, error) {
+	var questionnaire models.Questionnaire
+	if err := r.db.First(&questionnaire, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &questionnaire, nil
+}
+
+// FindByCanonical finds a questionnaire by its url and version. Without a
+// version it finds the latest active version.
+func (r *QuestionnaireRepository) FindByCanonical(url, version string) (*models.Questionnaire, error) {
+	query := r.db.Where("url = ?", url)
+	if version != "" {
+		query = query.Where("version = ?", version)
+	} else {
+		query = query.Where("status = ?", models.QuestionnaireActive).Order("created_at DESC, id DESC")
+	}
+	var questionnaire models.Questionnaire
+	if err := query.First(&questionnaire).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &questionnaire, nil
+}
+
+func (r *QuestionnaireRepository) Update(ctx context.Context, questionnaire *models.Questionnaire) (*models.Questionnaire, error) {
+	if err := r.db.WithContext(ctx).Save(questionnaire).Error; err != nil {
+		return nil, err
+	}
+	return questionnaire, nil
+}
+
+// List returns a page of questionnaires, latest first
+func (r *QuestionnaireRepository) List(q ListQuery) (*Page[models.Questionnaire], error) {
+	return Paginate[models.Questionnaire](r.db, ListSpec{Sort: "-created_at"}, q)
+}
+
+// CreateSubmission saves a submission with the observations extracted from it
+func (r *QuestionnaireRepository) CreateSubmission(ctx context.Context, submission *models.QuestionnaireSubmission, observations []models.QuestionnaireObservation) (*models.QuestionnaireSubmission, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(submission).Error; err != nil {
+			return err
+		}
+		return createObservations(tx, submission.ID, observations)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindSubmission(submission.ID)
+}
+
+// UpdateSubmission saves a submission and replaces its observations
+func (r *QuestionnaireRepository) UpdateSubmission(ctx context.Context, submission *models.QuestionnaireSubmission, observations []models.QuestionnaireObservation) (*models.QuestionnaireSubmission, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(submission).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("submission_id = ?", submission.ID).Delete(&models.QuestionnaireObservation{}).Error; err != nil {
+			return err
+		}
+		return createObservations(tx, submission.ID, observations)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindSubmission(submission.ID)
+}
+
+func createObservations(tx *gorm.DB, submissionID uint, observations []models.QuestionnaireObservation) error {
+	if len(observations) == 0 {
+		return nil
+	}
+	for i := range observations {
+		observations[i].SubmissionID = submissionID
+	}
+	return tx.Create(&observations).Error
+}
+
+// FindSubmission finds a submission with its questionnaire and observations
+func (r *QuestionnaireRepository) FindSubmission(id uint) (*models.QuestionnaireSubmission, error) {
+	var submission models.QuestionnaireSubmission
+	err := r.db.Preload("Questionnaire").Preload("Observations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&submission, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// ListSubmissionsByPatient returns a page of a patient's submissions, latest first
+func (r *QuestionnaireRepository) ListSubmissionsByPatient(patientID uint, q ListQuery) (*Page[models.QuestionnaireSubmission], error) {
+	return Paginate[models.QuestionnaireSubmission](r.db.Where("patient_id = ?", patientID),
+		ListSpec{Sort: "-authored_at", Preloads: []string{"Questionnaire"}}, q)
+}
+
+// ListSubmissionsByEncounter returns a page of an encounter's submissions, latest first
+func (r *QuestionnaireRepository) ListSubmissionsByEncounter(encounterID uint, q ListQuery) (*Page[models.QuestionnaireSubmission], error) {
+	return Paginate[models.QuestionnaireSubmission](r.db.Where("encounter_id = ?", encounterID),
+		ListSpec{Sort: "-authored_at", Preloads: []string{"Questionnaire"}}, q)
+}
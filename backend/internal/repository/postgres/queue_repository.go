@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QueueRepository struct {
+	db *gorm.DB
+}
+
+func NewQueueRepository(db *gorm.DB) *QueueRepository {
+	return &QueueRepository{db: db}
+}
+
+// queueOrder is the order in which waiting tokens are called
+const queueOrder = "priority DESC, checked_in_at, number"
+
+// issueQueueToken numbers a new token from the day's counter of its service
+// point and saves it. The counter is incremented by a single upsert, so concurrent
+// check-ins never get the same number.
+func issueQueueToken(tx *gorm.DB, token *models.QueueToken, point models.QueueServicePoint) error {
+	var number int
+	if err := tx.Raw(`
+		INSERT INTO queue_counters (service_point, queue_date, last_number) VALUES (?, ?, 1)
+		ON CONFLICT (service_point, queue_date) DO UPDATE SET last_number = queue_counters.last_number + 1
+		RETURNING last_number`, point.Code, token.QueueDate).Scan(&number).Error; err != nil {
+		return err
+	}
+	token.ServicePoint = point.Code
+	token.Number = number
+	token.Token = models.FormatQueueToken(point, number)
+	return tx.Omit(clause.Associations).Create(token).Error
+}
+
+// Create issues a token at a service point
+func (r *QueueRepository) Create(ctx context.Context, token *models.QueueToken, point models.QueueServicePoint) (*models.QueueToken, error) {
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error { return issueQueueToken(tx, token, point) }); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *QueueRepository) FindByID(id uint) (*models.QueueToken, error) {
+	var token models.QueueToken
+	if err := r.db.Preload("Patient").First(&token, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// FindOpen returns the patient's waiting or called token at a service point on a day
+func (r *QueueRepository) FindOpen(patientID uint, servicePoint, date string) (*models.QueueToken, error) {
+	var token models.QueueToken
+	err := r.db.Where("patient_id = ? AND service_point = ? AND queue_date = ? AND status IN ?",
+		patientID, servicePoint, date, []string{models.QueueStatusWaiting, models.QueueStatusCalled}).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *QueueRepository) Update(ctx context.Context, token *models.QueueToken) (*models.QueueToken, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(token).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// CallNext calls the first waiting token of a service point's queue to a
+// counter. The token is locked while it is called, so two counters calling
+// at the same time get different patients. It returns ErrNotFound when
+// nobody is waiting.
+func (r *QueueRepository) CallNext(ctx context.Context, servicePoint, date, counter string, calledBy uint, at time.Time) (*models.QueueToken, error) {
+	var token models.QueueToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("service_point = ? AND queue_date = ? AND status = ?", servicePoint, date, models.QueueStatusWaiting).
+			Order(queueOrder).First(&token).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if err := token.TransitionTo(models.QueueStatusCalled, at); err != nil {
+			return err
+		}
+		token.Counter = counter
+		token.CalledBy = &calledBy
+		return tx.Omit(clause.Associations).Save(&token).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Transfer saves a token that was transferred together with the new token
+// issued at the other service point
+func (r *QueueRepository) Transfer(ctx context.Context, from, to *models.QueueToken, point models.QueueServicePoint) (*models.QueueToken, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		to.TransferredFromID = &from.ID
+		if err := issueQueueToken(tx, to, point); err != nil {
+			return err
+		}
+		from.TransferredToID = &to.ID
+		return tx.Omit(clause.Associations).Save(from).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return to, nil
+}
+
+// List returns a page of a service point's tokens on a day, by number
+func (r *QueueRepository) List(servicePoint, date string, q ListQuery) (*Page[models.QueueToken], error) {
+	return Paginate[models.QueueToken](r.db.Where("service_point = ? AND queue_date = ?", servicePoint, date),
+		ListSpec{Sort: "number", Preloads: []string{"Patient"}}, q)
+}
+
+// ListOpen returns the waiting and called tokens of the service points on a
+// day, called first (latest call first) and then in the order they will be called
+func (r *QueueRepository) ListOpen(servicePoints []string, date string) ([]models.QueueToken, error) {
+	var tokens []models.QueueToken
+	err := r.db.Where("service_point IN ? AND queue_date = ? AND status IN ?",
+		servicePoints, date, []string{models.QueueStatusWaiting, models.QueueStatusCalled}).
+		Order("CASE status WHEN 'called' THEN 0 ELSE 1 END, CASE status WHEN 'called' THEN last_called_at END DESC, " + queueOrder).
+		Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// queueStatsSQL summarizes each service point's tokens of a day. Waits run
+// from check-in to the first call; percentile_cont skips tokens not called yet.
+const queueStatsSQL = `
+SELECT service_point,
+	count(*) FILTER (WHERE status = 'waiting') AS waiting,
+	count(*) FILTER (WHERE status = 'called') AS called,
+	count(*) FILTER (WHERE status = 'done') AS done,
+	count(*) FILTER (WHERE status = 'skipped') AS skipped,
+	count(*) FILTER (WHERE status = 'transferred') AS transferred,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM called_at - checked_in_at) / 60) AS wait_median,
+	avg(extract(epoch FROM called_at - checked_in_at) / 60) AS wait_mean,
+	max(extract(epoch FROM CAST(@now AS timestamptz) - checked_in_at) / 60) FILTER (WHERE status = 'waiting') AS longest_waiting,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM completed_at - called_at) / 60)
+		FILTER (WHERE status = 'done') AS service_median
+FROM queue_tokens
+WHERE queue_date = @date AND deleted_at IS NULL
+GROUP BY service_point`
+
+// Stats summarizes the queues of a day, for the service points that issued tokens
+func (r *QueueRepository) Stats(date string, now time.Time) ([]models.QueueStats, error) {
+	var stats []models.QueueStats
+	err := r.db.Raw(queueStatsSQL, map[string]interface{}{"date": date, "now": now}).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/zarishsphere/zarish-his/internal/models"
 	"gorm.io/gorm"
 )
@@ -15,8 +17,8 @@ func NewRadiologyRepository(db *gorm.DB) *RadiologyRepository {
 
 // Study Operations
 
-func (r *RadiologyRepository) CreateStudy(study *models.ImagingStudy) error {
-	return r.db.Create(study).Error
+func (r *RadiologyRepository) CreateStudy(ctx context.Context, study *models.ImagingStudy) error {
+	return r.db.WithContext(ctx).Create(study).Error
 }
 
 func (r *RadiologyRepository) GetStudy(id uint) (*models.ImagingStudy, error) {
@@ -31,41 +33,22 @@ func (r *RadiologyRepository) GetStudyByAccession(accession string) (*models.Ima
 	return &study, err
 }
 
-func (r *RadiologyRepository) ListStudies(patientID uint, status string, limit, offset int) ([]models.ImagingStudy, int64, error) {
-	var studies []models.ImagingStudy
-	var total int64
-
-	query := r.db.Model(&models.ImagingStudy{})
-
-	if patientID > 0 {
-		query = query.Where("patient_id = ?", patientID)
-	}
-
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-
-	err := query.Count(&total).Error
-	if err != nil {
-		return nil, 0, err
-	}
-
-	err = query.Preload("Patient").Preload("Report").Order("created_at desc").Limit(limit).Offset(offset).Find(&studies).Error
-	return studies, total, err
+func (r *RadiologyRepository) ListStudies(q ListQuery) (*Page[models.ImagingStudy], error) {
+	return Paginate[models.ImagingStudy](r.db, ListSpec{Sort: "-CreatedAt", Preloads: []string{"Patient", "Report"}}, q)
 }
 
-func (r *RadiologyRepository) UpdateStudyStatus(id uint, status string) error {
-	return r.db.Model(&models.ImagingStudy{}).Where("id = ?", id).Update("status", status).Error
+func (r *RadiologyRepository) UpdateStudyStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&models.ImagingStudy{}).Where("id = ?", id).Update("status", status).Error
 }
 
 // Report Operations
 
-func (r *RadiologyRepository) CreateReport(report *models.RadiologyReport) error {
-	return r.db.Create(report).Error
+func (r *RadiologyRepository) CreateReport(ctx context.Context, report *models.RadiologyReport) error {
+	return r.db.WithContext(ctx).Create(report).Error
 }
 
-func (r *RadiologyRepository) UpdateReport(report *models.RadiologyReport) error {
-	return r.db.Save(report).Error
+func (r *RadiologyRepository) UpdateReport(ctx context.Context, report *models.RadiologyReport) error {
+	return r.db.WithContext(ctx).Save(report).Error
 }
 
 func (r *RadiologyRepository) GetReportByStudyID(studyID uint) (*models.RadiologyReport, error) {
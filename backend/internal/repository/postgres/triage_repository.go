@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TriageRepository struct {
+	db *gorm.DB
+}
+
+func NewTriageRepository(db *gorm.DB) *TriageRepository {
+	return &TriageRepository{db: db}
+}
+
+// Save creates or replaces the triage of an encounter and saves the encounter
+// with its new priority. change is the encounter's move to triaged, or nil
+// when it is re-triaged. ErrEncounterStatusConflict is returned if the
+// encounter's status changed since it was read.
+func (r *TriageRepository) Save(ctx context.Context, triage *models.Triage, encounter *models.Encounter, change *models.EncounterStatusHistory) (*models.Triage, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(triage).Error; err != nil {
+			return err
+		}
+		from := encounter.Status
+		if change != nil {
+			from = change.FromStatus
+		}
+		if err := saveEncounter(tx, encounter, from); err != nil {
+			return err
+		}
+		if change == nil {
+			return nil
+		}
+		change.EncounterID = encounter.ID
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return triage, nil
+}
+
+func (r *TriageRepository) FindByEncounter(encounterID uint) (*models.Triage, error) {
+	var triage models.Triage
+	if err := r.db.Where("encounter_id = ?", encounterID).First(&triage).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &triage, nil
+}
+
+// erBoardSQL selects the emergency encounters waiting to be seen with their
+// triage, most urgent level first and then by arrival. Patients not yet
+// triaged sort last.
+const erBoardSQL = `
+SELECT e.id AS encounter_id, e.patient_id, p.mrn,
+	trim(p.given_name || ' ' || p.family_name) AS patient_name,
+	e.status, e.chief_complaint,
+	coalesce((SELECT min(h.changed_at) FROM encounter_status_history h
+		WHERE h.encounter_id = e.id AND h.status = 'arrived'), e.period_start) AS arrived_at,
+	t.id AS triage_id, t.level, t.tews, t.presenting_complaint, t.triaged_at
+FROM encounters e
+JOIN patients p ON p.id = e.patient_id
+LEFT JOIN triages t ON t.encounter_id = e.id AND t.deleted_at IS NULL
+WHERE e.deleted_at IS NULL AND e.class = ? AND e.status IN ?
+ORDER BY CASE t.level WHEN 'red' THEN 0 WHEN 'orange' THEN 1 WHEN 'yellow' THEN 2 WHEN 'green' THEN 3 ELSE 4 END,
+	arrived_at, e.id`
+
+// ListWaitingEmergencies returns the emergency encounters that have arrived
+// and not yet been seen, most urgent first
+func (r *TriageRepository) ListWaitingEmergencies() ([]models.ERBoardEntry, error) {
+	var entries []models.ERBoardEntry
+	err := r.db.Raw(erBoardSQL, models.EncounterClassEmergency,
+		[]string{models.EncounterStatusArrived, models.EncounterStatusTriaged}).Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type VitalSignsRepository struct {
@@ -15,8 +18,20 @@ func NewVitalSignsRepository(db *gorm.DB) *VitalSignsRepository {
 	return &VitalSignsRepository{db: db}
 }
 
-func (r *VitalSignsRepository) Create(vitals *models.VitalSigns) (*models.VitalSigns, error) {
-	if err := r.db.Create(vitals).Error; err != nil {
+// Create saves vital signs together with the early warning alert they raised,
+// if any
+func (r *VitalSignsRepository) Create(ctx context.Context, vitals *models.VitalSigns, alert *models.EarlyWarningAlert) (*models.VitalSigns, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(vitals).Error; err != nil {
+			return err
+		}
+		if alert == nil {
+			return nil
+		}
+		alert.VitalSignsID = vitals.ID
+		return tx.Omit(clause.Associations).Create(alert).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return vitals, nil
@@ -41,10 +56,179 @@ func (r *VitalSignsRepository) ListByEncounter(encounterID uint) ([]*models.Vita
 	return vitals, nil
 }
 
-func (r *VitalSignsRepository) ListByPatient(patientID uint, limit int) ([]*models.VitalSigns, error) {
+func (r *VitalSignsRepository) ListByPatient(patientID uint, q ListQuery) (*Page[models.VitalSigns], error) {
+	return Paginate[models.VitalSigns](r.db.Where("patient_id = ?", patientID), ListSpec{Sort: "-measured_at"}, q)
+}
+
+// FindDeviceReading returns the reading a device sent for a measurement time
+func (r *VitalSignsRepository) FindDeviceReading(deviceID uint, measuredAt time.Time) (*models.VitalSigns, error) {
+	var vitals models.VitalSigns
+	err := r.db.Unscoped().Where("device_id = ? AND measured_at = ?", deviceID, measuredAt).First(&vitals).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &vitals, nil
+}
+
+// ListPending returns a page of device readings awaiting validation, oldest
+// first, optionally only from devices at beds of a ward
+func (r *VitalSignsRepository) ListPending(wardID *uint, q ListQuery) (*Page[models.VitalSigns], error) {
+	query := r.db.Where("verification_status = ?", models.VerificationPending)
+	if wardID != nil {
+		query = query.Where(`device_id IN (SELECT d.id FROM devices d
+			JOIN beds b ON b.id = d.bed_id JOIN rooms rm ON rm.id = b.room_id
+			WHERE rm.ward_id = ?)`, *wardID)
+	}
+	return Paginate[models.VitalSigns](query, ListSpec{Sort: "measured_at", Preloads: []string{"Patient"}}, q)
+}
+
+// Verify saves a nurse's verification of a device reading. A rejected
+// reading is deleted with its early warning alert, so it drops out of charts
+// and scores.
+func (r *VitalSignsRepository) Verify(ctx context.Context, vitals *models.VitalSigns) (*models.VitalSigns, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(vitals).Error; err != nil {
+			return err
+		}
+		if vitals.VerificationStatus != models.VerificationRejected {
+			return nil
+		}
+		if err := tx.Where("vital_signs_id = ?", vitals.ID).Delete(&models.EarlyWarningAlert{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(vitals).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vitals, nil
+}
+
+// ListByPatientBetween returns a patient's vital signs measured in [from, to),
+// oldest first
+func (r *VitalSignsRepository) ListByPatientBetween(patientID uint, from, to time.Time) ([]*models.VitalSigns, error) {
+	var vitals []*models.VitalSigns
+	err := r.db.Where("patient_id = ? AND measured_at >= ? AND measured_at < ?", patientID, from, to).
+		Order("measured_at, id").Find(&vitals).Error
+	if err != nil {
+		return nil, err
+	}
+	return vitals, nil
+}
+
+// ListAnthropometry returns a patient's vital signs with weight, height, MUAC
+// or oedema recorded, oldest first
+func (r *VitalSignsRepository) ListAnthropometry(patientID uint) ([]*models.VitalSigns, error) {
 	var vitals []*models.VitalSigns
-	if err := r.db.Where("patient_id = ?", patientID).Order("measured_at DESC").Limit(limit).Find(&vitals).Error; err != nil {
+	err := r.db.Where("patient_id = ? AND (weight IS NOT NULL OR height IS NOT NULL OR muac IS NOT NULL OR oedema)", patientID).
+		Order("measured_at, id").Find(&vitals).Error
+	if err != nil {
 		return nil, err
 	}
 	return vitals, nil
 }
+
+// BackfillAbnormalFlags flags the vital signs recorded before they were
+// compared with age- and sex-specific reference ranges
+func (r *VitalSignsRepository) BackfillAbnormalFlags() error {
+	var batch []*models.VitalSigns
+	return r.db.Preload("Patient").
+		Where(`(systolic_bp IS NOT NULL AND systolic_bp_flag IS NULL) OR (diastolic_bp IS NOT NULL AND diastolic_bp_flag IS NULL)
+			OR (pulse_rate IS NOT NULL AND pulse_rate_flag IS NULL) OR (respiratory_rate IS NOT NULL AND respiratory_rate_flag IS NULL)
+			OR (temperature IS NOT NULL AND temperature_flag IS NULL) OR (sp_o2 IS NOT NULL AND sp_o2_flag IS NULL)`).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, vitals := range batch {
+				vitals.FlagAbnormal(&vitals.Patient)
+				columns := map[string]interface{}{
+					"systolic_bp_flag":      vitals.SystolicBPFlag,
+					"diastolic_bp_flag":     vitals.DiastolicBPFlag,
+					"pulse_rate_flag":       vitals.PulseRateFlag,
+					"respiratory_rate_flag": vitals.RespiratoryRateFlag,
+					"temperature_flag":      vitals.TemperatureFlag,
+					"sp_o2_flag":            vitals.SpO2Flag,
+				}
+				if err := tx.Model(&models.VitalSigns{}).Where("id = ?", vitals.ID).UpdateColumns(columns).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// LatestScoredBefore returns the encounter's latest observation with an early
+// warning score measured before a time
+func (r *VitalSignsRepository) LatestScoredBefore(encounterID uint, before time.Time) (*models.VitalSigns, error) {
+	var vitals models.VitalSigns
+	err := r.db.Where("encounter_id = ? AND ews_score IS NOT NULL AND measured_at < ?", encounterID, before).
+		Order("measured_at DESC, id DESC").First(&vitals).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &vitals, nil
+}
+
+func (r *VitalSignsRepository) FindAlert(id uint) (*models.EarlyWarningAlert, error) {
+	var alert models.EarlyWarningAlert
+	if err := r.db.Preload("Patient").First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (r *VitalSignsRepository) UpdateAlert(ctx context.Context, alert *models.EarlyWarningAlert) (*models.EarlyWarningAlert, error) {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Save(alert).Error; err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func (r *VitalSignsRepository) ListAlerts(status string, q ListQuery) (*Page[models.EarlyWarningAlert], error) {
+	query := r.db
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return Paginate[models.EarlyWarningAlert](query, ListSpec{Sort: "-raised_at", Preloads: []string{"Patient"}}, q)
+}
+
+// wardEarlyWarningSQL selects the patients admitted to a ward with the latest
+// scored observation since their admission, highest score first. Patients
+// not scored yet sort last.
+const wardEarlyWarningSQL = `
+SELECT a.id AS admission_id, a.admission_date, a.patient_id, p.mrn,
+	trim(p.given_name || ' ' || p.family_name) AS patient_name,
+	rm.room_number, b.bed_number,
+	v.id AS vital_signs_id, v.measured_at, v.ews_system AS system, v.ews_score AS score, v.ews_risk AS risk,
+	(SELECT count(*) FROM early_warning_alerts ea
+		WHERE ea.patient_id = a.patient_id AND ea.status = 'open' AND ea.deleted_at IS NULL) AS open_alerts
+FROM admissions a
+JOIN beds b ON b.id = a.bed_id
+JOIN rooms rm ON rm.id = b.room_id
+JOIN patients p ON p.id = a.patient_id
+LEFT JOIN LATERAL (
+	SELECT vs.id, vs.measured_at, vs.ews_system, vs.ews_score, vs.ews_risk FROM vital_signs vs
+	WHERE vs.patient_id = a.patient_id AND vs.ews_score IS NOT NULL AND vs.measured_at >= a.admission_date
+		AND vs.deleted_at IS NULL
+	ORDER BY vs.measured_at DESC, vs.id DESC
+	LIMIT 1
+) v ON true
+WHERE a.deleted_at IS NULL AND a.status = 'Admitted' AND rm.ward_id = ?
+ORDER BY v.ews_score DESC NULLS LAST, open_alerts DESC, rm.room_number, b.bed_number`
+
+// WardEarlyWarning returns the patients admitted to a ward with their latest
+// early warning score
+func (r *VitalSignsRepository) WardEarlyWarning(wardID uint) ([]models.WardEarlyWarning, error) {
+	var rows []models.WardEarlyWarning
+	if err := r.db.Raw(wardEarlyWarningSQL, wardID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
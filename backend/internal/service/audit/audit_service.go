@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// auditVerifyBatchSize is the number of events loaded per batch when verifying the chain
+const auditVerifyBatchSize = 1000
+
+// AuditVerifyResult reports the outcome of a hash chain verification
+type AuditVerifyResult struct {
+	Valid      bool   `json:"valid"`
+	Checked    int    `json:"checked"`
+	BrokenAtID uint   `json:"broken_at_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type AuditService struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends an audit event. before/after are the resource states for writes
+// (nil for reads). Writes made through the repositories are audited in their own
+// transaction, so Record is left for reads; callers must not return data whose
+// access could not be recorded.
+func (s *AuditService) Record(actor models.AuditActor, action, resourceType string, resourceID, patientID uint, before, after interface{}) error {
+	event, err := models.NewAuditEvent(actor, action, resourceType, resourceID, patientID, before, after)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Append(event); err != nil {
+		return fmt.Errorf("recording %s %s/%d: %w", action, resourceType, resourceID, err)
+	}
+	return nil
+}
+
+func (s *AuditService) ListEvents(filter repository.AuditFilter, page, limit int) ([]*models.AuditEvent, int64, error) {
+	offset := (page - 1) * limit
+	return s.repo.List(filter, offset, limit)
+}
+
+// VerifyChain recomputes every hash and checks that each event links to its predecessor
+func (s *AuditService) VerifyChain() (*AuditVerifyResult, error) {
+	result := &AuditVerifyResult{Valid: true}
+	prevHash := ""
+	var lastID uint
+
+	for {
+		events, err := s.repo.ListInOrder(lastID, auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return result, nil
+		}
+
+		for _, event := range events {
+			result.Checked++
+			if event.PrevHash != prevHash {
+				return brokenChain(result, event.ID, "previous hash does not match; an event was removed or altered"), nil
+			}
+			if event.ComputeHash() != event.Hash {
+				return brokenChain(result, event.ID, "event contents do not match its hash"), nil
+			}
+			prevHash = event.Hash
+			lastID = event.ID
+		}
+	}
+}
+
+func brokenChain(result *AuditVerifyResult, id uint, reason string) *AuditVerifyResult {
+	result.Valid = false
+	result.BrokenAtID = id
+	result.Reason = reason
+	return result
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInactiveUser       = errors.New("user account is inactive")
+	// ErrTokenReused wraps ErrInvalidToken for a refresh token presented again
+	// after it was used or revoked
+	ErrTokenReused = fmt.Errorf("%w: refresh token was already used, all sessions have been signed out", ErrInvalidToken)
+)
+
+// refreshTokenTTL is the lifetime of a refresh token
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// Claims are the JWT claims issued for an authenticated user
+type Claims struct {
+	UserID    uint   `json:"uid"`
+	Role      string `json:"role"`
+	PatientID *uint  `json:"pid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type AuthService struct {
+	repo      *repository.UserRepository
+	secret    []byte
+	accessTTL time.Duration
+}
+
+func NewAuthService(repo *repository.UserRepository, secret string, accessTTL time.Duration) *AuthService {
+	return &AuthService{
+		repo:      repo,
+		secret:    []byte(secret),
+		accessTTL: accessTTL,
+	}
+}
+
+// Login verifies the credentials and issues an access and refresh token pair
+func (s *AuthService) Login(username, password string) (*models.AuthResponse, error) {
+	user, err := s.repo.FindByUsername(username)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Active {
+		return nil, ErrInactiveUser
+	}
+
+	return s.issueTokens(user)
+}
+
+// Refresh exchanges a valid refresh token for a new token pair.
+// The presented refresh token is revoked (rotation). A token presented again,
+// whether by a thief or by a concurrent request that lost the race, may have
+// leaked, so every refresh token of the user is revoked and ErrTokenReused
+// is returned.
+func (s *AuthService) Refresh(refreshToken string) (*models.AuthResponse, error) {
+	stored, err := s.repo.FindRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if stored.RevokedAt != nil {
+		return nil, s.tokenReused(stored.UserID)
+	}
+	if !stored.IsValid() {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.repo.FindByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		return nil, ErrInactiveUser
+	}
+
+	if err := s.repo.RevokeRefreshToken(stored.ID); err != nil {
+		if errors.Is(err, repository.ErrTokenRevoked) {
+			return nil, s.tokenReused(stored.UserID)
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(user)
+}
+
+// tokenReused signs the user out of every session after a refresh token was reused
+func (s *AuthService) tokenReused(userID uint) error {
+	if err := s.repo.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	return ErrTokenReused
+}
+
+// Logout revokes the given refresh token, or all of the user's refresh tokens if none is given
+func (s *AuthService) Logout(userID uint, refreshToken string) error {
+	if refreshToken == "" {
+		return s.repo.RevokeUserRefreshTokens(userID)
+	}
+
+	stored, err := s.repo.FindRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != userID {
+		return ErrInvalidToken
+	}
+	if err := s.repo.RevokeRefreshToken(stored.ID); err != nil && !errors.Is(err, repository.ErrTokenRevoked) {
+		return err
+	}
+	return nil
+}
+
+// ParseToken validates a signed access token and returns its claims
+func (s *AuthService) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.secret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// HashPassword hashes a plain-text password for storage
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (s *AuthService) issueTokens(user *models.User) (*models.AuthResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL)
+
+	claims := Claims{
+		UserID:    user.ID,
+		Role:      user.Role,
+		PatientID: user.PatientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateRefreshToken(&models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		User:         *user,
+	}, nil
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestAuthService(t *testing.T, db *gorm.DB) (*AuthService, *models.User) {
+	t.Helper()
+	user := createTestUser(t, db, models.RoleNurse, nil)
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(user).Update("password", hash).Error)
+	return NewAuthService(repository.NewUserRepository(db), "test-secret", 15*time.Minute), user
+}
+
+func TestLogin(t *testing.T) {
+	db := openTestDB(t)
+	s, user := newTestAuthService(t, db)
+	inactive := createTestUser(t, db, models.RoleNurse, nil)
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(inactive).Updates(map[string]interface{}{"password": hash, "active": false}).Error)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{"valid", user.Username, "correct horse", nil},
+		{"wrong password", user.Username, "wrong", ErrInvalidCredentials},
+		{"unknown user", "nobody", "correct horse", ErrInvalidCredentials},
+		{"inactive user", inactive.Username, "correct horse", ErrInactiveUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := s.Login(tt.username, tt.password)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, auth.RefreshToken)
+			claims, err := s.ParseToken(auth.Token)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, claims.UserID)
+			assert.Equal(t, models.RoleNurse, claims.Role)
+		})
+	}
+}
+
+// TestRefreshRotation checks a refresh token can be used once, and that using
+// it again signs the user out everywhere
+func TestRefreshRotation(t *testing.T) {
+	db := openTestDB(t)
+	s, user := newTestAuthService(t, db)
+
+	first, err := s.Login(user.Username, "correct horse")
+	require.NoError(t, err)
+	other, err := s.Login(user.Username, "correct horse") // a second device
+	require.NoError(t, err)
+
+	second, err := s.Refresh(first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, err = s.Refresh(first.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = s.Refresh(second.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused, "the rotated token is revoked too")
+	_, err = s.Refresh(other.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused, "every session is signed out")
+
+	_, err = s.Refresh("not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+// TestRevokeRefreshTokenOnce checks only one of two concurrent refreshes with
+// the same token can revoke it; the other is treated as reuse
+func TestRevokeRefreshTokenOnce(t *testing.T) {
+	db := openTestDB(t)
+	s, user := newTestAuthService(t, db)
+	auth, err := s.Login(user.Username, "correct horse")
+	require.NoError(t, err)
+
+	users := repository.NewUserRepository(db)
+	stored, err := users.FindRefreshToken(hashToken(auth.RefreshToken))
+	require.NoError(t, err)
+	require.NoError(t, users.RevokeRefreshToken(stored.ID))
+	assert.ErrorIs(t, users.RevokeRefreshToken(stored.ID), repository.ErrTokenRevoked)
+
+	_, err = s.Refresh(auth.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused)
+}
+
+func TestLogout(t *testing.T) {
+	db := openTestDB(t)
+	s, user := newTestAuthService(t, db)
+
+	first, err := s.Login(user.Username, "correct horse")
+	require.NoError(t, err)
+	second, err := s.Login(user.Username, "correct horse")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.Logout(user.ID+1, first.RefreshToken), ErrInvalidToken, "another user's token")
+	require.NoError(t, s.Logout(user.ID, first.RefreshToken))
+	require.NoError(t, s.Logout(user.ID, first.RefreshToken), "logging out twice")
+	require.NoError(t, s.Logout(user.ID, "unknown"))
+	_, err = s.Refresh(second.RefreshToken)
+	require.NoError(t, err, "other sessions stay signed in")
+
+	third, err := s.Login(user.Username, "correct horse")
+	require.NoError(t, err)
+	require.NoError(t, s.Logout(user.ID, ""))
+	_, err = s.Refresh(third.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseToken(t *testing.T) {
+	s := NewAuthService(nil, "test-secret", time.Minute)
+	patientID := uint(7)
+	sign := func(method jwt.SigningMethod, key interface{}, expires time.Time) string {
+		claims := Claims{UserID: 3, Role: models.RolePatient, PatientID: &patientID,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expires)}}
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		require.NoError(t, err)
+		return token
+	}
+	later := time.Now().Add(time.Minute)
+
+	claims, err := s.ParseToken(sign(jwt.SigningMethodHS256, []byte("test-secret"), later))
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), claims.UserID)
+	require.NotNil(t, claims.PatientID)
+	assert.Equal(t, patientID, *claims.PatientID)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other secret", sign(jwt.SigningMethodHS256, []byte("other"), later)},
+		{"expired", sign(jwt.SigningMethodHS256, []byte("test-secret"), time.Now().Add(-time.Minute))},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, later)},
+		{"malformed", "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ParseToken(tt.token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -16,56 +17,48 @@ func NewADTService(repo *repository.ADTRepository) *ADTService {
 	return &ADTService{repo: repo}
 }
 
-func (s *ADTService) CreateWard(ward *models.Ward) error {
-	return s.repo.CreateWard(ward)
+func (s *ADTService) CreateWard(ctx context.Context, ward *models.Ward) error {
+	return s.repo.CreateWard(ctx, ward)
 }
 
-func (s *ADTService) ListWards() ([]models.Ward, error) {
-	return s.repo.ListWards()
+func (s *ADTService) ListWards(q repository.ListQuery) (*repository.Page[models.Ward], error) {
+	return s.repo.ListWards(q)
 }
 
-func (s *ADTService) CreateRoom(room *models.Room) error {
-	return s.repo.CreateRoom(room)
+func (s *ADTService) CreateRoom(ctx context.Context, room *models.Room) error {
+	return s.repo.CreateRoom(ctx, room)
 }
 
-func (s *ADTService) CreateBed(bed *models.Bed) error {
-	return s.repo.CreateBed(bed)
+func (s *ADTService) CreateBed(ctx context.Context, bed *models.Bed) error {
+	return s.repo.CreateBed(ctx, bed)
 }
 
-func (s *ADTService) ListBeds(status string) ([]models.Bed, error) {
-	return s.repo.ListBeds(status)
+func (s *ADTService) ListBeds(q repository.ListQuery) (*repository.Page[models.Bed], error) {
+	return s.repo.ListBeds(q)
 }
 
-func (s *ADTService) AdmitPatient(admission *models.Admission) error {
+func (s *ADTService) AdmitPatient(ctx context.Context, admission *models.Admission) error {
 	// Validate bed availability
-	beds, err := s.repo.ListBeds("Available")
+	isAvailable, err := s.repo.IsBedAvailable(admission.BedID)
 	if err != nil {
 		return err
 	}
 
-	isAvailable := false
-	for _, bed := range beds {
-		if bed.ID == admission.BedID {
-			isAvailable = true
-			break
-		}
-	}
-
 	if !isAvailable {
 		return errors.New("selected bed is not available")
 	}
 
 	admission.AdmissionDate = time.Now()
 	admission.Status = "Admitted"
-	return s.repo.CreateAdmission(admission)
+	return s.repo.CreateAdmission(ctx, admission)
 }
 
-func (s *ADTService) DischargePatient(admissionID uint) error {
-	return s.repo.DischargePatient(admissionID)
+func (s *ADTService) DischargePatient(ctx context.Context, admissionID uint) error {
+	return s.repo.DischargePatient(ctx, admissionID)
 }
 
-func (s *ADTService) ListActiveAdmissions() ([]models.Admission, error) {
-	return s.repo.ListAdmissions("Admitted")
+func (s *ADTService) ListActiveAdmissions(q repository.ListQuery) (*repository.Page[models.Admission], error) {
+	return s.repo.ListAdmissions("Admitted", q)
 }
 
 func (s *ADTService) GetAdmission(id uint) (*models.Admission, error) {
@@ -73,44 +66,36 @@ func (s *ADTService) GetAdmission(id uint) (*models.Admission, error) {
 }
 
 // TransferPatient transfers a patient to a new ward/bed
-func (s *ADTService) TransferPatient(transfer *models.Transfer) error {
+func (s *ADTService) TransferPatient(ctx context.Context, transfer *models.Transfer) error {
 	// Validate destination bed is available
-	beds, err := s.repo.ListBeds("Available")
+	isAvailable, err := s.repo.IsBedAvailable(transfer.ToBedID)
 	if err != nil {
 		return err
 	}
 
-	isAvailable := false
-	for _, bed := range beds {
-		if bed.ID == transfer.ToBedID {
-			isAvailable = true
-			break
-		}
-	}
-
 	if !isAvailable {
 		return errors.New("destination bed is not available")
 	}
 
 	transfer.TransferDate = time.Now()
-	return s.repo.CreateTransfer(transfer)
+	return s.repo.CreateTransfer(ctx, transfer)
 }
 
-func (s *ADTService) ListTransfers(admissionID uint) ([]models.Transfer, error) {
-	return s.repo.ListTransfers(admissionID)
+func (s *ADTService) ListTransfers(q repository.ListQuery) (*repository.Page[models.Transfer], error) {
+	return s.repo.ListTransfers(q)
 }
 
 // CreateDischargeSummary creates a discharge summary and updates admission status
-func (s *ADTService) CreateDischargeSummary(summary *models.DischargeSummary) error {
+func (s *ADTService) CreateDischargeSummary(ctx context.Context, summary *models.DischargeSummary) error {
 	summary.DischargeDate = time.Now()
 
 	// Create the summary
-	if err := s.repo.CreateDischargeSummary(summary); err != nil {
+	if err := s.repo.CreateDischargeSummary(ctx, summary); err != nil {
 		return err
 	}
 
 	// Discharge the patient
-	return s.repo.DischargePatient(summary.AdmissionID)
+	return s.repo.DischargePatient(ctx, summary.AdmissionID)
 }
 
 func (s *ADTService) GetDischargeSummary(admissionID uint) (*models.DischargeSummary, error) {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -15,36 +16,64 @@ func NewAppointmentService(repo *repository.AppointmentRepository) *AppointmentS
 	return &AppointmentService{repo: repo}
 }
 
-func (s *AppointmentService) CreateAppointment(appointment *models.Appointment) (*models.Appointment, error) {
+func (s *AppointmentService) CreateAppointment(ctx context.Context, appointment *models.Appointment) (*models.Appointment, error) {
 	if appointment.Status == "" {
 		appointment.Status = "scheduled"
 	}
-	return s.repo.Create(appointment)
+	return s.repo.Create(ctx, appointment)
 }
 
 func (s *AppointmentService) GetAppointmentByID(id uint) (*models.Appointment, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *AppointmentService) UpdateAppointment(appointment *models.Appointment) (*models.Appointment, error) {
-	return s.repo.Update(appointment)
+// UpdateAppointment saves changes to an appointment. Who booked and who
+// cancelled it stay as recorded.
+func (s *AppointmentService) UpdateAppointment(ctx context.Context, appointment *models.Appointment) (*models.Appointment, error) {
+	current, err := s.repo.FindByID(appointment.ID)
+	if err != nil {
+		return nil, err
+	}
+	appointment.CreatedBy = current.CreatedBy
+	appointment.CancelledBy = current.CancelledBy
+	return s.repo.Update(ctx, appointment)
 }
 
-func (s *AppointmentService) CancelAppointment(id uint, reason string, cancelledBy uint) (*models.Appointment, error) {
+func (s *AppointmentService) CancelAppointment(ctx context.Context, id uint, reason string, cancelledBy uint) (*models.Appointment, error) {
 	appointment, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 	appointment.Cancel(reason, cancelledBy)
-	return s.repo.Update(appointment)
+	return s.repo.Update(ctx, appointment)
 }
 
-func (s *AppointmentService) ListAppointmentsByDate(date time.Time) ([]*models.Appointment, error) {
+func (s *AppointmentService) ListAppointmentsByDate(date time.Time, q repository.ListQuery) (*repository.Page[models.Appointment], error) {
 	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	end := start.Add(24 * time.Hour)
-	return s.repo.ListByDateRange(start, end)
+	return s.repo.ListByDateRange(start, end, q)
 }
 
-func (s *AppointmentService) ListPatientAppointments(patientID uint) ([]*models.Appointment, error) {
-	return s.repo.ListByPatient(patientID)
+func (s *AppointmentService) ListPatientAppointments(patientID uint, q repository.ListQuery) (*repository.Page[models.Appointment], error) {
+	return s.repo.ListByPatient(patientID, q)
+}
+
+// ListDueReminders returns the appointments starting within the window whose
+// patients should get a reminder now. Patients without an SMS reminder
+// consent are left out.
+func (s *AppointmentService) ListDueReminders(window time.Duration) ([]*models.Appointment, error) {
+	now := time.Now()
+	return s.repo.ListDueReminders(now, now.Add(window))
+}
+
+// MarkReminderSent records that the appointment's reminder went out
+func (s *AppointmentService) MarkReminderSent(ctx context.Context, id uint) (*models.Appointment, error) {
+	appointment, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	appointment.ReminderSent = true
+	appointment.ReminderSentAt = &now
+	return s.repo.Update(ctx, appointment)
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// ErrDeviceKey is returned for an unknown device key
+var ErrDeviceKey = errors.New("invalid device key")
+
+// ErrDeviceMismatch is returned when a message names another device than the
+// one whose key sent it
+var ErrDeviceMismatch = errors.New("message is from another device")
+
+type DeviceService struct {
+	repo   *repository.DeviceRepository
+	vitals *VitalSignsService
+}
+
+func NewDeviceService(repo *repository.DeviceRepository, vitals *VitalSignsService) *DeviceService {
+	return &DeviceService{repo: repo, vitals: vitals}
+}
+
+// RegisterDevice registers a device and returns its ingestion key. Only the
+// key's hash is stored, so the key is shown this once.
+func (s *DeviceService) RegisterDevice(ctx context.Context, device *models.Device) (*models.Device, string, error) {
+	device.Identifier = strings.TrimSpace(device.Identifier)
+	if err := device.Validate(); err != nil {
+		return nil, "", err
+	}
+	key, hash, err := newDeviceKey()
+	if err != nil {
+		return nil, "", err
+	}
+	device.KeyHash = hash
+	device.Active = true
+	created, err := s.repo.Create(ctx, device)
+	if err != nil {
+		return nil, "", err
+	}
+	return created, key, nil
+}
+
+// RotateKey replaces a device's ingestion key
+func (s *DeviceService) RotateKey(ctx context.Context, id uint) (*models.Device, string, error) {
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	key, hash, err := newDeviceKey()
+	if err != nil {
+		return nil, "", err
+	}
+	device.KeyHash = hash
+	updated, err := s.repo.Update(ctx, device)
+	if err != nil {
+		return nil, "", err
+	}
+	return updated, key, nil
+}
+
+func newDeviceKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := hex.EncodeToString(b)
+	return key, hashDeviceKey(key), nil
+}
+
+func hashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *DeviceService) GetDevice(id uint) (*models.Device, error) {
+	return s.repo.FindByID(id)
+}
+
+// UpdateDevice saves a device's details, bed and active flag; its identifier
+// and key are kept
+func (s *DeviceService) UpdateDevice(ctx context.Context, id uint, update *models.Device) (*models.Device, error) {
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	device.Name = update.Name
+	device.Kind = update.Kind
+	device.Manufacturer = update.Manufacturer
+	device.Model = update.Model
+	device.BedID = update.BedID
+	device.Active = update.Active
+	if err := device.Validate(); err != nil {
+		return nil, err
+	}
+	device.Bed = nil
+	return s.repo.Update(ctx, device)
+}
+
+func (s *DeviceService) ListDevices(q repository.ListQuery) (*repository.Page[models.Device], error) {
+	return s.repo.List(q)
+}
+
+// Authenticate returns the active device holding a key
+func (s *DeviceService) Authenticate(key string) (*models.Device, error) {
+	device, err := s.repo.FindByKeyHash(hashDeviceKey(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDeviceKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !device.Active {
+		return nil, models.ErrDeviceInactive
+	}
+	return device, nil
+}
+
+// Ingest records a device reading for the patient who was admitted to the
+// device's bed when it was measured, on their encounter under way then,
+// pending a nurse's validation. Readings dated in the future or outside any
+// admission are rejected. equipmentID is the device identifier the message
+// names, if any; it must be the device's own. A reading the device already
+// sent is returned with false.
+func (s *DeviceService) Ingest(ctx context.Context, device *models.Device, reading *models.DeviceReading, equipmentID string) (*models.VitalSigns, bool, error) {
+	if equipmentID != "" && !strings.EqualFold(equipmentID, device.Identifier) {
+		return nil, false, fmt.Errorf("%w: %s", ErrDeviceMismatch, equipmentID)
+	}
+	if reading.Empty() {
+		return nil, false, models.ErrDeviceReadingEmpty
+	}
+	if device.BedID == nil {
+		return nil, false, models.ErrDeviceNoBed
+	}
+
+	now := time.Now()
+	measured, err := reading.Measured(now)
+	if err != nil {
+		return nil, false, err
+	}
+
+	patientID, err := s.repo.AdmittedPatientAtBed(*device.BedID, measured)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, false, models.ErrDeviceNoPatient
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	encounterID, err := s.repo.EncounterAt(patientID, measured)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, false, models.ErrDeviceNoEncounter
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	vitals, created, err := s.vitals.RecordDeviceReading(ctx, reading.VitalSigns(device, encounterID, patientID, measured))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.repo.Touch(device.ID, now); err != nil {
+		return nil, false, err
+	}
+	return vitals, created, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// ParseEarlyWarningThresholds reads escalation thresholds such as
+// "NEWS2:urgent=5,emergency=7;PEWS:urgent=3,emergency=5". A scoring system
+// left out keeps its default thresholds; an empty spec gives the defaults.
+func ParseEarlyWarningThresholds(spec string) (models.EarlyWarningThresholds, error) {
+	thresholds := models.DefaultEarlyWarningThresholds()
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		system, levels, ok := strings.Cut(part, ":")
+		system = strings.ToUpper(strings.TrimSpace(system))
+		if !ok || (system != models.EarlyWarningNEWS2 && system != models.EarlyWarningPEWS) {
+			return nil, fmt.Errorf("invalid early warning thresholds %q: expected NEWS2 or PEWS followed by a colon", part)
+		}
+
+		var parsed []models.EarlyWarningThreshold
+		for _, level := range strings.Split(levels, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(level), "=")
+			score, err := strconv.Atoi(strings.TrimSpace(value))
+			if !ok || strings.TrimSpace(name) == "" || err != nil || score < 0 {
+				return nil, fmt.Errorf("invalid early warning threshold %q for %s: expected level=score", level, system)
+			}
+			parsed = append(parsed, models.EarlyWarningThreshold{Level: strings.TrimSpace(name), Score: score})
+		}
+		thresholds[system] = parsed
+	}
+	thresholds.Sort()
+	return thresholds, nil
+}
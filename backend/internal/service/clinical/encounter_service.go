@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -15,45 +17,89 @@ func NewEncounterService(repo *repository.EncounterRepository) *EncounterService
 	return &EncounterService{repo: repo}
 }
 
-func (s *EncounterService) CreateEncounter(encounter *models.Encounter) (*models.Encounter, error) {
+func (s *EncounterService) CreateEncounter(ctx context.Context, encounter *models.Encounter, createdBy uint) (*models.Encounter, error) {
 	// Set default status if empty
 	if encounter.Status == "" {
-		encounter.Status = "planned"
+		encounter.Status = models.EncounterStatusPlanned
+	}
+	if !models.IsValidEncounterStatus(encounter.Status) {
+		return nil, models.ErrInvalidEncounterStatus
 	}
 	// Set default period start if empty
 	if encounter.PeriodStart.IsZero() {
 		encounter.PeriodStart = time.Now()
 	}
-	return s.repo.Create(encounter)
+	return s.repo.Create(ctx, encounter, createdBy)
 }
 
 func (s *EncounterService) GetEncounterByID(id uint) (*models.Encounter, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *EncounterService) UpdateEncounter(encounter *models.Encounter) (*models.Encounter, error) {
-	return s.repo.Update(encounter)
+// UpdateEncounter saves changes to an encounter. A changed status must be a
+// transition the workflow allows and is recorded in the status history; an
+// empty status keeps the current one.
+func (s *EncounterService) UpdateEncounter(ctx context.Context, encounter *models.Encounter, changedBy uint) (*models.Encounter, error) {
+	current, err := s.repo.FindByID(encounter.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := encounter.Status
+	encounter.Status = current.Status
+	encounter.CreatedAt = current.CreatedAt
+	if status == "" || status == current.Status {
+		return s.repo.Update(ctx, encounter)
+	}
+	return s.changeStatus(ctx, encounter, status, "", changedBy)
 }
 
-func (s *EncounterService) ListPatientEncounters(patientID uint, page, limit int) ([]*models.Encounter, int64, error) {
-	offset := (page - 1) * limit
-	return s.repo.ListByPatient(patientID, offset, limit)
+func (s *EncounterService) ListPatientEncounters(patientID uint, q repository.ListQuery) (*repository.Page[models.Encounter], error) {
+	return s.repo.ListByPatient(patientID, q)
 }
 
-func (s *EncounterService) StartEncounter(id uint) (*models.Encounter, error) {
+// ChangeStatus moves an encounter to status. Marking an encounter
+// entered-in-error needs a reason.
+func (s *EncounterService) ChangeStatus(ctx context.Context, id uint, status, reason string, changedBy uint) (*models.Encounter, error) {
 	encounter, err := s.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	encounter.Start()
-	return s.repo.Update(encounter)
+	return s.changeStatus(ctx, encounter, status, reason, changedBy)
 }
 
-func (s *EncounterService) FinishEncounter(id uint) (*models.Encounter, error) {
-	encounter, err := s.repo.FindByID(id)
-	if err != nil {
+func (s *EncounterService) changeStatus(ctx context.Context, encounter *models.Encounter, status, reason string, changedBy uint) (*models.Encounter, error) {
+	if status == models.EncounterStatusEnteredInError && strings.TrimSpace(reason) == "" {
+		return nil, models.ErrEncounterReasonRequired
+	}
+	from := encounter.Status
+	now := time.Now()
+	if err := encounter.TransitionTo(status, now); err != nil {
 		return nil, err
 	}
-	encounter.Finish()
-	return s.repo.Update(encounter)
+	return s.repo.UpdateStatus(ctx, encounter, &models.EncounterStatusHistory{
+		FromStatus: from,
+		Status:     status,
+		ChangedAt:  now,
+		ChangedBy:  changedBy,
+		Reason:     strings.TrimSpace(reason),
+	})
+}
+
+// GetStatusHistory returns the encounter's status changes, oldest first, and
+// the waiting and service times derived from them
+func (s *EncounterService) GetStatusHistory(id uint) ([]models.EncounterStatusHistory, models.EncounterTimes, error) {
+	if _, err := s.repo.FindByID(id); err != nil {
+		return nil, models.EncounterTimes{}, err
+	}
+	history, err := s.repo.ListStatusHistory(id)
+	if err != nil {
+		return nil, models.EncounterTimes{}, err
+	}
+	return history, models.EncounterTimesFrom(history), nil
+}
+
+// WaitTimes summarizes door-to-triage and door-to-doctor times of the
+// encounters that arrived in [from, to)
+func (s *EncounterService) WaitTimes(from, to time.Time, serviceCategory string) (*models.EncounterWaitTimes, error) {
+	return s.repo.WaitTimes(from, to, serviceCategory)
 }
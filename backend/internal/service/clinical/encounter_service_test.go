@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeEncounterStatus(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewEncounterRepository(db)
+	s := NewEncounterService(repo)
+	ctx := context.Background()
+	patient := createTestPatient(t, db, "encounter")
+
+	encounter, err := s.CreateEncounter(ctx, &models.Encounter{PatientID: patient.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.EncounterStatusPlanned, encounter.Status)
+
+	// Two users read the planned encounter; only the first change is applied
+	first, err := s.GetEncounterByID(encounter.ID)
+	require.NoError(t, err)
+	second, err := s.GetEncounterByID(encounter.ID)
+	require.NoError(t, err)
+	_, err = s.changeStatus(ctx, first, models.EncounterStatusArrived, "", 1)
+	require.NoError(t, err)
+	_, err = s.changeStatus(ctx, second, models.EncounterStatusCancelled, "", 2)
+	assert.ErrorIs(t, err, repository.ErrEncounterStatusConflict)
+
+	// A stale save does not put the old status back
+	second, err = s.GetEncounterByID(encounter.ID)
+	require.NoError(t, err)
+	second.Status = models.EncounterStatusPlanned
+	_, err = repo.Update(ctx, second)
+	assert.ErrorIs(t, err, repository.ErrEncounterStatusConflict)
+
+	// entered-in-error needs a reason
+	_, err = s.ChangeStatus(ctx, encounter.ID, models.EncounterStatusEnteredInError, "  ", 1)
+	assert.ErrorIs(t, err, models.ErrEncounterReasonRequired)
+	_, err = s.ChangeStatus(ctx, encounter.ID, models.EncounterStatusEnteredInError, " wrong patient ", 1)
+	require.NoError(t, err)
+	_, err = s.ChangeStatus(ctx, encounter.ID, models.EncounterStatusArrived, "", 1)
+	assert.ErrorIs(t, err, models.ErrEncounterTransition)
+
+	history, _, err := s.GetStatusHistory(encounter.ID)
+	require.NoError(t, err)
+	statuses := make([]string, len(history))
+	for i, entry := range history {
+		statuses[i] = entry.Status
+	}
+	assert.Equal(t, []string{models.EncounterStatusPlanned, models.EncounterStatusArrived, models.EncounterStatusEnteredInError}, statuses)
+	assert.Equal(t, models.EncounterStatusArrived, history[2].FromStatus)
+	assert.Equal(t, "wrong patient", history[2].Reason)
+}
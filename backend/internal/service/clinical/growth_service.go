@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// growthStandardFiles are the WHO Anthro (igrowup) reference files of each
+// indicator and the column holding their age or length
+var growthStandardFiles = []struct {
+	indicator, file, key string
+}{
+	{models.GrowthWeightForAge, "weianthro.txt", "age"},
+	{models.GrowthLengthForAge, "lenanthro.txt", "age"},
+	{models.GrowthWeightForLength, "wflanthro.txt", "length"},
+	{models.GrowthWeightForHeight, "wfhanthro.txt", "height"},
+	{models.GrowthMUACForAge, "acanthro.txt", "age"},
+}
+
+// LoadGrowthStandards reads the WHO child growth standards from the
+// tab-separated reference files of the WHO Anthro software in dir
+// (weianthro.txt, lenanthro.txt, wflanthro.txt, wfhanthro.txt and
+// acanthro.txt, with sex, age or length, l, m and s columns). Files that are
+// missing leave their indicator out. An empty dir gives nil standards.
+func LoadGrowthStandards(dir string) (*models.GrowthStandards, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	standards := models.NewGrowthStandards()
+	for _, f := range growthStandardFiles {
+		err := loadGrowthStandard(standards, filepath.Join(dir, f.file), f.indicator, f.key)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return standards, nil
+}
+
+func loadGrowthStandard(standards *models.GrowthStandards, path, indicator, key string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return fmt.Errorf("%s: empty file", path)
+	}
+	columns := map[string]int{}
+	for i, name := range strings.Fields(strings.ToLower(scanner.Text())) {
+		columns[name] = i
+	}
+	for _, name := range []string{"sex", key, "l", "m", "s"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("%s: missing %s column", path, name)
+		}
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		values := map[string]float64{}
+		for _, name := range []string{key, "l", "m", "s"} {
+			i := columns[name]
+			if i >= len(fields) {
+				return fmt.Errorf("%s:%d: missing %s", path, line, name)
+			}
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid %s: %w", path, line, name, err)
+			}
+			values[name] = v
+		}
+		var sex string
+		switch fields[columns["sex"]] {
+		case "1":
+			sex = "male"
+		case "2":
+			sex = "female"
+		default:
+			return fmt.Errorf("%s:%d: sex must be 1 or 2", path, line)
+		}
+		standards.Add(indicator, sex, values[key], models.LMS{L: values["l"], M: values["m"], S: values["s"]})
+	}
+	return scanner.Err()
+}
+
+type GrowthService struct {
+	vitals    *repository.VitalSignsRepository
+	patients  *PatientService
+	standards *models.GrowthStandards
+}
+
+func NewGrowthService(vitals *repository.VitalSignsRepository, patients *PatientService, standards *models.GrowthStandards) *GrowthService {
+	return &GrowthService{vitals: vitals, patients: patients, standards: standards}
+}
+
+// PatientGrowth returns the growth assessments of a child's measurements
+// before their fifth birthday, oldest first
+func (s *GrowthService) PatientGrowth(patientID uint) (*models.GrowthChart, error) {
+	patient, err := s.patients.GetPatientByID(patientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.BirthDate == nil {
+		return nil, models.ErrGrowthBirthDate
+	}
+	if patient.Gender != "male" && patient.Gender != "female" {
+		return nil, models.ErrGrowthSex
+	}
+
+	observations, err := s.vitals.ListAnthropometry(patientID)
+	if err != nil {
+		return nil, err
+	}
+	chart := &models.GrowthChart{PatientID: patientID, Sex: patient.Gender, BirthDate: *patient.BirthDate,
+		Standards: []string{}, Assessments: []models.GrowthAssessment{}}
+	for _, f := range growthStandardFiles {
+		if s.standards.Has(f.indicator) {
+			chart.Standards = append(chart.Standards, f.indicator)
+		}
+	}
+	for _, v := range observations {
+		if a, ok := s.standards.AssessGrowth(v, patient); ok {
+			chart.Assessments = append(chart.Assessments, a)
+		}
+	}
+	return chart, nil
+}
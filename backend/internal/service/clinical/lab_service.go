@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -15,33 +16,33 @@ func NewLabService(repo *repository.LabRepository) *LabService {
 	return &LabService{repo: repo}
 }
 
-func (s *LabService) CreateLabTest(test *models.LabTest) (*models.LabTest, error) {
-	return s.repo.CreateLabTest(test)
+func (s *LabService) CreateLabTest(ctx context.Context, test *models.LabTest) (*models.LabTest, error) {
+	return s.repo.CreateLabTest(ctx, test)
 }
 
-func (s *LabService) ListLabTests() ([]*models.LabTest, error) {
-	return s.repo.ListLabTests()
+func (s *LabService) ListLabTests(q repository.ListQuery) (*repository.Page[models.LabTest], error) {
+	return s.repo.ListLabTests(q)
 }
 
-func (s *LabService) CreateLabOrder(order *models.LabOrder) (*models.LabOrder, error) {
+func (s *LabService) CreateLabOrder(ctx context.Context, order *models.LabOrder) (*models.LabOrder, error) {
 	if order.OrderDate.IsZero() {
 		order.OrderDate = time.Now()
 	}
 	if order.Status == "" {
 		order.Status = "ordered"
 	}
-	return s.repo.CreateLabOrder(order)
+	return s.repo.CreateLabOrder(ctx, order)
 }
 
 func (s *LabService) GetLabOrderByID(id uint) (*models.LabOrder, error) {
 	return s.repo.FindLabOrderByID(id)
 }
 
-func (s *LabService) ListPatientLabOrders(patientID uint) ([]*models.LabOrder, error) {
-	return s.repo.ListLabOrdersByPatient(patientID)
+func (s *LabService) ListPatientLabOrders(patientID uint, q repository.ListQuery) (*repository.Page[models.LabOrder], error) {
+	return s.repo.ListLabOrdersByPatient(patientID, q)
 }
 
-func (s *LabService) AddLabResult(result *models.LabResult) (*models.LabResult, error) {
+func (s *LabService) AddLabResult(ctx context.Context, result *models.LabResult) (*models.LabResult, error) {
 	// Fetch the test definition to check reference ranges
 	test, err := s.repo.FindLabTestByID(result.LabTestID)
 	if err == nil {
@@ -53,5 +54,5 @@ func (s *LabService) AddLabResult(result *models.LabResult) (*models.LabResult,
 		result.ResultDate = time.Now()
 	}
 
-	return s.repo.CreateLabResult(result)
+	return s.repo.CreateLabResult(ctx, result)
 }
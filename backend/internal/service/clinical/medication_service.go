@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
@@ -20,8 +21,8 @@ func NewMedicationService(repo *repository.MedicationRepository, cdsService *CDS
 }
 
 // Medication methods
-func (s *MedicationService) CreateMedication(med *models.Medication) (*models.Medication, error) {
-	return s.repo.CreateMedication(med)
+func (s *MedicationService) CreateMedication(ctx context.Context, med *models.Medication) (*models.Medication, error) {
+	return s.repo.CreateMedication(ctx, med)
 }
 
 func (s *MedicationService) SearchMedications(query string) ([]*models.Medication, error) {
@@ -29,31 +30,31 @@ func (s *MedicationService) SearchMedications(query string) ([]*models.Medicatio
 }
 
 // Prescription methods
-func (s *MedicationService) CreatePrescription(prescription *models.Prescription) (*models.Prescription, error) {
+func (s *MedicationService) CreatePrescription(ctx context.Context, prescription *models.Prescription) (*models.Prescription, error) {
 	if prescription.StartDate.IsZero() {
 		prescription.StartDate = time.Now()
 	}
 	if prescription.Status == "" {
 		prescription.Status = "active"
 	}
-	return s.repo.CreatePrescription(prescription)
+	return s.repo.CreatePrescription(ctx, prescription)
 }
 
 func (s *MedicationService) GetPrescriptionByID(id uint) (*models.Prescription, error) {
 	return s.repo.FindPrescriptionByID(id)
 }
 
-func (s *MedicationService) DiscontinuePrescription(id uint, reason string) (*models.Prescription, error) {
+func (s *MedicationService) DiscontinuePrescription(ctx context.Context, id uint, reason string) (*models.Prescription, error) {
 	prescription, err := s.repo.FindPrescriptionByID(id)
 	if err != nil {
 		return nil, err
 	}
 	prescription.Discontinue(reason)
-	return s.repo.UpdatePrescription(prescription)
+	return s.repo.UpdatePrescription(ctx, prescription)
 }
 
-func (s *MedicationService) ListPatientPrescriptions(patientID uint) ([]*models.Prescription, error) {
-	return s.repo.ListPrescriptionsByPatient(patientID)
+func (s *MedicationService) ListPatientPrescriptions(patientID uint, q repository.ListQuery) (*repository.Page[models.Prescription], error) {
+	return s.repo.ListPrescriptionsByPatient(patientID, q)
 }
 
 func (s *MedicationService) ListActivePrescriptions(patientID uint) ([]*models.Prescription, error) {
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// cvdRiskChartColumns are the columns of a CVD risk chart file
+var cvdRiskChartColumns = []string{"chart", "sex", "diabetes", "smoker", "age", "sbp", "factor", "risk"}
+
+// LoadCVDRiskCharts reads the WHO CVD risk charts of a region from a CSV file
+// with one row per chart cell: chart (lab or non-lab), sex (male or female),
+// diabetes and smoker (0 or 1), the lower bounds of the age, systolic BP and
+// total cholesterol (mmol/L) or BMI band, and the 10-year risk in percent.
+// The lowest bands start at 0. An empty path gives nil charts.
+func LoadCVDRiskCharts(path string) (*models.CVDRiskCharts, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range cvdRiskChartColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s: missing %s column", path, name)
+		}
+	}
+
+	charts := models.NewCVDRiskCharts()
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		field := func(name string) string { return strings.TrimSpace(row[columns[name]]) }
+
+		chart, sex := field("chart"), field("sex")
+		if chart != models.CVDChartLab && chart != models.CVDChartNonLab {
+			return nil, fmt.Errorf("%s:%d: chart must be lab or non-lab", path, line)
+		}
+		if sex != "male" && sex != "female" {
+			return nil, fmt.Errorf("%s:%d: sex must be male or female", path, line)
+		}
+		flags := map[string]bool{}
+		for _, name := range []string{"diabetes", "smoker"} {
+			if field(name) == "" {
+				continue
+			}
+			if flags[name], err = strconv.ParseBool(field(name)); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid %s: %w", path, line, name, err)
+			}
+		}
+		values := map[string]float64{}
+		for _, name := range []string{"age", "sbp", "factor", "risk"} {
+			if values[name], err = strconv.ParseFloat(field(name), 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid %s: %w", path, line, name, err)
+			}
+		}
+		charts.Add(chart, sex, flags["diabetes"], flags["smoker"], values["age"], values["sbp"], values["factor"], values["risk"])
+	}
+	return charts, nil
+}
+
+type NCDScreeningService struct {
+	repo       *repository.NCDScreeningRepository
+	encounters *EncounterService
+	vitals     *VitalSignsService
+	programs   *ProgramService
+	charts     *models.CVDRiskCharts
+}
+
+func NewNCDScreeningService(repo *repository.NCDScreeningRepository, encounters *EncounterService, vitals *VitalSignsService, programs *ProgramService, charts *models.CVDRiskCharts) *NCDScreeningService {
+	return &NCDScreeningService{repo: repo, encounters: encounters, vitals: vitals, programs: programs, charts: charts}
+}
+
+// Checklists returns the answer options of the screening checklists
+func (s *NCDScreeningService) Checklists() models.NCDChecklists {
+	return models.NCDChecklists{
+		Symptoms:      models.NCDSymptoms,
+		FemaleHistory: models.NCDFemaleHistory,
+		WarningSigns:  models.NCDWarningSigns,
+		Conditions:    models.NCDConditions,
+	}
+}
+
+// StartScreening records Part B of an encounter's NCD screening at the
+// nursing station. An encounter has one screening.
+func (s *NCDScreeningService) StartScreening(ctx context.Context, screening *models.NCDScreening, screenedBy uint) (*models.NCDScreening, error) {
+	encounter, err := s.encounters.GetEncounterByID(screening.EncounterID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindByEncounter(encounter.ID); err == nil {
+		return nil, models.ErrNCDScreeningExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	partB := screening
+	screening = &models.NCDScreening{
+		EncounterID: encounter.ID,
+		PatientID:   encounter.PatientID,
+		Status:      models.NCDScreeningInProgress,
+	}
+	if err := s.applyPartB(ctx, screening, partB, encounter, screenedBy); err != nil {
+		return nil, err
+	}
+	return s.repo.Create(ctx, screening)
+}
+
+// UpdatePartB replaces Part B of a screening that is not completed yet.
+func (s *NCDScreeningService) UpdatePartB(ctx context.Context, id uint, partB *models.NCDScreening, screenedBy uint) (*models.NCDScreening, error) {
+	screening, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if screening.Status == models.NCDScreeningCompleted {
+		return nil, models.ErrNCDScreeningCompleted
+	}
+	encounter, err := s.encounters.GetEncounterByID(screening.EncounterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPartB(ctx, screening, partB, encounter, screenedBy); err != nil {
+		return nil, err
+	}
+	return s.repo.Update(ctx, screening)
+}
+
+// applyPartB copies the Part B answers onto the screening, takes its BP,
+// weight and height from the encounter's vital signs and assesses it
+func (s *NCDScreeningService) applyPartB(ctx context.Context, screening, partB *models.NCDScreening, encounter *models.Encounter, screenedBy uint) error {
+	screening.CurrentHistory = strings.TrimSpace(partB.CurrentHistory)
+	screening.Symptoms = partB.Symptoms
+	screening.FemaleHistory = partB.FemaleHistory
+	screening.WarningSigns = partB.WarningSigns
+	screening.FamilyHistory = partB.FamilyHistory
+	screening.TobaccoUse = partB.TobaccoUse
+	screening.SmokelessTobacco = partB.SmokelessTobacco
+	screening.AlcoholUse = partB.AlcoholUse
+	screening.FruitVegetableServings = partB.FruitVegetableServings
+	screening.PhysicalActivityMinutes = partB.PhysicalActivityMinutes
+	screening.ExtraSalt = partB.ExtraSalt
+	screening.VitalSignsID = partB.VitalSignsID
+	screening.SystolicBP = partB.SystolicBP
+	screening.DiastolicBP = partB.DiastolicBP
+	screening.Weight = partB.Weight
+	screening.Height = partB.Height
+	screening.WaistCircumference = partB.WaistCircumference
+	screening.BloodGlucose = partB.BloodGlucose
+	screening.GlucoseTest = partB.GlucoseTest
+	screening.ScreenedAt = time.Now()
+	screening.ScreenedBy = screenedBy
+
+	if err := screening.Validate(&encounter.Patient); err != nil {
+		return err
+	}
+	if err := s.useVitalSigns(ctx, screening, encounter.VitalSigns); err != nil {
+		return err
+	}
+	screening.Assess(&encounter.Patient, s.charts)
+	return nil
+}
+
+// useVitalSigns fills the screening's BP, weight and height from the chosen
+// vital signs of the encounter. Values entered without one are recorded as a
+// new measurement of the encounter; with neither, the encounter's latest
+// measurement is used.
+func (s *NCDScreeningService) useVitalSigns(ctx context.Context, screening *models.NCDScreening, measurements []models.VitalSigns) error {
+	if screening.VitalSignsID == nil && screening.HasMeasurements() {
+		vitals, err := s.vitals.CreateVitalSigns(ctx, screening.VitalSigns())
+		if err != nil {
+			return err
+		}
+		screening.VitalSignsID = &vitals.ID
+		return nil
+	}
+
+	var chosen *models.VitalSigns
+	for i := range measurements {
+		v := &measurements[i]
+		if screening.VitalSignsID != nil {
+			if v.ID == *screening.VitalSignsID {
+				chosen = v
+			}
+		} else if chosen == nil || v.MeasuredAt.After(chosen.MeasuredAt) {
+			chosen = v
+		}
+	}
+	if chosen == nil {
+		if screening.VitalSignsID != nil {
+			return models.ErrNCDVitalSignsNotFound
+		}
+		return nil
+	}
+	screening.UseVitalSigns(chosen)
+	return nil
+}
+
+// RecordPartC records the consultation (Part C) and completes the screening.
+// Part C can be revised until the patient is enrolled.
+func (s *NCDScreeningService) RecordPartC(ctx context.Context, id uint, partC *models.NCDScreening, consultedBy uint) (*models.NCDScreening, error) {
+	screening, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if screening.EnrolledAt != nil {
+		return nil, models.ErrNCDAlreadyEnrolled
+	}
+	if partC.Outcome == "" {
+		return nil, models.ErrNCDOutcomeRequired
+	}
+	encounter, err := s.encounters.GetEncounterByID(screening.EncounterID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	screening.KnownConditions = partC.KnownConditions
+	screening.CurrentMedications = strings.TrimSpace(partC.CurrentMedications)
+	screening.ClinicalAssessment = strings.TrimSpace(partC.ClinicalAssessment)
+	screening.TotalCholesterol = partC.TotalCholesterol
+	screening.HbA1c = partC.HbA1c
+	screening.Diagnoses = partC.Diagnoses
+	screening.DiagnosisNotes = strings.TrimSpace(partC.DiagnosisNotes)
+	screening.ManagementPlan = strings.TrimSpace(partC.ManagementPlan)
+	screening.FollowUpDate = partC.FollowUpDate
+	screening.Outcome = partC.Outcome
+	screening.Status = models.NCDScreeningCompleted
+	screening.ConsultedAt = &now
+	screening.ConsultedBy = &consultedBy
+
+	if err := screening.Validate(&encounter.Patient); err != nil {
+		return nil, err
+	}
+	screening.Assess(&encounter.Patient, s.charts)
+	return s.repo.Update(ctx, screening)
+}
+
+// Enrol records the patient's enrolment in NCD programs (Part D) from a
+// completed screening with outcome enrol, and starts their follow-up in each
+// program. Programs default to those the screening calls for.
+func (s *NCDScreeningService) Enrol(ctx context.Context, id uint, programs []string, ncdNumber string, bookIssued bool, enrolledBy uint) (*models.NCDScreening, error) {
+	screening, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := screening.Enrol(programs, enrolledBy, time.Now()); err != nil {
+		return nil, err
+	}
+	screening.NCDNumber = strings.TrimSpace(ncdNumber)
+	screening.NCDBookIssued = bookIssued
+	if _, err := s.programs.EnrolFromScreening(ctx, screening); err != nil {
+		return nil, err
+	}
+	return s.repo.Update(ctx, screening)
+}
+
+func (s *NCDScreeningService) GetScreening(id uint) (*models.NCDScreening, error) {
+	return s.repo.FindByID(id)
+}
+
+func (s *NCDScreeningService) GetEncounterScreening(encounterID uint) (*models.NCDScreening, error) {
+	return s.repo.FindByEncounter(encounterID)
+}
+
+// ListScreenings returns a page of screenings, latest first
+func (s *NCDScreeningService) ListScreenings(q repository.ListQuery) (*repository.Page[models.NCDScreening], error) {
+	return s.repo.List(q)
+}
+
+// ListPatientScreenings returns a page of a patient's screenings, latest first
+func (s *NCDScreeningService) ListPatientScreenings(patientID uint, q repository.ListQuery) (*repository.Page[models.NCDScreening], error) {
+	return s.repo.ListByPatient(patientID, q)
+}
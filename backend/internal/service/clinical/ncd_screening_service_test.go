@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCVDRiskCharts(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "charts.csv")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	charts, err := LoadCVDRiskCharts(write(`chart, sex, diabetes, smoker, age, sbp, factor, risk
+lab, male, 0, 1, 40, 0, 0, 4
+lab, male, 0, 1, 40, 140, 0, 9
+non-lab, female, , true, 50, 0, 25, 12
+`))
+	require.NoError(t, err)
+	risk, ok := charts.Risk(models.CVDChartLab, "male", false, true, 45, 150, 5)
+	require.True(t, ok)
+	assert.Equal(t, 9.0, risk)
+	risk, ok = charts.Risk(models.CVDChartNonLab, "female", true, true, 60, 120, 27)
+	require.True(t, ok)
+	assert.Equal(t, 12.0, risk)
+
+	charts, err = LoadCVDRiskCharts("")
+	require.NoError(t, err)
+	assert.Nil(t, charts)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"missing column", "chart,sex,diabetes,smoker,age,sbp,risk\n", "missing factor column"},
+		{"unknown chart", "chart,sex,diabetes,smoker,age,sbp,factor,risk\nscore,male,0,0,40,0,0,4\n", ":2: chart must be lab or non-lab"},
+		{"unknown sex", "chart,sex,diabetes,smoker,age,sbp,factor,risk\nlab,m,0,0,40,0,0,4\n", ":2: sex must be male or female"},
+		{"bad flag", "chart,sex,diabetes,smoker,age,sbp,factor,risk\nlab,male,yes,0,40,0,0,4\n", ":2: invalid diabetes"},
+		{"bad number", "chart,sex,diabetes,smoker,age,sbp,factor,risk\nlab,male,0,0,forty,0,0,4\n", ":2: invalid age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadCVDRiskCharts(write(tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+	_, err = LoadCVDRiskCharts(filepath.Join(t.TempDir(), "missing.csv"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestNCDScreeningParts records Parts B and C of a screening
+func TestNCDScreeningParts(t *testing.T) {
+	db := openTestDB(t)
+	patients := newTestPatientService(t, db)
+	encounters := NewEncounterService(repository.NewEncounterRepository(db))
+	vitals := NewVitalSignsService(repository.NewVitalSignsRepository(db), patients, models.DefaultEarlyWarningThresholds())
+	s := NewNCDScreeningService(repository.NewNCDScreeningRepository(db), encounters, vitals, nil, nil)
+	ctx := context.Background()
+
+	patient := createTestPatient(t, db, "ncd")
+	require.NoError(t, db.Model(patient).UpdateColumns(map[string]interface{}{
+		"birth_date": time.Now().AddDate(-50, 0, 0), "gender": "female",
+	}).Error)
+	newEncounter := func() *models.Encounter {
+		encounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: patient.ID, Class: models.EncounterClassAmbulatory}, 1)
+		require.NoError(t, err)
+		return encounter
+	}
+	bp := func(i int) *int { return &i }
+
+	// BP entered at screening is recorded as the encounter's vital signs
+	encounter := newEncounter()
+	screening, err := s.StartScreening(ctx, &models.NCDScreening{
+		EncounterID: encounter.ID, SystolicBP: bp(150), DiastolicBP: bp(95), TobaccoUse: models.UseCurrent,
+	}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.NCDScreeningInProgress, screening.Status)
+	assert.Equal(t, patient.ID, screening.PatientID)
+	assert.Equal(t, models.NCDFindingSuspected, screening.HypertensionFinding)
+	assert.Equal(t, []string{models.RiskFactorTobacco}, screening.RiskFactors)
+	require.NotNil(t, screening.VitalSignsID)
+	recorded, err := vitals.GetVitalSignsByID(*screening.VitalSignsID)
+	require.NoError(t, err)
+	assert.Equal(t, encounter.ID, recorded.EncounterID)
+	assert.Equal(t, 150, *recorded.SystolicBP)
+
+	_, err = s.StartScreening(ctx, &models.NCDScreening{EncounterID: encounter.ID}, 2)
+	assert.ErrorIs(t, err, models.ErrNCDScreeningExists)
+
+	// Part C completes the screening; Part B can no longer change
+	_, err = s.RecordPartC(ctx, screening.ID, &models.NCDScreening{Diagnoses: []string{"hypertension"}}, 3)
+	assert.ErrorIs(t, err, models.ErrNCDOutcomeRequired)
+	screening, err = s.RecordPartC(ctx, screening.ID, &models.NCDScreening{
+		Diagnoses: []string{"hypertension"}, Outcome: models.NCDOutcomeEnrol, ManagementPlan: " Amlodipine 5 mg ",
+	}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, models.NCDScreeningCompleted, screening.Status)
+	assert.Equal(t, "Amlodipine 5 mg", screening.ManagementPlan)
+	assert.Equal(t, []string{models.NCDProgramHypertension}, screening.EnrolmentPrograms)
+	_, err = s.UpdatePartB(ctx, screening.ID, &models.NCDScreening{}, 2)
+	assert.ErrorIs(t, err, models.ErrNCDScreeningCompleted)
+
+	// Without values the encounter's latest vital signs are used
+	encounter = newEncounter()
+	for _, systolic := range []int{118, 136} {
+		_, err := vitals.CreateVitalSigns(ctx, &models.VitalSigns{EncounterID: encounter.ID, PatientID: patient.ID, SystolicBP: bp(systolic), DiastolicBP: bp(80)})
+		require.NoError(t, err)
+	}
+	_, err = s.StartScreening(ctx, &models.NCDScreening{EncounterID: encounter.ID, VitalSignsID: &recorded.ID}, 2)
+	assert.ErrorIs(t, err, models.ErrNCDVitalSignsNotFound)
+	screening, err = s.StartScreening(ctx, &models.NCDScreening{EncounterID: encounter.ID}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 136, *screening.SystolicBP)
+	assert.Equal(t, models.NCDFindingBorderline, screening.HypertensionFinding)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -16,24 +17,25 @@ func NewPharmacyService(repo *repository.PharmacyRepository) *PharmacyService {
 	return &PharmacyService{repo: repo}
 }
 
-func (s *PharmacyService) AddStock(stock *models.PharmacyStock) error {
+// AddStock receives stock, recording the movement as performed by performedBy
+func (s *PharmacyService) AddStock(ctx context.Context, stock *models.PharmacyStock, performedBy uint) error {
 	// Validate expiry date
 	if stock.ExpiryDate.Before(time.Now()) {
 		return errors.New("cannot add expired medication to stock")
 	}
 
-	return s.repo.AddStock(stock)
+	return s.repo.AddStock(ctx, stock, performedBy)
 }
 
 func (s *PharmacyService) GetAvailableStock(medicationID uint) ([]models.PharmacyStock, error) {
 	return s.repo.GetStock(medicationID)
 }
 
-func (s *PharmacyService) GetLowStockAlerts() ([]models.PharmacyStock, error) {
-	return s.repo.GetLowStock(10)
+func (s *PharmacyService) GetLowStockAlerts(q repository.ListQuery) (*repository.Page[models.PharmacyStock], error) {
+	return s.repo.GetLowStock(q)
 }
 
-func (s *PharmacyService) DispenseMedication(dispensing *models.Dispensing) error {
+func (s *PharmacyService) DispenseMedication(ctx context.Context, dispensing *models.Dispensing) error {
 	// Check if sufficient stock available
 	stocks, err := s.repo.GetStock(dispensing.MedicationID)
 	if err != nil {
@@ -52,15 +54,15 @@ func (s *PharmacyService) DispenseMedication(dispensing *models.Dispensing) erro
 	dispensing.DispensedAt = time.Now()
 	dispensing.Status = "dispensed"
 
-	return s.repo.CreateDispensing(dispensing)
+	return s.repo.CreateDispensing(ctx, dispensing)
 }
 
-func (s *PharmacyService) GetDispensingQueue() ([]models.Prescription, error) {
-	return s.repo.GetPendingPrescriptions()
+func (s *PharmacyService) GetDispensingQueue(q repository.ListQuery) (*repository.Page[models.Prescription], error) {
+	return s.repo.GetPendingPrescriptions(q)
 }
 
-func (s *PharmacyService) GetPatientDispensingHistory(patientID uint) ([]models.Dispensing, error) {
-	return s.repo.GetDispensingHistory(patientID)
+func (s *PharmacyService) GetPatientDispensingHistory(patientID uint, q repository.ListQuery) (*repository.Page[models.Dispensing], error) {
+	return s.repo.GetDispensingHistory(patientID, q)
 }
 
 func (s *PharmacyService) GetStockMovementReport(medicationID uint, startDate, endDate time.Time) ([]models.StockMovement, error) {
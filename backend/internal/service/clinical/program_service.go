@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// ParseProgramFollowUpSchedules reads the days between follow-up visits of
+// programs, e.g. "hypertension=30,diabetes=90", over the defaults
+func ParseProgramFollowUpSchedules(spec string) (models.ProgramFollowUpSchedules, error) {
+	schedules := models.DefaultProgramFollowUpSchedules()
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		program, value, ok := strings.Cut(part, "=")
+		program = strings.ToLower(strings.TrimSpace(program))
+		days, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || !models.IsProgram(program) || err != nil || days < 1 || days > 365 {
+			return nil, fmt.Errorf("invalid program follow-up schedule %q: expected program=days", part)
+		}
+		schedules[program] = days
+	}
+	return schedules, nil
+}
+
+type ProgramService struct {
+	repo       *repository.ProgramEnrolmentRepository
+	patients   *PatientService
+	encounters *EncounterService
+	schedules  models.ProgramFollowUpSchedules
+}
+
+func NewProgramService(repo *repository.ProgramEnrolmentRepository, patients *PatientService, encounters *EncounterService, schedules models.ProgramFollowUpSchedules) *ProgramService {
+	return &ProgramService{repo: repo, patients: patients, encounters: encounters, schedules: schedules}
+}
+
+// Schedules returns the days between follow-up visits of each program
+func (s *ProgramService) Schedules() models.ProgramFollowUpSchedules {
+	return s.schedules
+}
+
+// Enrol enrols a patient in a program and schedules the first follow-up
+// visit. The follow-up interval defaults to the program's schedule.
+func (s *ProgramService) Enrol(ctx context.Context, enrolment *models.ProgramEnrolment, enrolledBy uint) (*models.ProgramEnrolment, error) {
+	if _, err := s.patients.GetPatientByID(enrolment.PatientID); err != nil {
+		return nil, err
+	}
+	if enrolment.FollowUpDays == 0 {
+		enrolment.FollowUpDays = s.schedules[enrolment.Program]
+	}
+	if err := enrolment.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindActive(enrolment.PatientID, enrolment.Program); err == nil {
+		return nil, models.ErrProgramEnrolmentExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if enrolment.EnrolledAt.IsZero() {
+		enrolment.EnrolledAt = time.Now()
+	}
+	next := enrolment.NextVisit(enrolment.EnrolledAt)
+	enrolment.Status = models.ProgramEnrolmentActive
+	enrolment.EnrolledBy = enrolledBy
+	enrolment.NCDNumber = strings.TrimSpace(enrolment.NCDNumber)
+	enrolment.LastVisitDate = nil
+	enrolment.NextVisitDate = &next
+	enrolment.Outcome, enrolment.OutcomeNotes, enrolment.ExitedAt, enrolment.ExitedBy = "", "", nil, nil
+
+	due := &models.ProgramVisit{PatientID: enrolment.PatientID, DueDate: next, Status: models.ProgramVisitDue}
+	return s.repo.Create(ctx, enrolment, due)
+}
+
+// EnrolFromScreening enrols the patient of an NCD screening in the programs
+// of its Part D. Programs the patient is already active in are left as they are.
+func (s *ProgramService) EnrolFromScreening(ctx context.Context, screening *models.NCDScreening) ([]*models.ProgramEnrolment, error) {
+	var enrolments []*models.ProgramEnrolment
+	for _, program := range screening.EnrolledPrograms {
+		enrolment, err := s.Enrol(ctx, &models.ProgramEnrolment{
+			PatientID:      screening.PatientID,
+			Program:        program,
+			EnrolledAt:     *screening.EnrolledAt,
+			NCDScreeningID: &screening.ID,
+			NCDNumber:      screening.NCDNumber,
+		}, *screening.EnrolledBy)
+		if errors.Is(err, models.ErrProgramEnrolmentExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		enrolments = append(enrolments, enrolment)
+	}
+	return enrolments, nil
+}
+
+// RecordVisit records a follow-up visit of an enrolment, on its due visit,
+// and schedules the next one, by default after the follow-up interval.
+func (s *ProgramService) RecordVisit(ctx context.Context, id uint, encounterID *uint, visitDate time.Time, nextVisitDate *time.Time, recordedBy uint) (*models.ProgramEnrolment, error) {
+	enrolment, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if enrolment.Status != models.ProgramEnrolmentActive {
+		return nil, models.ErrProgramEnrolmentExited
+	}
+	now := time.Now()
+	if visitDate.IsZero() {
+		visitDate = now
+	}
+	if visitDate.After(now) {
+		return nil, models.ErrProgramVisitFuture
+	}
+	if encounterID != nil {
+		encounter, err := s.encounters.GetEncounterByID(*encounterID)
+		if err != nil {
+			return nil, err
+		}
+		if encounter.PatientID != enrolment.PatientID {
+			return nil, models.ErrProgramVisitEncounter
+		}
+	}
+	next := enrolment.NextVisit(visitDate)
+	if nextVisitDate != nil {
+		if !nextVisitDate.After(visitDate) {
+			return nil, models.ErrNextVisitBeforeVisit
+		}
+		next = *nextVisitDate
+	}
+
+	attended := &models.ProgramVisit{EnrolmentID: enrolment.ID, PatientID: enrolment.PatientID, DueDate: visitDate}
+	for _, visit := range enrolment.Visits {
+		if visit.Status == models.ProgramVisitDue {
+			v := visit
+			attended = &v
+			break
+		}
+	}
+	attended.Status = models.ProgramVisitAttended
+	attended.EncounterID = encounterID
+	attended.AttendedAt = &visitDate
+	attended.RecordedBy = &recordedBy
+
+	enrolment.Visits = nil
+	if enrolment.LastVisitDate == nil || visitDate.After(*enrolment.LastVisitDate) {
+		enrolment.LastVisitDate = &visitDate
+	}
+	enrolment.NextVisitDate = &next
+	due := &models.ProgramVisit{EnrolmentID: enrolment.ID, PatientID: enrolment.PatientID, DueDate: next, Status: models.ProgramVisitDue}
+
+	updated, err := s.repo.RecordVisit(ctx, enrolment, attended, due)
+	if err != nil {
+		return nil, err
+	}
+	return s.withControl(updated), nil
+}
+
+// Exit records the patient leaving a program and cancels the due visit.
+func (s *ProgramService) Exit(ctx context.Context, id uint, outcome, notes string, exitedBy uint) (*models.ProgramEnrolment, error) {
+	enrolment, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	enrolment.Visits = nil
+	if err := enrolment.Exit(outcome, strings.TrimSpace(notes), exitedBy, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.Exit(ctx, enrolment)
+}
+
+// GetEnrolment returns an enrolment with its visits and control
+func (s *ProgramService) GetEnrolment(id uint) (*models.ProgramEnrolment, error) {
+	enrolment, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.withControl(enrolment), nil
+}
+
+// ListEnrolments returns a page of enrolments with their control, latest first
+func (s *ProgramService) ListEnrolments(q repository.ListQuery) (*repository.Page[models.ProgramEnrolment], error) {
+	page, err := s.repo.List(q)
+	if err != nil {
+		return nil, err
+	}
+	return page, s.addControls(page.Data)
+}
+
+// ListPatientEnrolments returns a page of a patient's enrolments with their
+// control, latest first
+func (s *ProgramService) ListPatientEnrolments(patientID uint, q repository.ListQuery) (*repository.Page[models.ProgramEnrolment], error) {
+	page, err := s.repo.ListByPatient(patientID, q)
+	if err != nil {
+		return nil, err
+	}
+	return page, s.addControls(page.Data)
+}
+
+// withControl adds an enrolment's control. The enrolment is returned without
+// it if the measurements cannot be read.
+func (s *ProgramService) withControl(enrolment *models.ProgramEnrolment) *models.ProgramEnrolment {
+	if err := s.addControls([]*models.ProgramEnrolment{enrolment}); err != nil {
+		log.Printf("program: failed to read the control of enrolment %d: %v", enrolment.ID, err)
+	}
+	return enrolment
+}
+
+func (s *ProgramService) addControls(enrolments []*models.ProgramEnrolment) error {
+	ids := make([]uint, len(enrolments))
+	for i := range enrolments {
+		ids[i] = enrolments[i].ID
+	}
+	controls, err := s.repo.Controls(ids)
+	if err != nil {
+		return err
+	}
+	byEnrolment := map[uint]*models.ProgramControl{}
+	for i := range controls {
+		controls[i].Assess()
+		byEnrolment[controls[i].EnrolmentID] = &controls[i]
+	}
+	for i := range enrolments {
+		enrolments[i].Control = byEnrolment[enrolments[i].ID]
+	}
+	return nil
+}
+
+// Defaulters lists the active enrolments of a program, or of all programs,
+// whose follow-up visit is more than days overdue, longest overdue first
+func (s *ProgramService) Defaulters(program string, days int) ([]models.ProgramDefaulter, error) {
+	if program != "" && !models.IsProgram(program) {
+		return nil, models.ErrInvalidProgram
+	}
+	now := time.Now()
+	defaulters, err := s.repo.Defaulters(program, now.AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+	for i := range defaulters {
+		defaulters[i].DaysOverdue = int(now.Sub(defaulters[i].DueDate).Hours() / 24)
+	}
+	return defaulters, nil
+}
+
+// Indicators computes the control indicators of a program, or of all
+// programs: active enrolments, defaulters by days overdue, BP under 140/90
+// and HbA1c under 7% at the latest measurement, and exits by outcome
+func (s *ProgramService) Indicators(program string, days int) ([]models.ProgramIndicators, error) {
+	programs := models.Programs
+	if program != "" {
+		if !models.IsProgram(program) {
+			return nil, models.ErrInvalidProgram
+		}
+		programs = []string{program}
+	}
+
+	indicators := make([]models.ProgramIndicators, 0, len(programs))
+	for _, program := range programs {
+		controls, err := s.repo.ActiveControls(program)
+		if err != nil {
+			return nil, err
+		}
+		defaulters, err := s.Defaulters(program, days)
+		if err != nil {
+			return nil, err
+		}
+		outcomes, err := s.repo.OutcomeCounts(program)
+		if err != nil {
+			return nil, err
+		}
+
+		ind := models.ProgramIndicators{
+			Program:       program,
+			Active:        len(controls),
+			Defaulters:    len(defaulters),
+			DefaulterDays: days,
+			Outcomes:      outcomes,
+		}
+		for i := range controls {
+			controls[i].Assess()
+			ind.Add(&controls[i])
+		}
+		ind.Rates()
+		indicators = append(indicators, ind)
+	}
+	return indicators, nil
+}
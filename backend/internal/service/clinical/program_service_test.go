@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestParseProgramFollowUpSchedules(t *testing.T) {
+	schedules, err := ParseProgramFollowUpSchedules("")
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultProgramFollowUpSchedules(), schedules)
+
+	schedules, err = ParseProgramFollowUpSchedules(" Diabetes = 90 ,")
+	require.NoError(t, err)
+	assert.Equal(t, 30, schedules[models.NCDProgramHypertension])
+	assert.Equal(t, 90, schedules[models.NCDProgramDiabetes])
+
+	for _, spec := range []string{"diabetes", "asthma=30", "diabetes=monthly", "diabetes=0", "hypertension=400"} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParseProgramFollowUpSchedules(spec)
+			assert.ErrorContains(t, err, "expected program=days")
+		})
+	}
+}
+
+func newTestProgramService(t *testing.T, db *gorm.DB) (*ProgramService, *EncounterService, *VitalSignsService) {
+	patients := newTestPatientService(t, db)
+	encounters := NewEncounterService(repository.NewEncounterRepository(db))
+	vitals := NewVitalSignsService(repository.NewVitalSignsRepository(db), patients, models.DefaultEarlyWarningThresholds())
+	programs := NewProgramService(repository.NewProgramEnrolmentRepository(db), patients, encounters, models.ProgramFollowUpSchedules{
+		models.NCDProgramHypertension: 30,
+		models.NCDProgramDiabetes:     90,
+	})
+	return programs, encounters, vitals
+}
+
+// TestProgramEnrolment follows an enrolment from enrolment through a visit to
+// leaving the program
+func TestProgramEnrolment(t *testing.T) {
+	db := openTestDB(t)
+	s, encounters, vitals := newTestProgramService(t, db)
+	ctx := context.Background()
+	patient := createTestPatient(t, db, "program")
+	other := createTestPatient(t, db, "program-other")
+
+	_, err := s.Enrol(ctx, &models.ProgramEnrolment{PatientID: patient.ID, Program: "asthma"}, 2)
+	assert.Equal(t, models.ErrInvalidProgram, err)
+
+	// The follow-up interval defaults to the program's schedule
+	enrolledAt := time.Now().AddDate(0, 0, -20)
+	enrolment, err := s.Enrol(ctx, &models.ProgramEnrolment{
+		PatientID: patient.ID, Program: models.NCDProgramDiabetes, EnrolledAt: enrolledAt, NCDNumber: " NCD-0042 ",
+	}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.ProgramEnrolmentActive, enrolment.Status)
+	assert.Equal(t, 90, enrolment.FollowUpDays)
+	assert.Equal(t, "NCD-0042", enrolment.NCDNumber)
+	assert.Equal(t, uint(2), enrolment.EnrolledBy)
+	require.NotNil(t, enrolment.NextVisitDate)
+	assert.True(t, enrolment.NextVisit(enrolledAt).Equal(*enrolment.NextVisitDate))
+
+	_, err = s.Enrol(ctx, &models.ProgramEnrolment{PatientID: patient.ID, Program: models.NCDProgramDiabetes}, 2)
+	assert.ErrorIs(t, err, models.ErrProgramEnrolmentExists)
+
+	// A visit attends the due visit and schedules the next one
+	otherEncounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: other.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+	_, err = s.RecordVisit(ctx, enrolment.ID, &otherEncounter.ID, time.Time{}, nil, 3)
+	assert.Equal(t, models.ErrProgramVisitEncounter, err)
+	_, err = s.RecordVisit(ctx, enrolment.ID, nil, time.Now().Add(time.Hour), nil, 3)
+	assert.Equal(t, models.ErrProgramVisitFuture, err)
+	visitDate := time.Now().AddDate(0, 0, -1)
+	_, err = s.RecordVisit(ctx, enrolment.ID, nil, visitDate, &visitDate, 3)
+	assert.Equal(t, models.ErrNextVisitBeforeVisit, err)
+
+	encounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: patient.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+	systolic, diastolic := 132, 84
+	_, err = vitals.CreateVitalSigns(ctx, &models.VitalSigns{EncounterID: encounter.ID, PatientID: patient.ID, SystolicBP: &systolic, DiastolicBP: &diastolic})
+	require.NoError(t, err)
+	nextVisit := time.Now().AddDate(0, 0, 28)
+	enrolment, err = s.RecordVisit(ctx, enrolment.ID, &encounter.ID, visitDate, &nextVisit, 3)
+	require.NoError(t, err)
+	require.NotNil(t, enrolment.LastVisitDate)
+	assert.True(t, visitDate.Equal(*enrolment.LastVisitDate))
+	assert.True(t, nextVisit.Equal(*enrolment.NextVisitDate))
+	require.NotNil(t, enrolment.Control)
+	require.NotNil(t, enrolment.Control.BPControlled)
+	assert.True(t, *enrolment.Control.BPControlled)
+	assert.Nil(t, enrolment.Control.HbA1cControlled)
+
+	enrolment, err = s.GetEnrolment(enrolment.ID)
+	require.NoError(t, err)
+	statuses := map[string]int{}
+	for _, visit := range enrolment.Visits {
+		statuses[visit.Status]++
+		if visit.Status == models.ProgramVisitAttended {
+			assert.Equal(t, &encounter.ID, visit.EncounterID)
+		}
+	}
+	assert.Equal(t, map[string]int{models.ProgramVisitAttended: 1, models.ProgramVisitDue: 1}, statuses)
+
+	// Leaving cancels the due visit; the patient can then be enrolled again
+	_, err = s.Exit(ctx, enrolment.ID, "cured", "", 4)
+	assert.Equal(t, models.ErrInvalidProgramOutcome, err)
+	enrolment, err = s.Exit(ctx, enrolment.ID, models.ProgramOutcomeTransferredOut, " To Ukhiya UHC ", 4)
+	require.NoError(t, err)
+	assert.Equal(t, models.ProgramEnrolmentExited, enrolment.Status)
+	assert.Equal(t, "To Ukhiya UHC", enrolment.OutcomeNotes)
+	assert.Nil(t, enrolment.NextVisitDate)
+	_, err = s.RecordVisit(ctx, enrolment.ID, nil, time.Time{}, nil, 3)
+	assert.ErrorIs(t, err, models.ErrProgramEnrolmentExited)
+
+	enrolment, err = s.GetEnrolment(enrolment.ID)
+	require.NoError(t, err)
+	for _, visit := range enrolment.Visits {
+		assert.NotEqual(t, models.ProgramVisitDue, visit.Status)
+	}
+	_, err = s.Enrol(ctx, &models.ProgramEnrolment{PatientID: patient.ID, Program: models.NCDProgramDiabetes}, 2)
+	assert.NoError(t, err)
+}
+
+// TestProgramDefaultersAndIndicators lists a patient who missed a visit and
+// counts them in the program's indicators
+func TestProgramDefaultersAndIndicators(t *testing.T) {
+	db := openTestDB(t)
+	s, encounters, vitals := newTestProgramService(t, db)
+	ctx := context.Background()
+
+	_, err := s.Defaulters("asthma", models.DefaultDefaulterDays)
+	assert.Equal(t, models.ErrInvalidProgram, err)
+	_, err = s.Indicators("asthma", models.DefaultDefaulterDays)
+	assert.Equal(t, models.ErrInvalidProgram, err)
+
+	before, err := s.Indicators(models.NCDProgramHypertension, models.DefaultDefaulterDays)
+	require.NoError(t, err)
+	require.Len(t, before, 1)
+
+	// Enrolled 40 days ago, the first visit was due 10 days ago
+	defaulter := createTestPatient(t, db, "program-defaulter")
+	late, err := s.Enrol(ctx, &models.ProgramEnrolment{
+		PatientID: defaulter.ID, Program: models.NCDProgramHypertension, EnrolledAt: time.Now().AddDate(0, 0, -40),
+	}, 2)
+	require.NoError(t, err)
+	encounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: defaulter.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+	systolic, diastolic := 158, 98
+	_, err = vitals.CreateVitalSigns(ctx, &models.VitalSigns{EncounterID: encounter.ID, PatientID: defaulter.ID, SystolicBP: &systolic, DiastolicBP: &diastolic})
+	require.NoError(t, err)
+
+	onTime := createTestPatient(t, db, "program-on-time")
+	_, err = s.Enrol(ctx, &models.ProgramEnrolment{PatientID: onTime.ID, Program: models.NCDProgramHypertension}, 2)
+	require.NoError(t, err)
+
+	exited := createTestPatient(t, db, "program-exited")
+	enrolment, err := s.Enrol(ctx, &models.ProgramEnrolment{PatientID: exited.ID, Program: models.NCDProgramHypertension}, 2)
+	require.NoError(t, err)
+	_, err = s.Exit(ctx, enrolment.ID, models.ProgramOutcomeDied, "", 4)
+	require.NoError(t, err)
+
+	findDefaulter := func(defaulters []models.ProgramDefaulter) *models.ProgramDefaulter {
+		for i := range defaulters {
+			if defaulters[i].EnrolmentID == late.ID {
+				return &defaulters[i]
+			}
+		}
+		return nil
+	}
+	defaulters, err := s.Defaulters(models.NCDProgramHypertension, models.DefaultDefaulterDays)
+	require.NoError(t, err)
+	found := findDefaulter(defaulters)
+	require.NotNil(t, found)
+	assert.Equal(t, defaulter.ID, found.PatientID)
+	assert.Equal(t, defaulter.MRN, found.MRN)
+	assert.InDelta(t, 10, found.DaysOverdue, 1)
+	for _, d := range defaulters {
+		assert.NotEqual(t, onTime.ID, d.PatientID)
+	}
+
+	defaulters, err = s.Defaulters("", 14)
+	require.NoError(t, err)
+	assert.Nil(t, findDefaulter(defaulters))
+	defaulters, err = s.Defaulters(models.NCDProgramDiabetes, models.DefaultDefaulterDays)
+	require.NoError(t, err)
+	assert.Nil(t, findDefaulter(defaulters))
+
+	after, err := s.Indicators(models.NCDProgramHypertension, models.DefaultDefaulterDays)
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+	assert.Equal(t, before[0].Active+2, after[0].Active)
+	assert.Equal(t, before[0].Defaulters+1, after[0].Defaulters)
+	assert.Equal(t, before[0].BPMeasured+1, after[0].BPMeasured)
+	assert.Equal(t, before[0].BPControlled, after[0].BPControlled)
+	assert.Equal(t, before[0].Outcomes[models.ProgramOutcomeDied]+1, after[0].Outcomes[models.ProgramOutcomeDied])
+
+	all, err := s.Indicators("", models.DefaultDefaulterDays)
+	require.NoError(t, err)
+	require.Len(t, all, len(models.Programs))
+	assert.Equal(t, models.NCDProgramHypertension, all[0].Program)
+	assert.Equal(t, models.NCDProgramDiabetes, all[1].Program)
+}
+
+// TestNCDScreeningEnrol enrols the patient of a completed screening in the
+// programs of its Part D
+func TestNCDScreeningEnrol(t *testing.T) {
+	db := openTestDB(t)
+	programs, encounters, vitals := newTestProgramService(t, db)
+	s := NewNCDScreeningService(repository.NewNCDScreeningRepository(db), encounters, vitals, programs, nil)
+	ctx := context.Background()
+	patient := createTestPatient(t, db, "ncd-enrol")
+
+	// Already active in hypertension, the patient is only enrolled in diabetes
+	existing, err := programs.Enrol(ctx, &models.ProgramEnrolment{PatientID: patient.ID, Program: models.NCDProgramHypertension}, 2)
+	require.NoError(t, err)
+
+	encounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: patient.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+	screening, err := s.StartScreening(ctx, &models.NCDScreening{EncounterID: encounter.ID}, 2)
+	require.NoError(t, err)
+	_, err = s.Enrol(ctx, screening.ID, nil, "", false, 3)
+	assert.ErrorIs(t, err, models.ErrNCDScreeningNotCompleted)
+
+	screening, err = s.RecordPartC(ctx, screening.ID, &models.NCDScreening{
+		Diagnoses: []string{models.NCDProgramHypertension, models.NCDProgramDiabetes}, Outcome: models.NCDOutcomeEnrol,
+	}, 3)
+	require.NoError(t, err)
+	screening, err = s.Enrol(ctx, screening.ID, nil, " NCD-0107 ", true, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "NCD-0107", screening.NCDNumber)
+	assert.True(t, screening.NCDBookIssued)
+	_, err = s.Enrol(ctx, screening.ID, nil, "", false, 3)
+	assert.ErrorIs(t, err, models.ErrNCDAlreadyEnrolled)
+
+	page, err := programs.ListPatientEnrolments(patient.ID, repository.ListQuery{Limit: 10})
+	require.NoError(t, err)
+	byProgram := map[string]*models.ProgramEnrolment{}
+	for _, enrolment := range page.Data {
+		byProgram[enrolment.Program] = enrolment
+	}
+	require.Len(t, byProgram, 2)
+	assert.Equal(t, existing.ID, byProgram[models.NCDProgramHypertension].ID)
+	assert.Nil(t, byProgram[models.NCDProgramHypertension].NCDScreeningID)
+	diabetes := byProgram[models.NCDProgramDiabetes]
+	assert.Equal(t, &screening.ID, diabetes.NCDScreeningID)
+	assert.Equal(t, "NCD-0107", diabetes.NCDNumber)
+	assert.Equal(t, 90, diabetes.FollowUpDays)
+	assert.Equal(t, uint(3), diabetes.EnrolledBy)
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// QuestionnaireIssuesError is returned when a questionnaire definition or a
+// response does not pass validation, with one issue per problem
+type QuestionnaireIssuesError struct {
+	Message string
+	Issues  []fhir.OperationOutcomeIssue
+}
+
+func (e *QuestionnaireIssuesError) Error() string {
+	return e.Message
+}
+
+type QuestionnaireService struct {
+	repo       *repository.QuestionnaireRepository
+	patients   *PatientService
+	encounters *EncounterService
+}
+
+func NewQuestionnaireService(repo *repository.QuestionnaireRepository, patients *PatientService, encounters *EncounterService) *QuestionnaireService {
+	return &QuestionnaireService{repo: repo, patients: patients, encounters: encounters}
+}
+
+// CreateQuestionnaire stores a new questionnaire definition as a draft
+func (s *QuestionnaireService) CreateQuestionnaire(ctx context.Context, definition *fhir.Questionnaire, createdBy uint) (*models.Questionnaire, error) {
+	questionnaire := &models.Questionnaire{Status: models.QuestionnaireDraft, CreatedBy: createdBy}
+	if err := s.applyDefinition(questionnaire, definition); err != nil {
+		return nil, err
+	}
+	return s.repo.Create(ctx, questionnaire)
+}
+
+// UpdateQuestionnaire replaces the definition of a draft questionnaire.
+func (s *QuestionnaireService) UpdateQuestionnaire(ctx context.Context, id uint, definition *fhir.Questionnaire) (*models.Questionnaire, error) {
+	questionnaire, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if questionnaire.Status != models.QuestionnaireDraft {
+		return nil, models.ErrQuestionnaireNotDraft
+	}
+
+	if err := s.applyDefinition(questionnaire, definition); err != nil {
+		return nil, err
+	}
+	return s.repo.Update(ctx, questionnaire)
+}
+
+// applyDefinition validates a definition and stores it on the questionnaire.
+// A url and version identify one questionnaire.
+func (s *QuestionnaireService) applyDefinition(questionnaire *models.Questionnaire, definition *fhir.Questionnaire) error {
+	if definition.ResourceType == "" {
+		definition.ResourceType = "Questionnaire"
+	}
+	definition.URL = strings.TrimSpace(definition.URL)
+	definition.Version = strings.TrimSpace(definition.Version)
+	if issues := fhir.ValidateQuestionnaire(definition); len(issues) > 0 {
+		return &QuestionnaireIssuesError{Message: "Invalid questionnaire", Issues: issues}
+	}
+	if existing, err := s.repo.FindByCanonical(definition.URL, definition.Version); err == nil {
+		if existing.ID != questionnaire.ID {
+			return models.ErrQuestionnaireExists
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	definition.ID, definition.Meta = "", nil
+	definition.Status = questionnaire.Status
+	raw, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	questionnaire.URL = definition.URL
+	questionnaire.Version = definition.Version
+	questionnaire.Name = definition.Name
+	questionnaire.Title = definition.Title
+	questionnaire.Definition = string(raw)
+	return nil
+}
+
+// SetQuestionnaireStatus publishes or retires a questionnaire.
+func (s *QuestionnaireService) SetQuestionnaireStatus(ctx context.Context, id uint, status string) (*models.Questionnaire, error) {
+	questionnaire, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := questionnaire.SetStatus(status); err != nil {
+		return nil, err
+	}
+	return s.repo.Update(ctx, questionnaire)
+}
+
+func (s *QuestionnaireService) GetQuestionnaire(id uint) (*models.Questionnaire, error) {
+	return s.repo.FindByID(id)
+}
+
+// ListQuestionnaires returns a page of questionnaires, latest first
+func (s *QuestionnaireService) ListQuestionnaires(q repository.ListQuery) (*repository.Page[models.Questionnaire], error) {
+	return s.repo.List(q)
+}
+
+// ValidateResponse checks a response against a questionnaire without saving
+// it. It returns the response as it would be saved, with calculated items
+// filled in and items that are not enabled removed, and the issues found.
+func (s *QuestionnaireService) ValidateResponse(id uint, response *fhir.QuestionnaireResponse) (*fhir.QuestionnaireResponse, []fhir.OperationOutcomeIssue, error) {
+	questionnaire, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	definition, err := fhir.QuestionnaireFromModel(questionnaire)
+	if err != nil {
+		return nil, nil, err
+	}
+	issues := fhir.ProcessQuestionnaireResponse(definition, response)
+	if issues == nil {
+		issues = []fhir.OperationOutcomeIssue{}
+	}
+	return response, issues, nil
+}
+
+// SubmitResponse saves a response to an active questionnaire for the patient
+// it is about, optionally during one of their encounters. The questionnaire
+// is the canonical url|version, or the latest active version of the url.
+// Observations are extracted from completed responses.
+func (s *QuestionnaireService) SubmitResponse(ctx context.Context, response *fhir.QuestionnaireResponse, authorID uint) (*models.QuestionnaireSubmission, error) {
+	questionnaire, err := s.resolveQuestionnaire(response.Questionnaire)
+	if err != nil {
+		return nil, err
+	}
+	if questionnaire.Status != models.QuestionnaireActive {
+		return nil, models.ErrQuestionnaireNotActive
+	}
+	patientID, err := fhir.ParseReference(response.Subject, "Patient")
+	if err != nil || patientID == 0 {
+		return nil, models.ErrSubmissionPatientRequired
+	}
+	if _, err := s.patients.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	var encounterID *uint
+	if response.Encounter != nil {
+		id, err := fhir.ParseReference(response.Encounter, "Encounter")
+		if err != nil || id == 0 {
+			return nil, models.ErrSubmissionEncounter
+		}
+		encounter, err := s.encounters.GetEncounterByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if encounter.PatientID != patientID {
+			return nil, models.ErrSubmissionEncounter
+		}
+		encounterID = &id
+	}
+
+	submission := &models.QuestionnaireSubmission{
+		QuestionnaireID: questionnaire.ID,
+		Questionnaire:   *questionnaire,
+		PatientID:       patientID,
+		EncounterID:     encounterID,
+		AuthorID:        authorID,
+	}
+	if err := submission.SetStatus(response.Status); err != nil {
+		return nil, err
+	}
+	if submission.AuthoredAt, err = fhir.ParseDateTime(response.Authored); err != nil {
+		return nil, models.ErrSubmissionAuthored
+	}
+	if submission.AuthoredAt.IsZero() {
+		submission.AuthoredAt = time.Now()
+	}
+	observations, err := s.applyResponse(submission, response)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CreateSubmission(ctx, submission, observations)
+}
+
+// UpdateResponse replaces the answers of a response. Changing a completed
+// response amends it and extracts its observations again; marking it entered
+// in error keeps the answers and removes its observations. The
+// questionnaire, subject and encounter stay as submitted.
+func (s *QuestionnaireService) UpdateResponse(ctx context.Context, id uint, response *fhir.QuestionnaireResponse, authorID uint) (*models.QuestionnaireSubmission, error) {
+	submission, err := s.repo.FindSubmission(id)
+	if err != nil {
+		return nil, err
+	}
+
+	submission.Observations = nil
+	if err := submission.SetStatus(response.Status); err != nil {
+		return nil, err
+	}
+	submission.AuthorID = authorID
+	submission.AuthoredAt = time.Now()
+
+	var observations []models.QuestionnaireObservation
+	if submission.Status != models.SubmissionEnteredInError {
+		if observations, err = s.applyResponse(submission, response); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.UpdateSubmission(ctx, submission, observations)
+}
+
+// applyResponse validates a response against the submission's questionnaire
+// and stores it on the submission, returning the observations to extract
+func (s *QuestionnaireService) applyResponse(submission *models.QuestionnaireSubmission, response *fhir.QuestionnaireResponse) ([]models.QuestionnaireObservation, error) {
+	definition, err := fhir.QuestionnaireFromModel(&submission.Questionnaire)
+	if err != nil {
+		return nil, err
+	}
+	response.Status = submission.Status
+	if issues := fhir.ProcessQuestionnaireResponse(definition, response); len(issues) > 0 {
+		return nil, &QuestionnaireIssuesError{Message: "Invalid questionnaire response", Issues: issues}
+	}
+
+	response.ResourceType = "QuestionnaireResponse"
+	response.ID, response.Meta = "", nil
+	response.Questionnaire = submission.Questionnaire.Canonical()
+	raw, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	submission.Response = string(raw)
+
+	if !submission.IsFinal() {
+		return nil, nil
+	}
+	observations := fhir.ExtractQuestionnaireObservations(definition, response)
+	for i := range observations {
+		observations[i].PatientID = submission.PatientID
+		observations[i].EncounterID = submission.EncounterID
+		observations[i].EffectiveAt = submission.AuthoredAt
+	}
+	return observations, nil
+}
+
+// resolveQuestionnaire finds the questionnaire of a canonical reference
+func (s *QuestionnaireService) resolveQuestionnaire(canonical string) (*models.Questionnaire, error) {
+	url, version, _ := strings.Cut(strings.TrimSpace(canonical), "|")
+	if url == "" {
+		return nil, models.ErrSubmissionQuestionnaire
+	}
+	questionnaire, err := s.repo.FindByCanonical(url, version)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, models.ErrSubmissionQuestionnaire
+	}
+	return questionnaire, err
+}
+
+// GetResponse returns a submission with its questionnaire and observations
+func (s *QuestionnaireService) GetResponse(id uint) (*models.QuestionnaireSubmission, error) {
+	return s.repo.FindSubmission(id)
+}
+
+// ListPatientResponses returns a page of a patient's submissions, latest first
+func (s *QuestionnaireService) ListPatientResponses(patientID uint, q repository.ListQuery) (*repository.Page[models.QuestionnaireSubmission], error) {
+	return s.repo.ListSubmissionsByPatient(patientID, q)
+}
+
+// ListEncounterResponses returns a page of an encounter's submissions, latest first
+func (s *QuestionnaireService) ListEncounterResponses(encounterID uint, q repository.ListQuery) (*repository.Page[models.QuestionnaireSubmission], error) {
+	return s.repo.ListSubmissionsByEncounter(encounterID, q)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// queueSubscriberBuffer is how many events a slow subscriber may fall behind
+// before events are dropped for it
+const queueSubscriberBuffer = 64
+
+// QueueBroker fans queue events out to the display screens connected to this
+// API instance
+type QueueBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan models.QueueEvent]struct{}
+}
+
+func NewQueueBroker() *QueueBroker {
+	return &QueueBroker{subscribers: map[chan models.QueueEvent]struct{}{}}
+}
+
+// Subscribe returns a channel receiving all queue events and a function that
+// ends the subscription
+func (b *QueueBroker) Subscribe() (<-chan models.QueueEvent, func()) {
+	events := make(chan models.QueueEvent, queueSubscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, events)
+			b.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber without waiting. A subscriber
+// whose buffer is full misses the event and catches up with the next
+// snapshot of the queue.
+func (b *QueueBroker) Publish(event models.QueueEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueBroker(t *testing.T) {
+	b := NewQueueBroker()
+	first, stopFirst := b.Subscribe()
+	second, stopSecond := b.Subscribe()
+
+	b.Publish(models.QueueEvent{Type: "issued", Token: "G-001"})
+	assert.Equal(t, "G-001", (<-first).Token)
+	assert.Equal(t, "G-001", (<-second).Token)
+
+	// A subscriber that stopped reading misses events instead of blocking the others
+	for i := 0; i < queueSubscriberBuffer+10; i++ {
+		b.Publish(models.QueueEvent{Type: "called", Number: i})
+		<-first
+	}
+	assert.Len(t, second, queueSubscriberBuffer)
+
+	// Ending a subscription closes its channel, once
+	stopSecond()
+	stopSecond()
+	for range second {
+	}
+	b.Publish(models.QueueEvent{Type: "done"})
+	assert.Equal(t, "done", (<-first).Type)
+
+	stopFirst()
+	_, open := <-first
+	assert.False(t, open)
+	b.Publish(models.QueueEvent{Type: "issued"})
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+type QueueService struct {
+	repo       *repository.QueueRepository
+	patients   *PatientService
+	encounters *EncounterService
+	broker     *QueueBroker
+}
+
+func NewQueueService(repo *repository.QueueRepository, patients *PatientService, encounters *EncounterService, broker *QueueBroker) *QueueService {
+	return &QueueService{repo: repo, patients: patients, encounters: encounters, broker: broker}
+}
+
+// QueueDate returns the queue day of a time, in the server's local time
+func QueueDate(t time.Time) string {
+	return t.Format(models.QueueDateLayout)
+}
+
+// servicePoint looks up a service point by code
+func servicePoint(code string) (models.QueueServicePoint, error) {
+	point, ok := models.FindQueueServicePoint(code)
+	if !ok {
+		return point, models.ErrInvalidServicePoint
+	}
+	return point, nil
+}
+
+// CheckIn issues the patient today's next token at a service point. An
+// encounter given with the check-in that is still planned is marked arrived.
+func (s *QueueService) CheckIn(ctx context.Context, code string, token *models.QueueToken, issuedBy uint) (*models.QueueToken, error) {
+	point, err := servicePoint(code)
+	if err != nil {
+		return nil, err
+	}
+	patient, err := s.patients.GetPatientByID(token.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MergedIntoID != nil {
+		return nil, ErrPatientMerged
+	}
+
+	now := time.Now()
+	if _, err := s.repo.FindOpen(token.PatientID, point.Code, QueueDate(now)); err == nil {
+		return nil, models.ErrQueueCheckedIn
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if token.EncounterID != nil {
+		encounter, err := s.encounters.GetEncounterByID(*token.EncounterID)
+		if err != nil {
+			return nil, err
+		}
+		if encounter.PatientID != token.PatientID {
+			return nil, models.ErrQueueEncounterOther
+		}
+		if encounter.Status == models.EncounterStatusPlanned {
+			if _, err := s.encounters.ChangeStatus(ctx, encounter.ID, models.EncounterStatusArrived, "", issuedBy); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	token.QueueDate = QueueDate(now)
+	token.Status = models.QueueStatusWaiting
+	token.CheckedInAt = now
+	token.IssuedBy = issuedBy
+	created, err := s.repo.Create(ctx, token, point)
+	if err != nil {
+		return nil, err
+	}
+	s.publish("issued", created, nil)
+	return created, nil
+}
+
+// CallNext calls the next waiting patient of a service point to a counter,
+// priority tokens first and then in order of check-in. It returns
+// repository.ErrNotFound when nobody is waiting.
+func (s *QueueService) CallNext(ctx context.Context, code, counter string, calledBy uint) (*models.QueueToken, error) {
+	point, err := servicePoint(code)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	token, err := s.repo.CallNext(ctx, point.Code, QueueDate(now), counter, calledBy, now)
+	if err != nil {
+		return nil, err
+	}
+	s.publish("called", token, nil)
+	return token, nil
+}
+
+// Call calls a particular token to a counter, out of turn or again
+func (s *QueueService) Call(ctx context.Context, id uint, counter string, calledBy uint) (*models.QueueToken, error) {
+	return s.change(ctx, id, models.QueueStatusCalled, "called", func(token *models.QueueToken) {
+		if counter != "" {
+			token.Counter = counter
+		}
+		token.CalledBy = &calledBy
+	})
+}
+
+// Skip marks a called patient who did not come as skipped
+func (s *QueueService) Skip(ctx context.Context, id uint) (*models.QueueToken, error) {
+	return s.change(ctx, id, models.QueueStatusSkipped, "skipped", nil)
+}
+
+// Requeue puts a skipped patient who turned up back in their original place
+func (s *QueueService) Requeue(ctx context.Context, id uint) (*models.QueueToken, error) {
+	return s.change(ctx, id, models.QueueStatusWaiting, "requeued", nil)
+}
+
+// Complete marks a patient as served
+func (s *QueueService) Complete(ctx context.Context, id uint) (*models.QueueToken, error) {
+	return s.change(ctx, id, models.QueueStatusDone, "done", nil)
+}
+
+func (s *QueueService) change(ctx context.Context, id uint, status, event string, update func(*models.QueueToken)) (*models.QueueToken, error) {
+	token, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.TransitionTo(status, time.Now()); err != nil {
+		return nil, err
+	}
+	if update != nil {
+		update(token)
+	}
+	updated, err := s.repo.Update(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(event, updated, nil)
+	return updated, nil
+}
+
+// Transfer sends a patient on to another service point, e.g. from
+// consultation to the laboratory, with a new token there. The new token keeps
+// the encounter and priority of the old one unless priority is given.
+func (s *QueueService) Transfer(ctx context.Context, id uint, code string, priority *bool, transferredBy uint) (*models.QueueToken, error) {
+	point, err := servicePoint(code)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if token.ServicePoint == point.Code {
+		return nil, models.ErrQueueSamePoint
+	}
+
+	now := time.Now()
+	if _, err := s.repo.FindOpen(token.PatientID, point.Code, QueueDate(now)); err == nil {
+		return nil, models.ErrQueueCheckedIn
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err := token.TransitionTo(models.QueueStatusTransferred, now); err != nil {
+		return nil, err
+	}
+
+	next := &models.QueueToken{
+		QueueDate:   QueueDate(now),
+		PatientID:   token.PatientID,
+		EncounterID: token.EncounterID,
+		Priority:    token.Priority,
+		Status:      models.QueueStatusWaiting,
+		CheckedInAt: now,
+		IssuedBy:    transferredBy,
+	}
+	if priority != nil {
+		next.Priority = *priority
+	}
+	created, err := s.repo.Transfer(ctx, token, next, point)
+	if err != nil {
+		return nil, err
+	}
+	s.publish("transferred", token, created)
+	s.publish("issued", created, nil)
+	return created, nil
+}
+
+func (s *QueueService) GetToken(id uint) (*models.QueueToken, error) {
+	return s.repo.FindByID(id)
+}
+
+// ListTokens returns a page of a service point's tokens on a day
+func (s *QueueService) ListTokens(code, date string, q repository.ListQuery) (*repository.Page[models.QueueToken], error) {
+	point, err := servicePoint(code)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.List(point.Code, date, q)
+}
+
+// Stats summarizes every service point's queue on a day
+func (s *QueueService) Stats(date string) ([]models.QueueStats, error) {
+	rows, err := s.repo.Stats(date, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	byPoint := map[string]models.QueueStats{}
+	for _, row := range rows {
+		byPoint[row.ServicePoint] = row
+	}
+
+	stats := make([]models.QueueStats, 0, len(models.QueueServicePoints))
+	for _, point := range models.QueueServicePoints {
+		row := byPoint[point.Code]
+		row.ServicePoint = point.Code
+		row.Name = point.Name
+		row.QueueDate = date
+		stats = append(stats, row)
+	}
+	return stats, nil
+}
+
+// Display returns today's queue of the service points as shown on the
+// waiting-area screens, all service points when codes is empty
+func (s *QueueService) Display(codes []string) ([]models.QueueDisplay, error) {
+	points, err := servicePoints(codes)
+	if err != nil {
+		return nil, err
+	}
+	pointCodes := make([]string, len(points))
+	for i, point := range points {
+		pointCodes[i] = point.Code
+	}
+	tokens, err := s.repo.ListOpen(pointCodes, QueueDate(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	displays := make([]models.QueueDisplay, len(points))
+	index := map[string]int{}
+	for i, point := range points {
+		displays[i] = models.QueueDisplay{
+			ServicePoint: point.Code,
+			Name:         point.Name,
+			NowServing:   []models.QueueDisplayToken{},
+			Waiting:      []models.QueueDisplayToken{},
+		}
+		index[point.Code] = i
+	}
+	for _, token := range tokens {
+		display := &displays[index[token.ServicePoint]]
+		shown := models.QueueDisplayToken{Token: token.Token, Priority: token.Priority}
+		if token.Status == models.QueueStatusCalled {
+			shown.Counter = token.Counter
+			shown.CalledAt = token.LastCalledAt
+			display.NowServing = append(display.NowServing, shown)
+		} else {
+			display.Waiting = append(display.Waiting, shown)
+		}
+	}
+	return displays, nil
+}
+
+func servicePoints(codes []string) ([]models.QueueServicePoint, error) {
+	if len(codes) == 0 {
+		return models.QueueServicePoints, nil
+	}
+	points := make([]models.QueueServicePoint, 0, len(codes))
+	for _, code := range codes {
+		point, err := servicePoint(code)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// Subscribe returns a channel of queue events and a function that ends the
+// subscription
+func (s *QueueService) Subscribe() (<-chan models.QueueEvent, func()) {
+	return s.broker.Subscribe()
+}
+
+func (s *QueueService) publish(event string, token, transferredTo *models.QueueToken) {
+	e := models.QueueEvent{
+		Type:         event,
+		ServicePoint: token.ServicePoint,
+		Token:        token.Token,
+		Number:       token.Number,
+		Status:       token.Status,
+		Counter:      token.Counter,
+		Priority:     token.Priority,
+		At:           time.Now(),
+	}
+	if transferredTo != nil {
+		e.ToServicePoint = transferredTo.ServicePoint
+		e.ToToken = transferredTo.Token
+	}
+	s.broker.Publish(e)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueue walks patients through check-in, calls, a skip and a transfer
+func TestQueue(t *testing.T) {
+	db := openTestDB(t)
+	encounters := NewEncounterService(repository.NewEncounterRepository(db))
+	s := NewQueueService(repository.NewQueueRepository(db), newTestPatientService(t, db), encounters, NewQueueBroker())
+	ctx := context.Background()
+	events, stop := s.Subscribe()
+	defer stop()
+
+	first := createTestPatient(t, db, "first")
+	second := createTestPatient(t, db, "second")
+	elderly := createTestPatient(t, db, "elderly")
+	encounter, err := encounters.CreateEncounter(ctx, &models.Encounter{PatientID: first.ID, Class: models.EncounterClassAmbulatory}, 1)
+	require.NoError(t, err)
+
+	checkIn := func(code string, patientID uint, priority bool, encounterID *uint) (*models.QueueToken, error) {
+		return s.CheckIn(ctx, code, &models.QueueToken{PatientID: patientID, Priority: priority, EncounterID: encounterID}, 1)
+	}
+	a, err := checkIn("general", first.ID, false, &encounter.ID)
+	require.NoError(t, err)
+	b, err := checkIn("general", second.ID, false, nil)
+	require.NoError(t, err)
+	c, err := checkIn("general", elderly.ID, true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"G-001", "G-002", "G-003"}, []string{a.Token, b.Token, c.Token})
+	assert.Equal(t, "issued", (<-events).Type)
+
+	// Checking in marks a planned encounter arrived
+	encounter, err = encounters.GetEncounterByID(encounter.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.EncounterStatusArrived, encounter.Status)
+
+	_, err = checkIn("general", first.ID, false, nil)
+	assert.ErrorIs(t, err, models.ErrQueueCheckedIn)
+	_, err = checkIn("radiology", first.ID, false, nil)
+	assert.ErrorIs(t, err, models.ErrInvalidServicePoint)
+	_, err = checkIn("laboratory", second.ID, false, &encounter.ID)
+	assert.ErrorIs(t, err, models.ErrQueueEncounterOther)
+
+	// The priority token is called first, then in order of check-in
+	called, err := s.CallNext(ctx, "general", "Room 1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, c.ID, called.ID)
+	called, err = s.CallNext(ctx, "general", "Room 2", 2)
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, called.ID)
+	assert.Equal(t, "Room 2", called.Counter)
+
+	display, err := s.Display([]string{"general"})
+	require.NoError(t, err)
+	require.Len(t, display, 1)
+	assert.Equal(t, []string{"G-001", "G-003"}, displayTokens(display[0].NowServing))
+	assert.Equal(t, []string{"G-002"}, displayTokens(display[0].Waiting))
+
+	// A skipped patient who turns up is called before later check-ins
+	_, err = s.Skip(ctx, a.ID)
+	require.NoError(t, err)
+	_, err = s.Skip(ctx, a.ID)
+	assert.ErrorIs(t, err, models.ErrQueueTransition)
+	_, err = s.Requeue(ctx, a.ID)
+	require.NoError(t, err)
+	called, err = s.CallNext(ctx, "general", "Room 1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, called.ID)
+	assert.Equal(t, 2, called.CallCount)
+
+	// A transfer closes the token and issues one at the other service point
+	_, err = s.Transfer(ctx, a.ID, "general", nil, 2)
+	assert.ErrorIs(t, err, models.ErrQueueSamePoint)
+	lab, err := s.Transfer(ctx, a.ID, "laboratory", nil, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "L-001", lab.Token)
+	assert.Equal(t, encounter.ID, *lab.EncounterID)
+	require.NotNil(t, lab.TransferredFromID)
+	assert.Equal(t, a.ID, *lab.TransferredFromID)
+	from, err := s.GetToken(a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.QueueStatusTransferred, from.Status)
+	assert.Equal(t, lab.ID, *from.TransferredToID)
+
+	_, err = s.Complete(ctx, c.ID)
+	require.NoError(t, err)
+	_, err = s.CallNext(ctx, "general", "Room 1", 2)
+	require.NoError(t, err)
+	_, err = s.CallNext(ctx, "general", "Room 1", 2)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	stats, err := s.Stats(QueueDate(time.Now()))
+	require.NoError(t, err)
+	require.Len(t, stats, len(models.QueueServicePoints))
+	for _, row := range stats {
+		switch row.ServicePoint {
+		case "general":
+			assert.EqualValues(t, 1, row.Called)
+			assert.EqualValues(t, 1, row.Done)
+			assert.EqualValues(t, 1, row.Transferred)
+		case "laboratory":
+			assert.EqualValues(t, 1, row.Waiting)
+		default:
+			assert.Zero(t, row.Waiting+row.Called+row.Done)
+		}
+	}
+}
+
+func displayTokens(tokens []models.QueueDisplayToken) []string {
+	shown := make([]string, len(tokens))
+	for i, token := range tokens {
+		shown[i] = token.Token
+	}
+	return shown
+}
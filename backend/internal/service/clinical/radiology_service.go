@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -17,7 +18,7 @@ func NewRadiologyService(repo *repository.RadiologyRepository) *RadiologyService
 	return &RadiologyService{repo: repo}
 }
 
-func (s *RadiologyService) CreateStudy(study *models.ImagingStudy) error {
+func (s *RadiologyService) CreateStudy(ctx context.Context, study *models.ImagingStudy) error {
 	// Generate UIDs if not present (simplified for MVP)
 	if study.StudyUID == "" {
 		study.StudyUID = fmt.Sprintf("1.2.840.10008.%d", time.Now().UnixNano())
@@ -29,19 +30,18 @@ func (s *RadiologyService) CreateStudy(study *models.ImagingStudy) error {
 	study.Status = "scheduled"
 	study.StartedAt = time.Now()
 
-	return s.repo.CreateStudy(study)
+	return s.repo.CreateStudy(ctx, study)
 }
 
 func (s *RadiologyService) GetStudy(id uint) (*models.ImagingStudy, error) {
 	return s.repo.GetStudy(id)
 }
 
-func (s *RadiologyService) ListStudies(patientID uint, status string, page, limit int) ([]models.ImagingStudy, int64, error) {
-	offset := (page - 1) * limit
-	return s.repo.ListStudies(patientID, status, limit, offset)
+func (s *RadiologyService) ListStudies(q repository.ListQuery) (*repository.Page[models.ImagingStudy], error) {
+	return s.repo.ListStudies(q)
 }
 
-func (s *RadiologyService) StartExam(id uint, techID uint) error {
+func (s *RadiologyService) StartExam(ctx context.Context, id uint, techID uint) error {
 	study, err := s.repo.GetStudy(id)
 	if err != nil {
 		return err
@@ -56,16 +56,16 @@ func (s *RadiologyService) StartExam(id uint, techID uint) error {
 
 	// Use repository update or save
 	// For simplicity, we'll use the status update method but ideally we'd update multiple fields
-	return s.repo.UpdateStudyStatus(id, "in-progress")
+	return s.repo.UpdateStudyStatus(ctx, id, "in-progress")
 }
 
-func (s *RadiologyService) CompleteExam(id uint) error {
+func (s *RadiologyService) CompleteExam(ctx context.Context, id uint) error {
 	// In a real system, we'd verify that images have been received
 	// Also update CompletedAt in a real implementation
-	return s.repo.UpdateStudyStatus(id, "completed")
+	return s.repo.UpdateStudyStatus(ctx, id, "completed")
 }
 
-func (s *RadiologyService) CreateReport(report *models.RadiologyReport) error {
+func (s *RadiologyService) CreateReport(ctx context.Context, report *models.RadiologyReport) error {
 	// Check if study exists
 	study, err := s.repo.GetStudy(report.StudyID)
 	if err != nil {
@@ -81,7 +81,7 @@ func (s *RadiologyService) CreateReport(report *models.RadiologyReport) error {
 		report.Status = "draft"
 	}
 
-	return s.repo.CreateReport(report)
+	return s.repo.CreateReport(ctx, report)
 }
 
 func (s *RadiologyService) FinalizeReport(id uint) error {
@@ -90,12 +90,12 @@ func (s *RadiologyService) FinalizeReport(id uint) error {
 	return nil
 }
 
-func (s *RadiologyService) UpdateReport(report *models.RadiologyReport) error {
+func (s *RadiologyService) UpdateReport(ctx context.Context, report *models.RadiologyReport) error {
 	if report.Status == "final" {
 		now := time.Now()
 		report.FinalizedAt = &now
 	}
-	return s.repo.UpdateReport(report)
+	return s.repo.UpdateReport(ctx, report)
 }
 
 func (s *RadiologyService) GetWorklist() ([]models.ImagingStudy, error) {
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+type TriageService struct {
+	repo          *repository.TriageRepository
+	encounterRepo *repository.EncounterRepository
+}
+
+func NewTriageService(repo *repository.TriageRepository, encounterRepo *repository.EncounterRepository) *TriageService {
+	return &TriageService{repo: repo, encounterRepo: encounterRepo}
+}
+
+// TriageEncounter assesses an emergency encounter on the SATS and moves it to
+// triaged. Vital signs not entered with the triage are taken from
+// triage.VitalSignsID or else the encounter's latest measurement. A level
+// other than the computed one needs an override reason. An encounter that was
+// already triaged is re-triaged; the previous assessment is returned.
+func (s *TriageService) TriageEncounter(ctx context.Context, encounterID uint, triage *models.Triage, triagedBy uint) (*models.Triage, *models.Triage, error) {
+	encounter, err := s.encounterRepo.FindByID(encounterID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if encounter.Class != models.EncounterClassEmergency {
+		return nil, nil, models.ErrTriageNotEmergency
+	}
+	previous, err := s.repo.FindByEncounter(encounterID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var change *models.EncounterStatusHistory
+	if encounter.Status != models.EncounterStatusTriaged {
+		from := encounter.Status
+		if err := encounter.TransitionTo(models.EncounterStatusTriaged, now); err != nil {
+			return nil, nil, err
+		}
+		change = &models.EncounterStatusHistory{
+			FromStatus: from,
+			Status:     models.EncounterStatusTriaged,
+			ChangedAt:  now,
+			ChangedBy:  triagedBy,
+		}
+	}
+
+	if err := useEncounterVitalSigns(triage, encounter.VitalSigns); err != nil {
+		return nil, nil, err
+	}
+
+	triage.PresentingComplaint = strings.TrimSpace(triage.PresentingComplaint)
+	if err := triage.Assess(&encounter.Patient, now); err != nil {
+		return nil, nil, err
+	}
+
+	triage.OverrideReason = strings.TrimSpace(triage.OverrideReason)
+	switch {
+	case triage.Level == "" || triage.Level == triage.ComputedLevel:
+		triage.Level = triage.ComputedLevel
+		triage.OverrideReason = ""
+	case !models.IsValidTriageLevel(triage.Level):
+		return nil, nil, models.ErrInvalidTriageLevel
+	case triage.OverrideReason == "":
+		return nil, nil, models.ErrTriageOverrideReason
+	}
+
+	triage.ID = 0
+	if previous != nil {
+		triage.ID = previous.ID
+		triage.CreatedAt = previous.CreatedAt
+	}
+	triage.EncounterID = encounter.ID
+	triage.PatientID = encounter.PatientID
+	triage.TriagedAt = now
+	triage.TriagedBy = triagedBy
+	encounter.Priority = models.TriagePriority(triage.Level)
+
+	saved, err := s.repo.Save(ctx, triage, encounter, change)
+	if err != nil {
+		return nil, nil, err
+	}
+	return saved, previous, nil
+}
+
+// useEncounterVitalSigns fills the triage's missing vital signs from the
+// chosen measurement of the encounter, or its latest one
+func useEncounterVitalSigns(triage *models.Triage, measurements []models.VitalSigns) error {
+	var chosen *models.VitalSigns
+	for i := range measurements {
+		v := &measurements[i]
+		if triage.VitalSignsID != nil {
+			if v.ID == *triage.VitalSignsID {
+				chosen = v
+			}
+		} else if chosen == nil || v.MeasuredAt.After(chosen.MeasuredAt) {
+			chosen = v
+		}
+	}
+	if chosen == nil {
+		if triage.VitalSignsID != nil {
+			return models.ErrTriageVitalSignsNotFound
+		}
+		return nil
+	}
+	triage.UseVitalSigns(chosen)
+	return nil
+}
+
+func (s *TriageService) GetTriage(encounterID uint) (*models.Triage, error) {
+	return s.repo.FindByEncounter(encounterID)
+}
+
+// Board returns the emergency patients waiting to be seen, with how long
+// they have waited and how long is left until the target time of their level
+func (s *TriageService) Board() (*models.ERBoard, error) {
+	entries, err := s.repo.ListWaitingEmergencies()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	board := &models.ERBoard{
+		GeneratedAt:    now,
+		AwaitingTriage: []models.ERBoardEntry{},
+		Waiting:        []models.ERBoardEntry{},
+	}
+	for _, entry := range entries {
+		entry.WaitingMinutes = now.Sub(entry.ArrivedAt).Minutes()
+		if entry.TriagedAt == nil {
+			board.AwaitingTriage = append(board.AwaitingTriage, entry)
+			continue
+		}
+		target := entry.TriagedAt.Add(time.Duration(models.TriageTargetMinutes[entry.Level]) * time.Minute)
+		left := target.Sub(now).Minutes()
+		entry.MinutesToTarget = &left
+		entry.Overdue = left < 0
+		board.Waiting = append(board.Waiting, entry)
+	}
+	return board, nil
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/zarishsphere/zarish-his/internal/models"
@@ -8,14 +10,50 @@ import (
 )
 
 type VitalSignsService struct {
-	repo *repository.VitalSignsRepository
+	repo       *repository.VitalSignsRepository
+	patients   *PatientService
+	thresholds models.EarlyWarningThresholds
 }
 
-func NewVitalSignsService(repo *repository.VitalSignsRepository) *VitalSignsService {
-	return &VitalSignsService{repo: repo}
+func NewVitalSignsService(repo *repository.VitalSignsRepository, patients *PatientService, thresholds models.EarlyWarningThresholds) *VitalSignsService {
+	return &VitalSignsService{repo: repo, patients: patients, thresholds: thresholds}
 }
 
-func (s *VitalSignsService) CreateVitalSigns(vitals *models.VitalSigns) (*models.VitalSigns, error) {
+// CreateVitalSigns records vital signs flagged against their reference ranges
+// and with their early warning score. When the score reaches a more urgent escalation level than the encounter's
+// previous observation an alert is raised with it.
+func (s *VitalSignsService) CreateVitalSigns(ctx context.Context, vitals *models.VitalSigns) (*models.VitalSigns, error) {
+	vitals.Source = models.VitalSourceManual
+	vitals.DeviceID = nil
+	vitals.VerificationStatus = ""
+	vitals.VerifiedBy = nil
+	vitals.VerifiedAt = nil
+	vitals.RejectionReason = ""
+	return s.record(ctx, vitals)
+}
+
+// RecordDeviceReading records a device reading pending validation. A reading
+// the device already sent for the same time is returned instead, with false.
+func (s *VitalSignsService) RecordDeviceReading(ctx context.Context, vitals *models.VitalSigns) (*models.VitalSigns, bool, error) {
+	existing, err := s.repo.FindDeviceReading(*vitals.DeviceID, vitals.MeasuredAt)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, false, err
+	}
+	created, err := s.record(ctx, vitals)
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+func (s *VitalSignsService) record(ctx context.Context, vitals *models.VitalSigns) (*models.VitalSigns, error) {
+	if err := vitals.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Auto-calculate BMI
 	vitals.CalculateBMI()
 
@@ -24,7 +62,74 @@ func (s *VitalSignsService) CreateVitalSigns(vitals *models.VitalSigns) (*models
 		vitals.MeasuredAt = time.Now()
 	}
 
-	return s.repo.Create(vitals)
+	patient, err := s.patients.GetPatientByID(vitals.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	vitals.FlagAbnormal(patient)
+	ews := vitals.ScoreEarlyWarning(patient)
+
+	alert, err := s.escalation(vitals, ews)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Create(ctx, vitals, alert)
+}
+
+// Reassess flags and scores vital signs again after they were corrected.
+// No alert is raised for a corrected observation.
+func (s *VitalSignsService) Reassess(vitals *models.VitalSigns) error {
+	if err := vitals.Validate(); err != nil {
+		return err
+	}
+	patient, err := s.patients.GetPatientByID(vitals.PatientID)
+	if err != nil {
+		return err
+	}
+	vitals.FlagAbnormal(patient)
+	vitals.ScoreEarlyWarning(patient)
+	return nil
+}
+
+// escalation returns the alert to raise for a scored observation, or nil when
+// its level is no more urgent than that of the encounter's previous observation
+func (s *VitalSignsService) escalation(vitals *models.VitalSigns, ews models.EarlyWarning) (*models.EarlyWarningAlert, error) {
+	index, level := s.thresholds.Level(ews.System, ews.Score, ews.RedParameter)
+	if index < 0 {
+		return nil, nil
+	}
+
+	var previousScore *int
+	previous, err := s.repo.LatestScoredBefore(vitals.EncounterID, vitals.MeasuredAt)
+	switch {
+	case err == nil:
+		// A previous score of another system, after a birthday, is compared
+		// on the current system's thresholds
+		previousIndex, _ := s.thresholds.Level(ews.System, *previous.EWSScore, previous.EWSRisk == models.EarlyWarningRiskLowMedium)
+		if previousIndex >= index {
+			return nil, nil
+		}
+		previousScore = previous.EWSScore
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	return &models.EarlyWarningAlert{
+		EncounterID:   vitals.EncounterID,
+		PatientID:     vitals.PatientID,
+		System:        ews.System,
+		Score:         ews.Score,
+		Risk:          ews.Risk,
+		Level:         level,
+		PreviousScore: previousScore,
+		Status:        models.EarlyWarningAlertOpen,
+		RaisedAt:      time.Now(),
+	}, nil
+}
+
+// ReferenceRanges returns the vital sign reference range catalog
+func (s *VitalSignsService) ReferenceRanges() []models.VitalReferenceRange {
+	return models.VitalReferenceRanges
 }
 
 func (s *VitalSignsService) GetVitalSignsByID(id uint) (*models.VitalSigns, error) {
@@ -35,6 +140,75 @@ func (s *VitalSignsService) ListEncounterVitalSigns(encounterID uint) ([]*models
 	return s.repo.ListByEncounter(encounterID)
 }
 
-func (s *VitalSignsService) ListPatientVitalSigns(patientID uint, limit int) ([]*models.VitalSigns, error) {
-	return s.repo.ListByPatient(patientID, limit)
+func (s *VitalSignsService) ListPatientVitalSigns(patientID uint, q repository.ListQuery) (*repository.Page[models.VitalSigns], error) {
+	return s.repo.ListByPatient(patientID, q)
+}
+
+// ListPendingDeviceReadings returns a page of device readings awaiting a
+// nurse's validation, optionally only those of a ward
+func (s *VitalSignsService) ListPendingDeviceReadings(wardID *uint, q repository.ListQuery) (*repository.Page[models.VitalSigns], error) {
+	return s.repo.ListPending(wardID, q)
+}
+
+// ValidateDeviceReading confirms a device reading
+func (s *VitalSignsService) ValidateDeviceReading(ctx context.Context, id, by uint) (*models.VitalSigns, error) {
+	vitals, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := vitals.Verify(models.VerificationValidated, by, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.Verify(ctx, vitals)
+}
+
+// RejectDeviceReading discards a device reading as an artefact, e.g. a
+// displaced probe, with the reason
+func (s *VitalSignsService) RejectDeviceReading(ctx context.Context, id uint, reason string, by uint) (*models.VitalSigns, error) {
+	if reason == "" {
+		return nil, models.ErrRejectReasonMissing
+	}
+	vitals, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := vitals.Verify(models.VerificationRejected, by, time.Now()); err != nil {
+		return nil, err
+	}
+	vitals.RejectionReason = reason
+	return s.repo.Verify(ctx, vitals)
+}
+
+// Trends returns the time series of a patient's vital signs measured in
+// [from, to) with their statistics per day, week or month
+func (s *VitalSignsService) Trends(patientID uint, vitals []string, period string, from, to time.Time) ([]models.VitalTrend, error) {
+	observations, err := s.repo.ListByPatientBetween(patientID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return models.VitalTrends(observations, vitals, period)
+}
+
+// ListAlerts returns a page of early warning alerts, newest first, optionally
+// only those of a status
+func (s *VitalSignsService) ListAlerts(status string, q repository.ListQuery) (*repository.Page[models.EarlyWarningAlert], error) {
+	return s.repo.ListAlerts(status, q)
+}
+
+// AcknowledgeAlert records the response to an open alert
+func (s *VitalSignsService) AcknowledgeAlert(ctx context.Context, id uint, response string, by uint) (*models.EarlyWarningAlert, error) {
+	alert, err := s.repo.FindAlert(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := alert.Acknowledge(by, response, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateAlert(ctx, alert)
+}
+
+// WardEarlyWarning lists the patients admitted to a ward with their latest
+// early warning score, highest first
+func (s *VitalSignsService) WardEarlyWarning(wardID uint) ([]models.WardEarlyWarning, error) {
+	return s.repo.WardEarlyWarning(wardID)
 }
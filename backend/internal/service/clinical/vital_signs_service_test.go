@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVitalSignsReferenceRanges checks recorded and corrected vital signs are
+// flagged for the patient's age and pregnancy status
+func TestVitalSignsReferenceRanges(t *testing.T) {
+	db := openTestDB(t)
+	s := NewVitalSignsService(repository.NewVitalSignsRepository(db), newTestPatientService(t, db), models.DefaultEarlyWarningThresholds())
+	ctx := context.Background()
+
+	patient := func(name string, born time.Time, gender string) *models.Patient {
+		p := createTestPatient(t, db, name)
+		require.NoError(t, db.Model(p).UpdateColumns(map[string]interface{}{"birth_date": born, "gender": gender}).Error)
+		return p
+	}
+	infant := patient("infant", time.Now().AddDate(0, -6, 0), "male")
+	mother := patient("mother", time.Now().AddDate(-25, 0, 0), "female")
+	pulse := func(i int) *int { return &i }
+
+	recorded, err := s.CreateVitalSigns(ctx, &models.VitalSigns{PatientID: infant.ID, PulseRate: pulse(150)})
+	require.NoError(t, err)
+	assert.Equal(t, models.VitalFlagNormal, recorded.PulseRateFlag)
+
+	recorded, err = s.CreateVitalSigns(ctx, &models.VitalSigns{PatientID: mother.ID, PulseRate: pulse(105)})
+	require.NoError(t, err)
+	assert.Equal(t, models.VitalFlagHigh, recorded.PulseRateFlag)
+	stored, err := s.GetVitalSignsByID(recorded.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.VitalFlagHigh, stored.PulseRateFlag)
+
+	// Correcting the pregnancy status flags the pulse again
+	stored.Pregnant = true
+	require.NoError(t, s.Reassess(stored))
+	assert.Equal(t, models.VitalFlagNormal, stored.PulseRateFlag)
+
+	stored.PatientID = mother.ID + 1000
+	assert.ErrorIs(t, s.Reassess(stored), repository.ErrNotFound)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// ExportResourceTypes are the resource types included in $everything and $export,
+// in the order they are written
+var ExportResourceTypes = []string{
+	"Patient", "Encounter", "Appointment", "Observation", "Composition", "DocumentReference",
+	"QuestionnaireResponse", "MedicationRequest", "MedicationDispense", "ServiceRequest", "ImagingStudy", "DiagnosticReport",
+}
+
+// exportStep exports one table; a table can yield more than one resource type
+type exportStep struct {
+	types []string
+	run   func(repository.ExportFilter, func(*FHIRRecord) error) error
+}
+
+// exportTable adapts a batched repository export to a stream of records
+func exportTable[T any](export func(repository.ExportFilter, func([]*T) error) error, toRecords func(*T) []*FHIRRecord) func(repository.ExportFilter, func(*FHIRRecord) error) error {
+	return func(filter repository.ExportFilter, emit func(*FHIRRecord) error) error {
+		return export(filter, func(batch []*T) error {
+			for _, item := range batch {
+				for _, record := range toRecords(item) {
+					if err := emit(record); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func one[T any](toRecord func(*T) *FHIRRecord) func(*T) []*FHIRRecord {
+	return func(item *T) []*FHIRRecord { return []*FHIRRecord{toRecord(item)} }
+}
+
+// exportSteps lists the tables in dependency order, so a transaction Bundle
+// creates referenced resources before the resources that point at them
+func (s *FHIRService) exportSteps() []exportStep {
+	return []exportStep{
+		{[]string{"Patient"}, exportTable(s.repo.ExportPatients, one(patientRecord))},
+		{[]string{"Encounter"}, exportTable(s.repo.ExportEncounters, one(encounterRecord))},
+		{[]string{"Appointment"}, exportTable(s.repo.ExportAppointments, one(appointmentRecord))},
+		{[]string{"Observation"}, exportTable(s.repo.ExportVitalSigns, one(vitalSignsRecord))},
+		{[]string{"Composition", "DocumentReference"}, exportTable(s.repo.ExportClinicalNotes, clinicalNoteRecords)},
+		{[]string{"QuestionnaireResponse", "Observation"}, exportTable(s.repo.ExportNCDScreenings, ncdScreeningRecords)},
+		{[]string{"MedicationRequest"}, exportTable(s.repo.ExportPrescriptions, one(prescriptionRecord))},
+		{[]string{"MedicationDispense"}, exportTable(s.repo.ExportDispensings, one(dispensingRecord))},
+		{[]string{"ServiceRequest"}, exportTable(s.repo.ExportLabOrders, one(labOrderRecord))},
+		{[]string{"Observation"}, exportTable(s.repo.ExportLabResults, one(labResultRecord))},
+		{[]string{"ImagingStudy", "DiagnosticReport"}, exportTable(s.repo.ExportImagingStudies, imagingStudyRecords)},
+	}
+}
+
+// Export streams every resource matching the filter to emit. types limits the
+// export to some resource types; empty means all of ExportResourceTypes.
+func (s *FHIRService) Export(filter repository.ExportFilter, types []string, emit func(*FHIRRecord) error) error {
+	wanted := map[string]bool{}
+	for _, resourceType := range types {
+		if !containsType(ExportResourceTypes, resourceType) {
+			return invalidf("resource type %q cannot be exported", resourceType)
+		}
+		wanted[resourceType] = true
+	}
+	if len(wanted) == 0 {
+		for _, resourceType := range ExportResourceTypes {
+			wanted[resourceType] = true
+		}
+	}
+
+	for _, step := range s.exportSteps() {
+		include := false
+		for _, resourceType := range step.types {
+			include = include || wanted[resourceType]
+		}
+		if !include {
+			continue
+		}
+		err := step.run(filter, func(record *FHIRRecord) error {
+			if !wanted[record.ResourceType] {
+				return nil
+			}
+			return emit(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseExportParams reads the $export parameters: _type (comma separated),
+// patient (comma separated references), _since and _until. The date range
+// covers records last modified from the start of _since to the end of _until.
+// Bulk exports leave the facility, so they only include patients who
+// consented to data sharing.
+func ParseExportParams(params url.Values) (repository.ExportFilter, []string, error) {
+	filter := repository.ExportFilter{ConsentScope: models.ConsentScopeDataSharing}
+	var types []string
+
+	if raw := params.Get("_type"); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+	if raw := params.Get("patient"); raw != "" {
+		for _, ref := range strings.Split(raw, ",") {
+			id, err := fhir.ParseReference(&fhir.Reference{Reference: strings.TrimSpace(ref)}, "Patient")
+			if err != nil {
+				return filter, nil, invalidf("patient: %v", err)
+			}
+			if id == 0 {
+				continue
+			}
+			filter.PatientIDs = append(filter.PatientIDs, id)
+		}
+	}
+	if raw := params.Get("_since"); raw != "" {
+		date, err := parseFHIRDate(raw)
+		if err != nil || date.Prefix != "eq" {
+			return filter, nil, invalidf("_since: invalid date %q", raw)
+		}
+		filter.Since = &date.Start
+	}
+	if raw := params.Get("_until"); raw != "" {
+		date, err := parseFHIRDate(raw)
+		if err != nil || date.Prefix != "eq" {
+			return filter, nil, invalidf("_until: invalid date %q", raw)
+		}
+		filter.Until = &date.End
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Since.Before(*filter.Until) {
+		return filter, nil, invalidf("_since must be before _until")
+	}
+	return filter, types, nil
+}
+
+// Everything returns the patient and every record about them, ready to be
+// packaged as a transaction Bundle. The records leave the facility, so the
+// patient must have consented to data sharing; otherwise ErrConsentRequired
+// is returned.
+func (s *FHIRService) Everything(id string) ([]*FHIRRecord, error) {
+	patientID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	if exists, err := s.repo.Exists(&models.Patient{}, uint(patientID)); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, repository.ErrNotFound
+	}
+
+	var records []*FHIRRecord
+	filter := repository.ExportFilter{PatientIDs: []uint{uint(patientID)}, ConsentScope: models.ConsentScopeDataSharing}
+	err = s.Export(filter, nil, func(record *FHIRRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The Patient is written first; without consent nothing is
+	if len(records) == 0 {
+		return nil, ErrConsentRequired
+	}
+	return records, nil
+}
+
+func containsType(types []string, target string) bool {
+	for _, t := range types {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// clinicalNoteRecords exports a note both as a Composition and as a
+// DocumentReference, since receiving systems often support only one of them
+func clinicalNoteRecords(n *models.ClinicalNote) []*FHIRRecord {
+	composition := fhir.CompositionFromClinicalNote(n)
+	document := fhir.DocumentReferenceFromClinicalNote(n)
+	return []*FHIRRecord{
+		{ResourceType: composition.ResourceType, ID: composition.ID, Resource: composition, AuditType: "ClinicalNote", RecordID: n.ID, PatientID: n.PatientID, Model: n},
+		{ResourceType: document.ResourceType, ID: document.ID, Resource: document, AuditType: "ClinicalNote", RecordID: n.ID, PatientID: n.PatientID, Model: n},
+	}
+}
+
+// ncdScreeningRecords exports a screening as a QuestionnaireResponse followed
+// by the Observations derived from it
+func ncdScreeningRecords(sc *models.NCDScreening) []*FHIRRecord {
+	records := []*FHIRRecord{ncdScreeningRecord(sc)}
+	for _, res := range fhir.ObservationsFromNCDScreening(sc) {
+		records = append(records, &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "NCDScreening", RecordID: sc.ID, PatientID: sc.PatientID, Model: sc})
+	}
+	return records
+}
+
+func dispensingRecord(d *models.Dispensing) *FHIRRecord {
+	res := fhir.MedicationDispenseFromModel(d)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Dispensing", RecordID: d.ID, PatientID: d.PatientID, Model: d}
+}
+
+// imagingStudyRecords exports a study followed by its report, if any
+func imagingStudyRecords(st *models.ImagingStudy) []*FHIRRecord {
+	records := []*FHIRRecord{imagingStudyRecord(st)}
+	if st.Report != nil {
+		res := fhir.DiagnosticReportFromRadiologyReport(st.Report, st)
+		records = append(records, &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "RadiologyReport", RecordID: st.Report.ID, PatientID: st.PatientID, Model: st.Report})
+	}
+	return records
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEverythingRequiresConsent checks $everything releases nothing about a
+// patient who has not consented to data sharing
+func TestEverythingRequiresConsent(t *testing.T) {
+	db := openTestDB(t)
+	s := &FHIRService{repo: repository.NewFHIRRepository(db)}
+
+	declined := createTestPatient(t, db, "declined")
+	recordConsent(t, db, declined.ID, models.ConsentScopeDataSharing, models.ConsentStatusRejected)
+	consented := createTestPatient(t, db, "consented")
+	recordConsent(t, db, consented.ID, models.ConsentScopeDataSharing, models.ConsentStatusActive)
+	unasked := createTestPatient(t, db, "unasked")
+
+	tests := []struct {
+		name    string
+		patient *models.Patient
+		wantErr error
+	}{
+		{"declined", declined, ErrConsentRequired},
+		{"never asked", unasked, ErrConsentRequired},
+		{"consented", consented, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.Everything(fmt.Sprint(tt.patient.ID))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, records)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, records)
+			assert.Equal(t, "Patient", records[0].ResourceType)
+			for _, record := range records {
+				assert.Equal(t, tt.patient.ID, record.PatientID)
+			}
+		})
+	}
+
+	_, err := s.Everything("999999")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
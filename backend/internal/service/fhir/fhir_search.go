@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// FHIR search paging limits
+const (
+	fhirDefaultCount = 20
+	fhirMaxCount     = 100
+)
+
+var fhirDatePrefixes = map[string]bool{
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true, "sa": true, "eb": true,
+}
+
+// parseFHIRSearch parses the parameters shared by all resource types. dateParam is
+// the resource's date search parameter name; statusCodes maps a FHIR status to the
+// internal statuses it covers. It returns ok=false when a criterion can never match.
+func parseFHIRSearch(params url.Values, dateParam string, statusCodes func(string) []string) (repository.FHIRSearch, bool, error) {
+	search := repository.FHIRSearch{Count: fhirDefaultCount}
+
+	if raw := params.Get("_count"); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil || count < 0 {
+			return search, false, invalidf("invalid _count %q", raw)
+		}
+		if count > fhirMaxCount {
+			count = fhirMaxCount
+		}
+		search.Count = count
+	}
+	if raw := params.Get("_offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return search, false, invalidf("invalid _offset %q", raw)
+		}
+		search.Offset = offset
+	}
+
+	if raw := params.Get("_id"); raw != "" {
+		for _, value := range strings.Split(raw, ",") {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				// IDs are numeric, so anything else cannot match
+				return search, false, nil
+			}
+			search.IDs = append(search.IDs, uint(id))
+		}
+	}
+
+	for _, name := range []string{"patient", "subject"} {
+		if raw := params.Get(name); raw != "" {
+			id, err := fhir.ParseReference(&fhir.Reference{Reference: raw}, "Patient")
+			if err != nil {
+				return search, false, invalidf("%s: %v", name, err)
+			}
+			search.PatientID = &id
+		}
+	}
+
+	if raw := params.Get("status"); raw != "" && statusCodes != nil {
+		for _, code := range strings.Split(raw, ",") {
+			search.Statuses = append(search.Statuses, statusCodes(code)...)
+		}
+		if len(search.Statuses) == 0 {
+			return search, false, nil
+		}
+	}
+
+	if dateParam != "" {
+		for _, raw := range params[dateParam] {
+			filter, err := parseFHIRDate(raw)
+			if err != nil {
+				return search, false, invalidf("%s: %v", dateParam, err)
+			}
+			search.Dates = append(search.Dates, filter)
+		}
+	}
+
+	return search, true, nil
+}
+
+// parsePatientSearch adds the Patient-specific parameters
+func parsePatientSearch(params url.Values, search *repository.FHIRSearch) (bool, error) {
+	search.Name = params.Get("name")
+	search.Gender = params.Get("gender")
+
+	if raw := params.Get("identifier"); raw != "" {
+		system, value := "", raw
+		if i := strings.Index(raw, "|"); i >= 0 {
+			system, value = raw[:i], raw[i+1:]
+		}
+		// Values are stored normalized, so the search value is normalized the same way
+		if system == "" {
+			search.IdentifierValues = models.IdentifierLookupValues(value)
+		} else {
+			search.IdentifierSystem = system
+			search.IdentifierValues = []string{models.FindIdentifierSystem(system).Normalize(value)}
+		}
+		if len(search.IdentifierValues) == 0 || search.IdentifierValues[0] == "" {
+			return false, nil
+		}
+	}
+
+	for _, raw := range params["birthdate"] {
+		filter, err := parseFHIRDate(raw)
+		if err != nil {
+			return false, invalidf("birthdate: %v", err)
+		}
+		search.BirthDates = append(search.BirthDates, filter)
+	}
+	return true, nil
+}
+
+// parseFHIRDate parses a date search value such as "ge2024-01" into the range
+// covered by its precision
+func parseFHIRDate(raw string) (repository.DateFilter, error) {
+	filter := repository.DateFilter{Prefix: "eq"}
+	if len(raw) > 2 && fhirDatePrefixes[raw[:2]] {
+		filter.Prefix, raw = raw[:2], raw[2:]
+	}
+
+	var err error
+	switch len(raw) {
+	case 4:
+		filter.Start, err = time.Parse("2006", raw)
+		filter.End = filter.Start.AddDate(1, 0, 0)
+	case 7:
+		filter.Start, err = time.Parse("2006-01", raw)
+		filter.End = filter.Start.AddDate(0, 1, 0)
+	case 10:
+		filter.Start, err = time.Parse(fhir.DateFormat, raw)
+		filter.End = filter.Start.AddDate(0, 0, 1)
+	default:
+		filter.Start, err = time.Parse(fhir.DateTimeFormat, raw)
+		filter.End = filter.Start.Add(time.Second)
+	}
+	if err != nil {
+		return filter, fmt.Errorf("invalid date %q", raw)
+	}
+	return filter, nil
+}
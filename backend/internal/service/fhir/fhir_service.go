@@ -0,0 +1,776 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/fhir"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+var (
+	// ErrFHIRInvalid is returned for malformed resources, references and search parameters
+	ErrFHIRInvalid = errors.New("invalid FHIR request")
+	// ErrFHIRUnsupported is returned for resource types the facade does not serve
+	ErrFHIRUnsupported = errors.New("unsupported FHIR resource type")
+)
+
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFHIRInvalid, fmt.Sprintf(format, args...))
+}
+
+// FHIRRecord is a FHIR resource together with the record it was mapped from,
+// so callers can audit access in terms of the internal resource
+type FHIRRecord struct {
+	ResourceType string
+	ID           string
+	Resource     interface{}
+	AuditType    string
+	RecordID     uint
+	PatientID    uint
+	Model        interface{}
+}
+
+// FHIRSearchResult is one page of search matches
+type FHIRSearchResult struct {
+	Records []*FHIRRecord
+	Total   int64
+	Offset  int
+	Count   int
+}
+
+// FHIRService exposes the domain models as FHIR R4 resources. Creates go through
+// the existing domain services so their defaults and checks apply; updates map the
+// resource onto the stored record and save it.
+type FHIRService struct {
+	repo               *repository.FHIRRepository
+	patientService     *PatientService
+	encounterService   *EncounterService
+	appointmentService *AppointmentService
+	labService         *LabService
+	vitalSignsService  *VitalSignsService
+	medicationService  *MedicationService
+	radiologyService   *RadiologyService
+}
+
+func NewFHIRService(
+	repo *repository.FHIRRepository,
+	patientService *PatientService,
+	encounterService *EncounterService,
+	appointmentService *AppointmentService,
+	labService *LabService,
+	vitalSignsService *VitalSignsService,
+	medicationService *MedicationService,
+	radiologyService *RadiologyService,
+) *FHIRService {
+	return &FHIRService{
+		repo:               repo,
+		patientService:     patientService,
+		encounterService:   encounterService,
+		appointmentService: appointmentService,
+		labService:         labService,
+		vitalSignsService:  vitalSignsService,
+		medicationService:  medicationService,
+		radiologyService:   radiologyService,
+	}
+}
+
+// Read returns a single resource
+func (s *FHIRService) Read(resourceType, id string) (*FHIRRecord, error) {
+	if resourceType == "Observation" {
+		if screeningID, ok := fhir.ParseNCDObservationID(id); ok {
+			return s.loadNCDObservation(id, screeningID)
+		}
+		prefix, recordID, err := fhir.ParseObservationID(id)
+		if err != nil {
+			return nil, repository.ErrNotFound
+		}
+		return s.loadObservation(prefix, recordID)
+	}
+
+	recordID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.load(resourceType, uint(recordID))
+}
+
+// load reads a record and maps it to its resource
+func (s *FHIRService) load(resourceType string, id uint) (*FHIRRecord, error) {
+	switch resourceType {
+	case "Patient":
+		var patient models.Patient
+		if err := s.repo.Find(&patient, id, "Identifiers"); err != nil {
+			return nil, err
+		}
+		return patientRecord(&patient), nil
+	case "Encounter":
+		var encounter models.Encounter
+		if err := s.repo.Find(&encounter, id); err != nil {
+			return nil, err
+		}
+		return encounterRecord(&encounter), nil
+	case "Appointment":
+		var appointment models.Appointment
+		if err := s.repo.Find(&appointment, id); err != nil {
+			return nil, err
+		}
+		return appointmentRecord(&appointment), nil
+	case "ServiceRequest":
+		var order models.LabOrder
+		if err := s.repo.Find(&order, id, "Results.LabTest"); err != nil {
+			return nil, err
+		}
+		return labOrderRecord(&order), nil
+	case "MedicationRequest":
+		var prescription models.Prescription
+		if err := s.repo.Find(&prescription, id, "Medication"); err != nil {
+			return nil, err
+		}
+		return prescriptionRecord(&prescription), nil
+	case "ImagingStudy":
+		var study models.ImagingStudy
+		if err := s.repo.Find(&study, id, "Series.Instances"); err != nil {
+			return nil, err
+		}
+		return imagingStudyRecord(&study), nil
+	case "QuestionnaireResponse":
+		var screening models.NCDScreening
+		if err := s.repo.Find(&screening, id); err != nil {
+			return nil, err
+		}
+		return ncdScreeningRecord(&screening), nil
+	case "Questionnaire":
+		var questionnaire models.Questionnaire
+		if err := s.repo.Find(&questionnaire, id); err != nil {
+			return nil, err
+		}
+		return questionnaireRecord(&questionnaire)
+	}
+	return nil, ErrFHIRUnsupported
+}
+
+// loadNCDObservation reads one of the Observations of an NCD screening
+func (s *FHIRService) loadNCDObservation(id string, screeningID uint) (*FHIRRecord, error) {
+	var screening models.NCDScreening
+	if err := s.repo.Find(&screening, screeningID); err != nil {
+		return nil, err
+	}
+	for _, record := range ncdScreeningRecords(&screening)[1:] {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *FHIRService) loadObservation(prefix string, id uint) (*FHIRRecord, error) {
+	if prefix == fhir.VitalsObservationPrefix {
+		var vitals models.VitalSigns
+		if err := s.repo.Find(&vitals, id); err != nil {
+			return nil, err
+		}
+		return vitalSignsRecord(&vitals), nil
+	}
+	var result models.LabResult
+	if err := s.repo.Find(&result, id, "LabOrder", "LabTest"); err != nil {
+		return nil, err
+	}
+	return labResultRecord(&result), nil
+}
+
+// Search runs a FHIR search and returns one page of matches
+func (s *FHIRService) Search(resourceType string, params url.Values) (*FHIRSearchResult, error) {
+	switch resourceType {
+	case "Patient":
+		search, ok, err := parseFHIRSearch(params, "", nil)
+		if err == nil && ok {
+			ok, err = parsePatientSearch(params, &search)
+		}
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		patients, total, err := s.repo.SearchPatients(search)
+		return searchResult(search, total, err, patients, patientRecord)
+	case "Encounter":
+		search, ok, err := parseFHIRSearch(params, "date", fhir.EncounterStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		encounters, total, err := s.repo.SearchEncounters(search)
+		return searchResult(search, total, err, encounters, encounterRecord)
+	case "Appointment":
+		search, ok, err := parseFHIRSearch(params, "date", fhir.AppointmentStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		appointments, total, err := s.repo.SearchAppointments(search)
+		return searchResult(search, total, err, appointments, appointmentRecord)
+	case "ServiceRequest":
+		search, ok, err := parseFHIRSearch(params, "authored", fhir.ServiceRequestStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		orders, total, err := s.repo.SearchLabOrders(search)
+		return searchResult(search, total, err, orders, labOrderRecord)
+	case "MedicationRequest":
+		search, ok, err := parseFHIRSearch(params, "authoredon", fhir.MedicationRequestStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		prescriptions, total, err := s.repo.SearchPrescriptions(search)
+		return searchResult(search, total, err, prescriptions, prescriptionRecord)
+	case "ImagingStudy":
+		search, ok, err := parseFHIRSearch(params, "started", fhir.ImagingStudyStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		studies, total, err := s.repo.SearchImagingStudies(search)
+		return searchResult(search, total, err, studies, imagingStudyRecord)
+	case "QuestionnaireResponse":
+		search, ok, err := parseFHIRSearch(params, "authored", fhir.QuestionnaireResponseStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		screenings, total, err := s.repo.SearchNCDScreenings(search)
+		return searchResult(search, total, err, screenings, ncdScreeningRecord)
+	case "Questionnaire":
+		search, ok, err := parseFHIRSearch(params, "date", fhir.QuestionnaireStatusCodes)
+		if err != nil || !ok {
+			return emptySearch(search, err)
+		}
+		questionnaires, total, err := s.repo.SearchQuestionnaires(search)
+		if err != nil {
+			return nil, err
+		}
+		var records []*FHIRRecord
+		for _, questionnaire := range questionnaires {
+			record, err := questionnaireRecord(questionnaire)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return &FHIRSearchResult{Records: records, Total: total, Offset: search.Offset, Count: search.Count}, nil
+	case "Observation":
+		return s.searchObservations(params)
+	}
+	return nil, ErrFHIRUnsupported
+}
+
+// searchObservations pages across lab results followed by vital signs
+func (s *FHIRService) searchObservations(params url.Values) (*FHIRSearchResult, error) {
+	includeLab, includeVitals := true, true
+	if raw := params.Get("category"); raw != "" {
+		includeLab, includeVitals = false, false
+		for _, category := range splitTokens(raw) {
+			includeLab = includeLab || category == fhir.ObservationCategoryLaboratory
+			includeVitals = includeVitals || category == fhir.ObservationCategoryVitalSigns
+		}
+	}
+
+	// Observation IDs carry a source prefix, so _id is split per table
+	var labIDs, vitalsIDs []uint
+	if raw := params.Get("_id"); raw != "" {
+		for _, id := range splitTokens(raw) {
+			prefix, recordID, err := fhir.ParseObservationID(id)
+			if err != nil {
+				continue
+			}
+			if prefix == fhir.VitalsObservationPrefix {
+				vitalsIDs = append(vitalsIDs, recordID)
+			} else {
+				labIDs = append(labIDs, recordID)
+			}
+		}
+		includeLab = includeLab && len(labIDs) > 0
+		includeVitals = includeVitals && len(vitalsIDs) > 0
+		params = cloneValues(params)
+		params.Del("_id")
+	}
+
+	search, ok, err := parseFHIRSearch(params, "date", fhir.LabResultStatusCodes)
+	if err != nil {
+		return nil, err
+	}
+	// Vital signs are always final and are filtered on the raw status instead
+	vitalsSearch, vitalsOK, err := parseFHIRSearch(params, "date", func(code string) []string { return []string{code} })
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FHIRSearchResult{Offset: search.Offset, Count: search.Count}
+	var labTotal int64
+	if includeLab && ok {
+		search.IDs = labIDs
+		results, total, err := s.repo.SearchLabResults(search)
+		if err != nil {
+			return nil, err
+		}
+		labTotal = total
+		for _, r := range results {
+			result.Records = append(result.Records, labResultRecord(r))
+		}
+	}
+	if includeVitals && vitalsOK {
+		vitalsSearch.IDs = vitalsIDs
+		vitalsSearch.Offset = search.Offset - int(labTotal)
+		if vitalsSearch.Offset < 0 {
+			vitalsSearch.Offset = 0
+		}
+		vitalsSearch.Count = search.Count - len(result.Records)
+		vitals, total, err := s.repo.SearchVitalSigns(vitalsSearch)
+		if err != nil {
+			return nil, err
+		}
+		result.Total += total
+		for _, v := range vitals {
+			result.Records = append(result.Records, vitalSignsRecord(v))
+		}
+	}
+	result.Total += labTotal
+	return result, nil
+}
+
+// Create maps a resource to a new record and stores it through the domain services.
+// actorID is recorded as the creating user where the model tracks it, in place
+// of any requester or performer in the resource.
+func (s *FHIRService) Create(ctx context.Context, resourceType string, body []byte, actorID uint) (*FHIRRecord, error) {
+	switch resourceType {
+	case "Patient":
+		var res fhir.Patient
+		patient := &models.Patient{}
+		if err := decodeResource(body, &res, func() error { return fhir.PatientToModel(&res, patient) }); err != nil {
+			return nil, err
+		}
+		created, _, err := s.patientService.CreatePatient(ctx, patient)
+		if err != nil {
+			return nil, err
+		}
+		return patientRecord(created), nil
+
+	case "Encounter":
+		var res fhir.Encounter
+		encounter := &models.Encounter{}
+		if err := decodeResource(body, &res, func() error { return fhir.EncounterToModel(&res, encounter) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, encounter.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		created, err := s.encounterService.CreateEncounter(ctx, encounter, actorID)
+		if err != nil {
+			return nil, err
+		}
+		return encounterRecord(created), nil
+
+	case "Appointment":
+		var res fhir.Appointment
+		appointment := &models.Appointment{}
+		if err := decodeResource(body, &res, func() error { return fhir.AppointmentToModel(&res, appointment) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, appointment.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		appointment.CreatedBy = actorID
+		created, err := s.appointmentService.CreateAppointment(ctx, appointment)
+		if err != nil {
+			return nil, err
+		}
+		return appointmentRecord(created), nil
+
+	case "ServiceRequest":
+		var res fhir.ServiceRequest
+		order := &models.LabOrder{}
+		if err := decodeResource(body, &res, func() error { return fhir.ServiceRequestToModel(&res, order) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireEncounter(order.EncounterID, order.PatientID); err != nil {
+			return nil, err
+		}
+		order.PractitionerID = actorID
+		created, err := s.labService.CreateLabOrder(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		return labOrderRecord(created), nil
+
+	case "Observation":
+		var res fhir.Observation
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, invalidf("%v", err)
+		}
+		if fhir.IsVitalSignsObservation(&res) {
+			vitals := &models.VitalSigns{}
+			if err := fhir.ObservationToVitalSigns(&res, vitals); err != nil {
+				return nil, invalidf("%v", err)
+			}
+			if err := s.requireEncounter(vitals.EncounterID, vitals.PatientID); err != nil {
+				return nil, err
+			}
+			vitals.RecordedBy = actorID
+			created, err := s.vitalSignsService.CreateVitalSigns(ctx, vitals)
+			if err != nil {
+				return nil, err
+			}
+			return vitalSignsRecord(created), nil
+		}
+
+		result := &models.LabResult{}
+		if err := s.mapLabResult(&res, result); err != nil {
+			return nil, err
+		}
+		result.PerformedBy = actorID
+		created, err := s.labService.AddLabResult(ctx, result)
+		if err != nil {
+			return nil, err
+		}
+		return s.loadObservation(fhir.LabObservationPrefix, created.ID)
+
+	case "MedicationRequest":
+		var res fhir.MedicationRequest
+		prescription := &models.Prescription{}
+		if err := decodeResource(body, &res, func() error { return fhir.MedicationRequestToModel(&res, prescription) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireEncounter(prescription.EncounterID, prescription.PatientID); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Medication{}, prescription.MedicationID, "Medication"); err != nil {
+			return nil, err
+		}
+		prescription.PractitionerID = actorID
+		created, err := s.medicationService.CreatePrescription(ctx, prescription)
+		if err != nil {
+			return nil, err
+		}
+		return s.load("MedicationRequest", created.ID)
+
+	case "ImagingStudy":
+		var res fhir.ImagingStudy
+		study := &models.ImagingStudy{}
+		if err := decodeResource(body, &res, func() error { return fhir.ImagingStudyToModel(&res, study) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, study.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		if err := s.radiologyService.CreateStudy(ctx, study); err != nil {
+			return nil, err
+		}
+		return imagingStudyRecord(study), nil
+	}
+	return nil, ErrFHIRUnsupported
+}
+
+// Update maps a resource onto the stored record and saves it. actorID is
+// recorded as the user who changed an encounter's status; the recorded
+// requester, performer and booking user are kept.
+func (s *FHIRService) Update(ctx context.Context, resourceType, id string, body []byte, actorID uint) (*FHIRRecord, error) {
+	stored, err := s.Read(resourceType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &header); err != nil {
+		return nil, invalidf("%v", err)
+	}
+	if header.ID != id {
+		return nil, invalidf("resource id %q does not match the URL id %q", header.ID, id)
+	}
+
+	var after *FHIRRecord
+	switch current := stored.Model.(type) {
+	case *models.Patient:
+		patient := *current
+		var res fhir.Patient
+		if err := decodeResource(body, &res, func() error { return fhir.PatientToModel(&res, &patient) }); err != nil {
+			return nil, err
+		}
+		// Saved through the patient service so the identifiers are stored too
+		updated, err := s.patientService.UpdatePatient(ctx, &patient)
+		if err != nil {
+			return nil, err
+		}
+		after = patientRecord(updated)
+
+	case *models.Encounter:
+		encounter := *current
+		var res fhir.Encounter
+		if err := decodeResource(body, &res, func() error { return fhir.EncounterToModel(&res, &encounter) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, encounter.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		// Saved through the encounter service so status changes are checked and recorded
+		updated, err := s.encounterService.UpdateEncounter(ctx, &encounter, actorID)
+		if err != nil {
+			return nil, err
+		}
+		after = encounterRecord(updated)
+
+	case *models.Appointment:
+		appointment := *current
+		var res fhir.Appointment
+		if err := decodeResource(body, &res, func() error { return fhir.AppointmentToModel(&res, &appointment) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, appointment.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		appointment.CreatedBy = current.CreatedBy
+		after, err = s.save(ctx, &appointment, appointmentRecord(&appointment))
+
+	case *models.LabOrder:
+		order := *current
+		var res fhir.ServiceRequest
+		if err := decodeResource(body, &res, func() error { return fhir.ServiceRequestToModel(&res, &order) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireEncounter(order.EncounterID, order.PatientID); err != nil {
+			return nil, err
+		}
+		order.PractitionerID = current.PractitionerID
+		after, err = s.save(ctx, &order, labOrderRecord(&order))
+
+	case *models.LabResult:
+		result := *current
+		var res fhir.Observation
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, invalidf("%v", err)
+		}
+		if err := s.mapLabResult(&res, &result); err != nil {
+			return nil, err
+		}
+		result.PerformedBy = current.PerformedBy
+		if err := s.repo.Save(ctx, &result); err != nil {
+			return nil, err
+		}
+		after, err = s.loadObservation(fhir.LabObservationPrefix, result.ID)
+
+	case *models.VitalSigns:
+		vitals := *current
+		var res fhir.Observation
+		if err := decodeResource(body, &res, func() error { return fhir.ObservationToVitalSigns(&res, &vitals) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireEncounter(vitals.EncounterID, vitals.PatientID); err != nil {
+			return nil, err
+		}
+		vitals.CalculateBMI()
+		if err := s.vitalSignsService.Reassess(&vitals); err != nil {
+			return nil, err
+		}
+		after, err = s.save(ctx, &vitals, vitalSignsRecord(&vitals))
+
+	case *models.Prescription:
+		prescription := *current
+		var res fhir.MedicationRequest
+		if err := decodeResource(body, &res, func() error { return fhir.MedicationRequestToModel(&res, &prescription) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireEncounter(prescription.EncounterID, prescription.PatientID); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Medication{}, prescription.MedicationID, "Medication"); err != nil {
+			return nil, err
+		}
+		prescription.PractitionerID = current.PractitionerID
+		if err := s.repo.Save(ctx, &prescription); err != nil {
+			return nil, err
+		}
+		after, err = s.load("MedicationRequest", prescription.ID)
+
+	case *models.ImagingStudy:
+		study := *current
+		var res fhir.ImagingStudy
+		if err := decodeResource(body, &res, func() error { return fhir.ImagingStudyToModel(&res, &study) }); err != nil {
+			return nil, err
+		}
+		if err := s.requireExists(&models.Patient{}, study.PatientID, "Patient"); err != nil {
+			return nil, err
+		}
+		after, err = s.save(ctx, &study, imagingStudyRecord(&study))
+
+	default:
+		return nil, ErrFHIRUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+func (s *FHIRService) save(ctx context.Context, model interface{}, record *FHIRRecord) (*FHIRRecord, error) {
+	if err := s.repo.Save(ctx, model); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// mapLabResult maps an Observation onto a lab result and resolves its lab test
+func (s *FHIRService) mapLabResult(res *fhir.Observation, result *models.LabResult) error {
+	if err := fhir.ObservationToLabResult(res, result); err != nil {
+		return invalidf("%v", err)
+	}
+	if err := s.requireExists(&models.LabOrder{}, result.LabOrderID, "ServiceRequest"); err != nil {
+		return err
+	}
+
+	code := fhir.ObservationLabTestCode(res)
+	if code == "" {
+		return invalidf("code must identify a lab test (%s)", fhir.SystemLabTestCode)
+	}
+	test, err := s.repo.FindLabTestByCode(code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return invalidf("unknown lab test code %q", code)
+	}
+	if err != nil {
+		return err
+	}
+	result.LabTestID = test.ID
+	result.DetermineAbnormalFlag(test)
+	return nil
+}
+
+// requireExists rejects references to records that do not exist
+func (s *FHIRService) requireExists(model interface{}, id uint, resourceType string) error {
+	exists, err := s.repo.Exists(model, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return invalidf("%s/%d does not exist", resourceType, id)
+	}
+	return nil
+}
+
+// requireEncounter checks that the encounter exists and belongs to the patient
+func (s *FHIRService) requireEncounter(encounterID, patientID uint) error {
+	var encounter models.Encounter
+	err := s.repo.Find(&encounter, encounterID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return invalidf("Encounter/%d does not exist", encounterID)
+	}
+	if err != nil {
+		return err
+	}
+	if encounter.PatientID != patientID {
+		return invalidf("Encounter/%d does not belong to Patient/%d", encounterID, patientID)
+	}
+	return nil
+}
+
+// decodeResource unmarshals the body into res and applies it with mapToModel
+func decodeResource(body []byte, res interface{}, mapToModel func() error) error {
+	if err := json.Unmarshal(body, res); err != nil {
+		return invalidf("%v", err)
+	}
+	if err := mapToModel(); err != nil {
+		return invalidf("%v", err)
+	}
+	return nil
+}
+
+func emptySearch(search repository.FHIRSearch, err error) (*FHIRSearchResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &FHIRSearchResult{Offset: search.Offset, Count: search.Count}, nil
+}
+
+func searchResult[T any](search repository.FHIRSearch, total int64, err error, items []T, toRecord func(T) *FHIRRecord) (*FHIRSearchResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := &FHIRSearchResult{Total: total, Offset: search.Offset, Count: search.Count}
+	for _, item := range items {
+		result.Records = append(result.Records, toRecord(item))
+	}
+	return result, nil
+}
+
+func splitTokens(raw string) []string {
+	var tokens []string
+	for _, token := range strings.Split(raw, ",") {
+		// Drop an optional system prefix (system|code)
+		if i := strings.LastIndex(token, "|"); i >= 0 {
+			token = token[i+1:]
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := url.Values{}
+	for key, v := range values {
+		clone[key] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+func patientRecord(p *models.Patient) *FHIRRecord {
+	res := fhir.PatientFromModel(p)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Patient", RecordID: p.ID, PatientID: p.ID, Model: p}
+}
+
+func encounterRecord(e *models.Encounter) *FHIRRecord {
+	res := fhir.EncounterFromModel(e)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Encounter", RecordID: e.ID, PatientID: e.PatientID, Model: e}
+}
+
+func appointmentRecord(a *models.Appointment) *FHIRRecord {
+	res := fhir.AppointmentFromModel(a)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Appointment", RecordID: a.ID, PatientID: a.PatientID, Model: a}
+}
+
+func labOrderRecord(o *models.LabOrder) *FHIRRecord {
+	res := fhir.ServiceRequestFromModel(o)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "LabOrder", RecordID: o.ID, PatientID: o.PatientID, Model: o}
+}
+
+func labResultRecord(r *models.LabResult) *FHIRRecord {
+	res := fhir.ObservationFromLabResult(r)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "LabResult", RecordID: r.ID, PatientID: r.LabOrder.PatientID, Model: r}
+}
+
+func vitalSignsRecord(v *models.VitalSigns) *FHIRRecord {
+	res := fhir.ObservationFromVitalSigns(v)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "VitalSigns", RecordID: v.ID, PatientID: v.PatientID, Model: v}
+}
+
+func prescriptionRecord(p *models.Prescription) *FHIRRecord {
+	res := fhir.MedicationRequestFromModel(p)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Prescription", RecordID: p.ID, PatientID: p.PatientID, Model: p}
+}
+
+func ncdScreeningRecord(sc *models.NCDScreening) *FHIRRecord {
+	res := fhir.QuestionnaireResponseFromNCDScreening(sc)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "NCDScreening", RecordID: sc.ID, PatientID: sc.PatientID, Model: sc}
+}
+
+// questionnaireRecord maps a stored form definition, which is not about a patient
+func questionnaireRecord(q *models.Questionnaire) (*FHIRRecord, error) {
+	res, err := fhir.QuestionnaireFromModel(q)
+	if err != nil {
+		return nil, err
+	}
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "Questionnaire", RecordID: q.ID, Model: q}, nil
+}
+
+func imagingStudyRecord(st *models.ImagingStudy) *FHIRRecord {
+	res := fhir.ImagingStudyFromModel(st)
+	return &FHIRRecord{ResourceType: res.ResourceType, ID: res.ID, Resource: res, AuditType: "ImagingStudy", RecordID: st.ID, PatientID: st.PatientID, Model: st}
+}
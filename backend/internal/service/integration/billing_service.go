@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"time"
 
 	"zarish-his/backend/internal/domain/models"
@@ -15,8 +16,8 @@ func NewBillingService(repo *postgres.BillingRepository) *BillingService {
 	return &BillingService{repo: repo}
 }
 
-func (s *BillingService) GenerateInvoice(invoice *models.Invoice) error {
-	return s.repo.CreateInvoice(invoice)
+func (s *BillingService) GenerateInvoice(ctx context.Context, invoice *models.Invoice) error {
+	return s.repo.CreateInvoice(ctx, invoice)
 }
 
 func (s *BillingService) GetInvoice(id uint) (*models.Invoice, error) {
@@ -27,12 +28,12 @@ func (s *BillingService) GetPatientInvoices(patientID uint) ([]models.Invoice, e
 	return s.repo.GetPatientInvoices(patientID)
 }
 
-func (s *BillingService) GetOutstandingInvoices() ([]models.Invoice, error) {
-	return s.repo.GetOutstandingInvoices()
+func (s *BillingService) GetOutstandingInvoices(q postgres.ListQuery) (*postgres.Page[models.Invoice], error) {
+	return s.repo.GetOutstandingInvoices(q)
 }
 
-func (s *BillingService) RecordPayment(payment *models.Payment) error {
-	return s.repo.CreatePayment(payment)
+func (s *BillingService) RecordPayment(ctx context.Context, payment *models.Payment) error {
+	return s.repo.CreatePayment(ctx, payment)
 }
 
 func (s *BillingService) GetInvoicePayments(invoiceID uint) ([]models.Payment, error) {
@@ -43,8 +44,8 @@ func (s *BillingService) GetPaymentReport(startDate, endDate time.Time) ([]model
 	return s.repo.GetPaymentReport(startDate, endDate)
 }
 
-func (s *BillingService) SubmitInsuranceClaim(claim *models.InsuranceClaim) error {
-	return s.repo.CreateClaim(claim)
+func (s *BillingService) SubmitInsuranceClaim(ctx context.Context, claim *models.InsuranceClaim) error {
+	return s.repo.CreateClaim(ctx, claim)
 }
 
 func (s *BillingService) GetClaim(id uint) (*models.InsuranceClaim, error) {
@@ -55,10 +56,10 @@ func (s *BillingService) GetPendingClaims() ([]models.InsuranceClaim, error) {
 	return s.repo.GetPendingClaims()
 }
 
-func (s *BillingService) ApproveClaim(id uint, approvedAmount float64) error {
-	return s.repo.UpdateClaimStatus(id, "Approved", approvedAmount, "")
+func (s *BillingService) ApproveClaim(ctx context.Context, id uint, approvedAmount float64) error {
+	return s.repo.UpdateClaimStatus(ctx, id, "Approved", approvedAmount, "")
 }
 
-func (s *BillingService) RejectClaim(id uint, reason string) error {
-	return s.repo.UpdateClaimStatus(id, "Rejected", 0, reason)
+func (s *BillingService) RejectClaim(ctx context.Context, id uint, reason string) error {
+	return s.repo.UpdateClaimStatus(ctx, id, "Rejected", 0, reason)
 }
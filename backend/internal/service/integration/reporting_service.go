@@ -14,10 +14,6 @@ func NewReportingService(repo *postgres.ReportingRepository) *ReportingService {
 	return &ReportingService{repo: repo}
 }
 
-func (s *ReportingService) GetPatientActivity(patientID uint, startDate, endDate time.Time) (map[string]interface{}, error) {
-	return s.repo.GetPatientActivity(patientID, startDate, endDate)
-}
-
 func (s *ReportingService) GetAppointmentAnalytics(startDate, endDate time.Time) (map[string]interface{}, error) {
 	return s.repo.GetAppointmentAnalytics(startDate, endDate)
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+var (
+	ErrConsentNotActive = errors.New("only a consent that is in force can be withdrawn")
+	ErrConsentRequired  = errors.New("the patient has not consented to this use of their records")
+)
+
+// ConsentService records patients' consent decisions. Other services check
+// HasConsent, or filter by repository consent scope, before using a patient's
+// data for the scope's purpose.
+type ConsentService struct {
+	repo     *repository.ConsentRepository
+	patients *PatientService
+}
+
+func NewConsentService(repo *repository.ConsentRepository, patients *PatientService) *ConsentService {
+	return &ConsentService{repo: repo, patients: patients}
+}
+
+// RecordConsent records a patient's decision on a scope, superseding the
+// previous decision on it
+func (s *ConsentService) RecordConsent(ctx context.Context, consent *models.Consent) (*models.Consent, error) {
+	patient, err := s.patients.GetPatientByID(consent.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MergedIntoID != nil {
+		return nil, ErrPatientMerged
+	}
+
+	consent.Normalize()
+	if consent.GrantedAt.IsZero() {
+		consent.GrantedAt = time.Now()
+	}
+	consent.WithdrawnAt = nil
+	consent.WithdrawnBy = nil
+	consent.WithdrawnReason = ""
+	if err := consent.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.Create(ctx, consent)
+}
+
+// WithdrawConsent ends a consent that is in force
+func (s *ConsentService) WithdrawConsent(ctx context.Context, id uint, reason string, withdrawnBy uint) (*models.Consent, error) {
+	consent, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if consent.Status != models.ConsentStatusActive {
+		return nil, ErrConsentNotActive
+	}
+	consent.Withdraw(reason, withdrawnBy)
+	return s.repo.Update(ctx, consent)
+}
+
+func (s *ConsentService) GetConsent(id uint) (*models.Consent, error) {
+	return s.repo.FindByID(id)
+}
+
+// ListPatientConsents returns a page of the patient's consent history
+func (s *ConsentService) ListPatientConsents(patientID uint, q repository.ListQuery) (*repository.Page[models.Consent], error) {
+	if _, err := s.patients.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByPatient(patientID, q)
+}
+
+// HasConsent checks if the patient currently consents to scope
+func (s *ConsentService) HasConsent(patientID uint, scope string) (bool, error) {
+	return s.repo.HasConsent(patientID, scope)
+}
+
+// RequireConsent returns ErrConsentRequired unless the patient currently
+// consents to scope
+func (s *ConsentService) RequireConsent(patientID uint, scope string) error {
+	consented, err := s.HasConsent(patientID, scope)
+	if err != nil {
+		return err
+	}
+	if !consented {
+		return ErrConsentRequired
+	}
+	return nil
+}
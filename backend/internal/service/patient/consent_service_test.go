@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordConsentReplacesDecision checks a patient can change their mind:
+// each decision supersedes the last, and withdrawal ends consent
+func TestRecordConsentReplacesDecision(t *testing.T) {
+	db := openTestDB(t)
+	s := NewConsentService(repository.NewConsentRepository(db), newTestPatientService(t, db))
+	ctx := context.Background()
+	patient := createTestPatient(t, db, "consent")
+
+	record := func(status string) *models.Consent {
+		t.Helper()
+		consent, err := s.RecordConsent(ctx, &models.Consent{
+			PatientID: patient.ID, Scope: " Data-Sharing ", Status: status, WitnessName: "Amina Begum", RecordedBy: 1,
+		})
+		require.NoError(t, err)
+		return consent
+	}
+	assertConsent := func(want bool) {
+		t.Helper()
+		err := s.RequireConsent(patient.ID, models.ConsentScopeDataSharing)
+		if want {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, ErrConsentRequired)
+		}
+	}
+
+	assertConsent(false)
+	declined := record(models.ConsentStatusRejected)
+	assert.Equal(t, models.ConsentScopeDataSharing, declined.Scope)
+	assertConsent(false)
+
+	given := record(models.ConsentStatusActive)
+	assertConsent(true)
+	stored, err := s.GetConsent(declined.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusInactive, stored.Status)
+
+	declinedAgain := record(models.ConsentStatusRejected)
+	assertConsent(false)
+	stored, err = s.GetConsent(given.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusInactive, stored.Status)
+
+	// Only a consent in force can be withdrawn
+	_, err = s.WithdrawConsent(ctx, declinedAgain.ID, "changed mind", 1)
+	assert.ErrorIs(t, err, ErrConsentNotActive)
+	given = record(models.ConsentStatusActive)
+	withdrawn, err := s.WithdrawConsent(ctx, given.ID, "changed mind", 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConsentStatusInactive, withdrawn.Status)
+	assertConsent(false)
+
+	history, err := s.ListPatientConsents(patient.ID, repository.ListQuery{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, history.Total)
+}
+
+func TestRecordConsentRejects(t *testing.T) {
+	db := openTestDB(t)
+	s := NewConsentService(repository.NewConsentRepository(db), newTestPatientService(t, db))
+	patient := createTestPatient(t, db, "consent")
+
+	tests := []struct {
+		name    string
+		consent models.Consent
+		wantErr error
+	}{
+		{"unknown patient", models.Consent{PatientID: 999999, Scope: models.ConsentScopeDataSharing, Status: models.ConsentStatusRejected}, repository.ErrNotFound},
+		{"unknown scope", models.Consent{PatientID: patient.ID, Scope: "marketing", Status: models.ConsentStatusRejected}, models.ErrInvalidConsentScope},
+		{"withdrawn status", models.Consent{PatientID: patient.ID, Scope: models.ConsentScopeDataSharing, Status: models.ConsentStatusInactive}, models.ErrInvalidConsentStatus},
+		{"given without evidence", models.Consent{PatientID: patient.ID, Scope: models.ConsentScopeDataSharing, Status: models.ConsentStatusActive}, models.ErrConsentEvidenceRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.RecordConsent(context.Background(), &tt.consent)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to the PostgreSQL database in TEST_DATABASE_URL and
+// migrates every model into a schema of its own, dropped when the test ends.
+// Tests that need a database are skipped without TEST_DATABASE_URL.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	require.NoError(t, admin.Exec("CREATE SCHEMA "+schema).Error)
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	sep := " search_path="
+	if strings.Contains(dsn, "://") {
+		sep = "?search_path="
+		if strings.Contains(dsn, "?") {
+			sep = "&search_path="
+		}
+	}
+	db, err := gorm.Open(postgres.Open(dsn+sep+schema), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	require.NoError(t, db.AutoMigrate(models.All()...))
+	require.NoError(t, repository.NewAuditRepository(db).InstallImmutabilityTrigger())
+	return db
+}
+
+// createTestPatient stores a patient with a unique MRN
+func createTestPatient(t *testing.T, db *gorm.DB, name string) *models.Patient {
+	t.Helper()
+	patient := &models.Patient{MRN: fmt.Sprintf("TEST-%s-%d", name, time.Now().UnixNano())}
+	require.NoError(t, db.Create(patient).Error)
+	return patient
+}
+
+// recordConsent stores a patient's decision on a scope, granted an hour ago
+func recordConsent(t *testing.T, db *gorm.DB, patientID uint, scope, status string) {
+	t.Helper()
+	consent := &models.Consent{PatientID: patientID, Scope: scope, Status: status, GrantedAt: time.Now().Add(-time.Hour), RecordedBy: 1}
+	_, err := repository.NewConsentRepository(db).Create(context.Background(), consent)
+	require.NoError(t, err)
+}
+
+// newTestPatientService builds a PatientService on db with the default MRN format
+func newTestPatientService(t *testing.T, db *gorm.DB) *PatientService {
+	t.Helper()
+	mrnFormat, err := NewMRNFormat("", "")
+	require.NoError(t, err)
+	return NewPatientService(repository.NewPatientRepository(db), repository.NewPatientDuplicateRepository(db),
+		repository.NewPatientMergeRepository(db), mrnFormat)
+}
+
+// createTestUser stores an active user with a unique username
+func createTestUser(t *testing.T, db *gorm.DB, role string, patientID *uint) *models.User {
+	t.Helper()
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	user := &models.User{Username: name, Password: "x", Email: name + "@example.org", Role: role, PatientID: patientID, Active: true}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// minMotherAge is how much older than the child a linked mother must be, when
+// both birth dates are known
+const minMotherAge = 10
+
+var (
+	ErrAlreadyInHousehold = errors.New("patient already belongs to a household; remove them from it first")
+	ErrNotHouseholdMember = errors.New("patient is not a current member of this household")
+	ErrHouseholdHead      = errors.New("the head of the household cannot be removed or recoded; appoint a new head first")
+	ErrInvalidMother      = errors.New("invalid mother")
+)
+
+// HouseholdService registers households and the family links between patients
+type HouseholdService struct {
+	repo     *repository.HouseholdRepository
+	patients *PatientService
+}
+
+func NewHouseholdService(repo *repository.HouseholdRepository, patients *PatientService) *HouseholdService {
+	return &HouseholdService{repo: repo, patients: patients}
+}
+
+// CreateHousehold registers a household with its members, exactly one of whom is the head
+func (s *HouseholdService) CreateHousehold(ctx context.Context, household *models.Household) (*models.Household, error) {
+	household.Normalize()
+	now := time.Now()
+	for i := range household.Members {
+		member := &household.Members[i]
+		member.BaseModel = models.BaseModel{}
+		member.Patient = nil
+		member.LeftAt = nil
+		if member.JoinedAt.IsZero() {
+			member.JoinedAt = now
+		}
+	}
+	if err := household.Validate(); err != nil {
+		return nil, err
+	}
+	for _, member := range household.Members {
+		if err := s.checkJoinable(member.PatientID); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := s.repo.Create(ctx, household)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(created.ID)
+}
+
+// checkJoinable checks that the patient exists, is not a merged record and is
+// not a current member of any household
+func (s *HouseholdService) checkJoinable(patientID uint) error {
+	patient, err := s.patients.GetPatientByID(patientID)
+	if err != nil {
+		return err
+	}
+	if patient.MergedIntoID != nil {
+		return ErrPatientMerged
+	}
+	if _, err := s.repo.FindCurrentByPatient(patientID); err == nil {
+		return ErrAlreadyInHousehold
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *HouseholdService) GetHousehold(id uint) (*models.Household, error) {
+	return s.repo.FindByID(id)
+}
+
+// GetPatientHousehold returns the household the patient currently lives in
+func (s *HouseholdService) GetPatientHousehold(patientID uint) (*models.Household, error) {
+	return s.repo.FindCurrentByPatient(patientID)
+}
+
+// UpdateHousehold changes the case number and shared address of a household
+func (s *HouseholdService) UpdateHousehold(ctx context.Context, id uint, changes *models.Household) (*models.Household, error) {
+	household, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	changes.Normalize()
+	household.UNHCRCaseNumber = changes.UNHCRCaseNumber
+	household.CampName = changes.CampName
+	household.BlockNumber = changes.BlockNumber
+	household.ShelterNumber = changes.ShelterNumber
+	household.AddressLine1 = changes.AddressLine1
+	household.District = changes.District
+	household.Division = changes.Division
+	household.Phone = changes.Phone
+	if _, err := s.repo.Update(ctx, household); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(id)
+}
+
+func (s *HouseholdService) SearchHouseholds(caseNumber, camp, block, shelter string) ([]*models.Household, error) {
+	return s.repo.Search(strings.ToUpper(strings.TrimSpace(caseNumber)), strings.TrimSpace(camp),
+		strings.TrimSpace(block), strings.TrimSpace(shelter))
+}
+
+// AddMember adds a patient to the household. A new head is appointed with
+// ChangeHead instead.
+func (s *HouseholdService) AddMember(ctx context.Context, householdID, patientID uint, relationship string) (*models.Household, error) {
+	household, err := s.repo.FindByID(householdID)
+	if err != nil {
+		return nil, err
+	}
+	relationship = strings.ToLower(strings.TrimSpace(relationship))
+	if _, ok := models.HouseholdRelationships[relationship]; !ok {
+		return nil, models.ErrInvalidHouseholdRelationship
+	}
+	if relationship == models.HouseholdRelationshipHead {
+		return nil, models.ErrHouseholdHeadRequired
+	}
+	if err := s.checkJoinable(patientID); err != nil {
+		return nil, err
+	}
+
+	member := &models.HouseholdMember{PatientID: patientID, Relationship: relationship, JoinedAt: time.Now()}
+	if _, err := s.repo.AddMember(ctx, household, member); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(householdID)
+}
+
+// UpdateMember changes a member's relationship to the head
+func (s *HouseholdService) UpdateMember(ctx context.Context, householdID, patientID uint, relationship string) (*models.Household, error) {
+	household, err := s.repo.FindByID(householdID)
+	if err != nil {
+		return nil, err
+	}
+	member := household.CurrentMember(patientID)
+	if member == nil {
+		return nil, ErrNotHouseholdMember
+	}
+	relationship = strings.ToLower(strings.TrimSpace(relationship))
+	if _, ok := models.HouseholdRelationships[relationship]; !ok {
+		return nil, models.ErrInvalidHouseholdRelationship
+	}
+	if member.Relationship == models.HouseholdRelationshipHead || relationship == models.HouseholdRelationshipHead {
+		return nil, ErrHouseholdHead
+	}
+
+	member.Relationship = relationship
+	if err := s.repo.UpdateMembers(ctx, member); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(householdID)
+}
+
+// RemoveMember ends a patient's membership, e.g. when they move out or die
+func (s *HouseholdService) RemoveMember(ctx context.Context, householdID, patientID uint, reason string) (*models.Household, error) {
+	household, err := s.repo.FindByID(householdID)
+	if err != nil {
+		return nil, err
+	}
+	member := household.CurrentMember(patientID)
+	if member == nil {
+		return nil, ErrNotHouseholdMember
+	}
+	if member.Relationship == models.HouseholdRelationshipHead {
+		return nil, ErrHouseholdHead
+	}
+
+	member.Leave(reason)
+	if err := s.repo.UpdateMembers(ctx, member); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(householdID)
+}
+
+// ChangeHead appoints a current member as head of the household. The former
+// head stays a member with formerHeadRelationship, their relationship to the
+// new head; other members keep theirs until they are recoded.
+func (s *HouseholdService) ChangeHead(ctx context.Context, householdID, patientID uint, formerHeadRelationship string) (*models.Household, error) {
+	household, err := s.repo.FindByID(householdID)
+	if err != nil {
+		return nil, err
+	}
+	member := household.CurrentMember(patientID)
+	if member == nil {
+		return nil, ErrNotHouseholdMember
+	}
+	head := household.Head()
+	if head != nil && head.ID == member.ID {
+		return household, nil
+	}
+
+	changed := []*models.HouseholdMember{member}
+	if head != nil {
+		formerHeadRelationship = strings.ToLower(strings.TrimSpace(formerHeadRelationship))
+		if _, ok := models.HouseholdRelationships[formerHeadRelationship]; !ok || formerHeadRelationship == models.HouseholdRelationshipHead {
+			return nil, models.ErrInvalidHouseholdRelationship
+		}
+		head.Relationship = formerHeadRelationship
+		changed = append(changed, head)
+	}
+	member.Relationship = models.HouseholdRelationshipHead
+	if err := s.repo.UpdateMembers(ctx, changed...); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(householdID)
+}
+
+// SetMother links a child to its mother for immunization and MNCH follow-up;
+// nil removes the link. The mother must be a different, female, unmerged
+// patient and, when both birth dates are known, at least minMotherAge years older.
+func (s *HouseholdService) SetMother(ctx context.Context, childID uint, motherID *uint) (*models.Patient, error) {
+	child, err := s.patients.GetPatientByID(childID)
+	if err != nil {
+		return nil, err
+	}
+	if motherID != nil {
+		mother, err := s.patients.GetPatientByID(*motherID)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateMother(child, mother); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.patients.repo.SetMother(ctx, childID, motherID); err != nil {
+		return nil, err
+	}
+	child.MotherID = motherID
+	return child, nil
+}
+
+func validateMother(child, mother *models.Patient) error {
+	switch {
+	case mother.ID == child.ID:
+		return fmt.Errorf("%w: a patient cannot be their own mother", ErrInvalidMother)
+	case mother.MergedIntoID != nil:
+		return ErrPatientMerged
+	case mother.Gender != "female":
+		return fmt.Errorf("%w: the mother's record must be female", ErrInvalidMother)
+	case mother.MotherID != nil && *mother.MotherID == child.ID:
+		return fmt.Errorf("%w: the patient is the mother's mother", ErrInvalidMother)
+	}
+	if child.BirthDate != nil && mother.BirthDate != nil &&
+		child.BirthDate.Before(mother.BirthDate.AddDate(minMotherAge, 0, 0)) {
+		return fmt.Errorf("%w: the mother must be at least %d years older than the child", ErrInvalidMother, minMotherAge)
+	}
+	return nil
+}
+
+// ListChildren returns the children linked to a mother
+func (s *HouseholdService) ListChildren(motherID uint) ([]*models.Patient, error) {
+	if _, err := s.patients.GetPatientByID(motherID); err != nil {
+		return nil, err
+	}
+	return s.patients.repo.FindChildren(motherID)
+}
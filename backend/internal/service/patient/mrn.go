@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMRNTemplate is the MRN format used when none is configured
+const DefaultMRNTemplate = "MRN-{SEQ:6}"
+
+var ErrInvalidMRN = errors.New("invalid MRN: the check digit does not match, the number was probably mistyped")
+
+// mrnToken matches the placeholders of an MRN template
+var mrnToken = regexp.MustCompile(`\{(FACILITY|YYYY|YY|SEQ(?::(\d+))?|CHECK)\}`)
+
+// MRNFormat builds and checks MRNs from a template such as
+// "{FACILITY}-{YY}-{SEQ:6}{CHECK}". Placeholders:
+//
+//	{FACILITY}  facility code
+//	{YYYY}/{YY} registration year; the sequence restarts every year
+//	{SEQ:n}     sequence number, zero padded to n digits
+//	{CHECK}     Luhn mod-10 check digit over all digits before it
+type MRNFormat struct {
+	template string
+	facility string
+	yearly   bool
+	check    bool
+
+	// shape matches any MRN of this format, from any facility and year
+	shape *regexp.Regexp
+}
+
+// NewMRNFormat parses an MRN template for the given facility
+func NewMRNFormat(template, facility string) (*MRNFormat, error) {
+	if template == "" {
+		template = DefaultMRNTemplate
+	}
+	f := &MRNFormat{template: template, facility: strings.ToUpper(strings.TrimSpace(facility))}
+
+	if len(mrnToken.FindAllString(template, -1)) != strings.Count(template, "{") {
+		return nil, fmt.Errorf("MRN template %q has an unknown placeholder", template)
+	}
+	if strings.Count(template, "{SEQ") != 1 {
+		return nil, fmt.Errorf("MRN template %q must contain exactly one {SEQ} placeholder", template)
+	}
+	if strings.Contains(template, "{CHECK}") && !strings.HasSuffix(template, "{CHECK}") {
+		return nil, fmt.Errorf("MRN template %q must end with {CHECK}", template)
+	}
+	if strings.Contains(template, "{FACILITY}") && f.facility == "" {
+		return nil, fmt.Errorf("MRN template %q needs a facility code", template)
+	}
+	f.yearly = strings.Contains(template, "{YY")
+	f.check = strings.Contains(template, "{CHECK}")
+
+	shape := f.pattern(func(placeholder, _ string) string {
+		switch placeholder {
+		case "FACILITY":
+			return `[A-Z0-9]+`
+		case "YYYY":
+			return `[0-9]{4}`
+		case "YY":
+			return `[0-9]{2}`
+		case "CHECK":
+			return `[0-9]`
+		}
+		return `[0-9]+`
+	})
+	var err error
+	if f.shape, err = regexp.Compile("(?i)" + shape); err != nil {
+		return nil, fmt.Errorf("MRN template %q: %v", template, err)
+	}
+	return f, nil
+}
+
+// pattern turns the template into an anchored regular expression: literal
+// text is quoted and each placeholder is replaced by expand(name, width)
+func (f *MRNFormat) pattern(expand func(placeholder, width string) string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range mrnToken.FindAllStringSubmatchIndex(f.template, -1) {
+		b.WriteString(regexp.QuoteMeta(f.template[last:loc[0]]))
+		placeholder := f.template[loc[2]:loc[3]]
+		width := ""
+		if loc[4] >= 0 {
+			width = f.template[loc[4]:loc[5]]
+		}
+		if strings.HasPrefix(placeholder, "SEQ") {
+			placeholder = "SEQ"
+		}
+		b.WriteString(expand(placeholder, width))
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(f.template[last:]))
+	b.WriteString("$")
+	return b.String()
+}
+
+// Period is the counter period an MRN issued at t belongs to: the year for
+// templates that contain one, otherwise empty
+func (f *MRNFormat) Period(t time.Time) string {
+	if f.yearly {
+		return strconv.Itoa(t.Year())
+	}
+	return ""
+}
+
+// Facility returns the facility code the format issues MRNs for
+func (f *MRNFormat) Facility() string {
+	return f.facility
+}
+
+// Format renders the MRN for a sequence number issued at t
+func (f *MRNFormat) Format(seq int64, t time.Time) string {
+	mrn := mrnToken.ReplaceAllStringFunc(f.template, func(token string) string {
+		m := mrnToken.FindStringSubmatch(token)
+		switch {
+		case m[1] == "FACILITY":
+			return f.facility
+		case m[1] == "YYYY":
+			return strconv.Itoa(t.Year())
+		case m[1] == "YY":
+			return fmt.Sprintf("%02d", t.Year()%100)
+		case m[1] == "CHECK":
+			return token // filled in below, once the rest is known
+		default:
+			width, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%0*d", width, seq)
+		}
+	})
+	if f.check {
+		body := strings.TrimSuffix(mrn, "{CHECK}")
+		mrn = body + strconv.Itoa(luhnCheckDigit(body))
+	}
+	return mrn
+}
+
+// SequencePattern returns a regular expression (valid in both Go and
+// PostgreSQL) matching this facility's MRNs for the period of t, with the
+// sequence number as its only capture group. It is used to seed a new counter
+// from MRNs issued before the counter existed.
+func (f *MRNFormat) SequencePattern(t time.Time) string {
+	return f.pattern(func(placeholder, _ string) string {
+		switch placeholder {
+		case "FACILITY":
+			return regexp.QuoteMeta(f.facility)
+		case "YYYY":
+			return strconv.Itoa(t.Year())
+		case "YY":
+			return fmt.Sprintf("%02d", t.Year()%100)
+		case "CHECK":
+			return `[0-9]`
+		}
+		return `([0-9]+)`
+	})
+}
+
+// Matches reports whether s has the shape of an MRN of this format
+func (f *MRNFormat) Matches(s string) bool {
+	return f.shape.MatchString(strings.TrimSpace(s))
+}
+
+// Validate checks an MRN of this format, including its check digit
+func (f *MRNFormat) Validate(mrn string) error {
+	mrn = strings.TrimSpace(mrn)
+	if !f.shape.MatchString(mrn) {
+		return fmt.Errorf("invalid MRN: expected the format %s", f.template)
+	}
+	if f.check && luhnCheckDigit(mrn[:len(mrn)-1]) != int(mrn[len(mrn)-1]-'0') {
+		return ErrInvalidMRN
+	}
+	return nil
+}
+
+// luhnCheckDigit computes the Luhn mod-10 check digit of the digits in s;
+// other characters are ignored
+func luhnCheckDigit(s string) int {
+	sum := 0
+	double := true
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
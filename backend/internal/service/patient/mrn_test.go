@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuhnCheckDigit(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"7992739871", 3},
+		{"411111111111111", 1},
+		{"0", 0},
+		{"", 0},
+		{"CXB-24-000042", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			assert.Equal(t, tt.want, luhnCheckDigit(tt.body))
+		})
+	}
+}
+
+func TestNewMRNFormatRejectsBadTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		facility string
+	}{
+		{"unknown placeholder", "{FACILITY}-{SEQ:6}-{WARD}", "CXB"},
+		{"no sequence", "{FACILITY}-{YY}", "CXB"},
+		{"two sequences", "{SEQ:4}-{SEQ:4}", ""},
+		{"check digit not last", "{CHECK}{SEQ:6}", ""},
+		{"facility without a code", "{FACILITY}-{SEQ:6}", " "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMRNFormat(tt.template, tt.facility)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMRNFormat(t *testing.T) {
+	issued := time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		template   string
+		seq        int64
+		want       string
+		wantPeriod string
+	}{
+		{"default", "", 42, "MRN-000042", ""},
+		{"facility and year", "{FACILITY}-{YY}-{SEQ:6}", 42, "CXB-24-000042", "2024"},
+		{"four digit year", "{FACILITY}{YYYY}{SEQ:4}", 7, "CXB20240007", "2024"},
+		{"sequence wider than padding", "{SEQ:2}", 1234, "1234", ""},
+		{"check digit", "{FACILITY}-{YY}-{SEQ:6}{CHECK}", 42, "CXB-24-0000422", "2024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := NewMRNFormat(tt.template, "cxb")
+			require.NoError(t, err)
+
+			mrn := format.Format(tt.seq, issued)
+			assert.Equal(t, tt.want, mrn)
+			assert.Equal(t, tt.wantPeriod, format.Period(issued))
+			assert.True(t, format.Matches(mrn))
+			assert.NoError(t, format.Validate(mrn))
+
+			// The seed pattern finds the sequence number again
+			m := regexp.MustCompile(format.SequencePattern(issued)).FindStringSubmatch(mrn)
+			require.Len(t, m, 2)
+			seq, err := strconv.ParseInt(m[1], 10, 64)
+			require.NoError(t, err)
+			assert.Equal(t, tt.seq, seq)
+		})
+	}
+}
+
+func TestMRNFormatValidate(t *testing.T) {
+	format, err := NewMRNFormat("{FACILITY}-{YY}-{SEQ:6}{CHECK}", "CXB")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		mrn          string
+		wantErr      bool
+		wantMistyped bool
+	}{
+		{"valid", "CXB-24-0000422", false, false},
+		{"lower case and spaces", " cxb-24-0000422 ", false, false},
+		{"mistyped digit", "CXB-24-0000432", true, true},
+		{"swapped digits", "CXB-24-0000242", true, true},
+		{"wrong shape", "CXB-2024-0000422", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := format.Validate(tt.mrn)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantMistyped, errors.Is(err, ErrInvalidMRN))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+// cardPayloadPrefix starts every card QR payload; the number is bumped if the
+// payload layout ever changes
+const cardPayloadPrefix = "ZH1"
+
+var ErrInvalidCard = errors.New("invalid patient card: the QR code was not issued by this system or has been altered")
+
+// PhotoLoader returns the photo printed on a patient's card, or nil if there is none
+type PhotoLoader func(*models.Patient) (image.Image, error)
+
+// PatientCardService issues patient ID cards carrying a signed QR code and
+// finds the patient again from a scanned code
+type PatientCardService struct {
+	patients *PatientService
+	key      []byte
+	facility string
+	photo    PhotoLoader
+}
+
+func NewPatientCardService(patients *PatientService, key []byte, facility string) *PatientCardService {
+	return &PatientCardService{patients: patients, key: key, facility: facility, photo: dataURLPhoto}
+}
+
+// SetPhotoLoader replaces how card photos are loaded
+func (s *PatientCardService) SetPhotoLoader(loader PhotoLoader) {
+	s.photo = loader
+}
+
+// PatientCard is the content of a printed patient card
+type PatientCard struct {
+	Patient  *models.Patient
+	Facility string
+	IssuedAt time.Time
+	Payload  string
+	Photo    image.Image
+}
+
+// Issue prepares a new card for a patient. Cards are not issued for merged
+// records; the surviving patient gets the card.
+func (s *PatientCardService) Issue(patientID uint) (*PatientCard, error) {
+	patient, err := s.patients.GetPatientByID(patientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MergedIntoID != nil {
+		return nil, ErrPatientMerged
+	}
+
+	card := &PatientCard{Patient: patient, Facility: s.facility, IssuedAt: time.Now()}
+	card.Payload = s.sign(patient, card.IssuedAt)
+	if s.photo != nil {
+		if card.Photo, err = s.photo(patient); err != nil {
+			// A card without a photo is still useful
+			log.Printf("patient card: failed to load the photo of patient %d: %v", patient.ID, err)
+		}
+	}
+	return card, nil
+}
+
+// LookupByQR verifies a scanned card payload and returns the patient it was
+// issued to. A card of a merged record returns the surviving patient.
+func (s *PatientCardService) LookupByQR(payload string) (*models.Patient, error) {
+	patientID, mrn, err := s.verify(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, err
+	}
+	patient, err := s.patients.GetPatientByID(patientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MRN != mrn {
+		return nil, ErrInvalidCard
+	}
+
+	resolved, err := s.patients.resolveMerged([]*models.Patient{patient})
+	if err != nil {
+		return nil, err
+	}
+	return resolved[0], nil
+}
+
+// sign builds the payload "ZH1|<patient id>|<MRN>|<issued unix time>|<signature>".
+// The signature is a truncated HMAC-SHA256 over everything before it.
+func (s *PatientCardService) sign(patient *models.Patient, issuedAt time.Time) string {
+	body := strings.Join([]string{
+		cardPayloadPrefix,
+		strconv.FormatUint(uint64(patient.ID), 10),
+		patient.MRN,
+		strconv.FormatInt(issuedAt.Unix(), 10),
+	}, "|")
+	return body + "|" + s.signature(body)
+}
+
+func (s *PatientCardService) signature(body string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// verify checks the signature and returns the patient id and MRN on the card.
+// The MRN sits between fixed fields, so it may itself contain "|".
+func (s *PatientCardService) verify(payload string) (uint, string, error) {
+	fields := strings.Split(payload, "|")
+	if len(fields) < 5 || fields[0] != cardPayloadPrefix {
+		return 0, "", ErrInvalidCard
+	}
+	last := len(fields) - 1
+	body := strings.Join(fields[:last], "|")
+	if !hmac.Equal([]byte(fields[last]), []byte(s.signature(body))) {
+		return 0, "", ErrInvalidCard
+	}
+
+	patientID, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, "", ErrInvalidCard
+	}
+	return uint(patientID), strings.Join(fields[2:last-1], "|"), nil
+}
+
+// dataURLPhoto reads a photo stored inline in PhotoURL as a data: URL
+func dataURLPhoto(patient *models.Patient) (image.Image, error) {
+	const prefix = "data:image/"
+	if !strings.HasPrefix(patient.PhotoURL, prefix) {
+		return nil, nil
+	}
+	comma := strings.Index(patient.PhotoURL, ";base64,")
+	if comma < 0 {
+		return nil, errors.New("photo data URL is not base64 encoded")
+	}
+	data, err := base64.StdEncoding.DecodeString(patient.PhotoURL[comma+len(";base64,"):])
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/qrcode"
+)
+
+// Card size (ID-1/CR80, 85.6 x 54 mm) in points, and the PNG resolution
+const (
+	cardWidth     = 242.6
+	cardHeight    = 153.0
+	cardPNGScale  = 4 // pixels per point, about 288 dpi
+	cardCharWidth = 0.62
+	cardColumn    = 88 // width of the text column between photo and QR code
+)
+
+// cardLayout is the card drawn in points from the top-left corner, shared by
+// the PDF and PNG renderers
+type cardLayout struct {
+	boxes []cardBox
+	texts []cardText
+	photo image.Image
+	frame cardBox // photo area
+	qr    *qrcode.Code
+	qrBox cardBox
+}
+
+type cardBox struct {
+	x, y, w, h float64
+	gray       float64 // 0 black, 1 white
+}
+
+type cardText struct {
+	x, y  float64 // baseline start
+	size  float64
+	bold  bool
+	white bool
+	text  string
+}
+
+func (c *PatientCard) layout() (*cardLayout, error) {
+	qr, err := qrcode.Encode([]byte(c.Payload))
+	if err != nil {
+		return nil, err
+	}
+	p := c.Patient
+	l := &cardLayout{
+		photo: c.Photo,
+		frame: cardBox{x: 8, y: 28, w: 56, h: 70, gray: 0.9},
+		qr:    qr,
+		qrBox: cardBox{x: 162, y: 32, w: 72, h: 72},
+		boxes: []cardBox{{x: 0, y: 0, w: cardWidth, h: 20, gray: 0.15}},
+	}
+	l.texts = append(l.texts, cardText{x: 8, y: 14, size: 9, bold: true, white: true, text: "PATIENT ID CARD"})
+	if c.Facility != "" {
+		l.texts = append(l.texts, cardText{x: cardWidth - 8 - textWidth(c.Facility, 8), y: 14, size: 8, white: true, text: c.Facility})
+	}
+
+	y := 36.0
+	name := wrapText(p.GetFullName(), cardColumn, 9)
+	if len(name) > 2 {
+		name = []string{name[0], truncateText(strings.Join(name[1:], " "), cardColumn, 9)}
+	}
+	for _, line := range name {
+		l.texts = append(l.texts, cardText{x: 70, y: y, size: 9, bold: true, text: line})
+		y += 11
+	}
+	// The MRN is never cut short; a long one is set smaller instead
+	mrn := "MRN " + p.MRN
+	l.texts = append(l.texts, cardText{x: 70, y: y + 2, size: min(8, cardColumn/textWidth(mrn, 1)), bold: true, text: mrn})
+	y += 11
+
+	var lines []string
+	details := []string{}
+	if p.BirthDate != nil {
+		details = append(details, "DOB "+p.BirthDate.Format("2006-01-02"))
+	}
+	if p.Gender != "" && p.Gender != "unknown" {
+		details = append(details, "Sex "+strings.ToUpper(p.Gender[:1]))
+	}
+	if len(details) > 0 {
+		lines = append(lines, strings.Join(details, "  "))
+	}
+	if label, value := cardIdentifier(p, c.IssuedAt); value != "" {
+		lines = append(lines, label+" "+value)
+	}
+	if p.CampName != "" {
+		camp := p.CampName
+		if p.BlockNumber != "" {
+			camp += ", Block " + p.BlockNumber
+		}
+		lines = append(lines, camp)
+	}
+	for _, line := range lines {
+		l.texts = append(l.texts, cardText{x: 70, y: y + 2, size: 6.5, text: truncateText(line, cardColumn, 6.5)})
+		y += 11
+	}
+
+	l.texts = append(l.texts, cardText{x: 8, y: cardHeight - 10, size: 6,
+		text: "Issued " + c.IssuedAt.Format("2006-01-02") + " - scan the QR code at check-in"})
+	return l, nil
+}
+
+// cardIdentifier returns the first current identifier other than the MRN, e.g. UNHCR or NID
+func cardIdentifier(p *models.Patient, now time.Time) (string, string) {
+	for _, id := range p.Identifiers {
+		if id.System == models.IdentifierSystemMRN || !id.IsCurrent(now) {
+			continue
+		}
+		if system := models.FindIdentifierSystem(id.System); system != nil {
+			return strings.ToUpper(system.Code), id.Value
+		}
+	}
+	return "", ""
+}
+
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * cardCharWidth
+}
+
+// wrapText breaks s into lines of at most width points
+func wrapText(s string, width, size float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		if line != "" && textWidth(line+" "+word, size) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, truncateText(line, width, size))
+	}
+	return lines
+}
+
+func truncateText(s string, width, size float64) string {
+	runes := []rune(s)
+	limit := int(width / (size * cardCharWidth))
+	if len(runes) > limit && limit > 3 {
+		return string(runes[:limit-3]) + "..."
+	}
+	return s
+}
+
+// photoBox fits the photo inside the frame, keeping its aspect ratio
+func (l *cardLayout) photoBox() cardBox {
+	box := l.frame
+	bounds := l.photo.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return box
+	}
+	aspect := float64(bounds.Dx()) / float64(bounds.Dy())
+	if aspect > box.w/box.h {
+		h := box.w / aspect
+		box.y += (box.h - h) / 2
+		box.h = h
+	} else {
+		w := box.h * aspect
+		box.x += (box.w - w) / 2
+		box.w = w
+	}
+	return box
+}
+
+// PDF renders the card as a single page PDF using the standard Helvetica fonts
+func (c *PatientCard) PDF() ([]byte, error) {
+	l, err := c.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	rect := func(b cardBox) {
+		fmt.Fprintf(&content, "%.3f g %.2f %.2f %.2f %.2f re f\n", b.gray, b.x, cardHeight-b.y-b.h, b.w, b.h)
+	}
+	for _, b := range l.boxes {
+		rect(b)
+	}
+	if l.photo != nil {
+		b := l.photoBox()
+		fmt.Fprintf(&content, "q %.2f 0 0 %.2f %.2f %.2f cm /Photo Do Q\n", b.w, b.h, b.x, cardHeight-b.y-b.h)
+	} else {
+		rect(l.frame)
+		l.texts = append(l.texts, cardText{x: l.frame.x + 12, y: l.frame.y + l.frame.h/2 + 2, size: 6, text: "NO PHOTO"})
+	}
+	module := l.qrBox.w / float64(l.qr.Size)
+	content.WriteString("0 g\n")
+	for y := 0; y < l.qr.Size; y++ {
+		for x := 0; x < l.qr.Size; x++ {
+			if l.qr.Black(x, y) {
+				fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n", l.qrBox.x+float64(x)*module,
+					cardHeight-l.qrBox.y-float64(y+1)*module, module, module)
+			}
+		}
+	}
+	content.WriteString("f\n")
+	for _, t := range l.texts {
+		font, gray := "F1", 0.0
+		if t.bold {
+			font = "F2"
+		}
+		if t.white {
+			gray = 1
+		}
+		fmt.Fprintf(&content, "BT %.1f g /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", gray, font, t.size, t.x, cardHeight-t.y, pdfString(t.text))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.1f %.1f] /Contents 4 0 R "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> /XObject << %s>> >> >>", cardWidth, cardHeight, photoResource(l.photo)),
+		pdfStream(fmt.Sprintf("<< /Length %d >>", content.Len()), content.Bytes()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	if l.photo != nil {
+		pixels, width, height := rgbPixels(l.photo, 240)
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(pixels)
+		zw.Close()
+		objects = append(objects, pdfStream(fmt.Sprintf(
+			"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			width, height, compressed.Len()), compressed.Bytes()))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes(), nil
+}
+
+func photoResource(photo image.Image) string {
+	if photo == nil {
+		return ""
+	}
+	return "/Photo 7 0 R "
+}
+
+func pdfStream(dict string, data []byte) string {
+	return dict + "\nstream\n" + string(data) + "\nendstream"
+}
+
+// pdfString escapes text for a PDF string literal; characters outside Latin-1
+// cannot be shown by the standard fonts and become "?"
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xFF || (r >= 0x7F && r < 0xA0):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// rgbPixels returns the image as 8-bit RGB, scaled down so neither side
+// exceeds maxSide pixels
+func rgbPixels(img image.Image, maxSide int) ([]byte, int, int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > maxSide {
+		width = width * maxSide / longest
+		height = height * maxSide / longest
+	}
+	width, height = max(width, 1), max(height, 1)
+	pixels := make([]byte, 0, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height).RGBA()
+			pixels = append(pixels, byte(r>>8), byte(g>>8), byte(b>>8))
+		}
+	}
+	return pixels, width, height
+}
+
+// PNG renders the card as an image for label printers and screens. Text uses
+// a built-in 5x7 bitmap font, so it is shown in capitals.
+func (c *PatientCard) PNG() ([]byte, error) {
+	l, err := c.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	px := func(v float64) int { return int(v*cardPNGScale + 0.5) }
+	img := image.NewRGBA(image.Rect(0, 0, px(cardWidth), px(cardHeight)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	fill := func(b cardBox) {
+		shade := uint8(b.gray * 255)
+		draw.Draw(img, image.Rect(px(b.x), px(b.y), px(b.x+b.w), px(b.y+b.h)),
+			image.NewUniform(color.Gray{Y: shade}), image.Point{}, draw.Src)
+	}
+	for _, b := range l.boxes {
+		fill(b)
+	}
+
+	if l.photo != nil {
+		b := l.photoBox()
+		frame := image.Rect(px(b.x), px(b.y), px(b.x+b.w), px(b.y+b.h))
+		src := l.photo.Bounds()
+		for y := frame.Min.Y; y < frame.Max.Y; y++ {
+			for x := frame.Min.X; x < frame.Max.X; x++ {
+				img.Set(x, y, l.photo.At(src.Min.X+(x-frame.Min.X)*src.Dx()/frame.Dx(), src.Min.Y+(y-frame.Min.Y)*src.Dy()/frame.Dy()))
+			}
+		}
+	} else {
+		fill(l.frame)
+		l.texts = append(l.texts, cardText{x: l.frame.x + 12, y: l.frame.y + l.frame.h/2 + 2, size: 6, text: "NO PHOTO"})
+	}
+
+	// Whole pixels per module keep the code sharp
+	module := px(l.qrBox.w) / l.qr.Size
+	for y := 0; y < l.qr.Size; y++ {
+		for x := 0; x < l.qr.Size; x++ {
+			if l.qr.Black(x, y) {
+				x0, y0 := px(l.qrBox.x)+x*module, px(l.qrBox.y)+y*module
+				draw.Draw(img, image.Rect(x0, y0, x0+module, y0+module), image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	for _, t := range l.texts {
+		ink := color.Color(color.Black)
+		if t.white {
+			ink = color.White
+		}
+		// A glyph is 7 dots tall and spans the cap height, about 0.72 em; it
+		// advances by the width the layout measured with
+		dot := max(1, int(t.size*0.72/7*cardPNGScale+0.5))
+		advance := t.size * cardCharWidth * cardPNGScale
+		top := px(t.y) - 7*dot
+		for i, r := range []rune(strings.ToUpper(t.text)) {
+			x := px(t.x) + int(float64(i)*advance)
+			rows, ok := glyphs[r]
+			if !ok {
+				rows = glyphs['?']
+			}
+			for row, bits := range rows {
+				for col := 0; col < 5; col++ {
+					if bits&(0x10>>uint(col)) == 0 {
+						continue
+					}
+					x0, y0 := x+col*dot, top+row*dot
+					rect := image.Rect(x0, y0, x0+dot, y0+dot)
+					if t.bold {
+						rect.Max.X += dot / 2
+					}
+					draw.Draw(img, rect, image.NewUniform(ink), image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// glyphs is a 5x7 bitmap font; each row's five low bits are the dots, left to right
+var glyphs = map[rune][7]byte{
+	' ':  {},
+	'A':  {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C':  {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D':  {0b11110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b11110},
+	'E':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G':  {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H':  {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I':  {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J':  {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K':  {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L':  {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M':  {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N':  {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S':  {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T':  {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W':  {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X':  {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y':  {0b10001, 0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100},
+	'Z':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0':  {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1':  {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3':  {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4':  {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5':  {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6':  {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8':  {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9':  {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	'-':  {0, 0, 0, 0b11111, 0, 0, 0},
+	'/':  {0, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0},
+	'.':  {0, 0, 0, 0, 0, 0b01100, 0b01100},
+	':':  {0, 0b01100, 0b01100, 0, 0b01100, 0b01100, 0},
+	',':  {0, 0, 0, 0, 0b01100, 0b00100, 0b01000},
+	'\'': {0b01100, 0b00100, 0b01000, 0, 0, 0, 0},
+	'(':  {0b00010, 0b00100, 0b01000, 0b01000, 0b01000, 0b00100, 0b00010},
+	')':  {0b01000, 0b00100, 0b00010, 0b00010, 0b00010, 0b00100, 0b01000},
+	'#':  {0b01010, 0b01010, 0b11111, 0b01010, 0b11111, 0b01010, 0b01010},
+	'+':  {0, 0b00100, 0b00100, 0b11111, 0b00100, 0b00100, 0},
+	'&':  {0b01100, 0b10010, 0b10100, 0b01000, 0b10101, 0b10010, 0b01101},
+	'_':  {0, 0, 0, 0, 0, 0, 0b11111},
+	'?':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0, 0b00100},
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+// Score thresholds for reporting a candidate as a duplicate
+const (
+	probableDuplicateScore = 0.85
+	possibleDuplicateScore = 0.70
+
+	// matchCandidateLimit caps how many records sharing a name key, identifier
+	// or phone are scored for one registration
+	matchCandidateLimit = 200
+)
+
+// Weights of the compared fields. A field missing on either record is left out
+// of the score rather than counting against the match.
+const (
+	nameWeight       = 0.35
+	identifierWeight = 0.25
+	birthDateWeight  = 0.15
+	phoneWeight      = 0.10
+	locationWeight   = 0.10
+	genderWeight     = 0.05
+)
+
+// PatientMatch is an existing patient that may be the same person as the one being registered
+type PatientMatch struct {
+	Patient *models.Patient `json:"patient"`
+	Score   float64         `json:"score"`
+	Level   string          `json:"level"`
+	Reasons []string        `json:"reasons"`
+}
+
+// FindDuplicates scores the existing records that could belong to the same
+// person and returns those above the possible-duplicate threshold, best first
+func (s *PatientService) FindDuplicates(patient *models.Patient) ([]*PatientMatch, error) {
+	candidates, err := s.repo.FindMatchCandidates(patient, matchCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*PatientMatch
+	for _, candidate := range candidates {
+		score, reasons := ScorePatientMatch(patient, candidate)
+		if score < possibleDuplicateScore {
+			continue
+		}
+		level := models.DuplicateLevelPossible
+		if score >= probableDuplicateScore {
+			level = models.DuplicateLevelProbable
+		}
+		matches = append(matches, &PatientMatch{Patient: candidate, Score: score, Level: level, Reasons: reasons})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// ScorePatientMatch returns how likely two records are the same person (0 to 1)
+// and which fields agreed
+func ScorePatientMatch(a, b *models.Patient) (float64, []string) {
+	var total, weights float64
+	var reasons []string
+	add := func(weight, score float64, reason string) {
+		total += weight * score
+		weights += weight
+		if score >= 0.8 && reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if score, ok := nameSimilarity(a, b); ok {
+		add(nameWeight, score, "name")
+	}
+
+	if score, ok := identifierSimilarity(a, b); ok {
+		add(identifierWeight, score, "identifier")
+		// The same UNHCR/NID number is close to conclusive on its own
+		if score == 1 {
+			total += identifierWeight
+			weights += identifierWeight
+		}
+	}
+
+	if a.BirthDate != nil && b.BirthDate != nil {
+		add(birthDateWeight, birthDateSimilarity(*a.BirthDate, *b.BirthDate), "birth date")
+	}
+
+	phonesA := phoneSet(a)
+	phonesB := phoneSet(b)
+	if len(phonesA) > 0 && len(phonesB) > 0 {
+		score := 0.0
+		for phone := range phonesA {
+			if phonesB[phone] {
+				score = 1
+			}
+		}
+		add(phoneWeight, score, "phone")
+	}
+
+	if a.CampName != "" && b.CampName != "" {
+		score := 0.0
+		if strings.EqualFold(strings.TrimSpace(a.CampName), strings.TrimSpace(b.CampName)) {
+			score = 0.6
+			if a.BlockNumber != "" && strings.EqualFold(strings.TrimSpace(a.BlockNumber), strings.TrimSpace(b.BlockNumber)) {
+				score = 1
+			}
+		}
+		add(locationWeight, score, "camp/block")
+	}
+
+	if known(a.Gender) && known(b.Gender) {
+		score := 0.0
+		if strings.EqualFold(a.Gender, b.Gender) {
+			score = 1
+		}
+		add(genderWeight, score, "")
+	}
+
+	if weights == 0 {
+		return 0, nil
+	}
+	// A match on very little evidence (e.g. the name alone) is capped below
+	// the probable threshold
+	score := total / weights
+	if weights < nameWeight+birthDateWeight && score > possibleDuplicateScore {
+		score = possibleDuplicateScore
+	}
+	return math.Round(score*1000) / 1000, reasons
+}
+
+func known(gender string) bool {
+	return gender != "" && gender != "unknown"
+}
+
+// nameSimilarity compares the name parts regardless of order. Each part of the
+// shorter name is paired with its best match in the other name; parts with the
+// same phonetic key count as near equal.
+func nameSimilarity(a, b *models.Patient) (float64, bool) {
+	partsA := nameParts(a)
+	partsB := nameParts(b)
+	if len(partsA) == 0 || len(partsB) == 0 {
+		return 0, false
+	}
+	if len(partsA) > len(partsB) {
+		partsA, partsB = partsB, partsA
+	}
+
+	var sum float64
+	for _, partA := range partsA {
+		best := 0.0
+		keyA := models.NameTokenKeys(partA)
+		for _, partB := range partsB {
+			score := jaroWinkler(partA, partB)
+			if keyB := models.NameTokenKeys(partB); len(keyA) == 1 && len(keyB) == 1 && keyA[0] == keyB[0] {
+				score = math.Max(score, 0.95)
+			}
+			best = math.Max(best, score)
+		}
+		// Different names can still share most letters (Abdul/Abdur is close,
+		// Karim/Rahman is not), so weak similarities count as a mismatch
+		if best < 0.85 {
+			best = 0
+		}
+		sum += best
+	}
+	score := sum / float64(len(partsA))
+
+	// Missing name parts (a family name on only one record) lower the score slightly
+	score -= 0.05 * float64(len(partsB)-len(partsA))
+	return math.Max(score, 0), true
+}
+
+// nameParts returns the normalized name parts without honorifics
+func nameParts(p *models.Patient) []string {
+	var parts []string
+	for _, part := range strings.Fields(models.NormalizeName(p.GivenName + " " + p.MiddleName + " " + p.FamilyName)) {
+		if len(models.NameTokenKeys(part)) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// identifierSimilarity compares the identifiers of the systems both records
+// have, other than the MRN. A single typo (one substitution, insertion,
+// deletion or swap) still scores highly.
+func identifierSimilarity(a, b *models.Patient) (float64, bool) {
+	compared := false
+	best := 0.0
+	for _, idA := range a.Identifiers {
+		if idA.System == models.IdentifierSystemMRN {
+			continue
+		}
+		for _, idB := range b.Identifiers {
+			if idB.System != idA.System {
+				continue
+			}
+			x := normalizeIdentifier(idA.Value)
+			y := normalizeIdentifier(idB.Value)
+			if x == "" || y == "" {
+				continue
+			}
+			compared = true
+			switch {
+			case x == y:
+				return 1, true
+			case withinOneEdit(x, y):
+				best = math.Max(best, 0.8)
+			}
+		}
+	}
+	return best, compared
+}
+
+func normalizeIdentifier(id string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(id) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// withinOneEdit reports whether x and y differ by at most one edit or one adjacent swap
+func withinOneEdit(x, y string) bool {
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	switch len(y) - len(x) {
+	case 0:
+		var diffs []int
+		for i := 0; i < len(x); i++ {
+			if x[i] != y[i] {
+				diffs = append(diffs, i)
+			}
+		}
+		if len(diffs) <= 1 {
+			return true
+		}
+		return len(diffs) == 2 && diffs[1] == diffs[0]+1 &&
+			x[diffs[0]] == y[diffs[1]] && x[diffs[1]] == y[diffs[0]]
+	case 1:
+		i := 0
+		for i < len(x) && x[i] == y[i] {
+			i++
+		}
+		return x[i:] == y[i+1:]
+	}
+	return false
+}
+
+// birthDateSimilarity allows for the estimated birth dates common among
+// refugees: the same year scores well, a year or two apart still counts a little
+func birthDateSimilarity(a, b time.Time) float64 {
+	days := math.Abs(a.Sub(b).Hours() / 24)
+	switch {
+	case days < 1:
+		return 1
+	case days <= 31:
+		return 0.8
+	case a.Year() == b.Year():
+		return 0.7
+	case days <= 2*366:
+		return 0.4
+	}
+	return 0
+}
+
+func phoneSet(p *models.Patient) map[string]bool {
+	phones := map[string]bool{}
+	for _, phone := range []string{p.Phone, p.Phone2} {
+		if digits := repository.PhoneDigits(phone); digits != "" {
+			phones[digits] = true
+		}
+	}
+	return phones
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings (0 to 1)
+func jaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := int(math.Max(float64(len(ra)), float64(len(rb))))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo := int(math.Max(0, float64(i-window)))
+		hi := int(math.Min(float64(len(rb)-1), float64(i+window)))
+		for j := lo; j <= hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScorePatientMatch(t *testing.T) {
+	born := time.Date(1990, 3, 15, 0, 0, 0, 0, time.UTC)
+	otherYear := time.Date(1975, 8, 1, 0, 0, 0, 0, time.UTC)
+	unhcr := func(value string) []models.PatientIdentifier {
+		return []models.PatientIdentifier{models.NewPatientIdentifier(models.IdentifierSystemUNHCR, value)}
+	}
+	registered := &models.Patient{
+		GivenName: "Mohammad Rahman", FamilyName: "Hossain", BirthDate: &born, Gender: "male",
+		Phone: "+8801712345678", CampName: "Camp 4", BlockNumber: "B-12",
+	}
+
+	tests := []struct {
+		name      string
+		candidate *models.Patient
+		level     string
+		reasons   []string
+	}{
+		{"romanized spelling at another desk", &models.Patient{
+			GivenName: "Md. Rahaman", FamilyName: "Hussain", BirthDate: &born, Gender: "male",
+			Phone: "01712345678", CampName: "camp 4", BlockNumber: "b-12",
+		}, models.DuplicateLevelProbable, []string{"name", "birth date", "phone", "camp/block"}},
+		{"bangla script", &models.Patient{
+			GivenName: "রহমান", FamilyName: "হোসেন", BirthDate: &born, Gender: "male",
+		}, models.DuplicateLevelProbable, []string{"name", "birth date"}},
+		{"name only", &models.Patient{GivenName: "Rahman", FamilyName: "Hossain"}, models.DuplicateLevelPossible, []string{"name"}},
+		{"different person in the same block", &models.Patient{
+			GivenName: "Karim", FamilyName: "Uddin", BirthDate: &otherYear, Gender: "male", CampName: "Camp 4", BlockNumber: "B-12",
+		}, "", []string{"camp/block"}},
+		{"nothing to compare", &models.Patient{}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, reasons := ScorePatientMatch(registered, tt.candidate)
+			switch tt.level {
+			case models.DuplicateLevelProbable:
+				assert.GreaterOrEqual(t, score, probableDuplicateScore)
+			case models.DuplicateLevelPossible:
+				assert.GreaterOrEqual(t, score, possibleDuplicateScore)
+				assert.Less(t, score, probableDuplicateScore)
+			default:
+				assert.Less(t, score, possibleDuplicateScore)
+			}
+			assert.Equal(t, tt.reasons, reasons)
+		})
+	}
+
+	// The same UNHCR number outweighs a differently spelled name; a typo in it still counts
+	a := &models.Patient{GivenName: "Nur Begum", Identifiers: unhcr("AB1-234567"), BirthDate: &born}
+	score, reasons := ScorePatientMatch(a, &models.Patient{GivenName: "Noor", Identifiers: unhcr("ab1234567"), BirthDate: &born})
+	assert.GreaterOrEqual(t, score, probableDuplicateScore)
+	assert.Contains(t, reasons, "identifier")
+	typo, _ := ScorePatientMatch(a, &models.Patient{GivenName: "Noor", Identifiers: unhcr("AB1-234576"), BirthDate: &born})
+	assert.Less(t, typo, score)
+	assert.GreaterOrEqual(t, typo, possibleDuplicateScore)
+
+	// The score does not depend on which record is registered first
+	b := &models.Patient{GivenName: "Rahman", FamilyName: "Hossain", BirthDate: &otherYear, Gender: "female"}
+	forward, _ := ScorePatientMatch(registered, b)
+	backward, _ := ScorePatientMatch(b, registered)
+	assert.Equal(t, forward, backward)
+}
+
+func TestWithinOneEdit(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want bool
+	}{
+		{"123456", "123456", true},
+		{"123456", "123457", true},
+		{"123456", "12356", true},
+		{"123456", "1234567", true},
+		{"123456", "124356", true},
+		{"123456", "654321", false},
+		{"123456", "123465X", false},
+		{"123456", "12345678", false},
+		{"", "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.x+"/"+tt.y, func(t *testing.T) {
+			assert.Equal(t, tt.want, withinOneEdit(tt.x, tt.y))
+			assert.Equal(t, tt.want, withinOneEdit(tt.y, tt.x))
+		})
+	}
+}
+
+func TestBirthDateSimilarity(t *testing.T) {
+	born := time.Date(1990, 6, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		other time.Time
+		want  float64
+	}{
+		{"same day", born, 1},
+		{"within a month", born.AddDate(0, 0, 20), 0.8},
+		{"same year", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), 0.7},
+		{"estimated a year off", born.AddDate(1, 0, 0), 0.4},
+		{"years apart", born.AddDate(5, 0, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, birthDateSimilarity(born, tt.other))
+		})
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	assert.Equal(t, 1.0, jaroWinkler("rahman", "rahman"))
+	assert.Equal(t, 0.0, jaroWinkler("", "rahman"))
+	assert.Equal(t, 0.0, jaroWinkler("abc", "xyz"))
+	assert.InDelta(t, 0.961, jaroWinkler("martha", "marhta"), 0.001)
+	assert.InDelta(t, 0.813, jaroWinkler("dixon", "dicksonx"), 0.001)
+	assert.Greater(t, jaroWinkler("abdul", "abdur"), jaroWinkler("karim", "rahman"))
+}
+
+// TestCreatePatientQueuesDuplicates checks a likely duplicate is returned,
+// queued for review and can be dismissed once
+func TestCreatePatientQueuesDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestPatientService(t, db)
+	ctx := context.Background()
+	born := time.Date(1990, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	first, matches, err := s.CreatePatient(ctx, &models.Patient{
+		GivenName: "Mohammad Rahman", FamilyName: "Hossain", BirthDate: &born, Gender: "male", Phone: "+8801712345678",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	second, matches, err := s.CreatePatient(ctx, &models.Patient{
+		GivenName: "Md. Rahaman", FamilyName: "Hussain", BirthDate: &born, Gender: "male", Phone: "01712345678",
+	})
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, first.ID, matches[0].Patient.ID)
+	assert.Equal(t, models.DuplicateLevelProbable, matches[0].Level)
+
+	queued, total, err := s.ListDuplicates(models.DuplicateStatusOpen, 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	assert.Equal(t, second.ID, queued[0].PatientID)
+	assert.Equal(t, first.ID, queued[0].CandidateID)
+
+	dismissed, err := s.DismissDuplicate(ctx, queued[0].ID, 1, "twins")
+	require.NoError(t, err)
+	assert.Equal(t, models.DuplicateStatusDismissed, dismissed.Status)
+	_, err = s.DismissDuplicate(ctx, queued[0].ID, 1, "twins")
+	assert.ErrorIs(t, err, ErrDuplicateReviewed)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+)
+
+var (
+	ErrMergeSelf      = errors.New("a patient cannot be merged into itself")
+	ErrPatientMerged  = errors.New("patient has already been merged into another record")
+	ErrMergeUndone    = errors.New("merge has already been undone")
+	ErrSurvivorMerged = errors.New("the surviving patient has since been merged into another record; undo that merge first")
+)
+
+// MergePatients merges the duplicate record into the survivor. All clinical,
+// billing and portal records move to the survivor; the duplicate stays as an
+// inactive record whose MRN resolves to the survivor.
+func (s *PatientService) MergePatients(ctx context.Context, survivorID, duplicateID uint, reason string, mergedBy uint) (*models.PatientMerge, error) {
+	if survivorID == duplicateID {
+		return nil, ErrMergeSelf
+	}
+
+	survivor, err := s.repo.FindByID(survivorID)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := s.repo.FindByID(duplicateID)
+	if err != nil {
+		return nil, err
+	}
+	if survivor.MergedIntoID != nil || duplicate.MergedIntoID != nil {
+		return nil, ErrPatientMerged
+	}
+
+	merge := &models.PatientMerge{
+		SurvivorID: survivor.ID,
+		MergedID:   duplicate.ID,
+		MergedMRN:  duplicate.MRN,
+		Reason:     reason,
+		MergedBy:   mergedBy,
+	}
+	if err := s.mergesRepo.Merge(ctx, merge); err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// UnmergePatients reverses a merge: the rows that were moved go back to the
+// duplicate record and it becomes active again
+func (s *PatientService) UnmergePatients(ctx context.Context, mergeID, unmergedBy uint, reason string) (*models.PatientMerge, error) {
+	merge, err := s.mergesRepo.FindByID(mergeID)
+	if err != nil {
+		return nil, err
+	}
+	if !merge.IsActive() {
+		return nil, ErrMergeUndone
+	}
+
+	survivor, err := s.repo.FindByID(merge.SurvivorID)
+	if err != nil {
+		return nil, err
+	}
+	if survivor.MergedIntoID != nil {
+		return nil, ErrSurvivorMerged
+	}
+
+	if err := s.mergesRepo.Unmerge(ctx, merge, unmergedBy, reason); err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+func (s *PatientService) GetMerge(id uint) (*models.PatientMerge, error) {
+	return s.mergesRepo.FindByID(id)
+}
+
+// ListMerges returns the merges a patient took part in as survivor or duplicate
+func (s *PatientService) ListMerges(patientID uint) ([]*models.PatientMerge, error) {
+	return s.mergesRepo.ListByPatient(patientID)
+}
+
+// GetPatientByMRN finds a patient by MRN; a merged record's MRN resolves to the survivor
+func (s *PatientService) GetPatientByMRN(mrn string) (*models.Patient, error) {
+	if err := s.ValidateMRN(mrn); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByMRN(mrn)
+}
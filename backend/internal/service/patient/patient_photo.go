@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/storage"
+)
+
+// Upload limits; the pixel limit guards against images that are small files
+// but decode to huge bitmaps
+const (
+	MaxPhotoBytes  = 10 << 20
+	maxPhotoPixels = 40_000_000
+)
+
+var (
+	ErrUnsupportedPhoto = errors.New("photo must be a JPEG or PNG image")
+	ErrPhotoTooLarge    = fmt.Errorf("photo must be at most %d MB and %d megapixels", MaxPhotoBytes>>20, maxPhotoPixels/1_000_000)
+	ErrUnknownPhotoSize = errors.New("unknown photo size; use original, medium or small")
+)
+
+// PatientPhotoService stores patient photos with their thumbnails in object storage
+type PatientPhotoService struct {
+	repo     *repository.PatientPhotoRepository
+	patients *PatientService
+	store    storage.Store
+}
+
+func NewPatientPhotoService(repo *repository.PatientPhotoRepository, patients *PatientService, store storage.Store) *PatientPhotoService {
+	return &PatientPhotoService{repo: repo, patients: patients, store: store}
+}
+
+// Upload replaces the patient's photo. The image is turned upright and
+// re-encoded, which drops EXIF and other metadata (GPS position, camera
+// serial numbers), and the PhotoVariants thumbnails are generated.
+func (s *PatientPhotoService) Upload(ctx context.Context, patientID uint, data []byte, uploadedBy uint) (*models.PatientPhoto, error) {
+	patient, err := s.patients.GetPatientByID(patientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MergedIntoID != nil {
+		return nil, ErrPatientMerged
+	}
+	if len(data) > MaxPhotoBytes {
+		return nil, ErrPhotoTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedPhoto
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedPhoto
+	}
+	if config.Width*config.Height > maxPhotoPixels {
+		return nil, ErrPhotoTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedPhoto
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	var original bytes.Buffer
+	if contentType == "image/png" {
+		err = png.Encode(&original, img)
+	} else {
+		err = jpeg.Encode(&original, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 12)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(original.Bytes())
+	photo := &models.PatientPhoto{
+		PatientID:   patientID,
+		StorageKey:  fmt.Sprintf("patients/%d/photos/%s", patientID, hex.EncodeToString(token)),
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        int64(original.Len()),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedBy:  uploadedBy,
+	}
+
+	stored := []string{photo.Key("original")}
+	if err := s.store.Put(stored[0], original.Bytes(), contentType); err != nil {
+		return nil, err
+	}
+	for variant, size := range models.PhotoVariants {
+		var thumb bytes.Buffer
+		if err := jpeg.Encode(&thumb, fitWithin(img, size), &jpeg.Options{Quality: 85}); err != nil {
+			s.discard(stored)
+			return nil, err
+		}
+		key := photo.Key(variant)
+		if err := s.store.Put(key, thumb.Bytes(), "image/jpeg"); err != nil {
+			s.discard(stored)
+			return nil, err
+		}
+		stored = append(stored, key)
+	}
+
+	if _, err := s.repo.Create(ctx, photo, models.PatientPhotoURL(patientID)); err != nil {
+		s.discard(stored)
+		return nil, err
+	}
+	return photo, nil
+}
+
+// discard removes the files of an upload that could not be completed
+func (s *PatientPhotoService) discard(keys []string) {
+	for _, key := range keys {
+		if err := s.store.Delete(key); err != nil {
+			log.Printf("patient photo: failed to remove %s: %v", key, err)
+		}
+	}
+}
+
+// GetPhoto returns the current photo's record
+func (s *PatientPhotoService) GetPhoto(patientID uint) (*models.PatientPhoto, error) {
+	return s.repo.FindCurrent(patientID)
+}
+
+// Open returns the image of the patient's current photo in the given size:
+// original or a PhotoVariants name
+func (s *PatientPhotoService) Open(patientID uint, size string) ([]byte, string, error) {
+	if _, ok := models.PhotoVariants[size]; !ok && size != "original" {
+		return nil, "", ErrUnknownPhotoSize
+	}
+	photo, err := s.repo.FindCurrent(patientID)
+	if err != nil {
+		return nil, "", err
+	}
+	data, contentType, err := s.store.Get(photo.Key(size))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", repository.ErrNotFound
+	}
+	return data, contentType, err
+}
+
+// DeletePhoto removes the patient's current photo. The files are kept with the
+// retired record.
+func (s *PatientPhotoService) DeletePhoto(ctx context.Context, patientID uint) error {
+	return s.repo.Delete(ctx, patientID)
+}
+
+// CardPhoto loads the photo printed on patient cards. Patients without an
+// uploaded photo fall back to an inline data: URL photo.
+func (s *PatientPhotoService) CardPhoto(patient *models.Patient) (image.Image, error) {
+	data, _, err := s.Open(patient.ID, "medium")
+	if errors.Is(err, repository.ErrNotFound) {
+		return dataURLPhoto(patient)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
@@ -1,44 +1,118 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
 	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
 )
 
+var (
+	ErrDuplicateReviewed       = errors.New("duplicate has already been reviewed")
+	ErrUnknownIdentifierSystem = errors.New("unknown identifier system")
+)
+
 type PatientService struct {
-	repo *repository.PatientRepository
+	repo           *repository.PatientRepository
+	duplicatesRepo *repository.PatientDuplicateRepository
+	mergesRepo     *repository.PatientMergeRepository
+	mrnFormat      *MRNFormat
 }
 
-func NewPatientService(repo *repository.PatientRepository) *PatientService {
-	return &PatientService{repo: repo}
+func NewPatientService(
+	repo *repository.PatientRepository,
+	duplicatesRepo *repository.PatientDuplicateRepository,
+	mergesRepo *repository.PatientMergeRepository,
+	mrnFormat *MRNFormat,
+) *PatientService {
+	return &PatientService{repo: repo, duplicatesRepo: duplicatesRepo, mergesRepo: mergesRepo, mrnFormat: mrnFormat}
 }
 
-func (s *PatientService) CreatePatient(patient *models.Patient) (*models.Patient, error) {
+// CreatePatient registers a patient and returns the existing records that are
+// likely the same person. Registration is not blocked; the matches are queued
+// for review and returned so the registration desk can be warned.
+func (s *PatientService) CreatePatient(ctx context.Context, patient *models.Patient) (*models.Patient, []*PatientMatch, error) {
+	patient.SyncIdentifiers()
+	matches, err := s.FindDuplicates(patient)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Generate MRN if not provided
 	if patient.MRN == "" {
 		mrn, err := s.generateMRN()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		patient.MRN = mrn
 	}
 
-	return s.repo.Create(patient)
+	created, err := s.repo.Create(ctx, patient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	duplicates := make([]*models.PatientDuplicate, 0, len(matches))
+	for _, match := range matches {
+		duplicates = append(duplicates, &models.PatientDuplicate{
+			PatientID:   created.ID,
+			CandidateID: match.Patient.ID,
+			Score:       match.Score,
+			Level:       match.Level,
+			Reasons:     strings.Join(match.Reasons, ", "),
+			Status:      models.DuplicateStatusOpen,
+		})
+	}
+	if err := s.duplicatesRepo.CreateAll(ctx, duplicates); err != nil {
+		// The patient is registered; a missing queue entry must not fail the request
+		log.Printf("patient: failed to queue %d possible duplicates of patient %d: %v", len(duplicates), created.ID, err)
+	}
+
+	return created, matches, nil
+}
+
+// ListDuplicates returns the duplicate review queue
+func (s *PatientService) ListDuplicates(status string, page, limit int) ([]*models.PatientDuplicate, int64, error) {
+	offset := (page - 1) * limit
+	return s.duplicatesRepo.List(status, offset, limit)
+}
+
+func (s *PatientService) GetDuplicate(id uint) (*models.PatientDuplicate, error) {
+	return s.duplicatesRepo.FindByID(id)
+}
+
+// DismissDuplicate records that a queued pair are different people
+func (s *PatientService) DismissDuplicate(ctx context.Context, id, reviewerID uint, reason string) (*models.PatientDuplicate, error) {
+	duplicate, err := s.duplicatesRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if duplicate.Status != models.DuplicateStatusOpen {
+		return nil, ErrDuplicateReviewed
+	}
+
+	now := time.Now()
+	duplicate.Status = models.DuplicateStatusDismissed
+	duplicate.ReviewedBy = &reviewerID
+	duplicate.ReviewedAt = &now
+	duplicate.ReviewNote = reason
+	return s.duplicatesRepo.Update(ctx, duplicate)
 }
 
 func (s *PatientService) GetPatientByID(id uint) (*models.Patient, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *PatientService) UpdatePatient(patient *models.Patient) (*models.Patient, error) {
-	return s.repo.Update(patient)
+func (s *PatientService) UpdatePatient(ctx context.Context, patient *models.Patient) (*models.Patient, error) {
+	return s.repo.Update(ctx, patient)
 }
 
-func (s *PatientService) DeletePatient(id uint) error {
-	return s.repo.Delete(id)
+func (s *PatientService) DeletePatient(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
 }
 
 func (s *PatientService) ListPatients(page, limit int, nationality, search string) ([]*models.Patient, int64, error) {
@@ -46,8 +120,59 @@ func (s *PatientService) ListPatients(page, limit int, nationality, search strin
 	return s.repo.List(offset, limit, nationality, search)
 }
 
+// SearchPatients searches patients. A query shaped like an MRN with a wrong
+// check digit is rejected with ErrInvalidMRN. A match on a merged record (e.g.
+// its old MRN) is replaced by the patient it was merged into.
 func (s *PatientService) SearchPatients(query string) ([]*models.Patient, error) {
-	return s.repo.Search(query)
+	if err := s.ValidateMRN(query); err != nil {
+		return nil, err
+	}
+
+	matches, err := s.repo.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveMerged(matches)
+}
+
+// FindByIdentifier finds the patients holding an identifier. system is a
+// registered system code or URI, an external system URI, or empty to search
+// every system. Merged records are replaced by the patient they were merged into.
+func (s *PatientService) FindByIdentifier(system, value string) ([]*models.Patient, error) {
+	values := models.IdentifierLookupValues(value)
+	if system != "" {
+		registered := models.FindIdentifierSystem(system)
+		if registered == nil && !strings.Contains(system, ":") {
+			return nil, ErrUnknownIdentifierSystem
+		}
+		if registered != nil {
+			system = registered.System
+		}
+		values = []string{registered.Normalize(value)}
+	}
+
+	matches, err := s.repo.FindByIdentifier(system, values)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveMerged(matches)
+}
+
+// resolveMerged replaces merged records by their survivor, without repeats
+func (s *PatientService) resolveMerged(matches []*models.Patient) ([]*models.Patient, error) {
+	patients := make([]*models.Patient, 0, len(matches))
+	seen := map[uint]bool{}
+	for _, match := range matches {
+		patient, err := s.repo.ResolveMerged(match)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[patient.ID] {
+			seen[patient.ID] = true
+			patients = append(patients, patient)
+		}
+	}
+	return patients, nil
 }
 
 func (s *PatientService) GetPatientHistory(id uint) (map[string]interface{}, error) {
@@ -67,22 +192,21 @@ func (s *PatientService) GetPatientHistory(id uint) (map[string]interface{}, err
 	return history, nil
 }
 
-// generateMRN generates a unique Medical Record Number
+// generateMRN allocates the next MRN from the facility's counter
 func (s *PatientService) generateMRN() (string, error) {
-	// Get the last patient to determine the next MRN
-	lastPatient, err := s.repo.GetLastPatient()
-	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+	now := time.Now()
+	seq, err := s.repo.NextMRNSequence(s.mrnFormat.Facility(), s.mrnFormat.Period(now), s.mrnFormat.SequencePattern(now))
+	if err != nil {
 		return "", err
 	}
+	return s.mrnFormat.Format(seq, now), nil
+}
 
-	var nextNumber int
-	if lastPatient != nil && lastPatient.MRN != "" {
-		// Extract number from MRN (assuming format: MRN-XXXXXX)
-		fmt.Sscanf(lastPatient.MRN, "MRN-%d", &nextNumber)
-		nextNumber++
-	} else {
-		nextNumber = 1
+// ValidateMRN checks a value that has the shape of one of our MRNs, catching
+// mistyped numbers through the check digit. Other values are not MRNs and pass.
+func (s *PatientService) ValidateMRN(value string) error {
+	if !s.mrnFormat.Matches(value) {
+		return nil
 	}
-
-	return fmt.Sprintf("MRN-%06d", nextNumber), nil
+	return s.mrnFormat.Validate(value)
 }
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+)
+
+var (
+	ErrPortalAccessDenied = errors.New("access to this patient's records is not permitted")
+	ErrInvalidProxyUser   = errors.New("proxy user must be an active portal user with the PATIENT role")
+)
+
+// dependentAge is the age at which a delegation to a child's mother or head
+// of household ends
+const dependentAge = 18
+
+// PortalAccessService decides which patient records a portal user may see
+type PortalAccessService struct {
+	repo       *repository.PortalDelegationRepository
+	households *repository.HouseholdRepository
+	users      *repository.UserRepository
+	patients   *PatientService
+	consents   *ConsentService
+}
+
+func NewPortalAccessService(repo *repository.PortalDelegationRepository, households *repository.HouseholdRepository,
+	users *repository.UserRepository, patients *PatientService, consents *ConsentService) *PortalAccessService {
+	return &PortalAccessService{repo: repo, households: households, users: users, patients: patients, consents: consents}
+}
+
+// ResolvePatientID returns the patient the portal user is acting for.
+// With no requested patient the user's own record is used; any other patient
+// requires an active delegation to the user, dependents included (see
+// DelegateDependents). Either way the patient must have consented to portal
+// access, otherwise ErrConsentRequired is returned.
+func (s *PortalAccessService) ResolvePatientID(userID uint, ownPatientID *uint, requestedPatientID uint) (uint, error) {
+	patientID, err := s.accessiblePatientID(userID, ownPatientID, requestedPatientID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.consents.RequireConsent(patientID, models.ConsentScopePortalAccess); err != nil {
+		return 0, err
+	}
+	return patientID, nil
+}
+
+func (s *PortalAccessService) accessiblePatientID(userID uint, ownPatientID *uint, requestedPatientID uint) (uint, error) {
+	if requestedPatientID == 0 {
+		if ownPatientID == nil {
+			return 0, ErrPortalAccessDenied
+		}
+		return *ownPatientID, nil
+	}
+
+	if ownPatientID != nil && *ownPatientID == requestedPatientID {
+		return requestedPatientID, nil
+	}
+
+	allowed, err := s.repo.HasActiveDelegation(userID, requestedPatientID)
+	if err != nil {
+		return 0, err
+	}
+	if !allowed {
+		return 0, ErrPortalAccessDenied
+	}
+	return requestedPatientID, nil
+}
+
+// CreateDelegation grants a portal user access to a patient's records. The
+// proxy must be an active PATIENT user and the patient must exist; a missing
+// user or patient is reported as repository.ErrNotFound.
+func (s *PortalAccessService) CreateDelegation(ctx context.Context, delegation *models.PortalDelegation) (*models.PortalDelegation, error) {
+	proxy, err := s.users.FindByID(delegation.ProxyUserID)
+	if err != nil {
+		return nil, fmt.Errorf("proxy user %d: %w", delegation.ProxyUserID, err)
+	}
+	if proxy.Role != models.RolePatient || !proxy.Active {
+		return nil, ErrInvalidProxyUser
+	}
+	if _, err := s.patients.GetPatientByID(delegation.PatientID); err != nil {
+		return nil, fmt.Errorf("patient %d: %w", delegation.PatientID, err)
+	}
+
+	if delegation.ValidFrom.IsZero() {
+		delegation.ValidFrom = time.Now()
+	}
+	if delegation.ValidUntil != nil && !delegation.ValidUntil.After(delegation.ValidFrom) {
+		return nil, errors.New("valid_until must be after valid_from")
+	}
+	return s.repo.Create(ctx, delegation)
+}
+
+// DelegateDependents grants a portal user access to the dependents of their
+// own record (see ListDependents) they do not have an active delegation for
+// yet. Each delegation ends when the child turns dependentAge, and can be
+// revoked like any other. The delegations created are returned.
+func (s *PortalAccessService) DelegateDependents(ctx context.Context, proxyUserID, grantedBy uint) ([]*models.PortalDelegation, error) {
+	proxy, err := s.users.FindByID(proxyUserID)
+	if err != nil {
+		return nil, fmt.Errorf("proxy user %d: %w", proxyUserID, err)
+	}
+	if proxy.Role != models.RolePatient || !proxy.Active || proxy.PatientID == nil {
+		return nil, ErrInvalidProxyUser
+	}
+	dependents, err := s.ListDependents(proxy.PatientID)
+	if err != nil {
+		return nil, err
+	}
+
+	created := []*models.PortalDelegation{}
+	for _, dependent := range dependents {
+		delegated, err := s.repo.HasActiveDelegation(proxyUserID, dependent.ID)
+		if err != nil {
+			return nil, err
+		}
+		if delegated || dependent.BirthDate == nil {
+			continue
+		}
+		adult := dependent.BirthDate.AddDate(dependentAge, 0, 0)
+		delegation := &models.PortalDelegation{
+			ProxyUserID:  proxyUserID,
+			PatientID:    dependent.ID,
+			Relationship: "guardian",
+			ValidFrom:    time.Now(),
+			ValidUntil:   &adult,
+			GrantedBy:    grantedBy,
+			Notes:        "Household dependent",
+		}
+		if dependent.MotherID != nil && *dependent.MotherID == *proxy.PatientID {
+			delegation.Relationship = "parent"
+		}
+		if _, err := s.repo.Create(ctx, delegation); err != nil {
+			return nil, err
+		}
+		created = append(created, delegation)
+	}
+	return created, nil
+}
+
+func (s *PortalAccessService) RevokeDelegation(ctx context.Context, id uint, reason string, revokedBy uint) (*models.PortalDelegation, error) {
+	delegation, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if delegation.RevokedAt != nil {
+		return nil, errors.New("delegation is already revoked")
+	}
+	delegation.Revoke(reason, revokedBy)
+	return s.repo.Update(ctx, delegation)
+}
+
+func (s *PortalAccessService) ListProxyDelegations(proxyUserID uint) ([]*models.PortalDelegation, error) {
+	return s.repo.ListActiveByProxy(proxyUserID)
+}
+
+func (s *PortalAccessService) ListPatientDelegations(patientID uint) ([]*models.PortalDelegation, error) {
+	return s.repo.ListByPatient(patientID)
+}
+
+// ListDependents returns the children under dependentAge whose mother is the
+// patient, or who live in a household the patient heads. Their records are
+// only open to the patient's portal login through a delegation.
+func (s *PortalAccessService) ListDependents(ownPatientID *uint) ([]*models.Patient, error) {
+	if ownPatientID == nil {
+		return []*models.Patient{}, nil
+	}
+	return s.households.ListDependents(*ownPatientID, dependentCutoff())
+}
+
+func dependentCutoff() time.Time {
+	return time.Now().AddDate(-dependentAge, 0, 0)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/code-and-brain/zarish-his-1/backend/internal/models"
+	"github.com/code-and-brain/zarish-his-1/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestPortalAccessService(t *testing.T, db *gorm.DB) *PortalAccessService {
+	t.Helper()
+	patients := newTestPatientService(t, db)
+	return NewPortalAccessService(repository.NewPortalDelegationRepository(db), repository.NewHouseholdRepository(db),
+		repository.NewUserRepository(db), patients, NewConsentService(repository.NewConsentRepository(db), patients))
+}
+
+func TestResolvePatientID(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestPortalAccessService(t, db)
+	ctx := context.Background()
+
+	// portalPatient is a patient who consented to portal access
+	portalPatient := func(name string) *models.Patient {
+		patient := createTestPatient(t, db, name)
+		recordConsent(t, db, patient.ID, models.ConsentScopePortalAccess, models.ConsentStatusActive)
+		return patient
+	}
+	own := portalPatient("own")
+	user := createTestUser(t, db, models.RolePatient, &own.ID)
+	delegate := func(patientID uint, validUntil *time.Time) *models.PortalDelegation {
+		delegation, err := s.CreateDelegation(ctx, &models.PortalDelegation{
+			ProxyUserID: user.ID, PatientID: patientID, Relationship: "caregiver", ValidFrom: time.Now().Add(-2 * time.Hour), ValidUntil: validUntil,
+		})
+		require.NoError(t, err)
+		return delegation
+	}
+
+	delegated := portalPatient("delegated")
+	delegate(delegated.ID, nil)
+	revoked := portalPatient("revoked")
+	_, err := s.RevokeDelegation(ctx, delegate(revoked.ID, nil).ID, "no longer caring", 1)
+	require.NoError(t, err)
+	expired := portalPatient("expired")
+	hourAgo := time.Now().Add(-time.Hour)
+	delegate(expired.ID, &hourAgo)
+	unconsented := createTestPatient(t, db, "unconsented")
+	delegate(unconsented.ID, nil)
+	stranger := portalPatient("stranger")
+
+	child := portalPatient("child")
+	born := time.Now().AddDate(-5, 0, 0)
+	require.NoError(t, db.Model(child).UpdateColumns(map[string]interface{}{"mother_id": own.ID, "birth_date": born}).Error)
+
+	tests := []struct {
+		name      string
+		own       *uint
+		requested uint
+		want      uint
+		wantErr   error
+	}{
+		{"own record", &own.ID, 0, own.ID, nil},
+		{"own record requested", &own.ID, own.ID, own.ID, nil},
+		{"no own record", nil, 0, 0, ErrPortalAccessDenied},
+		{"delegated", &own.ID, delegated.ID, delegated.ID, nil},
+		{"revoked delegation", &own.ID, revoked.ID, 0, ErrPortalAccessDenied},
+		{"expired delegation", &own.ID, expired.ID, 0, ErrPortalAccessDenied},
+		{"delegated without consent", &own.ID, unconsented.ID, 0, ErrConsentRequired},
+		{"no delegation", &own.ID, stranger.ID, 0, ErrPortalAccessDenied},
+		{"child without a delegation", &own.ID, child.ID, 0, ErrPortalAccessDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ResolvePatientID(user.ID, tt.own, tt.requested)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Delegating the dependents opens the child until it turns 18, once
+	created, err := s.DelegateDependents(ctx, user.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, created, 1)
+	assert.Equal(t, child.ID, created[0].PatientID)
+	assert.Equal(t, "parent", created[0].Relationship)
+	require.NotNil(t, created[0].ValidUntil)
+	assert.True(t, born.AddDate(dependentAge, 0, 0).Equal(*created[0].ValidUntil))
+	got, err := s.ResolvePatientID(user.ID, &own.ID, child.ID)
+	require.NoError(t, err)
+	assert.Equal(t, child.ID, got)
+
+	created, err = s.DelegateDependents(ctx, user.ID, 1)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+
+	staff := createTestUser(t, db, models.RoleNurse, nil)
+	_, err = s.DelegateDependents(ctx, staff.ID, 1)
+	assert.ErrorIs(t, err, ErrInvalidProxyUser)
+}
+
+func TestCreateDelegation(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestPortalAccessService(t, db)
+	ctx := context.Background()
+
+	patient := createTestPatient(t, db, "delegated")
+	proxy := createTestUser(t, db, models.RolePatient, nil)
+	staff := createTestUser(t, db, models.RoleNurse, nil)
+	inactive := createTestUser(t, db, models.RolePatient, nil)
+	require.NoError(t, db.Model(inactive).Update("active", false).Error)
+	from := time.Now()
+	before := from.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		proxyID   uint
+		patientID uint
+		wantErr   error
+	}{
+		{"valid", proxy.ID, patient.ID, nil},
+		{"unknown proxy user", proxy.ID + 1000, patient.ID, repository.ErrNotFound},
+		{"staff proxy user", staff.ID, patient.ID, ErrInvalidProxyUser},
+		{"inactive proxy user", inactive.ID, patient.ID, ErrInvalidProxyUser},
+		{"unknown patient", proxy.ID, patient.ID + 1000, repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := s.CreateDelegation(ctx, &models.PortalDelegation{
+				ProxyUserID: tt.proxyID, PatientID: tt.patientID, Relationship: "caregiver", ValidFrom: from,
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, created)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotZero(t, created.ID)
+		})
+	}
+
+	_, err := s.CreateDelegation(ctx, &models.PortalDelegation{
+		ProxyUserID: proxy.ID, PatientID: patient.ID, Relationship: "caregiver", ValidFrom: from, ValidUntil: &before,
+	})
+	assert.EqualError(t, err, "valid_until must be after valid_from")
+}
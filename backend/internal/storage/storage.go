@@ -0,0 +1,64 @@
+// Package storage keeps binary objects such as patient photos outside the
+// database, on the local filesystem or in an S3-compatible object store.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Store is a flat key/value store of objects. Keys are slash-separated paths
+// such as "patients/42/photos/ab12/original.jpg".
+type Store interface {
+	Put(key string, data []byte, contentType string) error
+	// Get returns the object and its content type, or ErrNotFound
+	Get(key string) ([]byte, string, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(key string) error
+}
+
+// Config selects and configures a Store
+type Config struct {
+	Backend string // local (default) or s3
+
+	// local
+	Dir string
+
+	// s3
+	Endpoint        string // e.g. https://s3.ap-southeast-1.amazonaws.com or http://minio:9000
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// New returns the Store configured by cfg
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStore(cfg.Dir)
+	case "s3":
+		return NewS3Store(cfg.Endpoint, cfg.Bucket, cfg.Region, cfg.AccessKeyID, cfg.SecretAccessKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// checkKey rejects keys that could escape the store, e.g. "../x" or "/etc/x"
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
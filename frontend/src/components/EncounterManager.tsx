@@ -159,7 +159,7 @@ const EncounterManager: React.FC<Props> = ({ patientId }) => {
                         Mark Arrived
                       </button>
                     )}
-                    {encounter.status === 'arrived' && (
+                    {(encounter.status === 'arrived' || encounter.status === 'triaged') && (
                       <button
                         onClick={() => handleStatusUpdate(encounter.id, 'in-progress')}
                         className="text-xs text-green-600 hover:underline"
@@ -59,20 +59,20 @@ const TransferModal: React.FC<TransferModalProps> = ({
 
   useEffect(() => {
     // Fetch wards
-    fetch('/api/v1/wards')
+    fetch('/api/v1/wards?limit=100')
       .then((res) => res.json())
-      .then((data) => setWards(data))
+      .then((page) => setWards(page.data))
       .catch((err) => console.error('Failed to fetch wards:', err));
   }, []);
 
   useEffect(() => {
     // Fetch available beds when ward is selected
     if (formData.to_ward_id > 0) {
-      fetch(`/api/v1/beds?status=Available`)
+      fetch(`/api/v1/beds?status=Available&limit=100`)
         .then((res) => res.json())
-        .then((data: BedOption[]) => {
+        .then((page: { data: BedOption[] }) => {
           // Filter beds by selected ward (assuming beds have ward_id)
-          setAvailableBeds(data);
+          setAvailableBeds(page.data);
         })
         .catch((err) => console.error('Failed to fetch beds:', err));
     }
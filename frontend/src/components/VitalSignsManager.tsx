@@ -1,7 +1,11 @@
 import React, { useEffect, useState } from 'react';
 import { VitalSignsService } from '../services/vitalSignsService';
 import { EncounterService } from '../services/encounterService';
-import type { VitalSigns, Encounter } from '../types';
+import type { VitalSigns, VitalFlag, Encounter } from '../types';
+
+// Values outside the reference range for the patient's age, sex and pregnancy
+const flagClass = (...flags: (VitalFlag | undefined)[]) =>
+  flags.some(flag => flag === 'low' || flag === 'high') ? 'text-red-600 font-semibold' : '';
 
 interface Props {
   patientId: number;
@@ -150,10 +154,10 @@ const VitalSignsManager: React.FC<Props> = ({ patientId }) => {
               {vitalsList.map((vitals) => (
                 <tr key={vitals.id}>
                   <td className="px-4 py-2 whitespace-nowrap">{new Date(vitals.measured_at).toLocaleString()}</td>
-                  <td className="px-4 py-2">{vitals.systolic_bp}/{vitals.diastolic_bp}</td>
-                  <td className="px-4 py-2">{vitals.pulse_rate}</td>
-                  <td className="px-4 py-2">{vitals.temperature}°C</td>
-                  <td className="px-4 py-2">{vitals.spo2}%</td>
+                  <td className={`px-4 py-2 ${flagClass(vitals.systolic_bp_flag, vitals.diastolic_bp_flag)}`}>{vitals.systolic_bp}/{vitals.diastolic_bp}</td>
+                  <td className={`px-4 py-2 ${flagClass(vitals.pulse_rate_flag)}`}>{vitals.pulse_rate}</td>
+                  <td className={`px-4 py-2 ${flagClass(vitals.temperature_flag)}`}>{vitals.temperature}°C</td>
+                  <td className={`px-4 py-2 ${flagClass(vitals.spo2_flag)}`}>{vitals.spo2}%</td>
                   <td className="px-4 py-2 font-medium">{vitals.bmi?.toFixed(1)}</td>
                 </tr>
               ))}
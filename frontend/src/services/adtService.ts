@@ -1,3 +1,4 @@
+import type { Page } from '../types';
 import type { Admission, Bed, Room, Ward } from '../types/adt';
 import api from './api';
 
@@ -9,8 +10,8 @@ export const ADTService = {
   },
 
   listWards: async (): Promise<Ward[]> => {
-    const response = await api.get<Ward[]>('/wards');
-    return response.data;
+    const response = await api.get<Page<Ward>>('/wards', { params: { limit: 100 } });
+    return response.data.data;
   },
 
   // Rooms
@@ -26,9 +27,9 @@ export const ADTService = {
   },
 
   listBeds: async (status?: string): Promise<Bed[]> => {
-    const params = status ? { status } : {};
-    const response = await api.get<Bed[]>('/beds', { params });
-    return response.data;
+    const params = status ? { status, limit: 100 } : { limit: 100 };
+    const response = await api.get<Page<Bed>>('/beds', { params });
+    return response.data.data;
   },
 
   // Admissions
@@ -42,8 +43,8 @@ export const ADTService = {
   },
 
   listActiveAdmissions: async (): Promise<Admission[]> => {
-    const response = await api.get<Admission[]>('/admissions/active');
-    return response.data;
+    const response = await api.get<Page<Admission>>('/admissions/active', { params: { limit: 100 } });
+    return response.data.data;
   },
 
   getAdmission: async (id: number): Promise<Admission> => {
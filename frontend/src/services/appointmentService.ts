@@ -1,5 +1,5 @@
 import api from './api';
-import type { Appointment } from '../types';
+import type { Appointment, Page } from '../types';
 
 export const AppointmentService = {
   create: async (appointment: Partial<Appointment>): Promise<Appointment> => {
@@ -23,12 +23,12 @@ export const AppointmentService = {
   },
 
   listByDate: async (date: string): Promise<Appointment[]> => {
-    const response = await api.get<Appointment[]>('/appointments', { params: { date } });
-    return response.data;
+    const response = await api.get<Page<Appointment>>('/appointments', { params: { date, limit: 100 } });
+    return response.data.data;
   },
 
   listByPatient: async (patientId: number): Promise<Appointment[]> => {
-    const response = await api.get<Appointment[]>(`/patients/${patientId}/appointments`);
-    return response.data;
+    const response = await api.get<Page<Appointment>>(`/patients/${patientId}/appointments`);
+    return response.data.data;
   },
 };
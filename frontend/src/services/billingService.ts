@@ -1,3 +1,4 @@
+import type { Page } from '../types';
 import type { InsuranceClaim, Invoice, Payment } from '../types/billing';
 import api from './api';
 
@@ -21,8 +22,8 @@ export const billingService = {
   },
 
   getOutstandingInvoices: async (): Promise<Invoice[]> => {
-    const response = await api.get<Invoice[]>('/billing/invoices/outstanding');
-    return response.data;
+    const response = await api.get<Page<Invoice>>('/billing/invoices/outstanding', { params: { limit: 100 } });
+    return response.data.data;
   },
 
   // Payment Operations
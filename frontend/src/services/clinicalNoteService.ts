@@ -1,5 +1,5 @@
 import api from './api';
-import type { ClinicalNote } from '../types';
+import type { ClinicalNote, Page } from '../types';
 
 export const ClinicalNoteService = {
   create: async (note: Partial<ClinicalNote>): Promise<ClinicalNote> => {
@@ -28,7 +28,7 @@ export const ClinicalNoteService = {
   },
 
   listByPatient: async (patientId: number, limit = 20): Promise<ClinicalNote[]> => {
-    const response = await api.get<ClinicalNote[]>(`/patients/${patientId}/clinical-notes`, { params: { limit } });
-    return response.data;
+    const response = await api.get<Page<ClinicalNote>>(`/patients/${patientId}/clinical-notes`, { params: { limit } });
+    return response.data.data;
   },
 };
@@ -1,5 +1,5 @@
 import api from './api';
-import type { Encounter } from '../types';
+import type { Encounter, Page } from '../types';
 
 export const EncounterService = {
   create: async (encounter: Partial<Encounter>): Promise<Encounter> => {
@@ -22,9 +22,9 @@ export const EncounterService = {
     return response.data;
   },
 
-  listByPatient: async (patientId: number, page = 1, limit = 20) => {
-    const params = { page, limit };
-    const response = await api.get<{ data: Encounter[]; total: number }>(`/patients/${patientId}/encounters`, { params });
+  listByPatient: async (patientId: number, cursor?: string, limit = 20) => {
+    const params = cursor ? { cursor, limit } : { limit };
+    const response = await api.get<Page<Encounter>>(`/patients/${patientId}/encounters`, { params });
     return response.data;
   },
 };
@@ -1,5 +1,5 @@
 import api from './api';
-import type { LabTest, LabOrder, LabResult } from '../types';
+import type { LabTest, LabOrder, LabResult, Page } from '../types';
 
 export const LabService = {
   // Lab Tests
@@ -9,8 +9,8 @@ export const LabService = {
   },
 
   listTests: async (): Promise<LabTest[]> => {
-    const response = await api.get<LabTest[]>('/lab-tests');
-    return response.data;
+    const response = await api.get<Page<LabTest>>('/lab-tests', { params: { limit: 100 } });
+    return response.data.data;
   },
 
   // Lab Orders
@@ -25,8 +25,8 @@ export const LabService = {
   },
 
   listPatientOrders: async (patientId: number): Promise<LabOrder[]> => {
-    const response = await api.get<LabOrder[]>(`/patients/${patientId}/lab-orders`);
-    return response.data;
+    const response = await api.get<Page<LabOrder>>(`/patients/${patientId}/lab-orders`);
+    return response.data.data;
   },
 
   // Lab Results
@@ -1,4 +1,4 @@
-import type { Medication, Prescription } from '../types';
+import type { Medication, Page, Prescription } from '../types';
 import api from './api';
 
 export const MedicationService = {
@@ -45,10 +45,10 @@ export const MedicationService = {
     patientId: number,
     activeOnly = false
   ): Promise<Prescription[]> => {
-    const response = await api.get<Prescription[]>(
+    const response = await api.get<Page<Prescription>>(
       `/patients/${patientId}/prescriptions`,
       { params: { active: activeOnly } }
     );
-    return response.data;
+    return response.data.data;
   },
 };
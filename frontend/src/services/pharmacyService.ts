@@ -1,6 +1,6 @@
 import api from './api';
 import type { PharmacyStock, Dispensing, StockMovement } from '../types/pharmacy';
-import type { Prescription } from '../types';
+import type { Page, Prescription } from '../types';
 
 export const PharmacyService = {
     // Stock Management
@@ -15,8 +15,8 @@ export const PharmacyService = {
     },
 
     getLowStock: async () => {
-        const response = await api.get<PharmacyStock[]>('/pharmacy/stock/low');
-        return response.data;
+        const response = await api.get<Page<PharmacyStock>>('/pharmacy/stock/low', { params: { limit: 100 } });
+        return response.data.data;
     },
 
     // Dispensing
@@ -26,13 +26,13 @@ export const PharmacyService = {
     },
 
     getDispensingQueue: async () => {
-        const response = await api.get<Prescription[]>('/pharmacy/dispensing-queue');
-        return response.data;
+        const response = await api.get<Page<Prescription>>('/pharmacy/dispensing-queue', { params: { limit: 100 } });
+        return response.data.data;
     },
 
     getPatientHistory: async (patientId: number) => {
-        const response = await api.get<Dispensing[]>(`/pharmacy/history/${patientId}`);
-        return response.data;
+        const response = await api.get<Page<Dispensing>>(`/pharmacy/history/${patientId}`);
+        return response.data.data;
     },
 
     // Stock Movements
@@ -1,3 +1,4 @@
+import type { Page } from '../types';
 import type { ImagingStudy, RadiologyReport } from '../types/radiology';
 import api from './api';
 
@@ -10,16 +11,17 @@ export const RadiologyService = {
 
   // List studies with filtering
   listStudies: async (
-    page = 1,
+    cursor?: string,
     limit = 20,
     patientId?: number,
     status?: string
   ) => {
-    const params: any = { page, limit };
+    const params: any = { limit };
+    if (cursor) params.cursor = cursor;
     if (patientId) params.patient_id = patientId;
     if (status) params.status = status;
 
-    const response = await api.get<{ data: ImagingStudy[]; total: number }>(
+    const response = await api.get<Page<ImagingStudy>>(
       '/radiology/studies',
       { params }
     );
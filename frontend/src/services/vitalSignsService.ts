@@ -1,5 +1,5 @@
 import api from './api';
-import type { VitalSigns } from '../types';
+import type { Page, VitalSigns } from '../types';
 
 export const VitalSignsService = {
   create: async (vitals: Partial<VitalSigns>): Promise<VitalSigns> => {
@@ -18,7 +18,7 @@ export const VitalSignsService = {
   },
 
   listByPatient: async (patientId: number, limit = 10): Promise<VitalSigns[]> => {
-    const response = await api.get<VitalSigns[]>(`/patients/${patientId}/vital-signs`, { params: { limit } });
-    return response.data;
+    const response = await api.get<Page<VitalSigns>>(`/patients/${patientId}/vital-signs`, { params: { limit } });
+    return response.data.data;
   },
 };
@@ -44,6 +44,9 @@ export interface VitalSigns {
   encounter_id: number;
   patient_id: number;
   measured_at: string;
+  source?: 'manual' | 'device';
+  device_id?: number;
+  verification_status?: 'pending' | 'validated' | 'rejected';
   systolic_bp?: number;
   diastolic_bp?: number;
   pulse_rate?: number;
@@ -52,11 +55,23 @@ export interface VitalSigns {
   spo2?: number;
   weight?: number;
   height?: number;
+  length_position?: 'recumbent' | 'standing';
+  muac?: number;
+  oedema?: boolean;
   bmi?: number;
   pain_scale?: number;
+  pregnant?: boolean;
+  systolic_bp_flag?: VitalFlag;
+  diastolic_bp_flag?: VitalFlag;
+  pulse_rate_flag?: VitalFlag;
+  respiratory_rate_flag?: VitalFlag;
+  temperature_flag?: VitalFlag;
+  spo2_flag?: VitalFlag;
   notes?: string;
 }
 
+export type VitalFlag = 'low' | 'normal' | 'high';
+
 export interface ClinicalNote {
   id: number;
   encounter_id: number;
@@ -142,3 +157,10 @@ export interface Appointment {
   scheduled_end: string;
   reason?: string;
 }
+
+// One page of a list endpoint; pass next_cursor as cursor for the next page
+export interface Page<T> {
+  data: T[];
+  next_cursor: string;
+  total: number;
+}